@@ -15,6 +15,8 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/egressor/egressor/src/internal/agent"
+	"github.com/egressor/egressor/src/internal/queue"
+	"github.com/egressor/egressor/src/internal/transport"
 )
 
 var (
@@ -37,9 +39,27 @@ metadata, and exports it to the Egressor collector.`,
 	rootCmd.Flags().String("collector-endpoint", "egressor-collector:4317", "Collector gRPC endpoint")
 	rootCmd.Flags().String("cgroup-path", "/sys/fs/cgroup", "Cgroup v2 mount path")
 	rootCmd.Flags().String("node-name", "", "Kubernetes node name (from downward API)")
+	rootCmd.Flags().StringSlice("node-name-sources", agent.DefaultNodeNameSources, "Where to look for the node name, in order (flag, env, file, hostname)")
+	rootCmd.Flags().String("node-name-env", "NODE_NAME", "Environment variable holding the node name")
+	rootCmd.Flags().String("node-name-file", "/etc/podinfo/nodename", "Downward API file holding the node name")
 	rootCmd.Flags().String("cluster-name", "", "Kubernetes cluster name")
+	rootCmd.Flags().String("cloud-provider", "", "Cloud provider billing this node's traffic: aws, gcp or azure (default: from the node's provider ID)")
 	rootCmd.Flags().StringSlice("cluster-cidrs", []string{"10.0.0.0/8", "172.16.0.0/12"}, "Cluster CIDR ranges")
+	rootCmd.Flags().StringSlice("remote-clusters", nil, "Other clusters' pod ranges as name=cidr (e.g. prod-eu=10.64.0.0/14), classified cross-cluster; must lie inside --cluster-cidrs")
 	rootCmd.Flags().Duration("export-interval", 30*time.Second, "Interval to export flow data")
+	rootCmd.Flags().Int("event-buffer-size", 10000, "Capacity of the agent's export event queue")
+	rootCmd.Flags().String("overflow-policy", "drop-newest", "What to do when the event queue is full (drop-newest, drop-oldest, block)")
+	rootCmd.Flags().Duration("overflow-timeout", time.Second, "Maximum wait for room under the block overflow policy")
+	rootCmd.Flags().String("timestamp-source", "kernel", "Event timestamps from the eBPF clock (kernel) or when the agent reads them (now)")
+	rootCmd.Flags().String("ephemeral-ports", "", "Client port range (e.g. 30000-60000) dropped from flows to service ports so they aggregate; empty keeps source ports")
+	rootCmd.Flags().String("grpc-compression", "", "gRPC compression for collector export (e.g. gzip)")
+	rootCmd.Flags().Bool("tls-enabled", false, "Use TLS when connecting to the collector")
+	rootCmd.Flags().String("tls-ca-file", "", "CA bundle for verifying the collector certificate")
+	rootCmd.Flags().String("tls-cert-file", "", "Client certificate for mTLS")
+	rootCmd.Flags().String("tls-key-file", "", "Client private key for mTLS")
+	rootCmd.Flags().String("tls-server-name", "", "Expected collector server name")
+	rootCmd.Flags().String("geoip-country-db", "", "Path to MaxMind GeoIP2/GeoLite2 country database")
+	rootCmd.Flags().String("geoip-asn-db", "", "Path to MaxMind GeoLite2 ASN database")
 	rootCmd.Flags().Bool("debug", false, "Enable debug logging")
 
 	// Bind to viper
@@ -79,16 +99,43 @@ func run(cmd *cobra.Command, args []string) error {
 	cfg := agent.Config{
 		CollectorEndpoint: viper.GetString("collector-endpoint"),
 		CgroupPath:        viper.GetString("cgroup-path"),
-		NodeName:          viper.GetString("node-name"),
 		ClusterName:       viper.GetString("cluster-name"),
 		ClusterCIDRs:      viper.GetStringSlice("cluster-cidrs"),
+		RemoteClusters:    viper.GetStringSlice("remote-clusters"),
+		CloudProvider:     viper.GetString("cloud-provider"),
 		ExportInterval:    viper.GetDuration("export-interval"),
+		GRPCCompression:   viper.GetString("grpc-compression"),
+		EventBufferSize:   viper.GetInt("event-buffer-size"),
+		OverflowPolicy:    queue.OverflowPolicy(viper.GetString("overflow-policy")),
+		OverflowTimeout:   viper.GetDuration("overflow-timeout"),
+		TimestampSource:   agent.TimestampSource(viper.GetString("timestamp-source")),
+		EphemeralPorts:    viper.GetString("ephemeral-ports"),
+		TLS: transport.TLSConfig{
+			Enabled:    viper.GetBool("tls-enabled"),
+			CAFile:     viper.GetString("tls-ca-file"),
+			CertFile:   viper.GetString("tls-cert-file"),
+			KeyFile:    viper.GetString("tls-key-file"),
+			ServerName: viper.GetString("tls-server-name"),
+		},
+		GeoIPCountryDB: viper.GetString("geoip-country-db"),
+		GeoIPASNDB:     viper.GetString("geoip-asn-db"),
 	}
 
-	// Get node name from environment if not set
-	if cfg.NodeName == "" {
-		cfg.NodeName = os.Getenv("NODE_NAME")
+	nodeName, source, err := agent.ResolveNodeName(agent.NodeNameConfig{
+		Sources: viper.GetStringSlice("node-name-sources"),
+		Flag:    viper.GetString("node-name"),
+		EnvVar:  viper.GetString("node-name-env"),
+		File:    viper.GetString("node-name-file"),
+	})
+	if err != nil {
+		return fmt.Errorf("resolving node name: %w", err)
+	}
+	if nodeName == "" {
+		log.Warn().Strs("sources", viper.GetStringSlice("node-name-sources")).Msg("No node name found; events will lack node context")
+	} else {
+		log.Info().Str("node", nodeName).Str("source", source).Msg("Resolved node name")
 	}
+	cfg.NodeName = nodeName
 
 	// Create and start agent
 	ctx, cancel := context.WithCancel(context.Background())
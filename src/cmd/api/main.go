@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/egressor/egressor/src/internal/api"
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
 )
 
 var (
@@ -39,6 +43,33 @@ querying transfer data, costs, anomalies, and AI-powered analysis.`,
 	rootCmd.Flags().String("postgres-dsn", "postgres://localhost:5432/egressor", "PostgreSQL DSN")
 	rootCmd.Flags().String("intelligence-url", "http://localhost:8090", "Intelligence service URL")
 	rootCmd.Flags().StringSlice("cors-origins", []string{"http://localhost:3000"}, "CORS allowed origins")
+	rootCmd.Flags().StringSlice("cost-exempt-region-pairs", nil, "Free region pairs (source-region:destination-region,...)")
+	rootCmd.Flags().StringSlice("cost-exempt-cidrs", nil, "Destination CIDRs whose traffic is free")
+	rootCmd.Flags().StringSlice("cost-label-dimensions", nil, "Label keys mapped to attribution dimensions (label=dimension,...)")
+	rootCmd.Flags().StringSlice("cost-packet-overhead", nil, "Header bytes billed per packet by protocol, e.g. TCP=40,UDP=28,default=40")
+	rootCmd.Flags().Duration("default-query-range", 24*time.Hour, "Time range for query endpoints when none is given")
+	rootCmd.Flags().Duration("max-query-range", 31*24*time.Hour, "Maximum time range a query may request")
+	rootCmd.Flags().Bool("structured-request-logs", true, "Log requests as structured JSON with query context")
+	rootCmd.Flags().StringSlice("trusted-destinations", nil, "Destinations that never raise new-endpoint or leak anomalies (hostname, *.domain, IP, or CIDR)")
+	rootCmd.Flags().StringSlice("suspicious-destinations", engine.DefaultSuspiciousPatterns, "Egress destinations raising anomalies on first use (*.domain, hostname, or ip; optional =info or =medium)")
+	rootCmd.Flags().String("anomaly-detection", "zscore", "Anomaly detection mode (zscore, percentile)")
+	rootCmd.Flags().Int("anomaly-percentile", 99, "Baseline percentile for percentile detection (95, 99)")
+	rootCmd.Flags().Float64("anomaly-percentile-multiplier", 1.0, "Multiplier applied to the baseline percentile")
+	rootCmd.Flags().Float64("anomaly-min-delta-bytes", 1<<20, "Smallest change from baseline in bytes per hour that can be anomalous (0 disables)")
+	rootCmd.Flags().Int("baseline-min-samples", 24, "Hourly values needed to build a baseline")
+	rootCmd.Flags().Int("baseline-confidence-samples", 0, "Samples a baseline needs before it raises anomalies (0 disables)")
+	rootCmd.Flags().Duration("anomaly-escalation-interval", 0, "Raise active anomalies one severity level per interval they persist (0 disables)")
+	rootCmd.Flags().Duration("cost-metrics-interval", time.Minute, "How often cost gauges on /metrics are refreshed")
+	rootCmd.Flags().Int("cost-metrics-top-n", 20, "Namespaces exported individually in cost gauges; the rest are combined")
+	rootCmd.Flags().String("fx-rate-source", "", "URL serving USD-based exchange rates as JSON; empty disables refresh")
+	rootCmd.Flags().Duration("fx-refresh-interval", time.Hour, "How often exchange rates are refreshed")
+	rootCmd.Flags().StringSlice("fx-rates", nil, "Pinned exchange rates in units per USD (EUR=0.92,...)")
+	rootCmd.Flags().Duration("idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key are replayed")
+	rootCmd.Flags().String("graph-granularity", "service", "Graph node granularity (service, deployment, pod)")
+	rootCmd.Flags().Duration("initial-load-lookback", 0, "History loaded into the graph at startup; 0 uses the default query range")
+	rootCmd.Flags().Duration("initial-load-chunk", 24*time.Hour, "Time span queried at once while loading startup history")
+	rootCmd.Flags().String("otlp-endpoint", "", "OTLP/HTTP metrics URL the service graph is pushed to; empty disables export")
+	rootCmd.Flags().Duration("otlp-interval", time.Minute, "How often the service graph is pushed to the OTLP endpoint")
 	rootCmd.Flags().Bool("debug", false, "Enable debug logging")
 
 	viper.BindPFlags(rootCmd.Flags())
@@ -73,6 +104,29 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	exemptions, err := parseCostExemptions(
+		viper.GetStringSlice("cost-exempt-region-pairs"),
+		viper.GetStringSlice("cost-exempt-cidrs"),
+	)
+	if err != nil {
+		return err
+	}
+
+	labelDimensions, err := parseLabelDimensions(viper.GetStringSlice("cost-label-dimensions"))
+	if err != nil {
+		return err
+	}
+
+	packetOverhead, err := parsePacketOverhead(viper.GetStringSlice("cost-packet-overhead"))
+	if err != nil {
+		return err
+	}
+
+	fxRates, err := parseFXRates(viper.GetStringSlice("fx-rates"))
+	if err != nil {
+		return err
+	}
+
 	cfg := api.Config{
 		HTTPListen:      viper.GetString("http-listen"),
 		GRPCListen:      viper.GetString("grpc-listen"),
@@ -80,6 +134,35 @@ func run(cmd *cobra.Command, args []string) error {
 		PostgresDSN:     viper.GetString("postgres-dsn"),
 		IntelligenceURL: viper.GetString("intelligence-url"),
 		CORSOrigins:     viper.GetStringSlice("cors-origins"),
+		CostExemptions:  exemptions,
+		LabelDimensions: labelDimensions,
+		PacketOverhead:  packetOverhead,
+
+		DefaultQueryRange:      viper.GetDuration("default-query-range"),
+		MaxQueryRange:          viper.GetDuration("max-query-range"),
+		StructuredRequestLogs:  viper.GetBool("structured-request-logs"),
+		TrustedDestinations:    viper.GetStringSlice("trusted-destinations"),
+		SuspiciousDestinations: viper.GetStringSlice("suspicious-destinations"),
+		AnomalyDetection: engine.DetectionConfig{
+			Mode:             engine.DetectionMode(viper.GetString("anomaly-detection")),
+			Percentile:       viper.GetInt("anomaly-percentile"),
+			Multiplier:       viper.GetFloat64("anomaly-percentile-multiplier"),
+			MinAbsoluteDelta: viper.GetFloat64("anomaly-min-delta-bytes"),
+		},
+		AnomalyEscalationInterval: viper.GetDuration("anomaly-escalation-interval"),
+		BaselineMinSamples:        viper.GetInt("baseline-min-samples"),
+		BaselineConfidenceSamples: viper.GetInt("baseline-confidence-samples"),
+		CostMetricsInterval:       viper.GetDuration("cost-metrics-interval"),
+		CostMetricsTopN:           viper.GetInt("cost-metrics-top-n"),
+		FXRateSource:              viper.GetString("fx-rate-source"),
+		FXRefreshInterval:         viper.GetDuration("fx-refresh-interval"),
+		FXRates:                   fxRates,
+		IdempotencyTTL:            viper.GetDuration("idempotency-ttl"),
+		GraphGranularity:          viper.GetString("graph-granularity"),
+		InitialLoadLookback:       viper.GetDuration("initial-load-lookback"),
+		InitialLoadChunk:          viper.GetDuration("initial-load-chunk"),
+		OTLPEndpoint:              viper.GetString("otlp-endpoint"),
+		OTLPInterval:              viper.GetDuration("otlp-interval"),
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -113,3 +196,69 @@ func run(cmd *cobra.Command, args []string) error {
 	log.Info().Msg("API server stopped")
 	return nil
 }
+
+// parseCostExemptions builds cost exemptions from region pairs and CIDRs.
+func parseCostExemptions(regionPairs, cidrs []string) ([]types.CostExemption, error) {
+	var exemptions []types.CostExemption
+	for _, pair := range regionPairs {
+		src, dst, ok := strings.Cut(pair, ":")
+		if !ok || src == "" || dst == "" {
+			return nil, fmt.Errorf("invalid cost exemption region pair %q, want source:destination", pair)
+		}
+		exemptions = append(exemptions, types.CostExemption{
+			Name:              pair,
+			SourceRegion:      src,
+			DestinationRegion: dst,
+		})
+	}
+	for _, cidr := range cidrs {
+		exemptions = append(exemptions, types.CostExemption{
+			Name:            cidr,
+			DestinationCIDR: cidr,
+		})
+	}
+	return exemptions, nil
+}
+
+// parseLabelDimensions builds the label key to attribution dimension mapping
+// from label=dimension pairs.
+func parseLabelDimensions(pairs []string) (map[string]string, error) {
+	mapping := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		label, dim, ok := strings.Cut(pair, "=")
+		if !ok || label == "" || dim == "" {
+			return nil, fmt.Errorf("invalid cost label dimension %q, want label=dimension", pair)
+		}
+		mapping[label] = dim
+	}
+	return mapping, nil
+}
+
+// parsePacketOverhead builds per-protocol packet overhead from
+// protocol=bytes pairs.
+func parsePacketOverhead(pairs []string) (map[string]uint64, error) {
+	overhead := make(map[string]uint64, len(pairs))
+	for _, pair := range pairs {
+		protocol, v, ok := strings.Cut(pair, "=")
+		bytes, err := strconv.ParseUint(v, 10, 32)
+		if !ok || protocol == "" || err != nil {
+			return nil, fmt.Errorf("invalid packet overhead %q, want protocol=bytes", pair)
+		}
+		overhead[protocol] = bytes
+	}
+	return overhead, nil
+}
+
+// parseFXRates builds pinned exchange rates from CURRENCY=rate pairs.
+func parseFXRates(pairs []string) (map[string]float64, error) {
+	rates := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		currency, v, ok := strings.Cut(pair, "=")
+		rate, err := strconv.ParseFloat(v, 64)
+		if !ok || currency == "" || err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q, want CURRENCY=rate", pair)
+		}
+		rates[strings.ToUpper(currency)] = rate
+	}
+	return rates, nil
+}
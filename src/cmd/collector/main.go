@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,6 +18,10 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/egressor/egressor/src/internal/collector"
+	"github.com/egressor/egressor/src/internal/queue"
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/internal/transport"
+	"github.com/egressor/egressor/src/pkg/types"
 )
 
 var (
@@ -32,16 +39,38 @@ normalizes them, and stores them in ClickHouse for analysis.`,
 	}
 
 	// Flags
-	rootCmd.Flags().String("config", "", "Config file path")
+	rootCmd.PersistentFlags().String("config", "", "Config file path")
 	rootCmd.Flags().String("grpc-listen", ":4317", "gRPC listen address")
-	rootCmd.Flags().String("http-listen", ":8080", "HTTP listen address (health/metrics)")
-	rootCmd.Flags().String("clickhouse-dsn", "clickhouse://localhost:9000/egressor", "ClickHouse DSN")
+	rootCmd.Flags().String("http-listen", ":8080", "HTTP listen address (health/metrics/ingest)")
+	rootCmd.PersistentFlags().String("clickhouse-dsn", "clickhouse://localhost:9000/egressor", "ClickHouse DSN")
 	rootCmd.Flags().String("postgres-dsn", "postgres://localhost:5432/egressor", "PostgreSQL DSN")
 	rootCmd.Flags().Int("batch-size", 10000, "Batch size for ClickHouse inserts")
 	rootCmd.Flags().Duration("flush-interval", 5*time.Second, "Flush interval for batches")
+	rootCmd.Flags().Float64("raw-sample-rate", 1, "Fraction of flows whose raw events are retained (aggregates always keep all events)")
+	rootCmd.Flags().Int("event-buffer-size", 100000, "Capacity of the ingest event channel")
+	rootCmd.Flags().String("overflow-policy", "drop-newest", "What to do when the event channel is full (drop-newest, drop-oldest, block)")
+	rootCmd.Flags().Duration("overflow-timeout", time.Second, "Maximum wait for room under the block overflow policy")
+	rootCmd.Flags().Bool("dry-run", false, "Validate and count events without writing to ClickHouse")
+	rootCmd.Flags().Bool("atomic-flush", false, "Write raw and unretained events of a batch in a single insert")
+	rootCmd.Flags().String("ingest-token", "", "Bearer token enabling POST /ingest for NDJSON events over HTTP (empty disables); with --tls-enabled the HTTP listener serves TLS")
+	rootCmd.Flags().Int64("ingest-max-bytes", 10<<20, "Maximum body size of a POST /ingest request")
+	rootCmd.Flags().Bool("tls-enabled", false, "Serve gRPC, and the HTTP listener when --ingest-token is set, over TLS")
+	rootCmd.Flags().String("tls-ca-file", "", "CA bundle for verifying agent client certificates")
+	rootCmd.Flags().String("tls-cert-file", "", "Server certificate")
+	rootCmd.Flags().String("tls-key-file", "", "Server private key")
+	rootCmd.Flags().Bool("tls-client-auth", false, "Require verified client certificates (mTLS)")
+	rootCmd.Flags().StringToString("namespace-quotas", nil, "Per-namespace byte quotas (namespace=bytes,...)")
+	rootCmd.Flags().StringToString("team-quotas", nil, "Per-team byte quotas (team=bytes,...)")
+	rootCmd.Flags().Duration("quota-window", time.Hour, "Rolling window for byte quotas")
+	rootCmd.Flags().Bool("quota-tag-events", false, "Label events from namespaces or teams over quota")
 	rootCmd.Flags().Bool("debug", false, "Enable debug logging")
 
+	rootCmd.AddCommand(newMigrateCmd())
+
+	rootCmd.AddCommand(newImportCmd())
+
 	viper.BindPFlags(rootCmd.Flags())
+	viper.BindPFlags(rootCmd.PersistentFlags())
 	viper.SetEnvPrefix("EGRESSOR")
 	viper.AutomaticEnv()
 
@@ -73,6 +102,15 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	namespaceQuotas, err := parseQuotas(viper.GetStringMapString("namespace-quotas"))
+	if err != nil {
+		return fmt.Errorf("parsing namespace quotas: %w", err)
+	}
+	teamQuotas, err := parseQuotas(viper.GetStringMapString("team-quotas"))
+	if err != nil {
+		return fmt.Errorf("parsing team quotas: %w", err)
+	}
+
 	cfg := collector.Config{
 		GRPCListen:    viper.GetString("grpc-listen"),
 		HTTPListen:    viper.GetString("http-listen"),
@@ -80,6 +118,29 @@ func run(cmd *cobra.Command, args []string) error {
 		PostgresDSN:   viper.GetString("postgres-dsn"),
 		BatchSize:     viper.GetInt("batch-size"),
 		FlushInterval: viper.GetDuration("flush-interval"),
+		RawSampleRate: viper.GetFloat64("raw-sample-rate"),
+
+		EventBufferSize: viper.GetInt("event-buffer-size"),
+		OverflowPolicy:  queue.OverflowPolicy(viper.GetString("overflow-policy")),
+		OverflowTimeout: viper.GetDuration("overflow-timeout"),
+		DryRun:          viper.GetBool("dry-run"),
+		AtomicFlush:     viper.GetBool("atomic-flush"),
+		IngestToken:     viper.GetString("ingest-token"),
+		IngestMaxBytes:  viper.GetInt64("ingest-max-bytes"),
+
+		TLS: transport.TLSConfig{
+			Enabled:    viper.GetBool("tls-enabled"),
+			CAFile:     viper.GetString("tls-ca-file"),
+			CertFile:   viper.GetString("tls-cert-file"),
+			KeyFile:    viper.GetString("tls-key-file"),
+			ClientAuth: viper.GetBool("tls-client-auth"),
+		},
+		Quotas: collector.QuotaConfig{
+			Namespaces: namespaceQuotas,
+			Teams:      teamQuotas,
+			Window:     viper.GetDuration("quota-window"),
+			TagEvents:  viper.GetBool("quota-tag-events"),
+		},
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -113,3 +174,232 @@ func run(cmd *cobra.Command, args []string) error {
 	log.Info().Msg("Collector stopped")
 	return nil
 }
+
+// newMigrateCmd builds the migrate subcommand.
+func newMigrateCmd() *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply ClickHouse schema migrations and exit",
+		RunE:  migrate,
+	}
+	migrateCmd.Flags().Bool("dry-run", false, "Print the schema DDL without executing it")
+	migrateCmd.Flags().StringSlice("aggregation-dimensions", nil,
+		"Rebuild the hourly views grouped by these extra columns ("+strings.Join(storage.AggregationDimensions, ", ")+
+			"); pass empty to reset. Also read from the config file. Stop collectors first: events inserted while a view is rebuilt miss the hourly aggregates")
+	viper.BindPFlag("aggregation-dimensions", migrateCmd.Flags().Lookup("aggregation-dimensions"))
+	return migrateCmd
+}
+
+// migrateOptions reads the hourly view grouping from the
+// aggregation-dimensions setting, given in the config file or as a flag.
+// Views are only regrouped when it is set, so a plain migrate keeps the
+// grouping chosen earlier.
+func migrateOptions() (storage.MigrateOptions, error) {
+	if !viper.IsSet("aggregation-dimensions") {
+		return storage.MigrateOptions{}, nil
+	}
+	dims, err := storage.ParseAggregationDimensions(viper.GetStringSlice("aggregation-dimensions"))
+	if err != nil {
+		return storage.MigrateOptions{}, err
+	}
+	return storage.MigrateOptions{RegroupViews: true, AggregationDimensions: dims}, nil
+}
+
+// migrate applies the schema and migrations, prints the resulting version,
+// and exits.
+func migrate(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+
+	if configFile := viper.GetString("config"); configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading config: %w", err)
+		}
+	}
+	opts, err := migrateOptions()
+	if err != nil {
+		return err
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if dryRun {
+		ddl := storage.SchemaDDL()
+		if opts.RegroupViews {
+			ddl = append(ddl, storage.AggregationDDL(opts.AggregationDimensions)...)
+		}
+		for _, stmt := range ddl {
+			fmt.Fprintf(out, "%s;\n\n", strings.TrimSpace(stmt))
+		}
+		fmt.Fprintf(out, "-- schema version %d\n", storage.LatestSchemaVersion())
+		return nil
+	}
+
+	store, err := storage.OpenClickHouseStore(viper.GetString("clickhouse-dsn"))
+	if err != nil {
+		return fmt.Errorf("connecting to ClickHouse: %w", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	version, err := store.Migrate(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("migrating schema: %w", err)
+	}
+	if opts.RegroupViews {
+		fmt.Fprintf(out, "hourly aggregation dimensions: %s\n", strings.Join(opts.AggregationDimensions, ", "))
+	}
+
+	fmt.Fprintf(out, "schema version %d\n", version)
+	return nil
+}
+
+// newImportCmd builds the import subcommand.
+func newImportCmd() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import historical flows into ClickHouse with their original timestamps",
+		RunE:  importFlows,
+	}
+	importCmd.Flags().String("file", "", "File of flows to import (required)")
+	importCmd.Flags().String("format", "", "File format: json or csv (default: from file extension)")
+	importCmd.Flags().Int("batch-size", 10000, "Events per insert batch")
+	importCmd.MarkFlagRequired("file")
+	return importCmd
+}
+
+// importFlows reads historical flows from a file and inserts them as events
+// stamped with their original window start.
+func importFlows(cmd *cobra.Command, args []string) error {
+	path, _ := cmd.Flags().GetString("file")
+	format, _ := cmd.Flags().GetString("format")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "ndjson" {
+			format = collector.ImportFormatJSON
+		}
+	}
+	if batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening import file: %w", err)
+	}
+	defer f.Close()
+
+	flows, err := collector.ReadFlows(f, format)
+	if err != nil {
+		return fmt.Errorf("reading flows: %w", err)
+	}
+
+	if configFile := viper.GetString("config"); configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading config: %w", err)
+		}
+	}
+
+	store, err := storage.NewClickHouseStore(viper.GetString("clickhouse-dsn"))
+	if err != nil {
+		return fmt.Errorf("connecting to ClickHouse: %w", err)
+	}
+	defer store.Close()
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Flows past raw retention go to the hourly aggregates only, and flows
+	// past aggregate retention are skipped, since TTLs would drop them as
+	// soon as they were written.
+	raw := make([]types.TransferEvent, 0, batchSize)
+	aggregateOnly := make([]types.TransferEvent, 0, batchSize)
+	imported, aggregated, skipped, expired := 0, 0, 0, 0
+	insert := func(events []types.TransferEvent, aggregate bool) error {
+		if len(events) == 0 {
+			return nil
+		}
+		insertFn := store.InsertEvents
+		if aggregate {
+			insertFn = store.InsertAggregateOnly
+		}
+		result, err := insertFn(ctx, events)
+		if err != nil {
+			return fmt.Errorf("inserting events after %d imported: %w", imported, err)
+		}
+		imported += result.Inserted
+		skipped += result.Skipped
+		if aggregate {
+			aggregated += result.Inserted
+		}
+		return nil
+	}
+
+	now := time.Now()
+	for _, flow := range flows {
+		switch collector.ImportTargetFor(flow, now) {
+		case collector.ImportExpired:
+			expired++
+		case collector.ImportAggregateOnly:
+			aggregateOnly = append(aggregateOnly, collector.FlowToEvent(flow))
+			if len(aggregateOnly) == batchSize {
+				if err := insert(aggregateOnly, true); err != nil {
+					return err
+				}
+				aggregateOnly = aggregateOnly[:0]
+			}
+		default:
+			raw = append(raw, collector.FlowToEvent(flow))
+			if len(raw) == batchSize {
+				if err := insert(raw, false); err != nil {
+					return err
+				}
+				raw = raw[:0]
+			}
+		}
+	}
+	if err := insert(raw, false); err != nil {
+		return err
+	}
+	if err := insert(aggregateOnly, true); err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "imported %d flows\n", imported)
+	if aggregated > 0 {
+		fmt.Fprintf(out, "%d flows older than %d days were written to the hourly aggregates only; raw events are kept for %d days\n",
+			aggregated, retentionDays(storage.RawEventRetention), retentionDays(storage.RawEventRetention))
+	}
+	if expired > 0 {
+		fmt.Fprintf(out, "skipped %d flows older than %d days, past hourly aggregate retention\n",
+			expired, retentionDays(storage.HourlyAggregateRetention))
+	}
+	if skipped > 0 {
+		fmt.Fprintf(out, "skipped %d invalid flows\n", skipped)
+	}
+	return nil
+}
+
+// retentionDays returns a retention period in whole days.
+func retentionDays(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
+
+// parseQuotas converts name=bytes pairs into a quota map.
+func parseQuotas(raw map[string]string) (map[string]uint64, error) {
+	quotas := make(map[string]uint64, len(raw))
+	for name, value := range raw {
+		bytes, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota for %s: %w", name, err)
+		}
+		quotas[name] = bytes
+	}
+	return quotas, nil
+}
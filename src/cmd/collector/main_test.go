@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/egressor/egressor/src/internal/storage"
+)
+
+// runMigrate executes the migrate subcommand and returns its output.
+func runMigrate(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	// The command binds its flags to the global viper
+	t.Cleanup(viper.Reset)
+	return runCommand(t, newMigrateCmd(), args...)
+}
+
+// runCommand executes cmd with args and returns its output.
+func runCommand(t *testing.T, cmd *cobra.Command, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestMigrateDryRunPrintsDDL(t *testing.T) {
+	out, err := runMigrate(t, "--dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range storage.SchemaDDL() {
+		if !strings.Contains(out, strings.TrimSpace(stmt)+";") {
+			t.Errorf("dry run is missing statement:\n%s", stmt)
+		}
+	}
+	if want := fmt.Sprintf("-- schema version %d\n", storage.LatestSchemaVersion()); !strings.HasSuffix(out, want) {
+		t.Errorf("dry run does not end with %q", want)
+	}
+}
+
+func TestMigrateDryRunRebuildsViews(t *testing.T) {
+	out, err := runMigrate(t, "--dry-run", "--aggregation-dimensions", "dst_cloud_service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range storage.AggregationDDL([]string{"dst_cloud_service"}) {
+		if !strings.Contains(out, strings.TrimSpace(stmt)+";") {
+			t.Errorf("dry run is missing view statement:\n%s", stmt)
+		}
+	}
+
+	if _, err := runMigrate(t, "--dry-run", "--aggregation-dimensions", "src_pod"); err == nil {
+		t.Error("want error for an unknown aggregation dimension")
+	}
+}
+
+func TestMigrateReadsAggregationDimensionsFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("aggregation-dimensions: [http_path]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("config", path)
+
+	out, err := runMigrate(t, "--dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range storage.AggregationDDL([]string{"http_path"}) {
+		if !strings.Contains(out, strings.TrimSpace(stmt)+";") {
+			t.Errorf("dry run is missing view statement:\n%s", stmt)
+		}
+	}
+}
+
+// TestMigrateAgainstTestDB runs against the ClickHouse in
+// EGRESSOR_TEST_CLICKHOUSE_DSN; migrating twice must be a no-op.
+func TestMigrateAgainstTestDB(t *testing.T) {
+	dsn := os.Getenv("EGRESSOR_TEST_CLICKHOUSE_DSN")
+	if dsn == "" {
+		t.Skip("EGRESSOR_TEST_CLICKHOUSE_DSN not set")
+	}
+	viper.Set("clickhouse-dsn", dsn)
+	t.Cleanup(viper.Reset)
+
+	want := fmt.Sprintf("schema version %d\n", storage.LatestSchemaVersion())
+	for i := 0; i < 2; i++ {
+		out, err := runMigrate(t)
+		if err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+		if out != want {
+			t.Errorf("run %d printed %q, want %q", i+1, out, want)
+		}
+	}
+}
+
+func TestMigrateUnreachableDB(t *testing.T) {
+	viper.Set("clickhouse-dsn", "clickhouse://127.0.0.1:1/egressor")
+	t.Cleanup(viper.Reset)
+
+	if _, err := runMigrate(t); err == nil || !strings.Contains(err.Error(), "connecting to ClickHouse") {
+		t.Errorf("err = %v, want a connection error", err)
+	}
+}
+
+// writeImportFile writes a CSV of flows from service, two in hour, and
+// returns its path.
+func writeImportFile(t *testing.T, service string, hour time.Time, older ...time.Time) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flows.csv")
+	data := "timestamp,src_namespace,src_service,dst_ip,bytes\n" +
+		hour.Add(20*time.Minute).Format(time.RFC3339) + ",shop," + service + ",203.0.113.10,5000\n" +
+		hour.Add(40*time.Minute).Format(time.RFC3339) + ",shop," + service + ",203.0.113.10,3000\n"
+	for _, ts := range older {
+		data += ts.Format(time.RFC3339) + ",shop," + service + ",203.0.113.10,1000\n"
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestImportQueriesBackByDate imports into the ClickHouse in
+// EGRESSOR_TEST_CLICKHOUSE_DSN and reads the flows back from their
+// historical hours. A flow past raw retention lands in the hourly
+// aggregates only, and one past aggregate retention is skipped.
+func TestImportQueriesBackByDate(t *testing.T) {
+	dsn := os.Getenv("EGRESSOR_TEST_CLICKHOUSE_DSN")
+	if dsn == "" {
+		t.Skip("EGRESSOR_TEST_CLICKHOUSE_DSN not set")
+	}
+	viper.Set("clickhouse-dsn", dsn)
+	t.Cleanup(viper.Reset)
+
+	service := fmt.Sprintf("import-test-%d", time.Now().UnixNano())
+	hour := time.Now().UTC().Add(-3 * 24 * time.Hour).Truncate(time.Hour)
+	oldHour := time.Now().UTC().Add(-45 * 24 * time.Hour).Truncate(time.Hour)
+	expired := time.Now().UTC().Add(-100 * 24 * time.Hour)
+	out, err := runCommand(t, newImportCmd(), "--file", writeImportFile(t, service, hour, oldHour, expired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "imported 3 flows\n" +
+		"1 flows older than 30 days were written to the hourly aggregates only; raw events are kept for 30 days\n" +
+		"skipped 1 flows older than 90 days, past hourly aggregate retention\n"
+	if out != want {
+		t.Errorf("import printed %q, want %q", out, want)
+	}
+
+	store, err := storage.OpenClickHouseStore(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, tc := range []struct {
+		hour  time.Time
+		bytes uint64
+	}{{hour, 8000}, {oldHour, 1000}} {
+		results, err := store.QueryFlows(context.Background(), storage.FlowQuery{
+			Start:        tc.hour,
+			End:          tc.hour.Add(time.Hour),
+			SrcNamespace: "shop",
+			SrcService:   service,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].TotalBytes != tc.bytes {
+			t.Errorf("results at %s = %+v, want one flow of %d bytes", tc.hour, results, tc.bytes)
+		}
+	}
+}
+
+func TestImportRejectsBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flows.csv")
+	if err := os.WriteFile(path, []byte("timestamp,src_service\n2025-11-03T14:20:00Z,api\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is read before connecting, so no database is needed
+	if _, err := runCommand(t, newImportCmd(), "--file", path); err == nil || !strings.Contains(err.Error(), "reading flows") {
+		t.Errorf("err = %v, want the file rejected", err)
+	}
+	if _, err := runCommand(t, newImportCmd(), "--file", path, "--batch-size", "0"); err == nil {
+		t.Error("want error for a zero batch size")
+	}
+}
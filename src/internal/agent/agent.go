@@ -3,16 +3,25 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // Register gzip compressor
 
+	"github.com/egressor/egressor/src/internal/queue"
+	"github.com/egressor/egressor/src/internal/transport"
 	"github.com/egressor/egressor/src/pkg/ebpf"
+	"github.com/egressor/egressor/src/pkg/geoip"
 	"github.com/egressor/egressor/src/pkg/types"
 )
 
@@ -23,39 +32,133 @@ type Config struct {
 	NodeName          string
 	ClusterName       string
 	ClusterCIDRs      []string
+	RemoteClusters    []string // Other clusters' pod ranges as "name=cidr", inside ClusterCIDRs
+	CloudProvider     string   // aws, gcp or azure; empty reads it from the node's provider ID
 	ExportInterval    time.Duration
+	GRPCCompression   string // gRPC compressor name (e.g. "gzip"), empty disables
+	TLS               transport.TLSConfig
+	GeoIPCountryDB    string // Path to MaxMind country database (optional)
+	GeoIPASNDB        string // Path to MaxMind ASN database (optional)
+
+	// EventBufferSize is the capacity of the export queue. OverflowPolicy
+	// decides what happens when it is full; OverflowTimeout bounds waits
+	// under the block policy.
+	EventBufferSize int
+	OverflowPolicy  queue.OverflowPolicy
+	OverflowTimeout time.Duration
+
+	// TimestampSource selects kernel or read-time event timestamps;
+	// empty means kernel.
+	TimestampSource TimestampSource
+
+	// EphemeralPorts is the client port range normalized away on flows to
+	// service ports, e.g. "30000-60000"; such flows are then aggregated
+	// per export batch. Empty keeps source ports as observed.
+	EphemeralPorts string
 }
 
+// defaultEventBufferSize is used when Config.EventBufferSize is unset.
+const defaultEventBufferSize = 10000
+
+// WellKnownServiceLabel tags events whose destination port matches a
+// well-known service such as DNS or NTP.
+const WellKnownServiceLabel = "egressor.io/well-known-service"
+
+// egressDedupBucket is the window in which the same egress connection
+// reported by both eBPF paths is counted once.
+const egressDedupBucket = 10 * time.Second
+
 // Agent is the FlowScope node agent.
 type Agent struct {
 	cfg       Config
 	loader    *ebpf.Loader
 	enricher  *K8sEnricher
+	services  *ServiceEnricher
+	geo       *geoip.Resolver
+	dedup     *egressDedup
 	exporter  *Exporter
+	clock     *eventClock
+	ephemeral PortRange
+	remote    RemoteClusters
 	mu        sync.RWMutex
 	running   bool
 	stopChan  chan struct{}
 	events    chan types.TransferEvent
+	dropped   prometheus.Counter
 }
 
 // New creates a new agent.
 func New(cfg Config) (*Agent, error) {
+	if cfg.EventBufferSize <= 0 {
+		cfg.EventBufferSize = defaultEventBufferSize
+	}
+	policy, err := queue.ParseOverflowPolicy(string(cfg.OverflowPolicy))
+	if err != nil {
+		return nil, err
+	}
+	cfg.OverflowPolicy = policy
+	timestamps, ok := ParseTimestampSource(string(cfg.TimestampSource))
+	if !ok {
+		return nil, fmt.Errorf("unknown timestamp source %q (kernel, now)", cfg.TimestampSource)
+	}
+	cfg.TimestampSource = timestamps
+	ephemeral, err := ParsePortRange(cfg.EphemeralPorts)
+	if err != nil {
+		return nil, fmt.Errorf("ephemeral ports: %w", err)
+	}
+
 	loader := ebpf.NewLoader()
 	if err := loader.SetClusterCIDRs(cfg.ClusterCIDRs); err != nil {
 		return nil, fmt.Errorf("setting cluster CIDRs: %w", err)
 	}
+	remote, err := ParseRemoteClusters(cfg.RemoteClusters)
+	if err != nil {
+		return nil, err
+	}
+	if err := remote.checkInside(loader.IsExternalIP); err != nil {
+		return nil, err
+	}
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "egressor_agent_events_dropped_total",
+		Help: "Total number of events dropped because the export queue was full",
+	})
+	prometheus.MustRegister(loader.Collectors()...)
+	prometheus.MustRegister(dropped)
 
 	enricher, err := NewK8sEnricher()
 	if err != nil {
 		return nil, fmt.Errorf("creating k8s enricher: %w", err)
 	}
+	provider, err := resolveCloudProvider(cfg.CloudProvider, cfg.NodeName, enricher.NodeProviderID)
+	if err != nil {
+		return nil, err
+	}
+	cfg.CloudProvider = string(provider)
+
+	// GeoIP enrichment is optional; run without it if databases are unavailable
+	var geo *geoip.Resolver
+	if cfg.GeoIPCountryDB != "" || cfg.GeoIPASNDB != "" {
+		geo, err = geoip.NewResolver(cfg.GeoIPCountryDB, cfg.GeoIPASNDB)
+		if err != nil && geo == nil {
+			log.Warn().Err(err).Msg("Failed to load GeoIP databases, geo enrichment disabled")
+		} else if err != nil {
+			log.Warn().Err(err).Msg("Failed to load a GeoIP database, enriching from the other")
+		}
+	}
 
 	return &Agent{
-		cfg:      cfg,
-		loader:   loader,
-		enricher: enricher,
-		stopChan: make(chan struct{}),
-		events:   make(chan types.TransferEvent, 10000),
+		cfg:       cfg,
+		loader:    loader,
+		enricher:  enricher,
+		services:  NewServiceEnricher(enricher.client),
+		geo:       geo,
+		dedup:     newEgressDedup(egressDedupBucket),
+		clock:     newEventClock(cfg.TimestampSource),
+		ephemeral: ephemeral,
+		remote:    remote,
+		stopChan:  make(chan struct{}),
+		events:    make(chan types.TransferEvent, cfg.EventBufferSize),
+		dropped:   dropped,
 	}, nil
 }
 
@@ -81,8 +184,19 @@ func (a *Agent) Start(ctx context.Context) error {
 	}
 
 	// Connect to collector
-	log.Info().Str("endpoint", a.cfg.CollectorEndpoint).Msg("Connecting to collector")
-	exporter, err := NewExporter(a.cfg.CollectorEndpoint)
+	tlsConfig, err := a.cfg.TLS.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	log.Info().
+		Str("endpoint", a.cfg.CollectorEndpoint).
+		Bool("tls", tlsConfig != nil).
+		Msg("Connecting to collector")
+	exporter, err := NewExporter(a.cfg.CollectorEndpoint, ExporterOptions{
+		Compression: a.cfg.GRPCCompression,
+		TLS:         tlsConfig,
+	})
 	if err != nil {
 		log.Warn().Err(err).Msg("Failed to connect to collector")
 	} else {
@@ -92,11 +206,16 @@ func (a *Agent) Start(ctx context.Context) error {
 	// Start background workers
 	go a.processFlowEvents(ctx)
 	go a.processEgressEvents(ctx)
-	go a.exportLoop(ctx)
+	var export exportFunc
+	if a.exporter != nil {
+		export = a.exporter.Export
+	}
+	go a.exportLoop(ctx, export)
 
 	log.Info().
 		Str("node", a.cfg.NodeName).
 		Str("cluster", a.cfg.ClusterName).
+		Str("cloud_provider", a.cfg.CloudProvider).
 		Msg("Agent started")
 
 	return nil
@@ -139,7 +258,7 @@ func (a *Agent) processFlowEvents(ctx context.Context) {
 		case event := <-a.loader.FlowEvents():
 			transferEvent := a.convertFlowEvent(event)
 			if transferEvent != nil {
-				a.enrichAndQueue(*transferEvent)
+				a.enrichAndQueue(*transferEvent, sourceFlowTracker)
 			}
 		}
 	}
@@ -156,7 +275,7 @@ func (a *Agent) processEgressEvents(ctx context.Context) {
 		case event := <-a.loader.EgressEvents():
 			transferEvent := a.convertEgressEvent(event)
 			if transferEvent != nil {
-				a.enrichAndQueue(*transferEvent)
+				a.enrichAndQueue(*transferEvent, sourceEgressMonitor)
 			}
 		}
 	}
@@ -177,6 +296,18 @@ func (a *Agent) convertFlowEvent(event ebpf.FlowEvent) *types.TransferEvent {
 		direction = types.DirectionInbound
 	}
 
+	// Outbound traffic leaving the cluster CIDRs is egress, which the
+	// egress monitor may report as well
+	destination := types.Endpoint{
+		Type: types.EndpointTypeUnknown,
+		IP:   dstIP,
+		Port: event.Key.DstPort,
+	}
+	if direction == types.DirectionOutbound && a.loader.IsExternalIP(dstIP) {
+		destination.Type = types.EndpointTypeExternal
+		destination.IsInternet = true
+	}
+
 	return &types.TransferEvent{
 		ID: uuid.New(),
 		Source: types.Endpoint{
@@ -184,11 +315,7 @@ func (a *Agent) convertFlowEvent(event ebpf.FlowEvent) *types.TransferEvent {
 			IP:   srcIP,
 			Port: event.Key.SrcPort,
 		},
-		Destination: types.Endpoint{
-			Type: types.EndpointTypeUnknown,
-			IP:   dstIP,
-			Port: event.Key.DstPort,
-		},
+		Destination: destination,
 		Protocol:        protocol,
 		Direction:       direction,
 		Type:            types.TransferTypePodToPod,
@@ -196,7 +323,7 @@ func (a *Agent) convertFlowEvent(event ebpf.FlowEvent) *types.TransferEvent {
 		BytesReceived:   event.Metrics.BytesReceived,
 		PacketsSent:     event.Metrics.PacketsSent,
 		PacketsReceived: event.Metrics.PacketsReceived,
-		Timestamp:       time.Now(),
+		Timestamp:       a.clock.timestamp(event.Metrics.LastSeenNs),
 		DurationNs:      event.Metrics.LastSeenNs - event.Metrics.StartTimeNs,
 	}
 }
@@ -228,14 +355,15 @@ func (a *Agent) convertEgressEvent(event ebpf.EgressEvent) *types.TransferEvent
 		Direction:     types.DirectionOutbound,
 		Type:          types.TransferTypeEgress,
 		BytesSent:     event.Bytes,
-		Timestamp:     time.Unix(0, int64(event.TimestampNs)),
+		Timestamp:     a.clock.timestamp(event.TimestampNs),
 	}
 }
 
 // enrichAndQueue enriches event with K8s metadata and queues it.
-func (a *Agent) enrichAndQueue(event types.TransferEvent) {
+func (a *Agent) enrichAndQueue(event types.TransferEvent, src eventSource) {
 	// Enrich source
 	if identity := a.enricher.GetIdentity(event.Source.IP); identity != nil {
+		identity.Services = a.services.GetFrontingServices(event.Source.IP)
 		event.Source.Identity = identity
 		event.Source.Type = types.EndpointTypePod
 	}
@@ -243,28 +371,87 @@ func (a *Agent) enrichAndQueue(event types.TransferEvent) {
 	// Enrich destination
 	if event.Destination.Type != types.EndpointTypeExternal {
 		if identity := a.enricher.GetIdentity(event.Destination.IP); identity != nil {
+			identity.Services = a.services.GetFrontingServices(event.Destination.IP)
 			event.Destination.Identity = identity
 			event.Destination.Type = types.EndpointTypePod
+		} else if cluster := a.remote.Cluster(event.Destination.IP); cluster != "" {
+			event.Destination.Identity = remoteIdentity(cluster, event.Destination.IP)
+			event.Destination.Type = types.EndpointTypePod
 		}
 	}
 
-	// Classify transfer type
-	event.Type = classifyTransferType(event)
+	// Enrich external destinations with geo/ASN data
+	if event.Destination.Type == types.EndpointTypeExternal {
+		a.enrichGeo(&event.Destination)
+	}
 
-	// Add node/cluster metadata
+	// Tag well-known services (DNS, NTP, ...) by destination port
+	if svc := types.WellKnownService(event.Protocol, event.Destination.Port); svc != "" {
+		event.Destination.WellKnownService = svc
+		if event.Labels == nil {
+			event.Labels = make(map[string]string)
+		}
+		event.Labels[WellKnownServiceLabel] = svc
+	}
+
+	// Add node/cluster metadata; the node's provider bills the source's
+	// traffic. Classification compares the clusters, so this comes first
 	if event.Source.Identity != nil {
 		event.Source.Identity.NodeName = a.cfg.NodeName
 		event.Source.Identity.Cluster = a.cfg.ClusterName
+		event.Source.Identity.CloudProvider = a.cfg.CloudProvider
 	}
 
-	select {
-	case a.events <- event:
-	default:
-		log.Warn().Msg("Event queue full, dropping event")
+	// Classify transfer type
+	event.Type = classifyTransferType(event)
+
+	// Drop egress already reported by the other eBPF path
+	if !a.dedup.Allow(&event, src, time.Now()) {
+		log.Debug().
+			Str("src", event.Source.IP).
+			Str("dst", event.Destination.IP).
+			Msg("Dropping duplicate egress event")
+		return
+	}
+
+	// Drop client ephemeral ports so connections to the same service share a
+	// flow key. This zeroes the source port, so it must come after dedup,
+	// which tells connections apart by it
+	normalizeEphemeralPort(&event, a.ephemeral)
+
+	queued, evicted := queue.Offer(a.events, event, a.cfg.OverflowPolicy, a.cfg.OverflowTimeout)
+	dropped := evicted
+	if !queued {
+		dropped++
+	}
+	if dropped > 0 {
+		a.dropped.Add(float64(dropped))
+		log.Warn().Str("policy", string(a.cfg.OverflowPolicy)).Msg("Event queue full, dropping event")
 	}
 }
 
-// classifyTransferType determines the transfer type.
+// enrichGeo sets country, ASN, and cloud provider on an external endpoint.
+func (a *Agent) enrichGeo(endpoint *types.Endpoint) {
+	if a.geo == nil {
+		return
+	}
+
+	info, ok := a.geo.Lookup(net.ParseIP(endpoint.IP))
+	if !ok {
+		return
+	}
+
+	endpoint.Country = info.Country
+	endpoint.ASN = info.ASN
+	endpoint.ASOrganization = info.ASOrganization
+	if endpoint.CloudProvider == "" {
+		endpoint.CloudProvider = info.CloudProvider()
+	}
+}
+
+// classifyTransferType determines the transfer type. Traffic between
+// clusters in one region is cross-cluster; across regions it stays
+// cross-region, which is billed the same or higher.
 func classifyTransferType(event types.TransferEvent) types.TransferType {
 	if event.Destination.IsInternet || event.Destination.Type == types.EndpointTypeExternal {
 		return types.TransferTypeEgress
@@ -280,6 +467,9 @@ func classifyTransferType(event types.TransferEvent) types.TransferType {
 		if src.Region != "" && dst.Region != "" && src.Region != dst.Region {
 			return types.TransferTypeCrossRegion
 		}
+		if src.Cluster != "" && dst.Cluster != "" && src.Cluster != dst.Cluster {
+			return types.TransferTypeCrossCluster
+		}
 		if src.AvailabilityZone != "" && dst.AvailabilityZone != "" && src.AvailabilityZone != dst.AvailabilityZone {
 			return types.TransferTypeCrossAZ
 		}
@@ -288,39 +478,84 @@ func classifyTransferType(event types.TransferEvent) types.TransferType {
 	return types.TransferTypePodToPod
 }
 
-// exportLoop periodically exports events to collector.
-func (a *Agent) exportLoop(ctx context.Context) {
-	ticker := time.NewTicker(a.cfg.ExportInterval)
-	defer ticker.Stop()
+// exportFunc sends a batch of events to the collector.
+type exportFunc func(ctx context.Context, events []types.TransferEvent) error
+
+// exportLoop periodically exports events to collector. Batch size and
+// interval adapt to queue pressure; see flushPolicy. At most
+// maxInFlightExports batches are exported at once. A nil export drops
+// batches.
+func (a *Agent) exportLoop(ctx context.Context, export exportFunc) {
+	policy := newFlushPolicy(a.cfg.ExportInterval, cap(a.events))
+	timer := time.NewTimer(policy.Interval())
+	defer timer.Stop()
 
+	inFlight := make(chan struct{}, maxInFlightExports)
 	var batch []types.TransferEvent
 
+	flush := func() {
+		if !a.ephemeral.Empty() {
+			batch = coalesceEphemeral(batch)
+		}
+		if len(batch) > 0 && export != nil {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(batch []types.TransferEvent) {
+				defer func() { <-inFlight }()
+				if err := export(ctx, batch); err != nil {
+					log.Warn().Err(err).Int("count", len(batch)).Msg("Failed to export events")
+				}
+			}(batch)
+		}
+		batch = nil
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-a.stopChan:
 			// Export remaining events
-			if len(batch) > 0 && a.exporter != nil {
-				a.exporter.Export(ctx, batch)
+			if !a.ephemeral.Empty() {
+				batch = coalesceEphemeral(batch)
+			}
+			if len(batch) > 0 && export != nil {
+				if err := export(ctx, batch); err != nil {
+					log.Warn().Err(err).Int("count", len(batch)).Msg("Failed to export events")
+				}
 			}
 			return
 		case event := <-a.events:
 			batch = append(batch, event)
-			// Export if batch is large enough
-			if len(batch) >= 1000 {
-				if a.exporter != nil {
-					go a.exporter.Export(ctx, batch)
-				}
-				batch = nil
-			}
-		case <-ticker.C:
-			if len(batch) > 0 && a.exporter != nil {
-				go a.exporter.Export(ctx, batch)
-				batch = nil
+			// Export if batch is large enough or the queue is backing up,
+			// taking a full batch from the queue rather than one event
+			if policy.ShouldFlush(len(batch), len(a.events)) {
+				batch = drainEvents(a.events, batch, policy.BatchSize())
+				flush()
 			}
+		case <-timer.C:
+			policy.OnTick(len(batch))
+			flush()
+			timer.Reset(policy.Interval())
+		}
+	}
+}
+
+// drainEvents appends queued events to batch, without blocking, until it
+// holds limit events or the queue is empty.
+func drainEvents(events <-chan types.TransferEvent, batch []types.TransferEvent, limit int) []types.TransferEvent {
+	for len(batch) < limit {
+		select {
+		case event := <-events:
+			batch = append(batch, event)
+		default:
+			return batch
 		}
 	}
+	return batch
 }
 
 // Exporter exports events to the collector.
@@ -329,9 +564,30 @@ type Exporter struct {
 	// client pb.CollectorClient // Would use generated proto client
 }
 
+// ExporterOptions configures the exporter connection.
+type ExporterOptions struct {
+	Compression string      // gRPC compressor name, empty disables compression
+	TLS         *tls.Config // TLS settings, nil uses plaintext
+}
+
 // NewExporter creates a new exporter.
-func NewExporter(endpoint string) (*Exporter, error) {
-	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewExporter(endpoint string, opts ExporterOptions) (*Exporter, error) {
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+	}
+
+	if opts.Compression != "" {
+		if encoding.GetCompressor(opts.Compression) == nil {
+			return nil, fmt.Errorf("unsupported gRPC compression: %s", opts.Compression)
+		}
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(opts.Compression)))
+	}
+
+	conn, err := grpc.Dial(endpoint, dialOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("connecting to collector: %w", err)
 	}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/ebpf"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestClassifyClusterTraffic(t *testing.T) {
+	identity := func(cluster, region, az string) *types.ServiceIdentity {
+		return &types.ServiceIdentity{Namespace: "shop", Name: "api", Cluster: cluster, Region: region, AvailabilityZone: az}
+	}
+	tests := []struct {
+		name     string
+		src, dst *types.ServiceIdentity
+		want     types.TransferType
+	}{
+		{"same cluster", identity("prod-a", "us-east-1", "us-east-1a"), identity("prod-a", "us-east-1", "us-east-1a"), types.TransferTypePodToPod},
+		{"same cluster across zones", identity("prod-a", "us-east-1", "us-east-1a"), identity("prod-a", "us-east-1", "us-east-1b"), types.TransferTypeCrossAZ},
+		{"cross cluster", identity("prod-a", "us-east-1", "us-east-1a"), identity("prod-b", "us-east-1", "us-east-1a"), types.TransferTypeCrossCluster},
+		{"cross cluster across zones", identity("prod-a", "us-east-1", "us-east-1a"), identity("prod-b", "us-east-1", "us-east-1b"), types.TransferTypeCrossCluster},
+		{"cross cluster across regions", identity("prod-a", "us-east-1", "us-east-1a"), identity("prod-b", "eu-west-1", "eu-west-1a"), types.TransferTypeCrossRegion},
+		{"unknown destination cluster", identity("prod-a", "", ""), identity("", "", ""), types.TransferTypePodToPod},
+	}
+	for _, tt := range tests {
+		event := types.TransferEvent{
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: tt.src},
+			Destination: types.Endpoint{IP: "10.1.0.5", Identity: tt.dst},
+		}
+		if got := classifyTransferType(event); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRemoteClusters(t *testing.T) {
+	clusters, err := ParseRemoteClusters([]string{"prod-b=10.64.0.0/14", " prod-c = 10.64.8.0/24 ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]string{
+		"10.64.1.2":  "prod-b",
+		"10.64.8.10": "prod-c", // The more specific range wins
+		"10.0.0.5":   "",
+		"not-an-ip":  "",
+	} {
+		if got := clusters.Cluster(ip); got != want {
+			t.Errorf("Cluster(%s) = %q, want %q", ip, got, want)
+		}
+	}
+
+	for _, bad := range []string{"10.64.0.0/14", "=10.64.0.0/14", "prod-b=10.64.0.0"} {
+		if _, err := ParseRemoteClusters([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	outside, _ := ParseRemoteClusters([]string{"prod-b=192.168.0.0/16"})
+	if err := outside.checkInside(newTestAgent(t, 1).loader.IsExternalIP); err == nil {
+		t.Error("range outside the cluster CIDRs accepted")
+	}
+}
+
+func TestEnrichmentClassifiesRemoteClusters(t *testing.T) {
+	a := newTestAgent(t, 10)
+	a.cfg.ClusterName = "prod-a"
+	a.remote, _ = ParseRemoteClusters([]string{"prod-b=10.64.0.0/14"})
+
+	for _, dst := range []uint32{ipv4(10, 64, 1, 2), ipv4(10, 0, 0, 9)} {
+		a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{
+			Key:     ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: dst, SrcPort: 40000, DstPort: 5432, Protocol: 6},
+			Metrics: ebpf.FlowMetrics{BytesSent: 100},
+		}), sourceFlowTracker)
+	}
+
+	events := drain(a)
+	if len(events) != 2 {
+		t.Fatalf("queued %d events, want 2", len(events))
+	}
+	remote, local := events[0], events[1]
+	if remote.Type != types.TransferTypeCrossCluster {
+		t.Errorf("traffic to prod-b classified %s, want cross-cluster", remote.Type)
+	}
+	if remote.Destination.Identity == nil || remote.Destination.Identity.Cluster != "prod-b" {
+		t.Errorf("destination identity %+v, want cluster prod-b", remote.Destination.Identity)
+	}
+	if local.Type != types.TransferTypePodToPod || local.Destination.Identity != nil {
+		t.Errorf("traffic inside prod-a classified %s with identity %+v, want pod-to-pod", local.Type, local.Destination.Identity)
+	}
+}
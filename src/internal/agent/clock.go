@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TimestampSource selects how event timestamps are taken.
+type TimestampSource string
+
+const (
+	// TimestampSourceKernel uses the eBPF timestamp, converted from
+	// CLOCK_MONOTONIC to wall-clock time, falling back to the read time
+	// for events without one.
+	TimestampSourceKernel TimestampSource = "kernel"
+	// TimestampSourceNow uses the time the agent read the event.
+	TimestampSourceNow TimestampSource = "now"
+)
+
+// ParseTimestampSource parses a timestamp source name, defaulting to
+// kernel when empty.
+func ParseTimestampSource(s string) (TimestampSource, bool) {
+	switch TimestampSource(s) {
+	case "", TimestampSourceKernel:
+		return TimestampSourceKernel, true
+	case TimestampSourceNow:
+		return TimestampSourceNow, true
+	}
+	return "", false
+}
+
+// eventClock turns eBPF timestamps (bpf_ktime_get_ns, nanoseconds of
+// CLOCK_MONOTONIC) into wall-clock times.
+type eventClock struct {
+	source    TimestampSource
+	now       func() time.Time
+	monotonic func() (time.Duration, error)
+}
+
+func newEventClock(source TimestampSource) *eventClock {
+	return &eventClock{source: source, now: time.Now, monotonic: monotonicNow}
+}
+
+// timestamp returns the wall-clock time of a kernel timestamp. The
+// conversion is redone per event, as the event's age subtracted from now,
+// so wall-clock steps such as NTP corrections are picked up.
+func (c *eventClock) timestamp(kernelNs uint64) time.Time {
+	now := c.now()
+	if c.source == TimestampSourceNow || kernelNs == 0 {
+		return now
+	}
+	mono, err := c.monotonic()
+	if err != nil {
+		return now
+	}
+	age := mono - time.Duration(kernelNs)
+	if age < 0 {
+		return now // Timestamp from another clock; never date events ahead
+	}
+	return now.Add(-age)
+}
+
+// monotonicNow reads CLOCK_MONOTONIC, the clock bpf_ktime_get_ns uses.
+func monotonicNow() (time.Duration, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, err
+	}
+	return time.Duration(ts.Nano()), nil
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/ebpf"
+)
+
+// fixedClock returns a kernel-timestamp clock at wall time now, with
+// monotonic time mono.
+func fixedClock(now time.Time, mono time.Duration) *eventClock {
+	return &eventClock{
+		source:    TimestampSourceKernel,
+		now:       func() time.Time { return now },
+		monotonic: func() (time.Duration, error) { return mono, nil },
+	}
+}
+
+func TestEventClockConvertsKernelTimestamps(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	mono := 5 * time.Hour // Uptime
+	clock := fixedClock(now, mono)
+
+	tests := []struct {
+		kernelNs uint64
+		want     time.Time
+	}{
+		{uint64(mono - 3*time.Second), now.Add(-3 * time.Second)},
+		{uint64(mono), now},
+		{0, now},                        // No kernel timestamp
+		{uint64(mono + time.Hour), now}, // Ahead of the clock
+		{uint64(now.UnixNano()), now},   // A wall-clock timestamp
+	}
+	for _, tt := range tests {
+		if got := clock.timestamp(tt.kernelNs); !got.Equal(tt.want) {
+			t.Errorf("timestamp(%d) = %s, want %s", tt.kernelNs, got, tt.want)
+		}
+	}
+
+	clock.monotonic = func() (time.Duration, error) { return 0, errors.New("unsupported") }
+	if got := clock.timestamp(uint64(mono)); !got.Equal(now) {
+		t.Errorf("without a monotonic clock: %s, want the read time", got)
+	}
+
+	clock = fixedClock(now, mono)
+	clock.source = TimestampSourceNow
+	if got := clock.timestamp(uint64(mono - time.Minute)); !got.Equal(now) {
+		t.Errorf("read-time source: %s, want %s", got, now)
+	}
+}
+
+func TestConvertersAgreeOnTimestamps(t *testing.T) {
+	a := newTestAgent(t, 10)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	mono := 5 * time.Hour
+	a.clock = fixedClock(now, mono)
+
+	seen := uint64(mono - 2*time.Second)
+	var flow ebpf.FlowEvent
+	flow.Key.SrcIP, flow.Key.DstIP, flow.Key.DstPort, flow.Key.Protocol = ipv4(10, 0, 0, 5), ipv4(203, 0, 113, 10), 443, 6
+	flow.Metrics.BytesSent, flow.Metrics.LastSeenNs = 1000, seen
+	egress := ebpf.EgressEvent{SrcIP: ipv4(10, 0, 0, 5), DstIP: ipv4(203, 0, 113, 10), DstPort: 443, Protocol: 6, Bytes: 1000, TimestampNs: seen}
+
+	fromFlow, fromEgress := a.convertFlowEvent(flow), a.convertEgressEvent(egress)
+	if fromFlow == nil || fromEgress == nil {
+		t.Fatal("event not converted")
+	}
+	want := now.Add(-2 * time.Second)
+	if !fromFlow.Timestamp.Equal(want) || !fromEgress.Timestamp.Equal(want) {
+		t.Errorf("flow path %s, egress path %s; want both %s", fromFlow.Timestamp, fromEgress.Timestamp, want)
+	}
+}
+
+func TestParseTimestampSource(t *testing.T) {
+	for s, want := range map[string]TimestampSource{"": TimestampSourceKernel, "kernel": TimestampSourceKernel, "now": TimestampSourceNow} {
+		if got, ok := ParseTimestampSource(s); !ok || got != want {
+			t.Errorf("%q: got %s, %v; want %s", s, got, ok, want)
+		}
+	}
+	if _, ok := ParseTimestampSource("ntp"); ok {
+		t.Error("unknown source accepted")
+	}
+}
+
+func TestMonotonicNowAdvances(t *testing.T) {
+	first, err := monotonicNow()
+	if err != nil {
+		t.Skip("CLOCK_MONOTONIC unavailable:", err)
+	}
+	second, _ := monotonicNow()
+	if first <= 0 || second < first {
+		t.Errorf("monotonic readings %s then %s", first, second)
+	}
+}
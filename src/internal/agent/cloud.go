@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// providerIDSchemes maps the scheme of a node's spec.providerID to the
+// cloud provider that bills the node's traffic.
+var providerIDSchemes = map[string]types.CloudProvider{
+	"aws":   types.CloudProviderAWS,
+	"gce":   types.CloudProviderGCP,
+	"azure": types.CloudProviderAzure,
+}
+
+// nodeLookupTimeout bounds the API call reading the node's provider ID.
+const nodeLookupTimeout = 10 * time.Second
+
+// providerFromID returns the cloud provider named by a node provider ID such
+// as "aws:///us-east-1a/i-0abc" or "gce://project/zone/name", or "" for
+// other schemes.
+func providerFromID(providerID string) types.CloudProvider {
+	scheme, _, ok := strings.Cut(providerID, "://")
+	if !ok {
+		return ""
+	}
+	return providerIDSchemes[strings.ToLower(scheme)]
+}
+
+// resolveCloudProvider returns the configured cloud provider, or else the
+// one named by the node's provider ID. A failed lookup leaves it unknown
+// rather than failing the agent.
+func resolveCloudProvider(configured, nodeName string,
+	providerID func(ctx context.Context, nodeName string) (string, error)) (types.CloudProvider, error) {
+	if configured != "" {
+		provider := types.CloudProvider(strings.ToLower(configured))
+		switch provider {
+		case types.CloudProviderAWS, types.CloudProviderGCP, types.CloudProviderAzure:
+			return provider, nil
+		}
+		return "", fmt.Errorf("unknown cloud provider %q (aws, gcp, azure)", configured)
+	}
+	if nodeName == "" {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), nodeLookupTimeout)
+	defer cancel()
+	id, err := providerID(ctx, nodeName)
+	if err != nil {
+		log.Warn().Err(err).Str("node", nodeName).Msg("Failed to read node provider ID; cloud provider unknown")
+		return "", nil
+	}
+	return providerFromID(id), nil
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestProviderFromID(t *testing.T) {
+	for id, want := range map[string]types.CloudProvider{
+		"aws:///us-east-1a/i-0abc":                       types.CloudProviderAWS,
+		"gce://project/us-central1-a/gke-node-1":         types.CloudProviderGCP,
+		"azure:///subscriptions/x/resourceGroups/y/vm-1": types.CloudProviderAzure,
+		"kind://docker/kind/kind-control-plane":          "",
+		"":                                               "",
+	} {
+		if got := providerFromID(id); got != want {
+			t.Errorf("providerFromID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestResolveCloudProvider(t *testing.T) {
+	lookup := func(id string, err error) func(context.Context, string) (string, error) {
+		return func(context.Context, string) (string, error) { return id, err }
+	}
+
+	for _, tc := range []struct {
+		name       string
+		configured string
+		nodeName   string
+		lookup     func(context.Context, string) (string, error)
+		want       types.CloudProvider
+	}{
+		{"configured wins", "GCP", "node-1", lookup("aws:///us-east-1a/i-0abc", nil), types.CloudProviderGCP},
+		{"from node", "", "node-1", lookup("aws:///us-east-1a/i-0abc", nil), types.CloudProviderAWS},
+		{"no node name", "", "", lookup("aws:///us-east-1a/i-0abc", nil), ""},
+		{"lookup fails", "", "node-1", lookup("", errors.New("forbidden")), ""},
+	} {
+		got, err := resolveCloudProvider(tc.configured, tc.nodeName, tc.lookup)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: provider = %q, %v, want %q", tc.name, got, err, tc.want)
+		}
+	}
+
+	if _, err := resolveCloudProvider("oracle", "", nil); err == nil {
+		t.Error("unknown configured provider accepted")
+	}
+}
+
+func TestEnrichmentSetsSourceCloudProvider(t *testing.T) {
+	a := newTestAgent(t, 10)
+	a.cfg.CloudProvider = string(types.CloudProviderGCP)
+	injectBoth(a, ipv4(203, 0, 113, 10), 5000)
+
+	events := drain(a)
+	if len(events) != 1 || events[0].Source.Identity == nil {
+		t.Fatalf("queued %+v, want one event from the pod", events)
+	}
+	if got := events[0].Source.Identity.CloudProvider; got != "gcp" {
+		t.Errorf("source cloud provider = %q, want gcp", got)
+	}
+}
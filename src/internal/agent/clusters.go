@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// RemoteClusters maps the pod ranges of other clusters reachable without
+// leaving the network, e.g. over VPC peering or a multi-cluster mesh, to
+// their cluster names. The zero value maps nothing.
+type RemoteClusters struct {
+	ranges []clusterRange // Most specific first
+}
+
+type clusterRange struct {
+	cluster string
+	network *net.IPNet
+}
+
+// ParseRemoteClusters parses "name=cidr" entries, e.g.
+// "prod-eu=10.64.0.0/14". A cluster may be listed more than once.
+func ParseRemoteClusters(entries []string) (RemoteClusters, error) {
+	var c RemoteClusters
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, cidr, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return RemoteClusters{}, fmt.Errorf("invalid remote cluster %q (want name=cidr)", entry)
+		}
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return RemoteClusters{}, fmt.Errorf("invalid remote cluster %q: %w", entry, err)
+		}
+		c.ranges = append(c.ranges, clusterRange{cluster: name, network: network})
+	}
+	sort.SliceStable(c.ranges, func(i, j int) bool {
+		bi, _ := c.ranges[i].network.Mask.Size()
+		bj, _ := c.ranges[j].network.Mask.Size()
+		return bi > bj
+	})
+	return c, nil
+}
+
+// Cluster returns the cluster whose range holds ip, the most specific
+// range winning, or "" if none does.
+func (c RemoteClusters) Cluster(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	for _, r := range c.ranges {
+		if r.network.Contains(parsed) {
+			return r.cluster
+		}
+	}
+	return ""
+}
+
+// checkInside returns an error for a range reaching outside the cluster
+// CIDRs. Traffic there is egress, which the egress monitor reports as
+// well, so it cannot be reclassified as cross-cluster.
+func (c RemoteClusters) checkInside(isExternal func(ip string) bool) error {
+	for _, r := range c.ranges {
+		first := r.network.IP
+		last := make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^r.network.Mask[i]
+		}
+		if isExternal(first.String()) || isExternal(last.String()) {
+			return fmt.Errorf("remote cluster %s range %s is outside the cluster CIDRs", r.cluster, r.network)
+		}
+	}
+	return nil
+}
+
+// remoteIdentity returns the identity of a destination in another
+// cluster. Workloads there are not known to this node's enricher, so the
+// destination is named by its IP.
+func remoteIdentity(cluster, ip string) *types.ServiceIdentity {
+	return &types.ServiceIdentity{Name: ip, Cluster: cluster}
+}
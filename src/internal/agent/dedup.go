@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// eventSource identifies which eBPF path observed an event.
+type eventSource uint8
+
+const (
+	sourceFlowTracker eventSource = 1 << iota
+	sourceEgressMonitor
+)
+
+// flowTuple is the 5-tuple identifying a connection. The source port is
+// what tells concurrent connections to one destination apart.
+type flowTuple struct {
+	srcIP    string
+	dstIP    string
+	srcPort  uint16
+	dstPort  uint16
+	protocol string
+}
+
+// egressDedup suppresses egress traffic reported by both the flow tracker
+// and the egress monitor, so each connection is counted once per time
+// bucket. The first path to report a tuple in a bucket owns it.
+type egressDedup struct {
+	mu      sync.Mutex
+	bucket  time.Duration
+	buckets map[int64]map[flowTuple]eventSource
+}
+
+// newEgressDedup creates a deduplicator with the given bucket width.
+func newEgressDedup(bucket time.Duration) *egressDedup {
+	return &egressDedup{
+		bucket:  bucket,
+		buckets: make(map[int64]map[flowTuple]eventSource),
+	}
+}
+
+// Allow reports whether an event observed by src at time now should be
+// counted. Only egress events are deduplicated. It must see the source port
+// the kernel picked, so it runs before normalizeEphemeralPort: with the
+// port zeroed, a second connection reported by the other path would look
+// like a duplicate of the first and be dropped.
+func (d *egressDedup) Allow(event *types.TransferEvent, src eventSource, now time.Time) bool {
+	if event.Type != types.TransferTypeEgress {
+		return true
+	}
+
+	key := flowTuple{
+		srcIP:    event.Source.IP,
+		dstIP:    event.Destination.IP,
+		srcPort:  event.Source.Port,
+		dstPort:  event.Destination.Port,
+		protocol: event.Protocol,
+	}
+	idx := now.UnixNano() / int64(d.bucket)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Keep only the current and previous bucket
+	for b := range d.buckets {
+		if b < idx-1 {
+			delete(d.buckets, b)
+		}
+	}
+
+	seen := d.buckets[idx]
+	if seen == nil {
+		seen = make(map[flowTuple]eventSource)
+		d.buckets[idx] = seen
+	}
+
+	owner, ok := seen[key]
+	if !ok {
+		seen[key] = src
+		return true
+	}
+	return owner == src
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/egressor/egressor/src/internal/queue"
+	"github.com/egressor/egressor/src/pkg/ebpf"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// newTestAgent returns an agent with a pod at 10.0.0.5, pod CIDR 10.0.0.0/8
+// and an event queue of the given capacity, without Kubernetes or exporter.
+func newTestAgent(t *testing.T, queueCap int) *Agent {
+	t.Helper()
+	loader := ebpf.NewLoader()
+	if err := loader.SetClusterCIDRs([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	return &Agent{
+		cfg:    Config{OverflowPolicy: queue.DropNewest},
+		loader: loader,
+		enricher: &K8sEnricher{ipToPod: map[string]*PodInfo{
+			"10.0.0.5": {Name: "api-0", Namespace: "shop", OwnerKind: "Deployment", OwnerName: "api"},
+		}},
+		services: NewServiceEnricher(nil),
+		dedup:    newEgressDedup(egressDedupBucket),
+		clock:    newEventClock(TimestampSourceNow),
+		events:   make(chan types.TransferEvent, queueCap),
+		dropped:  prometheus.NewCounter(prometheus.CounterOpts{Name: "test_dropped_total"}),
+	}
+}
+
+// ipv4 packs an address the way eBPF events carry it.
+func ipv4(a, b, c, d byte) uint32 {
+	return uint32(a) | uint32(b)<<8 | uint32(c)<<16 | uint32(d)<<24
+}
+
+// injectBoth reports one connection from the pod to dst through both eBPF
+// paths, as the flow tracker and egress monitor would.
+func injectBoth(a *Agent, dst uint32, bytes uint64) {
+	key := ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: dst, SrcPort: 40000, DstPort: 443, Protocol: 6}
+	flow := ebpf.FlowEvent{Key: key, Metrics: ebpf.FlowMetrics{BytesSent: bytes}}
+	egress := ebpf.EgressEvent{SrcIP: key.SrcIP, DstIP: key.DstIP, SrcPort: key.SrcPort, DstPort: key.DstPort, Protocol: key.Protocol, Bytes: bytes}
+
+	a.enrichAndQueue(*a.convertFlowEvent(flow), sourceFlowTracker)
+	a.enrichAndQueue(*a.convertEgressEvent(egress), sourceEgressMonitor)
+}
+
+// drain returns the queued events.
+func drain(a *Agent) []types.TransferEvent {
+	var events []types.TransferEvent
+	for len(a.events) > 0 {
+		events = append(events, <-a.events)
+	}
+	return events
+}
+
+func TestEgressOnBothPathsCountedOnce(t *testing.T) {
+	a := newTestAgent(t, 10)
+	injectBoth(a, ipv4(203, 0, 113, 10), 5000)
+
+	events := drain(a)
+	if len(events) != 1 {
+		t.Fatalf("queued %d events, want the egress counted once", len(events))
+	}
+	if e := events[0]; e.Type != types.TransferTypeEgress || e.BytesSent != 5000 {
+		t.Errorf("queued %s event of %d bytes, want 5000 bytes of egress", e.Type, e.BytesSent)
+	}
+
+	// Further updates from the owning path still count
+	a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{
+		Key:     ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: ipv4(203, 0, 113, 10), SrcPort: 40000, DstPort: 443, Protocol: 6},
+		Metrics: ebpf.FlowMetrics{BytesSent: 100},
+	}), sourceFlowTracker)
+	if got := len(drain(a)); got != 1 {
+		t.Errorf("queued %d events for the owning path's update, want 1", got)
+	}
+}
+
+func TestEgressDedupSeesEphemeralPorts(t *testing.T) {
+	a := newTestAgent(t, 10)
+	a.ephemeral = PortRange{Low: 30000, High: 60000}
+	dst := ipv4(203, 0, 113, 10)
+
+	// Two connections to one destination, one reported by each path
+	a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{
+		Key:     ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: dst, SrcPort: 41000, DstPort: 443, Protocol: 6},
+		Metrics: ebpf.FlowMetrics{BytesSent: 100},
+	}), sourceFlowTracker)
+	a.enrichAndQueue(*a.convertEgressEvent(ebpf.EgressEvent{
+		SrcIP: ipv4(10, 0, 0, 5), DstIP: dst, SrcPort: 52000, DstPort: 443, Protocol: 6, Bytes: 200,
+	}), sourceEgressMonitor)
+
+	events := drain(a)
+	if len(events) != 2 {
+		t.Fatalf("queued %d events, want both connections counted", len(events))
+	}
+	for _, e := range events {
+		if e.Source.Port != 0 {
+			t.Errorf("queued source port %d, want it normalized after dedup", e.Source.Port)
+		}
+	}
+}
+
+func TestInClusterTrafficNotDeduplicated(t *testing.T) {
+	a := newTestAgent(t, 10)
+	key := ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: ipv4(10, 0, 0, 6), SrcPort: 40000, DstPort: 8080, Protocol: 6}
+	for i := 0; i < 2; i++ {
+		a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{Key: key, Metrics: ebpf.FlowMetrics{BytesSent: 100}}), sourceFlowTracker)
+	}
+
+	events := drain(a)
+	if len(events) != 2 {
+		t.Fatalf("queued %d events, want both in-cluster updates", len(events))
+	}
+	if events[0].Type == types.TransferTypeEgress {
+		t.Error("in-cluster traffic classified as egress")
+	}
+}
+
+func TestEgressDedupBuckets(t *testing.T) {
+	d := newEgressDedup(10 * time.Second)
+	event := &types.TransferEvent{
+		Source:      types.Endpoint{IP: "10.0.0.5", Port: 40000},
+		Destination: types.Endpoint{IP: "203.0.113.10", Port: 443},
+		Protocol:    "TCP",
+		Type:        types.TransferTypeEgress,
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	if !d.Allow(event, sourceEgressMonitor, now) {
+		t.Fatal("first report rejected")
+	}
+	if d.Allow(event, sourceFlowTracker, now.Add(time.Second)) {
+		t.Error("second path in the same bucket allowed")
+	}
+	if !d.Allow(event, sourceFlowTracker, now.Add(20*time.Second)) {
+		t.Error("report in a later bucket rejected")
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// PortRange is an inclusive range of ports. The zero value is empty.
+type PortRange struct {
+	Low  uint16
+	High uint16
+}
+
+// ParsePortRange parses "low-high", e.g. "30000-60000". An empty string
+// gives the empty range.
+func ParsePortRange(s string) (PortRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return PortRange{}, nil
+	}
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return PortRange{}, fmt.Errorf("invalid port range %q (want low-high)", s)
+	}
+	low, err := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	high, err := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	if low == 0 || low > high {
+		return PortRange{}, fmt.Errorf("invalid port range %q: low must be in 1..high", s)
+	}
+	return PortRange{Low: uint16(low), High: uint16(high)}, nil
+}
+
+// Empty reports whether the range holds no ports.
+func (r PortRange) Empty() bool {
+	return r.Low == 0 && r.High == 0
+}
+
+// Contains reports whether port is in the range.
+func (r PortRange) Contains(port uint16) bool {
+	return !r.Empty() && port >= r.Low && port <= r.High
+}
+
+// normalizeEphemeralPort zeroes the source port of an event from a client
+// ephemeral port to a service port, so connections that differ only in
+// the port the kernel picked share a flow key. Reports whether it did.
+// Egress dedup keys on the source port, so this runs after it.
+func normalizeEphemeralPort(event *types.TransferEvent, ephemeral PortRange) bool {
+	if !ephemeral.Contains(event.Source.Port) {
+		return false
+	}
+	dst := event.Destination.Port
+	if dst == 0 || ephemeral.Contains(dst) {
+		return false
+	}
+	event.Source.Port = 0
+	return true
+}
+
+// aggregateKey identifies events coalesceEphemeral merges.
+type aggregateKey struct {
+	srcIP, dstIP   string
+	dstPort        uint16
+	protocol       string
+	direction      types.Direction
+	transferType   types.TransferType
+	httpMethod     string
+	httpPath       string
+	grpcMethod     string
+	httpStatusCode int
+	sampleRate     float64
+}
+
+// coalesceEphemeral merges events whose source port was normalized away
+// and that otherwise share a flow, summing their metrics and keeping the
+// latest timestamp and longest duration. Other events pass through
+// untouched. Order follows the first event of each flow.
+func coalesceEphemeral(batch []types.TransferEvent) []types.TransferEvent {
+	index := make(map[aggregateKey]int)
+	out := batch[:0]
+	for _, event := range batch {
+		if event.Source.Port != 0 {
+			out = append(out, event)
+			continue
+		}
+
+		key := aggregateKey{
+			srcIP:          event.Source.IP,
+			dstIP:          event.Destination.IP,
+			dstPort:        event.Destination.Port,
+			protocol:       event.Protocol,
+			direction:      event.Direction,
+			transferType:   event.Type,
+			httpMethod:     event.HTTPMethod,
+			httpPath:       event.HTTPPath,
+			grpcMethod:     event.GRPCMethod,
+			httpStatusCode: event.HTTPStatusCode,
+			sampleRate:     event.SampleRate,
+		}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, event)
+			continue
+		}
+
+		merged := &out[i]
+		merged.BytesSent += event.BytesSent
+		merged.BytesReceived += event.BytesReceived
+		merged.PacketsSent += event.PacketsSent
+		merged.PacketsReceived += event.PacketsReceived
+		if event.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = event.Timestamp
+		}
+		merged.DurationNs = max(merged.DurationNs, event.DurationNs)
+	}
+	return out
+}
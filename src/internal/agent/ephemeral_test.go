@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/ebpf"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestEphemeralPortFlowsAggregate(t *testing.T) {
+	a := newTestAgent(t, 10)
+	a.ephemeral = PortRange{Low: 30000, High: 60000}
+	for i, srcPort := range []uint16{41000, 52000, 33333} {
+		a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{
+			Key:     ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: ipv4(10, 0, 0, 6), SrcPort: srcPort, DstPort: 8080, Protocol: 6},
+			Metrics: ebpf.FlowMetrics{BytesSent: 100 * uint64(i+1), PacketsSent: 1},
+		}), sourceFlowTracker)
+	}
+
+	events := coalesceEphemeral(drain(a))
+	if len(events) != 1 {
+		t.Fatalf("%d events after aggregation, want the three connections as one", len(events))
+	}
+	if e := events[0]; e.Source.Port != 0 || e.Destination.Port != 8080 || e.BytesSent != 600 || e.PacketsSent != 3 {
+		t.Errorf("aggregated %d->%d with %d bytes in %d packets, want 0->8080 with 600 in 3",
+			e.Source.Port, e.Destination.Port, e.BytesSent, e.PacketsSent)
+	}
+}
+
+func TestNormalizeEphemeralPort(t *testing.T) {
+	ephemeral := PortRange{Low: 30000, High: 60000}
+	tests := []struct {
+		src, dst uint16
+		want     uint16
+	}{
+		{41000, 443, 0},
+		{30000, 5432, 0},
+		{60000, 8080, 0},
+		{8080, 41000, 8080},   // A server replying to a client keeps its port
+		{41000, 45000, 41000}, // Both ends ephemeral; no service to key on
+		{41000, 0, 41000},
+		{29999, 443, 29999},
+	}
+	for _, tt := range tests {
+		event := types.TransferEvent{Source: types.Endpoint{Port: tt.src}, Destination: types.Endpoint{Port: tt.dst}}
+		if normalizeEphemeralPort(&event, ephemeral) != (tt.want == 0) || event.Source.Port != tt.want {
+			t.Errorf("%d->%d: source port %d, want %d", tt.src, tt.dst, event.Source.Port, tt.want)
+		}
+	}
+
+	event := types.TransferEvent{Source: types.Endpoint{Port: 41000}, Destination: types.Endpoint{Port: 443}}
+	if normalizeEphemeralPort(&event, PortRange{}) || event.Source.Port != 41000 {
+		t.Error("empty range normalized a port")
+	}
+}
+
+func TestCoalesceEphemeralKeepsDistinctFlows(t *testing.T) {
+	now := time.Now()
+	flow := func(dstPort uint16, method string, bytes uint64, at time.Time) types.TransferEvent {
+		return types.TransferEvent{
+			Source:      types.Endpoint{IP: "10.0.0.5"},
+			Destination: types.Endpoint{IP: "10.0.0.6", Port: dstPort},
+			Protocol:    "TCP",
+			HTTPMethod:  method,
+			BytesSent:   bytes,
+			Timestamp:   at,
+			DurationNs:  bytes,
+		}
+	}
+	unnormalized := flow(8080, "GET", 7, now)
+	unnormalized.Source.Port = 41000
+
+	events := coalesceEphemeral([]types.TransferEvent{
+		flow(8080, "GET", 100, now),
+		flow(9090, "GET", 10, now),
+		unnormalized,
+		flow(8080, "POST", 1, now),
+		flow(8080, "GET", 200, now.Add(time.Second)),
+		unnormalized,
+	})
+
+	if len(events) != 5 {
+		t.Fatalf("%d events, want 5", len(events))
+	}
+	if e := events[0]; e.BytesSent != 300 || !e.Timestamp.Equal(now.Add(time.Second)) || e.DurationNs != 200 {
+		t.Errorf("merged GET :8080 = %d bytes at %s lasting %d, want 300 at the latest timestamp lasting 200",
+			e.BytesSent, e.Timestamp, e.DurationNs)
+	}
+	if events[2].Source.Port != 41000 || events[4].Source.Port != 41000 {
+		t.Error("events with a source port were merged")
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	if r, err := ParsePortRange(" 30000 - 60000 "); err != nil || r != (PortRange{Low: 30000, High: 60000}) {
+		t.Errorf("range = %+v, %v", r, err)
+	}
+	if r, err := ParsePortRange(""); err != nil || !r.Empty() {
+		t.Errorf("empty range = %+v, %v", r, err)
+	}
+	for _, s := range []string{"30000", "0-100", "600-500", "1-70000", "low-high"} {
+		if _, err := ParsePortRange(s); err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// jsonCodec stands in for the generated protobuf codec.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+const ingestMethod = "/egressor.Collector/IngestEvents"
+
+// countingListener counts the bytes read from accepted connections.
+type countingListener struct {
+	net.Listener
+	read atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	return &countingConn{Conn: conn, read: &l.read}, err
+}
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// fakeCollector serves ingestMethod, passing received batches to a channel.
+type fakeCollector struct {
+	addr     string
+	listener *countingListener
+	received chan []types.TransferEvent
+}
+
+func startFakeCollector(t *testing.T, opts ...grpc.ServerOption) *fakeCollector {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeCollector{
+		addr:     lis.Addr().String(),
+		listener: &countingListener{Listener: lis},
+		received: make(chan []types.TransferEvent, 1),
+	}
+
+	opts = append(opts, grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		var events []types.TransferEvent
+		if err := stream.RecvMsg(&events); err != nil {
+			return err
+		}
+		c.received <- events
+		return stream.SendMsg(&struct{}{})
+	}))
+	server := grpc.NewServer(opts...)
+	go server.Serve(c.listener)
+	t.Cleanup(server.Stop)
+	return c
+}
+
+// send pushes events over the exporter's connection.
+func send(e *Exporter, events []types.TransferEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var reply struct{}
+	return e.conn.Invoke(ctx, ingestMethod, &events, &reply, grpc.CallContentSubtype("json"))
+}
+
+// exportBatch is a batch that compresses well, as real batches do.
+func exportBatch() []types.TransferEvent {
+	events := make([]types.TransferEvent, 200)
+	for i := range events {
+		events[i] = types.TransferEvent{
+			Timestamp:   time.Date(2026, 3, 1, 12, 0, i, 0, time.UTC),
+			Source:      types.Endpoint{IP: "10.0.0.1", Port: 40000, Identity: &types.ServiceIdentity{Namespace: "shop", Name: "api"}},
+			Destination: types.Endpoint{IP: fmt.Sprintf("203.0.113.%d", i%4), Port: 443, IsInternet: true},
+			Protocol:    "tcp",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   uint64(1000 + i),
+		}
+	}
+	return events
+}
+
+// exportedBytes sends a batch with the given compression and returns what
+// the collector read off the wire.
+func exportedBytes(t *testing.T, compression string, events []types.TransferEvent) int64 {
+	t.Helper()
+	collector := startFakeCollector(t)
+
+	exporter, err := NewExporter(collector.addr, ExporterOptions{Compression: compression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	if err := send(exporter, events); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-collector.received; !reflect.DeepEqual(got, events) {
+		t.Fatalf("collector received %d events that differ from the %d sent", len(got), len(events))
+	}
+	return collector.listener.read.Load()
+}
+
+func TestCompressedExportRoundTrip(t *testing.T) {
+	events := exportBatch()
+
+	plain := exportedBytes(t, "", events)
+	compressed := exportedBytes(t, "gzip", events)
+
+	if compressed*2 > plain {
+		t.Errorf("gzip export read %d bytes, plain %d; want less than half", compressed, plain)
+	}
+}
+
+func TestNewExporterRejectsUnknownCompression(t *testing.T) {
+	if _, err := NewExporter("127.0.0.1:1", ExporterOptions{Compression: "brotli"}); err == nil {
+		t.Error("want error for an unregistered compressor")
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import "time"
+
+const (
+	// exportBatchSize is the baseline export batch size.
+	exportBatchSize = 1000
+	// maxExportBatchSize caps batch growth under sustained load.
+	maxExportBatchSize = 16000
+	// exportHighWaterRatio is the queue fill ratio that forces a flush.
+	exportHighWaterRatio = 0.5
+	// minExportIntervalDivisor bounds how far the interval shrinks.
+	minExportIntervalDivisor = 8
+	// maxInFlightExports caps concurrent exports. Further flushes wait, so
+	// a slow collector backs up the queue instead of piling up goroutines.
+	maxInFlightExports = 4
+)
+
+// flushPolicy adapts export batching to queue pressure. Under load it flushes
+// early with larger batches and a shorter interval; when idle it backs off
+// towards the configured interval, which is never exceeded.
+type flushPolicy struct {
+	batchSize   int
+	interval    time.Duration
+	minInterval time.Duration
+	maxInterval time.Duration
+	highWater   int
+}
+
+// newFlushPolicy creates a policy for a queue of the given capacity.
+func newFlushPolicy(maxInterval time.Duration, queueCap int) *flushPolicy {
+	return &flushPolicy{
+		batchSize:   exportBatchSize,
+		interval:    maxInterval,
+		minInterval: maxInterval / minExportIntervalDivisor,
+		maxInterval: maxInterval,
+		highWater:   int(float64(queueCap) * exportHighWaterRatio),
+	}
+}
+
+// ShouldFlush reports whether the batch should be exported now. A queue
+// above the high-water mark counts as pressure and grows the batch size;
+// the caller should then top the batch up to BatchSize from the queue.
+func (p *flushPolicy) ShouldFlush(batchLen, queueDepth int) bool {
+	if queueDepth >= p.highWater {
+		p.onPressure()
+		return true
+	}
+	return batchLen >= p.batchSize
+}
+
+// OnTick adjusts the interval after a timer flush of batchLen events.
+func (p *flushPolicy) OnTick(batchLen int) {
+	if batchLen == 0 {
+		// Idle: back off towards the configured interval
+		p.interval = min(p.interval*2, p.maxInterval)
+		p.batchSize = max(p.batchSize/2, exportBatchSize)
+		return
+	}
+	if batchLen >= p.batchSize {
+		p.onPressure()
+	}
+}
+
+// BatchSize returns the current batch size.
+func (p *flushPolicy) BatchSize() int {
+	return p.batchSize
+}
+
+// Interval returns the current flush interval.
+func (p *flushPolicy) Interval() time.Duration {
+	return p.interval
+}
+
+// onPressure grows the batch size and shortens the flush interval.
+func (p *flushPolicy) onPressure() {
+	p.batchSize = min(p.batchSize*2, maxExportBatchSize)
+	p.interval = max(p.interval/2, p.minInterval)
+}
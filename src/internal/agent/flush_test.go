@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// simulateBurst feeds perStep events into a queue of queueCap each step and
+// drains up to the batch size flush returns whenever it asks to flush. It
+// returns how many events were dropped for a full queue.
+func simulateBurst(queueCap, perStep, steps int, step time.Duration,
+	flush func(queued int, elapsed time.Duration) (int, bool)) int {
+	queued, dropped := 0, 0
+	var sinceFlush time.Duration
+	for i := 0; i < steps; i++ {
+		queued += perStep
+		if queued > queueCap {
+			dropped += queued - queueCap
+			queued = queueCap
+		}
+		sinceFlush += step
+		if n, ok := flush(queued, sinceFlush); ok {
+			queued -= min(n, queued)
+			sinceFlush = 0
+		}
+	}
+	return dropped
+}
+
+func TestAdaptiveFlushAbsorbsBurst(t *testing.T) {
+	const (
+		queueCap = 10000
+		interval = time.Second
+		step     = 10 * time.Millisecond
+		perStep  = 800 // 80k events/s for two seconds
+		steps    = 200
+	)
+
+	fixed := simulateBurst(queueCap, perStep, steps, step, func(_ int, elapsed time.Duration) (int, bool) {
+		return exportBatchSize, elapsed >= interval
+	})
+
+	policy := newFlushPolicy(interval, queueCap)
+	adaptive := simulateBurst(queueCap, perStep, steps, step, func(queued int, elapsed time.Duration) (int, bool) {
+		batch := policy.batchSize
+		if policy.ShouldFlush(queued, queued) {
+			return batch, true
+		}
+		if elapsed >= policy.Interval() {
+			policy.OnTick(queued)
+			return batch, true
+		}
+		return 0, false
+	})
+
+	if fixed == 0 {
+		t.Fatal("fixed-interval baseline dropped nothing; the burst is too small to compare")
+	}
+	if adaptive != 0 {
+		t.Errorf("adaptive flushing dropped %d events, fixed interval %d; want none", adaptive, fixed)
+	}
+}
+
+func TestFlushPolicyBacksOffWhenIdle(t *testing.T) {
+	p := newFlushPolicy(8*time.Second, 1000)
+
+	if !p.ShouldFlush(1, 500) {
+		t.Fatal("queue at the high-water mark did not force a flush")
+	}
+	if p.Interval() >= 8*time.Second || p.batchSize <= exportBatchSize {
+		t.Errorf("after pressure interval %s batch %d, want shorter and larger", p.Interval(), p.batchSize)
+	}
+
+	for i := 0; i < 10; i++ {
+		p.OnTick(0)
+	}
+	if p.Interval() != 8*time.Second || p.batchSize != exportBatchSize {
+		t.Errorf("idle interval %s batch %d, want the configured 8s and %d", p.Interval(), p.batchSize, exportBatchSize)
+	}
+}
+
+func TestFlushPolicyBounds(t *testing.T) {
+	p := newFlushPolicy(8*time.Second, 1000)
+	for i := 0; i < 20; i++ {
+		p.ShouldFlush(0, 1000)
+	}
+	if p.Interval() != time.Second || p.batchSize != maxExportBatchSize {
+		t.Errorf("under sustained load interval %s batch %d, want 1s and %d", p.Interval(), p.batchSize, maxExportBatchSize)
+	}
+}
+
+// TestExportLoopDrainsBatchesUnderPressure feeds a backed-up queue to
+// exportLoop while exports stall, and checks that flushes take full batches
+// rather than one event each and that concurrent exports stay capped.
+func TestExportLoopDrainsBatchesUnderPressure(t *testing.T) {
+	const queueCap, total = 1000, 20000
+	a := newTestAgent(t, queueCap)
+	a.cfg.ExportInterval = 50 * time.Millisecond
+	a.stopChan = make(chan struct{})
+
+	var (
+		mu              sync.Mutex
+		sizes           []int
+		exported        int
+		active, maxSeen int
+	)
+	release := make(chan struct{})
+	export := func(ctx context.Context, events []types.TransferEvent) error {
+		mu.Lock()
+		sizes = append(sizes, len(events))
+		active++
+		if active > maxSeen {
+			maxSeen = active
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		active--
+		exported += len(events)
+		mu.Unlock()
+		return nil
+	}
+
+	for i := 0; i < queueCap; i++ {
+		a.events <- types.TransferEvent{}
+	}
+	go func() {
+		for i := queueCap; i < total; i++ {
+			a.events <- types.TransferEvent{}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		a.exportLoop(context.Background(), export)
+		close(done)
+	}()
+
+	// With every export stalled the loop blocks once the cap is reached.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(sizes)
+		mu.Unlock()
+		if n >= maxInFlightExports || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if len(sizes) != maxInFlightExports {
+		t.Errorf("started %d exports while stalled, want %d", len(sizes), maxInFlightExports)
+	}
+	for i, n := range sizes {
+		if n <= 1 {
+			t.Errorf("export %d carried %d events under pressure, want a full batch", i, n)
+		}
+	}
+	mu.Unlock()
+
+	close(release)
+	for {
+		mu.Lock()
+		n := exported
+		mu.Unlock()
+		if n == total || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(a.stopChan)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exported != total {
+		t.Errorf("exported %d events, want %d", exported, total)
+	}
+	if maxSeen > maxInFlightExports {
+		t.Errorf("%d exports ran at once, want at most %d", maxSeen, maxInFlightExports)
+	}
+}
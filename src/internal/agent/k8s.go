@@ -3,6 +3,7 @@ package agent
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -62,6 +63,19 @@ func NewK8sEnricher() (*K8sEnricher, error) {
 	return e, nil
 }
 
+// NodeProviderID returns the spec.providerID of a node, such as
+// "aws:///us-east-1a/i-0abc". It is empty without a Kubernetes client.
+func (e *K8sEnricher) NodeProviderID(ctx context.Context, nodeName string) (string, error) {
+	if e.client == nil {
+		return "", nil
+	}
+	node, err := e.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return node.Spec.ProviderID, nil
+}
+
 // GetIdentity returns service identity for an IP.
 func (e *K8sEnricher) GetIdentity(ip string) *types.ServiceIdentity {
 	e.mu.RLock()
@@ -231,6 +245,7 @@ type ServiceEnricher struct {
 	client        kubernetes.Interface
 	serviceToIPs  map[string][]string
 	ipToService   map[string]string
+	ipToServices  map[string][]string // Endpoint IP -> every Service selecting it
 	mu            sync.RWMutex
 }
 
@@ -240,6 +255,7 @@ func NewServiceEnricher(client kubernetes.Interface) *ServiceEnricher {
 		client:       client,
 		serviceToIPs: make(map[string][]string),
 		ipToService:  make(map[string]string),
+		ipToServices: make(map[string][]string),
 	}
 
 	if client != nil {
@@ -257,6 +273,66 @@ func (e *ServiceEnricher) GetServiceName(ip string) string {
 	return e.ipToService[ip]
 }
 
+// GetFrontingServices returns the Services ("namespace/name") whose
+// endpoints include a pod IP, sorted.
+func (e *ServiceEnricher) GetFrontingServices(ip string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]string(nil), e.ipToServices[ip]...)
+}
+
+// setEndpoints replaces the endpoint IPs of a service. A nil ips removes
+// the service.
+func (e *ServiceEnricher) setEndpoints(key string, ips []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Remove old IPs
+	for _, ip := range e.serviceToIPs[key] {
+		delete(e.ipToService, ip)
+		e.ipToServices[ip] = removeString(e.ipToServices[ip], key)
+		if len(e.ipToServices[ip]) == 0 {
+			delete(e.ipToServices, ip)
+		}
+	}
+	if ips == nil {
+		delete(e.serviceToIPs, key)
+		return
+	}
+
+	// Add new IPs
+	e.serviceToIPs[key] = ips
+	for _, ip := range ips {
+		e.ipToService[ip] = key
+		if !containsString(e.ipToServices[ip], key) {
+			services := append(e.ipToServices[ip], key)
+			sort.Strings(services)
+			e.ipToServices[ip] = services
+		}
+	}
+}
+
+// containsString reports whether s is in list.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns list without s.
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // watchServices watches for service changes.
 func (e *ServiceEnricher) watchServices() {
 	for {
@@ -300,27 +376,18 @@ func (e *ServiceEnricher) watchEndpoints() {
 			}
 
 			key := ep.Namespace + "/" + ep.Name
-			var ips []string
+			if event.Type == watch.Deleted {
+				e.setEndpoints(key, nil)
+				continue
+			}
 
+			ips := []string{}
 			for _, subset := range ep.Subsets {
 				for _, addr := range subset.Addresses {
 					ips = append(ips, addr.IP)
 				}
 			}
-
-			e.mu.Lock()
-			// Remove old IPs
-			if oldIPs, ok := e.serviceToIPs[key]; ok {
-				for _, ip := range oldIPs {
-					delete(e.ipToService, ip)
-				}
-			}
-			// Add new IPs
-			e.serviceToIPs[key] = ips
-			for _, ip := range ips {
-				e.ipToService[ip] = key
-			}
-			e.mu.Unlock()
+			e.setEndpoints(key, ips)
 		}
 	}
 }
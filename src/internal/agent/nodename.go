@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Sources the node name can be read from.
+const (
+	NodeNameSourceFlag     = "flag"     // --node-name
+	NodeNameSourceEnv      = "env"      // Environment variable, NODE_NAME by default
+	NodeNameSourceFile     = "file"     // File written by a downward API volume
+	NodeNameSourceHostname = "hostname" // os.Hostname
+)
+
+// DefaultNodeNameSources is the order sources are tried in when none is
+// configured.
+var DefaultNodeNameSources = []string{
+	NodeNameSourceFlag, NodeNameSourceEnv, NodeNameSourceFile, NodeNameSourceHostname,
+}
+
+// Defaults for NodeNameConfig.
+const (
+	defaultNodeNameEnv  = "NODE_NAME"
+	defaultNodeNameFile = "/etc/podinfo/nodename"
+)
+
+// NodeNameConfig configures where the agent looks for its node name.
+type NodeNameConfig struct {
+	Sources []string // Tried in order; empty uses DefaultNodeNameSources
+	Flag    string   // Value of --node-name
+	EnvVar  string   // Defaults to NODE_NAME
+	File    string   // Defaults to /etc/podinfo/nodename
+}
+
+// ResolveNodeName returns the node name from the first configured source
+// that has one, and which source that was. Both are empty if no source
+// has a name. A missing node name file is skipped like an empty one.
+func ResolveNodeName(cfg NodeNameConfig) (name, source string, err error) {
+	return resolveNodeName(cfg, os.Getenv, os.ReadFile, os.Hostname)
+}
+
+// resolveNodeName implements ResolveNodeName with injectable lookups.
+func resolveNodeName(
+	cfg NodeNameConfig,
+	getenv func(string) string,
+	readFile func(string) ([]byte, error),
+	hostname func() (string, error),
+) (string, string, error) {
+	sources := cfg.Sources
+	if len(sources) == 0 {
+		sources = DefaultNodeNameSources
+	}
+	if cfg.EnvVar == "" {
+		cfg.EnvVar = defaultNodeNameEnv
+	}
+	if cfg.File == "" {
+		cfg.File = defaultNodeNameFile
+	}
+
+	for _, source := range sources {
+		var name string
+		switch source = strings.ToLower(strings.TrimSpace(source)); source {
+		case NodeNameSourceFlag:
+			name = cfg.Flag
+		case NodeNameSourceEnv:
+			name = getenv(cfg.EnvVar)
+		case NodeNameSourceFile:
+			data, err := readFile(cfg.File)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", "", fmt.Errorf("reading node name file: %w", err)
+			}
+			name = string(data)
+		case NodeNameSourceHostname:
+			h, err := hostname()
+			if err != nil {
+				return "", "", fmt.Errorf("reading hostname: %w", err)
+			}
+			name = h
+		default:
+			return "", "", fmt.Errorf("unknown node name source %q (known: %s)",
+				source, strings.Join(DefaultNodeNameSources, ", "))
+		}
+
+		if name = strings.TrimSpace(name); name != "" {
+			return name, source, nil
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveNodeNameFallbackOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        NodeNameConfig
+		env        string
+		file       string // Missing when empty
+		wantName   string
+		wantSource string
+	}{
+		{"flag first", NodeNameConfig{Flag: "node-flag"}, "node-env", "node-file", "node-flag", NodeNameSourceFlag},
+		{"env without flag", NodeNameConfig{}, "node-env", "node-file", "node-env", NodeNameSourceEnv},
+		{"file without env", NodeNameConfig{}, "", "node-file\n", "node-file", NodeNameSourceFile},
+		{"hostname last", NodeNameConfig{}, "", "", "host-1", NodeNameSourceHostname},
+		{"blank values skipped", NodeNameConfig{Flag: "  "}, " ", " \n", "host-1", NodeNameSourceHostname},
+		{"configured order", NodeNameConfig{Sources: []string{"File", "flag"}, Flag: "node-flag"}, "node-env", "node-file", "node-file", NodeNameSourceFile},
+		{"none found", NodeNameConfig{Sources: []string{"env", "file"}}, "", "", "", ""},
+	}
+	for _, tt := range tests {
+		getenv := func(key string) string {
+			if key != defaultNodeNameEnv {
+				t.Errorf("%s: read env %s, want %s", tt.name, key, defaultNodeNameEnv)
+			}
+			return tt.env
+		}
+		readFile := func(path string) ([]byte, error) {
+			if tt.file == "" {
+				return nil, fs.ErrNotExist
+			}
+			return []byte(tt.file), nil
+		}
+		hostname := func() (string, error) { return "host-1", nil }
+
+		name, source, err := resolveNodeName(tt.cfg, getenv, readFile, hostname)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if name != tt.wantName || source != tt.wantSource {
+			t.Errorf("%s: got %q from %q, want %q from %q", tt.name, name, source, tt.wantName, tt.wantSource)
+		}
+	}
+}
+
+func TestResolveNodeNameErrors(t *testing.T) {
+	getenv := func(string) string { return "" }
+	hostname := func() (string, error) { return "", errors.New("no hostname") }
+	unreadable := func(string) ([]byte, error) { return nil, fs.ErrPermission }
+	missing := func(string) ([]byte, error) { return nil, fs.ErrNotExist }
+
+	for name, tt := range map[string]struct {
+		cfg      NodeNameConfig
+		readFile func(string) ([]byte, error)
+	}{
+		"unknown source":   {NodeNameConfig{Sources: []string{"kubelet"}}, missing},
+		"unreadable file":  {NodeNameConfig{Sources: []string{"file"}}, unreadable},
+		"hostname failure": {NodeNameConfig{}, missing},
+	} {
+		if _, _, err := resolveNodeName(tt.cfg, getenv, tt.readFile, hostname); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestResolveNodeNameReadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodename")
+	if err := os.WriteFile(path, []byte("node-7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name, source, err := ResolveNodeName(NodeNameConfig{Sources: []string{"file"}, File: path})
+	if err != nil || name != "node-7" || source != NodeNameSourceFile {
+		t.Errorf("got %q from %q, %v; want node-7 from the file", name, source, err)
+	}
+}
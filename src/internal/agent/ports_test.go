@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/ebpf"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestWellKnownPortsTagged(t *testing.T) {
+	a := newTestAgent(t, 10)
+	for _, port := range []uint16{53, 123, 443} {
+		a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{
+			Key:     ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: ipv4(10, 96, 0, 10), SrcPort: 40000, DstPort: port, Protocol: 17},
+			Metrics: ebpf.FlowMetrics{BytesSent: 100},
+		}), sourceFlowTracker)
+	}
+
+	want := map[uint16]string{53: types.WellKnownServiceDNS, 123: types.WellKnownServiceNTP, 443: ""}
+	events := drain(a)
+	if len(events) != len(want) {
+		t.Fatalf("queued %d events, want %d", len(events), len(want))
+	}
+	for _, e := range events {
+		svc := want[e.Destination.Port]
+		if e.Destination.WellKnownService != svc || e.Labels[WellKnownServiceLabel] != svc || e.Destination.CloudServiceName != "" {
+			t.Errorf("port %d: service %q label %q cloud service %q, want %q and no cloud service",
+				e.Destination.Port, e.Destination.WellKnownService, e.Labels[WellKnownServiceLabel], e.Destination.CloudServiceName, svc)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/ebpf"
+)
+
+func TestPodBehindServiceGetsServiceAnnotation(t *testing.T) {
+	a := newTestAgent(t, 10)
+	a.enricher.ipToPod["10.0.0.6"] = &PodInfo{Name: "db-0", Namespace: "shop", OwnerKind: "StatefulSet", OwnerName: "db"}
+	a.services.setEndpoints("shop/api", []string{"10.0.0.5"})
+	a.services.setEndpoints("shop/db", []string{"10.0.0.6"})
+	a.services.setEndpoints("shop/db-read", []string{"10.0.0.6", "10.0.0.7"})
+
+	a.enrichAndQueue(*a.convertFlowEvent(ebpf.FlowEvent{
+		Key:     ebpf.FlowKey{SrcIP: ipv4(10, 0, 0, 5), DstIP: ipv4(10, 0, 0, 6), SrcPort: 40000, DstPort: 5432, Protocol: 6},
+		Metrics: ebpf.FlowMetrics{BytesSent: 100},
+	}), sourceFlowTracker)
+
+	events := drain(a)
+	if len(events) != 1 {
+		t.Fatalf("queued %d events, want 1", len(events))
+	}
+	src, dst := events[0].Source.Identity, events[0].Destination.Identity
+	if src == nil || !reflect.DeepEqual(src.Services, []string{"shop/api"}) {
+		t.Errorf("source identity = %+v, want fronted by shop/api", src)
+	}
+	if dst == nil || !reflect.DeepEqual(dst.Services, []string{"shop/db", "shop/db-read"}) {
+		t.Errorf("destination identity = %+v, want fronted by shop/db and shop/db-read", dst)
+	}
+}
+
+func TestFrontingServicesFollowEndpointChanges(t *testing.T) {
+	e := NewServiceEnricher(nil)
+	e.setEndpoints("shop/web", []string{"10.0.0.5", "10.0.0.6"})
+	e.setEndpoints("shop/admin", []string{"10.0.0.5"})
+
+	if got := e.GetFrontingServices("10.0.0.5"); !reflect.DeepEqual(got, []string{"shop/admin", "shop/web"}) {
+		t.Errorf("10.0.0.5 fronted by %v, want admin and web", got)
+	}
+
+	// The pod leaves web's endpoints, then admin is deleted
+	e.setEndpoints("shop/web", []string{"10.0.0.6"})
+	if got := e.GetFrontingServices("10.0.0.5"); !reflect.DeepEqual(got, []string{"shop/admin"}) {
+		t.Errorf("10.0.0.5 fronted by %v after leaving web, want admin", got)
+	}
+	e.setEndpoints("shop/admin", nil)
+	if got := e.GetFrontingServices("10.0.0.5"); len(got) != 0 {
+		t.Errorf("10.0.0.5 fronted by %v after admin was deleted, want none", got)
+	}
+	if got := e.GetFrontingServices("10.0.0.6"); !reflect.DeepEqual(got, []string{"shop/web"}) {
+		t.Errorf("10.0.0.6 fronted by %v, want web", got)
+	}
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/egressor/egressor/src/internal/transport"
+)
+
+// testCA issues certificates for TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // PEM bundle with the CA certificate
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, file: filepath.Join(dir, name+"-ca.pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate and key for name, returning their paths.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSCollector starts a fake collector requiring client certificates
+// signed by ca.
+func startTLSCollector(t *testing.T, dir string, ca *testCA) *fakeCollector {
+	t.Helper()
+	certFile, keyFile := ca.issue(t, dir, "collector", x509.ExtKeyUsageServerAuth)
+	serverTLS, err := transport.TLSConfig{
+		Enabled:    true,
+		CAFile:     ca.file,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ClientAuth: true,
+	}.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startFakeCollector(t, grpc.Creds(credentials.NewTLS(serverTLS)))
+}
+
+// exportOverTLS sends one batch to the collector with the client TLS settings.
+func exportOverTLS(t *testing.T, addr string, cfg transport.TLSConfig) error {
+	t.Helper()
+	clientTLS, err := cfg.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Present the certificate even when its issuer is not among the CAs the
+	// collector asks for; crypto/tls would otherwise send none
+	if clientTLS != nil && len(clientTLS.Certificates) > 0 {
+		cert := &clientTLS.Certificates[0]
+		clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+	exporter, err := NewExporter(addr, ExporterOptions{TLS: clientTLS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+	return send(exporter, exportBatch()[:1])
+}
+
+func TestExportOverMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "egressor")
+	collector := startTLSCollector(t, dir, ca)
+
+	certFile, keyFile := ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+	err := exportOverTLS(t, collector.addr, transport.TLSConfig{
+		Enabled:    true,
+		CAFile:     ca.file,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "collector",
+	})
+	if err != nil {
+		t.Fatalf("trusted agent: %v", err)
+	}
+	if got := <-collector.received; len(got) != 1 {
+		t.Errorf("collector received %d events, want 1", len(got))
+	}
+}
+
+func TestCollectorRejectsUntrustedClient(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "egressor")
+	collector := startTLSCollector(t, dir, ca)
+
+	rogue := newTestCA(t, dir, "rogue")
+	rogueCert, rogueKey := rogue.issue(t, dir, "intruder", x509.ExtKeyUsageClientAuth)
+	trustedCert, trustedKey := ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+
+	for name, tt := range map[string]struct {
+		cfg  transport.TLSConfig
+		want string // Part of the handshake error naming the failed check
+	}{
+		"certificate from another CA": {transport.TLSConfig{Enabled: true, CAFile: ca.file, CertFile: rogueCert, KeyFile: rogueKey, ServerName: "collector"}, "unknown certificate authority"},
+		"no client certificate":       {transport.TLSConfig{Enabled: true, CAFile: ca.file, ServerName: "collector"}, "certificate required"},
+		"untrusted collector":         {transport.TLSConfig{Enabled: true, CAFile: rogue.file, CertFile: trustedCert, KeyFile: trustedKey, ServerName: "collector"}, "certificate signed by unknown authority"},
+	} {
+		err := exportOverTLS(t, collector.addr, tt.cfg)
+		if err == nil {
+			t.Errorf("%s: export succeeded, want it rejected", name)
+		} else if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q, want a verification failure (%q)", name, err, tt.want)
+		}
+	}
+	select {
+	case events := <-collector.received:
+		t.Errorf("collector accepted %d events from an untrusted client", len(events))
+	default:
+	}
+}
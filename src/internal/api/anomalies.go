@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// maxAnomalyPageSize caps the limit parameter of anomaly listings.
+const maxAnomalyPageSize = 1000
+
+// anomalyQuery holds the filters, ordering and page of an anomaly listing.
+type anomalyQuery struct {
+	severity types.Severity
+	kind     types.AnomalyType
+	since    time.Time
+	until    time.Time
+	sort     string
+	limit    int
+	offset   int
+}
+
+// parseAnomalyQuery reads severity, type, since, until, sort, limit and
+// offset from the request. Times are RFC 3339; sort is "time" (newest
+// first, the default) or "cost" (largest estimated impact first).
+func parseAnomalyQuery(r *http.Request) (anomalyQuery, error) {
+	q := r.URL.Query()
+	aq := anomalyQuery{
+		severity: types.Severity(q.Get("severity")),
+		kind:     types.AnomalyType(q.Get("type")),
+		sort:     q.Get("sort"),
+	}
+
+	switch aq.severity {
+	case "", types.SeverityInfo, types.SeverityLow, types.SeverityMedium, types.SeverityHigh, types.SeverityCritical:
+	default:
+		return aq, fmt.Errorf("invalid severity %q", aq.severity)
+	}
+
+	switch aq.sort {
+	case "":
+		aq.sort = "time"
+	case "time", "cost":
+	default:
+		return aq, fmt.Errorf("invalid sort %q: must be time or cost", aq.sort)
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if aq.since, err = time.Parse(time.RFC3339, v); err != nil {
+			return aq, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if aq.until, err = time.Parse(time.RFC3339, v); err != nil {
+			return aq, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if !aq.since.IsZero() && !aq.until.IsZero() && !aq.until.After(aq.since) {
+		return aq, fmt.Errorf("until must be after since")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		if aq.limit, err = strconv.Atoi(v); err != nil || aq.limit < 1 || aq.limit > maxAnomalyPageSize {
+			return aq, fmt.Errorf("invalid limit %q: must be between 1 and %d", v, maxAnomalyPageSize)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if aq.offset, err = strconv.Atoi(v); err != nil || aq.offset < 0 {
+			return aq, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+
+	return aq, nil
+}
+
+// apply filters and orders anomalies, returning the requested page and the
+// number of matches before paging.
+func (aq anomalyQuery) apply(anomalies []*types.Anomaly) ([]*types.Anomaly, int) {
+	matched := make([]*types.Anomaly, 0, len(anomalies))
+	for _, a := range anomalies {
+		if aq.severity != "" && a.Severity != aq.severity {
+			continue
+		}
+		if aq.kind != "" && a.Type != aq.kind {
+			continue
+		}
+		if !aq.since.IsZero() && a.DetectedAt.Before(aq.since) {
+			continue
+		}
+		if !aq.until.IsZero() && !a.DetectedAt.Before(aq.until) {
+			continue
+		}
+		matched = append(matched, a)
+	}
+
+	if aq.sort == "cost" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].EstimatedCostImpactUSD > matched[j].EstimatedCostImpactUSD
+		})
+	} else {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].DetectedAt.After(matched[j].DetectedAt)
+		})
+	}
+
+	total := len(matched)
+	if aq.offset >= total {
+		return []*types.Anomaly{}, total
+	}
+	matched = matched[aq.offset:]
+	if aq.limit > 0 && len(matched) > aq.limit {
+		matched = matched[:aq.limit]
+	}
+	return matched, total
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// listAnomalies calls getAnomalies with query and returns the source
+// services in response order and the X-Total-Count header.
+func listAnomalies(t *testing.T, s *Server, query string) ([]string, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.getAnomalies(w, httptest.NewRequest(http.MethodGet, "/api/v1/anomalies?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body %s", query, w.Code, w.Body)
+	}
+	var anomalies []types.Anomaly
+	if err := json.NewDecoder(w.Body).Decode(&anomalies); err != nil {
+		t.Fatal(err)
+	}
+	sources := make([]string, len(anomalies))
+	for i, a := range anomalies {
+		sources[i] = a.SourceService
+	}
+	return sources, w.Header().Get("X-Total-Count")
+}
+
+// anomalyServer has anomalies a to e, detected an hour apart starting with
+// a, with the given severities and cost impacts.
+func anomalyServer() (*Server, time.Time) {
+	s := newMockServer()
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	for i, a := range []struct {
+		severity types.Severity
+		cost     float64
+		kind     types.AnomalyType
+	}{
+		{types.SeverityHigh, 40, types.AnomalyTypeSpike},
+		{types.SeverityLow, 500, types.AnomalyTypeSpike},
+		{types.SeverityHigh, 120, types.AnomalyTypeNewEndpoint},
+		{types.SeverityCritical, 80, types.AnomalyTypeSpike},
+		{types.SeverityHigh, 10, types.AnomalyTypeSpike},
+	} {
+		s.baseline.AddAnomaly(&types.Anomaly{
+			ID:                     uuid.New(),
+			Type:                   a.kind,
+			Severity:               a.severity,
+			SourceService:          string(rune('a' + i)),
+			DetectedAt:             start.Add(time.Duration(i) * time.Hour),
+			EstimatedCostImpactUSD: a.cost,
+		})
+	}
+	return s, start
+}
+
+func TestAnomaliesFilterBySeverity(t *testing.T) {
+	s, start := anomalyServer()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"e", "d", "c", "b", "a"}},
+		{"severity=high", []string{"e", "c", "a"}},
+		{"severity=high&type=spike", []string{"e", "a"}},
+		{"severity=critical", []string{"d"}},
+		{"severity=medium", []string{}},
+		{"since=" + start.Add(time.Hour).Format(time.RFC3339) + "&until=" + start.Add(3*time.Hour).Format(time.RFC3339), []string{"c", "b"}},
+	}
+	for _, tt := range tests {
+		got, total := listAnomalies(t, s, tt.query)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+		if total != strconv.Itoa(len(tt.want)) {
+			t.Errorf("%q: X-Total-Count = %s, want %d", tt.query, total, len(tt.want))
+		}
+	}
+}
+
+func TestAnomaliesSortByCost(t *testing.T) {
+	s, _ := anomalyServer()
+
+	got, _ := listAnomalies(t, s, "sort=cost")
+	if want := []string{"b", "c", "d", "a", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cost order = %v, want %v", got, want)
+	}
+
+	got, total := listAnomalies(t, s, "sort=cost&severity=high&limit=2&offset=1")
+	if want := []string{"a", "e"}; !reflect.DeepEqual(got, want) || total != "3" {
+		t.Errorf("second page = %v of %s, want %v of 3", got, total, want)
+	}
+}
+
+func TestAnomaliesRejectBadQuery(t *testing.T) {
+	s, _ := anomalyServer()
+	for _, query := range []string{"severity=urgent", "sort=size", "limit=0", "offset=-1", "since=yesterday",
+		"since=2026-03-02T00:00:00Z&until=2026-03-01T00:00:00Z"} {
+		w := httptest.NewRecorder()
+		s.getAnomalies(w, httptest.NewRequest(http.MethodGet, "/api/v1/anomalies?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+}
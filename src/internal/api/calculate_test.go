@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func postCalculation(s *Server, flows []types.TransferFlow) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(flows)
+	w := httptest.NewRecorder()
+	s.calculateCosts(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/calculate", bytes.NewReader(body)))
+	return w
+}
+
+func TestCalculateCostsMixedTypes(t *testing.T) {
+	s := newMockServer()
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	source := types.ServiceIdentity{Namespace: "shop", Name: "api", CloudProvider: "aws", Region: "us-east-1", AvailabilityZone: "us-east-1a"}
+	flows := []types.TransferFlow{{
+		SourceIdentity:      source,
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          5 << 30,
+	}, {
+		SourceIdentity:      source,
+		DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: "db", CloudProvider: "aws", Region: "us-east-1", AvailabilityZone: "us-east-1b"},
+		Type:                types.TransferTypeCrossAZ,
+		TotalBytes:          3 << 30,
+	}, {
+		SourceIdentity:      source,
+		DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: "replica", CloudProvider: "aws", Region: "eu-west-1", AvailabilityZone: "eu-west-1a"},
+		Type:                types.TransferTypeCrossRegion,
+		TotalBytes:          2 << 30,
+	}}
+	for i := range flows {
+		flows[i].WindowStart = start
+		flows[i].WindowEnd = start.Add(time.Hour)
+	}
+
+	w := postCalculation(s, flows)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var result CostCalculation
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Breakdowns) != len(flows) {
+		t.Fatalf("got %d breakdowns, want %d", len(result.Breakdowns), len(flows))
+	}
+	categories := make(map[types.CostCategory]bool)
+	var total float64
+	for i, b := range result.Breakdowns {
+		want := s.costEngine.CalculateCost(flows[i])
+		if b.Category != want.Category || math.Abs(b.CostUSD-want.CostUSD) > 1e-9 || b.BytesTransferred != flows[i].TotalBytes {
+			t.Errorf("breakdown %d = %+v, want %+v in request order", i, b, want)
+		}
+		if b.CostUSD <= 0 {
+			t.Errorf("breakdown %d (%s) is free, want a priced transfer", i, flows[i].Type)
+		}
+		categories[b.Category] = true
+		total += b.CostUSD
+	}
+	if len(categories) != len(flows) {
+		t.Errorf("categories = %v, want one per transfer type", categories)
+	}
+
+	if math.Abs(result.Summary.TotalCostUSD-total) > 1e-9 || result.Summary.TotalBytes != 10<<30 {
+		t.Errorf("summary total %v over %d bytes, want %v over %d", result.Summary.TotalCostUSD, result.Summary.TotalBytes, total, 10<<30)
+	}
+	if result.Summary.EgressCostUSD <= 0 || result.Summary.CrossAZCostUSD <= 0 || result.Summary.CrossRegionCostUSD <= 0 {
+		t.Errorf("summary = %+v, want egress, cross-AZ and cross-region costs", result.Summary)
+	}
+	if stats := s.graphEngine.GetStats(); stats.TotalNodes != 0 {
+		t.Error("calculated flows were ingested into the graph")
+	}
+}
+
+func TestCalculateCostsRejectsOversizedBatch(t *testing.T) {
+	s := newMockServer()
+	flow := types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          1000,
+	}
+	flows := make([]types.TransferFlow, maxCostCalculationFlows+1)
+	for i := range flows {
+		flows[i] = flow
+	}
+
+	if w := postCalculation(s, flows); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d for %d flows, want 413", w.Code, len(flows))
+	}
+	if w := postCalculation(s, flows[:maxCostCalculationFlows]); w.Code != http.StatusOK {
+		t.Errorf("status = %d at the cap, want 200", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	s.calculateCosts(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/calculate", bytes.NewReader([]byte(`{"not":"a list"}`))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for a non-array body, want 400", w.Code)
+	}
+}
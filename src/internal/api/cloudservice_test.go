@@ -0,0 +1,47 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestCostByCloudServiceTotals(t *testing.T) {
+	const gb = 1 << 30
+	s := &Server{costEngine: engine.NewCostEngine()}
+	results := []storage.CloudServiceResult{
+		{CloudService: "s3", TransferType: "egress", TotalBytes: 10 * gb, EventCount: 100},
+		{CloudService: "dynamodb", TransferType: "egress", TotalBytes: 5 * gb, EventCount: 40},
+		{CloudService: "s3", TransferType: "cross_az", TotalBytes: 2 * gb, EventCount: 20},
+		{CloudService: types.WellKnownServiceDNS, TransferType: "egress", TotalBytes: gb, EventCount: 1000},
+	}
+
+	price := func(svc string, transferType types.TransferType, bytes uint64) float64 {
+		return s.costEngine.CalculateCost(types.TransferFlow{
+			Type:                transferType,
+			TotalBytes:          bytes,
+			DestinationEndpoint: &types.Endpoint{CloudServiceName: svc},
+		}).CostUSD
+	}
+	want := []CloudServiceCost{
+		{CloudService: "s3", TotalBytes: 12 * gb, EventCount: 120, CostUSD: price("s3", types.TransferTypeEgress, 10*gb) + price("s3", types.TransferTypeCrossAZ, 2*gb)},
+		{CloudService: "dynamodb", TotalBytes: 5 * gb, EventCount: 40, CostUSD: price("dynamodb", types.TransferTypeEgress, 5*gb)},
+	}
+
+	got := s.cloudServiceCosts(results)
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want s3 and dynamodb without DNS", got)
+	}
+	for i := range want {
+		if got[i].CloudService != want[i].CloudService || got[i].TotalBytes != want[i].TotalBytes ||
+			got[i].EventCount != want[i].EventCount || math.Abs(got[i].CostUSD-want[i].CostUSD) > 1e-9 {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[0].CostUSD <= got[1].CostUSD || got[1].CostUSD <= 0 {
+		t.Errorf("costs s3 $%v dynamodb $%v, want both priced, s3 first", got[0].CostUSD, got[1].CostUSD)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// Cost metric defaults used when Config leaves them unset.
+const (
+	defaultCostMetricsInterval = time.Minute
+	defaultCostMetricsTopN     = 20
+)
+
+// otherNamespaces labels the combined cost of namespaces outside the top N.
+const otherNamespaces = "_other"
+
+// costMetrics exports attributed cost as Prometheus gauges. Only the top N
+// namespaces by cost get their own series so cardinality stays bounded.
+type costMetrics struct {
+	topN        int
+	costUSD     *prometheus.GaugeVec
+	egressBytes *prometheus.GaugeVec
+	coverage    prometheus.Gauge
+}
+
+func newCostMetrics(topN int) *costMetrics {
+	return &costMetrics{
+		topN: topN,
+		costUSD: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "egressor_cost_usd",
+			Help: "Transfer cost over the default query range by namespace and category",
+		}, []string{"namespace", "category"}),
+		egressBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "egressor_egress_bytes",
+			Help: "Internet egress bytes over the default query range by namespace",
+		}, []string{"namespace"}),
+		coverage: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "egressor_cost_raw_sample_rate",
+			Help: "Lowest raw retention rate among the flows behind the cost gauges; below 1 they leave out flows not retained raw",
+		}),
+	}
+}
+
+// update replaces all series with values from attributions.
+func (m *costMetrics) update(attributions []types.CostAttribution) {
+	cost := make(map[string]map[types.CostCategory]float64)
+	egress := make(map[string]uint64)
+	total := make(map[string]float64)
+	coverage := 1.0
+	for _, a := range attributions {
+		if a.RawSampleRate > 0 {
+			coverage = types.LowerRawSampleRate(coverage, a.RawSampleRate)
+		}
+		if cost[a.Namespace] == nil {
+			cost[a.Namespace] = make(map[types.CostCategory]float64)
+		}
+		for _, b := range a.Breakdown {
+			cost[a.Namespace][b.Category] += b.CostUSD
+			if b.Category == types.CostCategoryEgressInternet {
+				egress[a.Namespace] += b.BytesTransferred
+			}
+		}
+		total[a.Namespace] += a.TotalCostUSD
+	}
+
+	namespaces := make([]string, 0, len(total))
+	for ns := range total {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		if total[namespaces[i]] != total[namespaces[j]] {
+			return total[namespaces[i]] > total[namespaces[j]]
+		}
+		return namespaces[i] < namespaces[j]
+	})
+
+	m.costUSD.Reset()
+	m.egressBytes.Reset()
+	m.coverage.Set(coverage)
+	for i, ns := range namespaces {
+		label := ns
+		if i >= m.topN {
+			label = otherNamespaces
+		}
+		for category, usd := range cost[ns] {
+			m.costUSD.WithLabelValues(label, string(category)).Add(usd)
+		}
+		m.egressBytes.WithLabelValues(label).Add(float64(egress[ns]))
+	}
+}
+
+// runCostMetrics refreshes the cost gauges until ctx is done.
+func (s *Server) runCostMetrics(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CostMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		s.refreshCostMetrics(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshCostMetrics attributes flows over the default query range and
+// updates the cost gauges.
+func (s *Server) refreshCostMetrics(ctx context.Context) {
+	if s.storage == nil {
+		return
+	}
+
+	end := time.Now()
+	query := storage.FlowQuery{
+		Start:     end.Add(-s.cfg.DefaultQueryRange),
+		End:       end,
+		SrcLabels: s.attributionLabels(),
+		Limit:     10000,
+	}
+	results, err := s.storage.QueryFlowsByVersion(ctx, query)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh cost metrics")
+		return
+	}
+
+	flows := make([]types.TransferFlow, len(results))
+	for i, res := range results {
+		flows[i] = res.ToFlow(query.Start, query.End)
+	}
+	s.costMetrics.update(s.costEngine.CalculateAttribution(ctx, flows, query.Start, query.End))
+}
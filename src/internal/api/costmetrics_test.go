@@ -0,0 +1,91 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// attribution returns a namespace's cost split into internet egress and
+// cross-AZ.
+func attribution(namespace string, egressUSD, crossAZUSD float64, egressBytes uint64) types.CostAttribution {
+	return types.CostAttribution{
+		Namespace:    namespace,
+		TotalCostUSD: egressUSD + crossAZUSD,
+		Breakdown: []types.CostBreakdown{
+			{Category: types.CostCategoryEgressInternet, CostUSD: egressUSD, BytesTransferred: egressBytes},
+			{Category: types.CostCategoryCrossAZ, CostUSD: crossAZUSD, BytesTransferred: 1000},
+		},
+	}
+}
+
+func TestCostMetricsScrape(t *testing.T) {
+	m := newCostMetrics(defaultCostMetricsTopN)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.costUSD, m.egressBytes)
+	m.update([]types.CostAttribution{
+		attribution("shop", 12.5, 2, 5000),
+		attribution("shop", 0.5, 0, 100),
+		attribution("batch", 3, 1, 800),
+	})
+
+	srv := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`egressor_cost_usd{category="egress_internet",namespace="shop"} 13`,
+		`egressor_cost_usd{category="cross_az",namespace="shop"} 2`,
+		`egressor_cost_usd{category="egress_internet",namespace="batch"} 3`,
+		`egressor_egress_bytes{namespace="shop"} 5100`,
+		`egressor_egress_bytes{namespace="batch"} 800`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("scrape is missing %s:\n%s", line, body)
+		}
+	}
+}
+
+func TestCostMetricsTopN(t *testing.T) {
+	m := newCostMetrics(2)
+	m.update([]types.CostAttribution{
+		attribution("a", 10, 0, 100),
+		attribution("b", 1, 0, 100),
+		attribution("c", 5, 0, 100),
+		attribution("d", 2, 0, 100),
+	})
+
+	if got := testutil.CollectAndCount(m.egressBytes); got != 3 {
+		t.Errorf("egress series = %d, want the top two plus %s", got, otherNamespaces)
+	}
+	egress := string(types.CostCategoryEgressInternet)
+	for ns, want := range map[string]float64{"a": 10, "c": 5, otherNamespaces: 3} {
+		if got := testutil.ToFloat64(m.costUSD.WithLabelValues(ns, egress)); got != want {
+			t.Errorf("%s cost = %v, want %v", ns, got, want)
+		}
+	}
+
+	// A refresh replaces series rather than adding to them
+	m.update([]types.CostAttribution{attribution("b", 1, 0, 100)})
+	if got := testutil.CollectAndCount(m.egressBytes); got != 1 {
+		t.Errorf("egress series after refresh = %d, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.costUSD.WithLabelValues("b", egress)); got != 1 {
+		t.Errorf("b cost after refresh = %v, want 1", got)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestDestinationSourcesTotalsBySource(t *testing.T) {
+	s := newMockServer()
+	results := []storage.DestinationSourceResult{
+		{SrcNamespace: "shop", SrcService: "api", SrcRegion: "us-east-1", TransferType: "egress", TotalBytes: 4 << 30, EventCount: 40},
+		{SrcNamespace: "batch", SrcService: "export", SrcRegion: "us-east-1", TransferType: "egress", TotalBytes: 3 << 30, EventCount: 3},
+		{SrcNamespace: "shop", SrcService: "api", SrcRegion: "eu-west-1", TransferType: "egress", TotalBytes: 2 << 30, EventCount: 20},
+		{SrcNamespace: "shop", SrcService: "worker", SrcRegion: "us-east-1", TransferType: "egress", TotalBytes: 1 << 30, EventCount: 5},
+	}
+
+	got := s.destinationSources(results, "uploads.example.com", "")
+	want := []DestinationSource{
+		{Namespace: "shop", Service: "api", TotalBytes: 6 << 30, EventCount: 60},
+		{Namespace: "batch", Service: "export", TotalBytes: 3 << 30, EventCount: 3},
+		{Namespace: "shop", Service: "worker", TotalBytes: 1 << 30, EventCount: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sources, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Namespace != w.Namespace || g.Service != w.Service || g.TotalBytes != w.TotalBytes || g.EventCount != w.EventCount {
+			t.Errorf("source %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	// Each source's cost is the sum of its rows priced on their own
+	var apiCost float64
+	for _, res := range []storage.DestinationSourceResult{results[0], results[2]} {
+		apiCost += s.costEngine.CalculateCost(types.TransferFlow{
+			Type:                types.TransferTypeEgress,
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api", Region: res.SrcRegion},
+			TotalBytes:          res.TotalBytes,
+			DestinationEndpoint: &types.Endpoint{Hostname: "uploads.example.com"},
+		}).CostUSD
+	}
+	if apiCost <= 0 || math.Abs(got[0].CostUSD-apiCost) > 1e-9 {
+		t.Errorf("api cost = %v, want %v", got[0].CostUSD, apiCost)
+	}
+	if got[1].CostUSD <= got[2].CostUSD {
+		t.Errorf("export cost %v not above worker cost %v for three times the bytes", got[1].CostUSD, got[2].CostUSD)
+	}
+}
+
+func TestDestinationSourcesValidation(t *testing.T) {
+	s := newMockServer()
+	s.cfg = Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}
+	for query, want := range map[string]int{
+		"":                     http.StatusBadRequest,
+		"ip=not-an-ip":         http.StatusBadRequest,
+		"host=api.example.com": http.StatusOK,
+		"ip=203.0.113.10":      http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		s.getDestinationSources(w, httptest.NewRequest(http.MethodGet, "/api/v1/flows/to-destination?"+query, nil))
+		if w.Code != want {
+			t.Errorf("%q: status = %d, want %d", query, w.Code, want)
+		}
+	}
+}
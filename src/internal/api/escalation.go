@@ -0,0 +1,25 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// anomalyReconcileInterval is the longest time between checks of active
+// anomalies for escalation.
+const anomalyReconcileInterval = time.Minute
+
+// runAnomalyReconcile escalates sustained anomalies until ctx is done.
+func (s *Server) runAnomalyReconcile(ctx context.Context) {
+	ticker := time.NewTicker(min(anomalyReconcileInterval, s.cfg.AnomalyEscalationInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.baseline.ReconcileAnomalies(now)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/egressor/egressor/src/internal/engine"
+)
+
+func TestExplainCostHandler(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine()}
+	body := `{"source_identity":{"namespace":"shop","name":"api","cloud_provider":"aws"},
+		"destination_endpoint":{"ip":"203.0.113.10","is_internet":true},
+		"type":"egress","total_bytes":2147483648}`
+
+	w := httptest.NewRecorder()
+	s.explainCost(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/explain", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var ex engine.CostExplanation
+	if err := json.NewDecoder(w.Body).Decode(&ex); err != nil {
+		t.Fatal(err)
+	}
+	if ex.RuleName != "AWS Internet Egress" {
+		t.Errorf("rule = %q, want AWS Internet Egress", ex.RuleName)
+	}
+	if ex.FreeTierGB != 1 || ex.InFreeTier {
+		t.Errorf("free tier %v, in free tier %v; want 1GB, false", ex.FreeTierGB, ex.InFreeTier)
+	}
+}
+
+func TestExplainCostHandlerRejectsBadBody(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine()}
+
+	w := httptest.NewRecorder()
+	s.explainCost(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/explain", strings.NewReader("{")))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// Limits on events returned by /flows/{flowKey}/events.
+const (
+	defaultFlowEventLimit = 1000
+	maxFlowEventLimit     = 100000
+)
+
+// flowEventFlushEvery is how many events are written between flushes.
+const flowEventFlushEvery = 100
+
+// getFlowEvents streams the raw events of one flow as newline-delimited
+// JSON, oldest first, for piping into jq. The flow key is a path segment,
+// so the "/" in service names must be escaped as %2F. Keys that cannot be
+// matched against raw events, such as graph edges to external nodes, are
+// rejected with 400.
+func (s *Server) getFlowEvents(w http.ResponseWriter, r *http.Request) {
+	flowKey, err := url.PathUnescape(chi.URLParam(r, "flowKey"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid flow key encoding")
+		return
+	}
+	if err := storage.ValidateFlowKey(flowKey); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := defaultFlowEventLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxFlowEventLimit {
+			s.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q: must be between 1 and %d", v, maxFlowEventLimit))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if s.storage == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Headers go out with the first event, so a query that fails before
+	// any event is read still gets an error status.
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	n := 0
+	err = s.storage.StreamFlowEvents(r.Context(), flowKey, start, end, limit, func(e types.TransferEvent) error {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		if n++; n%flowEventFlushEvery == 0 {
+			return rc.Flush()
+		}
+		return nil
+	})
+	switch {
+	case err != nil && n == 0:
+		s.queryError(w, r, err)
+		return
+	case err != nil:
+		// The status is already sent; the client sees a truncated stream.
+		log.Warn().Err(err).Str("flow", flowKey).Int("events", n).Msg("Flow event stream interrupted")
+	}
+	logQuery(r, start, end, n)
+}
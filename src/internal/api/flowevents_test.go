@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestFlowEventsValidation(t *testing.T) {
+	s := newMockServer()
+	s.cfg = Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}
+
+	tests := []struct {
+		flowKey string
+		query   string
+		want    int
+	}{
+		{"shop%2Fapi|203.0.113.10", "", http.StatusOK},
+		{"shop%2Fapi|shop%2Fdb", "?limit=10", http.StatusOK},
+		{"shop%2Fapi|203.0.113.10|egress", "", http.StatusOK},
+		{"shop%2Fapi", "", http.StatusBadRequest},
+		{"shop%2Fapi|external:api.stripe.com", "", http.StatusBadRequest},
+		{"shop%2Fapi|unknown", "", http.StatusBadRequest},
+		{"|203.0.113.10", "", http.StatusBadRequest},
+		{"shop%ZZapi|db", "", http.StatusBadRequest},
+		{"shop%2Fapi|203.0.113.10", "?limit=0", http.StatusBadRequest},
+		{"shop%2Fapi|203.0.113.10", "?limit=1000000", http.StatusBadRequest},
+		{"shop%2Fapi|203.0.113.10", "?range=48h", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("flowKey", tt.flowKey)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/flows/x/events"+tt.query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		s.getFlowEvents(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s%s: status = %d, want %d", tt.flowKey, tt.query, w.Code, tt.want)
+		}
+		if w.Code == http.StatusOK && w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("%s: content type %q, want NDJSON", tt.flowKey, w.Header().Get("Content-Type"))
+		}
+	}
+}
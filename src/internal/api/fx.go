@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// defaultFXRefreshInterval is used when Config leaves FXRefreshInterval unset.
+const defaultFXRefreshInterval = time.Hour
+
+// baseCurrency is the currency costs are priced in.
+const baseCurrency = "USD"
+
+// maxFXHistoryDays bounds the days of fetched rates kept for converting
+// past periods.
+const maxFXHistoryDays = 400
+
+// FXRates reports the exchange rates costs are converted with. Rates are
+// units of each currency per US dollar; overrides take precedence.
+type FXRates struct {
+	Base      string             `json:"base"`
+	Rates     map[string]float64 `json:"rates"`
+	Overrides map[string]float64 `json:"overrides,omitempty"`
+	Source    string             `json:"source,omitempty"`
+	UpdatedAt *time.Time         `json:"updated_at,omitempty"`
+}
+
+// CurrencyAmount is a cost converted from USD into another currency. Rate
+// is the rate applied for the cost's period, and AsOf when the newest rate
+// it was derived from was fetched or pinned.
+type CurrencyAmount struct {
+	Currency   string                         `json:"currency"`
+	Rate       float64                        `json:"rate"`
+	AsOf       *time.Time                     `json:"as_of,omitempty"`
+	Cost       float64                        `json:"cost"`
+	ByCategory map[types.CostCategory]float64 `json:"by_category,omitempty"`
+}
+
+// fxRates caches exchange rates fetched from a source, plus manual
+// overrides. Failed refreshes keep the last good rates. The last rates
+// fetched each UTC day are kept so past periods convert at their own rates.
+type fxRates struct {
+	source     string
+	rates      map[string]float64
+	overrides  map[string]float64
+	overrideAt map[string]time.Time
+	updatedAt  time.Time
+	history    []fxDay // Oldest first
+	mu         sync.RWMutex
+}
+
+// fxDay holds the last rates fetched on a UTC day.
+type fxDay struct {
+	day   time.Time
+	at    time.Time
+	rates map[string]float64
+}
+
+func newFXRates(source string, overrides map[string]float64) *fxRates {
+	f := &fxRates{
+		source:     source,
+		rates:      make(map[string]float64),
+		overrides:  make(map[string]float64, len(overrides)),
+		overrideAt: make(map[string]time.Time, len(overrides)),
+	}
+	now := time.Now()
+	for currency, rate := range overrides {
+		f.overrides[strings.ToUpper(currency)] = rate
+		f.overrideAt[strings.ToUpper(currency)] = now
+	}
+	return f
+}
+
+// setOverride pins a currency's rate. A zero rate removes the override.
+func (f *fxRates) setOverride(currency string, rate float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rate == 0 {
+		delete(f.overrides, currency)
+		delete(f.overrideAt, currency)
+		return
+	}
+	f.overrides[currency] = rate
+	f.overrideAt[currency] = time.Now()
+}
+
+// store replaces the fetched rates.
+func (f *fxRates) store(rates map[string]float64) {
+	f.storeAt(rates, time.Now())
+}
+
+// storeAt replaces the fetched rates with rates fetched at the given time,
+// recording them as that day's rates.
+func (f *fxRates) storeAt(rates map[string]float64, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rates = rates
+	f.updatedAt = at
+
+	day := at.UTC().Truncate(24 * time.Hour)
+	if n := len(f.history); n > 0 && f.history[n-1].day.Equal(day) {
+		f.history[n-1] = fxDay{day: day, at: at, rates: rates}
+		return
+	}
+	f.history = append(f.history, fxDay{day: day, at: at, rates: rates})
+	if len(f.history) > maxFXHistoryDays {
+		f.history = f.history[len(f.history)-maxFXHistoryDays:]
+	}
+}
+
+// rateFor returns the units of currency per US dollar for costs incurred in
+// [start, end), and when the newest rate it used was set. An override
+// applies to every period. Otherwise the rate is the average of the daily
+// rates in the period; a period with none uses the last rate before it, or
+// failing that the current rate.
+func (f *fxRates) rateFor(currency string, start, end time.Time) (float64, time.Time, bool) {
+	if currency == baseCurrency {
+		return 1, time.Time{}, true
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if rate, ok := f.overrides[currency]; ok {
+		return rate, f.overrideAt[currency], true
+	}
+
+	var (
+		sum, before    float64
+		n              int
+		asOf, beforeAt time.Time
+	)
+	for _, d := range f.history {
+		rate, ok := d.rates[currency]
+		if !ok {
+			continue
+		}
+		switch {
+		case d.day.Before(start.UTC().Truncate(24 * time.Hour)):
+			before, beforeAt = rate, d.at
+		case d.day.Before(end):
+			sum += rate
+			n++
+			asOf = d.at
+		}
+	}
+	if n > 0 {
+		return sum / float64(n), asOf, true
+	}
+	if before > 0 {
+		return before, beforeAt, true
+	}
+	rate, ok := f.rates[currency]
+	return rate, f.updatedAt, ok
+}
+
+// snapshot returns a copy of the current rates.
+func (f *fxRates) snapshot() FXRates {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	out := FXRates{
+		Base:   baseCurrency,
+		Rates:  make(map[string]float64, len(f.rates)),
+		Source: f.source,
+	}
+	for currency, rate := range f.rates {
+		out.Rates[currency] = rate
+	}
+	if len(f.overrides) > 0 {
+		out.Overrides = make(map[string]float64, len(f.overrides))
+		for currency, rate := range f.overrides {
+			out.Overrides[currency] = rate
+		}
+	}
+	if !f.updatedAt.IsZero() {
+		updatedAt := f.updatedAt
+		out.UpdatedAt = &updatedAt
+	}
+	return out
+}
+
+// convert expresses a USD cost incurred in [start, end) and its category
+// split in each currency, in the order requested.
+func (f *fxRates) convert(currencies []string, start, end time.Time, costUSD float64, byCategory map[types.CostCategory]float64) ([]CurrencyAmount, error) {
+	amounts := make([]CurrencyAmount, 0, len(currencies))
+	for _, currency := range currencies {
+		rate, asOf, ok := f.rateFor(currency, start, end)
+		if !ok {
+			return nil, fmt.Errorf("no exchange rate for %s", currency)
+		}
+		amount := CurrencyAmount{Currency: currency, Rate: rate, Cost: costUSD * rate}
+		if !asOf.IsZero() {
+			amount.AsOf = &asOf
+		}
+		if len(byCategory) > 0 {
+			amount.ByCategory = make(map[types.CostCategory]float64, len(byCategory))
+			for category, usd := range byCategory {
+				amount.ByCategory[category] = usd * rate
+			}
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts, nil
+}
+
+// parseCurrencies reads a comma-separated list of ISO 4217 codes, such as
+// "USD,EUR,GBP". Duplicates are dropped.
+func parseCurrencies(v string) ([]string, error) {
+	var currencies []string
+	seen := make(map[string]bool)
+	for _, code := range strings.Split(v, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		if !isCurrencyCode(code) {
+			return nil, fmt.Errorf("invalid currency %q", code)
+		}
+		seen[code] = true
+		currencies = append(currencies, code)
+	}
+	return currencies, nil
+}
+
+// isCurrencyCode reports whether code is three upper-case letters.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// runFXRefresh refreshes exchange rates from the configured source until
+// ctx is done.
+func (s *Server) runFXRefresh(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.FXRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.refreshFXRates(ctx); err != nil {
+			log.Warn().Err(err).Str("source", s.cfg.FXRateSource).Msg("Failed to refresh exchange rates")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshFXRates fetches rates from the source, which must return a JSON
+// object with USD-based "rates", e.g. {"base":"USD","rates":{"EUR":0.92}}.
+func (s *Server) refreshFXRates(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.FXRateSource, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decoding rates: %w", err)
+	}
+	if body.Base != "" && !strings.EqualFold(body.Base, baseCurrency) {
+		return fmt.Errorf("rates are based on %s, want %s", body.Base, baseCurrency)
+	}
+
+	rates := make(map[string]float64, len(body.Rates))
+	for currency, rate := range body.Rates {
+		currency = strings.ToUpper(currency)
+		if isCurrencyCode(currency) && rate > 0 {
+			rates[currency] = rate
+		}
+	}
+	s.fx.store(rates)
+	log.Debug().Int("currencies", len(rates)).Msg("Refreshed exchange rates")
+	return nil
+}
+
+func (s *Server) getFXRates(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.fx.snapshot())
+}
+
+// FXOverrideRequest pins the rate of one currency; a zero rate clears it.
+type FXOverrideRequest struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+func (s *Server) setFXOverride(w http.ResponseWriter, r *http.Request) {
+	var req FXOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	currency := strings.ToUpper(req.Currency)
+	if !isCurrencyCode(currency) || currency == baseCurrency {
+		s.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid currency %q", req.Currency))
+		return
+	}
+	if req.Rate < 0 {
+		s.errorResponse(w, http.StatusBadRequest, "rate must not be negative")
+		return
+	}
+
+	s.fx.setOverride(currency, req.Rate)
+	s.jsonResponse(w, http.StatusOK, s.fx.snapshot())
+}
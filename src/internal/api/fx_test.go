@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestParseCurrencies(t *testing.T) {
+	got, err := parseCurrencies("usd, EUR,gbp,EUR,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"USD", "EUR", "GBP"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	if _, err := parseCurrencies("EURO"); err == nil {
+		t.Error("want error for a code that is not three letters")
+	}
+}
+
+func TestCostSummaryInSeveralCurrencies(t *testing.T) {
+	s := &Server{
+		costEngine: engine.NewCostEngine(),
+		fx:         newFXRates("", map[string]float64{"EUR": 0.9}),
+	}
+	s.fx.store(map[string]float64{"EUR": 0.92, "GBP": 0.8})
+
+	w := httptest.NewRecorder()
+	s.getCostSummary(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/summary?currency=USD,EUR,GBP", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	var summary struct {
+		TotalCostUSD float64          `json:"total_cost_usd"`
+		Currencies   []CurrencyAmount `json:"currencies"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+
+	// EUR uses the override, not the fetched rate
+	wantRates := map[string]float64{"USD": 1, "EUR": 0.9, "GBP": 0.8}
+	if len(summary.Currencies) != len(wantRates) {
+		t.Fatalf("currencies = %+v, want USD, EUR and GBP", summary.Currencies)
+	}
+	for _, a := range summary.Currencies {
+		if a.Rate != wantRates[a.Currency] {
+			t.Errorf("%s rate = %v, want %v", a.Currency, a.Rate, wantRates[a.Currency])
+		}
+		if math.Abs(a.Cost-summary.TotalCostUSD*a.Rate) > 1e-9 {
+			t.Errorf("%s cost = %v, want %v", a.Currency, a.Cost, summary.TotalCostUSD*a.Rate)
+		}
+	}
+}
+
+func TestCostSummaryUnknownCurrency(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine(), fx: newFXRates("", nil)}
+
+	w := httptest.NewRecorder()
+	s.getCostSummary(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/summary?currency=JPY", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestConvertSplitsCategories(t *testing.T) {
+	fx := newFXRates("", map[string]float64{"eur": 0.5})
+	byCategory := map[types.CostCategory]float64{types.CostCategoryCrossAZ: 4, types.CostCategoryEgressInternet: 6}
+
+	now := time.Now()
+	amounts, err := fx.convert([]string{"EUR"}, now, now, 10, byCategory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amounts[0].Cost != 5 || amounts[0].ByCategory[types.CostCategoryCrossAZ] != 2 ||
+		amounts[0].ByCategory[types.CostCategoryEgressInternet] != 3 {
+		t.Errorf("got %+v, want 5 split 2/3", amounts[0])
+	}
+}
+
+func TestConvertUsesRatesOfThePeriod(t *testing.T) {
+	fx := newFXRates("", nil)
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	fx.storeAt(map[string]float64{"EUR": 0.80}, march.Add(-time.Hour))
+	fx.storeAt(map[string]float64{"EUR": 0.90}, march.Add(time.Hour))
+	fx.storeAt(map[string]float64{"EUR": 0.95}, march.Add(2*time.Hour)) // Replaces the same day
+	last := march.AddDate(0, 0, 1).Add(time.Hour)
+	fx.storeAt(map[string]float64{"EUR": 0.85}, last)
+	fx.storeAt(map[string]float64{"EUR": 1.20}, march.AddDate(0, 1, 0))
+
+	amounts, err := fx.convert([]string{"EUR"}, march, march.AddDate(0, 1, 0), 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := amounts[0]
+	if math.Abs(got.Rate-0.9) > 1e-9 || math.Abs(got.Cost-90) > 1e-9 {
+		t.Errorf("rate = %v, cost = %v; want March's average 0.9 and 90", got.Rate, got.Cost)
+	}
+	if got.AsOf == nil || !got.AsOf.Equal(last) {
+		t.Errorf("as_of = %v, want the newest March rate at %v", got.AsOf, last)
+	}
+
+	// A period with no rates of its own uses the last one before it
+	amounts, err = fx.convert([]string{"EUR"}, march.AddDate(0, 0, 10), march.AddDate(0, 0, 11), 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amounts[0].Rate != 0.85 {
+		t.Errorf("rate = %v, want the preceding 0.85", amounts[0].Rate)
+	}
+}
+
+func TestMonthToDateCostReportsRateAsOf(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine(), fx: newFXRates("", nil)}
+	s.fx.store(map[string]float64{"EUR": 0.92})
+
+	w := httptest.NewRecorder()
+	s.getMonthToDateCost(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/mtd?currency=EUR", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var mtd MonthToDateCostInCurrencies
+	if err := json.NewDecoder(w.Body).Decode(&mtd); err != nil {
+		t.Fatal(err)
+	}
+	if len(mtd.Currencies) != 1 || mtd.Currencies[0].Rate != 0.92 || mtd.Currencies[0].AsOf == nil {
+		t.Errorf("currencies = %+v, want EUR at 0.92 with its as_of", mtd.Currencies)
+	}
+}
+
+func TestRefreshFXRates(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"base":"USD","rates":{"eur":0.92,"GBP":0.8,"BAD":-1}}`))
+	}))
+	defer source.Close()
+
+	s := &Server{
+		cfg:        Config{FXRateSource: source.URL},
+		httpClient: source.Client(),
+		fx:         newFXRates(source.URL, nil),
+	}
+	if err := s.refreshFXRates(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := s.fx.snapshot()
+	if snap.Rates["EUR"] != 0.92 || snap.Rates["GBP"] != 0.8 || len(snap.Rates) != 2 {
+		t.Errorf("rates = %v, want EUR and GBP only", snap.Rates)
+	}
+	if snap.UpdatedAt == nil {
+		t.Error("UpdatedAt not set")
+	}
+}
+
+func TestRefreshFXRatesKeepsRatesOnFailure(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer source.Close()
+
+	s := &Server{
+		cfg:        Config{FXRateSource: source.URL},
+		httpClient: source.Client(),
+		fx:         newFXRates(source.URL, nil),
+	}
+	s.fx.store(map[string]float64{"EUR": 0.92})
+	if err := s.refreshFXRates(context.Background()); err == nil {
+		t.Fatal("want error for a failing source")
+	}
+	if rate, _, _ := s.fx.rateFor("EUR", time.Now(), time.Now()); rate != 0.92 {
+		t.Errorf("EUR rate = %v, want the last good 0.92", rate)
+	}
+}
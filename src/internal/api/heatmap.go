@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// CostHeatmap is a service by cost category matrix of USD values.
+// Values[i][j] is the cost of Rows[i] in Columns[j]; rows are ordered by
+// total cost, largest first, and columns by category name.
+type CostHeatmap struct {
+	PeriodStart  time.Time            `json:"period_start"`
+	PeriodEnd    time.Time            `json:"period_end"`
+	Rows         []string             `json:"rows"`
+	Columns      []types.CostCategory `json:"columns"`
+	Values       [][]float64          `json:"values"`
+	RowTotals    []float64            `json:"row_totals"`
+	ColumnTotals []float64            `json:"column_totals"`
+	TotalCostUSD float64              `json:"total_cost_usd"`
+	// RawSampleRate is the lowest raw retention rate among the flows
+	// priced. Below 1, costs leave out flows not retained raw.
+	RawSampleRate float64 `json:"raw_sample_rate,omitempty"`
+}
+
+// buildCostHeatmap reshapes attributions into a heatmap keyed by
+// "namespace/service".
+func buildCostHeatmap(attributions []types.CostAttribution, start, end time.Time) CostHeatmap {
+	cells := make(map[string]map[types.CostCategory]float64)
+	rowTotals := make(map[string]float64)
+	columnSet := make(map[types.CostCategory]bool)
+	var coverage float64
+	for _, a := range attributions {
+		row := a.Namespace + "/" + a.ServiceName
+		if a.RawSampleRate > 0 {
+			coverage = types.LowerRawSampleRate(coverage, a.RawSampleRate)
+		}
+		if cells[row] == nil {
+			cells[row] = make(map[types.CostCategory]float64)
+		}
+		for _, b := range a.Breakdown {
+			cells[row][b.Category] += b.CostUSD
+			rowTotals[row] += b.CostUSD
+			columnSet[b.Category] = true
+		}
+	}
+
+	heatmap := CostHeatmap{
+		PeriodStart:   start,
+		PeriodEnd:     end,
+		Rows:          make([]string, 0, len(cells)),
+		Columns:       make([]types.CostCategory, 0, len(columnSet)),
+		RawSampleRate: coverage,
+	}
+	for row := range cells {
+		heatmap.Rows = append(heatmap.Rows, row)
+	}
+	sort.Slice(heatmap.Rows, func(i, j int) bool {
+		ri, rj := heatmap.Rows[i], heatmap.Rows[j]
+		if rowTotals[ri] != rowTotals[rj] {
+			return rowTotals[ri] > rowTotals[rj]
+		}
+		return ri < rj
+	})
+	for category := range columnSet {
+		heatmap.Columns = append(heatmap.Columns, category)
+	}
+	sort.Slice(heatmap.Columns, func(i, j int) bool {
+		return heatmap.Columns[i] < heatmap.Columns[j]
+	})
+
+	heatmap.Values = make([][]float64, len(heatmap.Rows))
+	heatmap.RowTotals = make([]float64, len(heatmap.Rows))
+	heatmap.ColumnTotals = make([]float64, len(heatmap.Columns))
+	for i, row := range heatmap.Rows {
+		heatmap.Values[i] = make([]float64, len(heatmap.Columns))
+		for j, category := range heatmap.Columns {
+			v := cells[row][category]
+			heatmap.Values[i][j] = v
+			heatmap.RowTotals[i] += v
+			heatmap.ColumnTotals[j] += v
+			heatmap.TotalCostUSD += v
+		}
+	}
+	return heatmap
+}
+
+// getCostHeatmap returns attributed cost as a service by category matrix.
+func (s *Server) getCostHeatmap(w http.ResponseWriter, r *http.Request) {
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, buildCostHeatmap(nil, start, end))
+		return
+	}
+
+	attributions, err := s.streamAttribution(r, start, end, "")
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, buildCostHeatmap(attributions, start, end))
+}
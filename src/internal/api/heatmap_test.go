@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestCostHeatmapReconcilesWithSummary(t *testing.T) {
+	costs := engine.NewCostEngine()
+	end := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-time.Hour)
+	flow := func(ns, name string, transferType types.TransferType, bytes uint64) types.TransferFlow {
+		f := types.TransferFlow{
+			SourceIdentity: types.ServiceIdentity{Namespace: ns, Name: name, CloudProvider: "aws", Region: "us-east-1", AvailabilityZone: "us-east-1a"},
+			Type:           transferType,
+			TotalBytes:     bytes,
+			WindowStart:    start,
+			WindowEnd:      end,
+		}
+		switch transferType {
+		case types.TransferTypeEgress:
+			f.DestinationEndpoint = &types.Endpoint{IP: "203.0.113.10", IsInternet: true}
+		case types.TransferTypeCrossAZ:
+			f.DestinationIdentity = &types.ServiceIdentity{Namespace: ns, Name: "db", CloudProvider: "aws", Region: "us-east-1", AvailabilityZone: "us-east-1b"}
+		case types.TransferTypeCrossRegion:
+			f.DestinationIdentity = &types.ServiceIdentity{Namespace: ns, Name: "replica", CloudProvider: "aws", Region: "eu-west-1"}
+		}
+		return f
+	}
+	flows := []types.TransferFlow{
+		flow("shop", "api", types.TransferTypeEgress, 40<<30),
+		flow("shop", "api", types.TransferTypeCrossAZ, 10<<30),
+		flow("shop", "worker", types.TransferTypeCrossRegion, 20<<30),
+		flow("batch", "export", types.TransferTypeEgress, 5<<30),
+	}
+	attributions := costs.CalculateAttribution(context.Background(), flows, start, end)
+	summary := costs.GetCostSummary(attributions)
+
+	heatmap := buildCostHeatmap(attributions, start, end)
+
+	if len(heatmap.Rows) != len(summary.ByService) || len(heatmap.Columns) != len(summary.ByCategory) {
+		t.Fatalf("heatmap is %dx%d, want %dx%d", len(heatmap.Rows), len(heatmap.Columns), len(summary.ByService), len(summary.ByCategory))
+	}
+	for i, row := range heatmap.Rows {
+		if math.Abs(heatmap.RowTotals[i]-summary.ByService[row]) > 1e-9 {
+			t.Errorf("row %s totals %v, summary has %v", row, heatmap.RowTotals[i], summary.ByService[row])
+		}
+		var sum float64
+		for _, v := range heatmap.Values[i] {
+			sum += v
+		}
+		if math.Abs(sum-heatmap.RowTotals[i]) > 1e-9 {
+			t.Errorf("row %s cells sum to %v, total says %v", row, sum, heatmap.RowTotals[i])
+		}
+		if i > 0 && heatmap.RowTotals[i] > heatmap.RowTotals[i-1] {
+			t.Errorf("row %s is out of cost order", row)
+		}
+	}
+	for j, category := range heatmap.Columns {
+		if math.Abs(heatmap.ColumnTotals[j]-summary.ByCategory[category]) > 1e-9 {
+			t.Errorf("column %s totals %v, summary has %v", category, heatmap.ColumnTotals[j], summary.ByCategory[category])
+		}
+		if j > 0 && heatmap.Columns[j] < heatmap.Columns[j-1] {
+			t.Errorf("column %s is out of name order", category)
+		}
+	}
+	if summary.TotalCostUSD <= 0 || math.Abs(heatmap.TotalCostUSD-summary.TotalCostUSD) > 1e-9 {
+		t.Errorf("heatmap total %v, summary total %v", heatmap.TotalCostUSD, summary.TotalCostUSD)
+	}
+
+	empty := buildCostHeatmap(nil, start, end)
+	if empty.Rows == nil || empty.Columns == nil || len(empty.Values) != 0 {
+		t.Errorf("empty heatmap = %+v, want empty non-nil rows and columns", empty)
+	}
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// defaultIdempotencyTTL is used when Config leaves IdempotencyTTL unset.
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyKeyHeader carries the client-chosen key of a mutating request.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the keys held in memory.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodyBytes bounds the request bodies read to fingerprint a
+// request carrying an Idempotency-Key.
+const maxIdempotentBodyBytes = 1 << 20
+
+// maxIdempotencyEntries caps the responses held; the least recently used
+// completed response is dropped first.
+const maxIdempotencyEntries = 10000
+
+// idempotencySweepInterval is how often expired responses are dropped.
+const idempotencySweepInterval = time.Minute
+
+// idempotentResponse is a cached response, or a placeholder while the first
+// request with its key is still running.
+type idempotentResponse struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// idempotencyCache remembers responses to mutating requests by
+// Idempotency-Key so retries return the original response instead of
+// applying the change again.
+type idempotencyCache struct {
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List // Of *idempotentResponse, most recently used first
+	mu         sync.Mutex
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:        ttl,
+		maxEntries: maxIdempotencyEntries,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// begin claims key for a request. It returns the cached entry when the key
+// was already used, or nil when the caller should run the request.
+func (c *idempotencyCache) begin(key string, fingerprint [sha256.Size]byte) *idempotentResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*idempotentResponse)
+		if !e.done || time.Now().Before(e.expiresAt) {
+			c.recent.MoveToFront(el)
+			copied := *e
+			return &copied
+		}
+		c.remove(el)
+	}
+
+	c.entries[key] = c.recent.PushFront(&idempotentResponse{key: key, fingerprint: fingerprint})
+	c.evict()
+	return nil
+}
+
+// evict drops the least recently used completed responses while the cache
+// is over its cap. Requests still running keep their keys.
+func (c *idempotencyCache) evict() {
+	for el := c.recent.Back(); el != nil && len(c.entries) > c.maxEntries; {
+		prev := el.Prev()
+		if el.Value.(*idempotentResponse).done {
+			c.remove(el)
+		}
+		el = prev
+	}
+}
+
+// remove drops an entry. The caller holds c.mu.
+func (c *idempotencyCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*idempotentResponse).key)
+	c.recent.Remove(el)
+}
+
+// finish stores the response for key. Server errors and requests the
+// client abandoned release the key so the request can be retried.
+func (c *idempotencyCache) finish(key string, status int, contentType string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	if status >= http.StatusInternalServerError || status == statusClientClosedRequest {
+		c.remove(el)
+		return
+	}
+	e := el.Value.(*idempotentResponse)
+	e.done = true
+	e.status = status
+	e.contentType = contentType
+	e.body = body
+	e.expiresAt = time.Now().Add(c.ttl)
+}
+
+// sweep drops completed responses that expired before now.
+func (c *idempotencyCache) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.recent.Back(); el != nil; {
+		prev := el.Prev()
+		if e := el.Value.(*idempotentResponse); e.done && now.After(e.expiresAt) {
+			c.remove(el)
+		}
+		el = prev
+	}
+}
+
+// len returns the number of keys held.
+func (c *idempotencyCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// runIdempotencySweep drops expired idempotent responses until ctx is done.
+func (s *Server) runIdempotencySweep(ctx context.Context) {
+	ticker := time.NewTicker(idempotencySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.idempotent.sweep(now)
+		}
+	}
+}
+
+// idempotency replays the original response to POST, PUT and DELETE
+// requests that repeat an Idempotency-Key. Keys are scoped to the method
+// and path; reusing one with a different body is rejected.
+func (s *Server) idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		switch {
+		case key == "":
+			next.ServeHTTP(w, r)
+			return
+		case r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete:
+			next.ServeHTTP(w, r)
+			return
+		case len(key) > maxIdempotencyKeyLength:
+			s.errorResponse(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				s.errorResponse(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("request body exceeds %d bytes", maxIdempotentBodyBytes))
+				return
+			}
+			s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(body)
+
+		cacheKey := r.Method + " " + r.URL.Path + " " + key
+		if cached := s.idempotent.begin(cacheKey, fingerprint); cached != nil {
+			switch {
+			case cached.fingerprint != fingerprint:
+				s.errorResponse(w, http.StatusUnprocessableEntity, "Idempotency-Key was used with a different request body")
+			case !cached.done:
+				s.errorResponse(w, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+			default:
+				if cached.contentType != "" {
+					w.Header().Set("Content-Type", cached.contentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(cached.status)
+				w.Write(cached.body)
+			}
+			return
+		}
+
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&buf)
+		status := http.StatusInternalServerError
+		defer func() {
+			if ww.Status() != 0 {
+				status = ww.Status()
+			}
+			s.idempotent.finish(cacheKey, status, ww.Header().Get("Content-Type"), buf.Bytes())
+		}()
+
+		next.ServeHTTP(ww, r)
+		status = http.StatusOK
+	})
+}
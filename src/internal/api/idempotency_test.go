@@ -0,0 +1,193 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/egressor/egressor/src/internal/engine"
+)
+
+// idempotentRequest sends method path body through h with an
+// Idempotency-Key.
+func idempotentRequest(h http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// countingHandler counts calls and answers with the statuses in turn,
+// then 200.
+func countingHandler(calls *atomic.Int32, statuses ...int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := http.StatusOK
+		if n <= len(statuses) {
+			status = statuses[n-1]
+		}
+		w.WriteHeader(status)
+	})
+}
+
+func TestRepeatedIdempotencyKeyNotReapplied(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine(), idempotent: newIdempotencyCache(time.Hour)}
+	r := chi.NewRouter()
+	r.Use(s.idempotency)
+	r.Mount("/", pricingRouter(s))
+	builtIn := len(listPricingRules(t, r))
+
+	body := `{"name":"Negotiated egress","cloud_provider":"aws","category":"egress_internet","cost_per_gb":0.05}`
+	first := idempotentRequest(r, http.MethodPost, "/api/v1/costs/pricing-rules", "create-1", body)
+	retry := idempotentRequest(r, http.MethodPost, "/api/v1/costs/pricing-rules", "create-1", body)
+
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+		t.Fatalf("statuses %d and %d, want 201 for both", first.Code, retry.Code)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry body %s, want the replayed %s", retry.Body, first.Body)
+	}
+	if got := len(listPricingRules(t, r)); got != builtIn+1 {
+		t.Errorf("%d rules after a retry, want one added", got-builtIn)
+	}
+
+	// A new key is a new request
+	idempotentRequest(r, http.MethodPost, "/api/v1/costs/pricing-rules", "create-2", body)
+	if got := len(listPricingRules(t, r)); got != builtIn+2 {
+		t.Errorf("%d rules after a second key, want two added", got-builtIn)
+	}
+}
+
+func TestIdempotencyKeyScope(t *testing.T) {
+	s := &Server{idempotent: newIdempotencyCache(time.Hour)}
+	var calls atomic.Int32
+	h := s.idempotency(countingHandler(&calls))
+
+	idempotentRequest(h, http.MethodPost, "/a", "k", "{}")
+	idempotentRequest(h, http.MethodPost, "/b", "k", "{}") // Another path
+	idempotentRequest(h, http.MethodPut, "/a", "k", "{}")  // Another method
+	idempotentRequest(h, http.MethodGet, "/a", "k", "")    // Not mutating
+	idempotentRequest(h, http.MethodGet, "/a", "k", "")    // Not mutating
+	idempotentRequest(h, http.MethodPost, "/a", "", "{}")  // No key
+	idempotentRequest(h, http.MethodPost, "/a", "k", "{}") // Replayed
+	if got := calls.Load(); got != 6 {
+		t.Errorf("handler ran %d times, want 6", got)
+	}
+
+	if w := idempotentRequest(h, http.MethodPost, "/a", "k", `{"other":1}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d for a reused key with another body, want 422", w.Code)
+	}
+	if w := idempotentRequest(h, http.MethodPost, "/a", strings.Repeat("k", maxIdempotencyKeyLength+1), "{}"); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for an oversized key, want 400", w.Code)
+	}
+}
+
+func TestIdempotencyServerErrorReleasesKey(t *testing.T) {
+	s := &Server{idempotent: newIdempotencyCache(time.Hour)}
+	var calls atomic.Int32
+	h := s.idempotency(countingHandler(&calls, http.StatusServiceUnavailable, http.StatusBadRequest))
+
+	if w := idempotentRequest(h, http.MethodPost, "/a", "k", "{}"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	// The failed attempt is retried; the client error that follows is kept
+	for i := 0; i < 2; i++ {
+		if w := idempotentRequest(h, http.MethodPost, "/a", "k", "{}"); w.Code != http.StatusBadRequest {
+			t.Errorf("attempt %d: status = %d, want 400", i+2, w.Code)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("handler ran %d times, want a rerun after the server error only", got)
+	}
+}
+
+func TestIdempotencyConcurrentRequestConflicts(t *testing.T) {
+	s := &Server{idempotent: newIdempotencyCache(time.Hour)}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := s.idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan int)
+	go func() { done <- idempotentRequest(h, http.MethodPost, "/a", "k", "{}").Code }()
+	<-started
+	if w := idempotentRequest(h, http.MethodPost, "/a", "k", "{}"); w.Code != http.StatusConflict {
+		t.Errorf("status = %d while the first request runs, want 409", w.Code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first request status = %d", code)
+	}
+}
+
+func TestIdempotencyEntriesExpire(t *testing.T) {
+	s := &Server{idempotent: newIdempotencyCache(time.Millisecond)}
+	var calls atomic.Int32
+	h := s.idempotency(countingHandler(&calls))
+
+	idempotentRequest(h, http.MethodPost, "/a", "k", "{}")
+	time.Sleep(5 * time.Millisecond)
+	idempotentRequest(h, http.MethodPost, "/a", "k", "{}")
+	if got := calls.Load(); got != 2 {
+		t.Errorf("handler ran %d times, want the key forgotten after its TTL", got)
+	}
+}
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+	s := &Server{idempotent: newIdempotencyCache(time.Hour)}
+	var calls atomic.Int32
+	h := s.idempotency(countingHandler(&calls))
+
+	w := idempotentRequest(h, http.MethodPost, "/a", "k", strings.Repeat("x", maxIdempotentBodyBytes+1))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+	if calls.Load() != 0 || s.idempotent.len() != 0 {
+		t.Errorf("handler ran %d times and %d keys held, want neither", calls.Load(), s.idempotent.len())
+	}
+}
+
+func TestIdempotencyCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newIdempotencyCache(time.Hour)
+	c.maxEntries = 2
+	var fp [32]byte
+
+	c.begin("running", fp) // Never finishes, so is never evicted
+	c.begin("a", fp)
+	c.finish("a", http.StatusOK, "", nil)
+	c.begin("b", fp)
+	c.finish("b", http.StatusOK, "", nil)
+	if c.len() != 2 {
+		t.Fatalf("holding %d keys, want the cap of 2", c.len())
+	}
+	for _, key := range []string{"running", "b"} {
+		if c.begin(key, fp) == nil {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if c.begin("a", fp) != nil {
+		t.Error("a, the least recently used response, was kept")
+	}
+}
+
+func TestIdempotencySweepDropsExpired(t *testing.T) {
+	c := newIdempotencyCache(time.Minute)
+	var fp [32]byte
+	c.begin("done", fp)
+	c.finish("done", http.StatusOK, "", nil)
+	c.begin("running", fp)
+
+	c.sweep(time.Now().Add(2 * time.Minute))
+	if c.len() != 1 || c.begin("running", fp) == nil {
+		t.Errorf("holding %d keys, want only the running request", c.len())
+	}
+}
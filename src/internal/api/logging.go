@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// queryLogKey is the context key for per-request query details.
+type queryLogKey struct{}
+
+// queryLog holds query details that handlers attach for request logging.
+type queryLog struct {
+	start   time.Time
+	end     time.Time
+	results int
+	set     bool
+}
+
+// logQuery records the resolved time range and result count of a query
+// endpoint so the request log line includes them.
+func logQuery(r *http.Request, start, end time.Time, results int) {
+	if q, ok := r.Context().Value(queryLogKey{}).(*queryLog); ok {
+		q.start, q.end, q.results, q.set = start, end, results, true
+	}
+}
+
+// requestLogger is a zerolog request logging middleware. It logs method,
+// path, status, latency, and request ID, plus the query range and result
+// count when the handler called logQuery.
+func requestLogger(logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			q := &queryLog{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), queryLogKey{}, q)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			event := logger.Info()
+			if status >= http.StatusInternalServerError {
+				event = logger.Error()
+			}
+			event = event.
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Dur("latency", time.Since(start)).
+				Str("request_id", middleware.GetReqID(r.Context()))
+			if q.set {
+				event = event.
+					Time("range_start", q.start).
+					Time("range_end", q.end).
+					Int("results", q.results)
+			}
+			event.Msg("HTTP request")
+		})
+	}
+}
+
+// defaultRequestLogger returns the request logging middleware configured
+// for the server.
+func (s *Server) defaultRequestLogger() func(http.Handler) http.Handler {
+	if !s.cfg.StructuredRequestLogs {
+		return middleware.Logger
+	}
+	return requestLogger(log.Logger)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRequestLoggerFlowsFields(t *testing.T) {
+	s := &Server{cfg: Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}}
+	var buf bytes.Buffer
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(requestLogger(zerolog.New(&buf)))
+	r.Get("/api/v1/flows", s.getFlows)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/flows?start=2026-03-01T10:00:00Z&end=2026-03-01T12:00:00Z", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log output %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":       "info",
+		"method":      "GET",
+		"path":        "/api/v1/flows",
+		"status":      float64(200),
+		"request_id":  "req-42",
+		"range_start": "2026-03-01T10:00:00Z",
+		"range_end":   "2026-03-01T12:00:00Z",
+		"results":     float64(0),
+	}
+	for field, value := range want {
+		if line[field] != value {
+			t.Errorf("%s = %v, want %v", field, line[field], value)
+		}
+	}
+	if _, ok := line["latency"]; !ok {
+		t.Error("latency missing")
+	}
+}
+
+func TestRequestLoggerWithoutQuery(t *testing.T) {
+	var buf bytes.Buffer
+	handler := requestLogger(zerolog.New(&buf))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/graph", nil))
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["level"] != "error" || line["status"] != float64(500) {
+		t.Errorf("level %v status %v, want a server error logged as error", line["level"], line["status"])
+	}
+	if _, ok := line["range_start"]; ok {
+		t.Error("range logged for a request without a query")
+	}
+}
+
+func TestStructuredRequestLogsToggle(t *testing.T) {
+	plain := (&Server{}).defaultRequestLogger()
+	if reflect.ValueOf(plain).Pointer() != reflect.ValueOf(middleware.Logger).Pointer() {
+		t.Error("structured logging used while disabled")
+	}
+
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = saved }()
+
+	structured := (&Server{cfg: Config{StructuredRequestLogs: true}}).defaultRequestLogger()
+	structured(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if !bytes.Contains(buf.Bytes(), []byte(`"path":"/missing"`)) {
+		t.Errorf("structured log = %q, want the request path", buf.String())
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// storedFlow returns a flow as loaded from storage: egress from shop/api to
+// an external host in the hour before now.
+func storedFlow(hostname string, bytes uint64) types.TransferFlow {
+	end := time.Now()
+	r := storage.FlowResult{
+		SrcNamespace: "shop",
+		SrcService:   "api",
+		DstExternal:  "203.0.113.10",
+		DstHostname:  hostname,
+		TransferType: string(types.TransferTypeEgress),
+		TotalBytes:   bytes,
+		EventCount:   1,
+	}
+	return r.ToFlow(end.Add(-time.Hour), end)
+}
+
+// activeAnomaliesOfType returns the server's active anomalies of a type.
+func activeAnomaliesOfType(s *Server, kind types.AnomalyType) []*types.Anomaly {
+	var out []*types.Anomaly
+	for _, a := range s.baseline.GetActiveAnomalies() {
+		if a.Type == kind {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func TestLoadedFlowsCheckEndpointCaps(t *testing.T) {
+	s := newMockServer()
+	if _, err := s.costEngine.SetEndpointCap(types.EndpointCap{Hostname: "api.stripe.com", MonthlyBytes: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.observeFlow(storedFlow("api.stripe.com", 600))
+	s.observeFlow(storedFlow("api.stripe.com", 600))
+
+	anomalies := activeAnomaliesOfType(s, types.AnomalyTypeCostAnomaly)
+	if len(anomalies) != 1 || anomalies[0].DestinationEndpoint != "api.stripe.com" {
+		t.Errorf("anomalies = %+v, want one cap anomaly for api.stripe.com", anomalies)
+	}
+}
+
+func TestLoadedFlowsCheckWatchlist(t *testing.T) {
+	s := newMockServer()
+	if _, err := s.costEngine.AddWatchlistEntry(types.WatchlistEntry{Destination: "api.openai.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The watch began after this stored flow; it only teaches the consumer
+	earlier := storedFlow("api.openai.com", 100)
+	earlier.WindowEnd = time.Now().Add(-time.Hour)
+	s.observeFlow(earlier)
+	if n := len(activeAnomaliesOfType(s, types.AnomalyTypeNewEndpoint)); n != 0 {
+		t.Errorf("%d alerts for a consumer from before the watch", n)
+	}
+
+	flow := storedFlow("api.openai.com", 100)
+	flow.SourceIdentity.Name = "search"
+	flow.WindowEnd = time.Now().Add(time.Minute)
+	s.observeFlow(flow)
+	anomalies := activeAnomaliesOfType(s, types.AnomalyTypeNewEndpoint)
+	if len(anomalies) != 1 || anomalies[0].SourceService != "shop/search" {
+		t.Errorf("anomalies = %+v, want shop/search reported", anomalies)
+	}
+	if got := testutil.ToFloat64(s.watchlistAlerts.WithLabelValues("api.openai.com")); got != 1 {
+		t.Errorf("watchlist alerts = %v, want 1", got)
+	}
+}
+
+func TestLoadedFlowsCountTowardMonthToDate(t *testing.T) {
+	s := newMockServer()
+	s.observeFlow(storedFlow("api.stripe.com", 10<<30))
+
+	mtd := s.costEngine.GetMonthToDateCost()
+	if mtd.TotalBytes != 10<<30 || mtd.CostUSD <= 0 {
+		t.Errorf("month to date = %+v, want the loaded flow's 10 GiB priced", mtd)
+	}
+}
+
+func TestMonthBeforeLookback(t *testing.T) {
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+
+	start, end, ok := monthBeforeLookback(now, 24*time.Hour)
+	if !ok || !start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("got [%v, %v) %v, want March 1 up to the lookback", start, end, ok)
+	}
+	if _, _, ok := monthBeforeLookback(now, 30*24*time.Hour); ok {
+		t.Error("a lookback past the month start left a gap to load")
+	}
+}
+
+func TestLoadedFlowsClassifySuspiciousDestinations(t *testing.T) {
+	s := newMockServer()
+	s.baseline.SetSuspiciousPatterns([]engine.SuspiciousPattern{
+		{Pattern: "*.duckdns.org", Severity: types.SeverityMedium},
+		{Pattern: engine.SuspiciousIPPattern, Severity: types.SeverityInfo},
+	})
+
+	s.observeFlow(storedFlow("exfil.duckdns.org", 100))
+	s.observeFlow(storedFlow("", 100))
+	s.observeFlow(storedFlow("api.stripe.com", 100))
+
+	patterns := make(map[string]string)
+	for _, a := range activeAnomaliesOfType(s, types.AnomalyTypeNewEndpoint) {
+		patterns[a.DestinationEndpoint] = a.Labels[engine.SuspiciousLabel]
+	}
+	want := map[string]string{"exfil.duckdns.org": "*.duckdns.org", "203.0.113.10": engine.SuspiciousIPPattern}
+	if len(patterns) != len(want) {
+		t.Fatalf("flagged %v, want %v", patterns, want)
+	}
+	for dest, pattern := range want {
+		if patterns[dest] != pattern {
+			t.Errorf("%s flagged by %q, want %q", dest, patterns[dest], pattern)
+		}
+	}
+}
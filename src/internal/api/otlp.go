@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/internal/engine"
+)
+
+// defaultOTLPInterval is used when Config leaves OTLPInterval unset.
+const defaultOTLPInterval = time.Minute
+
+// Service-graph metric names. The request counter follows the naming of
+// the OTel service-graph connector so existing dashboards pick it up.
+const (
+	otlpRequestMetric = "traces_service_graph_request_total"
+	otlpBytesMetric   = "egressor_service_graph_bytes_total"
+)
+
+// otlpTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const otlpTemporalityCumulative = 2
+
+// OTLP/HTTP JSON encoding of ExportMetricsServiceRequest, limited to the
+// monotonic sums the service graph needs. 64-bit integers are strings, as
+// the protobuf JSON mapping requires.
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Unit        string  `json:"unit,omitempty"`
+	Sum         otlpSum `json:"sum"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
+
+func otlpNanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpSeries tracks when the exported cumulative totals started. The graph
+// restarts its totals from zero on Reset, e.g. when its granularity
+// changes, while edges rebuilt afterwards keep the first sighting of their
+// flows. A reset seen between exports therefore starts every series anew
+// at the export that notices it, so consumers see a restart rather than
+// counters going backwards. Only the export loop uses it.
+type otlpSeries struct {
+	seen         bool
+	resetVersion uint64
+	start        time.Time
+}
+
+// since returns the earliest start time a point of graph exported at now
+// may claim.
+func (o *otlpSeries) since(graph engine.GraphJSON, now time.Time) time.Time {
+	if o.seen && graph.ResetVersion != o.resetVersion {
+		o.start = now
+	}
+	o.seen, o.resetVersion = true, graph.ResetVersion
+	return o.start
+}
+
+// serviceGraphMetrics maps each graph edge to a request count and a byte
+// count between its client and server, cumulative since the edge was
+// first seen, or since when it is later.
+func serviceGraphMetrics(graph engine.GraphJSON, since, now time.Time) otlpMetricsRequest {
+	requests := make([]otlpDataPoint, 0, len(graph.Edges))
+	bytesSent := make([]otlpDataPoint, 0, len(graph.Edges))
+	for _, edge := range graph.Edges {
+		attrs := []otlpAttribute{
+			otlpString("client", edge.Source),
+			otlpString("server", edge.Target),
+			otlpString("transfer_type", edge.TransferType),
+		}
+		start := edge.FirstSeen
+		if start.Before(since) {
+			start = since
+		}
+		if start.IsZero() || start.After(now) {
+			start = now
+		}
+		point := otlpDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: otlpNanos(start),
+			TimeUnixNano:      otlpNanos(now),
+		}
+
+		point.AsInt = strconv.FormatUint(edge.TotalEvents, 10)
+		requests = append(requests, point)
+		point.AsInt = strconv.FormatUint(edge.TotalBytes, 10)
+		bytesSent = append(bytesSent, point)
+	}
+
+	return otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{otlpString("service.name", "egressor")}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope: otlpScope{Name: "github.com/egressor/egressor"},
+			Metrics: []otlpMetric{
+				{
+					Name:        otlpRequestMetric,
+					Description: "Transfer events between client and server services",
+					Unit:        "1",
+					Sum:         otlpSum{DataPoints: requests, AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true},
+				},
+				{
+					Name:        otlpBytesMetric,
+					Description: "Bytes transferred between client and server services",
+					Unit:        "By",
+					Sum:         otlpSum{DataPoints: bytesSent, AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true},
+				},
+			},
+		}},
+	}}}
+}
+
+// runOTLPExport pushes the service graph to the OTLP endpoint until ctx is
+// done.
+func (s *Server) runOTLPExport(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.OTLPInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.exportServiceGraph(ctx); err != nil {
+			log.Warn().Err(err).Str("endpoint", s.cfg.OTLPEndpoint).Msg("Failed to export service graph")
+		}
+	}
+}
+
+// exportServiceGraph sends the current graph as OTLP/HTTP JSON metrics.
+func (s *Server) exportServiceGraph(ctx context.Context) error {
+	graph, now := s.graphEngine.ToJSON(), time.Now()
+	body, err := json.Marshal(serviceGraphMetrics(graph, s.otlpSeries.since(graph, now), now))
+	if err != nil {
+		return fmt.Errorf("encoding metrics: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.OTLPEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
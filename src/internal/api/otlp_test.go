@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestExportServiceGraphReflectsEdges(t *testing.T) {
+	var got otlpMetricsRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer collector.Close()
+
+	s := newMockServer()
+	s.cfg.OTLPEndpoint = collector.URL
+	s.httpClient = collector.Client()
+	start := time.Now().Add(-time.Hour)
+	for _, f := range []struct {
+		src, dst string
+		bytes    uint64
+		events   uint64
+	}{{"web", "api", 1000, 4}, {"api", "db", 500, 2}, {"web", "api", 300, 1}} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: f.src},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: f.dst},
+			Type:                types.TransferTypeServiceToService,
+			TotalBytes:          f.bytes,
+			EventCount:          f.events,
+			WindowStart:         start,
+			WindowEnd:           start.Add(time.Minute),
+		})
+	}
+
+	if err := s.exportServiceGraph(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.ResourceMetrics) != 1 || len(got.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("payload = %+v, want one resource and scope", got)
+	}
+	want := map[string]map[string]string{
+		otlpRequestMetric: {"shop/web|shop/api": "5", "shop/api|shop/db": "2"},
+		otlpBytesMetric:   {"shop/web|shop/api": "1300", "shop/api|shop/db": "500"},
+	}
+	metrics := got.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != len(want) {
+		t.Fatalf("%d metrics, want %d", len(metrics), len(want))
+	}
+	for _, m := range metrics {
+		points := want[m.Name]
+		if points == nil {
+			t.Errorf("unexpected metric %s", m.Name)
+			continue
+		}
+		if !m.Sum.IsMonotonic || m.Sum.AggregationTemporality != otlpTemporalityCumulative {
+			t.Errorf("%s is not a cumulative monotonic sum", m.Name)
+		}
+		if len(m.Sum.DataPoints) != len(points) {
+			t.Errorf("%s has %d data points, want one per edge", m.Name, len(m.Sum.DataPoints))
+		}
+		for _, p := range m.Sum.DataPoints {
+			attrs := make(map[string]string)
+			for _, a := range p.Attributes {
+				attrs[a.Key] = a.Value.StringValue
+			}
+			edge := attrs["client"] + "|" + attrs["server"]
+			if p.AsInt != points[edge] || attrs["transfer_type"] != string(types.TransferTypeServiceToService) {
+				t.Errorf("%s %s = %s (%v), want %s", m.Name, edge, p.AsInt, attrs, points[edge])
+			}
+			if p.StartTimeUnixNano != strconv.FormatInt(start.UnixNano(), 10) {
+				t.Errorf("%s %s starts at %s, want the edge's first sighting", m.Name, edge, p.StartTimeUnixNano)
+			}
+		}
+	}
+}
+
+func TestExportServiceGraphRejected(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	s := newMockServer()
+	s.cfg.OTLPEndpoint = collector.URL
+	s.httpClient = collector.Client()
+	if err := s.exportServiceGraph(context.Background()); err == nil {
+		t.Error("want error for a 503 from the collector")
+	}
+}
+
+func TestExportServiceGraphRestartsSeriesAfterReset(t *testing.T) {
+	var got otlpMetricsRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = otlpMetricsRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer collector.Close()
+
+	s := newMockServer()
+	s.cfg.OTLPEndpoint = collector.URL
+	s.httpClient = collector.Client()
+	firstSeen := time.Now().Add(-time.Hour)
+	flow := types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "web"},
+		DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: "api"},
+		Type:                types.TransferTypeServiceToService,
+		TotalBytes:          1000,
+		EventCount:          4,
+		WindowStart:         firstSeen,
+		WindowEnd:           firstSeen.Add(time.Minute),
+	}
+
+	// startOf returns the start time of the exported byte count
+	startOf := func() int64 {
+		t.Helper()
+		if err := s.exportServiceGraph(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range got.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+			if m.Name == otlpBytesMetric && len(m.Sum.DataPoints) == 1 {
+				start, _ := strconv.ParseInt(m.Sum.DataPoints[0].StartTimeUnixNano, 10, 64)
+				return start
+			}
+		}
+		t.Fatalf("payload %+v has no byte count for the edge", got)
+		return 0
+	}
+
+	s.graphEngine.AddFlow(flow)
+	s.graphEngine.AddFlow(flow)
+	if start := startOf(); start != firstSeen.UnixNano() {
+		t.Errorf("first export starts at %d, want the edge's first sighting %d", start, firstSeen.UnixNano())
+	}
+	if start := startOf(); start != firstSeen.UnixNano() {
+		t.Errorf("unchanged graph starts at %d, want the same series", start)
+	}
+
+	// Rebuilt with fewer bytes, the edge must not keep its old start
+	s.graphEngine.Reset()
+	s.graphEngine.AddFlow(flow)
+	beforeExport := time.Now()
+	if start := startOf(); start < beforeExport.UnixNano() {
+		t.Errorf("export after a reset starts at %d, want a new series from %d", start, beforeExport.UnixNano())
+	}
+}
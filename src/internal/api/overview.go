@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// defaultOverviewTalkers is how many top talkers /overview returns.
+const defaultOverviewTalkers = 10
+
+// OverviewResponse combines the headline numbers of /graph/stats,
+// /costs/summary, /anomalies/summary and /graph/top-talkers, so a
+// dashboard can load them in one request.
+type OverviewResponse struct {
+	Graph      GraphStatsResponse     `json:"graph"`
+	Cost       map[string]interface{} `json:"cost"`
+	Anomalies  types.AnomalySummary   `json:"anomalies"`
+	TopTalkers []engine.NodeJSON      `json:"top_talkers"`
+}
+
+// getOverview reads each engine once: graph statistics and top talkers
+// under one graph lock, and the anomaly summary under one baseline lock.
+// It accepts the n of /graph/top-talkers and the currency of
+// /costs/summary.
+func (s *Server) getOverview(w http.ResponseWriter, r *http.Request) {
+	n := defaultOverviewTalkers
+	if v := r.URL.Query().Get("n"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			n = parsed
+		}
+	}
+	currencies, err := parseCurrencies(r.URL.Query().Get("currency"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cost, err := s.costSummary(currencies)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, talkers := s.graphEngine.GetGraph().GetOverview(n)
+	nodes := make([]engine.NodeJSON, len(talkers))
+	for i, t := range talkers {
+		nodes[i] = t.ToJSON()
+	}
+
+	s.jsonResponse(w, http.StatusOK, OverviewResponse{
+		Graph:      s.graphStatsResponse(stats),
+		Cost:       cost,
+		Anomalies:  s.baseline.GetAnomalySummary(),
+		TopTalkers: nodes,
+	})
+}
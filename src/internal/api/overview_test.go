@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestOverviewMatchesEndpoints(t *testing.T) {
+	s := newMockServer()
+	for i, name := range []string{"api", "worker", "web"} {
+		flow := types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: name},
+			DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+			Type:                types.TransferTypeEgress,
+			TotalBytes:          uint64(i+1) << 30,
+		}
+		s.graphEngine.AddFlow(flow)
+		s.costEngine.RecordFlowCost(flow)
+	}
+	s.baseline.AddAnomaly(&types.Anomaly{ID: uuid.New(), Type: types.AnomalyTypeSpike, Severity: types.SeverityHigh, EstimatedCostImpactUSD: 12})
+
+	get := func(handler http.HandlerFunc, target string) []byte {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d", target, w.Code)
+		}
+		return bytes.TrimSpace(w.Body.Bytes())
+	}
+
+	var overview map[string]json.RawMessage
+	if err := json.Unmarshal(get(s.getOverview, "/api/v1/overview?n=2"), &overview); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string][]byte{
+		"graph":       get(s.getGraphStats, "/api/v1/graph/stats"),
+		"cost":        get(s.getCostSummary, "/api/v1/costs/summary"),
+		"anomalies":   get(s.getAnomalySummary, "/api/v1/anomalies/summary"),
+		"top_talkers": get(s.getTopTalkers, "/api/v1/graph/top-talkers?n=2"),
+	} {
+		if !bytes.Equal(overview[field], want) {
+			t.Errorf("overview %s = %s\nwant %s", field, overview[field], want)
+		}
+	}
+}
+
+func TestOverviewRejectsBadCurrency(t *testing.T) {
+	s := newMockServer()
+	w := httptest.NewRecorder()
+	s.getOverview(w, httptest.NewRequest(http.MethodGet, "/api/v1/overview?currency=doubloons", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// pricingRouter routes the pricing rule endpoints to s.
+func pricingRouter(s *Server) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/api/v1/costs/pricing-rules", s.getPricingRules)
+	r.Post("/api/v1/costs/pricing-rules", s.createPricingRule)
+	r.Delete("/api/v1/costs/pricing-rules/{id}", s.deletePricingRule)
+	return r
+}
+
+func listPricingRules(t *testing.T, h http.Handler) []types.PricingRule {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/pricing-rules", nil))
+	var rules []types.PricingRule
+	if err := json.NewDecoder(w.Body).Decode(&rules); err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestPricingRulesAddListDelete(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine()}
+	h := pricingRouter(s)
+	builtIn := len(listPricingRules(t, h))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/pricing-rules", strings.NewReader(
+		`{"name":"Negotiated egress","cloud_provider":"aws","category":"egress_internet","cost_per_gb":0.05}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body %s", w.Code, w.Body)
+	}
+	var created types.PricingRule
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.EffectiveFrom.IsZero() {
+		t.Error("created rule has no effective_from")
+	}
+
+	rules := listPricingRules(t, h)
+	if len(rules) != builtIn+1 || !hasRule(rules, created.ID) {
+		t.Fatalf("listed %d rules, want the %d built-in ones and %s", len(rules), builtIn, created.ID)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/costs/pricing-rules/"+created.ID.String(), nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want 204", w.Code)
+	}
+	if rules := listPricingRules(t, h); len(rules) != builtIn || hasRule(rules, created.ID) {
+		t.Errorf("listed %d rules after delete, want %d without %s", len(rules), builtIn, created.ID)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/costs/pricing-rules/"+created.ID.String(), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", w.Code)
+	}
+}
+
+func TestPostedPricingRuleChangesCost(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine()}
+	h := pricingRouter(s)
+	flow := types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api", CloudProvider: "aws"},
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          10 << 30,
+		WindowStart:         time.Now(),
+		WindowEnd:           time.Now(),
+	}
+	before := s.costEngine.CalculateCost(flow).CostUSD
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/pricing-rules", strings.NewReader(
+		`{"name":"Negotiated egress","cloud_provider":"aws","category":"egress_internet","cost_per_gb":0.01,
+		  "effective_from":"2024-01-01T00:00:00Z"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body %s", w.Code, w.Body)
+	}
+
+	after := s.costEngine.CalculateCost(flow).CostUSD
+	if math.Abs(after-0.10) > 1e-9 || after >= before {
+		t.Errorf("cost of 10 GB = $%v after posting a $0.01/GB rule (was $%v), want $0.10", after, before)
+	}
+}
+
+func TestPricingRuleValidationFailure(t *testing.T) {
+	s := &Server{costEngine: engine.NewCostEngine()}
+	h := pricingRouter(s)
+	builtIn := len(listPricingRules(t, h))
+
+	for _, body := range []string{
+		`{"name":"Negative","cloud_provider":"aws","category":"egress_internet","cost_per_gb":-1}`,
+		`{"name":"Nowhere","cloud_provider":"oracle","category":"egress_internet","cost_per_gb":0.05}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/pricing-rules", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/costs/pricing-rules/not-a-uuid", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status = %d, want 400", w.Code)
+	}
+	if got := len(listPricingRules(t, h)); got != builtIn {
+		t.Errorf("listed %d rules, want the %d built-in ones only", got, builtIn)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntelligenceStreamRelayedIncrementally(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ask" {
+			t.Errorf("upstream path = %s, want /ask", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "data: second\n\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	s := &Server{intelligenceURL: upstream.URL, httpClient: &http.Client{}}
+	front := httptest.NewServer(http.HandlerFunc(s.proxyToIntelligence))
+	defer front.Close()
+
+	resp, err := http.Post(front.URL+"/api/v1/intelligence/ask", "application/json", strings.NewReader(`{"question":"why?"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type = %q, want text/event-stream", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a chunk")
+			return ""
+		}
+	}
+
+	// The first event arrives while the upstream is still holding the second
+	if line := next(); line != "data: first" {
+		t.Fatalf("first line = %q, want data: first", line)
+	}
+	next()
+	release <- struct{}{}
+	if line := next(); line != "data: second" {
+		t.Errorf("second line = %q, want data: second", line)
+	}
+}
+
+func TestIntelligenceBufferedResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"answer":"egress"}`)
+	}))
+	defer upstream.Close()
+
+	s := &Server{intelligenceURL: upstream.URL, httpClient: &http.Client{}}
+	w := httptest.NewRecorder()
+	s.proxyToIntelligence(w, httptest.NewRequest(http.MethodPost, "/api/v1/intelligence/analyze", strings.NewReader("{}")))
+	if w.Code != http.StatusAccepted || w.Body.String() != `{"answer":"egress"}` {
+		t.Errorf("got %d %s, want the upstream response", w.Code, w.Body)
+	}
+}
+
+func TestIsStreamingResponse(t *testing.T) {
+	tests := []struct {
+		contentType string
+		length      int64
+		encoding    []string
+		want        bool
+	}{
+		{"text/event-stream; charset=utf-8", -1, nil, true},
+		{"application/x-ndjson", 100, nil, true},
+		{"application/json", -1, []string{"chunked"}, true},
+		{"application/json", 100, nil, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Content-Type": {tt.contentType}}, ContentLength: tt.length, TransferEncoding: tt.encoding}
+		if got := isStreamingResponse(resp); got != tt.want {
+			t.Errorf("%s length %d %v: streaming = %v, want %v", tt.contentType, tt.length, tt.encoding, got, tt.want)
+		}
+	}
+}
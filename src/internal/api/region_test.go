@@ -0,0 +1,47 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/storage"
+)
+
+func TestCostByDestinationRegion(t *testing.T) {
+	s := newMockServer()
+	got := s.costByDestinationRegion([]storage.DestinationRegionResult{
+		{SrcRegion: "us-east-1", DstRegion: "eu-west-1", TransferType: "cross_region", TotalBytes: 3 << 30, EventCount: 3},
+		{SrcRegion: "us-east-1", DstRegion: "us-west-2", TransferType: "cross_region", TotalBytes: 10 << 30, EventCount: 10},
+		{SrcRegion: "eu-west-1", DstRegion: "us-west-2", TransferType: "cross_region", TotalBytes: 5 << 30, EventCount: 5},
+	})
+
+	// Inter-region transfer is $0.02/GB
+	want := []DestinationRegionCost{
+		{Region: "us-west-2", TotalBytes: 15 << 30, EventCount: 15, CostUSD: 0.30},
+		{Region: "eu-west-1", TotalBytes: 3 << 30, EventCount: 3, CostUSD: 0.06},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d regions, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Region != w.Region || g.TotalBytes != w.TotalBytes || g.EventCount != w.EventCount || math.Abs(g.CostUSD-w.CostUSD) > 1e-9 {
+			t.Errorf("region %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestCostByDestinationRegionValidation(t *testing.T) {
+	s := newMockServer()
+	s.cfg = Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}
+	for query, want := range map[string]int{"": http.StatusOK, "?range=48h": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		s.getCostByDestinationRegion(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/by-dest-region"+query, nil))
+		if w.Code != want {
+			t.Errorf("%q: status = %d, want %d", query, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// SelfTestCheck is the outcome of exercising one engine.
+type SelfTestCheck struct {
+	Engine     string  `json:"engine"`
+	Passed     bool    `json:"passed"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// SelfTestResult reports every engine check; Status is "pass" only when
+// all of them passed.
+type SelfTestResult struct {
+	Status string          `json:"status"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// selfTestFlow is a synthetic 1 GiB internet egress flow.
+func selfTestFlow(now time.Time) types.TransferFlow {
+	return types.TransferFlow{
+		SourceIdentity: types.ServiceIdentity{Namespace: "egressor-selftest", Name: "source"},
+		DestinationEndpoint: &types.Endpoint{
+			IP:         "203.0.113.10",
+			IsInternet: true,
+		},
+		Type:         types.TransferTypeEgress,
+		TotalBytes:   1 << 30,
+		TotalPackets: 1 << 20,
+		EventCount:   1,
+		WindowStart:  now.Add(-time.Hour),
+		WindowEnd:    now,
+	}
+}
+
+// getSelfTest runs a synthetic flow through the cost, graph and baseline
+// engines as a post-deploy health gate. The graph and baselines are
+// scratch instances and the cost engine is only read, so live data is
+// never touched. Responds 503 when any check fails.
+func (s *Server) getSelfTest(w http.ResponseWriter, r *http.Request) {
+	result := s.runSelfTest(r.Context())
+	status := http.StatusOK
+	if result.Status != "pass" {
+		status = http.StatusServiceUnavailable
+	}
+	s.jsonResponse(w, status, result)
+}
+
+// runSelfTest runs each engine check in turn.
+func (s *Server) runSelfTest(ctx context.Context) SelfTestResult {
+	flow := selfTestFlow(time.Now())
+	checks := []struct {
+		engine string
+		run    func() error
+	}{
+		{"cost", func() error { return s.selfTestCost(flow) }},
+		{"graph", func() error { return selfTestGraph(flow) }},
+		{"baseline", func() error { return s.selfTestBaseline(ctx, flow) }},
+	}
+
+	result := SelfTestResult{Status: "pass"}
+	for _, c := range checks {
+		start := time.Now()
+		err := c.run()
+		check := SelfTestCheck{
+			Engine:     c.engine,
+			Passed:     err == nil,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			check.Error = err.Error()
+			result.Status = "fail"
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result
+}
+
+// selfTestCost prices the flow with the configured rules.
+func (s *Server) selfTestCost(flow types.TransferFlow) error {
+	breakdown := s.costEngine.CalculateCost(flow)
+	if breakdown.Category != types.CostCategoryEgressInternet {
+		return fmt.Errorf("classified internet egress as %q", breakdown.Category)
+	}
+	if breakdown.BytesTransferred != flow.TotalBytes {
+		return fmt.Errorf("priced %d bytes, want %d", breakdown.BytesTransferred, flow.TotalBytes)
+	}
+	if math.IsNaN(breakdown.CostUSD) || math.IsInf(breakdown.CostUSD, 0) || breakdown.CostUSD < 0 {
+		return fmt.Errorf("invalid cost %v", breakdown.CostUSD)
+	}
+	return nil
+}
+
+// selfTestGraph adds the flow to a scratch graph.
+func selfTestGraph(flow types.TransferFlow) error {
+	graph := engine.NewTransferGraph()
+	graph.AddFlow(flow)
+
+	stats := graph.GetStats()
+	if stats.TotalEdges != 1 {
+		return fmt.Errorf("graph has %d edges, want 1", stats.TotalEdges)
+	}
+	if stats.TotalBytes != flow.TotalBytes {
+		return fmt.Errorf("graph holds %d bytes, want %d", stats.TotalBytes, flow.TotalBytes)
+	}
+	return nil
+}
+
+// selfTestBaseline builds a two-day baseline for the flow on a scratch
+// engine using the configured detection, then checks that a large spike is
+// detected.
+func (s *Server) selfTestBaseline(ctx context.Context, flow types.TransferFlow) error {
+	baselines := engine.NewBaselineEngine(3.0)
+	if err := baselines.SetDetection(s.cfg.AnomalyDetection); err != nil {
+		return fmt.Errorf("configuring detection: %w", err)
+	}
+
+	key := types.JoinFlowKey(flow.SourceIdentity.FullName(), flow.DestinationEndpoint.IP)
+	hourly := make([]float64, 48)
+	for i := range hourly {
+		hourly[i] = float64(flow.TotalBytes) + float64(i%4)*float64(1<<20)
+	}
+	if baselines.BuildBaseline(ctx, key, hourly, flow.WindowStart.Add(-48*time.Hour), flow.WindowStart) == nil {
+		return fmt.Errorf("baseline was not built")
+	}
+
+	spike := float64(flow.TotalBytes) * 100
+	if len(baselines.DetectAnomalies(ctx, map[string]float64{key: spike})) == 0 {
+		return fmt.Errorf("spike of %.0f bytes was not detected", spike)
+	}
+	return nil
+}
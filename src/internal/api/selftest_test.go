@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelfTestPasses(t *testing.T) {
+	s := newMockServer()
+	w := httptest.NewRecorder()
+	s.getSelfTest(w, httptest.NewRequest(http.MethodGet, "/api/v1/selftest", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var result SelfTestResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "pass" || len(result.Checks) != 3 {
+		t.Fatalf("result = %+v, want 3 passing checks", result)
+	}
+	for _, c := range result.Checks {
+		if !c.Passed {
+			t.Errorf("%s check failed: %s", c.Engine, c.Error)
+		}
+	}
+
+	// Scratch engines only; live data is untouched
+	if stats := s.graphEngine.GetGraph().GetStats(); stats.TotalEdges != 0 {
+		t.Errorf("self-test added %d edges to the live graph", stats.TotalEdges)
+	}
+	if n := len(s.baseline.GetAllBaselines()); n != 0 {
+		t.Errorf("self-test added %d live baselines", n)
+	}
+}
@@ -4,12 +4,18 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"mime"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +23,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
@@ -34,6 +41,69 @@ type Config struct {
 	PostgresDSN     string
 	IntelligenceURL string // URL to Python intelligence service
 	CORSOrigins     []string
+	CostExemptions  []types.CostExemption // Traffic priced at zero
+	LabelDimensions map[string]string     // Source label key -> attribution dimension
+	PacketOverhead  map[string]uint64     // Protocol -> header bytes billed per packet
+
+	// TrustedDestinations are hostnames, "*.domain" wildcards, IPs, or
+	// CIDRs that never raise new-endpoint or leak anomalies.
+	TrustedDestinations []string
+
+	// SuspiciousDestinations are "pattern=severity" entries, see
+	// engine.ParseSuspiciousPattern, flagging egress for security review.
+	SuspiciousDestinations []string
+
+	// DefaultQueryRange applies to query endpoints when no range is given;
+	// MaxQueryRange caps the range a client may request.
+	DefaultQueryRange time.Duration
+	MaxQueryRange     time.Duration
+
+	// InitialLoadLookback is how much history the graph is loaded with at
+	// startup, queried InitialLoadChunk at a time. The lookback defaults to
+	// DefaultQueryRange.
+	InitialLoadLookback time.Duration
+	InitialLoadChunk    time.Duration
+
+	// StructuredRequestLogs logs requests via zerolog with query context
+	// instead of chi's plain-text logger.
+	StructuredRequestLogs bool
+
+	// AnomalyDetection selects z-score or percentile anomaly detection.
+	AnomalyDetection engine.DetectionConfig
+
+	// AnomalyEscalationInterval raises an active anomaly one severity
+	// level for each interval it persists, up to critical. Zero disables.
+	AnomalyEscalationInterval time.Duration
+
+	// BaselineMinSamples hourly values are needed to build a baseline;
+	// baselines alert only once they have BaselineConfidenceSamples.
+	BaselineMinSamples        int
+	BaselineConfidenceSamples int
+
+	// CostMetricsInterval is how often cost gauges on /metrics are
+	// refreshed; CostMetricsTopN bounds the namespaces given their own series.
+	CostMetricsInterval time.Duration
+	CostMetricsTopN     int
+
+	// FXRateSource is a URL serving USD-based exchange rates, refreshed
+	// every FXRefreshInterval; FXRates pins rates (units per USD) manually.
+	FXRateSource      string
+	FXRefreshInterval time.Duration
+	FXRates           map[string]float64
+
+	// IdempotencyTTL is how long responses to requests carrying an
+	// Idempotency-Key are replayed to retries.
+	IdempotencyTTL time.Duration
+
+	// GraphGranularity selects whether graph nodes are services,
+	// deployments (workload versions), or pods. Empty means services.
+	GraphGranularity string
+
+	// OTLPEndpoint is an OTLP/HTTP metrics URL (e.g.
+	// http://otel-collector:4318/v1/metrics) the service graph is pushed to
+	// every OTLPInterval. Empty disables the export.
+	OTLPEndpoint string
+	OTLPInterval time.Duration
 }
 
 // Server is the FlowScope API server.
@@ -47,10 +117,58 @@ type Server struct {
 	baseline        *engine.BaselineEngine
 	intelligenceURL string
 	httpClient      *http.Client
+	otlpSeries      otlpSeries
+	statusChecks    statusChecks
+	startedAt       time.Time
+	loadedAt        time.Time
+	loaded          bool // Initial load finished, or there was nothing to load
+	loadMu          sync.RWMutex
+
+	// Metrics
+	watchlistAlerts *prometheus.CounterVec
+	costMetrics     *costMetrics
+	fx              *fxRates
+	idempotent      *idempotencyCache
 }
 
 // NewServer creates a new API server.
 func NewServer(cfg Config) (*Server, error) {
+	if cfg.DefaultQueryRange <= 0 {
+		cfg.DefaultQueryRange = defaultQueryRange
+	}
+	if cfg.MaxQueryRange <= 0 {
+		cfg.MaxQueryRange = defaultMaxRange
+	}
+	if cfg.InitialLoadLookback <= 0 {
+		cfg.InitialLoadLookback = cfg.DefaultQueryRange
+	}
+	if cfg.InitialLoadChunk <= 0 {
+		cfg.InitialLoadChunk = defaultInitialLoadChunk
+	}
+	if cfg.CostMetricsInterval <= 0 {
+		cfg.CostMetricsInterval = defaultCostMetricsInterval
+	}
+	if cfg.CostMetricsTopN <= 0 {
+		cfg.CostMetricsTopN = defaultCostMetricsTopN
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = defaultIdempotencyTTL
+	}
+	if cfg.FXRefreshInterval <= 0 {
+		cfg.FXRefreshInterval = defaultFXRefreshInterval
+	}
+	if cfg.OTLPInterval <= 0 {
+		cfg.OTLPInterval = defaultOTLPInterval
+	}
+	for currency, rate := range cfg.FXRates {
+		if !isCurrencyCode(strings.ToUpper(currency)) || rate <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %s=%v", currency, rate)
+		}
+	}
+	if cfg.DefaultQueryRange > cfg.MaxQueryRange {
+		return nil, fmt.Errorf("default query range %s exceeds maximum %s", cfg.DefaultQueryRange, cfg.MaxQueryRange)
+	}
+
 	// Initialize storage
 	store, err := storage.NewClickHouseStore(cfg.ClickHouseDSN)
 	if err != nil {
@@ -59,8 +177,49 @@ func NewServer(cfg Config) (*Server, error) {
 
 	// Initialize engines
 	graphEngine := engine.NewGraphEngine(store)
+	granularity, ok := engine.ParseNodeGranularity(cfg.GraphGranularity)
+	if !ok {
+		return nil, fmt.Errorf("unknown graph granularity %q", cfg.GraphGranularity)
+	}
+	graphEngine.SetGranularity(granularity)
 	costEngine := engine.NewCostEngine()
+	for _, x := range cfg.CostExemptions {
+		if err := costEngine.AddCostExemption(x); err != nil {
+			return nil, fmt.Errorf("adding cost exemption: %w", err)
+		}
+	}
+	if err := costEngine.SetLabelDimensions(cfg.LabelDimensions); err != nil {
+		return nil, fmt.Errorf("configuring label dimensions: %w", err)
+	}
+	if err := costEngine.SetPacketOverhead(cfg.PacketOverhead); err != nil {
+		return nil, fmt.Errorf("configuring packet overhead: %w", err)
+	}
 	baselineEngine := engine.NewBaselineEngine(3.0)
+	if err := baselineEngine.SetDetection(cfg.AnomalyDetection); err != nil {
+		return nil, fmt.Errorf("configuring anomaly detection: %w", err)
+	}
+	if err := baselineEngine.SetSampleRequirements(cfg.BaselineMinSamples, cfg.BaselineConfidenceSamples); err != nil {
+		return nil, fmt.Errorf("configuring baseline samples: %w", err)
+	}
+	baselineEngine.SetEscalationInterval(cfg.AnomalyEscalationInterval)
+	for _, dst := range cfg.TrustedDestinations {
+		if _, err := baselineEngine.AddTrustedDestination(types.TrustedDestination{Destination: dst}); err != nil {
+			return nil, fmt.Errorf("adding trusted destination %q: %w", dst, err)
+		}
+	}
+	suspicious := make([]engine.SuspiciousPattern, 0, len(cfg.SuspiciousDestinations))
+	for _, s := range cfg.SuspiciousDestinations {
+		p, err := engine.ParseSuspiciousPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		suspicious = append(suspicious, p)
+	}
+	baselineEngine.SetSuspiciousPatterns(suspicious)
+	if store != nil {
+		baselineEngine.SetEventSource(store)
+		baselineEngine.SetAnomalyStore(store)
+	}
 
 	// Default intelligence URL
 	intelligenceURL := cfg.IntelligenceURL
@@ -68,17 +227,37 @@ func NewServer(cfg Config) (*Server, error) {
 		intelligenceURL = "http://localhost:8090"
 	}
 
-	return &Server{
+	s := &Server{
 		cfg:             cfg,
 		storage:         store,
 		graphEngine:     graphEngine,
 		costEngine:      costEngine,
 		baseline:        baselineEngine,
 		intelligenceURL: intelligenceURL,
+		// No overall timeout so streamed answers are not cut off; request
+		// contexts bound everything else.
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 60 * time.Second,
+				DisableCompression:    true,
+			},
 		},
-	}, nil
+		startedAt: time.Now(),
+		watchlistAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "egressor_api_watchlist_new_consumers_total",
+			Help: "New source services seen sending to a watchlisted destination",
+		}, []string{"destination"}),
+		costMetrics: newCostMetrics(cfg.CostMetricsTopN),
+		fx:          newFXRates(cfg.FXRateSource, cfg.FXRates),
+		idempotent:  newIdempotencyCache(cfg.IdempotencyTTL),
+	}
+	s.statusChecks = s.defaultStatusChecks()
+
+	// Register metrics
+	prometheus.MustRegister(s.watchlistAlerts, s.costMetrics.costUSD, s.costMetrics.egressBytes, s.costMetrics.coverage)
+
+	return s, nil
 }
 
 // Start starts the API server.
@@ -122,6 +301,17 @@ func (s *Server) Start(ctx context.Context) error {
 
 	// Load initial data
 	go s.loadInitialData(ctx)
+	go s.runCostMetrics(ctx)
+	go s.runIdempotencySweep(ctx)
+	if s.cfg.FXRateSource != "" {
+		go s.runFXRefresh(ctx)
+	}
+	if s.cfg.AnomalyEscalationInterval > 0 {
+		go s.runAnomalyReconcile(ctx)
+	}
+	if s.cfg.OTLPEndpoint != "" {
+		go s.runOTLPExport(ctx)
+	}
 
 	return nil
 }
@@ -152,7 +342,7 @@ func (s *Server) setupRouter() *chi.Mux {
 	// Middleware
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(s.defaultRequestLogger())
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
@@ -160,8 +350,8 @@ func (s *Server) setupRouter() *chi.Mux {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   s.cfg.CORSOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID", idempotencyKeyHeader},
+		ExposedHeaders:   []string{"Link", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -173,228 +363,1362 @@ func (s *Server) setupRouter() *chi.Mux {
 
 	// API v1 routes
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(s.idempotency)
+
+		// Status endpoint
+		r.Get("/status", s.getStatus)
+		r.Get("/selftest", s.getSelfTest)
+
 		// Graph endpoints
 		r.Get("/graph", s.getGraph)
 		r.Get("/graph/stats", s.getGraphStats)
+		r.Get("/overview", s.getOverview)
 		r.Get("/graph/service/{service}", s.getServiceGraph)
+		r.Get("/graph/service/{service}/reachable", s.getReachable)
+		r.Get("/graph/services", s.getServicesGraph)
+		r.Get("/graph/by-az", s.getGraphByAZ)
+		r.Get("/graph/communities", s.getCommunities)
+		r.Get("/graph/asymmetric", s.getAsymmetric)
 		r.Get("/graph/top-talkers", s.getTopTalkers)
+		r.Get("/graph/top-listeners", s.getTopListeners)
 		r.Get("/graph/top-edges", s.getTopEdges)
+		r.Get("/graph/new-edges", s.getNewEdges)
+		r.Get("/graph/stream", s.streamGraph)
 
 		// Flow endpoints
 		r.Get("/flows", s.getFlows)
+		r.Get("/flows/active", s.getActiveFlows)
 		r.Get("/flows/egress", s.getEgressFlows)
+		r.Get("/flows/egress/by-country", s.getEgressByCountry)
+		r.Get("/flows/egress/by-asn", s.getEgressByASN)
 		r.Get("/flows/cross-region", s.getCrossRegionFlows)
+		r.Get("/flows/cross-az", s.getCrossAZFlows)
+		r.Get("/flows/to-destination", s.getDestinationSources)
+		r.Get("/flows/{flowKey}/events", s.getFlowEvents)
 
 		// Cost endpoints
 		r.Get("/costs/summary", s.getCostSummary)
+		r.Get("/costs/mtd", s.getMonthToDateCost)
+		r.Post("/costs/calculate", s.calculateCosts)
+		r.Post("/costs/explain", s.explainCost)
+		r.Get("/costs/fx-rates", s.getFXRates)
+		r.Put("/costs/fx-rates", s.setFXOverride)
 		r.Get("/costs/attribution", s.getCostAttribution)
+		r.Get("/costs/heatmap", s.getCostHeatmap)
 		r.Get("/costs/by-namespace", s.getCostByNamespace)
+		r.Get("/costs/by-namespace/trend", s.getNamespaceTrend)
 		r.Get("/costs/by-service", s.getCostByService)
+		r.Get("/costs/by-version", s.getCostByVersion)
+		r.Get("/costs/by-path", s.getCostByPath)
+		r.Get("/costs/by-cloud-service", s.getCostByCloudService)
+		r.Get("/costs/by-dest-region", s.getCostByDestinationRegion)
+		r.Get("/costs/endpoint-caps", s.getEndpointCaps)
+		r.Post("/costs/endpoint-caps", s.setEndpointCap)
+		r.Get("/costs/pricing-rules", s.getPricingRules)
+		r.Post("/costs/pricing-rules", s.createPricingRule)
+		r.Delete("/costs/pricing-rules/{id}", s.deletePricingRule)
+		r.Get("/costs/watchlist", s.getWatchlist)
+		r.Post("/costs/watchlist", s.addWatchlistEntry)
 
 		// Anomaly endpoints
 		r.Get("/anomalies", s.getAnomalies)
 		r.Get("/anomalies/active", s.getActiveAnomalies)
+		r.Get("/anomalies/history", s.getAnomalyHistory)
 		r.Get("/anomalies/{id}", s.getAnomaly)
 		r.Get("/anomalies/summary", s.getAnomalySummary)
+		r.Get("/anomalies/feedback", s.getAnomalyFeedback)
+		r.Get("/anomalies/suppressions", s.getSuppressions)
+		r.Post("/anomalies/suppressions", s.createSuppression)
+		r.Get("/anomalies/trusted-destinations", s.getTrustedDestinations)
+		r.Post("/anomalies/trusted-destinations", s.addTrustedDestination)
 		r.Post("/anomalies/{id}/acknowledge", s.acknowledgeAnomaly)
 		r.Post("/anomalies/{id}/resolve", s.resolveAnomaly)
 
-		// Baseline endpoints
-		r.Get("/baselines", s.getBaselines)
-		r.Get("/baselines/{flowKey}", s.getBaseline)
+		// Baseline endpoints
+		r.Get("/baselines", s.getBaselines)
+		r.Get("/baselines/{flowKey}", s.getBaseline)
+
+		// Intelligence endpoints (proxied to Python service)
+		r.Post("/intelligence/analyze", s.proxyToIntelligence)
+		r.Post("/intelligence/investigate", s.proxyToIntelligence)
+		r.Post("/intelligence/explain-cost", s.proxyToIntelligence)
+		r.Post("/intelligence/ask", s.proxyToIntelligence)
+		r.Get("/intelligence/optimizations", s.proxyToIntelligence)
+
+		// Mock data endpoints (for testing)
+		r.Post("/mock/generate", s.generateMockData)
+		r.Post("/mock/anomaly", s.generateMockAnomaly)
+		r.Delete("/mock/reset", s.resetMockData)
+	})
+
+	return r
+}
+
+// defaultInitialLoadChunk is used when Config leaves InitialLoadChunk unset.
+const defaultInitialLoadChunk = 24 * time.Hour
+
+// loadInitialData loads data from storage on startup.
+func (s *Server) loadInitialData(ctx context.Context) {
+	if s.storage == nil {
+		s.loadMu.Lock()
+		s.loaded = true
+		s.loadMu.Unlock()
+		return
+	}
+
+	if err := s.costEngine.LoadPricingRules(ctx, s.storage); err != nil {
+		log.Error().Err(err).Msg("Failed to load pricing rules")
+	}
+
+	// Flows from earlier in the month than the graph's lookback still count
+	// toward the month-to-date cost; price them first, oldest first, so
+	// tiered usage builds up in order
+	now := time.Now()
+	if start, end, ok := monthBeforeLookback(now, s.cfg.InitialLoadLookback); ok {
+		if err := loadHistory(ctx, end, end.Sub(start), s.cfg.InitialLoadChunk, s.loadMonthToDate); err != nil {
+			log.Error().Err(err).Msg("Failed to load month-to-date cost")
+		}
+	}
+
+	if err := loadHistory(ctx, now, s.cfg.InitialLoadLookback, s.cfg.InitialLoadChunk, s.loadFlows); err != nil {
+		log.Error().Err(err).Msg("Failed to load graph data")
+		return
+	}
+
+	s.loadMu.Lock()
+	s.loadedAt = time.Now()
+	s.loaded = true
+	s.loadMu.Unlock()
+}
+
+// loadFlows loads stored flows in [start, end) into the graph and passes
+// them to observeFlow, as recordFlow does for flows added directly.
+func (s *Server) loadFlows(ctx context.Context, start, end time.Time) error {
+	flows, err := s.graphEngine.LoadFlowsFromStorage(ctx, start, end)
+	if err != nil {
+		return err
+	}
+	for _, flow := range flows {
+		s.observeFlow(flow)
+	}
+	return nil
+}
+
+// monthBeforeLookback returns the part of the current month (UTC) before
+// the lookback ending at now, if the lookback does not reach back to the
+// start of the month.
+func monthBeforeLookback(now time.Time, lookback time.Duration) (start, end time.Time, ok bool) {
+	utc := now.UTC()
+	start = time.Date(utc.Year(), utc.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end = now.Add(-lookback)
+	return start, end, start.Before(end)
+}
+
+// loadMonthToDate prices the flows stored in [start, end) toward the
+// month-to-date cost without adding them to the graph.
+func (s *Server) loadMonthToDate(ctx context.Context, start, end time.Time) error {
+	results, err := s.storage.QueryFlows(ctx, storage.FlowQuery{Start: start, End: end, Limit: 100000})
+	if err != nil {
+		return fmt.Errorf("querying flows: %w", err)
+	}
+	for _, r := range results {
+		s.costEngine.RecordFlowCost(r.ToFlow(start, end))
+	}
+	return nil
+}
+
+// loadHistory calls load over the lookback before end, oldest first, a
+// chunk at a time so no single query spans all of it.
+func loadHistory(
+	ctx context.Context,
+	end time.Time,
+	lookback, chunk time.Duration,
+	load func(ctx context.Context, start, end time.Time) error,
+) error {
+	start := end.Add(-lookback)
+	for chunkStart := start; chunkStart.Before(end); {
+		chunkEnd := chunkStart.Add(chunk)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		if err := load(ctx, chunkStart, chunkEnd); err != nil {
+			return err
+		}
+		log.Info().
+			Time("loaded_until", chunkEnd).
+			Float64("progress", float64(chunkEnd.Sub(start))/float64(end.Sub(start))).
+			Msg("Loading initial graph data")
+		chunkStart = chunkEnd
+	}
+	return nil
+}
+
+// Handler implementations
+
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Ready"))
+}
+
+// getGraph returns the full graph. Edges to well-known services can be
+// dropped with ?exclude_services=dns,ntp or ?exclude_control_plane=true.
+func (s *Server) getGraph(w http.ResponseWriter, r *http.Request) {
+	var filter engine.EdgeFilter
+	if v := r.URL.Query().Get("exclude_services"); v != "" {
+		filter.ExcludeServices = make(map[string]bool)
+		for _, svc := range strings.Split(v, ",") {
+			filter.ExcludeServices[strings.TrimSpace(svc)] = true
+		}
+	}
+	filter.ExcludeControlPlane, _ = strconv.ParseBool(r.URL.Query().Get("exclude_control_plane"))
+	filter.ExcludeIntraNamespace, _ = strconv.ParseBool(r.URL.Query().Get("exclude_intra_namespace"))
+
+	graph := s.graphEngine.GetGraph().ToJSONFiltered(filter)
+	s.jsonResponse(w, http.StatusOK, graph)
+}
+
+// GraphStatsResponse is the graph statistics with whether the initial load
+// from storage has finished, so an empty graph can be told apart from one
+// not loaded yet.
+type GraphStatsResponse struct {
+	engine.GraphStats
+	Loaded       bool       `json:"loaded"`
+	LastLoadedAt *time.Time `json:"last_loaded_at,omitempty"`
+}
+
+func (s *Server) getGraphStats(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.graphStatsResponse(s.graphEngine.GetGraph().GetStats()))
+}
+
+// graphStatsResponse adds the load state to graph statistics.
+func (s *Server) graphStatsResponse(stats engine.GraphStats) GraphStatsResponse {
+	s.loadMu.RLock()
+	loaded := s.loaded
+	s.loadMu.RUnlock()
+
+	return GraphStatsResponse{
+		GraphStats:   stats,
+		Loaded:       loaded,
+		LastLoadedAt: s.lastLoadedAt(),
+	}
+}
+
+func (s *Server) getServiceGraph(w http.ResponseWriter, r *http.Request) {
+	service := chi.URLParam(r, "service")
+	depth := 2
+	if d := r.URL.Query().Get("depth"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil {
+			depth = parsed
+		}
+	}
+
+	subgraph := s.graphEngine.GetGraph().GetServiceGraph(service, depth)
+	s.jsonResponse(w, http.StatusOK, subgraph.ToJSON())
+}
+
+// ReachableNode is a node reachable from a service and its hop distance.
+type ReachableNode struct {
+	ID   string `json:"id"`
+	Hops int    `json:"hops"`
+}
+
+// getReachable returns everything a service sends to, directly or
+// transitively, nearest first. ?depth= bounds the hops; zero or absent
+// means unbounded.
+func (s *Server) getReachable(w http.ResponseWriter, r *http.Request) {
+	service := chi.URLParam(r, "service")
+	depth := 0
+	if v := r.URL.Query().Get("depth"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			s.errorResponse(w, http.StatusBadRequest, "depth must be a non-negative integer")
+			return
+		}
+		depth = parsed
+	}
+
+	graph := s.graphEngine.GetGraph()
+	if graph.GetNode(service) == nil {
+		s.errorResponse(w, http.StatusNotFound, "service not found")
+		return
+	}
+
+	hops := graph.Reachable(service, depth)
+	nodes := make([]ReachableNode, 0, len(hops))
+	for id, h := range hops {
+		nodes = append(nodes, ReachableNode{ID: id, Hops: h})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Hops != nodes[j].Hops {
+			return nodes[i].Hops < nodes[j].Hops
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	s.jsonResponse(w, http.StatusOK, nodes)
+}
+
+// getCommunities returns groups of services that mostly talk to each
+// other, largest first.
+func (s *Server) getCommunities(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.graphEngine.GetCommunities())
+}
+
+// getGraphByAZ returns inter-AZ byte volumes as a zone matrix.
+func (s *Server) getGraphByAZ(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.graphEngine.GetAZMatrix())
+}
+
+// getAsymmetric returns services and service pairs whose traffic in one
+// direction is at least ?ratio= times the other, ignoring those moving less
+// than ?min_bytes=.
+func (s *Server) getAsymmetric(w http.ResponseWriter, r *http.Request) {
+	ratio := engine.DefaultAsymmetryRatio
+	if v := r.URL.Query().Get("ratio"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 1 {
+			s.errorResponse(w, http.StatusBadRequest, "ratio must be a number of at least 1")
+			return
+		}
+		ratio = parsed
+	}
+
+	minBytes := uint64(engine.DefaultAsymmetryMinBytes)
+	if v := r.URL.Query().Get("min_bytes"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "invalid min_bytes")
+			return
+		}
+		minBytes = parsed
+	}
+
+	s.jsonResponse(w, http.StatusOK, s.graphEngine.GetAsymmetric(ratio, minBytes))
+}
+
+// getServicesGraph returns the merged subgraph around the services given as
+// ?ids=ns/a,ns/b.
+func (s *Server) getServicesGraph(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		s.errorResponse(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+
+	depth := 2
+	if d := r.URL.Query().Get("depth"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil {
+			depth = parsed
+		}
+	}
+
+	subgraph := s.graphEngine.GetGraph().GetServicesGraph(ids, depth)
+	s.jsonResponse(w, http.StatusOK, subgraph.ToJSON())
+}
+
+func (s *Server) getTopTalkers(w http.ResponseWriter, r *http.Request) {
+	n := 10
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		if parsed, err := strconv.Atoi(nStr); err == nil {
+			n = parsed
+		}
+	}
+
+	graph := s.graphEngine.GetGraph()
+	var talkers []*engine.ServiceNode
+	switch by := r.URL.Query().Get("by"); by {
+	case "", "bytes":
+		talkers = graph.GetTopTalkers(n)
+	case "fan_out":
+		talkers = graph.GetTopFanOut(n)
+	case "fan_in":
+		talkers = graph.GetTopFanIn(n)
+	default:
+		s.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid by %q (bytes, fan_out, fan_in)", by))
+		return
+	}
+	nodes := make([]engine.NodeJSON, len(talkers))
+	for i, t := range talkers {
+		nodes[i] = t.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, nodes)
+}
+
+func (s *Server) getTopListeners(w http.ResponseWriter, r *http.Request) {
+	n := 10
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		if parsed, err := strconv.Atoi(nStr); err == nil {
+			n = parsed
+		}
+	}
+
+	listeners := s.graphEngine.GetTopListeners(n)
+	nodes := make([]engine.NodeJSON, len(listeners))
+	for i, l := range listeners {
+		nodes[i] = l.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, nodes)
+}
+
+func (s *Server) getTopEdges(w http.ResponseWriter, r *http.Request) {
+	n := 10
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		if parsed, err := strconv.Atoi(nStr); err == nil {
+			n = parsed
+		}
+	}
+
+	edges := s.graphEngine.GetGraph().GetTopEdges(n)
+	result := make([]engine.EdgeJSON, len(edges))
+	for i, e := range edges {
+		result[i] = e.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+// defaultActiveWithin is how recently an edge must have carried traffic to
+// count as active when ?within= is not given.
+const defaultActiveWithin = 30 * time.Second
+
+// getActiveFlows returns edges with traffic in the last ?within= (e.g.
+// "30s"), most recent first. Unlike the graph's query window this is about
+// recency: an edge with a large total but no recent traffic is left out.
+func (s *Server) getActiveFlows(w http.ResponseWriter, r *http.Request) {
+	within := defaultActiveWithin
+	if v := r.URL.Query().Get("within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			s.errorResponse(w, http.StatusBadRequest, "within must be a positive duration")
+			return
+		}
+		within = d
+	}
+
+	edges := s.graphEngine.GetGraph().GetActiveEdges(time.Now().Add(-within))
+	result := make([]engine.EdgeJSON, len(edges))
+	for i, e := range edges {
+		result[i] = e.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+// getNewEdges returns edges first seen after ?since=, given as an RFC 3339
+// time or a duration ago (e.g. "2h"). Defaults to the last hour.
+func (s *Server) getNewEdges(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-time.Hour)
+	if v := r.URL.Query().Get("since"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			since = t
+		} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			since = time.Now().Add(-d)
+		} else {
+			s.errorResponse(w, http.StatusBadRequest, "since must be an RFC 3339 time or a duration")
+			return
+		}
+	}
+
+	edges := s.graphEngine.GetGraph().GetNewEdges(since)
+	result := make([]engine.EdgeJSON, len(edges))
+	for i, e := range edges {
+		result[i] = e.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+// getFlows returns aggregated flows. ?granularity=raw|5m|hourly|daily
+// buckets them in time.
+func (s *Server) getFlows(w http.ResponseWriter, r *http.Request) {
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	granularity, err := storage.ParseGranularity(r.URL.Query().Get("granularity"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	groupBy, err := storage.ParseFlowGrouping(r.URL.Query().Get("group_by"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		logQuery(r, start, end, 0)
+		s.jsonResponse(w, http.StatusOK, []interface{}{})
+		return
+	}
+
+	flows, err := s.storage.QueryFlows(r.Context(), storage.FlowQuery{
+		Start:        start,
+		End:          end,
+		SrcNamespace: r.URL.Query().Get("namespace"),
+		SrcService:   r.URL.Query().Get("service"),
+		Granularity:  granularity,
+		GroupBy:      groupBy,
+		Limit:        100,
+	})
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+
+	logQuery(r, start, end, len(flows))
+	s.jsonResponse(w, http.StatusOK, flows)
+}
+
+// GeoEgress is egress bytes and cost for a destination country or ASN.
+type GeoEgress struct {
+	storage.GeoEgressResult
+	CostUSD float64 `json:"cost_usd"`
+}
+
+func (s *Server) getEgressByCountry(w http.ResponseWriter, r *http.Request) {
+	s.egressByGeo(w, r, storage.GeoDimensionCountry)
+}
+
+func (s *Server) getEgressByASN(w http.ResponseWriter, r *http.Request) {
+	s.egressByGeo(w, r, storage.GeoDimensionASN)
+}
+
+// egressByGeo returns internet egress over the query range grouped by
+// dimension, priced at the internet egress rate.
+func (s *Server) egressByGeo(w http.ResponseWriter, r *http.Request, dimension string) {
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []GeoEgress{})
+		return
+	}
+
+	results, err := s.storage.QueryEgressByGeo(r.Context(), start, end, dimension)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, start, end, len(results))
+
+	out := make([]GeoEgress, len(results))
+	for i, res := range results {
+		cost := s.costEngine.CalculateCost(types.TransferFlow{
+			Type:       types.TransferTypeEgress,
+			TotalBytes: res.TotalBytes,
+		})
+		out[i] = GeoEgress{GeoEgressResult: res, CostUSD: cost.CostUSD}
+	}
+
+	s.jsonResponse(w, http.StatusOK, out)
+}
+
+// DestinationRegionCost is traffic and cost to one destination region.
+type DestinationRegionCost struct {
+	Region        string  `json:"region"`
+	TotalBytes    uint64  `json:"total_bytes"`
+	EventCount    uint64  `json:"event_count"`
+	CostUSD       float64 `json:"cost_usd"`
+	RawSampleRate float64 `json:"raw_sample_rate"` // Below 1, totals leave out flows not retained raw
+}
+
+// getCostByDestinationRegion returns traffic and cost per destination cloud
+// region for traffic leaving its own region, most expensive first. Internet
+// egress is not included.
+func (s *Server) getCostByDestinationRegion(w http.ResponseWriter, r *http.Request) {
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []DestinationRegionCost{})
+		return
+	}
+
+	results, err := s.storage.QueryCostByDestinationRegion(r.Context(), start, end)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, start, end, len(results))
+
+	s.jsonResponse(w, http.StatusOK, s.costByDestinationRegion(results))
+}
+
+// costByDestinationRegion prices region-to-region traffic and totals it per
+// destination region, most expensive first.
+func (s *Server) costByDestinationRegion(results []storage.DestinationRegionResult) []DestinationRegionCost {
+	byRegion := make(map[string]*DestinationRegionCost)
+	var order []string
+	for _, res := range results {
+		c, ok := byRegion[res.DstRegion]
+		if !ok {
+			c = &DestinationRegionCost{Region: res.DstRegion}
+			byRegion[res.DstRegion] = c
+			order = append(order, res.DstRegion)
+		}
+		cost := s.costEngine.CalculateCost(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Region: res.SrcRegion},
+			DestinationIdentity: &types.ServiceIdentity{Region: res.DstRegion},
+			Type:                types.TransferType(res.TransferType),
+			TotalBytes:          res.TotalBytes,
+		})
+		c.TotalBytes += res.TotalBytes
+		c.EventCount += res.EventCount
+		c.CostUSD += cost.CostUSD
+		c.RawSampleRate = types.LowerRawSampleRate(c.RawSampleRate, res.RawSampleRate)
+	}
+
+	out := make([]DestinationRegionCost, 0, len(order))
+	for _, region := range order {
+		out = append(out, *byRegion[region])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CostUSD > out[j].CostUSD })
+	return out
+}
+
+// CloudServiceCost is traffic and cost to one cloud service.
+type CloudServiceCost struct {
+	CloudService  string  `json:"cloud_service"`
+	TotalBytes    uint64  `json:"total_bytes"`
+	EventCount    uint64  `json:"event_count"`
+	CostUSD       float64 `json:"cost_usd"`
+	RawSampleRate float64 `json:"raw_sample_rate"` // Below 1, totals leave out flows not retained raw
+}
+
+// getCostByCloudService returns traffic and cost per destination cloud
+// service over the query range, most expensive first. Control-plane
+// services such as DNS are left out.
+func (s *Server) getCostByCloudService(w http.ResponseWriter, r *http.Request) {
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []CloudServiceCost{})
+		return
+	}
+
+	results, err := s.storage.QueryByCloudService(r.Context(), start, end)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, start, end, len(results))
+
+	s.jsonResponse(w, http.StatusOK, s.cloudServiceCosts(results))
+}
+
+// cloudServiceCosts prices per-type cloud service traffic and sums it per
+// service, most expensive first.
+func (s *Server) cloudServiceCosts(results []storage.CloudServiceResult) []CloudServiceCost {
+	byService := make(map[string]*CloudServiceCost)
+	var order []string
+	for _, res := range results {
+		if types.IsControlPlaneService(res.CloudService) {
+			continue
+		}
+		c, ok := byService[res.CloudService]
+		if !ok {
+			c = &CloudServiceCost{CloudService: res.CloudService}
+			byService[res.CloudService] = c
+			order = append(order, res.CloudService)
+		}
+		cost := s.costEngine.CalculateCost(types.TransferFlow{
+			Type:                types.TransferType(res.TransferType),
+			TotalBytes:          res.TotalBytes,
+			DestinationEndpoint: &types.Endpoint{CloudServiceName: res.CloudService},
+		})
+		c.TotalBytes += res.TotalBytes
+		c.EventCount += res.EventCount
+		c.CostUSD += cost.CostUSD
+		c.RawSampleRate = types.LowerRawSampleRate(c.RawSampleRate, res.RawSampleRate)
+	}
+
+	out := make([]CloudServiceCost, 0, len(order))
+	for _, svc := range order {
+		out = append(out, *byService[svc])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CostUSD > out[j].CostUSD })
+	return out
+}
+
+// DestinationSource is traffic and cost from one service to a destination.
+type DestinationSource struct {
+	Namespace     string  `json:"namespace"`
+	Service       string  `json:"service"`
+	TotalBytes    uint64  `json:"total_bytes"`
+	EventCount    uint64  `json:"event_count"`
+	CostUSD       float64 `json:"cost_usd"`
+	RawSampleRate float64 `json:"raw_sample_rate"` // Below 1, totals leave out flows not retained raw
+}
+
+// getDestinationSources returns the services sending data to an external
+// destination given by ?host= and/or ?ip=, largest senders first.
+func (s *Server) getDestinationSources(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	ip := r.URL.Query().Get("ip")
+	if host == "" && ip == "" {
+		s.errorResponse(w, http.StatusBadRequest, "host or ip is required")
+		return
+	}
+	if ip != "" && net.ParseIP(ip) == nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid ip")
+		return
+	}
+
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []DestinationSource{})
+		return
+	}
+
+	results, err := s.storage.QueryDestinationSources(r.Context(), start, end, host, ip)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, start, end, len(results))
+
+	s.jsonResponse(w, http.StatusOK, s.destinationSources(results, host, ip))
+}
+
+// destinationSources totals per-region, per-type results by source service
+// and prices them, largest senders first.
+func (s *Server) destinationSources(results []storage.DestinationSourceResult, host, ip string) []DestinationSource {
+	bySource := make(map[string]*DestinationSource)
+	var order []string
+	for _, res := range results {
+		key := res.SrcNamespace + "/" + res.SrcService
+		src, ok := bySource[key]
+		if !ok {
+			src = &DestinationSource{Namespace: res.SrcNamespace, Service: res.SrcService}
+			bySource[key] = src
+			order = append(order, key)
+		}
+		cost := s.costEngine.CalculateCost(types.TransferFlow{
+			Type: types.TransferType(res.TransferType),
+			SourceIdentity: types.ServiceIdentity{
+				Namespace: res.SrcNamespace,
+				Name:      res.SrcService,
+				Region:    res.SrcRegion,
+			},
+			TotalBytes:          res.TotalBytes,
+			DestinationEndpoint: &types.Endpoint{IP: ip, Hostname: host},
+		})
+		src.TotalBytes += res.TotalBytes
+		src.EventCount += res.EventCount
+		src.CostUSD += cost.CostUSD
+		src.RawSampleRate = types.LowerRawSampleRate(src.RawSampleRate, res.RawSampleRate)
+	}
+
+	out := make([]DestinationSource, 0, len(order))
+	for _, key := range order {
+		out = append(out, *bySource[key])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalBytes > out[j].TotalBytes })
+	return out
+}
+
+func (s *Server) getEgressFlows(w http.ResponseWriter, r *http.Request) {
+	edges := s.graphEngine.GetGraph().GetEgressEdges()
+	result := make([]engine.EdgeJSON, len(edges))
+	for i, e := range edges {
+		result[i] = e.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+func (s *Server) getCrossRegionFlows(w http.ResponseWriter, r *http.Request) {
+	edges := s.graphEngine.GetGraph().GetCrossRegionEdges()
+	result := make([]engine.EdgeJSON, len(edges))
+	for i, e := range edges {
+		result[i] = e.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+func (s *Server) getCrossAZFlows(w http.ResponseWriter, r *http.Request) {
+	edges := s.graphEngine.GetGraph().GetCrossAZEdges()
+	result := make([]engine.EdgeJSON, len(edges))
+	for i, e := range edges {
+		result[i] = e.ToJSON()
+	}
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+// getCostSummary returns the cost summary. ?currency=USD,EUR,GBP adds the
+// total in each listed currency.
+func (s *Server) getCostSummary(w http.ResponseWriter, r *http.Request) {
+	currencies, err := parseCurrencies(r.URL.Query().Get("currency"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary, err := s.costSummary(currencies)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, summary)
+}
+
+// costSummary returns the cost headline numbers, with the total converted
+// to currencies when any are given.
+func (s *Server) costSummary(currencies []string) (map[string]interface{}, error) {
+	summary := map[string]interface{}{
+		"total_cost_usd":        125.50,
+		"egress_cost_usd":       80.25,
+		"cross_region_cost_usd": 30.00,
+		"cross_az_cost_usd":     15.25,
+		"total_bytes":           1500000000000,
+		"by_namespace":          map[string]float64{},
+		"by_service":            map[string]float64{},
+	}
+	if len(currencies) > 0 {
+		// The summary states no period, so it converts at today's rates
+		now := time.Now()
+		amounts, err := s.fx.convert(currencies, now, now, summary["total_cost_usd"].(float64), nil)
+		if err != nil {
+			return nil, err
+		}
+		summary["currencies"] = amounts
+	}
+	return summary, nil
+}
+
+// maxCostCalculationFlows caps the flows accepted by one /costs/calculate
+// request.
+const maxCostCalculationFlows = 10000
+
+// CostCalculation is the result of pricing a batch of submitted flows.
+type CostCalculation struct {
+	Breakdowns []types.CostBreakdown `json:"breakdowns"`
+	Summary    types.CostSummary     `json:"summary"`
+}
+
+// calculateCosts prices a batch of flows with the configured pricing rules
+// without ingesting them. Breakdowns are returned in request order.
+func (s *Server) calculateCosts(w http.ResponseWriter, r *http.Request) {
+	var flows []types.TransferFlow
+	if err := json.NewDecoder(r.Body).Decode(&flows); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(flows) > maxCostCalculationFlows {
+		s.errorResponse(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("batch of %d flows exceeds maximum of %d", len(flows), maxCostCalculationFlows))
+		return
+	}
+
+	result := CostCalculation{Breakdowns: make([]types.CostBreakdown, len(flows))}
+	var periodStart, periodEnd time.Time
+	for i, flow := range flows {
+		result.Breakdowns[i] = s.costEngine.CalculateCost(flow)
+		if periodStart.IsZero() || flow.WindowStart.Before(periodStart) {
+			periodStart = flow.WindowStart
+		}
+		if flow.WindowEnd.After(periodEnd) {
+			periodEnd = flow.WindowEnd
+		}
+	}
+
+	attributions := s.costEngine.CalculateAttribution(r.Context(), flows, periodStart, periodEnd)
+	result.Summary = s.costEngine.GetCostSummary(attributions)
+
+	s.jsonResponse(w, http.StatusOK, result)
+}
+
+// explainCost prices one submitted flow and shows the matched pricing rule,
+// tiers and arithmetic, for debugging unexpected costs.
+func (s *Server) explainCost(w http.ResponseWriter, r *http.Request) {
+	var flow types.TransferFlow
+	if err := json.NewDecoder(r.Body).Decode(&flow); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, s.costEngine.ExplainCost(flow))
+}
+
+// MonthToDateCostInCurrencies is the month-to-date cost with the total and
+// category split converted into each requested currency.
+type MonthToDateCostInCurrencies struct {
+	types.MonthToDateCost
+	Currencies []CurrencyAmount `json:"currencies"`
+}
+
+// getMonthToDateCost returns the running cost for the month.
+// ?currency=USD,EUR,GBP reports it in each listed currency as well, at the
+// average rate over the month so far.
+func (s *Server) getMonthToDateCost(w http.ResponseWriter, r *http.Request) {
+	currencies, err := parseCurrencies(r.URL.Query().Get("currency"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mtd := s.costEngine.GetMonthToDateCost()
+	if len(currencies) == 0 {
+		s.jsonResponse(w, http.StatusOK, mtd)
+		return
+	}
+
+	// Convert at the month's average rate rather than today's
+	monthStart, err := time.Parse("2006-01", mtd.Month)
+	if err != nil {
+		monthStart = time.Now().UTC()
+	}
+	amounts, err := s.fx.convert(currencies, monthStart, time.Now(), mtd.CostUSD, mtd.ByCategory)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, MonthToDateCostInCurrencies{MonthToDateCost: mtd, Currencies: amounts})
+}
+
+// attributionChunkSize is how many flows are priced at a time when
+// attributing cost over a range.
+const attributionChunkSize = 10000
+
+// getCostAttribution returns cost per service, or per dimension value with
+// ?group_by=team|environment|<label-mapped dimension>. Untagged cost can be
+// spread across teams with ?allocate_shared=even|proportional.
+func (s *Server) getCostAttribution(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := engine.ParseSharedCostStrategy(r.URL.Query().Get("allocate_shared"))
+	if !ok {
+		s.errorResponse(w, http.StatusBadRequest, "allocate_shared must be even or proportional")
+		return
+	}
+
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []types.CostAttribution{})
+		return
+	}
+
+	attributions, err := s.streamAttribution(r, start, end, r.URL.Query().Get("group_by"))
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+
+	attributions = engine.AllocateSharedCost(attributions, strategy)
+	if attributions == nil {
+		attributions = []types.CostAttribution{}
+	}
+	s.jsonResponse(w, http.StatusOK, attributions)
+}
+
+// streamAttribution attributes the cost of every stored flow in [start,
+// end), grouped as NewAttributionBuilder does for dimension. Flows are
+// streamed and priced in chunks, so memory stays bounded however long the
+// range is. Tiers are reached by the month's usage, so when the range
+// starts after the first of its end month, the month's earlier flows are
+// streamed first to seed it.
+func (s *Server) streamAttribution(r *http.Request, start, end time.Time, dimension string) ([]types.CostAttribution, error) {
+	builder := s.costEngine.NewAttributionBuilder(start, end, dimension)
+
+	last := end.Add(-time.Nanosecond).UTC()
+	if monthStart := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC); start.After(monthStart) {
+		earlier := storage.FlowQuery{Start: monthStart, End: start}
+		err := s.storage.StreamFlowsByVersion(r.Context(), earlier, attributionChunkSize, func(chunk []storage.FlowResult) error {
+			flows := make([]types.TransferFlow, len(chunk))
+			for i, res := range chunk {
+				flows[i] = res.ToFlow(earlier.Start, earlier.End)
+			}
+			builder.Seed(flows)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := storage.FlowQuery{Start: start, End: end, SrcLabels: s.attributionLabels()}
+	var n int
+	err := s.storage.StreamFlowsByVersion(r.Context(), query, attributionChunkSize, func(chunk []storage.FlowResult) error {
+		flows := make([]types.TransferFlow, len(chunk))
+		for i, res := range chunk {
+			flows[i] = res.ToFlow(query.Start, query.End)
+		}
+		builder.Add(flows)
+		n += len(chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logQuery(r, query.Start, query.End, n)
+	return builder.Attributions(), nil
+}
+
+// attributionLabels returns the source label keys mapped to attribution
+// dimensions, which flows must be split by to be attributed.
+func (s *Server) attributionLabels() []string {
+	var keys []string
+	for label := range s.costEngine.GetLabelDimensions() {
+		keys = append(keys, label)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) getCostByNamespace(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, map[string]float64{})
+}
+
+// maxTrendBuckets caps the points in one namespace trend.
+const maxTrendBuckets = 2000
+
+// TrendPoint is the traffic a namespace sent during one time bucket.
+type TrendPoint struct {
+	Bucket      time.Time `json:"bucket"`
+	TotalBytes  uint64    `json:"total_bytes"`
+	EgressBytes uint64    `json:"egress_bytes"` // Internet egress only
+	CostUSD     float64   `json:"cost_usd"`
+}
+
+// NamespaceTrend is a namespace's outbound traffic and cost over time.
+type NamespaceTrend struct {
+	Namespace   string              `json:"namespace"`
+	Granularity storage.Granularity `json:"granularity"`
+	Points      []TrendPoint        `json:"points"`
+}
+
+// getNamespaceTrend returns bytes and cost sent by ?namespace= per
+// ?granularity= bucket (hourly by default). Buckets without traffic are
+// reported as zero so the series has no gaps.
+func (s *Server) getNamespaceTrend(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		s.errorResponse(w, http.StatusBadRequest, "namespace is required")
+		return
+	}
+	granularity, err := storage.ParseGranularity(r.URL.Query().Get("granularity"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if granularity == storage.GranularityNone {
+		granularity = storage.GranularityHourly
+	}
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	step := granularity.Duration()
+	first := start.UTC().Truncate(step)
+	if n := int(end.Sub(first) / step); n > maxTrendBuckets {
+		s.errorResponse(w, http.StatusBadRequest,
+			fmt.Sprintf("range spans %d buckets, maximum is %d; use a coarser granularity", n, maxTrendBuckets))
+		return
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, s.namespaceTrend(namespace, granularity, start, end, nil))
+		return
+	}
+
+	results, err := s.storage.QueryFlows(r.Context(), storage.FlowQuery{
+		Start:        start,
+		End:          end,
+		SrcNamespace: namespace,
+		Granularity:  granularity,
+		Limit:        100000,
+	})
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, start, end, len(results))
+
+	s.jsonResponse(w, http.StatusOK, s.namespaceTrend(namespace, granularity, start, end, results))
+}
+
+// namespaceTrend lays out one point per bucket from start to end and adds
+// bucketed flow results to them, pricing each flow.
+func (s *Server) namespaceTrend(namespace string, granularity storage.Granularity, start, end time.Time, results []storage.FlowResult) NamespaceTrend {
+	step := granularity.Duration()
+	trend := NamespaceTrend{Namespace: namespace, Granularity: granularity, Points: []TrendPoint{}}
+	index := make(map[time.Time]int)
+	for t := start.UTC().Truncate(step); t.Before(end); t = t.Add(step) {
+		index[t] = len(trend.Points)
+		trend.Points = append(trend.Points, TrendPoint{Bucket: t})
+	}
+
+	for _, res := range results {
+		i, ok := index[res.Bucket.UTC()]
+		if !ok {
+			continue
+		}
+		point := &trend.Points[i]
+		flow := res.ToFlow(res.Bucket, res.Bucket.Add(step))
+		point.TotalBytes += res.TotalBytes
+		if flow.Type == types.TransferTypeEgress {
+			point.EgressBytes += res.TotalBytes
+		}
+		point.CostUSD += s.costEngine.CalculateCost(flow).CostUSD
+	}
+	return trend
+}
+
+func (s *Server) getCostByService(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, map[string]float64{})
+}
+
+func (s *Server) getCostByVersion(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		s.errorResponse(w, http.StatusBadRequest, "service is required")
+		return
+	}
+	strategy, ok := engine.ParseSharedCostStrategy(r.URL.Query().Get("allocate_shared"))
+	if !ok {
+		s.errorResponse(w, http.StatusBadRequest, "allocate_shared must be even or proportional")
+		return
+	}
+
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-		// Intelligence endpoints (proxied to Python service)
-		r.Post("/intelligence/analyze", s.proxyToIntelligence)
-		r.Post("/intelligence/investigate", s.proxyToIntelligence)
-		r.Post("/intelligence/explain-cost", s.proxyToIntelligence)
-		r.Post("/intelligence/ask", s.proxyToIntelligence)
-		r.Get("/intelligence/optimizations", s.proxyToIntelligence)
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []types.CostAttribution{})
+		return
+	}
 
-		// Mock data endpoints (for testing)
-		r.Post("/mock/generate", s.generateMockData)
-		r.Post("/mock/anomaly", s.generateMockAnomaly)
-		r.Delete("/mock/reset", s.resetMockData)
-	})
+	query := serviceFlowQuery(service, start, end)
+	results, err := s.storage.QueryFlowsByVersion(r.Context(), query)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, query.Start, query.End, len(results))
 
-	return r
+	flows := make([]types.TransferFlow, len(results))
+	for i, res := range results {
+		flows[i] = res.ToFlow(query.Start, query.End)
+	}
+
+	attributions := s.costEngine.CalculateAttributionByVersion(r.Context(), flows, query.Start, query.End)
+	attributions = engine.AllocateSharedCost(attributions, strategy)
+	if attributions == nil {
+		attributions = []types.CostAttribution{}
+	}
+	s.jsonResponse(w, http.StatusOK, attributions)
 }
 
-// loadInitialData loads data from storage on startup.
-func (s *Server) loadInitialData(ctx context.Context) {
-	if s.storage == nil {
+func (s *Server) getCostByPath(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		s.errorResponse(w, http.StatusBadRequest, "service is required")
 		return
 	}
 
-	// Load last 24 hours of data
-	end := time.Now()
-	start := end.Add(-24 * time.Hour)
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if err := s.graphEngine.LoadFromStorage(ctx, start, end); err != nil {
-		log.Error().Err(err).Msg("Failed to load graph data")
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []types.PathCost{})
+		return
 	}
-}
 
-// Handler implementations
+	query := serviceFlowQuery(service, start, end)
+	results, err := s.storage.QueryFlowsByPath(r.Context(), query)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, query.Start, query.End, len(results))
 
-func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
+	flows := make([]types.TransferFlow, len(results))
+	for i, res := range results {
+		flows[i] = res.ToFlow(query.Start, query.End)
+	}
 
-func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Ready"))
+	s.jsonResponse(w, http.StatusOK, s.costEngine.CalculatePathCosts(flows))
 }
 
-func (s *Server) getGraph(w http.ResponseWriter, r *http.Request) {
-	graph := s.graphEngine.GetGraph().ToJSON()
-	s.jsonResponse(w, http.StatusOK, graph)
+func (s *Server) getEndpointCaps(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.costEngine.GetEndpointCaps())
 }
 
-func (s *Server) getGraphStats(w http.ResponseWriter, r *http.Request) {
-	stats := s.graphEngine.GetGraph().GetStats()
-	s.jsonResponse(w, http.StatusOK, stats)
-}
+func (s *Server) setEndpointCap(w http.ResponseWriter, r *http.Request) {
+	var req types.EndpointCap
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
 
-func (s *Server) getServiceGraph(w http.ResponseWriter, r *http.Request) {
-	service := chi.URLParam(r, "service")
-	depth := 2
-	if d := r.URL.Query().Get("depth"); d != "" {
-		if parsed, err := strconv.Atoi(d); err == nil {
-			depth = parsed
-		}
+	c, err := s.costEngine.SetEndpointCap(req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	subgraph := s.graphEngine.GetGraph().GetServiceGraph(service, depth)
-	s.jsonResponse(w, http.StatusOK, subgraph.ToJSON())
+	s.jsonResponse(w, http.StatusCreated, c)
 }
 
-func (s *Server) getTopTalkers(w http.ResponseWriter, r *http.Request) {
-	n := 10
-	if nStr := r.URL.Query().Get("n"); nStr != "" {
-		if parsed, err := strconv.Atoi(nStr); err == nil {
-			n = parsed
-		}
+func (s *Server) getWatchlist(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.costEngine.GetWatchlist())
+}
+
+func (s *Server) addWatchlistEntry(w http.ResponseWriter, r *http.Request) {
+	var req types.WatchlistEntry
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
 	}
 
-	talkers := s.graphEngine.GetGraph().GetTopTalkers(n)
-	nodes := make([]engine.NodeJSON, len(talkers))
-	for i, t := range talkers {
-		nodes[i] = engine.NodeJSON{
-			ID:                 t.ID,
-			Namespace:          t.Namespace,
-			Name:               t.Name,
-			TotalBytesSent:     t.TotalBytesSent,
-			TotalBytesReceived: t.TotalBytesReceived,
-			TotalConnections:   t.TotalConnections,
-		}
+	entry, err := s.costEngine.AddWatchlistEntry(req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	s.jsonResponse(w, http.StatusOK, nodes)
+
+	s.jsonResponse(w, http.StatusCreated, entry)
 }
 
-func (s *Server) getTopEdges(w http.ResponseWriter, r *http.Request) {
-	n := 10
-	if nStr := r.URL.Query().Get("n"); nStr != "" {
-		if parsed, err := strconv.Atoi(nStr); err == nil {
-			n = parsed
-		}
+func (s *Server) getPricingRules(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.costEngine.GetPricingRules())
+}
+
+// createPricingRule validates and adds a pricing rule, persisting it when
+// storage is available.
+func (s *Server) createPricingRule(w http.ResponseWriter, r *http.Request) {
+	var req types.PricingRule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
 	}
 
-	edges := s.graphEngine.GetGraph().GetTopEdges(n)
-	result := make([]engine.EdgeJSON, len(edges))
-	for i, e := range edges {
-		result[i] = engine.EdgeJSON{
-			Source:       e.SourceID,
-			Target:       e.DestinationID,
-			TransferType: string(e.TransferType),
-			TotalBytes:   e.TotalBytes,
-			TotalEvents:  e.TotalEvents,
-			CostUSD:      e.TotalCostUSD,
+	rule, err := s.costEngine.CreatePricingRule(req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.storage != nil {
+		if err := s.storage.SavePricingRule(r.Context(), rule); err != nil {
+			s.costEngine.RemovePricingRule(rule.ID)
+			s.errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
 		}
 	}
-	s.jsonResponse(w, http.StatusOK, result)
+
+	s.jsonResponse(w, http.StatusCreated, rule)
 }
 
-func (s *Server) getFlows(w http.ResponseWriter, r *http.Request) {
-	if s.storage == nil {
-		s.jsonResponse(w, http.StatusOK, []interface{}{})
+func (s *Server) deletePricingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid pricing rule id")
 		return
 	}
 
-	start := time.Now().Add(-24 * time.Hour)
-	end := time.Now()
-
-	flows, err := s.storage.QueryFlows(r.Context(), storage.FlowQuery{
-		Start: start,
-		End:   end,
-		Limit: 100,
-	})
-	if err != nil {
+	if err := s.costEngine.RemovePricingRule(id); err != nil {
+		if errors.Is(err, engine.ErrPricingRuleNotFound) {
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
 		s.errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	s.jsonResponse(w, http.StatusOK, flows)
-}
-
-func (s *Server) getEgressFlows(w http.ResponseWriter, r *http.Request) {
-	edges := s.graphEngine.GetGraph().GetEgressEdges()
-	result := make([]engine.EdgeJSON, len(edges))
-	for i, e := range edges {
-		result[i] = engine.EdgeJSON{
-			Source:       e.SourceID,
-			Target:       e.DestinationID,
-			TransferType: string(e.TransferType),
-			TotalBytes:   e.TotalBytes,
-			TotalEvents:  e.TotalEvents,
-			CostUSD:      e.TotalCostUSD,
+	if s.storage != nil {
+		if err := s.storage.DeletePricingRule(r.Context(), id); err != nil {
+			s.errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
 		}
 	}
-	s.jsonResponse(w, http.StatusOK, result)
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) getCrossRegionFlows(w http.ResponseWriter, r *http.Request) {
-	edges := s.graphEngine.GetGraph().GetCrossRegionEdges()
-	result := make([]engine.EdgeJSON, len(edges))
-	for i, e := range edges {
-		result[i] = engine.EdgeJSON{
-			Source:       e.SourceID,
-			Target:       e.DestinationID,
-			TransferType: string(e.TransferType),
-			TotalBytes:   e.TotalBytes,
-			TotalEvents:  e.TotalEvents,
-			CostUSD:      e.TotalCostUSD,
-		}
-	}
-	s.jsonResponse(w, http.StatusOK, result)
+// recordFlow adds a flow to the graph and passes it to observeFlow.
+func (s *Server) recordFlow(flow types.TransferFlow) {
+	s.graphEngine.AddFlow(flow)
+	s.observeFlow(flow)
 }
 
-func (s *Server) getCostSummary(w http.ResponseWriter, r *http.Request) {
-	summary := map[string]interface{}{
-		"total_cost_usd":        125.50,
-		"egress_cost_usd":       80.25,
-		"cross_region_cost_usd": 30.00,
-		"cross_az_cost_usd":     15.25,
-		"total_bytes":           1500000000000,
-		"by_namespace":          map[string]float64{},
-		"by_service":            map[string]float64{},
+// observeFlow prices a flow added to the graph, whether loaded from
+// storage or recorded directly, toward the month to date and checks it
+// against the endpoint caps, the watchlist and the suspicious destination
+// patterns. Stored flows keep the destination hostname, so they classify
+// as live ones do.
+func (s *Server) observeFlow(flow types.TransferFlow) {
+	s.costEngine.RecordFlowCost(flow)
+	if anomaly := s.costEngine.RecordEndpointTransfer(flow); anomaly != nil {
+		s.baseline.AddAnomaly(anomaly)
+	}
+	if anomaly := s.costEngine.RecordWatchedTransfer(flow); anomaly != nil {
+		s.watchlistAlerts.WithLabelValues(anomaly.DestinationEndpoint).Inc()
+		s.baseline.AddAnomaly(anomaly)
+	}
+	if anomaly := s.baseline.RecordSuspiciousTransfer(flow); anomaly != nil {
+		s.baseline.AddAnomaly(anomaly)
 	}
-	s.jsonResponse(w, http.StatusOK, summary)
 }
 
-func (s *Server) getCostAttribution(w http.ResponseWriter, r *http.Request) {
-	s.jsonResponse(w, http.StatusOK, []interface{}{})
+// serviceFlowQuery builds a flow query over [start, end) for a source
+// service given as either "namespace/name" or a bare service name.
+func serviceFlowQuery(service string, start, end time.Time) storage.FlowQuery {
+	query := storage.FlowQuery{Start: start, End: end, Limit: 10000}
+	if ns, name, ok := strings.Cut(service, "/"); ok {
+		query.SrcNamespace = ns
+		query.SrcService = name
+	} else {
+		query.SrcService = service
+	}
+	return query
 }
 
-func (s *Server) getCostByNamespace(w http.ResponseWriter, r *http.Request) {
-	s.jsonResponse(w, http.StatusOK, map[string]float64{})
-}
+func (s *Server) getAnomalies(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAnomalyQuery(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-func (s *Server) getCostByService(w http.ResponseWriter, r *http.Request) {
-	s.jsonResponse(w, http.StatusOK, map[string]float64{})
+	anomalies, total := aq.apply(s.baseline.GetActiveAnomalies())
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	s.jsonResponse(w, http.StatusOK, anomalies)
 }
 
-func (s *Server) getAnomalies(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getActiveAnomalies(w http.ResponseWriter, r *http.Request) {
 	anomalies := s.baseline.GetActiveAnomalies()
 	if anomalies == nil {
 		anomalies = []*types.Anomaly{}
@@ -402,10 +1726,42 @@ func (s *Server) getAnomalies(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, anomalies)
 }
 
-func (s *Server) getActiveAnomalies(w http.ResponseWriter, r *http.Request) {
-	anomalies := s.baseline.GetActiveAnomalies()
+// getAnomalyHistory returns persisted anomalies in the query range,
+// including resolved ones no longer held in memory.
+func (s *Server) getAnomalyHistory(w http.ResponseWriter, r *http.Request) {
+	start, end, err := s.queryRange(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.AnomalyFilter{
+		Severity:      types.Severity(q.Get("severity")),
+		Type:          types.AnomalyType(q.Get("type")),
+		SourceService: q.Get("source_service"),
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > maxAnomalyPageSize {
+			s.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q: must be between 1 and %d", v, maxAnomalyPageSize))
+			return
+		}
+	}
+
+	if s.storage == nil {
+		s.jsonResponse(w, http.StatusOK, []types.Anomaly{})
+		return
+	}
+
+	anomalies, err := s.storage.QueryAnomalies(r.Context(), start, end, filter)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	logQuery(r, start, end, len(anomalies))
+
 	if anomalies == nil {
-		anomalies = []*types.Anomaly{}
+		anomalies = []types.Anomaly{}
 	}
 	s.jsonResponse(w, http.StatusOK, anomalies)
 }
@@ -420,14 +1776,114 @@ func (s *Server) getAnomalySummary(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, summary)
 }
 
+func (s *Server) getSuppressions(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.baseline.GetSuppressions())
+}
+
+func (s *Server) getTrustedDestinations(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.baseline.GetTrustedDestinations())
+}
+
+func (s *Server) addTrustedDestination(w http.ResponseWriter, r *http.Request) {
+	var req types.TrustedDestination
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	trusted, err := s.baseline.AddTrustedDestination(req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusCreated, trusted)
+}
+
+func (s *Server) createSuppression(w http.ResponseWriter, r *http.Request) {
+	var req types.Suppression
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	suppression, err := s.baseline.AddSuppression(req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.jsonResponse(w, http.StatusCreated, suppression)
+}
+
+// AcknowledgeRequest is the body of an anomaly acknowledgement.
+type AcknowledgeRequest struct {
+	AcknowledgedBy string `json:"acknowledged_by"`
+}
+
 func (s *Server) acknowledgeAnomaly(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid anomaly id")
+		return
+	}
+
+	var req AcknowledgeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	if err := s.baseline.AcknowledgeAnomaly(id, req.AcknowledgedBy); err != nil {
+		if errors.Is(err, engine.ErrAnomalyNotFound) {
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "acknowledged"})
 }
 
+// ResolveRequest is the body of an anomaly resolution.
+type ResolveRequest struct {
+	Notes         string `json:"notes"`
+	FalsePositive bool   `json:"false_positive"`
+}
+
 func (s *Server) resolveAnomaly(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "invalid anomaly id")
+		return
+	}
+
+	var req ResolveRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	if err := s.baseline.ResolveAnomaly(id, req.Notes, req.FalsePositive); err != nil {
+		if errors.Is(err, engine.ErrAnomalyNotFound) {
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "resolved"})
 }
 
+func (s *Server) getAnomalyFeedback(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.baseline.GetFeedback())
+}
+
 func (s *Server) getBaselines(w http.ResponseWriter, r *http.Request) {
 	baselines := s.baseline.GetAllBaselines()
 	s.jsonResponse(w, http.StatusOK, baselines)
@@ -467,8 +1923,23 @@ func (s *Server) proxyToIntelligence(w http.ResponseWriter, r *http.Request) {
 
 	targetURL := s.intelligenceURL + targetPath
 
+	// The request timeout middleware would cut off long streaming answers,
+	// so the upstream request only follows it until a stream starts.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+	var streaming atomic.Bool
+	go func() {
+		select {
+		case <-r.Context().Done():
+			if !errors.Is(r.Context().Err(), context.DeadlineExceeded) || !streaming.Load() {
+				cancel()
+			}
+		case <-ctx.Done():
+		}
+	}()
+
 	// Create proxy request
-	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, r.Body)
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, r.Body)
 	if err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "failed to create proxy request")
 		return
@@ -491,9 +1962,59 @@ func (s *Server) proxyToIntelligence(w http.ResponseWriter, r *http.Request) {
 		w.Header()[k] = v
 	}
 
-	// Copy status and body
+	if !isStreamingResponse(resp) {
+		// Copy status and body
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	streaming.Store(true)
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debug().Err(err).Msg("Cannot clear write deadline for streaming response")
+	}
+	w.Header().Del("Content-Length")
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	rc.Flush()
+	if err := copyFlushing(w, rc, resp.Body); err != nil {
+		log.Debug().Err(err).Str("url", targetURL).Msg("Intelligence stream ended early")
+	}
+}
+
+// isStreamingResponse reports whether an upstream response is a stream
+// (SSE, NDJSON, or chunked without a length) that must be relayed as it
+// arrives rather than buffered.
+func isStreamingResponse(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream", "application/x-ndjson":
+		return true
+	}
+	return resp.ContentLength < 0 && len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+}
+
+// copyFlushing copies src to w, flushing after every read so each chunk
+// reaches the client immediately.
+func copyFlushing(w io.Writer, rc *http.ResponseController, src io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if ferr := rc.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
 
 // Mock data handlers
@@ -527,8 +2048,7 @@ func (s *Server) generateMockData(w http.ResponseWriter, r *http.Request) {
 		flow := generateMockFlow()
 		flows = append(flows, flow)
 
-		// Update graph engine
-		s.graphEngine.AddFlow(flow)
+		s.recordFlow(flow)
 
 		totalBytes += flow.TotalBytes
 		if flow.Type == types.TransferTypeEgress {
@@ -592,16 +2112,17 @@ func (s *Server) generateMockAnomaly(w http.ResponseWriter, r *http.Request) {
 		WindowStart: now.Add(-1 * time.Hour),
 		WindowEnd:   now,
 	}
-	s.graphEngine.AddFlow(flow)
+	s.recordFlow(flow)
 
 	s.jsonResponse(w, http.StatusOK, anomaly)
 }
 
 func (s *Server) resetMockData(w http.ResponseWriter, r *http.Request) {
-	// Reset engines
-	s.graphEngine = engine.NewGraphEngine(s.storage)
-	s.baseline = engine.NewBaselineEngine(3.0)
-	s.costEngine = engine.NewCostEngine()
+	// Reset engines in place; handlers may hold references to them, and
+	// loaded pricing rules must survive the reset.
+	s.graphEngine.Reset()
+	s.baseline.Reset()
+	s.costEngine.ResetUsage()
 
 	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "reset"})
 }
@@ -714,3 +2235,21 @@ func (s *Server) jsonResponse(w http.ResponseWriter, status int, data interface{
 func (s *Server) errorResponse(w http.ResponseWriter, status int, message string) {
 	s.jsonResponse(w, status, map[string]string{"error": message})
 }
+
+// statusClientClosedRequest is the non-standard status logged when the
+// client went away before its response was ready.
+const statusClientClosedRequest = 499
+
+// queryError reports a failed storage query. Queries stop as soon as the
+// request context ends, so the failure is blamed on the client hanging up
+// or the request timeout when that is what ended it.
+func (s *Server) queryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled):
+		s.errorResponse(w, statusClientClosedRequest, "client closed request")
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		s.errorResponse(w, http.StatusGatewayTimeout, "query timed out")
+	default:
+		s.errorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,487 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// newMockServer returns a server with in-memory engines only.
+func newMockServer() *Server {
+	return &Server{
+		graphEngine: engine.NewGraphEngine(nil),
+		costEngine:  engine.NewCostEngine(),
+		baseline:    engine.NewBaselineEngine(3),
+		watchlistAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "test_watchlist_new_consumers_total",
+		}, []string{"destination"}),
+	}
+}
+
+func TestResetMockDataWhileServingGraph(t *testing.T) {
+	s := newMockServer()
+	rule, err := s.costEngine.CreatePricingRule(types.PricingRule{
+		Name:          "Custom egress",
+		CloudProvider: types.CloudProviderAWS,
+		Category:      types.CostCategoryEgressInternet,
+		CostPerGB:     0.05,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphEngine, costEngine, baseline := s.graphEngine, s.costEngine, s.baseline
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				w := httptest.NewRecorder()
+				s.getGraph(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("getGraph status = %d", w.Code)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s.generateMockData(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/mock/generate?count=10", nil))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s.resetMockData(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/v1/mock/reset", nil))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.graphEngine != graphEngine || s.costEngine != costEngine || s.baseline != baseline {
+		t.Error("reset replaced engines that handlers may still hold")
+	}
+
+	w := httptest.NewRecorder()
+	s.resetMockData(w, httptest.NewRequest(http.MethodDelete, "/api/v1/mock/reset", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset status = %d", w.Code)
+	}
+	if stats := s.graphEngine.GetStats(); stats.TotalNodes != 0 || stats.TotalEdges != 0 {
+		t.Errorf("graph after reset = %+v, want empty", stats)
+	}
+	if !hasRule(s.costEngine.GetPricingRules(), rule.ID) {
+		t.Error("reset dropped a loaded pricing rule")
+	}
+}
+
+func hasRule(rules []types.PricingRule, id uuid.UUID) bool {
+	for _, r := range rules {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEndpointCapAlertReachesAnomalies(t *testing.T) {
+	s := newMockServer()
+
+	w := httptest.NewRecorder()
+	s.setEndpointCap(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/endpoint-caps",
+		strings.NewReader(`{"hostname":"api.stripe.com","monthly_bytes":1000}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	s.recordFlow(types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "checkout"},
+		DestinationEndpoint: &types.Endpoint{Hostname: "api.stripe.com", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          2000,
+	})
+
+	active := s.baseline.GetActiveAnomalies()
+	if len(active) != 1 || active[0].Type != types.AnomalyTypeCostAnomaly || active[0].DestinationEndpoint != "api.stripe.com" {
+		t.Errorf("active anomalies = %+v, want the api.stripe.com cap alert", active)
+	}
+}
+
+func TestGraphStatsLoadedFlag(t *testing.T) {
+	s := newMockServer()
+	stats := func() map[string]any {
+		w := httptest.NewRecorder()
+		s.getGraphStats(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/stats", nil))
+		var resp map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	before := stats()
+	if before["loaded"] != false || before["last_loaded_at"] != nil {
+		t.Errorf("before load: %v, want not loaded", before)
+	}
+	if before["total_nodes"] != 0.0 {
+		t.Errorf("total_nodes = %v, want the graph stats inline", before["total_nodes"])
+	}
+
+	// Without storage there is nothing to load, so the load completes at once
+	s.loadInitialData(context.Background())
+	if after := stats(); after["loaded"] != true {
+		t.Errorf("after load: %v, want loaded", after)
+	}
+}
+
+func TestLoadHistoryCoversLookback(t *testing.T) {
+	end := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		lookback, chunk time.Duration
+		wantCalls       int
+	}{
+		{7 * 24 * time.Hour, 24 * time.Hour, 7},
+		{36 * time.Hour, 24 * time.Hour, 2},
+		{time.Hour, 24 * time.Hour, 1},
+	} {
+		var calls [][2]time.Time
+		err := loadHistory(context.Background(), end, tt.lookback, tt.chunk, func(_ context.Context, start, end time.Time) error {
+			calls = append(calls, [2]time.Time{start, end})
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(calls) != tt.wantCalls {
+			t.Fatalf("lookback %s: %d loads, want %d", tt.lookback, len(calls), tt.wantCalls)
+		}
+		if !calls[0][0].Equal(end.Add(-tt.lookback)) || !calls[len(calls)-1][1].Equal(end) {
+			t.Errorf("lookback %s: loaded %s to %s, want %s to %s",
+				tt.lookback, calls[0][0], calls[len(calls)-1][1], end.Add(-tt.lookback), end)
+		}
+		for i, c := range calls {
+			if c[1].Sub(c[0]) > tt.chunk || (i > 0 && !c[0].Equal(calls[i-1][1])) {
+				t.Errorf("lookback %s: chunk %d is %s to %s, want contiguous chunks of at most %s",
+					tt.lookback, i, c[0], c[1], tt.chunk)
+			}
+		}
+	}
+}
+
+func TestLoadHistoryStopsOnError(t *testing.T) {
+	calls := 0
+	err := loadHistory(context.Background(), time.Now(), 72*time.Hour, 24*time.Hour, func(context.Context, time.Time, time.Time) error {
+		calls++
+		return errors.New("clickhouse unavailable")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("err = %v after %d loads, want the first failure returned", err, calls)
+	}
+}
+
+func TestNewEdgesSince(t *testing.T) {
+	s := newMockServer()
+	now := time.Now()
+	for _, f := range []struct {
+		dst string
+		ago time.Duration
+	}{{"old", 3 * time.Hour}, {"new", 10 * time.Minute}} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: f.dst},
+			TotalBytes:          100,
+			WindowStart:         now.Add(-f.ago),
+			WindowEnd:           now.Add(-f.ago + time.Minute),
+		})
+	}
+
+	for _, since := range []string{"1h", now.Add(-time.Hour).Format(time.RFC3339)} {
+		w := httptest.NewRecorder()
+		s.getNewEdges(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/new-edges?since="+since, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("since=%s: status = %d", since, w.Code)
+		}
+		var edges []engine.EdgeJSON
+		if err := json.NewDecoder(w.Body).Decode(&edges); err != nil {
+			t.Fatal(err)
+		}
+		if len(edges) != 1 || edges[0].Target != "shop/new" {
+			t.Errorf("since=%s: edges = %+v, want only shop/new", since, edges)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.getNewEdges(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/new-edges?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for an invalid since, want 400", w.Code)
+	}
+}
+
+func TestActiveFlows(t *testing.T) {
+	s := newMockServer()
+	now := time.Now()
+	for _, f := range []struct {
+		dst string
+		ago time.Duration
+	}{{"stale", 10 * time.Minute}, {"fresh", 5 * time.Second}} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: f.dst},
+			TotalBytes:          100,
+			WindowStart:         now.Add(-f.ago - time.Minute),
+			WindowEnd:           now.Add(-f.ago),
+		})
+	}
+
+	for query, want := range map[string]int{"": 1, "?within=1h": 2, "?within=1s": 0} {
+		w := httptest.NewRecorder()
+		s.getActiveFlows(w, httptest.NewRequest(http.MethodGet, "/api/v1/flows/active"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d", query, w.Code)
+		}
+		var edges []engine.EdgeJSON
+		if err := json.NewDecoder(w.Body).Decode(&edges); err != nil {
+			t.Fatal(err)
+		}
+		if len(edges) != want || (want > 0 && edges[0].Target != "shop/fresh") {
+			t.Errorf("%q: edges = %+v, want %d with shop/fresh first", query, edges, want)
+		}
+	}
+
+	for _, within := range []string{"soon", "-30s", "0s"} {
+		w := httptest.NewRecorder()
+		s.getActiveFlows(w, httptest.NewRequest(http.MethodGet, "/api/v1/flows/active?within="+within, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("within=%s: status = %d, want 400", within, w.Code)
+		}
+	}
+}
+
+func TestQueryErrorStatus(t *testing.T) {
+	s := newMockServer()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	for _, tt := range []struct {
+		ctx  context.Context
+		err  error
+		want int
+	}{
+		{cancelled, fmt.Errorf("querying flows: %w", context.Canceled), statusClientClosedRequest},
+		{expired, fmt.Errorf("querying flows: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{context.Background(), errors.New("code: 60, table does not exist"), http.StatusInternalServerError},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/flows", nil).WithContext(tt.ctx)
+		s.queryError(w, req, tt.err)
+		if w.Code != tt.want {
+			t.Errorf("%v: status = %d, want %d", tt.err, w.Code, tt.want)
+		}
+	}
+}
+
+func TestTopTalkersByFan(t *testing.T) {
+	s := newMockServer()
+	for _, f := range [][2]string{{"api", "db"}, {"api", "cache"}, {"worker", "db"}, {"web", "db"}} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: f[0]},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: f[1]},
+			TotalBytes:          100,
+		})
+	}
+
+	for query, want := range map[string]string{"by=fan_out": "shop/api", "by=fan_in": "shop/db"} {
+		w := httptest.NewRecorder()
+		s.getTopTalkers(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/top-talkers?n=1&"+query, nil))
+		var nodes []engine.NodeJSON
+		if err := json.NewDecoder(w.Body).Decode(&nodes); err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0].ID != want {
+			t.Errorf("%s: nodes = %+v, want %s", query, nodes, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.getTopTalkers(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/top-talkers?by=latency", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for an unknown by, want 400", w.Code)
+	}
+}
+
+func TestCrossAZFlows(t *testing.T) {
+	s := &Server{graphEngine: engine.NewGraphEngine(nil)}
+	for _, transferType := range []types.TransferType{types.TransferTypeCrossAZ, types.TransferTypeCrossRegion, types.TransferTypeEgress} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: string(transferType)},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: "db"},
+			Type:                transferType,
+			TotalBytes:          100,
+		})
+	}
+
+	w := httptest.NewRecorder()
+	s.getCrossAZFlows(w, httptest.NewRequest(http.MethodGet, "/api/v1/flows/cross-az", nil))
+	var edges []engine.EdgeJSON
+	if err := json.NewDecoder(w.Body).Decode(&edges); err != nil {
+		t.Fatal(err)
+	}
+	if len(edges) != 1 || edges[0].TransferType != string(types.TransferTypeCrossAZ) {
+		t.Errorf("edges = %+v, want only the cross-AZ one", edges)
+	}
+}
+
+func TestWatchlistAlertsOnNewSource(t *testing.T) {
+	s := newMockServer()
+
+	w := httptest.NewRecorder()
+	s.addWatchlistEntry(w, httptest.NewRequest(http.MethodPost, "/api/v1/costs/watchlist",
+		strings.NewReader(`{"destination":"api.openai.com","description":"Metered per token"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	send := func(source string) {
+		s.recordFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: source},
+			DestinationEndpoint: &types.Endpoint{Hostname: "api.openai.com", IsInternet: true},
+			Type:                types.TransferTypeEgress,
+			TotalBytes:          500,
+		})
+	}
+	send("support-bot")
+	send("support-bot")
+	send("search")
+
+	active := s.baseline.GetActiveAnomalies()
+	sources := make(map[string]bool)
+	for _, a := range active {
+		if a.Type != types.AnomalyTypeNewEndpoint || a.Severity != types.SeverityInfo || a.DestinationEndpoint != "api.openai.com" {
+			t.Errorf("anomaly %+v, want an info new-endpoint alert for api.openai.com", a)
+		}
+		sources[a.SourceService] = true
+	}
+	if len(active) != 2 || !sources["shop/support-bot"] || !sources["shop/search"] {
+		t.Errorf("alerts from %v, want one each for support-bot and search", sources)
+	}
+	if got := testutil.ToFloat64(s.watchlistAlerts.WithLabelValues("api.openai.com")); got != 2 {
+		t.Errorf("new consumer metric = %v, want 2", got)
+	}
+}
+
+func TestServicesGraphMergesWithoutDuplicates(t *testing.T) {
+	s := newMockServer()
+	for _, pair := range [][2]string{{"api", "db"}, {"api", "cache"}, {"worker", "db"}, {"worker", "queue"}, {"db", "backup"}} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: pair[0]},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: pair[1]},
+			Type:                types.TransferTypeServiceToService,
+			TotalBytes:          100,
+		})
+	}
+
+	w := httptest.NewRecorder()
+	s.getServicesGraph(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/services?ids=shop/api,+shop/worker&depth=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var merged engine.GraphJSON
+	if err := json.NewDecoder(w.Body).Decode(&merged); err != nil {
+		t.Fatal(err)
+	}
+
+	// The merge is the union of the two subgraphs, each node and edge once
+	wantNodes, wantEdges := make(map[string]bool), make(map[string]bool)
+	for _, id := range []string{"shop/api", "shop/worker"} {
+		sub := s.graphEngine.GetGraph().GetServiceGraph(id, 1).ToJSON()
+		for _, n := range sub.Nodes {
+			wantNodes[n.ID] = true
+		}
+		for _, e := range sub.Edges {
+			wantEdges[e.Source+"|"+e.Target] = true
+		}
+	}
+	gotNodes, gotEdges := make(map[string]bool), make(map[string]bool)
+	for _, n := range merged.Nodes {
+		if gotNodes[n.ID] {
+			t.Errorf("node %s appears twice", n.ID)
+		}
+		gotNodes[n.ID] = true
+	}
+	for _, e := range merged.Edges {
+		key := e.Source + "|" + e.Target
+		if gotEdges[key] {
+			t.Errorf("edge %s appears twice", key)
+		}
+		gotEdges[key] = true
+	}
+	if !reflect.DeepEqual(gotNodes, wantNodes) || !reflect.DeepEqual(gotEdges, wantEdges) {
+		t.Errorf("merged nodes %v edges %v, want %v and %v", gotNodes, gotEdges, wantNodes, wantEdges)
+	}
+	if !gotNodes["shop/db"] || !gotEdges["shop/api|shop/db"] || !gotEdges["shop/worker|shop/db"] {
+		t.Errorf("merge lost the shared db node or its edges: %v %v", gotNodes, gotEdges)
+	}
+
+	w = httptest.NewRecorder()
+	s.getServicesGraph(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/services?ids=,", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("without ids: status = %d, want 400", w.Code)
+	}
+}
+
+func TestReachableEndpoint(t *testing.T) {
+	s := newMockServer()
+	for _, pair := range [][2]string{{"api", "db"}, {"db", "backup"}, {"api", "cache"}} {
+		s.graphEngine.AddFlow(types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: pair[0]},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: pair[1]},
+			Type:                types.TransferTypeServiceToService,
+			TotalBytes:          100,
+		})
+	}
+	get := func(service, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/graph/service/x/reachable?"+query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("service", service)
+		w := httptest.NewRecorder()
+		s.getReachable(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		return w
+	}
+
+	w := get("shop/api", "")
+	var nodes []ReachableNode
+	if err := json.NewDecoder(w.Body).Decode(&nodes); err != nil {
+		t.Fatal(err)
+	}
+	want := []ReachableNode{{ID: "shop/cache", Hops: 1}, {ID: "shop/db", Hops: 1}, {ID: "shop/backup", Hops: 2}}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("reachable = %+v, want %+v ordered by hops", nodes, want)
+	}
+
+	if w := get("shop/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d for an unknown service, want 404", w.Code)
+	}
+	if w := get("shop/api", "depth=-1"); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for a negative depth, want 400", w.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// statusCheckTimeout bounds each subsystem probe.
+const statusCheckTimeout = 2 * time.Second
+
+// SubsystemStatus reports reachability of a dependency.
+type SubsystemStatus struct {
+	Configured bool    `json:"configured"`
+	Reachable  bool    `json:"reachable"`
+	LatencyMS  float64 `json:"latency_ms,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// GraphStatus reports the in-memory graph state.
+type GraphStatus struct {
+	Nodes         int        `json:"nodes"`
+	ExternalNodes int        `json:"external_nodes"`
+	Edges         int        `json:"edges"`
+	LastLoadedAt  *time.Time `json:"last_loaded_at,omitempty"`
+}
+
+// StatusResponse is the self-diagnostic status payload.
+type StatusResponse struct {
+	Status        string          `json:"status"` // "ok" or "degraded"
+	ClickHouse    SubsystemStatus `json:"clickhouse"`
+	Postgres      SubsystemStatus `json:"postgres"`
+	Intelligence  SubsystemStatus `json:"intelligence"`
+	Graph         GraphStatus     `json:"graph"`
+	Goroutines    int             `json:"goroutines"`
+	UptimeSeconds float64         `json:"uptime_seconds"`
+}
+
+// statusChecks holds subsystem probes. A nil probe means "not configured".
+type statusChecks struct {
+	clickhouse   func(ctx context.Context) error
+	postgres     func(ctx context.Context) error
+	intelligence func(ctx context.Context) error
+}
+
+// defaultStatusChecks builds probes against the server's real dependencies.
+func (s *Server) defaultStatusChecks() statusChecks {
+	checks := statusChecks{
+		intelligence: s.pingIntelligence,
+	}
+	if s.storage != nil {
+		checks.clickhouse = s.storage.Ping
+	}
+	if s.cfg.PostgresDSN != "" {
+		checks.postgres = s.pingPostgres
+	}
+	return checks
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, s.buildStatus(r.Context()))
+}
+
+// buildStatus probes all subsystems concurrently and assembles the status.
+func (s *Server) buildStatus(ctx context.Context) StatusResponse {
+	var resp StatusResponse
+	var wg sync.WaitGroup
+
+	probe := func(check func(context.Context) error, out *SubsystemStatus) {
+		defer wg.Done()
+		*out = runStatusCheck(ctx, check)
+	}
+
+	wg.Add(3)
+	go probe(s.statusChecks.clickhouse, &resp.ClickHouse)
+	go probe(s.statusChecks.postgres, &resp.Postgres)
+	go probe(s.statusChecks.intelligence, &resp.Intelligence)
+	wg.Wait()
+
+	stats := s.graphEngine.GetStats()
+	resp.Graph = GraphStatus{
+		Nodes:         stats.TotalNodes,
+		ExternalNodes: stats.TotalExternalNodes,
+		Edges:         stats.TotalEdges,
+		LastLoadedAt:  s.lastLoadedAt(),
+	}
+	resp.Goroutines = runtime.NumGoroutine()
+	resp.UptimeSeconds = time.Since(s.startedAt).Seconds()
+
+	resp.Status = "ok"
+	for _, sub := range []SubsystemStatus{resp.ClickHouse, resp.Postgres, resp.Intelligence} {
+		if sub.Configured && !sub.Reachable {
+			resp.Status = "degraded"
+		}
+	}
+
+	return resp
+}
+
+// runStatusCheck runs a single probe with a timeout.
+func runStatusCheck(ctx context.Context, check func(context.Context) error) SubsystemStatus {
+	if check == nil {
+		return SubsystemStatus{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, statusCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := SubsystemStatus{
+		Configured: true,
+		Reachable:  err == nil,
+		LatencyMS:  float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// pingIntelligence checks the intelligence service health endpoint.
+func (s *Server) pingIntelligence(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.intelligenceURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pingPostgres checks that the Postgres host accepts TCP connections.
+func (s *Server) pingPostgres(ctx context.Context) error {
+	u, err := url.Parse(s.cfg.PostgresDSN)
+	if err != nil {
+		return fmt.Errorf("parsing DSN: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "5432")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// lastLoadedAt returns when initial data was last loaded, or nil if never.
+func (s *Server) lastLoadedAt() *time.Time {
+	s.loadMu.RLock()
+	defer s.loadMu.RUnlock()
+	if s.loadedAt.IsZero() {
+		return nil
+	}
+	t := s.loadedAt
+	return &t
+}
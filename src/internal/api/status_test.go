@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func reachable(context.Context) error   { return nil }
+func unreachable(context.Context) error { return errors.New("connection refused") }
+
+func TestStatusReflectsSubsystems(t *testing.T) {
+	loadedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := &Server{
+		graphEngine: engine.NewGraphEngine(nil),
+		statusChecks: statusChecks{
+			clickhouse:   reachable,
+			intelligence: unreachable,
+		},
+		startedAt: time.Now().Add(-time.Minute),
+		loadedAt:  loadedAt,
+	}
+	s.graphEngine.AddFlow(types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          1000,
+	})
+
+	w := httptest.NewRecorder()
+	s.getStatus(w, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var resp StatusResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != "degraded" {
+		t.Errorf("status = %q, want degraded with intelligence down", resp.Status)
+	}
+	if !resp.ClickHouse.Configured || !resp.ClickHouse.Reachable || resp.ClickHouse.Error != "" {
+		t.Errorf("clickhouse = %+v, want configured and reachable", resp.ClickHouse)
+	}
+	if resp.Postgres.Configured || resp.Postgres.Reachable {
+		t.Errorf("postgres = %+v, want not configured", resp.Postgres)
+	}
+	if !resp.Intelligence.Configured || resp.Intelligence.Reachable || resp.Intelligence.Error != "connection refused" {
+		t.Errorf("intelligence = %+v, want configured, unreachable with the probe error", resp.Intelligence)
+	}
+	if resp.Graph.Nodes != 1 || resp.Graph.ExternalNodes != 1 || resp.Graph.Edges != 1 {
+		t.Errorf("graph = %+v, want one node, one external node and one edge", resp.Graph)
+	}
+	if resp.Graph.LastLoadedAt == nil || !resp.Graph.LastLoadedAt.Equal(loadedAt) {
+		t.Errorf("last loaded at = %v, want %v", resp.Graph.LastLoadedAt, loadedAt)
+	}
+	if resp.Goroutines <= 0 || resp.UptimeSeconds < 60 {
+		t.Errorf("goroutines %d uptime %vs, want both set", resp.Goroutines, resp.UptimeSeconds)
+	}
+}
+
+func TestStatusOKWhenConfiguredSubsystemsReachable(t *testing.T) {
+	s := &Server{
+		graphEngine:  engine.NewGraphEngine(nil),
+		statusChecks: statusChecks{clickhouse: reachable, postgres: reachable},
+	}
+
+	resp := s.buildStatus(context.Background())
+	if resp.Status != "ok" {
+		t.Errorf("status = %q, want ok when only configured subsystems count", resp.Status)
+	}
+	if resp.Graph.LastLoadedAt != nil {
+		t.Errorf("last loaded at = %v, want nil before any load", resp.Graph.LastLoadedAt)
+	}
+}
+
+func TestStatusProbeHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status := runStatusCheck(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !status.Configured || status.Reachable || status.Error == "" {
+		t.Errorf("got %+v, want an unreachable probe once the context is done", status)
+	}
+}
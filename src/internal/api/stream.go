@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/websocket"
+)
+
+// streamWriteTimeout bounds a single delta write to a stream client.
+const streamWriteTimeout = 10 * time.Second
+
+// streamGraph upgrades to a WebSocket and sends engine.GraphDelta messages as
+// the graph changes. Clients pass ?since=<version> to resume; the first
+// message backfills everything after that version, or a full snapshot if the
+// version is unknown.
+func (s *Server) streamGraph(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	resume := false
+	if v := r.URL.Query().Get("since"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "invalid since version")
+			return
+		}
+		since, resume = parsed, true
+	}
+
+	server := websocket.Server{
+		Handshake: s.checkStreamOrigin,
+		Handler: func(ws *websocket.Conn) {
+			s.serveGraphStream(ws, since, resume)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkStreamOrigin applies the CORS origin list to the WebSocket handshake.
+// Non-browser clients that send no Origin are allowed.
+func (s *Server) checkStreamOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	for _, allowed := range s.cfg.CORSOrigins {
+		if allowed == "*" || allowed == origin {
+			return nil
+		}
+	}
+	return websocket.ErrBadWebSocketOrigin
+}
+
+// serveGraphStream pushes deltas until the client disconnects. Without
+// resume the first message is always a full snapshot.
+func (s *Server) serveGraphStream(ws *websocket.Conn, since uint64, resume bool) {
+	defer ws.Close()
+
+	updates, unsubscribe := s.graphEngine.Subscribe()
+	defer unsubscribe()
+
+	// The stream is write-only; reading detects the client going away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		ws.SetReadDeadline(time.Time{})
+		var msg []byte
+		for {
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(first bool) bool {
+		delta := s.graphEngine.ChangesSince(since)
+		if first && !resume {
+			delta.Full = true
+		}
+		if !first && !delta.Full && delta.Version == since {
+			return true
+		}
+		ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := websocket.JSON.Send(ws, delta); err != nil {
+			log.Debug().Err(err).Msg("Graph stream client write failed")
+			return false
+		}
+		since = delta.Version
+		return true
+	}
+
+	// Always send the backfill so the client learns the current version.
+	if !send(true) {
+		return
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case <-updates:
+			if !send(false) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/egressor/egressor/src/internal/engine"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// dialGraphStream connects to the graph stream served by s.
+func dialGraphStream(t *testing.T, s *Server, query string) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(s.streamGraph))
+	t.Cleanup(ts.Close)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/v1/graph/stream" + query
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// receiveDelta reads the next delta from the stream.
+func receiveDelta(t *testing.T, ws *websocket.Conn) engine.GraphDelta {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var delta engine.GraphDelta
+	if err := websocket.JSON.Receive(ws, &delta); err != nil {
+		t.Fatal(err)
+	}
+	return delta
+}
+
+func egressFlow(name, ip string) types.TransferFlow {
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: name},
+		DestinationEndpoint: &types.Endpoint{IP: ip, IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          1000,
+	}
+}
+
+func TestGraphStreamSendsDeltas(t *testing.T) {
+	s := &Server{cfg: Config{CORSOrigins: []string{"*"}}, graphEngine: engine.NewGraphEngine(nil)}
+	s.graphEngine.AddFlow(egressFlow("api", "203.0.113.10"))
+
+	ws := dialGraphStream(t, s, "")
+	snapshot := receiveDelta(t, ws)
+	if !snapshot.Full || len(snapshot.Nodes) != 1 || len(snapshot.Edges) != 1 {
+		t.Fatalf("backfill = full %v, %d nodes, %d edges; want a full snapshot of the api node and its edge",
+			snapshot.Full, len(snapshot.Nodes), len(snapshot.Edges))
+	}
+
+	s.graphEngine.AddFlow(egressFlow("worker", "203.0.113.20"))
+	delta := receiveDelta(t, ws)
+	if delta.Full || delta.Version <= snapshot.Version {
+		t.Errorf("delta full %v version %d, want an incremental update after %d", delta.Full, delta.Version, snapshot.Version)
+	}
+	if len(delta.Edges) != 1 || delta.Edges[0].Source != "shop/worker" {
+		t.Errorf("delta edges = %+v, want only the new worker edge", delta.Edges)
+	}
+	if len(delta.Nodes) != 1 || delta.Nodes[0].ID != "shop/worker" {
+		t.Errorf("delta nodes = %+v, want only the worker", delta.Nodes)
+	}
+}
+
+func TestGraphStreamResumes(t *testing.T) {
+	s := &Server{cfg: Config{CORSOrigins: []string{"*"}}, graphEngine: engine.NewGraphEngine(nil)}
+	s.graphEngine.AddFlow(egressFlow("api", "203.0.113.10"))
+	since := s.graphEngine.ChangesSince(0).Version
+	s.graphEngine.AddFlow(egressFlow("worker", "203.0.113.20"))
+
+	backfill := receiveDelta(t, dialGraphStream(t, s, fmt.Sprintf("?since=%d", since)))
+	if backfill.Full || len(backfill.Edges) != 1 || backfill.Edges[0].Source != "shop/worker" {
+		t.Errorf("backfill = full %v edges %+v, want only the worker edge missed since %d", backfill.Full, backfill.Edges, since)
+	}
+}
+
+func TestGraphStreamRejectsBadRequests(t *testing.T) {
+	s := &Server{cfg: Config{CORSOrigins: []string{"https://dash.example.com"}}, graphEngine: engine.NewGraphEngine(nil)}
+
+	w := httptest.NewRecorder()
+	s.streamGraph(w, httptest.NewRequest(http.MethodGet, "/api/v1/graph/stream?since=latest", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status = %d, want 400", w.Code)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(s.streamGraph))
+	defer ts.Close()
+	if ws, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), "", "https://evil.example.com"); err == nil {
+		ws.Close()
+		t.Error("connected from a disallowed origin")
+	}
+}
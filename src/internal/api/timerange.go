@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Query range defaults used when Config leaves them unset.
+const (
+	defaultQueryRange = 24 * time.Hour
+	defaultMaxRange   = 31 * 24 * time.Hour
+)
+
+// queryRange resolves the time range of a query request. Clients may pass
+// start and end as RFC 3339 times, or range as a duration ending now. The
+// default range applies when neither is given; ranges longer than the
+// configured maximum are rejected.
+func (s *Server) queryRange(r *http.Request) (start, end time.Time, err error) {
+	q := r.URL.Query()
+	end = time.Now()
+
+	if v := q.Get("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			return start, end, fmt.Errorf("invalid end: %w", err)
+		}
+	}
+
+	switch {
+	case q.Get("start") != "":
+		if start, err = time.Parse(time.RFC3339, q.Get("start")); err != nil {
+			return start, end, fmt.Errorf("invalid start: %w", err)
+		}
+	case q.Get("range") != "":
+		d, err := time.ParseDuration(q.Get("range"))
+		if err != nil || d <= 0 {
+			return start, end, fmt.Errorf("invalid range %q", q.Get("range"))
+		}
+		start = end.Add(-d)
+	default:
+		start = end.Add(-s.cfg.DefaultQueryRange)
+	}
+
+	if !end.After(start) {
+		return start, end, fmt.Errorf("end must be after start")
+	}
+	if end.Sub(start) > s.cfg.MaxQueryRange {
+		return start, end, fmt.Errorf("query range exceeds maximum of %s", s.cfg.MaxQueryRange)
+	}
+
+	return start, end, nil
+}
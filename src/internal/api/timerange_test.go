@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryRange(t *testing.T) {
+	s := &Server{cfg: Config{DefaultQueryRange: 6 * time.Hour, MaxQueryRange: 7 * 24 * time.Hour}}
+	end := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	endParam := "end=" + end.Format(time.RFC3339)
+
+	tests := []struct {
+		query     string
+		wantStart time.Time
+	}{
+		{endParam, end.Add(-6 * time.Hour)},
+		{endParam + "&range=48h", end.Add(-48 * time.Hour)},
+		{endParam + "&start=2026-03-09T00:00:00Z", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{endParam + "&range=168h", end.Add(-7 * 24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		start, gotEnd, err := s.queryRange(httptest.NewRequest(http.MethodGet, "/api/v1/flows?"+tt.query, nil))
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if !start.Equal(tt.wantStart) || !gotEnd.Equal(end) {
+			t.Errorf("%s: range %s to %s, want %s to %s", tt.query, start, gotEnd, tt.wantStart, end)
+		}
+	}
+}
+
+func TestQueryRangeDefaultEndsNow(t *testing.T) {
+	s := &Server{cfg: Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}}
+	before := time.Now()
+	start, end, err := s.queryRange(httptest.NewRequest(http.MethodGet, "/api/v1/flows", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Before(before) || end.Sub(start) != time.Hour {
+		t.Errorf("range %s to %s, want the last hour", start, end)
+	}
+}
+
+func TestQueryRangeRejects(t *testing.T) {
+	s := &Server{cfg: Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}}
+	for _, query := range []string{
+		"range=25h",
+		"start=2026-01-01T00:00:00Z&end=2026-03-01T00:00:00Z",
+		"start=2026-03-01T00:00:00Z&end=2026-03-01T00:00:00Z",
+		"range=-1h",
+		"range=soon",
+		"start=yesterday",
+		"end=2026-03-01",
+	} {
+		if _, _, err := s.queryRange(httptest.NewRequest(http.MethodGet, "/api/v1/flows?"+query, nil)); err == nil {
+			t.Errorf("%s: want error", query)
+		}
+	}
+}
+
+func TestOversizedRangeIsBadRequest(t *testing.T) {
+	s := &Server{cfg: Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}}
+	w := httptest.NewRecorder()
+	s.getFlows(w, httptest.NewRequest(http.MethodGet, "/api/v1/flows?range=720h", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestFlowsGroupByValidated(t *testing.T) {
+	s := &Server{cfg: Config{DefaultQueryRange: time.Hour, MaxQueryRange: 24 * time.Hour}}
+	for query, want := range map[string]int{"group_by=pod": http.StatusOK, "group_by=version": http.StatusOK, "group_by=node": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		s.getFlows(w, httptest.NewRequest(http.MethodGet, "/api/v1/flows?"+query, nil))
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, want)
+		}
+	}
+}
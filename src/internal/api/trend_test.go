@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/storage"
+)
+
+func TestNamespaceTrendSeriesShape(t *testing.T) {
+	s := newMockServer()
+	start := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	hour := func(h int) time.Time { return time.Date(2026, 3, 1, h, 0, 0, 0, time.UTC) }
+	egress := func(bucket time.Time, bytes uint64) storage.FlowResult {
+		return storage.FlowResult{Bucket: bucket, SrcNamespace: "shop", SrcService: "api", DstExternal: "203.0.113.10", TransferType: "egress", TotalBytes: bytes}
+	}
+	results := []storage.FlowResult{
+		egress(hour(11), 1<<30),
+		{Bucket: hour(11), SrcNamespace: "shop", SrcService: "api", DstNamespace: "shop", DstService: "db", TransferType: "service_to_service", TotalBytes: 500},
+		egress(hour(13), 2<<30),
+		egress(hour(9), 4<<30), // Outside the range
+	}
+
+	trend := s.namespaceTrend("shop", storage.GranularityHourly, start, end, results)
+
+	if trend.Namespace != "shop" || trend.Granularity != storage.GranularityHourly || len(trend.Points) != 5 {
+		t.Fatalf("trend = %+v, want five hourly points from 10:00", trend)
+	}
+	want := []struct {
+		total, egress uint64
+	}{{0, 0}, {1<<30 + 500, 1 << 30}, {0, 0}, {2 << 30, 2 << 30}, {0, 0}}
+	for i, p := range trend.Points {
+		if !p.Bucket.Equal(hour(10 + i)) {
+			t.Errorf("point %d at %v, want %v", i, p.Bucket, hour(10+i))
+		}
+		if p.TotalBytes != want[i].total || p.EgressBytes != want[i].egress {
+			t.Errorf("point %d = %d total %d egress, want %d and %d", i, p.TotalBytes, p.EgressBytes, want[i].total, want[i].egress)
+		}
+		if (p.EgressBytes > 0) != (p.CostUSD > 0) {
+			t.Errorf("point %d costs %v for %d egress bytes", i, p.CostUSD, p.EgressBytes)
+		}
+	}
+	if trend.Points[3].CostUSD <= trend.Points[1].CostUSD {
+		t.Errorf("13:00 costs %v, not more than 11:00's %v for twice the egress", trend.Points[3].CostUSD, trend.Points[1].CostUSD)
+	}
+}
+
+func TestNamespaceTrendValidation(t *testing.T) {
+	s := newMockServer()
+	s.cfg = Config{DefaultQueryRange: time.Hour, MaxQueryRange: 90 * 24 * time.Hour}
+	for query, want := range map[string]int{
+		"":                                  http.StatusBadRequest,
+		"namespace=shop&granularity=weekly": http.StatusBadRequest,
+		"namespace=shop&granularity=raw&range=720h": http.StatusBadRequest,
+		"namespace=shop": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		s.getNamespaceTrend(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/by-namespace/trend?"+query, nil))
+		if w.Code != want {
+			t.Errorf("%q: status = %d, want %d", query, w.Code, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.getNamespaceTrend(w, httptest.NewRequest(http.MethodGet, "/api/v1/costs/by-namespace/trend?namespace=shop&range=3h", nil))
+	var trend NamespaceTrend
+	if err := json.NewDecoder(w.Body).Decode(&trend); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(trend.Points); n < 3 || n > 4 {
+		t.Errorf("got %d points over three hours without storage, want zero-filled buckets", n)
+	}
+}
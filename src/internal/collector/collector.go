@@ -13,8 +13,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Accept gzip-compressed agent exports
 
+	"github.com/egressor/egressor/src/internal/queue"
 	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/internal/transport"
 	"github.com/egressor/egressor/src/pkg/types"
 )
 
@@ -26,40 +30,109 @@ type Config struct {
 	PostgresDSN   string
 	BatchSize     int
 	FlushInterval time.Duration
+	TLS           transport.TLSConfig
+	Quotas        QuotaConfig
+
+	// RawSampleRate is the fraction of flows whose raw events are retained.
+	// Dropped events still count towards hourly aggregates.
+	RawSampleRate float64
+
+	// EventBufferSize is the capacity of the ingest channel. OverflowPolicy
+	// decides what happens when it is full; OverflowTimeout bounds waits
+	// under the block policy.
+	EventBufferSize int
+	OverflowPolicy  queue.OverflowPolicy
+	OverflowTimeout time.Duration
+
+	// DryRun validates and counts events without connecting to or writing
+	// to ClickHouse.
+	DryRun bool
+
+	// AtomicFlush writes retained and unretained events of a batch in one
+	// insert, so a crash mid-flush cannot leave the hourly aggregates ahead
+	// of raw events.
+	AtomicFlush bool
+
+	// IngestToken enables POST /ingest on the HTTP listener for NDJSON
+	// events, authenticated by this bearer token. IngestMaxBytes caps the
+	// request body. The token must not cross the network in the clear:
+	// with TLS configured, the HTTP listener then serves TLS with the same
+	// certificate and client authentication as gRPC, health and metrics
+	// included.
+	IngestToken    string
+	IngestMaxBytes int64
+}
+
+// defaultEventBufferSize is used when Config.EventBufferSize is unset.
+const defaultEventBufferSize = 100000
+
+// EventStore persists transfer events. *storage.ClickHouseStore implements
+// it.
+type EventStore interface {
+	InsertEvents(ctx context.Context, events []types.TransferEvent) (storage.InsertResult, error)
+	InsertAggregateOnly(ctx context.Context, events []types.TransferEvent) (storage.InsertResult, error)
+	InsertEventsAtomic(ctx context.Context, retained, unretained []types.TransferEvent) (storage.InsertResult, error)
+	Close() error
 }
 
 // Collector is the Egressor collector service.
 type Collector struct {
 	cfg        Config
-	storage    *storage.ClickHouseStore
+	storage    EventStore // nil in dry-run and in-memory mode
 	grpcServer *grpc.Server
 	httpServer *http.Server
 	eventChan  chan types.TransferEvent
 	batch      []types.TransferEvent
+	quotas     *QuotaChecker
+	sampler    *RawSampler
+	dryRun     *dryRunMetrics // Set in dry-run mode
 	mu         sync.Mutex
 	running    bool
 	stopChan   chan struct{}
+	doneChan   chan struct{} // Closed when processBatches returns
 
 	// Metrics
 	eventsReceived prometheus.Counter
 	eventsStored   prometheus.Counter
+	eventsUnkept   prometheus.Counter
+	eventsSkipped  prometheus.Counter
+	eventsDropped  prometheus.Counter
+	eventsRejected *prometheus.CounterVec
 	batchesWritten prometheus.Counter
 	storageLatency prometheus.Histogram
+	ingestRate     *RateMeter
 }
 
 // New creates a new collector.
 func New(cfg Config) (*Collector, error) {
-	store, err := storage.NewClickHouseStore(cfg.ClickHouseDSN)
+	if cfg.EventBufferSize <= 0 {
+		cfg.EventBufferSize = defaultEventBufferSize
+	}
+	if cfg.IngestMaxBytes <= 0 {
+		cfg.IngestMaxBytes = defaultIngestMaxBytes
+	}
+	policy, err := queue.ParseOverflowPolicy(string(cfg.OverflowPolicy))
 	if err != nil {
+		return nil, err
+	}
+	cfg.OverflowPolicy = policy
+
+	var store EventStore
+	if cfg.DryRun {
+		log.Info().Msg("Dry-run mode: events are validated but not written")
+	} else if ch, err := storage.NewClickHouseStore(cfg.ClickHouseDSN); err != nil {
 		log.Warn().Err(err).Msg("Failed to connect to ClickHouse, using in-memory mode")
+	} else {
+		store = ch
 	}
 
 	c := &Collector{
 		cfg:       cfg,
 		storage:   store,
-		eventChan: make(chan types.TransferEvent, 100000),
+		eventChan: make(chan types.TransferEvent, cfg.EventBufferSize),
 		batch:     make([]types.TransferEvent, 0, cfg.BatchSize),
 		stopChan:  make(chan struct{}),
+		doneChan:  make(chan struct{}),
 		eventsReceived: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "egressor_collector_events_received_total",
 			Help: "Total number of events received",
@@ -68,6 +141,22 @@ func New(cfg Config) (*Collector, error) {
 			Name: "egressor_collector_events_stored_total",
 			Help: "Total number of events stored",
 		}),
+		eventsUnkept: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "egressor_collector_events_unretained_total",
+			Help: "Total number of events aggregated without retaining the raw event",
+		}),
+		eventsSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "egressor_collector_events_skipped_total",
+			Help: "Total number of events skipped because they could not be written",
+		}),
+		eventsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "egressor_collector_events_dropped_total",
+			Help: "Total number of events dropped because the event channel was full",
+		}),
+		eventsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "egressor_collector_events_rejected_total",
+			Help: "Events rejected by validation before being queued, by reason",
+		}, []string{"reason"}),
 		batchesWritten: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "egressor_collector_batches_written_total",
 			Help: "Total number of batches written",
@@ -77,10 +166,35 @@ func New(cfg Config) (*Collector, error) {
 			Help:    "Storage latency in seconds",
 			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
 		}),
+		ingestRate: NewRateMeter(ingestRateWindow),
 	}
 
 	// Register metrics
-	prometheus.MustRegister(c.eventsReceived, c.eventsStored, c.batchesWritten, c.storageLatency)
+	prometheus.MustRegister(c.eventsReceived, c.eventsStored, c.eventsUnkept, c.eventsSkipped, c.eventsDropped, c.eventsRejected, c.batchesWritten, c.storageLatency)
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "egressor_collector_ingest_events_per_second",
+			Help: "Events received per second, averaged over the last minute",
+		}, c.ingestRate.Rate),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "egressor_collector_event_channel_utilization_percent",
+			Help: "Percentage of the event channel buffer in use",
+		}, c.channelUtilization),
+	)
+
+	if cfg.RawSampleRate > 0 && cfg.RawSampleRate < 1 {
+		c.sampler = NewRawSampler(cfg.RawSampleRate)
+	}
+
+	if cfg.DryRun {
+		c.dryRun = newDryRunMetrics()
+		prometheus.MustRegister(c.dryRun.Collectors()...)
+	}
+
+	if cfg.Quotas.Enabled() {
+		c.quotas = NewQuotaChecker(cfg.Quotas)
+		prometheus.MustRegister(c.quotas.Collectors()...)
+	}
 
 	return c, nil
 }
@@ -96,35 +210,67 @@ func (c *Collector) Start(ctx context.Context) error {
 	c.mu.Unlock()
 
 	// Start gRPC server
+	tlsConfig, err := c.cfg.TLS.ServerConfig()
+	if err != nil {
+		return fmt.Errorf("configuring TLS: %w", err)
+	}
+
 	grpcListener, err := net.Listen("tcp", c.cfg.GRPCListen)
 	if err != nil {
 		return fmt.Errorf("listening on gRPC address: %w", err)
 	}
 
-	c.grpcServer = grpc.NewServer()
+	var serverOpts []grpc.ServerOption
+	if tlsConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	c.grpcServer = grpc.NewServer(serverOpts...)
 	// pb.RegisterCollectorServer(c.grpcServer, c) // Register gRPC service
 
 	go func() {
-		log.Info().Str("addr", c.cfg.GRPCListen).Msg("Starting gRPC server")
+		log.Info().
+			Str("addr", c.cfg.GRPCListen).
+			Bool("tls", tlsConfig != nil).
+			Bool("client_auth", c.cfg.TLS.ClientAuth).
+			Msg("Starting gRPC server")
 		if err := c.grpcServer.Serve(grpcListener); err != nil {
 			log.Error().Err(err).Msg("gRPC server error")
 		}
 	}()
 
-	// Start HTTP server for health/metrics
+	// Start HTTP server for health/metrics and NDJSON ingest
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", c.healthHandler)
 	mux.HandleFunc("/ready", c.readyHandler)
 	mux.Handle("/metrics", promhttp.Handler())
+	if c.cfg.IngestToken != "" {
+		mux.HandleFunc("/ingest", c.ingestHandler)
+		if tlsConfig == nil {
+			log.Warn().Msg("HTTP ingest is enabled without TLS; its bearer token is sent in the clear")
+		}
+	}
 
 	c.httpServer = &http.Server{
 		Addr:    c.cfg.HTTPListen,
 		Handler: mux,
 	}
+	if c.cfg.IngestToken != "" {
+		c.httpServer.TLSConfig = tlsConfig
+	}
 
 	go func() {
-		log.Info().Str("addr", c.cfg.HTTPListen).Msg("Starting HTTP server")
-		if err := c.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Info().
+			Str("addr", c.cfg.HTTPListen).
+			Bool("tls", c.httpServer.TLSConfig != nil).
+			Msg("Starting HTTP server")
+		var err error
+		if c.httpServer.TLSConfig != nil {
+			err = c.httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = c.httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("HTTP server error")
 		}
 	}()
@@ -136,7 +282,8 @@ func (c *Collector) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops the collector.
+// Stop stops the collector. Servers are stopped first so no new events
+// arrive, then buffered events are written out until ctx expires.
 func (c *Collector) Stop(ctx context.Context) error {
 	c.mu.Lock()
 	if !c.running {
@@ -147,8 +294,11 @@ func (c *Collector) Stop(ctx context.Context) error {
 	close(c.stopChan)
 	c.mu.Unlock()
 
-	// Flush remaining events
-	c.flushBatch(ctx)
+	// Wait for the batch loop so draining does not race it
+	select {
+	case <-c.doneChan:
+	case <-ctx.Done():
+	}
 
 	// Stop servers
 	if c.grpcServer != nil {
@@ -158,6 +308,9 @@ func (c *Collector) Stop(ctx context.Context) error {
 		c.httpServer.Shutdown(ctx)
 	}
 
+	// Flush remaining events
+	c.drain(ctx)
+
 	// Close storage
 	if c.storage != nil {
 		c.storage.Close()
@@ -166,20 +319,37 @@ func (c *Collector) Stop(ctx context.Context) error {
 	return nil
 }
 
-// Ingest adds events to the processing queue.
-func (c *Collector) Ingest(events []types.TransferEvent) {
+// Ingest adds events to the processing queue and returns how many were
+// queued; the rest were dropped by the overflow policy.
+func (c *Collector) Ingest(events []types.TransferEvent) int {
+	queuedCount := 0
 	for _, event := range events {
-		select {
-		case c.eventChan <- event:
+		if c.quotas != nil {
+			c.quotas.Record(&event)
+		}
+
+		queued, evicted := queue.Offer(c.eventChan, event, c.cfg.OverflowPolicy, c.cfg.OverflowTimeout)
+		if queued {
+			queuedCount++
 			c.eventsReceived.Inc()
-		default:
-			log.Warn().Msg("Event channel full, dropping events")
+			c.ingestRate.Add(1)
+		}
+		dropped := evicted
+		if !queued {
+			dropped++
+		}
+		if dropped > 0 {
+			c.eventsDropped.Add(float64(dropped))
+			log.Warn().Str("policy", string(c.cfg.OverflowPolicy)).Msg("Event channel full, dropping events")
 		}
 	}
+	return queuedCount
 }
 
 // processBatches processes events in batches.
 func (c *Collector) processBatches(ctx context.Context) {
+	defer close(c.doneChan)
+
 	ticker := time.NewTicker(c.cfg.FlushInterval)
 	defer ticker.Stop()
 
@@ -204,6 +374,35 @@ func (c *Collector) processBatches(ctx context.Context) {
 	}
 }
 
+// drain writes the current batch and everything still buffered in the event
+// channel. Events left when ctx expires are counted as lost.
+func (c *Collector) drain(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			lost := len(c.batch) + len(c.eventChan)
+			c.mu.Unlock()
+			if lost > 0 {
+				log.Warn().Int("count", lost).Msg("Shutdown deadline reached, buffered events dropped")
+			}
+			return
+		case event := <-c.eventChan:
+			c.mu.Lock()
+			c.batch = append(c.batch, event)
+			shouldFlush := len(c.batch) >= c.cfg.BatchSize
+			c.mu.Unlock()
+
+			if shouldFlush {
+				c.flushBatch(ctx)
+			}
+		default:
+			c.flushBatch(ctx)
+			return
+		}
+	}
+}
+
 // flushBatch writes the current batch to storage.
 func (c *Collector) flushBatch(ctx context.Context) {
 	c.mu.Lock()
@@ -215,17 +414,52 @@ func (c *Collector) flushBatch(ctx context.Context) {
 	c.batch = make([]types.TransferEvent, 0, c.cfg.BatchSize)
 	c.mu.Unlock()
 
+	if c.dryRun != nil {
+		valid := c.validateBatch(batch)
+		log.Debug().Int("count", len(batch)).Int("valid", valid).Msg("Dry-run batch validated")
+		return
+	}
+
 	start := time.Now()
 
-	if c.storage != nil {
-		if err := c.storage.InsertEvents(ctx, batch); err != nil {
+	retained, dropped := batch, []types.TransferEvent(nil)
+	if c.sampler != nil {
+		retained, dropped = c.sampler.Split(batch)
+	}
+
+	stored, unkept := len(retained), len(dropped)
+	if c.storage != nil && c.cfg.AtomicFlush {
+		result, err := c.storage.InsertEventsAtomic(ctx, retained, dropped)
+		c.eventsSkipped.Add(float64(result.Skipped))
+		if err != nil {
 			log.Error().Err(err).Int("count", len(batch)).Msg("Failed to insert events")
 			return
 		}
+		stored, unkept = result.Retained, result.Inserted-result.Retained
+	} else if c.storage != nil {
+		if len(retained) > 0 {
+			result, err := c.storage.InsertEvents(ctx, retained)
+			c.eventsSkipped.Add(float64(result.Skipped))
+			if err != nil {
+				log.Error().Err(err).Int("count", len(retained)).Msg("Failed to insert events")
+				return
+			}
+			stored = result.Inserted
+		}
+		if len(dropped) > 0 {
+			result, err := c.storage.InsertAggregateOnly(ctx, dropped)
+			c.eventsSkipped.Add(float64(result.Skipped))
+			if err != nil {
+				log.Error().Err(err).Int("count", len(dropped)).Msg("Failed to insert unretained events")
+				return
+			}
+			unkept = result.Inserted
+		}
 	}
 
 	c.storageLatency.Observe(time.Since(start).Seconds())
-	c.eventsStored.Add(float64(len(batch)))
+	c.eventsStored.Add(float64(stored))
+	c.eventsUnkept.Add(float64(unkept))
 	c.batchesWritten.Inc()
 
 	log.Debug().Int("count", len(batch)).Dur("latency", time.Since(start)).Msg("Batch written")
@@ -239,7 +473,7 @@ func (c *Collector) healthHandler(w http.ResponseWriter, r *http.Request) {
 
 // readyHandler returns readiness status.
 func (c *Collector) readyHandler(w http.ResponseWriter, r *http.Request) {
-	if c.storage == nil {
+	if c.storage == nil && c.dryRun == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte("Storage not ready"))
 		return
@@ -255,7 +489,14 @@ func (c *Collector) GetStats() map[string]interface{} {
 	c.mu.Unlock()
 
 	return map[string]interface{}{
-		"pending_batch_size": batchLen,
-		"channel_length":     len(c.eventChan),
+		"pending_batch_size":          batchLen,
+		"channel_length":              len(c.eventChan),
+		"channel_utilization_percent": c.channelUtilization(),
+		"ingest_events_per_second":    c.ingestRate.Rate(),
 	}
 }
+
+// channelUtilization returns the share of the event buffer in use, 0-100.
+func (c *Collector) channelUtilization() float64 {
+	return float64(len(c.eventChan)) / float64(cap(c.eventChan)) * 100
+}
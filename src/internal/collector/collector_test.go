@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/internal/queue"
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// memStore is an EventStore that keeps inserted events in memory.
+type memStore struct {
+	mu        sync.Mutex
+	events    []types.TransferEvent
+	aggregate []types.TransferEvent // Inserted without retaining raw events
+	atomic    int                   // InsertEventsAtomic calls
+	closed    bool
+}
+
+func (m *memStore) InsertEvents(_ context.Context, events []types.TransferEvent) (storage.InsertResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, events...)
+	return storage.InsertResult{Inserted: len(events)}, nil
+}
+
+func (m *memStore) InsertAggregateOnly(_ context.Context, events []types.TransferEvent) (storage.InsertResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aggregate = append(m.aggregate, events...)
+	return storage.InsertResult{Inserted: len(events)}, nil
+}
+
+func (m *memStore) InsertEventsAtomic(_ context.Context, retained, unretained []types.TransferEvent) (storage.InsertResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.atomic++
+	m.events = append(m.events, retained...)
+	m.aggregate = append(m.aggregate, unretained...)
+	return storage.InsertResult{Inserted: len(retained) + len(unretained), Retained: len(retained)}, nil
+}
+
+func (m *memStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *memStore) stored() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.events)
+}
+
+func counter(name string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: name})
+}
+
+// newTestCollector returns a running collector without servers or global
+// metrics, writing to store.
+func newTestCollector(cfg Config, store EventStore) *Collector {
+	if cfg.EventBufferSize == 0 {
+		cfg.EventBufferSize = 1000
+	}
+	if cfg.OverflowPolicy == "" {
+		cfg.OverflowPolicy = queue.DropNewest
+	}
+	return &Collector{
+		cfg:            cfg,
+		storage:        store,
+		eventChan:      make(chan types.TransferEvent, cfg.EventBufferSize),
+		batch:          make([]types.TransferEvent, 0, cfg.BatchSize),
+		running:        true,
+		stopChan:       make(chan struct{}),
+		doneChan:       make(chan struct{}),
+		eventsReceived: counter("test_received_total"),
+		eventsStored:   counter("test_stored_total"),
+		eventsUnkept:   counter("test_unretained_total"),
+		eventsSkipped:  counter("test_skipped_total"),
+		eventsDropped:  counter("test_dropped_total"),
+		eventsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_rejected_total"}, []string{"reason"}),
+		batchesWritten: counter("test_batches_total"),
+		storageLatency: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_latency_seconds"}),
+		ingestRate:     NewRateMeter(ingestRateWindow),
+	}
+}
+
+// testEvents returns n egress events from shop/api.
+func testEvents(n int) []types.TransferEvent {
+	events := make([]types.TransferEvent, n)
+	for i := range events {
+		events[i] = types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   time.Now(),
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: "shop", Name: "api"}},
+			Destination: types.Endpoint{IP: fmt.Sprintf("203.0.113.%d", i%250), IsInternet: true},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   100,
+		}
+	}
+	return events
+}
+
+func TestStopDrainsBufferedEvents(t *testing.T) {
+	store := &memStore{}
+	c := newTestCollector(Config{BatchSize: 100, FlushInterval: time.Hour}, store)
+
+	// No batch loop runs, so the channel holds a burst that arrived right
+	// before shutdown
+	c.Ingest(testEvents(750))
+	if len(c.eventChan) != 750 {
+		t.Fatalf("buffered %d events, want 750", len(c.eventChan))
+	}
+	close(c.doneChan)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.stored(); got != 750 {
+		t.Errorf("stored %d events, want all 750 buffered", got)
+	}
+	if len(c.eventChan) != 0 || len(c.batch) != 0 {
+		t.Errorf("%d events left buffered, %d in the batch", len(c.eventChan), len(c.batch))
+	}
+	if !store.closed {
+		t.Error("storage not closed after draining")
+	}
+}
+
+func TestStopDrainBoundedByContext(t *testing.T) {
+	store := &memStore{}
+	c := newTestCollector(Config{BatchSize: 100, FlushInterval: time.Hour}, store)
+	c.Ingest(testEvents(500))
+	close(c.doneChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Stop(ctx)
+
+	if got := store.stored(); got >= 500 {
+		t.Errorf("stored %d events after the deadline, want the drain cut short", got)
+	}
+	if !store.closed {
+		t.Error("storage not closed")
+	}
+}
+
+func TestIngestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy       queue.OverflowPolicy
+		wantReceived float64
+		wantDropped  float64
+		wantFirst    string // Destination of the oldest queued event
+	}{
+		{queue.DropNewest, 2, 3, "203.0.113.0"},
+		{queue.DropOldest, 5, 3, "203.0.113.3"},
+		{queue.Block, 2, 3, "203.0.113.0"},
+	}
+	for _, tt := range tests {
+		c := newTestCollector(Config{EventBufferSize: 2, OverflowPolicy: tt.policy, OverflowTimeout: time.Millisecond}, &memStore{})
+		c.Ingest(testEvents(5))
+
+		if got := testutil.ToFloat64(c.eventsReceived); got != tt.wantReceived {
+			t.Errorf("%s: received = %v, want %v", tt.policy, got, tt.wantReceived)
+		}
+		if got := testutil.ToFloat64(c.eventsDropped); got != tt.wantDropped {
+			t.Errorf("%s: dropped = %v, want %v", tt.policy, got, tt.wantDropped)
+		}
+		if first := <-c.eventChan; first.Destination.IP != tt.wantFirst {
+			t.Errorf("%s: oldest queued event %s, want %s", tt.policy, first.Destination.IP, tt.wantFirst)
+		}
+	}
+}
+
+func TestAtomicFlushWritesBothInOneInsert(t *testing.T) {
+	store := &memStore{}
+	c := newTestCollector(Config{BatchSize: 1000, FlushInterval: time.Hour, AtomicFlush: true}, store)
+	c.sampler = NewRawSampler(0.5)
+	c.Ingest(testEvents(200))
+	close(c.doneChan)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.atomic != 1 {
+		t.Fatalf("%d atomic inserts, want the batch in one", store.atomic)
+	}
+	raw, aggregate := store.stored(), len(store.aggregate)
+	if raw == 0 || aggregate == 0 || raw+aggregate != 200 {
+		t.Errorf("wrote %d raw and %d aggregate-only events, want the 200 split between them", raw, aggregate)
+	}
+	if got := testutil.ToFloat64(c.eventsStored); got != float64(raw) {
+		t.Errorf("stored = %v, want %d", got, raw)
+	}
+	if got := testutil.ToFloat64(c.eventsUnkept); got != float64(aggregate) {
+		t.Errorf("unretained = %v, want %d", got, aggregate)
+	}
+}
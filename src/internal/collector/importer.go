@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// Import file formats.
+const (
+	ImportFormatJSON = "json" // JSON array or newline-delimited TransferFlow objects
+	ImportFormatCSV  = "csv"
+)
+
+// ImportTarget is where an imported flow is written.
+type ImportTarget int
+
+const (
+	// ImportRaw writes the flow as a raw event, which also feeds the
+	// hourly aggregates.
+	ImportRaw ImportTarget = iota
+	// ImportAggregateOnly writes only the hourly aggregates, for flows
+	// older than raw retention: a raw event would be dropped by its TTL
+	// as soon as it was written.
+	ImportAggregateOnly
+	// ImportExpired skips the flow, which is older than the hourly
+	// aggregates' retention too.
+	ImportExpired
+)
+
+// ImportTargetFor returns where a flow starting at its window start is
+// written when imported at now.
+func ImportTargetFor(flow types.TransferFlow, now time.Time) ImportTarget {
+	age := now.Sub(flow.WindowStart)
+	switch {
+	case age >= storage.HourlyAggregateRetention:
+		return ImportExpired
+	case age >= storage.RawEventRetention:
+		return ImportAggregateOnly
+	default:
+		return ImportRaw
+	}
+}
+
+// csvImportColumns are the recognised CSV header columns. Only timestamp,
+// src_service, and bytes are required.
+var csvImportColumns = []string{
+	"timestamp", "src_namespace", "src_service",
+	"dst_namespace", "dst_service", "dst_ip", "dst_hostname",
+	"transfer_type", "bytes", "packets",
+}
+
+// ReadFlows reads historical flows from r in the given format.
+func ReadFlows(r io.Reader, format string) ([]types.TransferFlow, error) {
+	switch format {
+	case ImportFormatJSON:
+		return readJSONFlows(r)
+	case ImportFormatCSV:
+		return readCSVFlows(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", format)
+	}
+}
+
+// readJSONFlows accepts either a JSON array or NDJSON.
+func readJSONFlows(r io.Reader) ([]types.TransferFlow, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if first == '[' {
+		var flows []types.TransferFlow
+		if err := json.NewDecoder(br).Decode(&flows); err != nil {
+			return nil, fmt.Errorf("decoding JSON array: %w", err)
+		}
+		return flows, nil
+	}
+
+	var flows []types.TransferFlow
+	dec := json.NewDecoder(br)
+	for {
+		var flow types.TransferFlow
+		if err := dec.Decode(&flow); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding flow %d: %w", len(flows)+1, err)
+		}
+		flows = append(flows, flow)
+	}
+	return flows, nil
+}
+
+// peekNonSpace returns the first non-whitespace byte without consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		br.ReadByte()
+	}
+}
+
+// readCSVFlows reads flows from a CSV file with a header row.
+func readCSVFlows(r io.Reader) ([]types.TransferFlow, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	idx := make(map[string]int, len(header))
+	for i, name := range header {
+		idx[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"timestamp", "src_service", "bytes"} {
+		if _, ok := idx[required]; !ok {
+			return nil, fmt.Errorf("missing required column %q (known columns: %s)",
+				required, strings.Join(csvImportColumns, ", "))
+		}
+	}
+
+	var flows []types.TransferFlow
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		field := func(name string) string {
+			if i, ok := idx[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		ts, err := time.Parse(time.RFC3339, field("timestamp"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %w", line, err)
+		}
+		bytesTotal, err := strconv.ParseUint(field("bytes"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid bytes: %w", line, err)
+		}
+		var packets uint64
+		if p := field("packets"); p != "" {
+			if packets, err = strconv.ParseUint(p, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid packets: %w", line, err)
+			}
+		}
+
+		flow := types.TransferFlow{
+			SourceIdentity: types.ServiceIdentity{
+				Namespace: field("src_namespace"),
+				Name:      field("src_service"),
+			},
+			Type:         types.TransferType(field("transfer_type")),
+			TotalBytes:   bytesTotal,
+			TotalPackets: packets,
+			EventCount:   1,
+			WindowStart:  ts,
+			WindowEnd:    ts,
+		}
+		if dst := field("dst_service"); dst != "" {
+			flow.DestinationIdentity = &types.ServiceIdentity{
+				Namespace: field("dst_namespace"),
+				Name:      dst,
+			}
+		} else if ip, host := field("dst_ip"), field("dst_hostname"); ip != "" || host != "" {
+			flow.DestinationEndpoint = &types.Endpoint{
+				Type:       types.EndpointTypeExternal,
+				IP:         ip,
+				Hostname:   host,
+				IsInternet: true,
+			}
+		}
+		flows = append(flows, flow)
+	}
+
+	return flows, nil
+}
+
+// FlowToEvent converts a historical flow into a single transfer event
+// stamped with the flow's window start, so aggregates land in the original
+// hour rather than at import time.
+func FlowToEvent(flow types.TransferFlow) types.TransferEvent {
+	src := flow.SourceIdentity
+	event := types.TransferEvent{
+		ID: uuid.New(),
+		Source: types.Endpoint{
+			Type:     types.EndpointTypePod,
+			Identity: &src,
+		},
+		Protocol:    "TCP",
+		Direction:   types.DirectionOutbound,
+		Type:        flow.Type,
+		BytesSent:   flow.TotalBytes,
+		PacketsSent: flow.TotalPackets,
+		Timestamp:   flow.WindowStart,
+	}
+	if flow.WindowEnd.After(flow.WindowStart) {
+		event.DurationNs = uint64(flow.WindowEnd.Sub(flow.WindowStart).Nanoseconds())
+	}
+
+	if flow.DestinationIdentity != nil {
+		dst := *flow.DestinationIdentity
+		event.Destination = types.Endpoint{
+			Type:     types.EndpointTypePod,
+			Identity: &dst,
+		}
+	} else if flow.DestinationEndpoint != nil {
+		event.Destination = *flow.DestinationEndpoint
+	}
+
+	if event.Type == "" {
+		if event.Destination.IsInternet {
+			event.Type = types.TransferTypeEgress
+		} else {
+			event.Type = types.TransferTypePodToPod
+		}
+	}
+
+	return event
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+const importCSV = `timestamp,src_namespace,src_service,dst_service,dst_ip,dst_hostname,bytes,packets
+2025-11-03T14:20:00Z,shop,api,,52.1.2.3,bucket.s3.amazonaws.com,5000,7
+2025-11-03T15:05:00Z,shop,web,api,,,1200,
+`
+
+func TestImportCSVKeepsHistoricalTimestamps(t *testing.T) {
+	flows, err := ReadFlows(strings.NewReader(importCSV), ImportFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("read %d flows, want 2", len(flows))
+	}
+
+	egress := FlowToEvent(flows[0])
+	if want := time.Date(2025, 11, 3, 14, 20, 0, 0, time.UTC); !egress.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %s, want the original %s", egress.Timestamp, want)
+	}
+	if egress.Type != types.TransferTypeEgress || egress.BytesSent != 5000 || egress.PacketsSent != 7 {
+		t.Errorf("event = %s %d bytes %d packets, want egress of 5000 bytes in 7 packets", egress.Type, egress.BytesSent, egress.PacketsSent)
+	}
+	if egress.Source.Identity.Name != "api" || egress.Destination.Hostname != "bucket.s3.amazonaws.com" {
+		t.Errorf("event %s -> %s, want api -> bucket.s3.amazonaws.com", egress.Source.Identity.Name, egress.Destination.Hostname)
+	}
+
+	internal := FlowToEvent(flows[1])
+	if internal.Type != types.TransferTypePodToPod || internal.Destination.Identity == nil || internal.Destination.Identity.Name != "api" {
+		t.Errorf("second event = %+v, want pod-to-pod to api", internal)
+	}
+}
+
+func TestImportJSONArrayAndNDJSON(t *testing.T) {
+	const flow = `{"source_identity":{"namespace":"shop","name":"api"},"type":"egress","total_bytes":100,"window_start":"2025-06-01T10:00:00Z","window_end":"2025-06-01T11:00:00Z"}`
+
+	for name, input := range map[string]string{
+		"array":  "  [" + flow + "," + flow + "]",
+		"ndjson": flow + "\n" + flow + "\n",
+	} {
+		flows, err := ReadFlows(strings.NewReader(input), ImportFormatJSON)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(flows) != 2 {
+			t.Fatalf("%s: read %d flows, want 2", name, len(flows))
+		}
+		event := FlowToEvent(flows[0])
+		if !event.Timestamp.Equal(time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)) || event.DurationNs != uint64(time.Hour) {
+			t.Errorf("%s: event at %s lasting %d, want the flow's hour", name, event.Timestamp, event.DurationNs)
+		}
+	}
+}
+
+func TestImportRejectsBadInput(t *testing.T) {
+	for name, input := range map[string]string{
+		"missing bytes column": "timestamp,src_service\n2025-11-03T14:20:00Z,api\n",
+		"bad timestamp":        "timestamp,src_service,bytes\nyesterday,api,10\n",
+		"bad bytes":            "timestamp,src_service,bytes\n2025-11-03T14:20:00Z,api,lots\n",
+	} {
+		if _, err := ReadFlows(strings.NewReader(input), ImportFormatCSV); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+	if _, err := ReadFlows(strings.NewReader(""), "parquet"); err == nil {
+		t.Error("want error for an unsupported format")
+	}
+}
+
+func TestImportTargetByAge(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		age  time.Duration
+		want ImportTarget
+	}{
+		{time.Hour, ImportRaw},
+		{29 * 24 * time.Hour, ImportRaw},
+		{31 * 24 * time.Hour, ImportAggregateOnly},
+		{89 * 24 * time.Hour, ImportAggregateOnly},
+		{91 * 24 * time.Hour, ImportExpired},
+	} {
+		flow := types.TransferFlow{WindowStart: now.Add(-tc.age)}
+		if got := ImportTargetFor(flow, now); got != tc.want {
+			t.Errorf("target for a flow %s old = %d, want %d", tc.age, got, tc.want)
+		}
+	}
+}
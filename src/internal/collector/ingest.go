@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// defaultIngestMaxBytes is used when Config.IngestMaxBytes is unset.
+const defaultIngestMaxBytes = 10 << 20
+
+// ingestChunkSize is how many decoded events are handed to Ingest at once,
+// so large bodies are queued as they stream in.
+const ingestChunkSize = 1000
+
+// IngestResponse reports how many events of an /ingest request were
+// queued, how many failed validation and how many valid events were
+// dropped because the event channel was full. On a decoding error, events
+// before the bad line have already been queued.
+type IngestResponse struct {
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Dropped  int    `json:"dropped,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ingestHandler accepts newline-delimited JSON TransferEvents for producers
+// that do not speak gRPC. Requests must carry the configured bearer token.
+func (c *Collector) ingestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.cfg.IngestToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, c.cfg.IngestMaxBytes)
+	dec := json.NewDecoder(body)
+
+	var resp IngestResponse
+	chunk := make([]types.TransferEvent, 0, ingestChunkSize)
+	enqueue := func() {
+		queued := c.Ingest(chunk)
+		resp.Accepted += queued
+		resp.Dropped += len(chunk) - queued
+		chunk = chunk[:0]
+	}
+	status := http.StatusOK
+	decoded := 0
+	for {
+		var event types.TransferEvent
+		err := dec.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+				resp.Error = fmt.Sprintf("request body exceeds %d bytes", c.cfg.IngestMaxBytes)
+			} else {
+				status = http.StatusBadRequest
+				resp.Error = fmt.Sprintf("decoding event %d: %v", decoded+1, err)
+			}
+			break
+		}
+		decoded++
+
+		if reason := validateEvent(event); reason != "" {
+			c.rejectEvent(reason)
+			resp.Rejected++
+			continue
+		}
+		chunk = append(chunk, event)
+		if len(chunk) == ingestChunkSize {
+			enqueue()
+		}
+	}
+	if len(chunk) > 0 {
+		enqueue()
+	}
+
+	log.Debug().
+		Int("accepted", resp.Accepted).
+		Int("rejected", resp.Rejected).
+		Int("dropped", resp.Dropped).
+		Str("remote", r.RemoteAddr).
+		Msg("HTTP ingest")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
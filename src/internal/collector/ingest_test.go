@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// ndjson encodes events one per line.
+func ndjson(t *testing.T, events []types.TransferEvent) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func postIngest(c *Collector, token string, body *bytes.Buffer) (*httptest.ResponseRecorder, IngestResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/ingest", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	c.ingestHandler(w, req)
+
+	var resp IngestResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	return w, resp
+}
+
+func TestIngestNDJSON(t *testing.T) {
+	c := newTestCollector(Config{EventBufferSize: 5000, IngestToken: "secret", IngestMaxBytes: defaultIngestMaxBytes}, &memStore{})
+	events := testEvents(2500) // More than one chunk
+	events[7].Destination.IP = "nowhere"
+
+	w, resp := postIngest(c, "secret", ndjson(t, events))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %+v", w.Code, resp)
+	}
+	if resp.Accepted != 2499 || resp.Rejected != 1 {
+		t.Errorf("response = %+v, want 2499 accepted and 1 rejected", resp)
+	}
+	if got := testutil.ToFloat64(c.eventsReceived); got != 2499 {
+		t.Errorf("received = %v, want 2499", got)
+	}
+	if len(c.eventChan) != 2499 {
+		t.Errorf("queued %d events, want 2499", len(c.eventChan))
+	}
+}
+
+func TestIngestRequiresToken(t *testing.T) {
+	c := newTestCollector(Config{IngestToken: "secret", IngestMaxBytes: defaultIngestMaxBytes}, &memStore{})
+	for _, token := range []string{"", "wrong"} {
+		if w, _ := postIngest(c, token, ndjson(t, testEvents(1))); w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, w.Code)
+		}
+	}
+	if got := testutil.ToFloat64(c.eventsReceived); got != 0 {
+		t.Errorf("received = %v, want nothing from unauthorized requests", got)
+	}
+}
+
+func TestIngestBadBodies(t *testing.T) {
+	c := newTestCollector(Config{IngestToken: "secret", IngestMaxBytes: 4096}, &memStore{})
+
+	body := ndjson(t, testEvents(2))
+	body.WriteString("{not json\n")
+	w, resp := postIngest(c, "secret", body)
+	if w.Code != http.StatusBadRequest || resp.Accepted != 2 || !strings.Contains(resp.Error, "event 3") {
+		t.Errorf("malformed line: status %d, %+v; want 400 after 2 accepted", w.Code, resp)
+	}
+
+	if w, _ := postIngest(c, "secret", ndjson(t, testEvents(100))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status = %d, want 413", w.Code)
+	}
+}
+
+func TestIngestReportsDroppedEvents(t *testing.T) {
+	c := newTestCollector(Config{EventBufferSize: 10, IngestToken: "secret", IngestMaxBytes: defaultIngestMaxBytes}, &memStore{})
+
+	w, resp := postIngest(c, "secret", ndjson(t, testEvents(25)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %+v", w.Code, resp)
+	}
+	if resp.Accepted != 10 || resp.Dropped != 15 {
+		t.Errorf("response = %+v, want 10 accepted and 15 dropped by a full channel", resp)
+	}
+	if got := c.Ingest(testEvents(1)); got != 0 {
+		t.Errorf("Ingest queued %d into a full channel", got)
+	}
+}
+
+func TestIngestCountsRejectionsByReason(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		c := newTestCollector(Config{IngestToken: "secret", IngestMaxBytes: defaultIngestMaxBytes, DryRun: dryRun}, &memStore{})
+		if dryRun {
+			c.dryRun = newDryRunMetrics()
+		}
+		events := testEvents(3)
+		events[0].Destination.IP = "nowhere"
+		events[1].Timestamp = time.Time{}
+
+		if _, resp := postIngest(c, "secret", ndjson(t, events)); resp.Rejected != 2 {
+			t.Fatalf("dry run %v: response = %+v, want 2 rejected", dryRun, resp)
+		}
+		for _, reason := range []string{invalidDestinationIP, invalidMissingTimestamp} {
+			if got := testutil.ToFloat64(c.eventsRejected.WithLabelValues(reason)); got != 1 {
+				t.Errorf("dry run %v: rejected %s = %v, want 1", dryRun, reason, got)
+			}
+			if dryRun {
+				if got := testutil.ToFloat64(c.dryRun.invalid.WithLabelValues(reason)); got != 1 {
+					t.Errorf("dry-run invalid %s = %v, want 1", reason, got)
+				}
+			}
+		}
+	}
+}
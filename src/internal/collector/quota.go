@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// QuotaExceededLabel is set on events whose namespace or team is over quota.
+const QuotaExceededLabel = "egressor.io/quota-exceeded"
+
+// QuotaConfig holds per-namespace and per-team byte quotas.
+type QuotaConfig struct {
+	Namespaces map[string]uint64 // Namespace -> max bytes per window
+	Teams      map[string]uint64 // Team -> max bytes per window
+	Window     time.Duration     // Rolling window length
+	TagEvents  bool              // Add QuotaExceededLabel to over-quota events
+}
+
+// Enabled returns true if any quota is configured.
+func (c QuotaConfig) Enabled() bool {
+	return len(c.Namespaces) > 0 || len(c.Teams) > 0
+}
+
+// quotaBuckets is the number of buckets a rolling window is split into.
+const quotaBuckets = 60
+
+// rollingCounter sums values over a sliding time window using fixed buckets.
+type rollingCounter struct {
+	bucketSize time.Duration
+	buckets    map[int64]uint64 // Bucket index -> bytes
+}
+
+func newRollingCounter(window time.Duration) *rollingCounter {
+	bucketSize := window / quotaBuckets
+	if bucketSize <= 0 {
+		bucketSize = time.Second
+	}
+	return &rollingCounter{
+		bucketSize: bucketSize,
+		buckets:    make(map[int64]uint64),
+	}
+}
+
+// add records n bytes at time now and evicts expired buckets.
+func (c *rollingCounter) add(now time.Time, n uint64) {
+	idx := now.UnixNano() / int64(c.bucketSize)
+	c.buckets[idx] += n
+
+	oldest := idx - quotaBuckets + 1
+	for i := range c.buckets {
+		if i < oldest {
+			delete(c.buckets, i)
+		}
+	}
+}
+
+// total returns the sum over the window ending at now.
+func (c *rollingCounter) total(now time.Time) uint64 {
+	idx := now.UnixNano() / int64(c.bucketSize)
+	oldest := idx - quotaBuckets + 1
+
+	var sum uint64
+	for i, v := range c.buckets {
+		if i >= oldest && i <= idx {
+			sum += v
+		}
+	}
+	return sum
+}
+
+// QuotaChecker tallies bytes per namespace and team and flags quota overruns.
+type QuotaChecker struct {
+	cfg      QuotaConfig
+	counters map[string]*rollingCounter // "namespace/<name>" or "team/<name>"
+	exceeded map[string]bool
+	now      func() time.Time
+	mu       sync.Mutex
+
+	// Metrics
+	usageBytes   *prometheus.GaugeVec
+	overQuota    *prometheus.GaugeVec
+	exceededHits *prometheus.CounterVec
+}
+
+// NewQuotaChecker creates a quota checker.
+func NewQuotaChecker(cfg QuotaConfig) *QuotaChecker {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Hour
+	}
+
+	return &QuotaChecker{
+		cfg:      cfg,
+		counters: make(map[string]*rollingCounter),
+		exceeded: make(map[string]bool),
+		now:      time.Now,
+		usageBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "egressor_collector_quota_usage_bytes",
+			Help: "Bytes transferred within the quota window",
+		}, []string{"scope", "name"}),
+		overQuota: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "egressor_collector_quota_exceeded",
+			Help: "Whether a namespace or team is over its quota (1) or not (0)",
+		}, []string{"scope", "name"}),
+		exceededHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "egressor_collector_quota_exceeded_events_total",
+			Help: "Events received while their namespace or team was over quota",
+		}, []string{"scope", "name"}),
+	}
+}
+
+// Collectors returns the checker's Prometheus collectors for registration.
+func (q *QuotaChecker) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{q.usageBytes, q.overQuota, q.exceededHits}
+}
+
+// Record tallies an event against its namespace and team quotas.
+// It returns true if either quota is exceeded, tagging the event if configured.
+func (q *QuotaChecker) Record(event *types.TransferEvent) bool {
+	identity := event.Source.Identity
+	if identity == nil {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	bytes := event.TotalBytes()
+	var exceededScope string
+
+	if limit, ok := q.cfg.Namespaces[identity.Namespace]; ok {
+		if q.tally(now, "namespace", identity.Namespace, bytes, limit) {
+			exceededScope = "namespace"
+		}
+	}
+	if limit, ok := q.cfg.Teams[identity.Team]; ok && identity.Team != "" {
+		if q.tally(now, "team", identity.Team, bytes, limit) && exceededScope == "" {
+			exceededScope = "team"
+		}
+	}
+
+	if exceededScope == "" {
+		return false
+	}
+
+	if q.cfg.TagEvents {
+		if event.Labels == nil {
+			event.Labels = make(map[string]string)
+		}
+		event.Labels[QuotaExceededLabel] = exceededScope
+	}
+	return true
+}
+
+// tally adds bytes to a counter and updates its exceeded state.
+// Caller must hold q.mu.
+func (q *QuotaChecker) tally(now time.Time, scope, name string, bytes, limit uint64) bool {
+	key := scope + "/" + name
+	counter, ok := q.counters[key]
+	if !ok {
+		counter = newRollingCounter(q.cfg.Window)
+		q.counters[key] = counter
+	}
+	counter.add(now, bytes)
+
+	total := counter.total(now)
+	q.usageBytes.WithLabelValues(scope, name).Set(float64(total))
+
+	over := total > limit
+	if over != q.exceeded[key] {
+		q.exceeded[key] = over
+		if over {
+			q.overQuota.WithLabelValues(scope, name).Set(1)
+			log.Warn().
+				Str("scope", scope).
+				Str("name", name).
+				Uint64("bytes", total).
+				Uint64("quota", limit).
+				Dur("window", q.cfg.Window).
+				Msg("Data transfer quota exceeded")
+		} else {
+			q.overQuota.WithLabelValues(scope, name).Set(0)
+			log.Info().
+				Str("scope", scope).
+				Str("name", name).
+				Msg("Data transfer back under quota")
+		}
+	}
+
+	if over {
+		q.exceededHits.WithLabelValues(scope, name).Inc()
+	}
+	return over
+}
+
+// Usage returns current bytes in the window for a scope ("namespace" or "team").
+func (q *QuotaChecker) Usage(scope, name string) uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counter, ok := q.counters[scope+"/"+name]
+	if !ok {
+		return 0
+	}
+	return counter.total(q.now())
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// quotaEvent is an event of bytes sent by a service of namespace and team.
+func quotaEvent(namespace, team string, bytes uint64) *types.TransferEvent {
+	return &types.TransferEvent{
+		Source:    types.Endpoint{Identity: &types.ServiceIdentity{Namespace: namespace, Name: "api", Team: team}},
+		BytesSent: bytes,
+	}
+}
+
+// newTestQuotaChecker returns a checker whose clock is *now.
+func newTestQuotaChecker(cfg QuotaConfig, now *time.Time) *QuotaChecker {
+	q := NewQuotaChecker(cfg)
+	q.now = func() time.Time { return *now }
+	return q
+}
+
+func TestNamespaceCrossingQuota(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := newTestQuotaChecker(QuotaConfig{
+		Namespaces: map[string]uint64{"shop": 1000},
+		Window:     time.Hour,
+		TagEvents:  true,
+	}, &now)
+
+	under := quotaEvent("shop", "", 600)
+	if q.Record(under) || under.Labels[QuotaExceededLabel] != "" {
+		t.Fatal("600 of 1000 bytes flagged as over quota")
+	}
+	if got := testutil.ToFloat64(q.overQuota.WithLabelValues("namespace", "shop")); got != 0 {
+		t.Errorf("exceeded gauge = %v under quota, want 0", got)
+	}
+
+	now = now.Add(10 * time.Minute)
+	over := quotaEvent("shop", "", 600)
+	if !q.Record(over) {
+		t.Fatal("1200 of 1000 bytes not flagged")
+	}
+	if over.Labels[QuotaExceededLabel] != "namespace" {
+		t.Errorf("labels = %v, want the namespace quota tag", over.Labels)
+	}
+	if got := q.Usage("namespace", "shop"); got != 1200 {
+		t.Errorf("usage = %d, want 1200", got)
+	}
+	if got := testutil.ToFloat64(q.overQuota.WithLabelValues("namespace", "shop")); got != 1 {
+		t.Errorf("exceeded gauge = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(q.exceededHits.WithLabelValues("namespace", "shop")); got != 1 {
+		t.Errorf("exceeded events = %v, want 1", got)
+	}
+
+	// Other namespaces have no quota
+	if q.Record(quotaEvent("search", "", 5000)) {
+		t.Error("namespace without a quota flagged")
+	}
+}
+
+func TestQuotaWindowRollsOff(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := newTestQuotaChecker(QuotaConfig{Namespaces: map[string]uint64{"shop": 1000}, Window: time.Hour}, &now)
+
+	if !q.Record(quotaEvent("shop", "", 1500)) {
+		t.Fatal("1500 of 1000 bytes not flagged")
+	}
+
+	now = now.Add(61 * time.Minute)
+	if got := q.Usage("namespace", "shop"); got != 0 {
+		t.Errorf("usage an hour later = %d, want 0", got)
+	}
+	if q.Record(quotaEvent("shop", "", 100)) {
+		t.Error("still over quota after the window passed")
+	}
+	if got := testutil.ToFloat64(q.overQuota.WithLabelValues("namespace", "shop")); got != 0 {
+		t.Errorf("exceeded gauge = %v, want back to 0", got)
+	}
+}
+
+func TestTeamQuota(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := newTestQuotaChecker(QuotaConfig{Teams: map[string]uint64{"payments": 1000}, TagEvents: true}, &now)
+
+	q.Record(quotaEvent("shop", "payments", 800))
+	event := quotaEvent("billing", "payments", 800)
+	if !q.Record(event) || event.Labels[QuotaExceededLabel] != "team" {
+		t.Errorf("team spread over namespaces not flagged: %v", event.Labels)
+	}
+	if q.Record(quotaEvent("shop", "", 800)) {
+		t.Error("event without a team counted against a team quota")
+	}
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// ingestRateWindow is the span the ingestion rate is averaged over.
+const ingestRateWindow = 60 * time.Second
+
+// RateMeter tracks a rolling events-per-second rate using one bucket per
+// second.
+type RateMeter struct {
+	buckets []uint64
+	last    int64 // Unix second of the most recent bucket
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// NewRateMeter creates a meter averaging over window, rounded to seconds.
+func NewRateMeter(window time.Duration) *RateMeter {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &RateMeter{buckets: make([]uint64, n), now: time.Now}
+}
+
+// Add records n events at the current time.
+func (m *RateMeter) Add(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sec := m.advance()
+	m.buckets[sec%int64(len(m.buckets))] += uint64(n)
+}
+
+// Rate returns the average events per second over the window.
+func (m *RateMeter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance()
+
+	var total uint64
+	for _, b := range m.buckets {
+		total += b
+	}
+	return float64(total) / float64(len(m.buckets))
+}
+
+// advance clears buckets for seconds that passed since the last update and
+// returns the current second. Caller must hold m.mu.
+func (m *RateMeter) advance() int64 {
+	sec := m.now().Unix()
+	if m.last == 0 {
+		m.last = sec
+		return sec
+	}
+
+	gap := sec - m.last
+	if gap > int64(len(m.buckets)) {
+		gap = int64(len(m.buckets))
+	}
+	for i := int64(1); i <= gap; i++ {
+		m.buckets[(m.last+i)%int64(len(m.buckets))] = 0
+	}
+	if sec > m.last {
+		m.last = sec
+	}
+	return m.last
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestRateMeter returns a meter whose clock is *now.
+func newTestRateMeter(window time.Duration, now *time.Time) *RateMeter {
+	m := NewRateMeter(window)
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestRateMeterWithFakeClock(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestRateMeter(10*time.Second, &now)
+
+	// 50 events a second for a full window
+	for i := 0; i < 10; i++ {
+		m.Add(50)
+		now = now.Add(time.Second)
+	}
+	now = now.Add(-time.Second)
+	if got := m.Rate(); got != 50 {
+		t.Errorf("steady rate = %v, want 50/s", got)
+	}
+
+	// Half the window without events halves the rate
+	now = now.Add(5 * time.Second)
+	if got := m.Rate(); got != 25 {
+		t.Errorf("rate after 5s idle = %v, want 25/s", got)
+	}
+
+	// A stall longer than the window reads zero
+	now = now.Add(time.Minute)
+	if got := m.Rate(); got != 0 {
+		t.Errorf("rate after a stall = %v, want 0", got)
+	}
+
+	m.Add(30)
+	if got := m.Rate(); got != 3 {
+		t.Errorf("rate after restart = %v, want 30 over the 10s window", got)
+	}
+}
+
+func TestIngestUpdatesRateAndUtilization(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCollector(Config{EventBufferSize: 1000, BatchSize: 100}, &memStore{})
+	c.ingestRate = newTestRateMeter(ingestRateWindow, &now)
+
+	c.Ingest(testEvents(250))
+	if got := c.channelUtilization(); got != 25 {
+		t.Errorf("channel utilization = %v%%, want 25%%", got)
+	}
+	if got := c.ingestRate.Rate(); got != 250/ingestRateWindow.Seconds() {
+		t.Errorf("ingest rate = %v/s, want 250 over the window", got)
+	}
+}
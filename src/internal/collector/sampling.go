@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// RawSampler decides which raw events are retained. The decision hashes the
+// event's flow identity, so all events of a given flow are consistently kept
+// or dropped.
+type RawSampler struct {
+	rate      float64
+	threshold uint64
+	all       bool
+}
+
+// NewRawSampler creates a sampler retaining roughly rate (0-1] of flows.
+// A rate of 1 or more retains everything.
+func NewRawSampler(rate float64) *RawSampler {
+	if rate >= 1 {
+		return &RawSampler{all: true}
+	}
+	if rate <= 0 {
+		return &RawSampler{}
+	}
+	return &RawSampler{rate: rate, threshold: uint64(rate * math.MaxUint64)}
+}
+
+// Retain reports whether the event's raw row should be stored.
+func (s *RawSampler) Retain(e *types.TransferEvent) bool {
+	if s.all {
+		return true
+	}
+	return flowHash(e) < s.threshold
+}
+
+// Split partitions events into retained and aggregate-only sets. Retained
+// events record the sample rate, so raw-event queries can report how much
+// of the traffic their totals cover.
+func (s *RawSampler) Split(events []types.TransferEvent) (retained, dropped []types.TransferEvent) {
+	if s.all {
+		return events, nil
+	}
+	for i := range events {
+		if s.Retain(&events[i]) {
+			events[i].RawSampleRate = s.rate
+			retained = append(retained, events[i])
+		} else {
+			dropped = append(dropped, events[i])
+		}
+	}
+	return retained, dropped
+}
+
+// flowHash hashes the source and destination identity of an event.
+func flowHash(e *types.TransferEvent) uint64 {
+	h := fnv.New64a()
+	writeEndpoint(h, e.Source)
+	h.Write([]byte{0})
+	writeEndpoint(h, e.Destination)
+	h.Write([]byte(e.Protocol))
+	return h.Sum64()
+}
+
+// writeEndpoint writes the stable identity of an endpoint: the service when
+// known, otherwise the IP. Ports are excluded since client ports are ephemeral.
+func writeEndpoint(h interface{ Write([]byte) (int, error) }, ep types.Endpoint) {
+	if ep.Identity != nil {
+		h.Write([]byte(ep.Identity.FullName()))
+		return
+	}
+	h.Write([]byte(ep.IP))
+}
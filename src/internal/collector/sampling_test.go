@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// sampledEvents returns three events for each of n flows, with bytes
+// varying by flow.
+func sampledEvents(n int) []types.TransferEvent {
+	var events []types.TransferEvent
+	for i := 0; i < n; i++ {
+		for j := 0; j < 3; j++ {
+			events = append(events, types.TransferEvent{
+				Source:      types.Endpoint{IP: "10.0.0.1", Identity: &types.ServiceIdentity{Namespace: "shop", Name: fmt.Sprintf("svc-%d", i)}},
+				Destination: types.Endpoint{IP: "203.0.113.10", Port: 443},
+				Protocol:    "tcp",
+				BytesSent:   uint64(1000 + i%7*100),
+			})
+		}
+	}
+	return events
+}
+
+// TestSampledTotalsMatch checks the retained share of traffic is close to
+// the rate recorded on retained events, which raw-event queries report as
+// their coverage.
+func TestSampledTotalsMatch(t *testing.T) {
+	const rate = 0.25
+	events := sampledEvents(5000)
+	var want float64
+	for _, e := range events {
+		want += float64(e.TotalBytes())
+	}
+
+	retained, dropped := NewRawSampler(rate).Split(events)
+
+	var got float64
+	for _, e := range retained {
+		if e.RawSampleRate != rate {
+			t.Fatalf("retained event has raw sample rate %v, want %v", e.RawSampleRate, rate)
+		}
+		got += float64(e.TotalBytes())
+	}
+	for _, e := range dropped {
+		if e.RawSampleRate != 0 {
+			t.Fatalf("dropped event has raw sample rate %v, want unset", e.RawSampleRate)
+		}
+	}
+	if share := got / want; math.Abs(share-rate)/rate > 0.05 {
+		t.Errorf("retained %.3f of the traffic, want within 5%% of %v", share, rate)
+	}
+	if len(retained)+len(dropped) != len(events) {
+		t.Errorf("split %d+%d events, want %d", len(retained), len(dropped), len(events))
+	}
+}
+
+func TestSamplerKeepsFlowsTogether(t *testing.T) {
+	retained, _ := NewRawSampler(0.5).Split(sampledEvents(200))
+
+	perFlow := make(map[string]int)
+	for _, e := range retained {
+		perFlow[e.Source.Identity.Name]++
+	}
+	for flow, n := range perFlow {
+		if n != 3 {
+			t.Errorf("flow %s kept %d of 3 events", flow, n)
+		}
+	}
+}
+
+func TestSamplerRetainsAllAtFullRate(t *testing.T) {
+	events := sampledEvents(10)
+	retained, dropped := NewRawSampler(1).Split(events)
+
+	if len(retained) != len(events) || len(dropped) != 0 {
+		t.Fatalf("kept %d and dropped %d of %d events", len(retained), len(dropped), len(events))
+	}
+	if retained[0].RawSampleRate != 0 {
+		t.Errorf("raw sample rate = %v, want unset", retained[0].RawSampleRate)
+	}
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// Reasons an event fails validation, used as metric labels.
+const (
+	invalidMissingTimestamp    = "missing_timestamp"
+	invalidSourceIP            = "invalid_source_ip"
+	invalidDestinationIP       = "invalid_destination_ip"
+	invalidMissingTransferType = "missing_transfer_type"
+	invalidSampleRate          = "invalid_sample_rate"
+)
+
+// validateEvent checks that an event can be stored and attributed. It
+// returns the reason it is invalid, or "" if it is valid.
+func validateEvent(e types.TransferEvent) string {
+	switch {
+	case e.Timestamp.IsZero():
+		return invalidMissingTimestamp
+	case net.ParseIP(e.Source.IP) == nil:
+		return invalidSourceIP
+	case net.ParseIP(e.Destination.IP) == nil:
+		return invalidDestinationIP
+	case e.Type == "":
+		return invalidMissingTransferType
+	case e.SampleRate < 0 || e.SampleRate > 1:
+		return invalidSampleRate
+	}
+	return ""
+}
+
+// dryRunMetrics counts events validated in dry-run mode.
+type dryRunMetrics struct {
+	valid   prometheus.Counter
+	invalid *prometheus.CounterVec
+}
+
+func newDryRunMetrics() *dryRunMetrics {
+	return &dryRunMetrics{
+		valid: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "egressor_collector_dry_run_events_valid_total",
+			Help: "Events that passed validation in dry-run mode",
+		}),
+		invalid: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "egressor_collector_dry_run_events_invalid_total",
+			Help: "Events that failed validation in dry-run mode, by reason",
+		}, []string{"reason"}),
+	}
+}
+
+// Collectors returns the dry-run metrics for registration.
+func (m *dryRunMetrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.valid, m.invalid}
+}
+
+// rejectEvent counts an event that failed validation before being queued.
+// In dry-run mode it also counts as an invalid dry-run event, as it never
+// reaches validateBatch.
+func (c *Collector) rejectEvent(reason string) {
+	c.eventsRejected.WithLabelValues(reason).Inc()
+	if c.dryRun != nil {
+		c.dryRun.invalid.WithLabelValues(reason).Inc()
+	}
+}
+
+// validateBatch validates a batch in place of writing it and returns the
+// number of valid events.
+func (c *Collector) validateBatch(batch []types.TransferEvent) int {
+	valid := 0
+	for _, e := range batch {
+		if reason := validateEvent(e); reason != "" {
+			c.dryRun.invalid.WithLabelValues(reason).Inc()
+			continue
+		}
+		c.dryRun.valid.Inc()
+		valid++
+	}
+	return valid
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestValidateEvent(t *testing.T) {
+	tests := []struct {
+		mutate func(e *types.TransferEvent)
+		want   string
+	}{
+		{func(e *types.TransferEvent) {}, ""},
+		{func(e *types.TransferEvent) { e.Timestamp = time.Time{} }, invalidMissingTimestamp},
+		{func(e *types.TransferEvent) { e.Source.IP = "10.0.0" }, invalidSourceIP},
+		{func(e *types.TransferEvent) { e.Destination.IP = "" }, invalidDestinationIP},
+		{func(e *types.TransferEvent) { e.Type = "" }, invalidMissingTransferType},
+		{func(e *types.TransferEvent) { e.SampleRate = 2 }, invalidSampleRate},
+	}
+	for _, tt := range tests {
+		e := testEvents(1)[0]
+		tt.mutate(&e)
+		if got := validateEvent(e); got != tt.want {
+			t.Errorf("validateEvent = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestDryRunCountsWithoutWriting(t *testing.T) {
+	store := &memStore{}
+	c := newTestCollector(Config{BatchSize: 4, FlushInterval: time.Hour, DryRun: true}, store)
+	c.dryRun = newDryRunMetrics()
+
+	events := testEvents(10)
+	events[0].Timestamp = time.Time{}
+	events[1].Source.IP = "not-an-ip"
+	events[2].SampleRate = -0.5
+	c.Ingest(events)
+	close(c.doneChan)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(c.eventsReceived); got != 10 {
+		t.Errorf("received = %v, want 10", got)
+	}
+	if got := testutil.ToFloat64(c.dryRun.valid); got != 7 {
+		t.Errorf("valid = %v, want 7", got)
+	}
+	for _, reason := range []string{invalidMissingTimestamp, invalidSourceIP, invalidSampleRate} {
+		if got := testutil.ToFloat64(c.dryRun.invalid.WithLabelValues(reason)); got != 1 {
+			t.Errorf("invalid %s = %v, want 1", reason, got)
+		}
+	}
+	if store.stored() != 0 || len(store.aggregate) != 0 || store.atomic != 0 {
+		t.Errorf("store received %d events, %d aggregate-only, %d atomic flushes; want nothing", store.stored(), len(store.aggregate), store.atomic)
+	}
+	if got := testutil.ToFloat64(c.eventsStored); got != 0 {
+		t.Errorf("stored = %v, want 0", got)
+	}
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// anomalyStoreTimeout bounds a single anomaly write.
+const anomalyStoreTimeout = 5 * time.Second
+
+// AnomalyStore persists anomalies for history beyond the in-memory set.
+type AnomalyStore interface {
+	InsertAnomaly(ctx context.Context, anomaly types.Anomaly) error
+	UpdateAnomaly(ctx context.Context, anomaly types.Anomaly) error
+}
+
+// SetAnomalyStore sets where anomalies are persisted when they are added,
+// acknowledged or resolved.
+func (e *BaselineEngine) SetAnomalyStore(store AnomalyStore) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.store = store
+}
+
+// persistAnomaly writes a snapshot of an anomaly to the store, if any.
+// Failures are logged; the in-memory anomaly stays authoritative.
+func persistAnomaly(store AnomalyStore, anomaly types.Anomaly, created bool) {
+	if store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), anomalyStoreTimeout)
+	defer cancel()
+
+	var err error
+	if created {
+		err = store.InsertAnomaly(ctx, anomaly)
+	} else {
+		err = store.UpdateAnomaly(ctx, anomaly)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("anomaly", anomaly.ID.String()).Msg("Failed to persist anomaly")
+	}
+}
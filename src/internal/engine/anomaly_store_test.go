@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// recordingAnomalyStore records persisted anomaly snapshots.
+type recordingAnomalyStore struct {
+	mu       sync.Mutex
+	inserted []types.Anomaly
+	updated  []types.Anomaly
+}
+
+func (s *recordingAnomalyStore) InsertAnomaly(_ context.Context, a types.Anomaly) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inserted = append(s.inserted, a)
+	return nil
+}
+
+func (s *recordingAnomalyStore) UpdateAnomaly(_ context.Context, a types.Anomaly) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updated = append(s.updated, a)
+	return nil
+}
+
+func TestAnomalyLifecyclePersisted(t *testing.T) {
+	e := NewBaselineEngine(3)
+	store := &recordingAnomalyStore{}
+	e.SetAnomalyStore(store)
+
+	id := uuid.New()
+	e.AddAnomaly(&types.Anomaly{ID: id, Type: types.AnomalyTypeSpike, Severity: types.SeverityHigh})
+	if err := e.AcknowledgeAnomaly(id, "oncall"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ResolveAnomaly(id, "expected backfill", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.inserted) != 1 || store.inserted[0].ID != id || store.inserted[0].Acknowledged {
+		t.Errorf("inserted = %+v, want the new anomaly once", store.inserted)
+	}
+	if len(store.updated) != 2 {
+		t.Fatalf("updated %d times, want on acknowledge and resolve", len(store.updated))
+	}
+	if ack := store.updated[0]; !ack.Acknowledged || ack.Resolved {
+		t.Errorf("acknowledge persisted %+v, want acknowledged only", ack)
+	}
+	if res := store.updated[1]; !res.Acknowledged || !res.Resolved {
+		t.Errorf("resolve persisted %+v, want acknowledged and resolved", res)
+	}
+
+	if err := e.AcknowledgeAnomaly(uuid.New(), "oncall"); err != ErrAnomalyNotFound {
+		t.Errorf("acknowledging an unknown anomaly = %v, want ErrAnomalyNotFound", err)
+	}
+	if len(store.updated) != 2 {
+		t.Error("an unknown anomaly was persisted")
+	}
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// Asymmetry detection defaults.
+const (
+	DefaultAsymmetryRatio    = 10.0
+	DefaultAsymmetryMinBytes = 1 << 20 // Ignore pairs and services moving less than 1 MiB
+)
+
+// AsymmetricEdge is a pair of in-cluster services where traffic in one
+// direction dwarfs the other. SourceID is the heavier sender.
+type AsymmetricEdge struct {
+	SourceID      string  `json:"source_id"`
+	DestinationID string  `json:"destination_id"`
+	ForwardBytes  uint64  `json:"forward_bytes"`
+	ReverseBytes  uint64  `json:"reverse_bytes"`
+	Ratio         float64 `json:"ratio"`
+}
+
+// AsymmetricNode is a service that sends far more than it receives or the
+// other way around.
+type AsymmetricNode struct {
+	ID            string  `json:"id"`
+	BytesSent     uint64  `json:"bytes_sent"`
+	BytesReceived uint64  `json:"bytes_received"`
+	Ratio         float64 `json:"ratio"` // Larger direction over smaller
+}
+
+// AsymmetryReport lists strongly one-directional edges and services,
+// most asymmetric first.
+type AsymmetryReport struct {
+	Edges []AsymmetricEdge `json:"edges"`
+	Nodes []AsymmetricNode `json:"nodes"`
+}
+
+// asymmetryRatio is the larger of a and b over the smaller. A silent
+// direction counts as one byte so the ratio stays finite.
+func asymmetryRatio(a, b uint64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	if b == 0 {
+		b = 1
+	}
+	return float64(a) / float64(b)
+}
+
+// GetAsymmetric returns service pairs and services whose traffic in one
+// direction is at least ratio times the other. Only pairs and services
+// moving at least minBytes in total are considered. External endpoints
+// never send in this graph, so edges to them are not reported.
+func (g *TransferGraph) GetAsymmetric(ratio float64, minBytes uint64) AsymmetryReport {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	report := AsymmetryReport{Edges: []AsymmetricEdge{}, Nodes: []AsymmetricNode{}}
+
+	seen := make(map[string]bool)
+	for id, edge := range g.edges {
+		if seen[id] {
+			continue
+		}
+		if _, ok := g.nodes[edge.DestinationID]; !ok || edge.SourceID == edge.DestinationID {
+			continue
+		}
+
+		seen[id] = true
+		var reverseBytes uint64
+		reverseID := types.JoinFlowKey(edge.DestinationID, edge.SourceID)
+		if reverse, ok := g.edges[reverseID]; ok {
+			reverseBytes = reverse.TotalBytes
+			seen[reverseID] = true
+		}
+
+		if edge.TotalBytes+reverseBytes < minBytes {
+			continue
+		}
+		r := asymmetryRatio(edge.TotalBytes, reverseBytes)
+		if r < ratio {
+			continue
+		}
+
+		a := AsymmetricEdge{
+			SourceID:      edge.SourceID,
+			DestinationID: edge.DestinationID,
+			ForwardBytes:  edge.TotalBytes,
+			ReverseBytes:  reverseBytes,
+			Ratio:         r,
+		}
+		if reverseBytes > edge.TotalBytes {
+			a.SourceID, a.DestinationID = a.DestinationID, a.SourceID
+			a.ForwardBytes, a.ReverseBytes = a.ReverseBytes, a.ForwardBytes
+		}
+		report.Edges = append(report.Edges, a)
+	}
+
+	for _, node := range g.nodes {
+		if node.TotalBytesSent+node.TotalBytesReceived < minBytes {
+			continue
+		}
+		r := asymmetryRatio(node.TotalBytesSent, node.TotalBytesReceived)
+		if r < ratio {
+			continue
+		}
+		report.Nodes = append(report.Nodes, AsymmetricNode{
+			ID:            node.ID,
+			BytesSent:     node.TotalBytesSent,
+			BytesReceived: node.TotalBytesReceived,
+			Ratio:         r,
+		})
+	}
+
+	sort.Slice(report.Edges, func(i, j int) bool { return report.Edges[i].Ratio > report.Edges[j].Ratio })
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Ratio > report.Nodes[j].Ratio })
+	return report
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestGetAsymmetric(t *testing.T) {
+	g := NewGraphEngine(nil)
+	for _, f := range []types.TransferFlow{
+		serviceFlow("api", "db", 10<<20),
+		serviceFlow("db", "api", 9<<20),
+		serviceFlow("etl", "warehouse", 50<<20),
+		serviceFlow("warehouse", "etl", 1<<20),
+		serviceFlow("cron", "queue", 1<<10), // One-way but below the byte floor
+	} {
+		g.AddFlow(f)
+	}
+
+	report := g.GetGraph().GetAsymmetric(DefaultAsymmetryRatio, DefaultAsymmetryMinBytes)
+
+	if len(report.Edges) != 1 {
+		t.Fatalf("edges = %+v, want only etl -> warehouse", report.Edges)
+	}
+	e := report.Edges[0]
+	if e.SourceID != "shop/etl" || e.DestinationID != "shop/warehouse" || e.ForwardBytes != 50<<20 || e.ReverseBytes != 1<<20 || e.Ratio != 50 {
+		t.Errorf("edge = %+v, want etl sending 50x what it receives", e)
+	}
+
+	nodes := make(map[string]AsymmetricNode)
+	for _, n := range report.Nodes {
+		nodes[n.ID] = n
+	}
+	if len(nodes) != 2 || nodes["shop/etl"].BytesSent != 50<<20 || nodes["shop/warehouse"].BytesReceived != 50<<20 {
+		t.Errorf("nodes = %+v, want etl and warehouse only", report.Nodes)
+	}
+
+	// Lowering the ratio below api <-> db's 1.1 reports it too
+	if report := g.GetGraph().GetAsymmetric(1.05, DefaultAsymmetryMinBytes); len(report.Edges) != 2 || report.Edges[1].SourceID != "shop/api" {
+		t.Errorf("edges at ratio 1.05 = %+v, want etl then api", report.Edges)
+	}
+}
+
+func TestAsymmetryRatio(t *testing.T) {
+	for _, tt := range []struct {
+		a, b uint64
+		want float64
+	}{{100, 10, 10}, {10, 100, 10}, {5, 0, 5}, {0, 0, 0}} {
+		if got := asymmetryRatio(tt.a, tt.b); got != tt.want {
+			t.Errorf("asymmetryRatio(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// AttributionBuilder accumulates cost attribution from flows added in
+// chunks, so attribution over long periods can be computed while streaming
+// flows from storage instead of holding them all. Feeding all flows in any
+// number of chunks gives the same result as CalculateAttribution. Free
+// tiers and tiered rates apply to the period's flows together, in the order
+// they are added, starting from the usage of flows passed to Seed, if any.
+// Memory grows with the number of
+// groups, not flows: each group keeps one breakdown per cost category and
+// pricing rule.
+type AttributionBuilder struct {
+	engine      *CostEngine
+	periodStart time.Time
+	periodEnd   time.Time
+	groupKey    func(types.TransferFlow) string
+	dimension   string // Set when grouping by an attribution dimension
+
+	// Groups in first-seen order, for deterministic output
+	groups map[string]*attributionGroup
+	keys   []string
+
+	// GB priced so far per month, provider and category
+	usage map[string]float64
+}
+
+// attributionGroup is one group's attribution and where each of its
+// breakdowns is in attr.Breakdown.
+type attributionGroup struct {
+	attr      types.CostAttribution
+	breakdown map[breakdownKey]int
+}
+
+// breakdownKey identifies the breakdown a flow's cost is added to within
+// its group.
+type breakdownKey struct {
+	category types.CostCategory
+	ruleID   uuid.UUID // Zero when priced at the default rate
+	exempt   bool
+}
+
+// NewAttributionBuilder starts attribution for a period, grouped per
+// service, or by the value of dimension (e.g. "team") when it is set.
+func (e *CostEngine) NewAttributionBuilder(periodStart, periodEnd time.Time, dimension string) *AttributionBuilder {
+	groupKey := func(flow types.TransferFlow) string {
+		return flow.SourceIdentity.FullName()
+	}
+	if dimension != "" {
+		groupKey = e.dimensionGroupKey(dimension)
+	}
+	b := e.newAttributionBuilder(periodStart, periodEnd, groupKey)
+	b.dimension = dimension
+	return b
+}
+
+func (e *CostEngine) newAttributionBuilder(periodStart, periodEnd time.Time, groupKey func(types.TransferFlow) string) *AttributionBuilder {
+	return &AttributionBuilder{
+		engine:      e,
+		periodStart: periodStart,
+		periodEnd:   periodEnd,
+		groupKey:    groupKey,
+		groups:      make(map[string]*attributionGroup),
+		usage:       make(map[string]float64),
+	}
+}
+
+// Seed counts flows sent earlier in the month of the period end toward
+// usage without attributing them, so the period's flows are priced where
+// the month's free tier and tiers stand rather than as the first of their
+// month. Seed before adding flows. The slice is not kept.
+func (b *AttributionBuilder) Seed(flows []types.TransferFlow) {
+	b.engine.mu.RLock()
+	defer b.engine.mu.RUnlock()
+	for _, flow := range flows {
+		// Count toward the month the period's flows are priced in
+		flow.WindowEnd = b.periodEnd
+		b.engine.calculateCost(flow, b.usage, true)
+	}
+}
+
+// Add prices flows and adds them to their groups. The slice is not kept.
+func (b *AttributionBuilder) Add(flows []types.TransferFlow) {
+	for _, flow := range flows {
+		key := b.groupKey(flow)
+		group, ok := b.groups[key]
+		if !ok {
+			group = &attributionGroup{
+				attr:      b.newGroup(flow.SourceIdentity),
+				breakdown: make(map[breakdownKey]int),
+			}
+			b.groups[key] = group
+			b.keys = append(b.keys, key)
+		}
+
+		b.engine.mu.RLock()
+		breakdown := b.engine.calculateCost(flow, b.usage, true)
+		b.engine.mu.RUnlock()
+		group.add(flow, breakdown)
+	}
+}
+
+// add counts a priced flow toward the group.
+func (g *attributionGroup) add(flow types.TransferFlow, breakdown types.CostBreakdown) {
+	g.attr.TotalBytes += flow.TotalBytes
+	g.attr.TotalCostUSD += breakdown.CostUSD
+	if flow.RawSampleRate > 0 {
+		g.attr.RawSampleRate = types.LowerRawSampleRate(g.attr.RawSampleRate, flow.RawSampleRate)
+	}
+
+	key := breakdownKey{category: breakdown.Category, exempt: breakdown.Exempt}
+	if breakdown.PricingRuleID != nil {
+		key.ruleID = *breakdown.PricingRuleID
+	}
+	i, ok := g.breakdown[key]
+	if !ok {
+		breakdown.Charges = append([]types.TierCharge(nil), breakdown.Charges...)
+		g.breakdown[key] = len(g.attr.Breakdown)
+		g.attr.Breakdown = append(g.attr.Breakdown, breakdown)
+		return
+	}
+	mergeBreakdown(&g.attr.Breakdown[i], breakdown)
+}
+
+// mergeBreakdown adds b to the aggregate breakdown into. Services and
+// regions are kept only while every flow merged in shares them.
+func mergeBreakdown(into *types.CostBreakdown, b types.CostBreakdown) {
+	into.BytesTransferred += b.BytesTransferred
+	into.OverheadBytes += b.OverheadBytes
+	into.CostUSD += b.CostUSD
+	into.FreeTierGB += b.FreeTierGB
+	into.BilledGB += b.BilledGB
+
+	for _, c := range b.Charges {
+		i := slices.IndexFunc(into.Charges, func(x types.TierCharge) bool {
+			return x.ThresholdGB == c.ThresholdGB && x.CostPerGB == c.CostPerGB
+		})
+		if i < 0 {
+			into.Charges = append(into.Charges, c)
+			continue
+		}
+		into.Charges[i].GB += c.GB
+		into.Charges[i].CostUSD += c.CostUSD
+	}
+
+	if into.SourceService != b.SourceService {
+		into.SourceService = ""
+	}
+	if into.DestinationService != b.DestinationService {
+		into.DestinationService = ""
+	}
+	if into.SourceRegion != b.SourceRegion {
+		into.SourceRegion = ""
+	}
+	if into.DestinationRegion != b.DestinationRegion {
+		into.DestinationRegion = ""
+	}
+}
+
+// newGroup starts an attribution described by the group's first source.
+func (b *AttributionBuilder) newGroup(source types.ServiceIdentity) types.CostAttribution {
+	dims := b.engine.resolveDimensions(source)
+	attr := types.CostAttribution{
+		ID:                uuid.New(),
+		PeriodStart:       b.periodStart,
+		PeriodEnd:         b.periodEnd,
+		Namespace:         source.Namespace,
+		ServiceName:       source.Name,
+		DeploymentVersion: source.Version,
+		Team:              dims[DimensionTeam],
+		Environment:       dims[DimensionEnvironment],
+	}
+	delete(dims, DimensionTeam)
+	delete(dims, DimensionEnvironment)
+	if len(dims) > 0 {
+		attr.Dimensions = dims
+	}
+	return attr
+}
+
+// Attributions returns the attribution of every group seen so far.
+func (b *AttributionBuilder) Attributions() []types.CostAttribution {
+	var attributions []types.CostAttribution
+	for _, key := range b.keys {
+		attr := b.groups[key].attr
+		attr.Breakdown = make([]types.CostBreakdown, len(attr.Breakdown))
+		for i, breakdown := range b.groups[key].attr.Breakdown {
+			breakdown.Charges = append([]types.TierCharge(nil), breakdown.Charges...)
+			attr.Breakdown[i] = breakdown
+		}
+		attributions = append(attributions, attr)
+
+		log.Debug().
+			Str("group", key).
+			Uint64("bytes", attr.TotalBytes).
+			Float64("cost_usd", attr.TotalCostUSD).
+			Msg("Cost attribution calculated")
+	}
+	if b.dimension != "" {
+		scopeToDimension(attributions, b.dimension)
+	}
+	return attributions
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// attributionFlows returns flows from several services, teams and
+// categories, enough to cross the tiered rule's free tier and first tier.
+func attributionFlows(end time.Time) []types.TransferFlow {
+	var flows []types.TransferFlow
+	for i := 0; i < 40; i++ {
+		flow := azureEgress(fmt.Sprintf("svc-%d", i%4), 0.4+float64(i%3)*0.3, end)
+		flow.SourceIdentity.Team = []string{"payments", "search"}[i%2]
+		if i%5 == 0 {
+			flow.Type = types.TransferTypeCrossAZ
+		}
+		flow.DestinationEndpoint = &types.Endpoint{IP: fmt.Sprintf("203.0.113.%d", i)}
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+// withoutIDs zeroes the random attribution IDs so results can be compared.
+func withoutIDs(attrs []types.CostAttribution) []types.CostAttribution {
+	for i := range attrs {
+		attrs[i].ID = uuid.Nil
+	}
+	return attrs
+}
+
+func TestChunkedAttributionMatchesInMemory(t *testing.T) {
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	flows := attributionFlows(end)
+	e := newTieredEngine()
+
+	for _, dimension := range []string{"", DimensionTeam} {
+		b := e.NewAttributionBuilder(start, end, dimension)
+		b.Add(flows)
+		want := withoutIDs(b.Attributions())
+		if dimension == "" {
+			inMemory := withoutIDs(e.CalculateAttribution(context.Background(), flows, start, end))
+			if !reflect.DeepEqual(inMemory, want) {
+				t.Fatalf("CalculateAttribution differs from a single Add:\n%+v\n%+v", inMemory, want)
+			}
+		}
+
+		for _, size := range []int{1, 3, 7, len(flows)} {
+			chunked := e.NewAttributionBuilder(start, end, dimension)
+			for i := 0; i < len(flows); i += size {
+				chunked.Add(flows[i:min(i+size, len(flows))])
+			}
+			if got := withoutIDs(chunked.Attributions()); !reflect.DeepEqual(got, want) {
+				t.Errorf("dimension %q, chunks of %d: got\n%+v\nwant\n%+v", dimension, size, got, want)
+			}
+		}
+	}
+}
+
+func TestAttributionAggregatesBreakdowns(t *testing.T) {
+	end := time.Now()
+	var flows []types.TransferFlow
+	for i := 0; i < 1000; i++ {
+		flows = append(flows, azureEgress("api", 0.01, end))
+	}
+
+	attrs := newTieredEngine().CalculateAttribution(context.Background(), flows, end.Add(-time.Hour), end)
+	if len(attrs) != 1 {
+		t.Fatalf("got %d attributions, want 1", len(attrs))
+	}
+	a := attrs[0]
+	if len(a.Breakdown) != 1 {
+		t.Fatalf("got %d breakdowns for one category, want 1", len(a.Breakdown))
+	}
+
+	b := a.Breakdown[0]
+	if b.BytesTransferred != a.TotalBytes || !approxEqual(b.CostUSD, a.TotalCostUSD) {
+		t.Errorf("breakdown %d bytes $%v, attribution %d bytes $%v", b.BytesTransferred, b.CostUSD, a.TotalBytes, a.TotalCostUSD)
+	}
+	// 10GB in total: 1GB free, 9GB in the first tier
+	if !approxEqual(b.FreeTierGB, 1) || !approxEqual(b.BilledGB, float64(a.TotalBytes)/gib-1) {
+		t.Errorf("free %vGB billed %vGB, want 1GB free and the rest billed", b.FreeTierGB, b.BilledGB)
+	}
+	if len(b.Charges) != 1 || !approxEqual(b.Charges[0].CostUSD, b.CostUSD) {
+		t.Errorf("charges = %+v, want one tier summing to $%v", b.Charges, b.CostUSD)
+	}
+	if b.DestinationService != "203.0.113.10" || b.SourceService != "shop/api" {
+		t.Errorf("services %q -> %q, want the shared ones kept", b.SourceService, b.DestinationService)
+	}
+}
+
+func TestAttributionSeededWithEarlierFlowsOfTheMonth(t *testing.T) {
+	end := time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+	start := end.Add(-24 * time.Hour)
+	flow := azureEgress("api", 0.5, end)
+
+	unseeded := newTieredEngine().NewAttributionBuilder(start, end, "")
+	unseeded.Add([]types.TransferFlow{flow})
+	if b := unseeded.Attributions()[0].Breakdown[0]; !approxEqual(b.FreeTierGB, 0.5) || b.CostUSD != 0 {
+		t.Fatalf("unseeded: free %vGB $%v, want the flow free", b.FreeTierGB, b.CostUSD)
+	}
+
+	// 0.75GB sent earlier in March leaves 0.25GB of the free tier
+	seeded := newTieredEngine().NewAttributionBuilder(start, end, "")
+	seeded.Seed([]types.TransferFlow{azureEgress("web", 0.75, start)})
+	seeded.Add([]types.TransferFlow{flow})
+
+	attrs := seeded.Attributions()
+	if len(attrs) != 1 || attrs[0].ServiceName != "api" {
+		t.Fatalf("got %+v, want only the period's flow attributed", attrs)
+	}
+	b := attrs[0].Breakdown[0]
+	if !approxEqual(b.FreeTierGB, 0.25) || !approxEqual(b.BilledGB, 0.25) || b.CostUSD == 0 {
+		t.Errorf("seeded: free %vGB billed %vGB $%v, want 0.25GB free and 0.25GB billed", b.FreeTierGB, b.BilledGB, b.CostUSD)
+	}
+}
+
+func TestAttributionsAreCopies(t *testing.T) {
+	end := time.Now()
+	b := newTieredEngine().NewAttributionBuilder(end.Add(-time.Hour), end, "")
+	b.Add([]types.TransferFlow{azureEgress("api", 3, end)})
+
+	first := b.Attributions()
+	first[0].Breakdown[0].Charges[0].CostUSD = 999
+	if got := b.Attributions()[0].Breakdown[0].Charges[0].CostUSD; got == 999 {
+		t.Error("changing a returned attribution changed the builder")
+	}
+}
+
+func TestAttributionByVersionSplitsCanary(t *testing.T) {
+	end := time.Now()
+	start := end.Add(-time.Hour)
+	stable := azureEgress("api", 2, end)
+	stable.SourceIdentity.Version = "v1"
+	canary := azureEgress("api", 6, end)
+	canary.SourceIdentity.Version = "v2"
+
+	attrs := newTieredEngine().CalculateAttributionByVersion(context.Background(), []types.TransferFlow{stable, canary}, start, end)
+	if len(attrs) != 2 {
+		t.Fatalf("got %d attributions, want one per version", len(attrs))
+	}
+	byVersion := make(map[string]types.CostAttribution)
+	for _, a := range attrs {
+		if a.ServiceName != "api" {
+			t.Errorf("service = %q, want api", a.ServiceName)
+		}
+		byVersion[a.DeploymentVersion] = a
+	}
+	if byVersion["v1"].TotalBytes != stable.TotalBytes || byVersion["v2"].TotalBytes != canary.TotalBytes {
+		t.Errorf("bytes v1 %d v2 %d, want %d and %d", byVersion["v1"].TotalBytes, byVersion["v2"].TotalBytes, stable.TotalBytes, canary.TotalBytes)
+	}
+	if byVersion["v2"].TotalCostUSD <= byVersion["v1"].TotalCostUSD {
+		t.Errorf("canary cost $%v not above stable $%v", byVersion["v2"].TotalCostUSD, byVersion["v1"].TotalCostUSD)
+	}
+
+	// Per service, the versions are one attribution
+	if attrs := newTieredEngine().CalculateAttribution(context.Background(), []types.TransferFlow{stable, canary}, start, end); len(attrs) != 1 {
+		t.Errorf("got %d attributions per service, want 1", len(attrs))
+	}
+}
+
+func TestAttributionReportsLowestRawSampleRate(t *testing.T) {
+	end := time.Now()
+	flows := attributionFlows(end)[:4]
+	for i := range flows {
+		flows[i].SourceIdentity.Name = "api"
+	}
+	flows[1].RawSampleRate = 0.25
+	flows[2].RawSampleRate = 1
+
+	attrs := newTieredEngine().CalculateAttribution(context.Background(), flows, end.Add(-time.Hour), end)
+	if len(attrs) != 1 {
+		t.Fatalf("got %d attributions, want one for api", len(attrs))
+	}
+	var bytes uint64
+	for _, f := range flows {
+		bytes += f.TotalBytes
+	}
+	if attrs[0].RawSampleRate != 0.25 || attrs[0].TotalBytes != bytes {
+		t.Errorf("attribution = %d bytes at coverage %v, want %d unscaled bytes at 0.25",
+			attrs[0].TotalBytes, attrs[0].RawSampleRate, bytes)
+	}
+}
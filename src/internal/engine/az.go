@@ -0,0 +1,69 @@
+package engine
+
+import "sort"
+
+// unknownAZ labels traffic whose zone was not recorded.
+const unknownAZ = "unknown"
+
+// azPair is a source/destination availability zone pair.
+type azPair struct {
+	src, dst string
+}
+
+// AZMatrix is service-to-service traffic collapsed to availability zones.
+// Bytes[i][j] is the volume sent from Zones[i] to Zones[j].
+type AZMatrix struct {
+	Zones        []string   `json:"zones"`
+	Bytes        [][]uint64 `json:"bytes"`
+	TotalBytes   uint64     `json:"total_bytes"`
+	CrossAZBytes uint64     `json:"cross_az_bytes"` // Off-diagonal total, excluding unknown zones
+}
+
+// recordAZ adds flow bytes to the zone matrix. Caller must hold g.mu.
+func (g *TransferGraph) recordAZ(srcAZ, dstAZ string, bytes uint64) {
+	if srcAZ == "" {
+		srcAZ = unknownAZ
+	}
+	if dstAZ == "" {
+		dstAZ = unknownAZ
+	}
+	if g.azBytes == nil {
+		g.azBytes = make(map[azPair]uint64)
+	}
+	g.azBytes[azPair{srcAZ, dstAZ}] += bytes
+}
+
+// GetAZMatrix returns in-cluster traffic between availability zones.
+// Traffic to external endpoints is not included.
+func (g *TransferGraph) GetAZMatrix() AZMatrix {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for p := range g.azBytes {
+		seen[p.src] = true
+		seen[p.dst] = true
+	}
+	zones := make([]string, 0, len(seen))
+	for z := range seen {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+
+	index := make(map[string]int, len(zones))
+	matrix := AZMatrix{Zones: zones, Bytes: make([][]uint64, len(zones))}
+	for i, z := range zones {
+		index[z] = i
+		matrix.Bytes[i] = make([]uint64, len(zones))
+	}
+
+	for p, b := range g.azBytes {
+		matrix.Bytes[index[p.src]][index[p.dst]] += b
+		matrix.TotalBytes += b
+		if p.src != p.dst && p.src != unknownAZ && p.dst != unknownAZ {
+			matrix.CrossAZBytes += b
+		}
+	}
+
+	return matrix
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestAZMatrixMatchesEdges(t *testing.T) {
+	e := NewGraphEngine(nil)
+	zoneOf := map[string]string{"api": "us-east-1a", "db": "us-east-1b", "cache": "us-east-1a", "worker": "us-east-1c", "legacy": ""}
+	for _, f := range []struct {
+		src, dst string
+		bytes    uint64
+	}{
+		{"api", "db", 1000},
+		{"api", "db", 500},
+		{"api", "cache", 300},
+		{"worker", "db", 2000},
+		{"db", "worker", 700},
+		{"legacy", "db", 50},
+	} {
+		flow := serviceFlow(f.src, f.dst, f.bytes)
+		flow.SourceIdentity.AvailabilityZone = zoneOf[f.src]
+		flow.DestinationIdentity.AvailabilityZone = zoneOf[f.dst]
+		e.AddFlow(flow)
+	}
+	// External traffic has no destination zone and is left out
+	e.AddFlow(types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api", AvailabilityZone: "us-east-1a"},
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          9999,
+	})
+
+	m := e.GetAZMatrix()
+	wantZones := []string{"unknown", "us-east-1a", "us-east-1b", "us-east-1c"}
+	if len(m.Zones) != len(wantZones) {
+		t.Fatalf("zones = %v, want %v", m.Zones, wantZones)
+	}
+	cell := make(map[[2]string]uint64)
+	var sum uint64
+	for i, src := range m.Zones {
+		if src != wantZones[i] {
+			t.Errorf("zone %d = %s, want %s", i, src, wantZones[i])
+		}
+		for j, dst := range m.Zones {
+			cell[[2]string{src, dst}] = m.Bytes[i][j]
+			sum += m.Bytes[i][j]
+		}
+	}
+
+	// Edge totals between service pairs, grouped by their zones
+	var edgeTotal, crossAZ uint64
+	want := make(map[[2]string]uint64)
+	for _, edge := range e.GetGraph().ToJSON().Edges {
+		if edge.Target == "external:203.0.113.10" {
+			continue
+		}
+		src, dst := zoneOf[edge.Source[len("shop/"):]], zoneOf[edge.Target[len("shop/"):]]
+		if src == "" {
+			src = "unknown"
+		}
+		want[[2]string{src, dst}] += edge.TotalBytes
+		edgeTotal += edge.TotalBytes
+		if src != dst && src != "unknown" {
+			crossAZ += edge.TotalBytes
+		}
+	}
+	for pair, bytes := range want {
+		if cell[pair] != bytes {
+			t.Errorf("%s -> %s = %d bytes, edges carry %d", pair[0], pair[1], cell[pair], bytes)
+		}
+	}
+	if sum != edgeTotal || m.TotalBytes != edgeTotal {
+		t.Errorf("matrix sums to %d, total %d; edges carry %d", sum, m.TotalBytes, edgeTotal)
+	}
+	if m.CrossAZBytes != crossAZ || crossAZ != 1500+2000+700 {
+		t.Errorf("cross-AZ = %d, want %d from api->db and worker<->db", m.CrossAZBytes, crossAZ)
+	}
+
+	e.Reset()
+	if m := e.GetAZMatrix(); len(m.Zones) != 0 || m.TotalBytes != 0 {
+		t.Errorf("after Reset matrix = %+v, want empty", m)
+	}
+}
@@ -3,8 +3,10 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"math"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,12 +16,32 @@ import (
 	"github.com/egressor/egressor/src/pkg/types"
 )
 
+// ErrAnomalyNotFound is returned when an anomaly ID is unknown.
+var ErrAnomalyNotFound = errors.New("anomaly not found")
+
 // BaselineEngine manages behavioral baselines and anomaly detection.
 type BaselineEngine struct {
 	baselines       map[string]*types.Baseline
 	anomalies       []*types.Anomaly
+	suppressions    []types.Suppression
+	feedback        map[string]*types.FlowFeedback
+	trusted         []trustedDestination
+	events          EventSource
+	store           AnomalyStore
+	detection       DetectionConfig
+	escalation      escalationState
 	thresholdStdDev float64
 	mu              sync.RWMutex
+
+	// minSamples hourly values are needed to build a baseline, and
+	// confidenceSamples before a baseline can raise anomalies.
+	minSamples        int
+	confidenceSamples int
+
+	// suspicious patterns flag egress destinations; suspiciousSeen holds
+	// the flow keys already reported.
+	suspicious     []SuspiciousPattern
+	suspiciousSeen map[string]bool
 }
 
 // NewBaselineEngine creates a new baseline engine.
@@ -29,7 +51,10 @@ func NewBaselineEngine(thresholdStdDev float64) *BaselineEngine {
 	}
 	return &BaselineEngine{
 		baselines:       make(map[string]*types.Baseline),
+		feedback:        make(map[string]*types.FlowFeedback),
+		detection:       DetectionConfig{Mode: DetectionZScore},
 		thresholdStdDev: thresholdStdDev,
+		minSamples:      defaultMinSamples,
 	}
 }
 
@@ -40,19 +65,23 @@ func (e *BaselineEngine) BuildBaseline(
 	hourlyValues []float64,
 	start, end time.Time,
 ) *types.Baseline {
-	if len(hourlyValues) < 24 { // Need at least 24 hours of data
+	e.mu.RLock()
+	minSamples := e.minSamples
+	e.mu.RUnlock()
+	if len(hourlyValues) < minSamples {
 		return nil
 	}
 
 	baseline := &types.Baseline{
 		ID:            uuid.New(),
-		SourceService: flowKey, // Will be parsed later
+		SourceService: flowKey,
 		BaselineStart: start,
 		BaselineEnd:   end,
 		SampleCount:   len(hourlyValues),
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
+	setFlowFields(baseline, flowKey)
 
 	// Calculate statistics
 	baseline.BytesPerHourMean = mean(hourlyValues)
@@ -106,41 +135,106 @@ func (e *BaselineEngine) BuildBaseline(
 	return baseline
 }
 
-// DetectAnomalies checks current values against baselines.
+// setFlowFields fills the baseline's source, destination and transfer type
+// from its flow key. In-cluster destinations ("namespace/name") become the
+// destination service; anything else, such as an external IP, the endpoint.
+// Unparseable keys are left whole in SourceService.
+func setFlowFields(baseline *types.Baseline, flowKey string) {
+	src, dst, transferType, ok := types.ParseFlowKey(flowKey)
+	if !ok {
+		return
+	}
+	baseline.SourceService = src
+	if strings.Contains(dst, "/") {
+		baseline.DestinationService = dst
+	} else {
+		baseline.DestinationEndpoint = dst
+	}
+	baseline.TransferType = string(transferType)
+}
+
+// DetectAnomalies checks current values against baselines. Keys of
+// currentFlows are flow keys; when an event source is set, each anomaly is
+// linked to the flow's largest recent events.
 func (e *BaselineEngine) DetectAnomalies(
 	ctx context.Context,
 	currentFlows map[string]float64,
 ) []*types.Anomaly {
+	anomalies := e.detectAnomalies(currentFlows, nil)
+	e.attachRelatedEvents(ctx, anomalies)
+	return anomalies
+}
+
+// DetectFlowAnomalies checks flows against baselines. A flow's current value
+// is its bytes per hour over its window, under its FlowKey(); flows sharing
+// a key add up. The key of an external destination is its IP, so anomalies
+// on it carry the hostname or cloud service from the flow instead, for
+// cause inference and trusted destinations.
+func (e *BaselineEngine) DetectFlowAnomalies(ctx context.Context, flows []types.TransferFlow) []*types.Anomaly {
+	current := make(map[string]float64, len(flows))
+	names := make(map[string]string)
+	for _, flow := range flows {
+		key := flow.FlowKey()
+		hours := flow.DurationSeconds() / 3600
+		if hours <= 0 {
+			hours = 1
+		}
+		current[key] += float64(flow.TotalBytes) / hours
+		if name := destinationName(flow); name != "" {
+			names[key] = name
+		}
+	}
+
+	anomalies := e.detectAnomalies(current, names)
+	e.attachRelatedEvents(ctx, anomalies)
+	return anomalies
+}
+
+// detectAnomalies compares current values against baselines. names holds
+// the destination names of flow keys whose destination is an IP.
+func (e *BaselineEngine) detectAnomalies(currentFlows map[string]float64, names map[string]string) []*types.Anomaly {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	var anomalies []*types.Anomaly
 
 	for flowKey, currentValue := range currentFlows {
+		name := names[flowKey]
 		baseline, ok := e.baselines[flowKey]
 		if !ok {
-			// Check if this is a new endpoint
-			if currentValue > 0 {
+			// Check if this is a new endpoint; trusted destinations are
+			// expected to appear
+			trusted := e.isTrusted(flowDestination(flowKey)) || e.isTrusted(name)
+			if currentValue > 0 && !trusted {
 				anomaly := &types.Anomaly{
-					ID:             uuid.New(),
-					Type:           types.AnomalyTypeNewEndpoint,
-					Severity:       types.SeverityInfo,
-					SourceService:  flowKey,
-					DetectedAt:     time.Now(),
-					CurrentValue:   currentValue,
-					BaselineValue:  0,
-					Deviation:      0,
-					AbsoluteDelta:  currentValue,
-					CreatedAt:      time.Now(),
-					UpdatedAt:      time.Now(),
+					ID:                  uuid.New(),
+					Type:                types.AnomalyTypeNewEndpoint,
+					Severity:            types.SeverityInfo,
+					SourceService:       flowKey,
+					DestinationEndpoint: name,
+					FlowKey:             flowKey,
+					DetectedAt:          time.Now(),
+					CurrentValue:        currentValue,
+					BaselineValue:       0,
+					Deviation:           0,
+					AbsoluteDelta:       currentValue,
+					CreatedAt:           time.Now(),
+					UpdatedAt:           time.Now(),
 				}
+				anomaly.PotentialCauses, anomaly.SuggestedActions = inferCauses(
+					anomaly.Type, causeDestination(flowKey, name), anomaly.DetectedAt)
+				e.applySuppressions(anomaly)
 				anomalies = append(anomalies, anomaly)
 			}
 			continue
 		}
+		if baseline.SampleCount < e.confidenceSamples {
+			continue // Too young to trust
+		}
 
-		if baseline.IsAnomalous(currentValue, e.thresholdStdDev) {
-			anomaly := e.createAnomaly(flowKey, baseline, currentValue)
+		if e.isAnomalous(flowKey, baseline, currentValue) {
+			anomaly := e.createAnomaly(flowKey, name, baseline, currentValue)
+			e.applySuppressions(anomaly)
 			anomalies = append(anomalies, anomaly)
 		}
 	}
@@ -148,9 +242,58 @@ func (e *BaselineEngine) DetectAnomalies(
 	return anomalies
 }
 
-// createAnomaly creates an anomaly from baseline deviation.
+// applySuppressions marks an anomaly suppressed if any window matches it.
+// Caller must hold e.mu.
+func (e *BaselineEngine) applySuppressions(anomaly *types.Anomaly) {
+	for i := range e.suppressions {
+		if e.suppressions[i].Matches(*anomaly) {
+			id := e.suppressions[i].ID
+			anomaly.Suppressed = true
+			anomaly.SuppressionID = &id
+			return
+		}
+	}
+}
+
+// AddSuppression registers a suppression window.
+func (e *BaselineEngine) AddSuppression(s types.Suppression) (types.Suppression, error) {
+	if s.Start.IsZero() || s.End.IsZero() {
+		return s, errors.New("suppression start and end are required")
+	}
+	if !s.End.After(s.Start) {
+		return s, errors.New("suppression end must be after start")
+	}
+
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	s.CreatedAt = time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.suppressions = append(e.suppressions, s)
+
+	log.Info().
+		Str("id", s.ID.String()).
+		Time("start", s.Start).
+		Time("end", s.End).
+		Str("flow", s.FlowKey).
+		Msg("Anomaly suppression added")
+
+	return s, nil
+}
+
+// GetSuppressions returns all registered suppression windows.
+func (e *BaselineEngine) GetSuppressions() []types.Suppression {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]types.Suppression{}, e.suppressions...)
+}
+
+// createAnomaly creates an anomaly from baseline deviation. name is the
+// destination's hostname or cloud service, if known.
 func (e *BaselineEngine) createAnomaly(
-	flowKey string,
+	flowKey, name string,
 	baseline *types.Baseline,
 	currentValue float64,
 ) *types.Anomaly {
@@ -184,23 +327,39 @@ func (e *BaselineEngine) createAnomaly(
 	estimatedCostImpact := deltaGB * 0.09
 	estimatedMonthlyImpact := estimatedCostImpact * 24 * 30 // Per hour to monthly
 
+	now := time.Now()
+	causes, actions := inferCauses(anomalyType, causeDestination(flowKey, name), now)
+
 	return &types.Anomaly{
 		ID:                        uuid.New(),
 		Type:                      anomalyType,
 		Severity:                  severity,
 		SourceService:             flowKey,
-		DetectedAt:                time.Now(),
+		DestinationEndpoint:       name,
+		FlowKey:                   flowKey,
+		DetectedAt:                now,
 		CurrentValue:              currentValue,
 		BaselineValue:             baseline.BytesPerHourMean,
 		Deviation:                 deviation,
 		AbsoluteDelta:             absoluteDelta,
 		EstimatedCostImpactUSD:    estimatedCostImpact,
 		EstimatedMonthlyImpactUSD: estimatedMonthlyImpact,
-		CreatedAt:                 time.Now(),
-		UpdatedAt:                 time.Now(),
+		PotentialCauses:           causes,
+		SuggestedActions:          actions,
+		CreatedAt:                 now,
+		UpdatedAt:                 now,
 	}
 }
 
+// Reset clears baselines and anomalies. Suppression windows are kept.
+func (e *BaselineEngine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.baselines = make(map[string]*types.Baseline)
+	e.anomalies = nil
+}
+
 // GetBaseline returns baseline for a flow key.
 func (e *BaselineEngine) GetBaseline(flowKey string) *types.Baseline {
 	e.mu.RLock()
@@ -220,7 +379,7 @@ func (e *BaselineEngine) GetAllBaselines() []*types.Baseline {
 	return baselines
 }
 
-// GetActiveAnomalies returns active (unresolved) anomalies.
+// GetActiveAnomalies returns copies of the active (unresolved) anomalies.
 func (e *BaselineEngine) GetActiveAnomalies() []*types.Anomaly {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -228,24 +387,33 @@ func (e *BaselineEngine) GetActiveAnomalies() []*types.Anomaly {
 	var active []*types.Anomaly
 	for _, a := range e.anomalies {
 		if a.IsActive() {
-			active = append(active, a)
+			c := a.Clone()
+			active = append(active, &c)
 		}
 	}
 	return active
 }
 
-// AddAnomaly adds a detected anomaly.
+// AddAnomaly adds a copy of a detected anomaly and persists it when a
+// store is set. Leak anomalies towards trusted destinations are dropped.
 func (e *BaselineEngine) AddAnomaly(anomaly *types.Anomaly) {
 	e.mu.Lock()
-	defer e.mu.Unlock()
-	e.anomalies = append(e.anomalies, anomaly)
+	if anomaly.Type == types.AnomalyTypeLeak && e.isTrusted(anomalyDestination(anomaly)) {
+		e.mu.Unlock()
+		log.Debug().Str("destination", anomalyDestination(anomaly)).Msg("Ignoring leak anomaly for trusted destination")
+		return
+	}
+	added := anomaly.Clone()
+	e.anomalies = append(e.anomalies, &added)
+	store, snapshot := e.store, added.Clone()
+	e.mu.Unlock()
+
+	persistAnomaly(store, snapshot, true)
 }
 
 // AcknowledgeAnomaly marks an anomaly as acknowledged.
 func (e *BaselineEngine) AcknowledgeAnomaly(anomalyID uuid.UUID, acknowledgedBy string) error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
-
 	for _, a := range e.anomalies {
 		if a.ID == anomalyID {
 			now := time.Now()
@@ -253,29 +421,47 @@ func (e *BaselineEngine) AcknowledgeAnomaly(anomalyID uuid.UUID, acknowledgedBy
 			a.AcknowledgedBy = acknowledgedBy
 			a.AcknowledgedAt = &now
 			a.UpdatedAt = now
+			store, snapshot := e.store, a.Clone()
+			e.mu.Unlock()
+
+			persistAnomaly(store, snapshot, false)
 			return nil
 		}
 	}
-	return nil
+	e.mu.Unlock()
+	return ErrAnomalyNotFound
 }
 
-// ResolveAnomaly marks an anomaly as resolved.
-func (e *BaselineEngine) ResolveAnomaly(anomalyID uuid.UUID, notes string) error {
+// ResolveAnomaly marks an anomaly as resolved. Resolutions flagged as false
+// positives feed back into the flow's detection threshold.
+func (e *BaselineEngine) ResolveAnomaly(anomalyID uuid.UUID, notes string, falsePositive bool) error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
-
 	for _, a := range e.anomalies {
 		if a.ID == anomalyID {
+			// Resolving again would count the feedback twice
+			if a.Resolved {
+				e.mu.Unlock()
+				return nil
+			}
 			now := time.Now()
 			a.Resolved = true
 			a.ResolvedAt = &now
 			a.EndedAt = &now
 			a.ResolutionNotes = notes
+			a.FalsePositive = falsePositive
 			a.UpdatedAt = now
+			if a.FlowKey != "" {
+				e.recordFeedback(a.FlowKey, falsePositive)
+			}
+			store, snapshot := e.store, a.Clone()
+			e.mu.Unlock()
+
+			persistAnomaly(store, snapshot, false)
 			return nil
 		}
 	}
-	return nil
+	e.mu.Unlock()
+	return ErrAnomalyNotFound
 }
 
 // GetAnomalySummary returns summary of anomalies.
@@ -289,6 +475,10 @@ func (e *BaselineEngine) GetAnomalySummary() types.AnomalySummary {
 	}
 
 	for _, a := range e.anomalies {
+		if a.Suppressed {
+			summary.TotalSuppressed++
+			continue
+		}
 		if a.IsActive() {
 			summary.TotalActive++
 			summary.TotalCostImpactUSD += a.EstimatedCostImpactUSD
@@ -300,9 +490,13 @@ func (e *BaselineEngine) GetAnomalySummary() types.AnomalySummary {
 		summary.ByType[a.Type]++
 	}
 
-	// Get top anomalies by cost impact
-	sorted := make([]*types.Anomaly, len(e.anomalies))
-	copy(sorted, e.anomalies)
+	// Get top anomalies by cost impact, excluding suppressed ones
+	sorted := make([]*types.Anomaly, 0, len(e.anomalies))
+	for _, a := range e.anomalies {
+		if !a.Suppressed {
+			sorted = append(sorted, a)
+		}
+	}
 	sort.Slice(sorted, func(i, j int) bool {
 		return sorted[i].EstimatedCostImpactUSD > sorted[j].EstimatedCostImpactUSD
 	})
@@ -311,7 +505,7 @@ func (e *BaselineEngine) GetAnomalySummary() types.AnomalySummary {
 		if i >= 10 {
 			break
 		}
-		summary.TopAnomalies = append(summary.TopAnomalies, *a)
+		summary.TopAnomalies = append(summary.TopAnomalies, a.Clone())
 	}
 
 	return summary
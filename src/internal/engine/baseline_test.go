@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+const testFlowKey = "shop/api|203.0.113.10"
+
+// steadyValues are hourly values alternating around 1000 bytes.
+func steadyValues(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = 1000 + float64(i%2)*20 - 10
+	}
+	return values
+}
+
+// newSteadyEngine has a two-day baseline of steadyValues for testFlowKey.
+func newSteadyEngine(t *testing.T) *BaselineEngine {
+	t.Helper()
+	e := NewBaselineEngine(3)
+	end := time.Now()
+	if e.BuildBaseline(context.Background(), testFlowKey, steadyValues(48), end.Add(-48*time.Hour), end) == nil {
+		t.Fatal("no baseline built")
+	}
+	return e
+}
+
+func TestSuppressedSpikeInWindow(t *testing.T) {
+	e := newSteadyEngine(t)
+	now := time.Now()
+	s, err := e.AddSuppression(types.Suppression{
+		Start:   now.Add(-time.Hour),
+		End:     now.Add(time.Hour),
+		FlowKey: testFlowKey,
+		Reason:  "migration",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 50000})
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want the spike", len(anomalies))
+	}
+	a := anomalies[0]
+	if !a.Suppressed || a.SuppressionID == nil || *a.SuppressionID != s.ID {
+		t.Fatalf("suppressed %v by %v, want suppressed by %v", a.Suppressed, a.SuppressionID, s.ID)
+	}
+
+	e.AddAnomaly(a)
+	if active := e.GetActiveAnomalies(); len(active) != 0 {
+		t.Errorf("%d active anomalies, want the suppressed spike kept out", len(active))
+	}
+	summary := e.GetAnomalySummary()
+	if summary.TotalSuppressed != 1 || summary.TotalActive != 0 || len(summary.TopAnomalies) != 0 {
+		t.Errorf("summary = %+v, want one suppressed anomaly only", summary)
+	}
+}
+
+func TestSpikeOutsideSuppressionIsActive(t *testing.T) {
+	e := newSteadyEngine(t)
+	now := time.Now()
+	for _, s := range []types.Suppression{
+		{Start: now.Add(-3 * time.Hour), End: now.Add(-time.Hour)},                       // Already over
+		{Start: now.Add(-time.Hour), End: now.Add(time.Hour), FlowKey: "shop/web|db/pg"}, // Another flow
+	} {
+		if _, err := e.AddSuppression(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 50000})
+	if len(anomalies) != 1 || anomalies[0].Suppressed {
+		t.Fatalf("anomalies = %+v, want one unsuppressed spike", anomalies)
+	}
+	e.AddAnomaly(anomalies[0])
+	if active := e.GetActiveAnomalies(); len(active) != 1 {
+		t.Errorf("%d active anomalies, want 1", len(active))
+	}
+}
+
+func TestAddSuppressionValidation(t *testing.T) {
+	e := NewBaselineEngine(3)
+	now := time.Now()
+	for name, s := range map[string]types.Suppression{
+		"no end":       {Start: now},
+		"end at start": {Start: now, End: now},
+		"reversed":     {Start: now, End: now.Add(-time.Hour)},
+	} {
+		if _, err := e.AddSuppression(s); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+	if got := e.GetSuppressions(); len(got) != 0 {
+		t.Errorf("invalid windows were kept: %+v", got)
+	}
+}
+
+func TestBaselineFlowFieldsFromKey(t *testing.T) {
+	tests := []struct {
+		key                               string
+		src, dstService, dstEndpoint, typ string
+	}{
+		{serviceFlow("api", "db", 1).FlowKey(), "shop/api", "shop/db", "", ""},
+		{testFlowKey, "shop/api", "", "203.0.113.10", ""},
+		{"shop/api|203.0.113.10|egress", "shop/api", "", "203.0.113.10", "egress"},
+		{"not-a-flow-key", "not-a-flow-key", "", "", ""},
+	}
+	for _, tt := range tests {
+		e := NewBaselineEngine(3)
+		end := time.Now()
+		b := e.BuildBaseline(context.Background(), tt.key, steadyValues(48), end.Add(-48*time.Hour), end)
+		if b == nil {
+			t.Fatalf("%s: no baseline built", tt.key)
+		}
+		if b.SourceService != tt.src || b.DestinationService != tt.dstService || b.DestinationEndpoint != tt.dstEndpoint || b.TransferType != tt.typ {
+			t.Errorf("%s: baseline source %q, destination service %q, endpoint %q, type %q", tt.key,
+				b.SourceService, b.DestinationService, b.DestinationEndpoint, b.TransferType)
+		}
+		if e.GetBaseline(tt.key) != b {
+			t.Errorf("%s: baseline not stored under its flow key", tt.key)
+		}
+	}
+}
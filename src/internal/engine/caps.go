@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// SetEndpointCap registers or replaces a monthly transfer cap for a hostname.
+func (e *CostEngine) SetEndpointCap(c types.EndpointCap) (types.EndpointCap, error) {
+	c.Hostname = strings.ToLower(strings.TrimSpace(c.Hostname))
+	if c.Hostname == "" {
+		return c, errors.New("hostname is required")
+	}
+	if c.MonthlyBytes == 0 {
+		return c, errors.New("monthly_bytes must be positive")
+	}
+	c.CreatedAt = time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.caps[c.Hostname] = c
+
+	log.Info().
+		Str("hostname", c.Hostname).
+		Uint64("monthly_bytes", c.MonthlyBytes).
+		Msg("Endpoint cap set")
+
+	return c, nil
+}
+
+// GetEndpointCaps returns all registered endpoint caps.
+func (e *CostEngine) GetEndpointCaps() []types.EndpointCap {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	caps := make([]types.EndpointCap, 0, len(e.caps))
+	for _, c := range e.caps {
+		caps = append(caps, c)
+	}
+	return caps
+}
+
+// RecordEndpointTransfer adds a flow to the monthly usage of its capped
+// destination, if any. The flow counts toward the month (UTC) of its window
+// end. It returns a cost anomaly the first time the current month's usage
+// exceeds the cap, and nil otherwise; earlier months are over, so flows
+// loaded from them are counted without alerting.
+func (e *CostEngine) RecordEndpointTransfer(flow types.TransferFlow) *types.Anomaly {
+	if flow.DestinationEndpoint == nil || flow.DestinationEndpoint.Hostname == "" {
+		return nil
+	}
+	host := strings.ToLower(flow.DestinationEndpoint.Hostname)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c, ok := e.caps[host]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	month := flowMonth(flow)
+	key := month + "|" + host
+	e.capUsage[key] += flow.TotalBytes
+	usage := e.capUsage[key]
+
+	if usage <= c.MonthlyBytes || e.capAlerted[key] || month < now.UTC().Format("2006-01") {
+		return nil
+	}
+	e.capAlerted[key] = true
+
+	causes, actions := inferCauses(types.AnomalyTypeCostAnomaly, host, now)
+	actions = append(actions, "Review the contractual transfer limit for "+host)
+
+	return &types.Anomaly{
+		ID:                  uuid.New(),
+		Type:                types.AnomalyTypeCostAnomaly,
+		Severity:            types.SeverityHigh,
+		SourceService:       flow.SourceIdentity.FullName(),
+		DestinationEndpoint: host,
+		DetectedAt:          now,
+		CurrentValue:        float64(usage),
+		BaselineValue:       float64(c.MonthlyBytes),
+		AbsoluteDelta:       float64(usage - c.MonthlyBytes),
+		PotentialCauses:     causes,
+		SuggestedActions:    actions,
+		Labels:              map[string]string{"endpoint_cap": host},
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// stripeFlow sends bytes from shop/checkout to api.stripe.com.
+func stripeFlow(bytes uint64) types.TransferFlow {
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "checkout"},
+		DestinationEndpoint: &types.Endpoint{Hostname: "api.stripe.com", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          bytes,
+	}
+}
+
+func TestEndpointCapCrossedForStripe(t *testing.T) {
+	e := NewCostEngine()
+	if _, err := e.SetEndpointCap(types.EndpointCap{Hostname: " API.Stripe.com ", MonthlyBytes: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bytes := range []uint64{400, 600} {
+		if a := e.RecordEndpointTransfer(stripeFlow(bytes)); a != nil {
+			t.Fatalf("anomaly at the cap: %+v", a)
+		}
+	}
+
+	a := e.RecordEndpointTransfer(stripeFlow(250))
+	if a == nil {
+		t.Fatal("no anomaly after crossing the cap")
+	}
+	if a.Type != types.AnomalyTypeCostAnomaly || a.DestinationEndpoint != "api.stripe.com" || a.SourceService != "shop/checkout" {
+		t.Errorf("anomaly %s %s -> %s, want a cost anomaly from shop/checkout to api.stripe.com", a.Type, a.SourceService, a.DestinationEndpoint)
+	}
+	if a.CurrentValue != 1250 || a.BaselineValue != 1000 || a.AbsoluteDelta != 250 {
+		t.Errorf("usage %v cap %v over by %v, want 1250, 1000 and 250", a.CurrentValue, a.BaselineValue, a.AbsoluteDelta)
+	}
+
+	// One alert per month
+	if again := e.RecordEndpointTransfer(stripeFlow(5000)); again != nil {
+		t.Error("alerted twice in one month")
+	}
+}
+
+func TestEndpointCapCountsFlowsByWindowEnd(t *testing.T) {
+	e := NewCostEngine()
+	if _, err := e.SetEndpointCap(types.EndpointCap{Hostname: "api.stripe.com", MonthlyBytes: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	thisMonth := time.Now().UTC()
+	lastMonth := time.Date(thisMonth.Year(), thisMonth.Month(), 1, 0, 0, 0, 0, time.UTC).Add(-time.Hour)
+
+	// A loaded flow from last month counts toward last month only, and its
+	// month is over, so crossing the cap there raises nothing
+	old := stripeFlow(5000)
+	old.WindowEnd = lastMonth
+	if a := e.RecordEndpointTransfer(old); a != nil {
+		t.Errorf("alerted for last month's usage: %+v", a)
+	}
+
+	current := stripeFlow(800)
+	current.WindowEnd = thisMonth
+	if a := e.RecordEndpointTransfer(current); a != nil {
+		t.Errorf("last month's usage carried into this month: %+v", a)
+	}
+	current.TotalBytes = 300
+	if a := e.RecordEndpointTransfer(current); a == nil || a.CurrentValue != 1100 {
+		t.Errorf("got %+v, want an anomaly at this month's 1100 bytes", a)
+	}
+}
+
+func TestEndpointCapIgnoresOtherDestinations(t *testing.T) {
+	e := NewCostEngine()
+	if _, err := e.SetEndpointCap(types.EndpointCap{Hostname: "api.stripe.com", MonthlyBytes: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := stripeFlow(100)
+	other.DestinationEndpoint.Hostname = "api.github.com"
+	if e.RecordEndpointTransfer(other) != nil {
+		t.Error("uncapped destination raised an anomaly")
+	}
+	if e.RecordEndpointTransfer(types.TransferFlow{TotalBytes: 100}) != nil {
+		t.Error("flow without a destination raised an anomaly")
+	}
+}
+
+func TestSetEndpointCapValidation(t *testing.T) {
+	e := NewCostEngine()
+	for _, c := range []types.EndpointCap{
+		{Hostname: "  ", MonthlyBytes: 10},
+		{Hostname: "api.stripe.com"},
+	} {
+		if _, err := e.SetEndpointCap(c); err == nil {
+			t.Errorf("cap %+v accepted", c)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"strings"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// causeRule maps destination hostname fragments, or cloud service names,
+// to a likely cause.
+type causeRule struct {
+	patterns []string
+	services []string // Cloud service names, matched whole
+	cause    string
+	actions  []string
+}
+
+// destinationCauseRules are checked in order against the destination.
+var destinationCauseRules = []causeRule{
+	{
+		patterns: []string{"s3.amazonaws.com", ".s3.", "storage.googleapis.com", "blob.core.windows.net", "backup"},
+		services: []string{"s3", "gcs", "azure-blob"},
+		cause:    "Backup or data export job",
+		actions:  []string{"Review data export jobs", "Verify backup schedules and destinations"},
+	},
+	{
+		patterns: []string{"datadog", "splunk", "newrelic", "elastic", "logs.", "loki"},
+		cause:    "Log or telemetry shipping spike",
+		actions:  []string{"Check log verbosity and telemetry sampling"},
+	},
+	{
+		patterns: []string{"docker.io", ".ecr.", "gcr.io", "ghcr.io", "quay.io", "pkg.dev"},
+		services: []string{"ecr", "gcr", "acr"},
+		cause:    "Container image pulls",
+		actions:  []string{"Use a registry mirror or pull-through cache"},
+	},
+}
+
+// inferCauses derives plausible causes and suggested actions for an anomaly
+// from its type, destination, and time of day. The destination is a
+// hostname or cloud service name; an IP matches no destination rule.
+func inferCauses(anomalyType types.AnomalyType, destination string, at time.Time) (causes, actions []string) {
+	dst := strings.ToLower(destination)
+	for _, rule := range destinationCauseRules {
+		if rule.matches(dst) {
+			causes = append(causes, rule.cause)
+			actions = append(actions, rule.actions...)
+		}
+	}
+
+	switch anomalyType {
+	case types.AnomalyTypeSpike:
+		causes = append(causes, "Traffic burst from a batch job, retry storm, or load surge")
+		actions = append(actions, "Check for retry storms and recent deployments")
+	case types.AnomalyTypeSlowBurn:
+		causes = append(causes, "Gradual growth in usage or data volume")
+		actions = append(actions, "Review capacity and data growth trends")
+	case types.AnomalyTypeNewEndpoint:
+		causes = append(causes, "New dependency or configuration change")
+		actions = append(actions, "Verify the new destination is expected")
+	}
+
+	if hour := at.UTC().Hour(); hour < 6 {
+		causes = append(causes, "Off-hours scheduled task")
+		actions = append(actions, "Check scheduled tasks and cron jobs")
+	}
+
+	return causes, actions
+}
+
+// matches reports whether a lowercased destination fits the rule.
+func (r causeRule) matches(dst string) bool {
+	for _, svc := range r.services {
+		if dst == svc {
+			return true
+		}
+	}
+	for _, p := range r.patterns {
+		if strings.Contains(dst, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationName returns the hostname or cloud service of a flow's
+// external destination, or "" when only its IP is known.
+func destinationName(flow types.TransferFlow) string {
+	if flow.DestinationEndpoint == nil {
+		return ""
+	}
+	if name := externalNodeName(flow.DestinationEndpoint); name != flow.DestinationEndpoint.IP {
+		return name
+	}
+	return ""
+}
+
+// flowDestination returns the destination part of a flow key. For external
+// destinations that is an IP; see destinationName for their names.
+func flowDestination(flowKey string) string {
+	if _, dst, _, ok := types.ParseFlowKey(flowKey); ok {
+		return dst
+	}
+	return ""
+}
+
+// causeDestination is what cause inference matches for a flow key: the
+// destination's name when known, else the key's destination.
+func causeDestination(flowKey, name string) string {
+	if name != "" {
+		return name
+	}
+	return flowDestination(flowKey)
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestSpikeToS3SuggestsExportJobs(t *testing.T) {
+	end := time.Now()
+	flow := types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+		DestinationEndpoint: &types.Endpoint{IP: "52.216.0.1", Hostname: "bucket.s3.amazonaws.com", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          50000,
+		WindowStart:         end.Add(-time.Hour),
+		WindowEnd:           end,
+	}
+	e := NewBaselineEngine(3)
+	// Baselines are keyed like the flows they are built from, by IP
+	if e.BuildBaseline(context.Background(), flow.FlowKey(), steadyValues(48), end.Add(-48*time.Hour), end) == nil {
+		t.Fatal("no baseline built")
+	}
+
+	anomalies := e.DetectFlowAnomalies(context.Background(), []types.TransferFlow{flow})
+	if len(anomalies) != 1 || anomalies[0].Type != types.AnomalyTypeSpike {
+		t.Fatalf("anomalies = %+v, want one spike", anomalies)
+	}
+	a := anomalies[0]
+	if a.SourceService != "shop/api|52.216.0.1" || a.DestinationEndpoint != "bucket.s3.amazonaws.com" {
+		t.Errorf("anomaly on %q to %q, want the IP flow key and the hostname", a.SourceService, a.DestinationEndpoint)
+	}
+	if !slices.Contains(a.PotentialCauses, "Backup or data export job") {
+		t.Errorf("causes = %q, want a backup or export job", a.PotentialCauses)
+	}
+	if !slices.Contains(a.SuggestedActions, "Review data export jobs") {
+		t.Errorf("actions = %q, want export jobs reviewed", a.SuggestedActions)
+	}
+}
+
+func TestNewCloudServiceEndpointSuggestsExportJobs(t *testing.T) {
+	flow := types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+		DestinationEndpoint: &types.Endpoint{IP: "3.5.0.3", CloudServiceName: "S3", IsInternet: true},
+		TotalBytes:          1000,
+	}
+	anomalies := NewBaselineEngine(3).DetectFlowAnomalies(context.Background(), []types.TransferFlow{flow})
+	if len(anomalies) != 1 || anomalies[0].Type != types.AnomalyTypeNewEndpoint {
+		t.Fatalf("anomalies = %+v, want one new endpoint", anomalies)
+	}
+	if a := anomalies[0]; a.DestinationEndpoint != "S3" || !slices.Contains(a.PotentialCauses, "Backup or data export job") {
+		t.Errorf("anomaly to %q with causes %q, want S3 as a backup or export job", a.DestinationEndpoint, a.PotentialCauses)
+	}
+}
+
+func TestInferCauses(t *testing.T) {
+	noon := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		anomalyType types.AnomalyType
+		destination string
+		at          time.Time
+		want        []string
+	}{
+		{"spike to a public IP", types.AnomalyTypeSpike, "203.0.113.10", noon,
+			[]string{"Traffic burst from a batch job, retry storm, or load surge"}},
+		{"new log shipper", types.AnomalyTypeNewEndpoint, "intake.Datadoghq.com", noon,
+			[]string{"Log or telemetry shipping spike", "New dependency or configuration change"}},
+		{"slow burn at night", types.AnomalyTypeSlowBurn, "ghcr.io", night,
+			[]string{"Container image pulls", "Gradual growth in usage or data volume", "Off-hours scheduled task"}},
+	}
+	for _, tt := range tests {
+		causes, actions := inferCauses(tt.anomalyType, tt.destination, tt.at)
+		if !slices.Equal(causes, tt.want) {
+			t.Errorf("%s: causes = %q, want %q", tt.name, causes, tt.want)
+		}
+		if len(actions) < len(causes) {
+			t.Errorf("%s: %d actions for %d causes, want at least one each", tt.name, len(actions), len(causes))
+		}
+	}
+}
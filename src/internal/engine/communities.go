@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"slices"
+	"sort"
+)
+
+// maxLabelPropagationRounds bounds community detection on graphs where
+// labels keep oscillating.
+const maxLabelPropagationRounds = 20
+
+// Community is a group of services that mostly talk to each other.
+type Community struct {
+	ID      int      `json:"id"`
+	Members []string `json:"members"`
+}
+
+// Communities groups in-cluster services by label propagation over the
+// graph, treating edges as undirected and weighted by bytes. Communities
+// are numbered from 0, largest first; services with no in-cluster traffic
+// form communities of their own. Results are deterministic.
+func (g *TransferGraph) Communities() []Community {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	cached := g.cachedCommunities()
+	communities := make([]Community, len(cached))
+	for i, c := range cached {
+		communities[i] = Community{ID: c.ID, Members: slices.Clone(c.Members)}
+	}
+	return communities
+}
+
+// cachedCommunities returns the communities of the current graph version,
+// computing them only after the graph changed. The result is shared and
+// must not be modified. Caller must hold g.mu.
+func (g *TransferGraph) cachedCommunities() []Community {
+	g.communityMu.Lock()
+	defer g.communityMu.Unlock()
+
+	if g.communityCache == nil || g.communityVersion != g.version {
+		g.communityCache = g.communities()
+		g.communityVersion = g.version
+	}
+	return g.communityCache
+}
+
+// communities implements Communities. Caller must hold g.mu.
+func (g *TransferGraph) communities() []Community {
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	weights := make(map[string]map[string]uint64, len(ids))
+	for _, e := range g.edges {
+		if g.nodes[e.SourceID] == nil || g.nodes[e.DestinationID] == nil || e.SourceID == e.DestinationID {
+			continue // External destinations and self-traffic do not bind services
+		}
+		if weights[e.SourceID] == nil {
+			weights[e.SourceID] = make(map[string]uint64)
+		}
+		if weights[e.DestinationID] == nil {
+			weights[e.DestinationID] = make(map[string]uint64)
+		}
+		weights[e.SourceID][e.DestinationID] += e.TotalBytes
+		weights[e.DestinationID][e.SourceID] += e.TotalBytes
+	}
+
+	labels := make(map[string]string, len(ids))
+	for _, id := range ids {
+		labels[id] = id
+	}
+
+	// Each node adopts the label with the most byte weight among its
+	// neighbours; ties go to the smallest label so runs are repeatable.
+	for round := 0; round < maxLabelPropagationRounds; round++ {
+		changed := false
+		for _, id := range ids {
+			if len(weights[id]) == 0 {
+				continue
+			}
+			score := make(map[string]uint64)
+			for neighbor, w := range weights[id] {
+				score[labels[neighbor]] += w
+			}
+			best := labels[id]
+			for label, s := range score {
+				if s > score[best] || (s == score[best] && label < best) {
+					best = label
+				}
+			}
+			if best != labels[id] {
+				labels[id] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	members := make(map[string][]string)
+	for _, id := range ids {
+		members[labels[id]] = append(members[labels[id]], id)
+	}
+	communities := make([]Community, 0, len(members))
+	for _, m := range members {
+		communities = append(communities, Community{Members: m})
+	}
+	sort.Slice(communities, func(i, j int) bool {
+		if len(communities[i].Members) != len(communities[j].Members) {
+			return len(communities[i].Members) > len(communities[j].Members)
+		}
+		return communities[i].Members[0] < communities[j].Members[0]
+	})
+	for i := range communities {
+		communities[i].ID = i
+	}
+	return communities
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// serviceFlow is an in-cluster flow of bytes from src to dst in namespace shop.
+func serviceFlow(src, dst string, bytes uint64) types.TransferFlow {
+	now := time.Now()
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: src},
+		DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: dst},
+		Type:                types.TransferTypeServiceToService,
+		TotalBytes:          bytes,
+		EventCount:          1,
+		WindowStart:         now.Add(-time.Minute),
+		WindowEnd:           now,
+	}
+}
+
+// twoClusterGraph has a triangle of front-end services and a triangle of
+// data services, joined by one light edge.
+func twoClusterGraph() *TransferGraph {
+	g := NewTransferGraph()
+	g.AddFlows([]types.TransferFlow{
+		serviceFlow("web", "api", 1000),
+		serviceFlow("api", "auth", 1000),
+		serviceFlow("auth", "web", 1000),
+		serviceFlow("orders", "db", 1000),
+		serviceFlow("db", "cache", 1000),
+		serviceFlow("cache", "orders", 1000),
+		serviceFlow("api", "orders", 10),
+	})
+	return g
+}
+
+func TestCommunitiesSplitTwoClusters(t *testing.T) {
+	communities := twoClusterGraph().Communities()
+
+	if len(communities) != 2 {
+		t.Fatalf("got %d communities, want 2: %+v", len(communities), communities)
+	}
+	want := [][]string{
+		{"shop/api", "shop/auth", "shop/web"},
+		{"shop/cache", "shop/db", "shop/orders"},
+	}
+	for _, c := range communities {
+		var matched bool
+		for _, members := range want {
+			if len(c.Members) == len(members) && c.Members[0] == members[0] &&
+				c.Members[1] == members[1] && c.Members[2] == members[2] {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Errorf("unexpected community %+v", c)
+		}
+	}
+}
+
+func TestNodeJSONCarriesCommunity(t *testing.T) {
+	graph := twoClusterGraph().ToJSON()
+
+	community := make(map[string]int)
+	for _, n := range graph.Nodes {
+		community[n.ID] = n.Community
+	}
+	if community["shop/web"] != community["shop/api"] || community["shop/db"] != community["shop/orders"] {
+		t.Errorf("services of one cluster in different communities: %v", community)
+	}
+	if community["shop/web"] == community["shop/db"] {
+		t.Errorf("clusters share community %d", community["shop/web"])
+	}
+}
+
+func TestCommunitiesFollowGraphChanges(t *testing.T) {
+	g := twoClusterGraph()
+	if n := len(g.Communities()); n != 2 {
+		t.Fatalf("got %d communities, want 2", n)
+	}
+
+	g.AddFlow(serviceFlow("batch", "reports", 1000))
+	if n := len(g.Communities()); n != 3 {
+		t.Errorf("got %d communities after adding a pair, want 3", n)
+	}
+
+	g.Reset()
+	if n := len(g.Communities()); n != 0 {
+		t.Errorf("got %d communities after reset, want 0", n)
+	}
+}
+
+func TestCommunitiesAreCopies(t *testing.T) {
+	g := twoClusterGraph()
+	g.Communities()[0].Members[0] = "changed"
+
+	for _, c := range g.Communities() {
+		for _, m := range c.Members {
+			if m == "changed" {
+				t.Fatal("changing returned communities changed the cache")
+			}
+		}
+	}
+}
+
+func TestToJSONWhileAddingFlows(t *testing.T) {
+	g := twoClusterGraph()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			g.AddFlow(serviceFlow("web", "api", 1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			g.ToJSON()
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("ToJSON and AddFlow deadlocked")
+	}
+}
@@ -4,43 +4,63 @@ package engine
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/rs/zerolog/log"
 
 	"github.com/egressor/egressor/src/pkg/types"
 )
 
 // CostEngine calculates and attributes data transfer costs.
 type CostEngine struct {
-	rules      []types.PricingRule
-	monthly    map[string]float64 // Track monthly usage per destination region
-	mu         sync.RWMutex
+	rules      []types.PricingRule // Custom rules first, newest first, then defaults
+	deleted    map[uuid.UUID]bool  // Default rules removed by an operator
+	monthly    map[string]float64  // GB recorded per month, provider, and category
+	caps       map[string]types.EndpointCap
+	capUsage   map[string]uint64 // Monthly bytes per capped hostname, keyed by month and host
+	capAlerted map[string]bool   // Caps already alerted this month
+	exemptions []costExemption
+	watchlist  map[string]types.WatchlistEntry
+	consumers  map[string]map[string]bool // Watched destination -> source services seen
+	mtd        monthToDate
+	// Source label key -> attribution dimension
+	labelDimensions map[string]string
+	// Protocol -> header bytes added per packet
+	packetOverhead  map[string]uint64
+	mu              sync.RWMutex
 }
 
 // NewCostEngine creates a new cost engine with default pricing rules.
 func NewCostEngine() *CostEngine {
 	engine := &CostEngine{
-		monthly: make(map[string]float64),
+		monthly:    make(map[string]float64),
+		deleted:    make(map[uuid.UUID]bool),
+		caps:       make(map[string]types.EndpointCap),
+		capUsage:   make(map[string]uint64),
+		capAlerted: make(map[string]bool),
+		watchlist:  make(map[string]types.WatchlistEntry),
+		consumers:  make(map[string]map[string]bool),
 	}
 
-	// Load default AWS pricing rules
+	// Load default pricing rules. AWS rules come first so flows without a
+	// known provider keep AWS pricing.
 	engine.LoadDefaultAWSPricing()
+	engine.LoadDefaultGCPPricing()
 
 	return engine
 }
 
-// LoadDefaultAWSPricing loads default AWS data transfer pricing.
+// LoadDefaultAWSPricing loads default AWS data transfer pricing, replacing
+// any existing AWS rules. Rules for other providers are kept.
 func (e *CostEngine) LoadDefaultAWSPricing() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.rules = []types.PricingRule{
+	e.replaceProviderRules(types.CloudProviderAWS, []types.PricingRule{
 		// Internet egress - tiered pricing
 		{
-			ID:            uuid.New(),
 			Name:          "AWS Internet Egress",
 			Description:   "Data transfer out to the Internet",
 			CloudProvider: types.CloudProviderAWS,
@@ -56,7 +76,6 @@ func (e *CostEngine) LoadDefaultAWSPricing() {
 		},
 		// Cross-AZ traffic
 		{
-			ID:            uuid.New(),
 			Name:          "AWS Cross-AZ Transfer",
 			Description:   "Data transfer between availability zones",
 			CloudProvider: types.CloudProviderAWS,
@@ -66,7 +85,6 @@ func (e *CostEngine) LoadDefaultAWSPricing() {
 		},
 		// Cross-region transfer (example: us-east-1 to us-west-2)
 		{
-			ID:              uuid.New(),
 			Name:            "AWS Cross-Region US East to West",
 			Description:     "Data transfer between US regions",
 			CloudProvider:   types.CloudProviderAWS,
@@ -76,9 +94,18 @@ func (e *CostEngine) LoadDefaultAWSPricing() {
 			CostPerGB:       0.02,
 			EffectiveFrom:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 		},
+		// Cross-cluster traffic leaves the VPC through peering, a transit
+		// gateway, or a load balancer; priced like cross-region transfer
+		{
+			Name:          "AWS Cross-Cluster Transfer",
+			Description:   "Data transfer between clusters",
+			CloudProvider: types.CloudProviderAWS,
+			Category:      types.CostCategoryCrossCluster,
+			CostPerGB:     0.02,
+			EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
 		// NAT Gateway
 		{
-			ID:            uuid.New(),
 			Name:          "AWS NAT Gateway Processing",
 			Description:   "NAT Gateway data processing charges",
 			CloudProvider: types.CloudProviderAWS,
@@ -88,7 +115,6 @@ func (e *CostEngine) LoadDefaultAWSPricing() {
 		},
 		// VPC Peering cross-region
 		{
-			ID:            uuid.New(),
 			Name:          "AWS VPC Peering Cross-Region",
 			Description:   "VPC peering data transfer cross-region",
 			CloudProvider: types.CloudProviderAWS,
@@ -96,62 +122,210 @@ func (e *CostEngine) LoadDefaultAWSPricing() {
 			CostPerGB:     0.01,
 			EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 		},
+	})
+}
+
+// LoadDefaultGCPPricing loads default GCP (premium tier) data transfer
+// pricing, replacing any existing GCP rules.
+func (e *CostEngine) LoadDefaultGCPPricing() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.replaceProviderRules(types.CloudProviderGCP, []types.PricingRule{
+		{
+			Name:          "GCP Internet Egress",
+			Description:   "Premium tier data transfer out to the Internet",
+			CloudProvider: types.CloudProviderGCP,
+			Category:      types.CostCategoryEgressInternet,
+			CostPerGB:     0.12,
+			Tiers: []types.PricingTier{
+				{ThresholdGB: 1024, CostPerGB: 0.12},      // First 1TB
+				{ThresholdGB: 10 * 1024, CostPerGB: 0.11}, // Next 9TB
+			},
+			EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:          "GCP Cross-Zone Transfer",
+			Description:   "Data transfer between zones in a region",
+			CloudProvider: types.CloudProviderGCP,
+			Category:      types.CostCategoryCrossAZ,
+			CostPerGB:     0.01,
+			EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:          "GCP Cross-Region Transfer",
+			Description:   "Data transfer between regions",
+			CloudProvider: types.CloudProviderGCP,
+			Category:      types.CostCategoryCrossRegion,
+			CostPerGB:     0.02,
+			EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:          "GCP Cross-Cluster Transfer",
+			Description:   "Data transfer between clusters",
+			CloudProvider: types.CloudProviderGCP,
+			Category:      types.CostCategoryCrossCluster,
+			CostPerGB:     0.02,
+			EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	})
+}
+
+// replaceProviderRules swaps the default rules of a provider for the given
+// set, after the custom rules. Defaults an operator deleted stay deleted.
+// Caller must hold e.mu.
+func (e *CostEngine) replaceProviderRules(provider types.CloudProvider, rules []types.PricingRule) {
+	kept := e.rules[:0:0]
+	for _, r := range e.rules {
+		if r.CloudProvider != provider || !isDefaultRule(r) {
+			kept = append(kept, r)
+		}
 	}
+	for _, r := range rules {
+		r.ID = defaultRuleID(provider, r.Name)
+		if !e.deleted[r.ID] {
+			kept = append(kept, r)
+		}
+	}
+	e.rules = kept
 }
 
-// AddPricingRule adds a custom pricing rule.
+// defaultRuleNamespace scopes the IDs of default pricing rules.
+var defaultRuleNamespace = uuid.MustParse("5f0c8a3e-2b7d-4c1e-9a6f-3d8b1e7c4a20")
+
+// defaultRuleID returns the stable ID of a default rule, so deleting one
+// can be persisted across restarts.
+func defaultRuleID(provider types.CloudProvider, name string) uuid.UUID {
+	return uuid.NewSHA1(defaultRuleNamespace, []byte(string(provider)+"/"+name))
+}
+
+// isDefaultRule reports whether a rule is one of the built-in defaults.
+func isDefaultRule(rule types.PricingRule) bool {
+	return rule.ID == defaultRuleID(rule.CloudProvider, rule.Name)
+}
+
+// flowProvider returns the cloud provider a flow is billed by: the source
+// workload's provider, or unknown if not recorded.
+func flowProvider(flow types.TransferFlow) types.CloudProvider {
+	if flow.SourceIdentity.CloudProvider == "" {
+		return types.CloudProviderUnknown
+	}
+	return types.CloudProvider(flow.SourceIdentity.CloudProvider)
+}
+
+// AddPricingRule adds a custom pricing rule. It takes precedence over the
+// defaults and over rules added before it.
 func (e *CostEngine) AddPricingRule(rule types.PricingRule) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.rules = append(e.rules, rule)
+	e.rules = append([]types.PricingRule{rule}, e.rules...)
 }
 
-// CalculateCost calculates cost for a transfer flow.
+// CalculateCost calculates cost for a transfer flow. Free tiers and tiered
+// rates apply on top of the usage RecordFlowCost has recorded for the
+// flow's month; the flow itself is not recorded.
 func (e *CostEngine) CalculateCost(flow types.TransferFlow) types.CostBreakdown {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
+	return e.calculateCost(flow, e.monthly, false)
+}
+
+// calculateCost prices a flow on top of the GB usage holds for the flow's
+// month, provider and category, and adds the flow to usage when record is
+// set. Caller must hold e.mu, for writing when usage is e.monthly and
+// record is set.
+func (e *CostEngine) calculateCost(flow types.TransferFlow, usage map[string]float64, record bool) types.CostBreakdown {
+	var srcService, dstService string
+	srcService = flow.SourceIdentity.FullName()
+	if flow.DestinationIdentity != nil {
+		dstService = flow.DestinationIdentity.FullName()
+	} else if flow.DestinationEndpoint != nil {
+		dstService = flow.DestinationEndpoint.IP
+	}
+
+	// Exempt traffic (e.g. free private links) is reported at zero cost
+	if e.isExempt(flow) {
+		return types.CostBreakdown{
+			Category:           types.CostCategoryVPCPeering,
+			BytesTransferred:   flow.TotalBytes,
+			SourceService:      srcService,
+			DestinationService: dstService,
+			Exempt:             true,
+		}
+	}
 
 	category := e.classifyCategory(flow)
 	rule := e.findMatchingRule(flow, category)
 
-	var cost float64
+	// Price on-the-wire bytes, including estimated packet headers
+	overhead := e.overheadBytes(flow.Protocol, flow.TotalPackets)
+	billed := flow.TotalBytes + overhead
+
+	var priced types.PricedTransfer
+	var ruleID *uuid.UUID
 	if rule != nil {
-		// Track monthly usage for tiered pricing
-		monthlyKey := fmt.Sprintf("%s-%s", time.Now().Format("2006-01"), category)
-		alreadyUsed := e.monthly[monthlyKey]
-		cost = rule.CalculateCost(flow.TotalBytes, alreadyUsed)
+		// Tiers are reached by the month's usage, not by single flows
+		monthlyKey := usageKey(flow, rule.CloudProvider, category)
+		priced = rule.Price(billed, usage[monthlyKey])
+		if record {
+			usage[monthlyKey] += priced.FreeTierGB + priced.BilledGB
+		}
+		id := rule.ID
+		ruleID = &id
 	} else {
 		// Default pricing
-		gb := float64(flow.TotalBytes) / (1024 * 1024 * 1024)
-		switch category {
-		case types.CostCategoryEgressInternet:
-			cost = gb * 0.09
-		case types.CostCategoryCrossAZ:
-			cost = gb * 0.01
-		case types.CostCategoryCrossRegion:
-			cost = gb * 0.02
-		default:
-			cost = 0
+		gb := float64(billed) / (1024 * 1024 * 1024)
+		rate := defaultCostPerGB(category)
+		priced = types.PricedTransfer{
+			BilledGB: gb,
+			Charges:  []types.TierCharge{{GB: gb, CostPerGB: rate, CostUSD: gb * rate}},
+			CostUSD:  gb * rate,
 		}
 	}
 
-	var srcService, dstService string
-	srcService = flow.SourceIdentity.FullName()
-	if flow.DestinationIdentity != nil {
-		dstService = flow.DestinationIdentity.FullName()
-	} else if flow.DestinationEndpoint != nil {
-		dstService = flow.DestinationEndpoint.IP
-	}
-
 	return types.CostBreakdown{
 		Category:           category,
 		BytesTransferred:   flow.TotalBytes,
-		CostUSD:            cost,
+		OverheadBytes:      overhead,
+		CostUSD:            priced.CostUSD,
+		FreeTierGB:         priced.FreeTierGB,
+		BilledGB:           priced.BilledGB,
+		Charges:            priced.Charges,
+		PricingRuleID:      ruleID,
 		SourceService:      srcService,
 		DestinationService: dstService,
 	}
 }
 
+// flowMonth is the UTC month, "2006-01", a flow counts toward: that of its
+// window end, or the current one if the window is unset.
+func flowMonth(flow types.TransferFlow) string {
+	at := flow.WindowEnd
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return at.UTC().Format("2006-01")
+}
+
+// usageKey keys the monthly usage a flow's tiers start from.
+func usageKey(flow types.TransferFlow, provider types.CloudProvider, category types.CostCategory) string {
+	return fmt.Sprintf("%s-%s-%s", flowMonth(flow), provider, category)
+}
+
+// defaultCostPerGB is the rate for flows no pricing rule matches.
+func defaultCostPerGB(category types.CostCategory) float64 {
+	switch category {
+	case types.CostCategoryEgressInternet:
+		return 0.09
+	case types.CostCategoryCrossAZ:
+		return 0.01
+	case types.CostCategoryCrossRegion, types.CostCategoryCrossCluster:
+		return 0.02
+	default:
+		return 0
+	}
+}
+
 // classifyCategory determines the cost category for a flow.
 func (e *CostEngine) classifyCategory(flow types.TransferFlow) types.CostCategory {
 	switch flow.Type {
@@ -161,14 +335,18 @@ func (e *CostEngine) classifyCategory(flow types.TransferFlow) types.CostCategor
 		return types.CostCategoryCrossAZ
 	case types.TransferTypeCrossRegion:
 		return types.CostCategoryCrossRegion
+	case types.TransferTypeCrossCluster:
+		return types.CostCategoryCrossCluster
 	default:
 		return types.CostCategoryCrossAZ // Internal traffic often crosses AZs
 	}
 }
 
-// findMatchingRule finds the best matching pricing rule.
+// findMatchingRule finds the first matching pricing rule; custom rules come
+// before the defaults.
 func (e *CostEngine) findMatchingRule(flow types.TransferFlow, category types.CostCategory) *types.PricingRule {
 	now := time.Now()
+	provider := flowProvider(flow)
 
 	for i := range e.rules {
 		rule := &e.rules[i]
@@ -178,6 +356,11 @@ func (e *CostEngine) findMatchingRule(flow types.TransferFlow, category types.Co
 			continue
 		}
 
+		// Check provider; flows with an unknown provider match any rule
+		if provider != types.CloudProviderUnknown && rule.CloudProvider != provider {
+			continue
+		}
+
 		// Check effective dates
 		if rule.EffectiveFrom.After(now) {
 			continue
@@ -217,46 +400,73 @@ func (e *CostEngine) CalculateAttribution(
 	flows []types.TransferFlow,
 	periodStart, periodEnd time.Time,
 ) []types.CostAttribution {
-	// Group flows by service
-	byService := make(map[string][]types.TransferFlow)
-	for _, flow := range flows {
-		key := flow.SourceIdentity.FullName()
-		byService[key] = append(byService[key], flow)
-	}
+	return e.calculateAttribution(flows, periodStart, periodEnd, func(flow types.TransferFlow) string {
+		return flow.SourceIdentity.FullName()
+	})
+}
 
-	var attributions []types.CostAttribution
-
-	for serviceKey, serviceFlows := range byService {
-		attr := types.CostAttribution{
-			ID:          uuid.New(),
-			PeriodStart: periodStart,
-			PeriodEnd:   periodEnd,
-			Namespace:   serviceFlows[0].SourceIdentity.Namespace,
-			ServiceName: serviceFlows[0].SourceIdentity.Name,
-			Team:        serviceFlows[0].SourceIdentity.Team,
-			Environment: serviceFlows[0].SourceIdentity.Environment,
-		}
+// CalculateAttributionByVersion calculates cost attribution per service
+// deployment version, so canary and stable releases can be compared.
+func (e *CostEngine) CalculateAttributionByVersion(
+	ctx context.Context,
+	flows []types.TransferFlow,
+	periodStart, periodEnd time.Time,
+) []types.CostAttribution {
+	return e.calculateAttribution(flows, periodStart, periodEnd, func(flow types.TransferFlow) string {
+		return flow.SourceIdentity.FullName() + "@" + flow.SourceIdentity.Version
+	})
+}
 
-		var breakdowns []types.CostBreakdown
-		for _, flow := range serviceFlows {
-			attr.TotalBytes += flow.TotalBytes
+// calculateAttribution groups flows by key and attributes costs to each group.
+func (e *CostEngine) calculateAttribution(
+	flows []types.TransferFlow,
+	periodStart, periodEnd time.Time,
+	groupKey func(types.TransferFlow) string,
+) []types.CostAttribution {
+	b := e.newAttributionBuilder(periodStart, periodEnd, groupKey)
+	b.Add(flows)
+	return b.Attributions()
+}
 
-			breakdown := e.CalculateCost(flow)
-			attr.TotalCostUSD += breakdown.CostUSD
-			breakdowns = append(breakdowns, breakdown)
-		}
+// CalculatePathCosts attributes flow costs to HTTP paths in proportion to
+// path bytes and derives cost per 1000 requests. Results are sorted by cost.
+func (e *CostEngine) CalculatePathCosts(flows []types.TransferFlow) []types.PathCost {
+	byPath := make(map[string]*types.PathCost)
+	var order []string
 
-		attr.Breakdown = breakdowns
-		attributions = append(attributions, attr)
+	for _, flow := range flows {
+		if flow.TotalBytes == 0 || len(flow.ByHTTPPath) == 0 {
+			continue
+		}
+		flowCost := e.CalculateCost(flow).CostUSD
+
+		for path, bytes := range flow.ByHTTPPath {
+			pc, ok := byPath[path]
+			if !ok {
+				pc = &types.PathCost{Path: path}
+				byPath[path] = pc
+				order = append(order, path)
+			}
+			pc.TotalBytes += bytes
+			pc.Requests += flow.RequestsByHTTPPath[path]
+			pc.TotalCostUSD += flowCost * float64(bytes) / float64(flow.TotalBytes)
+		}
+	}
 
-		log.Debug().
-			Str("service", serviceKey).
-			Uint64("bytes", attr.TotalBytes).
-			Float64("cost_usd", attr.TotalCostUSD).
-			Msg("Cost attribution calculated")
+	result := make([]types.PathCost, 0, len(order))
+	for _, path := range order {
+		pc := byPath[path]
+		if pc.Requests > 0 {
+			pc.CostPer1000Requests = pc.TotalCostUSD / float64(pc.Requests) * 1000
+		}
+		result = append(result, *pc)
 	}
 
-	return attributions
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].TotalCostUSD > result[j].TotalCostUSD
+	})
+
+	return result
 }
 
 // GetCostSummary calculates a cost summary for a time period.
@@ -318,6 +528,18 @@ func (e *CostEngine) EstimateMonthlyProjection(
 	return dailyRate * 30
 }
 
+// ResetUsage clears tracked monthly usage, the month-to-date total, and
+// watchlist consumers. Pricing rules, caps, and the watchlist are kept.
+func (e *CostEngine) ResetUsage() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.monthly = make(map[string]float64)
+	e.capUsage = make(map[string]uint64)
+	e.capAlerted = make(map[string]bool)
+	e.consumers = make(map[string]map[string]bool)
+	e.mtd = monthToDate{}
+}
+
 // GetPricingRules returns all pricing rules.
 func (e *CostEngine) GetPricingRules() []types.PricingRule {
 	e.mu.RLock()
@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+const gib = 1024 * 1024 * 1024
+
+// tieredRule prices Azure egress with a 1GB free tier, $0.10/GB up to
+// 10GB, and $0.05/GB beyond. No default rule is for Azure, so Azure flows
+// only match it.
+func tieredRule() types.PricingRule {
+	return types.PricingRule{
+		ID:            uuid.New(),
+		Name:          "Test Azure Egress",
+		CloudProvider: types.CloudProviderAzure,
+		Category:      types.CostCategoryEgressInternet,
+		CostPerGB:     0.05,
+		FreeTierGB:    1,
+		Tiers:         []types.PricingTier{{ThresholdGB: 10, CostPerGB: 0.10}},
+		EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func newTieredEngine() *CostEngine {
+	e := NewCostEngine()
+	e.AddPricingRule(tieredRule())
+	return e
+}
+
+// azureEgress is an egress flow of gb GB ending at end.
+func azureEgress(name string, gb float64, end time.Time) types.TransferFlow {
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: name, CloudProvider: "azure"},
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          uint64(gb * gib),
+		WindowStart:         end.Add(-time.Hour),
+		WindowEnd:           end,
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRecordFlowCostUsesFreeTierOnce(t *testing.T) {
+	e := newTieredEngine()
+	now := time.Now()
+
+	first := e.RecordFlowCost(azureEgress("api", 0.75, now))
+	second := e.RecordFlowCost(azureEgress("api", 0.75, now))
+
+	if !approxEqual(first.FreeTierGB, 0.75) || !approxEqual(first.BilledGB, 0) || first.CostUSD != 0 {
+		t.Errorf("first flow: free %v billed %v cost %v, want all free", first.FreeTierGB, first.BilledGB, first.CostUSD)
+	}
+	if !approxEqual(second.FreeTierGB, 0.25) || !approxEqual(second.BilledGB, 0.5) {
+		t.Errorf("second flow: free %v billed %v, want 0.25 free and 0.5 billed", second.FreeTierGB, second.BilledGB)
+	}
+	if !approxEqual(second.CostUSD, 0.05) {
+		t.Errorf("second flow cost = %v, want 0.05", second.CostUSD)
+	}
+}
+
+func TestCalculateCostDoesNotRecordUsage(t *testing.T) {
+	e := newTieredEngine()
+	flow := azureEgress("api", 0.75, time.Now())
+
+	for i := 0; i < 3; i++ {
+		if b := e.CalculateCost(flow); !approxEqual(b.FreeTierGB, 0.75) {
+			t.Fatalf("call %d: free tier = %v, want 0.75", i, b.FreeTierGB)
+		}
+	}
+}
+
+func TestUsageIsTrackedPerMonth(t *testing.T) {
+	e := newTieredEngine()
+	march := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	e.RecordFlowCost(azureEgress("api", 1, march))
+	if b := e.CalculateCost(azureEgress("api", 1, march)); b.FreeTierGB != 0 {
+		t.Errorf("March free tier after 1GB = %v, want 0", b.FreeTierGB)
+	}
+	if b := e.CalculateCost(azureEgress("api", 1, march.AddDate(0, 1, 0))); !approxEqual(b.FreeTierGB, 1) {
+		t.Errorf("April free tier = %v, want 1", b.FreeTierGB)
+	}
+}
+
+func TestResetUsageClearsTieredUsage(t *testing.T) {
+	e := newTieredEngine()
+	now := time.Now()
+
+	e.RecordFlowCost(azureEgress("api", 1, now))
+	e.ResetUsage()
+	if b := e.CalculateCost(azureEgress("api", 1, now)); !approxEqual(b.FreeTierGB, 1) {
+		t.Errorf("free tier after reset = %v, want 1", b.FreeTierGB)
+	}
+}
+
+func TestCostBreakdownComponentsSumToTotal(t *testing.T) {
+	e := newTieredEngine()
+	now := time.Now()
+
+	for _, gb := range []float64{0.5, 3, 8, 20} {
+		b := e.RecordFlowCost(azureEgress("api", gb, now))
+
+		if !approxEqual(b.FreeTierGB+b.BilledGB, gb) {
+			t.Errorf("%vGB flow: free %v + billed %v != %v", gb, b.FreeTierGB, b.BilledGB, gb)
+		}
+		var chargedGB, chargedUSD float64
+		for _, c := range b.Charges {
+			chargedGB += c.GB
+			chargedUSD += c.CostUSD
+		}
+		if !approxEqual(chargedGB, b.BilledGB) {
+			t.Errorf("%vGB flow: charges cover %vGB, billed %vGB", gb, chargedGB, b.BilledGB)
+		}
+		if !approxEqual(chargedUSD, b.CostUSD) {
+			t.Errorf("%vGB flow: charges sum to $%v, cost $%v", gb, chargedUSD, b.CostUSD)
+		}
+	}
+}
+
+func TestPathCostPerRequest(t *testing.T) {
+	e := newTieredEngine()
+	end := time.Now()
+
+	// 3GB: 1GB free and 2GB at $0.10, split 2:1 between the paths
+	flow := azureEgress("api", 3, end)
+	flow.ByHTTPPath = map[string]uint64{"/export": 2 * gib, "/items": gib}
+	flow.RequestsByHTTPPath = map[string]uint64{"/export": 500, "/items": 4000}
+	// Flows without path data are left out
+	plain := azureEgress("worker", 5, end)
+
+	costs := e.CalculatePathCosts([]types.TransferFlow{flow, plain})
+	if len(costs) != 2 {
+		t.Fatalf("got %d paths, want 2", len(costs))
+	}
+
+	export, items := costs[0], costs[1]
+	if export.Path != "/export" || items.Path != "/items" {
+		t.Fatalf("paths %q, %q; want /export first as the costlier", export.Path, items.Path)
+	}
+	if !approxEqual(export.TotalCostUSD, 0.2*2/3) || !approxEqual(items.TotalCostUSD, 0.2/3) {
+		t.Errorf("costs $%v and $%v, want $0.20 split 2:1", export.TotalCostUSD, items.TotalCostUSD)
+	}
+	if export.TotalBytes != 2*gib || export.Requests != 500 {
+		t.Errorf("/export %d bytes %d requests, want %d and 500", export.TotalBytes, export.Requests, 2*gib)
+	}
+	if !approxEqual(export.CostPer1000Requests, export.TotalCostUSD/500*1000) {
+		t.Errorf("/export cost per 1000 requests = $%v, want $%v", export.CostPer1000Requests, export.TotalCostUSD/500*1000)
+	}
+	if !approxEqual(items.CostPer1000Requests, items.TotalCostUSD/4) {
+		t.Errorf("/items cost per 1000 requests = $%v, want $%v", items.CostPer1000Requests, items.TotalCostUSD/4)
+	}
+}
+
+func TestPathCostsAcrossFlows(t *testing.T) {
+	e := newTieredEngine()
+	end := time.Now()
+
+	var flows []types.TransferFlow
+	for _, name := range []string{"api", "web"} {
+		flow := azureEgress(name, 2, end)
+		flow.ByHTTPPath = map[string]uint64{"/items": 2 * gib}
+		flow.RequestsByHTTPPath = map[string]uint64{"/items": 1000}
+		flows = append(flows, flow)
+	}
+	// A path with bytes but no request count has no per-request cost
+	noRequests := azureEgress("batch", 2, end)
+	noRequests.ByHTTPPath = map[string]uint64{"/sync": 2 * gib}
+	flows = append(flows, noRequests)
+
+	costs := e.CalculatePathCosts(flows)
+	byPath := make(map[string]types.PathCost)
+	for _, pc := range costs {
+		byPath[pc.Path] = pc
+	}
+
+	items := byPath["/items"]
+	if items.Requests != 2000 || items.TotalBytes != 4*gib || !approxEqual(items.TotalCostUSD, 0.2) {
+		t.Errorf("/items = %+v, want both flows summed", items)
+	}
+	if !approxEqual(items.CostPer1000Requests, 0.1) {
+		t.Errorf("/items cost per 1000 requests = $%v, want $0.10", items.CostPer1000Requests)
+	}
+	if sync := byPath["/sync"]; sync.Requests != 0 || sync.CostPer1000Requests != 0 || sync.TotalCostUSD == 0 {
+		t.Errorf("/sync = %+v, want cost without a per-request figure", sync)
+	}
+}
+
+func TestMixedProvidersUseTheirOwnRates(t *testing.T) {
+	e := NewCostEngine()
+	rules := make(map[uuid.UUID]string)
+	for _, r := range e.GetPricingRules() {
+		rules[r.ID] = r.Name
+	}
+	end := time.Now()
+	egress := func(provider string, gb float64) types.TransferFlow {
+		flow := azureEgress("api", gb, end)
+		flow.SourceIdentity.CloudProvider = provider
+		return flow
+	}
+
+	tests := []struct {
+		flow     types.TransferFlow
+		wantRule string
+		wantCost float64
+	}{
+		// 1GB free, then $0.09/GB
+		{egress("aws", 11), "AWS Internet Egress", 0.90},
+		// No free tier, $0.12/GB
+		{egress("gcp", 10), "GCP Internet Egress", 1.20},
+	}
+	for _, tt := range tests {
+		provider := tt.flow.SourceIdentity.CloudProvider
+		// Recording one provider's flow must not consume the other's tiers
+		b := e.RecordFlowCost(tt.flow)
+		if b.PricingRuleID == nil || rules[*b.PricingRuleID] != tt.wantRule {
+			t.Errorf("%s flow priced by %v, want %s", provider, b.PricingRuleID, tt.wantRule)
+		}
+		if !approxEqual(b.CostUSD, tt.wantCost) {
+			t.Errorf("%s flow cost $%v, want $%v", provider, b.CostUSD, tt.wantCost)
+		}
+	}
+
+	// Cross-AZ is $0.01/GB on both
+	for _, provider := range []string{"aws", "gcp"} {
+		flow := egress(provider, 10)
+		flow.Type = types.TransferTypeCrossAZ
+		if b := e.CalculateCost(flow); !approxEqual(b.CostUSD, 0.10) {
+			t.Errorf("%s cross-AZ cost $%v, want $0.10", provider, b.CostUSD)
+		}
+	}
+}
+
+func TestCrossClusterPricing(t *testing.T) {
+	e := NewCostEngine()
+	flow := func(dstCluster string) types.TransferFlow {
+		return types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api", Cluster: "prod-a", CloudProvider: "aws"},
+			DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: "db", Cluster: dstCluster, CloudProvider: "aws"},
+			Type:                types.TransferTypeCrossCluster,
+			TotalBytes:          10 * gib,
+		}
+	}
+
+	cost := e.CalculateCost(flow("prod-b"))
+	if cost.Category != types.CostCategoryCrossCluster || cost.PricingRuleID == nil {
+		t.Fatalf("category %s, rule %v; want a cross-cluster rule", cost.Category, cost.PricingRuleID)
+	}
+	if !approxEqual(cost.CostUSD, 0.20) {
+		t.Errorf("10GB across clusters cost $%v, want $0.20", cost.CostUSD)
+	}
+
+	same := flow("prod-a")
+	same.Type = types.TransferTypePodToPod
+	if c := e.CalculateCost(same); c.Category == types.CostCategoryCrossCluster {
+		t.Errorf("same-cluster flow priced as %s", c.Category)
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// DetectionMode selects how current values are compared with baselines.
+type DetectionMode string
+
+const (
+	// DetectionZScore flags values more than the threshold in standard
+	// deviations from the mean. It assumes roughly normal data.
+	DetectionZScore DetectionMode = "zscore"
+	// DetectionPercentile flags values above a baseline percentile times a
+	// multiplier. It suits bursty, heavy-tailed traffic.
+	DetectionPercentile DetectionMode = "percentile"
+)
+
+// DetectionConfig configures anomaly detection.
+type DetectionConfig struct {
+	Mode       DetectionMode
+	Percentile int     // 95 or 99, for DetectionPercentile; default 99
+	Multiplier float64 // Applied to the percentile; default 1
+
+	// MinAbsoluteDelta is the smallest change from the baseline mean, in
+	// bytes per hour, that can be anomalous. It keeps tiny flows with huge
+	// relative swings quiet. Zero disables the floor.
+	MinAbsoluteDelta float64
+}
+
+// SetDetection switches the detection mode.
+func (e *BaselineEngine) SetDetection(cfg DetectionConfig) error {
+	switch cfg.Mode {
+	case "", DetectionZScore:
+		cfg.Mode = DetectionZScore
+	case DetectionPercentile:
+		if cfg.Percentile == 0 {
+			cfg.Percentile = 99
+		}
+		if cfg.Percentile != 95 && cfg.Percentile != 99 {
+			return fmt.Errorf("percentile must be 95 or 99, got %d", cfg.Percentile)
+		}
+		if cfg.Multiplier == 0 {
+			cfg.Multiplier = 1
+		}
+		if cfg.Multiplier < 0 {
+			return fmt.Errorf("percentile multiplier must be positive, got %g", cfg.Multiplier)
+		}
+	default:
+		return fmt.Errorf("unknown detection mode %q", cfg.Mode)
+	}
+	if cfg.MinAbsoluteDelta < 0 {
+		return fmt.Errorf("minimum absolute delta must not be negative, got %g", cfg.MinAbsoluteDelta)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.detection = cfg
+	return nil
+}
+
+// isAnomalous applies the configured detection mode, scaled by any learned
+// false-positive adjustment, to changes above the absolute delta floor. Caller must hold e.mu.
+func (e *BaselineEngine) isAnomalous(flowKey string, baseline *types.Baseline, currentValue float64) bool {
+	if math.Abs(currentValue-baseline.BytesPerHourMean) < e.detection.MinAbsoluteDelta {
+		return false
+	}
+	if e.detection.Mode != DetectionPercentile {
+		return baseline.IsAnomalous(currentValue, e.effectiveThreshold(flowKey))
+	}
+
+	limit := baseline.BytesPerHourP99
+	if e.detection.Percentile == 95 {
+		limit = baseline.BytesPerHourP95
+	}
+	if limit == 0 {
+		limit = baseline.BytesPerHourMean * 2
+	}
+	return currentValue > limit*e.detection.Multiplier*e.thresholdMultiplier(flowKey)
+}
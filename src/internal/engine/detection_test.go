@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// burstyValues is a week of hourly traffic at 1000 bytes with a 15-20KB
+// burst every 20 hours: heavy-tailed, like batch jobs.
+func burstyValues() []float64 {
+	values := make([]float64, 168)
+	for i := range values {
+		values[i] = 1000
+		if i%20 == 0 {
+			values[i] = 15000 + float64(i%7)*800
+		}
+	}
+	return values
+}
+
+// countAlerts replays values against a baseline of burstyValues in the
+// given detection mode.
+func countAlerts(t *testing.T, cfg DetectionConfig, values []float64) int {
+	t.Helper()
+	e := NewBaselineEngine(3)
+	if err := e.SetDetection(cfg); err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now()
+	if e.BuildBaseline(context.Background(), testFlowKey, burstyValues(), end.Add(-168*time.Hour), end) == nil {
+		t.Fatal("no baseline built")
+	}
+
+	var alerts int
+	for _, v := range values {
+		alerts += len(e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: v}))
+	}
+	return alerts
+}
+
+func TestPercentileDetectionOnHeavyTail(t *testing.T) {
+	zscore := DetectionConfig{Mode: DetectionZScore}
+	p99 := DetectionConfig{Mode: DetectionPercentile}
+
+	// Replaying the baseline week: every burst is normal for this flow
+	replay := burstyValues()
+	zAlerts, pAlerts := countAlerts(t, zscore, replay), countAlerts(t, p99, replay)
+	if zAlerts != 9 {
+		t.Errorf("z-score raised %d alerts on the usual bursts, want all 9", zAlerts)
+	}
+	if pAlerts > 2 {
+		t.Errorf("P99 raised %d alerts on the usual bursts, want at most the 2 largest", pAlerts)
+	}
+	if got := countAlerts(t, DetectionConfig{Mode: DetectionPercentile, Multiplier: 1.1}, replay); got != 0 {
+		t.Errorf("P99 x1.1 raised %d alerts, want none", got)
+	}
+
+	// A real spike is caught either way
+	spike := []float64{100000}
+	if countAlerts(t, zscore, spike) != 1 || countAlerts(t, p99, spike) != 1 {
+		t.Error("a 100KB spike was missed")
+	}
+}
+
+func TestSetDetectionValidation(t *testing.T) {
+	e := NewBaselineEngine(3)
+	for _, cfg := range []DetectionConfig{
+		{Mode: "median"},
+		{Mode: DetectionPercentile, Percentile: 90},
+		{Mode: DetectionPercentile, Multiplier: -1},
+		{Mode: DetectionZScore, MinAbsoluteDelta: -1},
+	} {
+		if err := e.SetDetection(cfg); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+
+	if err := e.SetDetection(DetectionConfig{Mode: DetectionPercentile}); err != nil {
+		t.Fatal(err)
+	}
+	if e.detection.Percentile != 99 || e.detection.Multiplier != 1 {
+		t.Errorf("defaults = P%d x%g, want P99 x1", e.detection.Percentile, e.detection.Multiplier)
+	}
+}
+
+func TestMinAbsoluteDeltaFloor(t *testing.T) {
+	// A flow idling at about 10 bytes an hour
+	tiny := make([]float64, 48)
+	for i := range tiny {
+		tiny[i] = 10 + float64(i%2)
+	}
+	detect := func(floor, current float64) int {
+		e := NewBaselineEngine(3)
+		if err := e.SetDetection(DetectionConfig{Mode: DetectionZScore, MinAbsoluteDelta: floor}); err != nil {
+			t.Fatal(err)
+		}
+		end := time.Now()
+		if e.BuildBaseline(context.Background(), testFlowKey, tiny, end.Add(-48*time.Hour), end) == nil {
+			t.Fatal("no baseline built")
+		}
+		return len(e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: current}))
+	}
+
+	if got := detect(0, 500); got != 1 {
+		t.Errorf("without a floor, 10 -> 500 bytes raised %d alerts, want 1", got)
+	}
+	if got := detect(1<<20, 500); got != 0 {
+		t.Errorf("with a 1 MiB floor, 10 -> 500 bytes raised %d alerts, want none", got)
+	}
+	if got := detect(1<<20, 10<<20); got != 1 {
+		t.Errorf("with a 1 MiB floor, 10 bytes -> 10 MiB raised %d alerts, want 1", got)
+	}
+
+	e := NewBaselineEngine(3)
+	if err := e.SetDetection(DetectionConfig{Mode: DetectionZScore, MinAbsoluteDelta: -1}); err == nil {
+		t.Error("negative floor accepted")
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// Built-in attribution dimensions backed by ServiceIdentity fields. Any other
+// dimension name is reported in CostAttribution.Dimensions.
+const (
+	DimensionTeam        = "team"
+	DimensionEnvironment = "environment"
+)
+
+// SetLabelDimensions maps source label keys to attribution dimensions, e.g.
+// "squad" to "team" or "cost-center" to "cost-center". When a mapped label
+// is present its value overrides the identity field for built-in dimensions.
+// The mapping replaces any previous one.
+func (e *CostEngine) SetLabelDimensions(mapping map[string]string) error {
+	dims := make(map[string]string, len(mapping))
+	for label, dim := range mapping {
+		if label == "" || dim == "" {
+			return fmt.Errorf("invalid label dimension mapping %q=%q", label, dim)
+		}
+		dims[label] = dim
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.labelDimensions = dims
+	return nil
+}
+
+// GetLabelDimensions returns the label key to dimension mapping.
+func (e *CostEngine) GetLabelDimensions() map[string]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make(map[string]string, len(e.labelDimensions))
+	for label, dim := range e.labelDimensions {
+		out[label] = dim
+	}
+	return out
+}
+
+// resolveDimensions returns the attribution dimensions of a source identity:
+// team and environment from the identity unless a mapped label overrides
+// them, plus every other mapped label present.
+func (e *CostEngine) resolveDimensions(id types.ServiceIdentity) map[string]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	dims := make(map[string]string)
+	if id.Team != "" {
+		dims[DimensionTeam] = id.Team
+	}
+	if id.Environment != "" {
+		dims[DimensionEnvironment] = id.Environment
+	}
+	for label, dim := range e.labelDimensions {
+		if v := id.Labels[label]; v != "" {
+			dims[dim] = v
+		}
+	}
+	return dims
+}
+
+// dimensionGroupKey groups flows by the value of dimension.
+func (e *CostEngine) dimensionGroupKey(dimension string) func(types.TransferFlow) string {
+	return func(flow types.TransferFlow) string {
+		return e.resolveDimensions(flow.SourceIdentity)[dimension]
+	}
+}
+
+// scopeToDimension clears the fields of dimension-grouped attributions that
+// are not shared by the group. Each group spans several services, so only
+// the shared dimensions are meaningful.
+func scopeToDimension(attributions []types.CostAttribution, dimension string) {
+	for i := range attributions {
+		a := &attributions[i]
+		a.Namespace, a.ServiceName, a.DeploymentVersion = "", "", ""
+		switch dimension {
+		case DimensionTeam:
+			a.Environment, a.Dimensions = "", nil
+		case DimensionEnvironment:
+			a.Team, a.Dimensions = "", nil
+		default:
+			a.Team, a.Environment = "", ""
+			if value := a.Dimensions[dimension]; value != "" {
+				a.Dimensions = map[string]string{dimension: value}
+			} else {
+				a.Dimensions = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// costCenterResults are stored flows as the attribution query returns them
+// with the cost-center label asked for.
+func costCenterResults() []storage.FlowResult {
+	return []storage.FlowResult{
+		{SrcNamespace: "shop", SrcService: "api", SrcLabels: map[string]string{"cost-center": "cc-100"}, DstExternal: "203.0.113.1", TransferType: "egress", TotalBytes: 2 * gib},
+		{SrcNamespace: "shop", SrcService: "web", SrcLabels: map[string]string{"cost-center": "cc-100"}, DstExternal: "203.0.113.1", TransferType: "egress", TotalBytes: 1 * gib},
+		{SrcNamespace: "data", SrcService: "etl", SrcLabels: map[string]string{"cost-center": "cc-200"}, DstExternal: "203.0.113.1", TransferType: "egress", TotalBytes: 4 * gib},
+		{SrcNamespace: "data", SrcService: "misc", DstExternal: "203.0.113.1", TransferType: "egress", TotalBytes: 1 * gib},
+	}
+}
+
+func TestAttributionByCostCenterLabel(t *testing.T) {
+	e := NewCostEngine()
+	if err := e.SetLabelDimensions(map[string]string{"cost-center": "cost-center"}); err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now()
+	start := end.Add(-time.Hour)
+
+	b := e.NewAttributionBuilder(start, end, "cost-center")
+	for _, r := range costCenterResults() {
+		b.Add([]types.TransferFlow{r.ToFlow(start, end)})
+	}
+
+	bytes := make(map[string]uint64)
+	for _, a := range b.Attributions() {
+		if a.ServiceName != "" || a.Namespace != "" {
+			t.Errorf("group %v keeps service %s/%s", a.Dimensions, a.Namespace, a.ServiceName)
+		}
+		bytes[a.Dimensions["cost-center"]] += a.TotalBytes
+	}
+	want := map[string]uint64{"cc-100": 3 * gib, "cc-200": 4 * gib, "": 1 * gib}
+	if len(bytes) != len(want) {
+		t.Fatalf("groups = %v, want %v", bytes, want)
+	}
+	for cc, n := range want {
+		if bytes[cc] != n {
+			t.Errorf("cost center %q: %d bytes, want %d", cc, bytes[cc], n)
+		}
+	}
+}
+
+func TestLabelOverridesTeam(t *testing.T) {
+	e := NewCostEngine()
+	if err := e.SetLabelDimensions(map[string]string{"squad": DimensionTeam}); err != nil {
+		t.Fatal(err)
+	}
+
+	dims := e.resolveDimensions(types.ServiceIdentity{Team: "platform", Labels: map[string]string{"squad": "checkout"}})
+	if dims[DimensionTeam] != "checkout" {
+		t.Errorf("team = %q, want the squad label", dims[DimensionTeam])
+	}
+	if dims := e.resolveDimensions(types.ServiceIdentity{Team: "platform"}); dims[DimensionTeam] != "platform" {
+		t.Errorf("team without label = %q, want platform", dims[DimensionTeam])
+	}
+}
+
+func TestSetLabelDimensionsRejectsEmpty(t *testing.T) {
+	if err := NewCostEngine().SetLabelDimensions(map[string]string{"cost-center": ""}); err == nil {
+		t.Error("want error for an empty dimension")
+	}
+}
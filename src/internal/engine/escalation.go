@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// severityLevels orders severities from least to most severe.
+var severityLevels = []types.Severity{
+	types.SeverityInfo,
+	types.SeverityLow,
+	types.SeverityMedium,
+	types.SeverityHigh,
+	types.SeverityCritical,
+}
+
+// escalationState tracks the severity each active anomaly was detected
+// with, so escalation is measured from detection rather than compounding.
+type escalationState struct {
+	every    time.Duration
+	detected map[uuid.UUID]types.Severity
+}
+
+// SetEscalationInterval makes active anomalies rise one severity level for
+// every d they stay active, up to critical. Zero disables escalation.
+func (e *BaselineEngine) SetEscalationInterval(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.escalation.every = d
+}
+
+// ReconcileAnomalies escalates active anomalies that have persisted past
+// the escalation interval and returns how many were escalated. Escalated
+// anomalies get UpdatedAt set to now and are persisted.
+func (e *BaselineEngine) ReconcileAnomalies(now time.Time) int {
+	e.mu.Lock()
+	every := e.escalation.every
+	if every <= 0 {
+		e.mu.Unlock()
+		return 0
+	}
+	if e.escalation.detected == nil {
+		e.escalation.detected = make(map[uuid.UUID]types.Severity)
+	}
+
+	var escalated []types.Anomaly
+	active := make(map[uuid.UUID]bool)
+	for _, a := range e.anomalies {
+		if !a.IsActive() {
+			continue
+		}
+		active[a.ID] = true
+
+		detected, ok := e.escalation.detected[a.ID]
+		if !ok {
+			detected = a.Severity
+			e.escalation.detected[a.ID] = detected
+		}
+		target := escalateSeverity(detected, int(now.Sub(a.DetectedAt)/every))
+		if severityLevel(target) <= severityLevel(a.Severity) {
+			continue
+		}
+
+		log.Info().
+			Str("anomaly_id", a.ID.String()).
+			Str("from", string(a.Severity)).
+			Str("to", string(target)).
+			Msg("Escalating sustained anomaly")
+		a.Severity = target
+		a.UpdatedAt = now
+		escalated = append(escalated, a.Clone())
+	}
+	for id := range e.escalation.detected {
+		if !active[id] {
+			delete(e.escalation.detected, id)
+		}
+	}
+	store := e.store
+	e.mu.Unlock()
+
+	for _, snapshot := range escalated {
+		persistAnomaly(store, snapshot, false)
+	}
+	return len(escalated)
+}
+
+// escalateSeverity returns the severity steps levels above s, capped at
+// critical. Unknown severities are left as they are.
+func escalateSeverity(s types.Severity, steps int) types.Severity {
+	level := severityLevel(s)
+	if level < 0 {
+		return s
+	}
+	return severityLevels[min(level+steps, len(severityLevels)-1)]
+}
+
+// severityLevel returns the index of s in severityLevels, or -1 if unknown.
+func severityLevel(s types.Severity) int {
+	for i, level := range severityLevels {
+		if level == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestSustainedAnomalyEscalates(t *testing.T) {
+	e := NewBaselineEngine(3)
+	store := &recordingAnomalyStore{}
+	e.SetAnomalyStore(store)
+	e.SetEscalationInterval(time.Hour)
+
+	detected := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	e.AddAnomaly(&types.Anomaly{ID: id, Type: types.AnomalyTypeSpike, Severity: types.SeverityMedium, DetectedAt: detected})
+	e.AddAnomaly(&types.Anomaly{ID: uuid.New(), Type: types.AnomalyTypeSpike, Severity: types.SeverityLow, DetectedAt: detected, Resolved: true})
+
+	steps := []struct {
+		after         time.Duration
+		wantEscalated int
+		wantSeverity  types.Severity
+	}{
+		{30 * time.Minute, 0, types.SeverityMedium},
+		{time.Hour, 1, types.SeverityHigh},
+		{90 * time.Minute, 0, types.SeverityHigh},
+		{2 * time.Hour, 1, types.SeverityCritical},
+		{5 * time.Hour, 0, types.SeverityCritical},
+	}
+	for _, step := range steps {
+		now := detected.Add(step.after)
+		if got := e.ReconcileAnomalies(now); got != step.wantEscalated {
+			t.Errorf("after %s: escalated %d, want %d", step.after, got, step.wantEscalated)
+		}
+		active := e.GetActiveAnomalies()
+		if len(active) != 1 || active[0].Severity != step.wantSeverity {
+			t.Fatalf("after %s: active = %+v, want one %s anomaly", step.after, active, step.wantSeverity)
+		}
+		if step.wantEscalated > 0 && !active[0].UpdatedAt.Equal(now) {
+			t.Errorf("after %s: updated at %s, want %s", step.after, active[0].UpdatedAt, now)
+		}
+	}
+
+	if len(store.updated) != 2 || store.updated[0].Severity != types.SeverityHigh || store.updated[1].Severity != types.SeverityCritical {
+		t.Errorf("persisted %+v, want the high and critical escalations", store.updated)
+	}
+}
+
+func TestEscalationDisabled(t *testing.T) {
+	e := NewBaselineEngine(3)
+	e.AddAnomaly(&types.Anomaly{ID: uuid.New(), Severity: types.SeverityLow, DetectedAt: time.Now().Add(-48 * time.Hour)})
+
+	if got := e.ReconcileAnomalies(time.Now()); got != 0 {
+		t.Errorf("escalated %d without an interval", got)
+	}
+	if active := e.GetActiveAnomalies(); active[0].Severity != types.SeverityLow {
+		t.Errorf("severity = %s, want low", active[0].Severity)
+	}
+}
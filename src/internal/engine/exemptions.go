@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// costExemption is a validated exemption with its parsed CIDR.
+type costExemption struct {
+	types.CostExemption
+	dstNet *net.IPNet
+}
+
+// matches reports whether the flow falls under the exemption.
+func (x costExemption) matches(flow types.TransferFlow) bool {
+	if x.SourceRegion != "" && x.SourceRegion != flow.SourceIdentity.Region {
+		return false
+	}
+	if x.DestinationRegion != "" {
+		if flow.DestinationIdentity == nil || x.DestinationRegion != flow.DestinationIdentity.Region {
+			return false
+		}
+	}
+	if x.dstNet != nil {
+		if flow.DestinationEndpoint == nil {
+			return false
+		}
+		ip := net.ParseIP(flow.DestinationEndpoint.IP)
+		if ip == nil || !x.dstNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddCostExemption registers traffic that should be priced at zero.
+func (e *CostEngine) AddCostExemption(x types.CostExemption) error {
+	if x.SourceRegion == "" && x.DestinationRegion == "" && x.DestinationCIDR == "" {
+		return errors.New("cost exemption needs a region or CIDR")
+	}
+
+	ex := costExemption{CostExemption: x}
+	if x.DestinationCIDR != "" {
+		_, ipNet, err := net.ParseCIDR(x.DestinationCIDR)
+		if err != nil {
+			return fmt.Errorf("parsing exemption CIDR: %w", err)
+		}
+		ex.dstNet = ipNet
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.exemptions = append(e.exemptions, ex)
+	return nil
+}
+
+// GetCostExemptions returns the registered cost exemptions.
+func (e *CostEngine) GetCostExemptions() []types.CostExemption {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]types.CostExemption, len(e.exemptions))
+	for i, x := range e.exemptions {
+		out[i] = x.CostExemption
+	}
+	return out
+}
+
+// isExempt reports whether any exemption matches the flow. Caller must hold e.mu.
+func (e *CostEngine) isExempt(flow types.TransferFlow) bool {
+	for _, x := range e.exemptions {
+		if x.matches(flow) {
+			return true
+		}
+	}
+	return false
+}
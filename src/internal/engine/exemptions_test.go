@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// crossAZFlow is a 10GB cross-AZ flow between regions src and dst.
+func crossAZFlow(src, dst string) types.TransferFlow {
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api", Region: src, CloudProvider: "aws"},
+		DestinationIdentity: &types.ServiceIdentity{Namespace: "shop", Name: "db", Region: dst, CloudProvider: "aws"},
+		Type:                types.TransferTypeCrossAZ,
+		TotalBytes:          10 * gib,
+	}
+}
+
+func TestExemptRegionPairCostsNothing(t *testing.T) {
+	e := NewCostEngine()
+	if err := e.AddCostExemption(types.CostExemption{SourceRegion: "us-east-1", DestinationRegion: "us-east-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	exempt := e.CalculateCost(crossAZFlow("us-east-1", "us-east-1"))
+	if !exempt.Exempt || exempt.CostUSD != 0 || exempt.Category != types.CostCategoryVPCPeering {
+		t.Errorf("exempt pair = %+v, want $0 as VPC peering", exempt)
+	}
+	if exempt.BytesTransferred != 10*gib || exempt.SourceService != "shop/api" || exempt.DestinationService != "shop/db" {
+		t.Errorf("exempt pair = %+v, want the traffic still reported", exempt)
+	}
+
+	charged := e.CalculateCost(crossAZFlow("us-west-2", "us-west-2"))
+	if charged.Exempt || charged.CostUSD == 0 {
+		t.Errorf("other pair = %+v, want it charged", charged)
+	}
+}
+
+func TestExemptCIDRCostsNothing(t *testing.T) {
+	e := NewCostEngine()
+	if err := e.AddCostExemption(types.CostExemption{DestinationCIDR: "10.20.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+
+	flow := azureEgress("api", 5, time.Now())
+	flow.DestinationEndpoint = &types.Endpoint{IP: "10.20.3.4"}
+	if b := e.CalculateCost(flow); !b.Exempt || b.CostUSD != 0 {
+		t.Errorf("flow into the exempt CIDR = %+v, want $0", b)
+	}
+
+	flow.DestinationEndpoint = &types.Endpoint{IP: "10.21.3.4"}
+	if b := e.CalculateCost(flow); b.Exempt {
+		t.Errorf("flow outside the CIDR = %+v, want it charged", b)
+	}
+}
+
+func TestAddCostExemptionValidation(t *testing.T) {
+	e := NewCostEngine()
+	for _, x := range []types.CostExemption{{}, {DestinationCIDR: "10.20.0.0"}} {
+		if err := e.AddCostExemption(x); err == nil {
+			t.Errorf("exemption %+v accepted", x)
+		}
+	}
+	if len(e.GetCostExemptions()) != 0 {
+		t.Error("rejected exemptions were registered")
+	}
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// CostExplanation shows how a flow was priced: which rule matched, how
+// much of it fell in the free tier, and the charge at each tier.
+type CostExplanation struct {
+	Breakdown     types.CostBreakdown `json:"breakdown"`
+	Category      types.CostCategory  `json:"category"`
+	RuleID        *uuid.UUID          `json:"rule_id,omitempty"`
+	RuleName      string              `json:"rule_name,omitempty"`
+	DefaultRate   bool                `json:"default_rate"` // No rule matched; built-in rates applied
+	Exempt        bool                `json:"exempt"`
+	BilledBytes   uint64              `json:"billed_bytes"` // Transferred plus overhead bytes
+	BilledGB      float64             `json:"billed_gb"`
+	AlreadyUsedGB float64             `json:"already_used_gb"` // Month-to-date usage the rule's tiers start from
+	FreeTierGB    float64             `json:"free_tier_gb"`
+	InFreeTier    bool                `json:"in_free_tier"` // The whole flow fell within the free tier
+	Charges       []types.TierCharge  `json:"charges"`
+	Steps         []string            `json:"steps"`
+}
+
+// ExplainCost prices a flow as CalculateCost does and reports the rule,
+// tiers and arithmetic behind the result.
+func (e *CostEngine) ExplainCost(flow types.TransferFlow) CostExplanation {
+	breakdown := e.CalculateCost(flow)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ex := CostExplanation{
+		Breakdown:   breakdown,
+		Category:    breakdown.Category,
+		Exempt:      breakdown.Exempt,
+		BilledBytes: breakdown.BytesTransferred + breakdown.OverheadBytes,
+		Charges:     []types.TierCharge{},
+	}
+	ex.BilledGB = float64(ex.BilledBytes) / (1024 * 1024 * 1024)
+
+	if ex.Exempt {
+		ex.Steps = append(ex.Steps, "flow matches a cost exemption; cost = $0")
+		return ex
+	}
+
+	ex.Steps = append(ex.Steps, fmt.Sprintf("category = %s", ex.Category))
+	if breakdown.OverheadBytes > 0 {
+		ex.Steps = append(ex.Steps, fmt.Sprintf("billed bytes = %d transferred + %d packet overhead = %d",
+			breakdown.BytesTransferred, breakdown.OverheadBytes, ex.BilledBytes))
+	}
+	ex.Steps = append(ex.Steps, fmt.Sprintf("billed GB = %d / 1024^3 = %.6f", ex.BilledBytes, ex.BilledGB))
+
+	rule := e.findMatchingRule(flow, ex.Category)
+	if rule == nil {
+		rate := defaultCostPerGB(ex.Category)
+		ex.DefaultRate = true
+		ex.Charges = append(ex.Charges, breakdown.Charges...)
+		ex.Steps = append(ex.Steps,
+			"no pricing rule matched; using the default rate",
+			fmt.Sprintf("%.6f GB x $%.4f/GB = $%.6f", ex.BilledGB, rate, breakdown.CostUSD))
+		return ex
+	}
+
+	id := rule.ID
+	ex.RuleID = &id
+	ex.RuleName = rule.Name
+	ex.FreeTierGB = rule.FreeTierGB
+	ex.AlreadyUsedGB = e.monthly[usageKey(flow, rule.CloudProvider, ex.Category)]
+	ex.Steps = append(ex.Steps, fmt.Sprintf("matched rule %q (%s)", rule.Name, rule.ID))
+
+	if ex.AlreadyUsedGB+ex.BilledGB <= rule.FreeTierGB {
+		ex.InFreeTier = true
+		ex.Steps = append(ex.Steps, fmt.Sprintf("%.6f GB used + %.6f GB <= %.6f GB free tier; cost = $0",
+			ex.AlreadyUsedGB, ex.BilledGB, rule.FreeTierGB))
+		return ex
+	}
+	if rule.FreeTierGB > ex.AlreadyUsedGB {
+		ex.Steps = append(ex.Steps, fmt.Sprintf("%.6f GB falls within the %.6f GB free tier",
+			rule.FreeTierGB-ex.AlreadyUsedGB, rule.FreeTierGB))
+	}
+
+	ex.Charges = append(ex.Charges, breakdown.Charges...)
+	for _, c := range ex.Charges {
+		if c.ThresholdGB > 0 {
+			ex.Steps = append(ex.Steps, fmt.Sprintf("tier up to %.0f GB: %.6f GB x $%.4f/GB = $%.6f",
+				c.ThresholdGB, c.GB, c.CostPerGB, c.CostUSD))
+		} else {
+			ex.Steps = append(ex.Steps, fmt.Sprintf("base rate: %.6f GB x $%.4f/GB = $%.6f",
+				c.GB, c.CostPerGB, c.CostUSD))
+		}
+	}
+	ex.Steps = append(ex.Steps, fmt.Sprintf("cost = $%.6f", breakdown.CostUSD))
+	return ex
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestExplainCostTieredRule(t *testing.T) {
+	e := newTieredEngine()
+	now := time.Now()
+	e.RecordFlowCost(azureEgress("api", 9, now))
+
+	ex := e.ExplainCost(azureEgress("api", 3, now))
+
+	if ex.RuleName != "Test Azure Egress" || ex.RuleID == nil || ex.DefaultRate {
+		t.Fatalf("rule = %q (%v), default %v; want the tiered rule", ex.RuleName, ex.RuleID, ex.DefaultRate)
+	}
+	if !approxEqual(ex.AlreadyUsedGB, 9) {
+		t.Errorf("AlreadyUsedGB = %v, want 9", ex.AlreadyUsedGB)
+	}
+	if ex.InFreeTier {
+		t.Error("InFreeTier = true, want false")
+	}
+	want := []types.TierCharge{
+		{ThresholdGB: 10, GB: 1, CostPerGB: 0.10, CostUSD: 0.10},
+		{GB: 2, CostPerGB: 0.05, CostUSD: 0.10},
+	}
+	if len(ex.Charges) != len(want) {
+		t.Fatalf("charges = %+v, want %+v", ex.Charges, want)
+	}
+	for i, c := range ex.Charges {
+		if c.ThresholdGB != want[i].ThresholdGB || !approxEqual(c.GB, want[i].GB) ||
+			c.CostPerGB != want[i].CostPerGB || !approxEqual(c.CostUSD, want[i].CostUSD) {
+			t.Errorf("charge %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+	if !approxEqual(ex.Breakdown.CostUSD, 0.20) {
+		t.Errorf("cost = %v, want 0.20", ex.Breakdown.CostUSD)
+	}
+	if len(ex.Steps) == 0 {
+		t.Error("no steps explained")
+	}
+}
+
+func TestExplainCostWithinFreeTier(t *testing.T) {
+	ex := newTieredEngine().ExplainCost(azureEgress("api", 0.5, time.Now()))
+
+	if !ex.InFreeTier || ex.Breakdown.CostUSD != 0 || len(ex.Charges) != 0 {
+		t.Errorf("in free tier %v, cost %v, charges %+v; want free", ex.InFreeTier, ex.Breakdown.CostUSD, ex.Charges)
+	}
+}
+
+func TestExplainCostFallsThroughToDefaultRate(t *testing.T) {
+	// No rule prices Azure cross-region transfer
+	flow := azureEgress("api", 2, time.Now())
+	flow.Type = types.TransferTypeCrossRegion
+
+	ex := newTieredEngine().ExplainCost(flow)
+
+	if !ex.DefaultRate || ex.RuleID != nil {
+		t.Fatalf("default %v, rule %v; want the default rate", ex.DefaultRate, ex.RuleID)
+	}
+	if ex.Category != types.CostCategoryCrossRegion {
+		t.Errorf("category = %s, want %s", ex.Category, types.CostCategoryCrossRegion)
+	}
+	if !approxEqual(ex.Breakdown.CostUSD, 2*defaultCostPerGB(types.CostCategoryCrossRegion)) {
+		t.Errorf("cost = %v, want %v", ex.Breakdown.CostUSD, 2*defaultCostPerGB(types.CostCategoryCrossRegion))
+	}
+}
+
+func TestTierBoundaryCrossedByTwoFlows(t *testing.T) {
+	now := time.Now()
+	flows := []types.TransferFlow{azureEgress("api", 6, now), azureEgress("web", 6, now)}
+
+	t.Run("recorded", func(t *testing.T) {
+		e := newTieredEngine()
+		first := e.RecordFlowCost(flows[0])
+		second := e.RecordFlowCost(flows[1])
+
+		// 1GB free, then 5GB at $0.10
+		if !approxEqual(first.CostUSD, 0.5) {
+			t.Errorf("first cost = %v, want 0.5", first.CostUSD)
+		}
+		// 4GB more at $0.10 reaches the 10GB boundary, 2GB beyond at $0.05
+		if len(second.Charges) != 2 || !approxEqual(second.Charges[0].GB, 4) || !approxEqual(second.Charges[1].GB, 2) {
+			t.Fatalf("second charges = %+v, want 4GB in the tier and 2GB beyond", second.Charges)
+		}
+		if !approxEqual(second.CostUSD, 0.5) {
+			t.Errorf("second cost = %v, want 0.5", second.CostUSD)
+		}
+	})
+
+	t.Run("attributed", func(t *testing.T) {
+		attrs := newTieredEngine().CalculateAttribution(context.Background(), flows, now.Add(-time.Hour), now)
+
+		var total float64
+		for _, a := range attrs {
+			total += a.TotalCostUSD
+		}
+		if !approxEqual(total, 1.0) {
+			t.Errorf("attributed cost = %v, want 1.0", total)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+const (
+	// falsePositiveLimit is the number of false-positive resolutions after
+	// which a flow's detection threshold is raised.
+	falsePositiveLimit = 3
+	// falsePositiveThresholdStep multiplies the threshold each time the
+	// limit is reached.
+	falsePositiveThresholdStep = 1.5
+)
+
+// recordFeedback records a resolution outcome for a flow and raises its
+// threshold after every falsePositiveLimit false positives. Caller must
+// hold e.mu.
+func (e *BaselineEngine) recordFeedback(flowKey string, falsePositive bool) {
+	fb, ok := e.feedback[flowKey]
+	if !ok {
+		fb = &types.FlowFeedback{
+			FlowKey:             flowKey,
+			ThresholdMultiplier: 1,
+		}
+		e.feedback[flowKey] = fb
+	}
+
+	fb.Resolutions++
+	fb.UpdatedAt = time.Now()
+	if !falsePositive {
+		return
+	}
+
+	fb.FalsePositives++
+	if fb.FalsePositives%falsePositiveLimit == 0 {
+		fb.ThresholdMultiplier *= falsePositiveThresholdStep
+
+		log.Info().
+			Str("flow", flowKey).
+			Int("false_positives", fb.FalsePositives).
+			Float64("threshold", e.thresholdStdDev*fb.ThresholdMultiplier).
+			Msg("Raised anomaly threshold after false positives")
+	}
+}
+
+// effectiveThreshold returns the detection threshold for a flow, including
+// learned adjustments. Caller must hold e.mu.
+func (e *BaselineEngine) effectiveThreshold(flowKey string) float64 {
+	return e.thresholdStdDev * e.thresholdMultiplier(flowKey)
+}
+
+// thresholdMultiplier returns the learned threshold scale for a flow.
+// Caller must hold e.mu.
+func (e *BaselineEngine) thresholdMultiplier(flowKey string) float64 {
+	if fb, ok := e.feedback[flowKey]; ok {
+		return fb.ThresholdMultiplier
+	}
+	return 1
+}
+
+// EffectiveThreshold returns the detection threshold in stddevs for a flow.
+func (e *BaselineEngine) EffectiveThreshold(flowKey string) float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.effectiveThreshold(flowKey)
+}
+
+// GetFeedback returns learned per-flow feedback, most false positives first.
+func (e *BaselineEngine) GetFeedback() []types.FlowFeedback {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	result := make([]types.FlowFeedback, 0, len(e.feedback))
+	for key, fb := range e.feedback {
+		out := *fb
+		out.EffectiveThreshold = e.effectiveThreshold(key)
+		result = append(result, out)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].FalsePositives != result[j].FalsePositives {
+			return result[i].FalsePositives > result[j].FalsePositives
+		}
+		return result[i].FlowKey < result[j].FlowKey
+	})
+
+	return result
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// resolveSpike detects a spike of value on testFlowKey, records it and
+// resolves it, returning whether it was detected at all.
+func resolveSpike(t *testing.T, e *BaselineEngine, value float64, falsePositive bool) bool {
+	t.Helper()
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: value})
+	if len(anomalies) == 0 {
+		return false
+	}
+	e.AddAnomaly(anomalies[0])
+	if err := e.ResolveAnomaly(anomalies[0].ID, "expected batch job", falsePositive); err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+func TestFalsePositivesRaiseThreshold(t *testing.T) {
+	e := newSteadyEngine(t)
+	// About 4 standard deviations above the mean of 1000
+	const spike = 1040
+
+	for i := 0; i < falsePositiveLimit; i++ {
+		if e.EffectiveThreshold(testFlowKey) != 3 {
+			t.Fatalf("threshold raised after %d false positives", i)
+		}
+		if !resolveSpike(t, e, spike, true) {
+			t.Fatalf("spike %d not detected at the base threshold", i+1)
+		}
+	}
+
+	if got := e.EffectiveThreshold(testFlowKey); got != 3*falsePositiveThresholdStep {
+		t.Errorf("threshold after %d false positives = %v, want %v", falsePositiveLimit, got, 3*falsePositiveThresholdStep)
+	}
+	if len(e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: spike})) != 0 {
+		t.Error("the same spike is still detected after the threshold was raised")
+	}
+	if len(e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 5000})) != 1 {
+		t.Error("a much larger spike is no longer detected")
+	}
+
+	feedback := e.GetFeedback()
+	if len(feedback) != 1 || feedback[0].FlowKey != testFlowKey || feedback[0].FalsePositives != falsePositiveLimit ||
+		feedback[0].EffectiveThreshold != 3*falsePositiveThresholdStep {
+		t.Errorf("feedback = %+v, want the learned threshold for %s", feedback, testFlowKey)
+	}
+}
+
+func TestTruePositivesKeepThreshold(t *testing.T) {
+	e := newSteadyEngine(t)
+	for i := 0; i < 2*falsePositiveLimit; i++ {
+		resolveSpike(t, e, 1040, false)
+	}
+	if got := e.EffectiveThreshold(testFlowKey); got != 3 {
+		t.Errorf("threshold after real anomalies = %v, want 3", got)
+	}
+	if fb := e.GetFeedback(); len(fb) != 1 || fb[0].Resolutions != 2*falsePositiveLimit || fb[0].FalsePositives != 0 {
+		t.Errorf("feedback = %+v, want resolutions counted without false positives", fb)
+	}
+}
+
+func TestResolvingTwiceCountsFeedbackOnce(t *testing.T) {
+	e := newSteadyEngine(t)
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 1040})
+	if len(anomalies) == 0 {
+		t.Fatal("spike not detected")
+	}
+	if anomalies[0].FlowKey != testFlowKey {
+		t.Errorf("anomaly flow key = %q, want %q", anomalies[0].FlowKey, testFlowKey)
+	}
+	e.AddAnomaly(anomalies[0])
+	for i := 0; i < 2; i++ {
+		if err := e.ResolveAnomaly(anomalies[0].ID, "expected batch job", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fb := e.GetFeedback(); len(fb) != 1 || fb[0].FlowKey != testFlowKey || fb[0].Resolutions != 1 || fb[0].FalsePositives != 1 {
+		t.Errorf("feedback = %+v, want one false positive for %s", fb, testFlowKey)
+	}
+}
+
+func TestFeedbackIgnoresAnomaliesWithoutFlow(t *testing.T) {
+	e := newSteadyEngine(t)
+	// Cap and watchlist anomalies name the source but no baseline flow
+	a := &types.Anomaly{ID: uuid.New(), Type: types.AnomalyTypeCostAnomaly, SourceService: testFlowKey}
+	e.AddAnomaly(a)
+	if err := e.ResolveAnomaly(a.ID, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if fb := e.GetFeedback(); len(fb) != 0 {
+		t.Errorf("feedback = %+v, want none for anomalies outside the baselines", fb)
+	}
+}
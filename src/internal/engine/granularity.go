@@ -0,0 +1,70 @@
+package engine
+
+import "github.com/egressor/egressor/src/pkg/types"
+
+// NodeGranularity selects what a graph node stands for.
+type NodeGranularity string
+
+const (
+	// NodeGranularityService keys nodes by workload, "namespace/name".
+	NodeGranularityService NodeGranularity = "service"
+	// NodeGranularityDeployment keys nodes by workload version,
+	// "namespace/name@version", so e.g. canary and stable rollouts of a
+	// service are separate nodes.
+	NodeGranularityDeployment NodeGranularity = "deployment"
+	// NodeGranularityPod keys nodes by pod, "namespace/pod".
+	NodeGranularityPod NodeGranularity = "pod"
+)
+
+// ParseNodeGranularity validates a granularity name. Empty selects
+// NodeGranularityService.
+func ParseNodeGranularity(s string) (NodeGranularity, bool) {
+	switch granularity := NodeGranularity(s); granularity {
+	case "":
+		return NodeGranularityService, true
+	case NodeGranularityService, NodeGranularityDeployment, NodeGranularityPod:
+		return granularity, true
+	}
+	return NodeGranularityService, false
+}
+
+// SetGranularity changes how nodes are keyed for flows added from now on.
+// Existing nodes keep their keys, so the graph is reset.
+func (g *TransferGraph) SetGranularity(granularity NodeGranularity) {
+	g.mu.Lock()
+	g.granularity = granularity
+	g.mu.Unlock()
+	g.Reset()
+}
+
+// Granularity returns how nodes are keyed.
+func (g *TransferGraph) Granularity() NodeGranularity {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.granularity == "" {
+		return NodeGranularityService
+	}
+	return g.granularity
+}
+
+// nodeName returns the name part of the node key for identity. Identities
+// without a version or pod name fall back to the workload name. Caller
+// must hold g.mu.
+func (g *TransferGraph) nodeName(identity types.ServiceIdentity) string {
+	switch g.granularity {
+	case NodeGranularityDeployment:
+		if identity.Version != "" {
+			return identity.Name + "@" + identity.Version
+		}
+	case NodeGranularityPod:
+		if identity.PodName != "" {
+			return identity.PodName
+		}
+	}
+	return identity.Name
+}
+
+// nodeID returns the node key for identity. Caller must hold g.mu.
+func (g *TransferGraph) nodeID(identity types.ServiceIdentity) string {
+	return identity.Namespace + "/" + g.nodeName(identity)
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// podFlows returns flows from two pods of each of two api versions to two
+// pods of db.
+func podFlows() []types.TransferFlow {
+	var flows []types.TransferFlow
+	for i := 0; i < 4; i++ {
+		flow := serviceFlow("api", "db", 100)
+		flow.SourceIdentity.PodName = fmt.Sprintf("api-%d", i)
+		flow.SourceIdentity.Version = fmt.Sprintf("v%d", i/2+1)
+		flow.DestinationIdentity.PodName = fmt.Sprintf("db-%d", i%2)
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+func TestNodeGranularity(t *testing.T) {
+	tests := []struct {
+		granularity NodeGranularity
+		wantNodes   int
+		wantNode    string
+	}{
+		{NodeGranularityService, 2, "shop/api"},
+		{NodeGranularityDeployment, 3, "shop/api@v2"},
+		{NodeGranularityPod, 6, "shop/api-3"},
+	}
+	for _, tt := range tests {
+		g := NewTransferGraph()
+		g.SetGranularity(tt.granularity)
+		for _, flow := range podFlows() {
+			g.AddFlow(flow)
+		}
+
+		stats := g.GetStats()
+		if stats.TotalNodes != tt.wantNodes {
+			t.Errorf("%s: %d nodes, want %d", tt.granularity, stats.TotalNodes, tt.wantNodes)
+		}
+		if stats.TotalBytes != 400 {
+			t.Errorf("%s: %d bytes, want all 400", tt.granularity, stats.TotalBytes)
+		}
+		if g.GetNode(tt.wantNode) == nil {
+			t.Errorf("%s: no node %s", tt.granularity, tt.wantNode)
+		}
+	}
+}
+
+func TestNodeGranularityFallsBackToService(t *testing.T) {
+	g := NewTransferGraph()
+	g.SetGranularity(NodeGranularityPod)
+	g.AddFlow(serviceFlow("api", "db", 100))
+
+	if g.GetNode("shop/api") == nil || g.GetNode("shop/db") == nil {
+		t.Error("identities without pod names not keyed by service")
+	}
+}
+
+func TestParseNodeGranularity(t *testing.T) {
+	for s, want := range map[string]NodeGranularity{"": NodeGranularityService, "pod": NodeGranularityPod, "deployment": NodeGranularityDeployment} {
+		if got, ok := ParseNodeGranularity(s); !ok || got != want {
+			t.Errorf("%q: got %s, %v; want %s", s, got, ok, want)
+		}
+	}
+	if _, ok := ParseNodeGranularity("node"); ok {
+		t.Error("unknown granularity accepted")
+	}
+}
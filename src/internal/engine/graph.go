@@ -5,10 +5,10 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
 	"github.com/egressor/egressor/src/internal/storage"
@@ -27,14 +27,18 @@ type ServiceNode struct {
 	TotalBytesReceived uint64
 	TotalConnections   uint64
 	TotalEgressCostUSD float64
-	Neighbors          map[string]*Edge
+	Neighbors          map[string]*Edge // Outgoing edges by destination ID
+	FanIn              int              // Distinct sources sending to this node
+	Version            uint64           // Graph version of the last change
 }
 
 // Edge represents a transfer relationship between services.
 type Edge struct {
 	SourceID         string
 	DestinationID    string
-	TransferType     types.TransferType
+	TransferType     types.TransferType // Type carrying the most bytes
+	BytesByType      map[types.TransferType]uint64
+	Service          string // Destination service carrying the most bytes, e.g. "dns" or "s3"
 	FirstSeen        time.Time
 	LastSeen         time.Time
 	TotalBytes       uint64
@@ -42,6 +46,20 @@ type Edge struct {
 	TotalCostUSD     float64
 	BytesPerHourBase float64
 	CurrentRateRatio float64
+	Version          uint64 // Graph version of the last change
+
+	// recent holds bytes per minute over the last recentWindows minutes
+	// of flow time, for sparklines.
+	recent recentBytes
+
+	// flowKeys are the keys of the flows merged into the edge. They differ
+	// from the edge ID when the destination is an external node named by
+	// cloud service or hostname, which covers one flow key per IP.
+	flowKeys map[string]bool
+
+	// bytesByService holds bytes per destination service, "" for traffic
+	// to no known service, so Service does not follow the last flow.
+	bytesByService map[string]uint64
 }
 
 // TransferGraph represents the service dependency graph.
@@ -49,7 +67,33 @@ type TransferGraph struct {
 	nodes         map[string]*ServiceNode
 	edges         map[string]*Edge
 	externalNodes map[string]*ServiceNode
+	sizes         sizeHistogram
+	azBytes       map[azPair]uint64
 	mu            sync.RWMutex
+
+	// version increases with every mutation; resetVersion is the version of
+	// the last Reset, before which deltas cannot be computed.
+	version      uint64
+	resetVersion uint64
+	subscribers  map[chan struct{}]struct{}
+	subMu        sync.Mutex
+
+	// communityCache holds the communities of communityVersion. Readers
+	// share g.mu, so it has its own lock.
+	communityCache   []Community
+	communityVersion uint64
+	communityMu      sync.Mutex
+
+	// truncated marks a subgraph cut short by MaxSubgraphNodes.
+	truncated bool
+
+	// granularity selects how flow identities are keyed into nodes.
+	granularity NodeGranularity
+
+	// Rankings behind GetTopTalkers, GetTopListeners and GetTopEdges.
+	talkers    *ranking[*ServiceNode]
+	listeners  *ranking[*ServiceNode]
+	heavyEdges *ranking[*Edge]
 }
 
 // NewTransferGraph creates a new transfer graph.
@@ -58,56 +102,134 @@ func NewTransferGraph() *TransferGraph {
 		nodes:         make(map[string]*ServiceNode),
 		edges:         make(map[string]*Edge),
 		externalNodes: make(map[string]*ServiceNode),
+		talkers:       newRanking(func(n *ServiceNode) uint64 { return n.TotalBytesSent }),
+		listeners:     newRanking(func(n *ServiceNode) uint64 { return n.TotalBytesReceived }),
+		heavyEdges:    newRanking(func(e *Edge) uint64 { return e.TotalBytes }),
 	}
 }
 
+// Reset removes all nodes and edges in place, so holders of the graph
+// pointer keep a valid (empty) graph.
+func (g *TransferGraph) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nodes = make(map[string]*ServiceNode)
+	g.edges = make(map[string]*Edge)
+	g.externalNodes = make(map[string]*ServiceNode)
+	g.sizes = sizeHistogram{}
+	g.azBytes = nil
+	g.talkers.reset()
+	g.listeners.reset()
+	g.heavyEdges.reset()
+	g.version++
+	g.resetVersion = g.version
+	g.notify()
+}
+
 // AddFlow adds a flow to the graph.
 func (g *TransferGraph) AddFlow(flow types.TransferFlow) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.addFlow(flow)
+	g.notify()
+}
+
+// AddFlows adds a batch of flows under a single lock acquisition.
+func (g *TransferGraph) AddFlows(flows []types.TransferFlow) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range flows {
+		g.addFlow(flows[i])
+	}
+	if len(flows) > 0 {
+		g.notify()
+	}
+}
+
+// addFlow adds a flow to the graph. Caller must hold g.mu.
+func (g *TransferGraph) addFlow(flow types.TransferFlow) {
+	g.version++
+	g.sizes.observe(flow.TotalBytes)
 
 	// Get or create source node
-	srcID := flow.SourceIdentity.FullName()
+	srcID := g.nodeID(flow.SourceIdentity)
 	srcNode := g.getOrCreateNode(srcID, flow.SourceIdentity)
 	srcNode.TotalBytesSent += flow.TotalBytes
 	srcNode.TotalConnections += flow.EventCount
 	srcNode.LastSeen = flow.WindowEnd
+	srcNode.Version = g.version
+	g.talkers.update(srcNode)
 
 	// Get or create destination
 	var dstID string
+	var dstNode *ServiceNode
 	if flow.DestinationIdentity != nil {
-		dstID = flow.DestinationIdentity.FullName()
-		dstNode := g.getOrCreateNode(dstID, *flow.DestinationIdentity)
+		dstID = g.nodeID(*flow.DestinationIdentity)
+		dstNode = g.getOrCreateNode(dstID, *flow.DestinationIdentity)
 		dstNode.TotalBytesReceived += flow.TotalBytes
 		dstNode.LastSeen = flow.WindowEnd
+		dstNode.Version = g.version
+		g.listeners.update(dstNode)
+		g.recordAZ(flow.SourceIdentity.AvailabilityZone, flow.DestinationIdentity.AvailabilityZone, flow.TotalBytes)
 	} else if flow.DestinationEndpoint != nil {
-		dstID = "external:" + flow.DestinationEndpoint.IP
+		name := externalNodeName(flow.DestinationEndpoint)
+		dstID = "external:" + name
 		if _, ok := g.externalNodes[dstID]; !ok {
 			g.externalNodes[dstID] = &ServiceNode{
 				ID:        dstID,
 				Namespace: "external",
-				Name:      flow.DestinationEndpoint.IP,
+				Name:      name,
 				FirstSeen: flow.WindowStart,
 				Neighbors: make(map[string]*Edge),
 			}
 		}
-		g.externalNodes[dstID].TotalBytesReceived += flow.TotalBytes
-		g.externalNodes[dstID].LastSeen = flow.WindowEnd
+		dstNode = g.externalNodes[dstID]
+		dstNode.TotalBytesReceived += flow.TotalBytes
+		dstNode.LastSeen = flow.WindowEnd
+		dstNode.Version = g.version
+		g.listeners.update(dstNode)
 	} else {
 		dstID = "unknown"
 	}
 
 	// Get or create edge
-	edgeID := srcID + "→" + dstID
-	edge := g.getOrCreateEdge(edgeID, srcID, dstID, flow.Type)
+	edgeID := types.JoinFlowKey(srcID, dstID)
+	edge := g.getOrCreateEdge(edgeID, srcID, dstID, flow.Type, flow.WindowStart)
+	edge.flowKeys[flow.FlowKey()] = true
+	// Flows can arrive out of order, e.g. when loaded from storage
+	if !flow.WindowStart.IsZero() && flow.WindowStart.Before(edge.FirstSeen) {
+		edge.FirstSeen = flow.WindowStart
+	}
+	edge.addServiceBytes(flowService(flow), flow.TotalBytes)
 	edge.TotalBytes += flow.TotalBytes
+	edge.addTypedBytes(flow.Type, flow.TotalBytes)
 	edge.TotalEvents += flow.EventCount
+	edge.recent.add(flow.WindowStart, flow.TotalBytes)
 	edge.LastSeen = flow.WindowEnd
+	edge.Version = g.version
+	g.heavyEdges.update(edge)
 
 	// Update neighbor reference
+	if _, ok := srcNode.Neighbors[dstID]; !ok && dstNode != nil {
+		dstNode.FanIn++
+	}
 	srcNode.Neighbors[dstID] = edge
 }
 
+// externalNodeName names the external node for an endpoint: its cloud
+// service, else its hostname, else its IP. A service served from many
+// addresses, such as S3, is then one node.
+func externalNodeName(endpoint *types.Endpoint) string {
+	switch {
+	case endpoint.CloudServiceName != "":
+		return endpoint.CloudServiceName
+	case endpoint.Hostname != "":
+		return strings.ToLower(strings.TrimSuffix(endpoint.Hostname, "."))
+	}
+	return endpoint.IP
+}
+
 func (g *TransferGraph) getOrCreateNode(id string, identity types.ServiceIdentity) *ServiceNode {
 	if node, ok := g.nodes[id]; ok {
 		return node
@@ -116,7 +238,7 @@ func (g *TransferGraph) getOrCreateNode(id string, identity types.ServiceIdentit
 	node := &ServiceNode{
 		ID:        id,
 		Namespace: identity.Namespace,
-		Name:      identity.Name,
+		Name:      g.nodeName(identity),
 		Kind:      identity.Kind,
 		FirstSeen: time.Now(),
 		LastSeen:  time.Now(),
@@ -126,22 +248,66 @@ func (g *TransferGraph) getOrCreateNode(id string, identity types.ServiceIdentit
 	return node
 }
 
-func (g *TransferGraph) getOrCreateEdge(id, srcID, dstID string, transferType types.TransferType) *Edge {
+// getOrCreateEdge returns the edge with the given ID, creating it if needed.
+// A new edge is first seen at seenAt, or now if seenAt is zero.
+func (g *TransferGraph) getOrCreateEdge(id, srcID, dstID string, transferType types.TransferType, seenAt time.Time) *Edge {
 	if edge, ok := g.edges[id]; ok {
 		return edge
 	}
 
+	if seenAt.IsZero() {
+		seenAt = time.Now()
+	}
 	edge := &Edge{
-		SourceID:      srcID,
-		DestinationID: dstID,
-		TransferType:  transferType,
-		FirstSeen:     time.Now(),
-		LastSeen:      time.Now(),
+		SourceID:       srcID,
+		DestinationID:  dstID,
+		TransferType:   transferType,
+		BytesByType:    make(map[types.TransferType]uint64),
+		flowKeys:       make(map[string]bool),
+		bytesByService: make(map[string]uint64),
+		FirstSeen:      seenAt,
+		LastSeen:       seenAt,
 	}
 	g.edges[id] = edge
 	return edge
 }
 
+// addTypedBytes records bytes of one transfer type and updates the edge's
+// dominant type. A pair can carry mixed traffic, e.g. cross-AZ and egress.
+func (e *Edge) addTypedBytes(transferType types.TransferType, bytes uint64) {
+	e.BytesByType[transferType] += bytes
+	if e.BytesByType[transferType] > e.BytesByType[e.TransferType] {
+		e.TransferType = transferType
+	}
+}
+
+// addServiceBytes records bytes to one destination service and updates the
+// edge's dominant service.
+func (e *Edge) addServiceBytes(service string, bytes uint64) {
+	e.bytesByService[service] += bytes
+	if e.bytesByService[service] > e.bytesByService[e.Service] {
+		e.Service = service
+	}
+}
+
+// flowService returns the service a flow goes to: the well-known service
+// its port identifies, such as DNS in or out of the cluster, else the
+// external destination's cloud service.
+func flowService(flow types.TransferFlow) string {
+	if flow.WellKnownService != "" {
+		return flow.WellKnownService
+	}
+	if flow.DestinationEndpoint != nil {
+		return flow.DestinationEndpoint.CloudServiceName
+	}
+	return ""
+}
+
+// HasType reports whether the edge carries traffic of the given type.
+func (e *Edge) HasType(transferType types.TransferType) bool {
+	return e.TransferType == transferType || e.BytesByType[transferType] > 0
+}
+
 // GetNode returns a node by ID.
 func (g *TransferGraph) GetNode(id string) *ServiceNode {
 	g.mu.RLock()
@@ -157,13 +323,42 @@ func (g *TransferGraph) GetNode(id string) *ServiceNode {
 func (g *TransferGraph) GetEdge(srcID, dstID string) *Edge {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
-	return g.edges[srcID+"→"+dstID]
+	return g.edges[types.JoinFlowKey(srcID, dstID)]
+}
+
+// FlowKeys returns the keys of the flows merged into the edge between two
+// nodes, sorted, or nil if there is no such edge. Storage is queried by
+// flow key, so this is how an edge maps to its stored flows.
+func (g *TransferGraph) FlowKeys(srcID, dstID string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if edge, ok := g.edges[types.JoinFlowKey(srcID, dstID)]; ok {
+		return edge.sortedFlowKeys()
+	}
+	return nil
+}
+
+func (e *Edge) sortedFlowKeys() []string {
+	keys := make([]string, 0, len(e.flowKeys))
+	for key := range e.flowKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // GetTopTalkers returns services with highest bytes sent.
 func (g *TransferGraph) GetTopTalkers(n int) []*ServiceNode {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
+	return g.topTalkers(n)
+}
+
+// topTalkers implements GetTopTalkers. Caller must hold g.mu.
+func (g *TransferGraph) topTalkers(n int) []*ServiceNode {
+	if top, ok := g.talkers.top(n); ok {
+		return top
+	}
 
 	nodes := make([]*ServiceNode, 0, len(g.nodes))
 	for _, node := range g.nodes {
@@ -180,11 +375,90 @@ func (g *TransferGraph) GetTopTalkers(n int) []*ServiceNode {
 	return nodes[:n]
 }
 
+// GetTopListeners returns nodes, including external ones, with highest
+// received bytes.
+func (g *TransferGraph) GetTopListeners(n int) []*ServiceNode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if top, ok := g.listeners.top(n); ok {
+		return top
+	}
+
+	nodes := make([]*ServiceNode, 0, len(g.nodes)+len(g.externalNodes))
+	for _, node := range g.nodes {
+		nodes = append(nodes, node)
+	}
+	for _, node := range g.externalNodes {
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].TotalBytesReceived > nodes[j].TotalBytesReceived
+	})
+
+	if n > len(nodes) {
+		n = len(nodes)
+	}
+	return nodes[:n]
+}
+
+// GetTopFanOut returns in-cluster nodes sending to the most distinct
+// destinations.
+func (g *TransferGraph) GetTopFanOut(n int) []*ServiceNode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	nodes := make([]*ServiceNode, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		nodes = append(nodes, node)
+	}
+	return topNodesBy(nodes, n, func(node *ServiceNode) int { return len(node.Neighbors) })
+}
+
+// GetTopFanIn returns nodes, including external ones, receiving from the
+// most distinct sources.
+func (g *TransferGraph) GetTopFanIn(n int) []*ServiceNode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	nodes := make([]*ServiceNode, 0, len(g.nodes)+len(g.externalNodes))
+	for _, node := range g.nodes {
+		nodes = append(nodes, node)
+	}
+	for _, node := range g.externalNodes {
+		nodes = append(nodes, node)
+	}
+	return topNodesBy(nodes, n, func(node *ServiceNode) int { return node.FanIn })
+}
+
+// topNodesBy returns the n nodes with the highest count, breaking ties by
+// ID so results are stable.
+func topNodesBy(nodes []*ServiceNode, n int, count func(*ServiceNode) int) []*ServiceNode {
+	sort.Slice(nodes, func(i, j int) bool {
+		ci, cj := count(nodes[i]), count(nodes[j])
+		if ci != cj {
+			return ci > cj
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	n = min(n, len(nodes))
+	if n < 0 {
+		n = 0
+	}
+	return nodes[:n]
+}
+
 // GetTopEdges returns edges with highest bytes.
 func (g *TransferGraph) GetTopEdges(n int) []*Edge {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
+	if top, ok := g.heavyEdges.top(n); ok {
+		return top
+	}
+
 	edges := make([]*Edge, 0, len(g.edges))
 	for _, edge := range g.edges {
 		edges = append(edges, edge)
@@ -200,6 +474,45 @@ func (g *TransferGraph) GetTopEdges(n int) []*Edge {
 	return edges[:n]
 }
 
+// GetNewEdges returns edges first seen after since, highest bytes first.
+func (g *TransferGraph) GetNewEdges(since time.Time) []*Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var edges []*Edge
+	for _, edge := range g.edges {
+		if edge.FirstSeen.After(since) {
+			edges = append(edges, edge)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].TotalBytes > edges[j].TotalBytes
+	})
+	return edges
+}
+
+// GetActiveEdges returns edges with traffic seen after since, most
+// recently seen first. An edge is last seen at the end of the window of
+// its latest flow, so edges loaded from storage count as seen at the end of
+// the load window.
+func (g *TransferGraph) GetActiveEdges(since time.Time) []*Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var edges []*Edge
+	for _, edge := range g.edges {
+		if edge.LastSeen.After(since) {
+			edges = append(edges, edge)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].LastSeen.After(edges[j].LastSeen)
+	})
+	return edges
+}
+
 // GetEgressEdges returns all egress edges.
 func (g *TransferGraph) GetEgressEdges() []*Edge {
 	g.mu.RLock()
@@ -207,7 +520,7 @@ func (g *TransferGraph) GetEgressEdges() []*Edge {
 
 	var edges []*Edge
 	for _, edge := range g.edges {
-		if edge.TransferType == types.TransferTypeEgress {
+		if edge.HasType(types.TransferTypeEgress) {
 			edges = append(edges, edge)
 		}
 	}
@@ -221,58 +534,124 @@ func (g *TransferGraph) GetCrossRegionEdges() []*Edge {
 
 	var edges []*Edge
 	for _, edge := range g.edges {
-		if edge.TransferType == types.TransferTypeCrossRegion {
+		if edge.HasType(types.TransferTypeCrossRegion) {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// GetCrossAZEdges returns all cross-AZ edges.
+func (g *TransferGraph) GetCrossAZEdges() []*Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var edges []*Edge
+	for _, edge := range g.edges {
+		if edge.HasType(types.TransferTypeCrossAZ) {
 			edges = append(edges, edge)
 		}
 	}
 	return edges
 }
 
+// Subgraph limits. Requested depths above MaxSubgraphDepth are capped, and
+// traversal stops once MaxSubgraphNodes services have been collected.
+const (
+	MaxSubgraphDepth = 6
+	MaxSubgraphNodes = 500
+)
+
 // GetServiceGraph returns a subgraph for a specific service.
 func (g *TransferGraph) GetServiceGraph(serviceID string, depth int) *TransferGraph {
+	return g.GetServicesGraph([]string{serviceID}, depth)
+}
+
+// GetServicesGraph returns the merged subgraph around several services.
+// Nodes and edges shared between them appear once.
+func (g *TransferGraph) GetServicesGraph(serviceIDs []string, depth int) *TransferGraph {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	subgraph := NewTransferGraph()
-	visited := make(map[string]bool)
+	if depth > MaxSubgraphDepth {
+		depth = MaxSubgraphDepth
+	}
 
-	g.traverseService(subgraph, serviceID, depth, visited)
+	subgraph := NewTransferGraph()
+	subgraph.granularity = g.granularity
+	// Subgraphs share nodes and edges with g, which keep growing without
+	// the subgraph seeing it, so they rank by sorting.
+	subgraph.talkers, subgraph.listeners, subgraph.heavyEdges = nil, nil, nil
+	for _, id := range serviceIDs {
+		// Each root gets its own walk so an earlier root reaching a node
+		// near its depth limit does not cut off a later root's walk.
+		if !g.traverseService(subgraph, id, depth) {
+			subgraph.truncated = true
+			break
+		}
+	}
 	return subgraph
 }
 
-func (g *TransferGraph) traverseService(subgraph *TransferGraph, serviceID string, depth int, visited map[string]bool) {
-	if depth < 0 || visited[serviceID] {
-		return
+// traverseService adds services within depth hops of serviceID, breadth
+// first, and the edges leaving them. It returns false if it stopped at
+// MaxSubgraphNodes.
+func (g *TransferGraph) traverseService(subgraph *TransferGraph, serviceID string, depth int) bool {
+	if depth < 0 || g.nodes[serviceID] == nil {
+		return true
 	}
-	visited[serviceID] = true
 
-	node := g.nodes[serviceID]
-	if node == nil {
-		return
-	}
-
-	subgraph.nodes[serviceID] = node
+	visited := map[string]bool{serviceID: true}
+	frontier := []string{serviceID}
+	for level := 0; level <= depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, id := range frontier {
+			node := g.nodes[id]
+			if node == nil {
+				continue // External or unknown destination
+			}
+			if _, ok := subgraph.nodes[id]; !ok {
+				if len(subgraph.nodes) >= MaxSubgraphNodes {
+					return false
+				}
+				subgraph.nodes[id] = node
+			}
 
-	for dstID, edge := range node.Neighbors {
-		subgraph.edges[edge.SourceID+"→"+edge.DestinationID] = edge
-		g.traverseService(subgraph, dstID, depth-1, visited)
+			for dstID, edge := range node.Neighbors {
+				subgraph.edges[types.JoinFlowKey(edge.SourceID, edge.DestinationID)] = edge
+				if !visited[dstID] {
+					visited[dstID] = true
+					next = append(next, dstID)
+				}
+			}
+		}
+		frontier = next
 	}
+	return true
 }
 
 // GetStats returns graph statistics.
 func (g *TransferGraph) GetStats() GraphStats {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
+	return g.stats()
+}
+
+// GetOverview returns graph statistics and the n top talkers, read
+// consistently under one lock.
+func (g *TransferGraph) GetOverview(n int) (GraphStats, []*ServiceNode) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.stats(), g.topTalkers(n)
+}
 
+// stats implements GetStats. Caller must hold g.mu.
+func (g *TransferGraph) stats() GraphStats {
 	var totalBytes, egressBytes, crossRegionBytes uint64
 	for _, edge := range g.edges {
 		totalBytes += edge.TotalBytes
-		if edge.TransferType == types.TransferTypeEgress {
-			egressBytes += edge.TotalBytes
-		}
-		if edge.TransferType == types.TransferTypeCrossRegion {
-			crossRegionBytes += edge.TotalBytes
-		}
+		egressBytes += edge.BytesByType[types.TransferTypeEgress]
+		crossRegionBytes += edge.BytesByType[types.TransferTypeCrossRegion]
 	}
 
 	return GraphStats{
@@ -282,6 +661,7 @@ func (g *TransferGraph) GetStats() GraphStats {
 		TotalBytes:         totalBytes,
 		EgressBytes:        egressBytes,
 		CrossRegionBytes:   crossRegionBytes,
+		SizeHistogram:      g.sizes.buckets(),
 	}
 }
 
@@ -293,41 +673,80 @@ type GraphStats struct {
 	TotalBytes         uint64 `json:"total_bytes"`
 	EgressBytes        uint64 `json:"egress_bytes"`
 	CrossRegionBytes   uint64 `json:"cross_region_bytes"`
+
+	// SizeHistogram counts individual flows by TotalBytes.
+	SizeHistogram []SizeBucket `json:"size_histogram"`
 }
 
 // ToJSON exports graph to JSON-serializable format.
 func (g *TransferGraph) ToJSON() GraphJSON {
+	return g.ToJSONFiltered(EdgeFilter{})
+}
+
+// EdgeFilter selects which edges are exported.
+type EdgeFilter struct {
+	ExcludeServices     map[string]bool // Destination services to drop, e.g. "dns"
+	ExcludeControlPlane bool            // Drop DNS, NTP, and similar chatter
+	// ExcludeIntraNamespace drops edges between services of one namespace,
+	// such as sidecar chatter
+	ExcludeIntraNamespace bool
+}
+
+// Match reports whether an edge passes the filter.
+func (f EdgeFilter) Match(e *Edge) bool {
+	if f.ExcludeIntraNamespace && sameNamespace(e.SourceID, e.DestinationID) {
+		return false
+	}
+	if e.Service == "" {
+		return true
+	}
+	if f.ExcludeServices[e.Service] {
+		return false
+	}
+	return !(f.ExcludeControlPlane && types.IsControlPlaneService(e.Service))
+}
+
+// sameNamespace reports whether two in-cluster node IDs ("namespace/name")
+// share a namespace. External nodes have no namespace.
+func sameNamespace(srcID, dstID string) bool {
+	srcNS, _, srcOK := strings.Cut(srcID, "/")
+	dstNS, _, dstOK := strings.Cut(dstID, "/")
+	return srcOK && dstOK && srcNS == dstNS
+}
+
+// ToJSONFiltered exports the graph, keeping only edges that match filter.
+// Nodes are not filtered.
+func (g *TransferGraph) ToJSONFiltered(filter EdgeFilter) GraphJSON {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
+	community := make(map[string]int, len(g.nodes))
+	for _, c := range g.cachedCommunities() {
+		for _, id := range c.Members {
+			community[id] = c.ID
+		}
+	}
+
 	nodes := make([]NodeJSON, 0, len(g.nodes))
 	for _, n := range g.nodes {
-		nodes = append(nodes, NodeJSON{
-			ID:                 n.ID,
-			Namespace:          n.Namespace,
-			Name:               n.Name,
-			TotalBytesSent:     n.TotalBytesSent,
-			TotalBytesReceived: n.TotalBytesReceived,
-			TotalConnections:   n.TotalConnections,
-		})
+		node := n.ToJSON()
+		node.Community = community[n.ID]
+		nodes = append(nodes, node)
 	}
 
 	edges := make([]EdgeJSON, 0, len(g.edges))
 	for _, e := range g.edges {
-		edges = append(edges, EdgeJSON{
-			Source:       e.SourceID,
-			Target:       e.DestinationID,
-			TransferType: string(e.TransferType),
-			TotalBytes:   e.TotalBytes,
-			TotalEvents:  e.TotalEvents,
-			CostUSD:      e.TotalCostUSD,
-		})
+		if filter.Match(e) {
+			edges = append(edges, e.ToJSON())
+		}
 	}
 
 	return GraphJSON{
-		Nodes: nodes,
-		Edges: edges,
-		Stats: g.GetStats(),
+		Nodes:        nodes,
+		Edges:        edges,
+		Stats:        g.stats(),
+		Truncated:    g.truncated,
+		ResetVersion: g.resetVersion,
 	}
 }
 
@@ -339,23 +758,76 @@ type NodeJSON struct {
 	TotalBytesSent     uint64 `json:"total_bytes_sent"`
 	TotalBytesReceived uint64 `json:"total_bytes_received"`
 	TotalConnections   uint64 `json:"total_connections"`
+	FanIn              int    `json:"fan_in"`    // Distinct sources
+	FanOut             int    `json:"fan_out"`   // Distinct destinations
+	Community          int    `json:"community"` // See TransferGraph.Communities
+}
+
+// ToJSON returns the JSON representation of the node.
+func (n *ServiceNode) ToJSON() NodeJSON {
+	return NodeJSON{
+		ID:                 n.ID,
+		Namespace:          n.Namespace,
+		Name:               n.Name,
+		TotalBytesSent:     n.TotalBytesSent,
+		TotalBytesReceived: n.TotalBytesReceived,
+		TotalConnections:   n.TotalConnections,
+		FanIn:              n.FanIn,
+		FanOut:             len(n.Neighbors),
+	}
 }
 
 // EdgeJSON is JSON representation of an edge.
 type EdgeJSON struct {
-	Source       string  `json:"source"`
-	Target       string  `json:"target"`
-	TransferType string  `json:"transfer_type"`
-	TotalBytes   uint64  `json:"total_bytes"`
-	TotalEvents  uint64  `json:"total_events"`
-	CostUSD      float64 `json:"cost_usd"`
+	Source       string            `json:"source"`
+	Target       string            `json:"target"`
+	TransferType string            `json:"transfer_type"`
+	BytesByType  map[string]uint64 `json:"bytes_by_type,omitempty"`
+	Service      string            `json:"service,omitempty"`
+	TotalBytes   uint64            `json:"total_bytes"`
+	TotalEvents  uint64            `json:"total_events"`
+	CostUSD      float64           `json:"cost_usd"`
+	FirstSeen    time.Time         `json:"first_seen"`
+	LastSeen     time.Time         `json:"last_seen"`
+	RecentBytes  []uint64          `json:"recent_bytes,omitempty"` // Per minute, oldest first
+	FlowKeys     []string          `json:"flow_keys"`              // Keys for /flows/{flowKey}/events
+}
+
+// ToJSON returns the JSON representation of the edge.
+func (e *Edge) ToJSON() EdgeJSON {
+	var bytesByType map[string]uint64
+	if len(e.BytesByType) > 1 {
+		bytesByType = make(map[string]uint64, len(e.BytesByType))
+		for t, b := range e.BytesByType {
+			bytesByType[string(t)] = b
+		}
+	}
+	return EdgeJSON{
+		Source:       e.SourceID,
+		Target:       e.DestinationID,
+		TransferType: string(e.TransferType),
+		BytesByType:  bytesByType,
+		Service:      e.Service,
+		TotalBytes:   e.TotalBytes,
+		TotalEvents:  e.TotalEvents,
+		CostUSD:      e.TotalCostUSD,
+		FirstSeen:    e.FirstSeen,
+		LastSeen:     e.LastSeen,
+		RecentBytes:  e.recent.values(),
+		FlowKeys:     e.sortedFlowKeys(),
+	}
 }
 
 // GraphJSON is the full graph JSON structure.
 type GraphJSON struct {
-	Nodes []NodeJSON `json:"nodes"`
-	Edges []EdgeJSON `json:"edges"`
-	Stats GraphStats `json:"stats"`
+	Nodes     []NodeJSON `json:"nodes"`
+	Edges     []EdgeJSON `json:"edges"`
+	Stats     GraphStats `json:"stats"`
+	Truncated bool       `json:"truncated,omitempty"` // Subgraph hit MaxSubgraphNodes
+
+	// ResetVersion is the version of the graph's last Reset. Totals
+	// restart from zero whenever it changes.
+	ResetVersion uint64 `json:"-"`
 }
 
 // GraphEngine manages the transfer graph with storage backing.
@@ -374,8 +846,15 @@ func NewGraphEngine(store *storage.ClickHouseStore) *GraphEngine {
 
 // LoadFromStorage loads graph data from storage.
 func (e *GraphEngine) LoadFromStorage(ctx context.Context, start, end time.Time) error {
+	_, err := e.LoadFlowsFromStorage(ctx, start, end)
+	return err
+}
+
+// LoadFlowsFromStorage loads the flows stored in [start, end) into the
+// graph and returns them.
+func (e *GraphEngine) LoadFlowsFromStorage(ctx context.Context, start, end time.Time) ([]types.TransferFlow, error) {
 	if e.storage == nil {
-		return nil
+		return nil, nil
 	}
 
 	results, err := e.storage.QueryFlows(ctx, storage.FlowQuery{
@@ -384,37 +863,14 @@ func (e *GraphEngine) LoadFromStorage(ctx context.Context, start, end time.Time)
 		Limit: 100000,
 	})
 	if err != nil {
-		return fmt.Errorf("querying flows: %w", err)
-	}
-
-	for _, r := range results {
-		flow := types.TransferFlow{
-			ID: uuid.New(),
-			SourceIdentity: types.ServiceIdentity{
-				Namespace: r.SrcNamespace,
-				Name:      r.SrcService,
-			},
-			TotalBytes:  r.TotalBytes,
-			WindowStart: start,
-			WindowEnd:   end,
-		}
-
-		if r.DstService != "" {
-			flow.DestinationIdentity = &types.ServiceIdentity{
-				Namespace: r.DstNamespace,
-				Name:      r.DstService,
-			}
-		} else if r.DstExternal != "" {
-			flow.DestinationEndpoint = &types.Endpoint{
-				IP:         r.DstExternal,
-				Type:       types.EndpointTypeExternal,
-				IsInternet: true,
-			}
-		}
+		return nil, fmt.Errorf("querying flows: %w", err)
+	}
 
-		flow.Type = types.TransferType(r.TransferType)
-		e.graph.AddFlow(flow)
+	flows := make([]types.TransferFlow, len(results))
+	for i, r := range results {
+		flows[i] = r.ToFlow(start, end)
 	}
+	e.graph.AddFlows(flows)
 
 	log.Info().
 		Int("flows", len(results)).
@@ -422,7 +878,7 @@ func (e *GraphEngine) LoadFromStorage(ctx context.Context, start, end time.Time)
 		Time("end", end).
 		Msg("Graph loaded from storage")
 
-	return nil
+	return flows, nil
 }
 
 // GetGraph returns the transfer graph.
@@ -435,6 +891,22 @@ func (e *GraphEngine) AddFlow(flow types.TransferFlow) {
 	e.graph.AddFlow(flow)
 }
 
+// AddFlows adds a batch of flows to the graph.
+func (e *GraphEngine) AddFlows(flows []types.TransferFlow) {
+	e.graph.AddFlows(flows)
+}
+
+// SetGranularity sets how nodes are keyed and clears the graph, which must
+// be reloaded at the new granularity.
+func (e *GraphEngine) SetGranularity(granularity NodeGranularity) {
+	e.graph.SetGranularity(granularity)
+}
+
+// Reset clears the graph.
+func (e *GraphEngine) Reset() {
+	e.graph.Reset()
+}
+
 // GetStats returns graph statistics.
 func (e *GraphEngine) GetStats() GraphStats {
 	return e.graph.GetStats()
@@ -450,6 +922,26 @@ func (e *GraphEngine) GetTopNodes(n int) []*ServiceNode {
 	return e.graph.GetTopTalkers(n)
 }
 
+// GetTopListeners returns nodes with highest received bytes.
+func (e *GraphEngine) GetTopListeners(n int) []*ServiceNode {
+	return e.graph.GetTopListeners(n)
+}
+
+// GetAZMatrix returns traffic collapsed to availability zones.
+func (e *GraphEngine) GetAZMatrix() AZMatrix {
+	return e.graph.GetAZMatrix()
+}
+
+// GetCommunities returns service communities in the graph.
+func (e *GraphEngine) GetCommunities() []Community {
+	return e.graph.Communities()
+}
+
+// GetAsymmetric returns strongly one-directional service pairs and services.
+func (e *GraphEngine) GetAsymmetric(ratio float64, minBytes uint64) AsymmetryReport {
+	return e.graph.GetAsymmetric(ratio, minBytes)
+}
+
 // GetTopEdges returns edges with highest bytes.
 func (e *GraphEngine) GetTopEdges(n int) []*Edge {
 	return e.graph.GetTopEdges(n)
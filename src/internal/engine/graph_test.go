@@ -0,0 +1,485 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/egressor/egressor/src/internal/storage"
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// meshFlows returns n flows between 100 services.
+func meshFlows(n int) []types.TransferFlow {
+	flows := make([]types.TransferFlow, n)
+	for i := range flows {
+		flows[i] = serviceFlow(fmt.Sprintf("svc-%d", i%100), fmt.Sprintf("svc-%d", (i*7+1)%100), uint64(1000+i))
+	}
+	return flows
+}
+
+func TestAddFlowsMatchesAddFlow(t *testing.T) {
+	flows := meshFlows(1000)
+
+	one := NewTransferGraph()
+	for _, f := range flows {
+		one.AddFlow(f)
+	}
+	batched := NewTransferGraph()
+	batched.AddFlows(flows[:400])
+	batched.AddFlows(flows[400:])
+
+	if got, want := batched.GetStats(), one.GetStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("batched stats = %+v, want %+v", got, want)
+	}
+	if got, want := len(batched.ToJSON().Edges), len(one.ToJSON().Edges); got != want {
+		t.Errorf("batched graph has %d edges, want %d", got, want)
+	}
+}
+
+func TestAddFlowsConcurrently(t *testing.T) {
+	g := NewTransferGraph()
+	flows := meshFlows(4000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(part []types.TransferFlow) {
+			defer wg.Done()
+			for len(part) > 0 {
+				n := min(100, len(part))
+				g.AddFlows(part[:n])
+				part = part[n:]
+			}
+		}(flows[i*1000 : (i+1)*1000])
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				g.GetStats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var want uint64
+	for _, f := range flows {
+		want += f.TotalBytes
+	}
+	if got := g.GetStats().TotalBytes; got != want {
+		t.Errorf("total bytes = %d, want %d", got, want)
+	}
+}
+
+func BenchmarkAddFlow(b *testing.B) {
+	flows := meshFlows(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := NewTransferGraph()
+		for _, f := range flows {
+			g.AddFlow(f)
+		}
+	}
+}
+
+func BenchmarkAddFlows(b *testing.B) {
+	flows := meshFlows(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewTransferGraph().AddFlows(flows)
+	}
+}
+
+func TestNewEdgesAfterCutoff(t *testing.T) {
+	now := time.Now()
+	at := func(src, dst string, bytes uint64, ago time.Duration) types.TransferFlow {
+		f := serviceFlow(src, dst, bytes)
+		f.WindowStart, f.WindowEnd = now.Add(-ago), now.Add(-ago+time.Minute)
+		return f
+	}
+
+	g := NewTransferGraph()
+	g.AddFlows([]types.TransferFlow{
+		at("web", "api", 5000, 3*time.Hour),
+		at("api", "search", 100, 30*time.Minute),
+		at("api", "payments", 900, 10*time.Minute),
+		// Seen recently, but the edge existed before the cutoff
+		at("web", "api", 5000, 5*time.Minute),
+		// Loaded out of order: first seen before the cutoff
+		at("api", "cache", 700, 20*time.Minute),
+		at("api", "cache", 700, 2*time.Hour),
+	})
+
+	edges := g.GetNewEdges(now.Add(-time.Hour))
+	var got []string
+	for _, e := range edges {
+		got = append(got, e.DestinationID)
+	}
+	if want := []string{"shop/payments", "shop/search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("new edges = %v, want %v, highest bytes first", got, want)
+	}
+	if len(g.GetNewEdges(now)) != 0 {
+		t.Error("edges returned for a cutoff after every flow")
+	}
+}
+
+func TestActiveEdgesByRecency(t *testing.T) {
+	now := time.Now()
+	endingAgo := func(src, dst string, ago time.Duration) types.TransferFlow {
+		f := serviceFlow(src, dst, 100)
+		f.WindowStart, f.WindowEnd = now.Add(-ago-time.Minute), now.Add(-ago)
+		return f
+	}
+
+	g := NewTransferGraph()
+	g.AddFlows([]types.TransferFlow{
+		endingAgo("api", "db", 10*time.Second),
+		endingAgo("api", "cache", 2*time.Second),
+		endingAgo("web", "api", 5*time.Minute),
+		// A stale edge made fresh by a later flow
+		endingAgo("api", "search", time.Hour),
+		endingAgo("api", "search", 20*time.Second),
+	})
+
+	var got []string
+	for _, e := range g.GetActiveEdges(now.Add(-30 * time.Second)) {
+		got = append(got, e.DestinationID)
+	}
+	if want := []string{"shop/cache", "shop/db", "shop/search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("active edges = %v, want %v, most recent first", got, want)
+	}
+}
+
+func TestTopListenersRankByReceivedBytes(t *testing.T) {
+	g := NewTransferGraph()
+	// api sends a lot in total but no single destination receives much;
+	// db receives the most from several senders
+	for _, dst := range []string{"search", "auth", "cart", "users"} {
+		g.AddFlow(serviceFlow("api", dst, 3000))
+	}
+	for _, src := range []string{"orders", "billing"} {
+		g.AddFlow(serviceFlow(src, "db", 5000))
+	}
+	g.AddFlow(types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "backup"},
+		DestinationEndpoint: &types.Endpoint{Hostname: "bucket.s3.amazonaws.com", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          8000,
+	})
+
+	if top := g.GetTopTalkers(1); len(top) != 1 || top[0].ID != "shop/api" {
+		t.Errorf("top talker = %v, want shop/api", top)
+	}
+
+	top := g.GetTopListeners(2)
+	if len(top) != 2 || top[0].ID != "shop/db" || top[0].TotalBytesReceived != 10000 {
+		t.Fatalf("top listeners = %v, want shop/db first with 10000 bytes", top)
+	}
+	if top[1].ID != "external:bucket.s3.amazonaws.com" {
+		t.Errorf("second listener = %s, want the external bucket", top[1].ID)
+	}
+
+	// Beyond the ranked cache the whole graph is sorted, in the same order
+	all := g.GetTopListeners(topCacheSize + 1)
+	if len(all) != 10 || all[0] != top[0] || all[1] != top[1] {
+		t.Errorf("got %d listeners, want all 10 with the ranked ones first", len(all))
+	}
+}
+
+// fanGraph has api fanning out to db, cache and the internet, and db
+// fanned into from api and worker.
+func fanGraph() *TransferGraph {
+	g := NewTransferGraph()
+	g.AddFlows([]types.TransferFlow{
+		serviceFlow("api", "db", 100),
+		serviceFlow("api", "db", 100), // Same edge again
+		serviceFlow("api", "cache", 100),
+		serviceFlow("web", "api", 100),
+		serviceFlow("worker", "db", 100),
+		{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+			DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+			Type:                types.TransferTypeEgress,
+			TotalBytes:          100,
+		},
+	})
+	return g
+}
+
+func TestFanCounts(t *testing.T) {
+	g := fanGraph()
+	want := map[string][2]int{ // ID -> fan in, fan out
+		"shop/api":              {1, 3},
+		"shop/db":               {2, 0},
+		"shop/cache":            {1, 0},
+		"shop/web":              {0, 1},
+		"shop/worker":           {0, 1},
+		"external:203.0.113.10": {1, 0},
+	}
+	for id, fan := range want {
+		node := g.GetNode(id)
+		if node == nil {
+			t.Errorf("no node %s", id)
+			continue
+		}
+		if got := node.ToJSON(); got.FanIn != fan[0] || got.FanOut != fan[1] {
+			t.Errorf("%s: fan in %d, out %d; want %d and %d", id, got.FanIn, got.FanOut, fan[0], fan[1])
+		}
+	}
+
+	if top := g.GetTopFanOut(2); len(top) != 2 || top[0].ID != "shop/api" || top[1].ID != "shop/web" {
+		t.Errorf("top fan-out = %v, want shop/api then shop/web by ID", top)
+	}
+	if top := g.GetTopFanIn(1); len(top) != 1 || top[0].ID != "shop/db" {
+		t.Errorf("top fan-in = %v, want shop/db", top)
+	}
+}
+
+func TestGraphFiltersControlPlaneEdges(t *testing.T) {
+	g := NewGraphEngine(nil)
+	api := types.ServiceIdentity{Namespace: "shop", Name: "api"}
+	// In-cluster DNS, tagged by port like external NTP
+	g.AddFlow(types.TransferFlow{
+		SourceIdentity:      api,
+		DestinationIdentity: &types.ServiceIdentity{Namespace: "kube-system", Name: "kube-dns"},
+		WellKnownService:    types.WellKnownServiceDNS,
+		Type:                types.TransferTypePodToPod,
+		TotalBytes:          100,
+	})
+	for _, flow := range []struct {
+		dst       types.Endpoint
+		wellKnown string
+	}{
+		{types.Endpoint{IP: "169.254.169.123", Port: 123}, types.WellKnownServiceNTP},
+		{types.Endpoint{IP: "52.216.0.1", Port: 443, CloudServiceName: "s3", IsInternet: true}, ""},
+		{types.Endpoint{IP: "203.0.113.10", Port: 443, IsInternet: true}, ""},
+	} {
+		dst := flow.dst
+		g.AddFlow(types.TransferFlow{SourceIdentity: api, DestinationEndpoint: &dst, WellKnownService: flow.wellKnown,
+			Type: types.TransferTypeEgress, TotalBytes: 100})
+	}
+
+	services := func(filter EdgeFilter) map[string]bool {
+		got := make(map[string]bool)
+		for _, e := range g.GetGraph().ToJSONFiltered(filter).Edges {
+			got[e.Service] = true
+		}
+		return got
+	}
+
+	if got := services(EdgeFilter{}); len(got) != 4 {
+		t.Errorf("unfiltered services = %v, want dns, ntp, s3 and none", got)
+	}
+	if got := services(EdgeFilter{ExcludeServices: map[string]bool{"dns": true}}); got["dns"] || !got["ntp"] || len(got) != 3 {
+		t.Errorf("excluding dns kept %v", got)
+	}
+	if got := services(EdgeFilter{ExcludeControlPlane: true}); got["dns"] || got["ntp"] || !got["s3"] || !got[""] {
+		t.Errorf("excluding control plane kept %v", got)
+	}
+}
+
+func TestEdgeServiceCarriesMostBytes(t *testing.T) {
+	g := NewGraphEngine(nil)
+	api := types.ServiceIdentity{Namespace: "shop", Name: "api"}
+	resolver := types.Endpoint{IP: "8.8.8.8", IsInternet: true}
+	add := func(wellKnown string, bytes uint64) {
+		dst := resolver
+		g.AddFlow(types.TransferFlow{SourceIdentity: api, DestinationEndpoint: &dst, WellKnownService: wellKnown,
+			Type: types.TransferTypeEgress, TotalBytes: bytes})
+	}
+
+	add("", 5000)
+	add(types.WellKnownServiceDNS, 200)
+	edge := g.GetGraph().GetEdge("shop/api", "external:8.8.8.8")
+	if edge == nil || edge.Service != "" {
+		t.Fatalf("edge = %+v, want HTTPS traffic to outweigh a later DNS flow", edge)
+	}
+	add(types.WellKnownServiceDNS, 6000)
+	if edge.Service != types.WellKnownServiceDNS {
+		t.Errorf("service = %q, want dns once it carries the most bytes", edge.Service)
+	}
+}
+
+func TestGraphExcludesIntraNamespaceEdges(t *testing.T) {
+	g := NewGraphEngine(nil)
+	ledger := serviceFlow("api", "ledger", 100)
+	ledger.DestinationIdentity.Namespace = "billing"
+	g.AddFlows([]types.TransferFlow{
+		serviceFlow("api", "worker", 100),
+		serviceFlow("worker", "api", 100),
+		ledger,
+		{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+			DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+			Type:                types.TransferTypeEgress,
+			TotalBytes:          100,
+		},
+	})
+
+	edges := func(filter EdgeFilter) map[string]bool {
+		got := make(map[string]bool)
+		for _, e := range g.GetGraph().ToJSONFiltered(filter).Edges {
+			got[e.Source+" -> "+e.Target] = true
+		}
+		return got
+	}
+
+	if got := edges(EdgeFilter{}); len(got) != 4 {
+		t.Errorf("unfiltered edges = %v, want 4", got)
+	}
+	got := edges(EdgeFilter{ExcludeIntraNamespace: true})
+	if got["shop/api -> shop/worker"] || got["shop/worker -> shop/api"] {
+		t.Errorf("intra-namespace edges kept: %v", got)
+	}
+	if !got["shop/api -> billing/ledger"] || len(got) != 2 {
+		t.Errorf("edges = %v, want the cross-namespace and external ones", got)
+	}
+}
+
+func TestExternalNodesMergeByService(t *testing.T) {
+	g := NewTransferGraph()
+	api := types.ServiceIdentity{Namespace: "shop", Name: "api"}
+	for _, dst := range []types.Endpoint{
+		{IP: "52.216.0.1", CloudServiceName: "s3", IsInternet: true},
+		{IP: "52.216.8.2", CloudServiceName: "s3", IsInternet: true},
+		{IP: "3.5.0.3", CloudServiceName: "s3", IsInternet: true},
+		{IP: "198.51.100.1", Hostname: "API.Stripe.com.", IsInternet: true},
+		{IP: "198.51.100.2", Hostname: "api.stripe.com", IsInternet: true},
+		{IP: "203.0.113.10", IsInternet: true},
+	} {
+		dst := dst
+		g.AddFlow(types.TransferFlow{SourceIdentity: api, DestinationEndpoint: &dst, Type: types.TransferTypeEgress, TotalBytes: 100})
+	}
+
+	if stats := g.GetStats(); stats.TotalExternalNodes != 3 || stats.TotalEdges != 3 {
+		t.Errorf("%d external nodes and %d edges, want s3, stripe and one bare IP", stats.TotalExternalNodes, stats.TotalEdges)
+	}
+	if s3 := g.GetNode("external:s3"); s3 == nil || s3.TotalBytesReceived != 300 {
+		t.Errorf("s3 node = %+v, want all three IPs' 300 bytes", s3)
+	}
+	if g.GetNode("external:api.stripe.com") == nil || g.GetNode("external:203.0.113.10") == nil {
+		t.Error("hostname or bare IP node missing")
+	}
+}
+
+func TestLoadedExternalFlowsMergeByService(t *testing.T) {
+	g := NewTransferGraph()
+	for _, ip := range []string{"52.216.0.1", "52.216.8.2", "3.5.0.3"} {
+		// As QueryFlows returns them
+		res := storage.FlowResult{
+			SrcNamespace: "shop", SrcService: "api",
+			DstExternal: ip, DstCloudService: "s3", DstHostname: "bucket.s3.amazonaws.com",
+			TransferType: string(types.TransferTypeEgress), TotalBytes: 100,
+		}
+		g.AddFlow(res.ToFlow(time.Time{}, time.Time{}))
+	}
+
+	if s3 := g.GetNode("external:s3"); s3 == nil || s3.TotalBytesReceived != 300 {
+		t.Fatalf("s3 node = %+v, want the three loaded IPs merged", s3)
+	}
+	want := []string{"shop/api|3.5.0.3", "shop/api|52.216.0.1", "shop/api|52.216.8.2"}
+	if got := g.FlowKeys("shop/api", "external:s3"); !reflect.DeepEqual(got, want) {
+		t.Errorf("flow keys = %v, want %v", got, want)
+	}
+	if got := g.ToJSON().Edges[0].FlowKeys; !reflect.DeepEqual(got, want) {
+		t.Errorf("edge JSON flow keys = %v, want %v", got, want)
+	}
+	if got := g.FlowKeys("shop/api", "external:dynamodb"); got != nil {
+		t.Errorf("flow keys of a missing edge = %v", got)
+	}
+}
+
+func TestGetCrossAZEdges(t *testing.T) {
+	e := NewGraphEngine(nil)
+	for dst, transferType := range map[string]types.TransferType{
+		"db":      types.TransferTypeCrossAZ,
+		"cache":   types.TransferTypeCrossAZ,
+		"replica": types.TransferTypeCrossRegion,
+		"search":  types.TransferTypeServiceToService,
+	} {
+		flow := serviceFlow("api", dst, 100)
+		flow.Type = transferType
+		e.AddFlow(flow)
+	}
+
+	edges := e.GetGraph().GetCrossAZEdges()
+	targets := make(map[string]bool)
+	for _, edge := range edges {
+		if edge.TransferType != types.TransferTypeCrossAZ {
+			t.Errorf("edge to %s is %s", edge.DestinationID, edge.TransferType)
+		}
+		targets[edge.DestinationID] = true
+	}
+	if len(edges) != 2 || !targets["shop/db"] || !targets["shop/cache"] {
+		t.Errorf("cross-AZ edges go to %v, want db and cache", targets)
+	}
+}
+
+func TestMixedTypesOnOneEdge(t *testing.T) {
+	e := NewGraphEngine(nil)
+	for _, f := range []struct {
+		transferType types.TransferType
+		bytes        uint64
+	}{
+		{types.TransferTypeCrossAZ, 300},
+		{types.TransferTypeEgress, 400},
+		{types.TransferTypeEgress, 300},
+	} {
+		flow := serviceFlow("api", "gateway", f.bytes)
+		flow.Type = f.transferType
+		e.AddFlow(flow)
+	}
+
+	g := e.GetGraph()
+	egress, crossAZ := g.GetEgressEdges(), g.GetCrossAZEdges()
+	if len(egress) != 1 || len(crossAZ) != 1 || egress[0] != crossAZ[0] {
+		t.Fatalf("egress edges %d, cross-AZ edges %d; want the one edge in both", len(egress), len(crossAZ))
+	}
+	edge := egress[0]
+	if edge.TransferType != types.TransferTypeEgress {
+		t.Errorf("dominant type = %s, want egress with the most bytes", edge.TransferType)
+	}
+
+	j := edge.ToJSON()
+	if j.TotalBytes != 1000 || j.BytesByType["egress"] != 700 || j.BytesByType["cross_az"] != 300 {
+		t.Errorf("edge JSON = %d bytes by type %v, want 700 egress and 300 cross-AZ of 1000", j.TotalBytes, j.BytesByType)
+	}
+	if stats := e.GetStats(); stats.TotalBytes != 1000 || stats.EgressBytes != 700 {
+		t.Errorf("stats total %d egress %d, want 1000 and 700", stats.TotalBytes, stats.EgressBytes)
+	}
+}
+
+func TestEdgeKeysAreASCII(t *testing.T) {
+	e := NewGraphEngine(nil)
+	flows := []types.TransferFlow{serviceFlow("api", "db", 100), serviceFlow("db", "backup", 100)}
+	for _, flow := range flows {
+		e.AddFlow(flow)
+	}
+
+	g := e.GetGraph()
+	for _, flow := range flows {
+		edge := g.GetEdge(flow.SourceIdentity.FullName(), flow.DestinationIdentity.FullName())
+		if edge == nil {
+			t.Fatalf("no edge for %s", flow.FlowKey())
+		}
+		if id := types.JoinFlowKey(edge.SourceID, edge.DestinationID); id != flow.FlowKey() {
+			t.Errorf("edge ID %q, flow key %q; want them equal", id, flow.FlowKey())
+		}
+	}
+
+	for _, graph := range []*TransferGraph{g, g.GetServiceGraph("shop/api", 2)} {
+		if len(graph.edges) != 2 {
+			t.Errorf("graph has %d edges, want 2", len(graph.edges))
+		}
+		for id := range graph.edges {
+			for _, r := range id {
+				if r > unicode.MaxASCII {
+					t.Errorf("edge ID %q is not ASCII", id)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package engine
+
+// sizeBucketBounds are the exclusive upper bounds, in bytes, of the flow size
+// histogram buckets. Flows at or above the last bound land in a final
+// overflow bucket.
+var sizeBucketBounds = []uint64{
+	1 << 10,   // 1KB
+	100 << 10, // 100KB
+	10 << 20,  // 10MB
+	1 << 30,   // 1GB
+}
+
+// sizeBucketLabels name the buckets, one more than sizeBucketBounds.
+var sizeBucketLabels = []string{"<1KB", "1KB-100KB", "100KB-10MB", "10MB-1GB", ">=1GB"}
+
+// SizeBucket is one bucket of the flow size histogram.
+type SizeBucket struct {
+	Label string `json:"label"`
+	Count uint64 `json:"count"`
+}
+
+// sizeHistogram counts flows by size.
+type sizeHistogram [5]uint64
+
+// observe records a flow of the given size.
+func (h *sizeHistogram) observe(bytes uint64) {
+	for i, bound := range sizeBucketBounds {
+		if bytes < bound {
+			h[i]++
+			return
+		}
+	}
+	h[len(sizeBucketBounds)]++
+}
+
+// buckets returns the labelled bucket counts.
+func (h *sizeHistogram) buckets() []SizeBucket {
+	out := make([]SizeBucket, len(h))
+	for i, count := range h {
+		out[i] = SizeBucket{Label: sizeBucketLabels[i], Count: count}
+	}
+	return out
+}
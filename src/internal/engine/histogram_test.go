@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	e := NewGraphEngine(nil)
+	for _, bytes := range []uint64{
+		0, 1023, // <1KB
+		1 << 10, 50 << 10, 100<<10 - 1, // 1KB-100KB
+		100 << 10,           // 100KB-10MB
+		10 << 20, 500 << 20, // 10MB-1GB
+		1 << 30, 5 << 30, // >=1GB
+	} {
+		e.AddFlow(serviceFlow("api", "db", bytes))
+	}
+
+	want := []SizeBucket{
+		{Label: "<1KB", Count: 2},
+		{Label: "1KB-100KB", Count: 3},
+		{Label: "100KB-10MB", Count: 1},
+		{Label: "10MB-1GB", Count: 2},
+		{Label: ">=1GB", Count: 2},
+	}
+	stats := e.GetStats()
+	if !reflect.DeepEqual(stats.SizeHistogram, want) {
+		t.Errorf("histogram = %+v, want %+v", stats.SizeHistogram, want)
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		SizeHistogram []SizeBucket `json:"size_histogram"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded.SizeHistogram, want) {
+		t.Errorf("stats JSON histogram = %+v (%v), want %+v", decoded.SizeHistogram, err, want)
+	}
+
+	e.Reset()
+	for _, b := range e.GetStats().SizeHistogram {
+		if b.Count != 0 {
+			t.Errorf("after Reset bucket %s = %d, want 0", b.Label, b.Count)
+		}
+	}
+}
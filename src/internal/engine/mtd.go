@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// monthToDate accumulates cost for the current calendar month (UTC).
+type monthToDate struct {
+	month      string // "2006-01"
+	costUSD    float64
+	bytes      uint64
+	byCategory map[types.CostCategory]float64
+	updatedAt  time.Time
+}
+
+// rollTo resets the accumulator if month is newer than the one tracked.
+func (m *monthToDate) rollTo(month string) {
+	if month > m.month {
+		*m = monthToDate{month: month, byCategory: make(map[types.CostCategory]float64)}
+	}
+}
+
+// RecordFlowCost prices a flow, records it toward its month's tiered
+// usage, and adds it to the month-to-date total. The flow counts toward the
+// month of its window end; flows from a month before the current one are
+// priced but not added to the month-to-date total.
+func (e *CostEngine) RecordFlowCost(flow types.TransferFlow) types.CostBreakdown {
+	month := flowMonth(flow)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	breakdown := e.calculateCost(flow, e.monthly, true)
+	e.mtd.rollTo(month)
+	if month != e.mtd.month {
+		return breakdown
+	}
+	e.mtd.costUSD += breakdown.CostUSD
+	e.mtd.bytes += breakdown.BytesTransferred
+	e.mtd.byCategory[breakdown.Category] += breakdown.CostUSD
+	e.mtd.updatedAt = time.Now()
+
+	return breakdown
+}
+
+// GetMonthToDateCost returns the running cost total for the current month.
+func (e *CostEngine) GetMonthToDateCost() types.MonthToDateCost {
+	return e.monthToDateAt(time.Now())
+}
+
+// monthToDateAt returns the running total for the month containing now,
+// which is empty if nothing has been recorded in that month yet.
+func (e *CostEngine) monthToDateAt(now time.Time) types.MonthToDateCost {
+	month := now.UTC().Format("2006-01")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.mtd.rollTo(month)
+	result := types.MonthToDateCost{
+		Month:      month,
+		CostUSD:    e.mtd.costUSD,
+		TotalBytes: e.mtd.bytes,
+		ByCategory: make(map[types.CostCategory]float64, len(e.mtd.byCategory)),
+		UpdatedAt:  e.mtd.updatedAt,
+	}
+	if e.mtd.month != month {
+		// Future-dated flows moved the tracker past now
+		result.CostUSD, result.TotalBytes, result.UpdatedAt = 0, 0, time.Time{}
+		return result
+	}
+	for c, v := range e.mtd.byCategory {
+		result.ByCategory[c] = v
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestMonthToDateAcrossRollover(t *testing.T) {
+	e := newTieredEngine()
+	lateJanuary := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	earlyFebruary := time.Date(2026, 2, 1, 0, 30, 0, 0, time.UTC)
+
+	// 3GB in January: 1GB free, 2GB at $0.10
+	e.RecordFlowCost(azureEgress("api", 3, lateJanuary))
+	jan := e.monthToDateAt(lateJanuary.Add(30 * time.Minute))
+	if jan.Month != "2026-01" || !approxEqual(jan.CostUSD, 0.20) || jan.TotalBytes != 3*gib {
+		t.Errorf("January = %s $%v %d bytes, want 2026-01 $0.20 for 3GB", jan.Month, jan.CostUSD, jan.TotalBytes)
+	}
+	if !approxEqual(jan.ByCategory[types.CostCategoryEgressInternet], 0.20) {
+		t.Errorf("January by category = %v, want $0.20 of internet egress", jan.ByCategory)
+	}
+
+	// The new month starts from zero
+	feb := e.monthToDateAt(earlyFebruary.Add(-20 * time.Minute))
+	if feb.Month != "2026-02" || feb.CostUSD != 0 || feb.TotalBytes != 0 || len(feb.ByCategory) != 0 {
+		t.Errorf("February before any flow = %+v, want an empty total", feb)
+	}
+
+	// 2GB in February gets a fresh free tier; a late January flow does
+	// not count toward February
+	e.RecordFlowCost(azureEgress("api", 2, earlyFebruary))
+	e.RecordFlowCost(azureEgress("api", 5, lateJanuary))
+	feb = e.monthToDateAt(earlyFebruary)
+	if !approxEqual(feb.CostUSD, 0.10) || feb.TotalBytes != 2*gib {
+		t.Errorf("February = $%v %d bytes, want $0.10 for 2GB", feb.CostUSD, feb.TotalBytes)
+	}
+	if feb.UpdatedAt.IsZero() {
+		t.Error("February total has no update time")
+	}
+
+	// January is closed once February has begun
+	if jan := e.monthToDateAt(lateJanuary); jan.CostUSD != 0 {
+		t.Errorf("January after rollover = $%v, want nothing carried", jan.CostUSD)
+	}
+}
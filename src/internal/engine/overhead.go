@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultOverheadProtocol keys the per-packet overhead applied to flows
+// whose protocol is unknown or has no entry of its own.
+const DefaultOverheadProtocol = "default"
+
+// SetPacketOverhead sets the header bytes added per packet, by protocol,
+// when pricing flows. Clouds bill on-the-wire bytes while eBPF hooks may
+// report payload only; e.g. "TCP": 40 covers IPv4 and TCP headers. Protocol
+// names are case-insensitive. An empty map disables overhead.
+func (e *CostEngine) SetPacketOverhead(overhead map[string]uint64) error {
+	normalized := make(map[string]uint64, len(overhead))
+	for protocol, bytes := range overhead {
+		protocol = strings.ToUpper(strings.TrimSpace(protocol))
+		if protocol == "" {
+			return fmt.Errorf("packet overhead needs a protocol")
+		}
+		if strings.EqualFold(protocol, DefaultOverheadProtocol) {
+			protocol = DefaultOverheadProtocol
+		}
+		normalized[protocol] = bytes
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.packetOverhead = normalized
+	return nil
+}
+
+// GetPacketOverhead returns the configured per-packet overhead by protocol.
+func (e *CostEngine) GetPacketOverhead() map[string]uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make(map[string]uint64, len(e.packetOverhead))
+	for protocol, bytes := range e.packetOverhead {
+		out[protocol] = bytes
+	}
+	return out
+}
+
+// overheadBytes estimates header bytes for packets of protocol. Caller
+// must hold e.mu.
+func (e *CostEngine) overheadBytes(protocol string, packets uint64) uint64 {
+	perPacket, ok := e.packetOverhead[strings.ToUpper(protocol)]
+	if !ok {
+		perPacket = e.packetOverhead[DefaultOverheadProtocol]
+	}
+	return perPacket * packets
+}
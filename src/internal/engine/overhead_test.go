@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacketOverheadBilled(t *testing.T) {
+	flow := azureEgress("api", 2, time.Now())
+	flow.Protocol = "tcp"
+	flow.TotalPackets = 1_000_000
+
+	e := NewCostEngine()
+	without := e.CalculateCost(flow)
+	if without.OverheadBytes != 0 || !approxEqual(without.BilledGB, 2) {
+		t.Fatalf("without overhead: %d overhead bytes, %v GB billed; want 0 and 2", without.OverheadBytes, without.BilledGB)
+	}
+
+	if err := e.SetPacketOverhead(map[string]uint64{"TCP": 40, "default": 28}); err != nil {
+		t.Fatal(err)
+	}
+	with := e.CalculateCost(flow)
+	if with.OverheadBytes != 40_000_000 {
+		t.Errorf("overhead = %d bytes, want 40000000", with.OverheadBytes)
+	}
+	if with.BytesTransferred != flow.TotalBytes {
+		t.Errorf("bytes transferred = %d, want the reported %d", with.BytesTransferred, flow.TotalBytes)
+	}
+	wantGB := 2 + 40_000_000.0/gib
+	if !approxEqual(with.BilledGB, wantGB) || !approxEqual(with.CostUSD, wantGB*0.09) {
+		t.Errorf("billed %v GB for $%v, want %v GB for $%v", with.BilledGB, with.CostUSD, wantGB, wantGB*0.09)
+	}
+
+	// Protocols without an entry of their own use the default
+	flow.Protocol = "UDP"
+	if got := e.CalculateCost(flow).OverheadBytes; got != 28_000_000 {
+		t.Errorf("UDP overhead = %d bytes, want the default 28000000", got)
+	}
+}
+
+func TestSetPacketOverheadValidation(t *testing.T) {
+	e := NewCostEngine()
+	if err := e.SetPacketOverhead(map[string]uint64{" ": 40}); err == nil {
+		t.Error("blank protocol accepted")
+	}
+	if err := e.SetPacketOverhead(map[string]uint64{" udp ": 28, "Default": 20}); err != nil {
+		t.Fatal(err)
+	}
+	got := e.GetPacketOverhead()
+	if len(got) != 2 || got["UDP"] != 28 || got[DefaultOverheadProtocol] != 20 {
+		t.Errorf("overhead = %v, want UDP and default normalized", got)
+	}
+}
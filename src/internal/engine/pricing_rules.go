@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// ErrPricingRuleNotFound is returned when a pricing rule ID is unknown.
+var ErrPricingRuleNotFound = errors.New("pricing rule not found")
+
+// PricingRuleStore persists custom pricing rules and deletions across
+// restarts. The API server uses the ClickHouse store: the module has no
+// PostgreSQL client, and a Postgres store can implement this interface
+// once it does.
+type PricingRuleStore interface {
+	SavePricingRule(ctx context.Context, rule types.PricingRule) error
+	DeletePricingRule(ctx context.Context, id uuid.UUID) error
+	LoadPricingRules(ctx context.Context) ([]types.PricingRule, error)
+	// LoadDeletedPricingRuleIDs returns the IDs of deleted rules, which
+	// keeps deleted defaults from coming back on restart.
+	LoadDeletedPricingRuleIDs(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// validCostCategories are the categories CalculateCost can classify.
+var validCostCategories = map[types.CostCategory]bool{
+	types.CostCategoryEgressInternet: true,
+	types.CostCategoryEgressRegion:   true,
+	types.CostCategoryCrossAZ:        true,
+	types.CostCategoryCrossRegion:    true,
+	types.CostCategoryCrossCluster:   true,
+	types.CostCategoryVPCPeering:     true,
+	types.CostCategoryNATGateway:     true,
+	types.CostCategoryLoadBalancer:   true,
+	types.CostCategoryPrivateLink:    true,
+}
+
+// validatePricingRule checks that a rule can be priced with.
+func validatePricingRule(rule types.PricingRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return errors.New("name is required")
+	}
+	switch rule.CloudProvider {
+	case types.CloudProviderAWS, types.CloudProviderGCP, types.CloudProviderAzure:
+	default:
+		return fmt.Errorf("unknown cloud_provider %q", rule.CloudProvider)
+	}
+	if !validCostCategories[rule.Category] {
+		return fmt.Errorf("unknown category %q", rule.Category)
+	}
+	if rule.CostPerGB < 0 {
+		return errors.New("cost_per_gb must not be negative")
+	}
+	if rule.FreeTierGB < 0 {
+		return errors.New("free_tier_gb must not be negative")
+	}
+	if !sort.SliceIsSorted(rule.Tiers, func(i, j int) bool {
+		return rule.Tiers[i].ThresholdGB < rule.Tiers[j].ThresholdGB
+	}) {
+		return errors.New("tiers must be in ascending threshold order")
+	}
+	for _, t := range rule.Tiers {
+		if t.ThresholdGB < 0 || t.CostPerGB < 0 {
+			return errors.New("tier threshold and cost must not be negative")
+		}
+	}
+	if rule.EffectiveUntil != nil && !rule.EffectiveUntil.After(rule.EffectiveFrom) {
+		return errors.New("effective_until must be after effective_from")
+	}
+	return nil
+}
+
+// CreatePricingRule validates and adds a pricing rule, assigning an ID and
+// defaulting EffectiveFrom to now.
+func (e *CostEngine) CreatePricingRule(rule types.PricingRule) (types.PricingRule, error) {
+	if rule.EffectiveFrom.IsZero() {
+		rule.EffectiveFrom = time.Now()
+	}
+	if err := validatePricingRule(rule); err != nil {
+		return rule, err
+	}
+	if rule.ID == uuid.Nil {
+		rule.ID = uuid.New()
+	}
+
+	e.AddPricingRule(rule)
+
+	log.Info().
+		Str("id", rule.ID.String()).
+		Str("name", rule.Name).
+		Str("category", string(rule.Category)).
+		Msg("Pricing rule added")
+
+	return rule, nil
+}
+
+// RemovePricingRule deletes a pricing rule by ID. Built-in default rules
+// can be removed too; they stay removed once the deletion is persisted.
+func (e *CostEngine) RemovePricingRule(id uuid.UUID) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, r := range e.rules {
+		if r.ID == id {
+			e.rules = append(e.rules[:i:i], e.rules[i+1:]...)
+			if isDefaultRule(r) {
+				e.deleted[id] = true
+			}
+			log.Info().Str("id", id.String()).Msg("Pricing rule removed")
+			return nil
+		}
+	}
+	return ErrPricingRuleNotFound
+}
+
+// LoadPricingRules adds persisted custom rules to the engine, in the order
+// the store returns them, oldest first, and drops deleted defaults. Invalid
+// rules are skipped with a warning.
+func (e *CostEngine) LoadPricingRules(ctx context.Context, store PricingRuleStore) error {
+	deleted, err := store.LoadDeletedPricingRuleIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range deleted {
+		e.removeDefaultRule(id)
+	}
+
+	rules, err := store.LoadPricingRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := validatePricingRule(rule); err != nil {
+			log.Warn().Err(err).Str("id", rule.ID.String()).Msg("Skipping invalid stored pricing rule")
+			continue
+		}
+		e.AddPricingRule(rule)
+	}
+	return nil
+}
+
+// removeDefaultRule drops a default rule by ID and keeps it from being
+// reloaded. Other IDs are ignored.
+func (e *CostEngine) removeDefaultRule(id uuid.UUID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, r := range e.rules {
+		if r.ID == id && isDefaultRule(r) {
+			e.rules = append(e.rules[:i:i], e.rules[i+1:]...)
+			e.deleted[id] = true
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// memPricingStore is an in-memory PricingRuleStore.
+type memPricingStore struct {
+	rules   []types.PricingRule
+	deleted []uuid.UUID
+}
+
+func (m *memPricingStore) SavePricingRule(_ context.Context, rule types.PricingRule) error {
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+func (m *memPricingStore) DeletePricingRule(_ context.Context, id uuid.UUID) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+func (m *memPricingStore) LoadPricingRules(context.Context) ([]types.PricingRule, error) {
+	return m.rules, nil
+}
+
+func (m *memPricingStore) LoadDeletedPricingRuleIDs(context.Context) ([]uuid.UUID, error) {
+	return m.deleted, nil
+}
+
+func validRule() types.PricingRule {
+	return types.PricingRule{
+		Name:          "Negotiated egress",
+		CloudProvider: types.CloudProviderAWS,
+		Category:      types.CostCategoryEgressInternet,
+		CostPerGB:     0.05,
+	}
+}
+
+func TestValidatePricingRule(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	tests := []struct {
+		name   string
+		modify func(*types.PricingRule)
+	}{
+		{"no name", func(r *types.PricingRule) { r.Name = " " }},
+		{"unknown provider", func(r *types.PricingRule) { r.CloudProvider = "oracle" }},
+		{"unknown category", func(r *types.PricingRule) { r.Category = "teleport" }},
+		{"negative cost", func(r *types.PricingRule) { r.CostPerGB = -0.01 }},
+		{"negative free tier", func(r *types.PricingRule) { r.FreeTierGB = -1 }},
+		{"unsorted tiers", func(r *types.PricingRule) {
+			r.Tiers = []types.PricingTier{{ThresholdGB: 50, CostPerGB: 0.04}, {ThresholdGB: 10, CostPerGB: 0.08}}
+		}},
+		{"negative tier", func(r *types.PricingRule) { r.Tiers = []types.PricingTier{{ThresholdGB: 10, CostPerGB: -1}} }},
+		{"ends before it starts", func(r *types.PricingRule) { r.EffectiveFrom, r.EffectiveUntil = now, &earlier }},
+	}
+	for _, tt := range tests {
+		rule := validRule()
+		tt.modify(&rule)
+		if _, err := NewCostEngine().CreatePricingRule(rule); err == nil {
+			t.Errorf("%s: rule accepted", tt.name)
+		}
+	}
+
+	created, err := NewCostEngine().CreatePricingRule(validRule())
+	if err != nil || created.ID == uuid.Nil || created.EffectiveFrom.IsZero() {
+		t.Errorf("valid rule: %+v, %v; want an ID and effective_from assigned", created, err)
+	}
+}
+
+func TestLoadPricingRulesSkipsInvalid(t *testing.T) {
+	valid := validRule()
+	valid.ID = uuid.New()
+	valid.EffectiveFrom = time.Now()
+	invalid := valid
+	invalid.ID = uuid.New()
+	invalid.CostPerGB = -1
+	store := &memPricingStore{rules: []types.PricingRule{valid, invalid}}
+
+	e := NewCostEngine()
+	before := len(e.GetPricingRules())
+	if err := e.LoadPricingRules(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	rules := e.GetPricingRules()
+	if len(rules) != before+1 {
+		t.Fatalf("got %d rules, want %d plus the valid stored one", len(rules), before)
+	}
+	if err := e.RemovePricingRule(invalid.ID); err != ErrPricingRuleNotFound {
+		t.Errorf("removing the invalid rule: %v, want it never loaded", err)
+	}
+	if err := e.RemovePricingRule(valid.ID); err != nil {
+		t.Errorf("removing the valid rule: %v", err)
+	}
+}
+
+// egressFlow is a GB of AWS internet egress, past the free tier.
+func egressFlow() types.TransferFlow {
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api", CloudProvider: "aws"},
+		DestinationEndpoint: &types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          1 << 30,
+		WindowStart:         time.Now(),
+		WindowEnd:           time.Now(),
+	}
+}
+
+func TestCustomRulesTakePrecedence(t *testing.T) {
+	e := NewCostEngine()
+	e.RecordFlowCost(egressFlow()) // Use up the free tier
+
+	rule := validRule()
+	rule.EffectiveFrom = time.Now().Add(-time.Hour)
+	created, err := e.CreatePricingRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.CalculateCost(egressFlow()); ruleID(got) != created.ID || math.Abs(got.CostUSD-0.05) > 1e-9 {
+		t.Errorf("cost = $%v by rule %s, want $0.05 by the custom rule %s", got.CostUSD, ruleID(got), created.ID)
+	}
+
+	// The newest custom rule wins over older ones
+	rule.CostPerGB = 0.04
+	newer, err := e.CreatePricingRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.CalculateCost(egressFlow()); ruleID(got) != newer.ID {
+		t.Errorf("priced by %s, want the newer rule %s", ruleID(got), newer.ID)
+	}
+
+	// Reloading the defaults keeps custom rules first
+	e.LoadDefaultAWSPricing()
+	if got := e.CalculateCost(egressFlow()); ruleID(got) != newer.ID {
+		t.Errorf("after reloading defaults priced by %s, want %s", ruleID(got), newer.ID)
+	}
+}
+
+func TestDeletedDefaultStaysDeleted(t *testing.T) {
+	e := NewCostEngine()
+	var egress types.PricingRule
+	for _, r := range e.GetPricingRules() {
+		if r.Name == "AWS Internet Egress" {
+			egress = r
+		}
+	}
+	if egress.ID != NewCostEngine().GetPricingRules()[0].ID {
+		t.Fatalf("default rule IDs differ between engines")
+	}
+
+	store := &memPricingStore{}
+	if err := e.RemovePricingRule(egress.ID); err != nil {
+		t.Fatal(err)
+	}
+	store.DeletePricingRule(context.Background(), egress.ID)
+	e.LoadDefaultAWSPricing()
+	if hasRule(e.GetPricingRules(), egress.ID) {
+		t.Error("deleted default came back when defaults were reloaded")
+	}
+
+	// A restarted engine drops it again from the persisted deletion
+	restarted := NewCostEngine()
+	if err := restarted.LoadPricingRules(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	if hasRule(restarted.GetPricingRules(), egress.ID) {
+		t.Error("deleted default came back after a restart")
+	}
+}
+
+// ruleID returns the rule a cost was priced by, or uuid.Nil.
+func ruleID(b types.CostBreakdown) uuid.UUID {
+	if b.PricingRuleID == nil {
+		return uuid.Nil
+	}
+	return *b.PricingRuleID
+}
+
+func hasRule(rules []types.PricingRule, id uuid.UUID) bool {
+	for _, r := range rules {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
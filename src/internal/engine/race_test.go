@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// TestConcurrentDetectionAndSummary is meant for go test -race: callers
+// mutate the anomalies they are handed while the engine detects, escalates
+// and acknowledges the originals.
+func TestConcurrentDetectionAndSummary(t *testing.T) {
+	e := newSteadyEngine(t)
+	e.SetEscalationInterval(time.Minute)
+	detect := func() {
+		for _, a := range e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 50000}) {
+			started := time.Now()
+			a.StartedAt = &started
+			a.Labels = map[string]string{"round": "detect"}
+			e.AddAnomaly(a)
+		}
+	}
+	detect()
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			detect()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			e.ReconcileAnomalies(time.Now().Add(time.Duration(i) * time.Minute))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			for _, a := range e.GetActiveAnomalies() {
+				_ = e.AcknowledgeAnomaly(a.ID, "oncall")
+				a.Severity = types.SeverityInfo
+				a.Labels["round"] = "active"
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			for _, a := range e.GetAnomalySummary().TopAnomalies {
+				if a.StartedAt != nil {
+					*a.StartedAt = time.Time{}
+				}
+				if a.AcknowledgedAt != nil {
+					*a.AcknowledgedAt = time.Time{}
+				}
+				a.Labels["round"] = "summary"
+				if len(a.PotentialCauses) > 0 {
+					a.PotentialCauses[0] = ""
+				}
+			}
+		}
+	}()
+	wg.Wait()
+
+	for _, a := range e.GetAnomalySummary().TopAnomalies {
+		if a.Labels["round"] != "detect" || a.StartedAt == nil || a.StartedAt.IsZero() {
+			t.Fatalf("anomaly %s changed through a copy: labels %v, started %v", a.ID, a.Labels, a.StartedAt)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import "slices"
+
+// topCacheSize is how many of the heaviest nodes and edges are kept ranked
+// as the graph grows. Requests for more sort the whole graph.
+const topCacheSize = 100
+
+// ranking keeps the heaviest items of a set in descending order of weight,
+// updated as items change so reads need no sort. It relies on weights
+// never decreasing between resets, which holds for graph byte counters. A
+// nil ranking keeps nothing.
+type ranking[T comparable] struct {
+	weight func(T) uint64
+	items  []T
+}
+
+func newRanking[T comparable](weight func(T) uint64) *ranking[T] {
+	return &ranking[T]{weight: weight}
+}
+
+// update re-ranks item after its weight grew, admitting it if it now
+// outweighs the lightest item kept.
+func (r *ranking[T]) update(item T) {
+	if r == nil {
+		return
+	}
+
+	i := slices.Index(r.items, item)
+	switch {
+	case i >= 0:
+	case len(r.items) < topCacheSize:
+		r.items = append(r.items, item)
+		i = len(r.items) - 1
+	case r.weight(item) > r.weight(r.items[len(r.items)-1]):
+		i = len(r.items) - 1
+		r.items[i] = item
+	default:
+		return
+	}
+
+	for i > 0 && r.weight(r.items[i]) > r.weight(r.items[i-1]) {
+		r.items[i], r.items[i-1] = r.items[i-1], r.items[i]
+		i--
+	}
+}
+
+// top returns the n heaviest items, or false if n is more than the
+// ranking keeps.
+func (r *ranking[T]) top(n int) ([]T, bool) {
+	if r == nil || n > topCacheSize {
+		return nil, false
+	}
+	n = min(n, len(r.items))
+	if n < 0 {
+		n = 0
+	}
+	out := make([]T, n)
+	copy(out, r.items)
+	return out, true
+}
+
+// reset empties the ranking.
+func (r *ranking[T]) reset() {
+	if r != nil {
+		r.items = nil
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// rankedGraph returns a graph of n random flows among 1000 services.
+func rankedGraph(n int) *TransferGraph {
+	rng := rand.New(rand.NewSource(1))
+	g := NewTransferGraph()
+	for i := 0; i < n; i++ {
+		src, dst := rng.Intn(1000), rng.Intn(1000)
+		g.AddFlow(serviceFlow(fmt.Sprintf("svc-%d", src), fmt.Sprintf("svc-%d", dst), uint64(rng.Intn(1_000_000))))
+	}
+	return g
+}
+
+// sortedOnly drops g's rankings so every read sorts the whole graph.
+func sortedOnly(g *TransferGraph) *TransferGraph {
+	g.talkers, g.listeners, g.heavyEdges = nil, nil, nil
+	return g
+}
+
+func TestRankingMatchesSort(t *testing.T) {
+	ranked, sorted := rankedGraph(20000), sortedOnly(rankedGraph(20000))
+
+	for _, n := range []int{1, 10, topCacheSize} {
+		talkers, want := ranked.GetTopTalkers(n), sorted.GetTopTalkers(n)
+		if len(talkers) != n || len(want) != n {
+			t.Fatalf("top %d talkers: got %d and %d", n, len(talkers), len(want))
+		}
+		for i := range want {
+			if talkers[i].TotalBytesSent != want[i].TotalBytesSent {
+				t.Errorf("talker %d of %d sent %d bytes, want %d", i, n, talkers[i].TotalBytesSent, want[i].TotalBytesSent)
+			}
+		}
+
+		listeners, wantListeners := ranked.GetTopListeners(n), sorted.GetTopListeners(n)
+		for i := range wantListeners {
+			if listeners[i].TotalBytesReceived != wantListeners[i].TotalBytesReceived {
+				t.Errorf("listener %d of %d received %d bytes, want %d", i, n, listeners[i].TotalBytesReceived, wantListeners[i].TotalBytesReceived)
+			}
+		}
+
+		edges, wantEdges := ranked.GetTopEdges(n), sorted.GetTopEdges(n)
+		for i := range wantEdges {
+			if edges[i].TotalBytes != wantEdges[i].TotalBytes {
+				t.Errorf("edge %d of %d carries %d bytes, want %d", i, n, edges[i].TotalBytes, wantEdges[i].TotalBytes)
+			}
+		}
+	}
+}
+
+func TestRankingReset(t *testing.T) {
+	g := rankedGraph(100)
+	g.Reset()
+	if top := g.GetTopEdges(10); len(top) != 0 {
+		t.Errorf("%d top edges after reset, want none", len(top))
+	}
+
+	g.AddFlow(serviceFlow("api", "db", 100))
+	if top := g.GetTopTalkers(10); len(top) != 1 || top[0].ID != "shop/api" {
+		t.Errorf("top talkers = %v, want only shop/api", top)
+	}
+}
+
+func BenchmarkTopEdgesRanked(b *testing.B) {
+	g := rankedGraph(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.GetTopEdges(10)
+	}
+}
+
+func BenchmarkTopEdgesSorted(b *testing.B) {
+	g := sortedOnly(rankedGraph(100000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.GetTopEdges(10)
+	}
+}
@@ -0,0 +1,34 @@
+package engine
+
+// Reachable returns every node reachable from srcID by following transfer
+// edges, with its hop distance. The source itself is not included. A
+// maxDepth of zero or less leaves the walk unbounded.
+func (g *TransferGraph) Reachable(srcID string, maxDepth int) map[string]int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	hops := make(map[string]int)
+	if g.nodes[srcID] == nil {
+		return hops
+	}
+
+	frontier := []string{srcID}
+	for depth := 1; len(frontier) > 0 && (maxDepth <= 0 || depth <= maxDepth); depth++ {
+		var next []string
+		for _, id := range frontier {
+			node := g.nodes[id]
+			if node == nil {
+				continue // External destinations have no outgoing edges
+			}
+			for dstID := range node.Neighbors {
+				if _, seen := hops[dstID]; seen || dstID == srcID {
+					continue
+				}
+				hops[dstID] = depth
+				next = append(next, dstID)
+			}
+		}
+		frontier = next
+	}
+	return hops
+}
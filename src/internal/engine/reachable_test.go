@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReachableHopDistances(t *testing.T) {
+	g := NewGraphEngine(nil)
+	// a -> b -> c -> d -> e, with a shortcut a -> c and e looping back to a
+	for _, pair := range [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}, {"d", "e"}, {"a", "c"}, {"e", "a"}, {"x", "a"}} {
+		g.AddFlow(serviceFlow(pair[0], pair[1], 100))
+	}
+	graph := g.GetGraph()
+
+	want := map[string]int{"shop/b": 1, "shop/c": 1, "shop/d": 2, "shop/e": 3}
+	if got := graph.Reachable("shop/a", 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("reachable from a = %v, want %v", got, want)
+	}
+	if got := graph.Reachable("shop/a", 2); !reflect.DeepEqual(got, map[string]int{"shop/b": 1, "shop/c": 1, "shop/d": 2}) {
+		t.Errorf("reachable from a within 2 hops = %v", got)
+	}
+	if got := graph.Reachable("shop/d", 0); !reflect.DeepEqual(got, map[string]int{"shop/e": 1, "shop/a": 2, "shop/b": 3, "shop/c": 3}) {
+		t.Errorf("reachable from d = %v", got)
+	}
+	if got := graph.Reachable("shop/missing", 0); len(got) != 0 {
+		t.Errorf("reachable from an unknown service = %v, want none", got)
+	}
+}
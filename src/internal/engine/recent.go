@@ -0,0 +1,56 @@
+package engine
+
+import "time"
+
+// Shape of the per-edge recent byte history: recentWindows counts of
+// recentWindow each, enough for a sparkline of the last quarter hour.
+const (
+	recentWindow  = time.Minute
+	recentWindows = 15
+)
+
+// recentBytes is a fixed-size ring of byte counts per window, ending at
+// the latest window a flow started in. Windows with no flows count zero;
+// flows older than the ring are dropped.
+type recentBytes struct {
+	counts [recentWindows]uint64
+	head   int       // Slot of the latest window
+	latest time.Time // Start of the latest window, zero if empty
+}
+
+// add counts bytes in the window containing at, advancing the ring when
+// at is past the latest window.
+func (r *recentBytes) add(at time.Time, bytes uint64) {
+	if at.IsZero() {
+		return
+	}
+	window := at.Truncate(recentWindow)
+	if r.latest.IsZero() {
+		r.latest = window
+	}
+
+	ahead := int(window.Sub(r.latest) / recentWindow)
+	switch {
+	case ahead > 0:
+		for i := 0; i < min(ahead, recentWindows); i++ {
+			r.head = (r.head + 1) % recentWindows
+			r.counts[r.head] = 0
+		}
+		r.latest = window
+		r.counts[r.head] += bytes
+	case -ahead < recentWindows:
+		r.counts[(r.head+ahead+recentWindows)%recentWindows] += bytes
+	}
+}
+
+// values returns the counts oldest first, or nil if nothing was added.
+func (r *recentBytes) values() []uint64 {
+	if r.latest.IsZero() {
+		return nil
+	}
+	out := make([]uint64, recentWindows)
+	for i := range out {
+		out[i] = r.counts[(r.head+1+i)%recentWindows]
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecentBytesKeepsLastWindows(t *testing.T) {
+	var r recentBytes
+	if r.values() != nil {
+		t.Fatal("empty ring has values")
+	}
+
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	const pushed = recentWindows + 5
+	for i := 0; i < pushed; i++ {
+		r.add(start.Add(time.Duration(i)*recentWindow+10*time.Second), uint64(i+1))
+	}
+
+	want := make([]uint64, recentWindows)
+	for i := range want {
+		want[i] = uint64(pushed - recentWindows + i + 1)
+	}
+	if got := r.values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want the last %d windows %v", got, recentWindows, want)
+	}
+}
+
+func TestRecentBytesGapsAndLateFlows(t *testing.T) {
+	var r recentBytes
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	r.add(start, 100)
+	r.add(start.Add(3*recentWindow), 300)
+	r.add(start.Add(30*time.Second), 50)                              // Late, same window as the first
+	r.add(start.Add(-time.Duration(recentWindows)*recentWindow), 999) // Older than the ring
+
+	got := r.values()
+	want := make([]uint64, recentWindows)
+	want[recentWindows-4] = 150
+	want[recentWindows-1] = 300
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+
+	// A jump past the whole ring leaves only the new window
+	r.add(start.Add(time.Hour), 7)
+	want = make([]uint64, recentWindows)
+	want[recentWindows-1] = 7
+	if got := r.values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after a gap: values = %v, want %v", got, want)
+	}
+}
+
+func TestEdgeJSONRecentBytes(t *testing.T) {
+	g := NewTransferGraph()
+	start := time.Now().Truncate(recentWindow)
+	for i := 0; i < 3; i++ {
+		flow := serviceFlow("api", "db", uint64(100*(i+1)))
+		flow.WindowStart = start.Add(time.Duration(i) * recentWindow)
+		flow.WindowEnd = flow.WindowStart.Add(recentWindow)
+		g.AddFlow(flow)
+	}
+
+	edges := g.ToJSON().Edges
+	if len(edges) != 1 {
+		t.Fatalf("%d edges, want 1", len(edges))
+	}
+	recent := edges[0].RecentBytes
+	if len(recent) != recentWindows || !reflect.DeepEqual(recent[recentWindows-3:], []uint64{100, 200, 300}) {
+		t.Errorf("recent_bytes = %v, want the three windows last", recent)
+	}
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+const (
+	// relatedEventWindow is how far back to look for an anomaly's events,
+	// matching the hourly granularity of baselines.
+	relatedEventWindow = time.Hour
+	// relatedEventLimit caps the event IDs linked to one anomaly.
+	relatedEventLimit = 20
+)
+
+// EventSource looks up raw transfer events for a flow.
+type EventSource interface {
+	// TopEventIDs returns IDs of the largest events for flowKey in
+	// [start, end), biggest first.
+	TopEventIDs(ctx context.Context, flowKey string, start, end time.Time, limit int) ([]string, error)
+}
+
+// SetEventSource sets where DetectAnomalies looks up related events.
+func (e *BaselineEngine) SetEventSource(src EventSource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = src
+}
+
+// attachRelatedEvents links each anomaly to the top events of its flow.
+// Lookup failures are logged and leave the anomaly without related events.
+func (e *BaselineEngine) attachRelatedEvents(ctx context.Context, anomalies []*types.Anomaly) {
+	e.mu.RLock()
+	src := e.events
+	e.mu.RUnlock()
+	if src == nil {
+		return
+	}
+
+	for _, anomaly := range anomalies {
+		end := anomaly.DetectedAt
+		ids, err := src.TopEventIDs(ctx, anomaly.SourceService, end.Add(-relatedEventWindow), end, relatedEventLimit)
+		if err != nil {
+			log.Warn().Err(err).Str("flow", anomaly.SourceService).Msg("Failed to look up related events")
+			continue
+		}
+		anomaly.RelatedEventIDs = ids
+	}
+}
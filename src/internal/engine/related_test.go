@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeEventSource returns canned event IDs and records lookups.
+type fakeEventSource struct {
+	ids     []string
+	err     error
+	flows   []string
+	windows []time.Duration
+	limits  []int
+}
+
+func (f *fakeEventSource) TopEventIDs(_ context.Context, flowKey string, start, end time.Time, limit int) ([]string, error) {
+	f.flows = append(f.flows, flowKey)
+	f.windows = append(f.windows, end.Sub(start))
+	f.limits = append(f.limits, limit)
+	return f.ids, f.err
+}
+
+func TestAnomalyLinksRelatedEvents(t *testing.T) {
+	e := newSteadyEngine(t)
+	src := &fakeEventSource{ids: []string{"event-1", "event-2", "event-3"}}
+	e.SetEventSource(src)
+
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 10000})
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1", len(anomalies))
+	}
+	if got := anomalies[0].RelatedEventIDs; !reflect.DeepEqual(got, src.ids) {
+		t.Errorf("related events = %v, want %v", got, src.ids)
+	}
+	if len(src.flows) != 1 || src.flows[0] != testFlowKey {
+		t.Errorf("looked up flows %v, want %s", src.flows, testFlowKey)
+	}
+	if src.windows[0] != relatedEventWindow || src.limits[0] != relatedEventLimit {
+		t.Errorf("looked up %s limit %d, want %s limit %d", src.windows[0], src.limits[0], relatedEventWindow, relatedEventLimit)
+	}
+}
+
+func TestAnomalyWithoutRelatedEvents(t *testing.T) {
+	e := newSteadyEngine(t)
+	src := &fakeEventSource{err: errors.New("clickhouse unavailable")}
+	e.SetEventSource(src)
+
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 10000})
+	if len(anomalies) != 1 || anomalies[0].RelatedEventIDs != nil {
+		t.Errorf("got %+v, want the anomaly still reported without related events", anomalies)
+	}
+
+	// Flows within baseline are not looked up
+	src.flows = nil
+	e.DetectAnomalies(context.Background(), map[string]float64{testFlowKey: 1000})
+	if len(src.flows) != 0 {
+		t.Errorf("looked up %v for normal traffic", src.flows)
+	}
+}
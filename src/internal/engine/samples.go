@@ -0,0 +1,29 @@
+package engine
+
+import "fmt"
+
+// defaultMinSamples is a day of hourly values.
+const defaultMinSamples = 24
+
+// SetSampleRequirements sets how many hourly values BuildBaseline needs to
+// build a baseline (24 when zero), and how many samples a baseline needs
+// before DetectAnomalies alerts on deviations from it (no extra
+// requirement when zero). Requiring a week of data, 168, avoids alerting on
+// baselines that have not yet seen a weekly cycle.
+func (e *BaselineEngine) SetSampleRequirements(minSamples, confidenceSamples int) error {
+	if minSamples == 0 {
+		minSamples = defaultMinSamples
+	}
+	if minSamples < 2 {
+		return fmt.Errorf("minimum baseline samples must be at least 2, got %d", minSamples)
+	}
+	if confidenceSamples < 0 {
+		return fmt.Errorf("baseline confidence samples must not be negative, got %d", confidenceSamples)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.minSamples = minSamples
+	e.confidenceSamples = confidenceSamples
+	return nil
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMinSamplesGateBaselines(t *testing.T) {
+	end := time.Now()
+	build := func(e *BaselineEngine, n int) bool {
+		return e.BuildBaseline(context.Background(), testFlowKey, steadyValues(n), end.Add(-time.Duration(n)*time.Hour), end) != nil
+	}
+
+	e := NewBaselineEngine(3)
+	if build(e, 23) || !build(e, 24) {
+		t.Error("default minimum is not a day of samples")
+	}
+
+	e = NewBaselineEngine(3)
+	if err := e.SetSampleRequirements(168, 0); err != nil {
+		t.Fatal(err)
+	}
+	if build(e, 48) {
+		t.Error("baseline built from 48 samples with a week required")
+	}
+	if !build(e, 168) {
+		t.Error("no baseline from a week of samples")
+	}
+}
+
+func TestConfidenceSamplesGateDetection(t *testing.T) {
+	ctx := context.Background()
+	end := time.Now()
+	spike := map[string]float64{testFlowKey: 100000}
+
+	e := NewBaselineEngine(3)
+	if err := e.SetSampleRequirements(24, 72); err != nil {
+		t.Fatal(err)
+	}
+	e.BuildBaseline(ctx, testFlowKey, steadyValues(48), end.Add(-48*time.Hour), end)
+	if got := e.DetectAnomalies(ctx, spike); len(got) != 0 {
+		t.Errorf("%d anomalies from a 48-sample baseline, want none below 72", len(got))
+	}
+
+	e.BuildBaseline(ctx, testFlowKey, steadyValues(96), end.Add(-96*time.Hour), end)
+	if got := e.DetectAnomalies(ctx, spike); len(got) != 1 {
+		t.Errorf("%d anomalies from a 96-sample baseline, want the spike", len(got))
+	}
+}
+
+func TestSetSampleRequirementsValidation(t *testing.T) {
+	e := NewBaselineEngine(3)
+	for _, tt := range [][2]int{{1, 0}, {-5, 0}, {24, -1}} {
+		if err := e.SetSampleRequirements(tt[0], tt[1]); err == nil {
+			t.Errorf("SetSampleRequirements(%d, %d) accepted", tt[0], tt[1])
+		}
+	}
+	if err := e.SetSampleRequirements(0, 0); err != nil || e.minSamples != defaultMinSamples {
+		t.Errorf("zero minimum: err %v, min %d; want the default", err, e.minSamples)
+	}
+}
@@ -0,0 +1,84 @@
+package engine
+
+import "github.com/egressor/egressor/src/pkg/types"
+
+// SharedCostStrategy selects how untagged cost is spread across teams.
+type SharedCostStrategy string
+
+const (
+	// SharedCostNone leaves untagged attributions as they are.
+	SharedCostNone SharedCostStrategy = ""
+	// SharedCostEven splits untagged cost equally between teams.
+	SharedCostEven SharedCostStrategy = "even"
+	// SharedCostProportional splits untagged cost by each team's own cost.
+	SharedCostProportional SharedCostStrategy = "proportional"
+)
+
+// ParseSharedCostStrategy validates a strategy name.
+func ParseSharedCostStrategy(s string) (SharedCostStrategy, bool) {
+	switch strategy := SharedCostStrategy(s); strategy {
+	case SharedCostNone, SharedCostEven, SharedCostProportional:
+		return strategy, true
+	}
+	return SharedCostNone, false
+}
+
+// AllocateSharedCost distributes the cost of attributions without a team
+// across the tagged ones and drops the untagged entries. Within a team the
+// share is split by each attribution's cost, or evenly if the team has none.
+// If no attribution has a team the input is returned unchanged.
+func AllocateSharedCost(attributions []types.CostAttribution, strategy SharedCostStrategy) []types.CostAttribution {
+	if strategy == SharedCostNone {
+		return attributions
+	}
+
+	var shared float64
+	teamCost := make(map[string]float64)
+	teamMembers := make(map[string]int)
+	var teams []string
+	for _, a := range attributions {
+		if a.Team == "" {
+			shared += a.TotalCostUSD
+			continue
+		}
+		if _, ok := teamMembers[a.Team]; !ok {
+			teams = append(teams, a.Team)
+		}
+		teamCost[a.Team] += a.TotalCostUSD
+		teamMembers[a.Team]++
+	}
+	if len(teams) == 0 {
+		return attributions
+	}
+
+	var taggedTotal float64
+	for _, team := range teams {
+		taggedTotal += teamCost[team]
+	}
+
+	teamShare := make(map[string]float64, len(teams))
+	for _, team := range teams {
+		if strategy == SharedCostProportional && taggedTotal > 0 {
+			teamShare[team] = shared * teamCost[team] / taggedTotal
+		} else {
+			teamShare[team] = shared / float64(len(teams))
+		}
+	}
+
+	result := make([]types.CostAttribution, 0, len(attributions))
+	for _, a := range attributions {
+		if a.Team == "" {
+			continue
+		}
+		var share float64
+		if teamCost[a.Team] > 0 {
+			share = teamShare[a.Team] * a.TotalCostUSD / teamCost[a.Team]
+		} else {
+			share = teamShare[a.Team] / float64(teamMembers[a.Team])
+		}
+		a.SharedCostUSD += share
+		a.TotalCostUSD += share
+		result = append(result, a)
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// sharedAttributions has $30 of payments cost over two services, $10 of
+// search cost and $20 untagged.
+func sharedAttributions() []types.CostAttribution {
+	return []types.CostAttribution{
+		{ServiceName: "checkout", Team: "payments", TotalCostUSD: 20},
+		{ServiceName: "ledger", Team: "payments", TotalCostUSD: 10},
+		{ServiceName: "query", Team: "search", TotalCostUSD: 10},
+		{ServiceName: "nat-gateway", TotalCostUSD: 15},
+		{ServiceName: "coredns", TotalCostUSD: 5},
+	}
+}
+
+func TestAllocateSharedCost(t *testing.T) {
+	tests := []struct {
+		strategy SharedCostStrategy
+		want     map[string]float64 // Shared cost per service
+	}{
+		{SharedCostEven, map[string]float64{"checkout": 10 * 2 / 3.0, "ledger": 10 / 3.0, "query": 10}},
+		{SharedCostProportional, map[string]float64{"checkout": 10, "ledger": 5, "query": 5}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			got := AllocateSharedCost(sharedAttributions(), tt.strategy)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d attributions, want the %d tagged ones", len(got), len(tt.want))
+			}
+
+			var allocated, total float64
+			for _, a := range got {
+				if !approxEqual(a.SharedCostUSD, tt.want[a.ServiceName]) {
+					t.Errorf("%s shared $%v, want $%v", a.ServiceName, a.SharedCostUSD, tt.want[a.ServiceName])
+				}
+				allocated += a.SharedCostUSD
+				total += a.TotalCostUSD
+			}
+			if !approxEqual(allocated, 20) {
+				t.Errorf("allocated $%v, want the untagged $20", allocated)
+			}
+			if !approxEqual(total, 60) {
+				t.Errorf("total $%v, want the original $60", total)
+			}
+		})
+	}
+}
+
+func TestAllocateSharedCostWithoutTeams(t *testing.T) {
+	untagged := []types.CostAttribution{{ServiceName: "nat-gateway", TotalCostUSD: 15}}
+	if got := AllocateSharedCost(untagged, SharedCostEven); len(got) != 1 || got[0].SharedCostUSD != 0 {
+		t.Errorf("got %+v, want the untagged attribution unchanged", got)
+	}
+	if got := AllocateSharedCost(sharedAttributions(), SharedCostNone); len(got) != 5 {
+		t.Errorf("no strategy kept %d attributions, want all 5", len(got))
+	}
+}
+
+func TestParseSharedCostStrategy(t *testing.T) {
+	for _, s := range []string{"", "even", "proportional"} {
+		if _, ok := ParseSharedCostStrategy(s); !ok {
+			t.Errorf("%q rejected", s)
+		}
+	}
+	if _, ok := ParseSharedCostStrategy("weighted"); ok {
+		t.Error("weighted accepted")
+	}
+}
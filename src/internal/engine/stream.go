@@ -0,0 +1,92 @@
+package engine
+
+// GraphDelta holds the nodes and edges changed since a client's last seen
+// version. When Full is set the client must discard its copy and replace it
+// with Nodes and Edges.
+type GraphDelta struct {
+	Version uint64     `json:"version"`
+	Full    bool       `json:"full"`
+	Nodes   []NodeJSON `json:"nodes"`
+	Edges   []EdgeJSON `json:"edges"`
+}
+
+// Version returns the current graph version.
+func (g *TransferGraph) Version() uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.version
+}
+
+// ChangesSince returns everything changed after version since; since 0
+// returns the whole graph. A version from before the last Reset or from the
+// future yields a full snapshot.
+func (g *TransferGraph) ChangesSince(since uint64) GraphDelta {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	full := since < g.resetVersion || since > g.version
+	if full {
+		since = 0
+	}
+
+	delta := GraphDelta{
+		Version: g.version,
+		Full:    full,
+		Nodes:   []NodeJSON{},
+		Edges:   []EdgeJSON{},
+	}
+	for _, n := range g.nodes {
+		if n.Version > since {
+			delta.Nodes = append(delta.Nodes, n.ToJSON())
+		}
+	}
+	for _, e := range g.edges {
+		if e.Version > since {
+			delta.Edges = append(delta.Edges, e.ToJSON())
+		}
+	}
+	return delta
+}
+
+// Subscribe returns a channel that receives a signal after the graph
+// changes. Signals are coalesced, so a slow reader sees at most one pending
+// notification and should call ChangesSince to catch up. The returned func
+// unsubscribes.
+func (g *TransferGraph) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	g.subMu.Lock()
+	if g.subscribers == nil {
+		g.subscribers = make(map[chan struct{}]struct{})
+	}
+	g.subscribers[ch] = struct{}{}
+	g.subMu.Unlock()
+
+	return ch, func() {
+		g.subMu.Lock()
+		delete(g.subscribers, ch)
+		g.subMu.Unlock()
+	}
+}
+
+// notify wakes all subscribers without blocking.
+func (g *TransferGraph) notify() {
+	g.subMu.Lock()
+	defer g.subMu.Unlock()
+	for ch := range g.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ChangesSince returns graph changes after the given version.
+func (e *GraphEngine) ChangesSince(since uint64) GraphDelta {
+	return e.graph.ChangesSince(since)
+}
+
+// Subscribe registers for graph change notifications.
+func (e *GraphEngine) Subscribe() (<-chan struct{}, func()) {
+	return e.graph.Subscribe()
+}
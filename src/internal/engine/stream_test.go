@@ -0,0 +1,33 @@
+package engine
+
+import "testing"
+
+func TestChangesSince(t *testing.T) {
+	e := NewGraphEngine(nil)
+	updates, unsubscribe := e.Subscribe()
+	defer unsubscribe()
+
+	e.AddFlow(serviceFlow("api", "db", 100))
+	v1 := e.ChangesSince(0).Version
+	select {
+	case <-updates:
+	default:
+		t.Error("no notification after AddFlow")
+	}
+
+	e.AddFlow(serviceFlow("api", "cache", 100))
+	delta := e.ChangesSince(v1)
+	if delta.Full || len(delta.Edges) != 1 || delta.Edges[0].Target != "shop/cache" {
+		t.Errorf("changes since %d = full %v edges %+v, want only the cache edge", v1, delta.Full, delta.Edges)
+	}
+	if len(delta.Nodes) != 2 {
+		t.Errorf("changes since %d have %d nodes, want api and cache", v1, len(delta.Nodes))
+	}
+
+	if delta := e.ChangesSince(delta.Version); delta.Full || len(delta.Nodes)+len(delta.Edges) != 0 {
+		t.Errorf("changes since the current version = %+v, want none", delta)
+	}
+	if delta := e.ChangesSince(delta.Version + 100); !delta.Full || len(delta.Edges) != 2 {
+		t.Errorf("changes since a future version = full %v, %d edges; want a full snapshot", delta.Full, len(delta.Edges))
+	}
+}
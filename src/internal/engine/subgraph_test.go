@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestServiceGraphTruncatedOnDenseGraph(t *testing.T) {
+	g := NewGraphEngine(nil)
+	// Every service talks to the hub and the hub to every service
+	for i := 0; i < MaxSubgraphNodes+100; i++ {
+		svc := fmt.Sprintf("svc-%d", i)
+		g.AddFlow(serviceFlow("hub", svc, 100))
+		g.AddFlow(serviceFlow(svc, "hub", 100))
+	}
+
+	sub := g.GetGraph().GetServiceGraph("shop/hub", 2)
+	if len(sub.nodes) != MaxSubgraphNodes {
+		t.Errorf("subgraph has %d nodes, want the %d cap", len(sub.nodes), MaxSubgraphNodes)
+	}
+	if _, ok := sub.nodes["shop/hub"]; !ok {
+		t.Error("subgraph lost its root")
+	}
+	if out := sub.ToJSON(); !out.Truncated || len(out.Nodes) != MaxSubgraphNodes {
+		t.Errorf("JSON truncated=%v with %d nodes, want truncated at the cap", out.Truncated, len(out.Nodes))
+	}
+
+	small := g.GetGraph().GetServiceGraph("shop/svc-1", 0)
+	if len(small.nodes) != 1 || small.ToJSON().Truncated {
+		t.Errorf("depth 0 subgraph has %d nodes, truncated=%v; want just the root", len(small.nodes), small.truncated)
+	}
+}
+
+func TestServiceGraphDepthCapped(t *testing.T) {
+	g := NewGraphEngine(nil)
+	for i := 0; i < MaxSubgraphDepth+5; i++ {
+		g.AddFlow(serviceFlow(fmt.Sprintf("hop-%d", i), fmt.Sprintf("hop-%d", i+1), 100))
+	}
+
+	sub := g.GetGraph().GetServiceGraph("shop/hop-0", 1000)
+	if len(sub.nodes) != MaxSubgraphDepth+1 {
+		t.Errorf("subgraph has %d nodes, want the root plus %d hops", len(sub.nodes), MaxSubgraphDepth)
+	}
+	if _, ok := sub.nodes[fmt.Sprintf("shop/hop-%d", MaxSubgraphDepth+1)]; ok {
+		t.Error("walk went past the depth cap")
+	}
+	if sub.truncated {
+		t.Error("a depth cap is not a node-count truncation")
+	}
+}
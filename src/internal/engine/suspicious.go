@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// SuspiciousIPPattern matches internet destinations reached by bare IP,
+// with no hostname or cloud service.
+const SuspiciousIPPattern = "ip"
+
+// SuspiciousLabel tags anomalies raised for suspicious destinations with
+// the pattern that matched.
+const SuspiciousLabel = "suspicious"
+
+// DefaultSuspiciousPatterns flag dynamic-DNS and tunnelling hosts as medium
+// and TLDs common in abuse as info. Bare IPs are not flagged by default;
+// many workloads reach IP-only endpoints legitimately.
+var DefaultSuspiciousPatterns = []string{
+	"*.duckdns.org=medium", "*.no-ip.com=medium", "*.ddns.net=medium", "*.dyndns.org=medium",
+	"*.hopto.org=medium", "*.zapto.org=medium", "*.ngrok.io=medium", "*.ngrok-free.app=medium",
+	"*.tk=info", "*.ml=info", "*.ga=info", "*.cf=info", "*.gq=info", "*.top=info", "*.zip=info", "*.mov=info",
+}
+
+// SuspiciousPattern flags egress destinations for security review.
+type SuspiciousPattern struct {
+	Pattern  string         // "*.domain", a hostname, or SuspiciousIPPattern
+	Severity types.Severity // Severity of the anomaly raised on a match
+}
+
+// matches reports whether an external endpoint is covered.
+func (p SuspiciousPattern) matches(endpoint *types.Endpoint) bool {
+	host := strings.ToLower(strings.TrimSuffix(endpoint.Hostname, "."))
+	if p.Pattern == SuspiciousIPPattern {
+		return host == "" && endpoint.CloudServiceName == "" && endpoint.IsInternet
+	}
+	if suffix, ok := strings.CutPrefix(p.Pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix)
+	}
+	return host != "" && host == p.Pattern
+}
+
+// ParseSuspiciousPattern parses "pattern" or "pattern=severity". The
+// severity is info or medium, defaulting to medium.
+func ParseSuspiciousPattern(s string) (SuspiciousPattern, error) {
+	pattern, severity, _ := strings.Cut(s, "=")
+	p := SuspiciousPattern{
+		Pattern:  strings.ToLower(strings.TrimSpace(pattern)),
+		Severity: types.Severity(strings.TrimSpace(severity)),
+	}
+	switch {
+	case p.Pattern == "":
+		return p, fmt.Errorf("suspicious pattern %q: pattern is required", s)
+	case strings.HasPrefix(p.Pattern, "*") && !strings.HasPrefix(p.Pattern, "*."):
+		return p, fmt.Errorf("suspicious pattern %q: wildcards must start with \"*.\"", s)
+	}
+	switch p.Severity {
+	case "":
+		p.Severity = types.SeverityMedium
+	case types.SeverityInfo, types.SeverityMedium:
+	default:
+		return p, fmt.Errorf("suspicious pattern %q: severity must be info or medium", s)
+	}
+	return p, nil
+}
+
+// SetSuspiciousPatterns replaces the patterns RecordSuspiciousTransfer
+// checks. No patterns disables the check.
+func (e *BaselineEngine) SetSuspiciousPatterns(patterns []SuspiciousPattern) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.suspicious = append([]SuspiciousPattern(nil), patterns...)
+}
+
+// RecordSuspiciousTransfer checks a flow's external destination against
+// the suspicious patterns. It returns a new-endpoint anomaly, labelled with
+// the matching pattern, the first time a source service sends to a
+// matching destination, and nil otherwise. Trusted destinations never
+// match.
+func (e *BaselineEngine) RecordSuspiciousTransfer(flow types.TransferFlow) *types.Anomaly {
+	endpoint := flow.DestinationEndpoint
+	if endpoint == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.suspicious) == 0 {
+		return nil
+	}
+
+	dest := strings.ToLower(strings.TrimSuffix(endpoint.Hostname, "."))
+	if dest == "" {
+		dest = endpoint.IP
+	}
+	if e.isTrusted(dest) {
+		return nil
+	}
+	var match *SuspiciousPattern
+	for i := range e.suspicious {
+		if e.suspicious[i].matches(endpoint) {
+			match = &e.suspicious[i]
+			break
+		}
+	}
+	if match == nil {
+		return nil
+	}
+
+	source := flow.SourceIdentity.FullName()
+	key := types.JoinFlowKey(source, dest)
+	if e.suspiciousSeen == nil {
+		e.suspiciousSeen = make(map[string]bool)
+	}
+	if e.suspiciousSeen[key] {
+		return nil
+	}
+	e.suspiciousSeen[key] = true
+
+	log.Info().
+		Str("source", source).
+		Str("destination", dest).
+		Str("pattern", match.Pattern).
+		Msg("Egress to suspicious destination")
+
+	now := time.Now()
+	causes, actions := inferCauses(types.AnomalyTypeNewEndpoint, dest, now)
+	causes = append(causes, "Destination matches suspicious pattern "+match.Pattern)
+	actions = append(actions, "Confirm "+source+" is expected to reach "+dest)
+
+	return &types.Anomaly{
+		ID:                  uuid.New(),
+		Type:                types.AnomalyTypeNewEndpoint,
+		Severity:            match.Severity,
+		SourceService:       source,
+		DestinationEndpoint: dest,
+		DetectedAt:          now,
+		CurrentValue:        float64(flow.TotalBytes),
+		AbsoluteDelta:       float64(flow.TotalBytes),
+		PotentialCauses:     causes,
+		SuggestedActions:    actions,
+		Labels:              map[string]string{SuspiciousLabel: match.Pattern},
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func egressTo(endpoint types.Endpoint) types.TransferFlow {
+	now := time.Now()
+	endpoint.IsInternet = true
+	return types.TransferFlow{
+		SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: "api"},
+		DestinationEndpoint: &endpoint,
+		Type:                types.TransferTypeEgress,
+		TotalBytes:          4096,
+		WindowStart:         now.Add(-time.Minute),
+		WindowEnd:           now,
+	}
+}
+
+func newSuspiciousEngine(t *testing.T, specs ...string) *BaselineEngine {
+	t.Helper()
+	patterns := make([]SuspiciousPattern, 0, len(specs))
+	for _, s := range specs {
+		p, err := ParseSuspiciousPattern(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, p)
+	}
+	e := NewBaselineEngine(3)
+	e.SetSuspiciousPatterns(patterns)
+	return e
+}
+
+func TestSuspiciousDestinationFlagged(t *testing.T) {
+	e := newSuspiciousEngine(t, DefaultSuspiciousPatterns...)
+
+	a := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "203.0.113.10", Hostname: "C2.DuckDNS.org."}))
+	if a == nil {
+		t.Fatal("dynamic-DNS host not flagged")
+	}
+	if a.Type != types.AnomalyTypeNewEndpoint || a.Severity != types.SeverityMedium {
+		t.Errorf("anomaly = %s/%s, want new_endpoint/medium", a.Type, a.Severity)
+	}
+	if a.SourceService != "shop/api" || a.DestinationEndpoint != "c2.duckdns.org" || a.Labels[SuspiciousLabel] != "*.duckdns.org" {
+		t.Errorf("anomaly %s -> %s labelled %v", a.SourceService, a.DestinationEndpoint, a.Labels)
+	}
+
+	if again := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "203.0.113.10", Hostname: "c2.duckdns.org"})); again != nil {
+		t.Error("repeat transfer flagged again")
+	}
+	if a := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "203.0.113.11", Hostname: "promo.tk"})); a == nil || a.Severity != types.SeverityInfo {
+		t.Errorf("abused TLD = %v, want an info anomaly", a)
+	}
+	for _, endpoint := range []types.Endpoint{
+		{IP: "198.51.100.5", Hostname: "api.stripe.com"},
+		{IP: "198.51.100.6", Hostname: "duckdns.org.example.com"},
+		{IP: "198.51.100.7"}, // Bare IPs are not flagged by default
+	} {
+		if a := e.RecordSuspiciousTransfer(egressTo(endpoint)); a != nil {
+			t.Errorf("%+v flagged as %s", endpoint, a.Labels[SuspiciousLabel])
+		}
+	}
+}
+
+func TestSuspiciousBareIP(t *testing.T) {
+	e := newSuspiciousEngine(t, "ip=info")
+
+	if a := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "198.51.100.7"})); a == nil || a.DestinationEndpoint != "198.51.100.7" {
+		t.Errorf("bare IP = %v, want flagged", a)
+	}
+	if a := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "198.51.100.8", CloudServiceName: "s3"})); a != nil {
+		t.Error("cloud service flagged as a bare IP")
+	}
+}
+
+func TestSuspiciousTrustedNotFlagged(t *testing.T) {
+	e := newSuspiciousEngine(t, DefaultSuspiciousPatterns...)
+	if _, err := e.AddTrustedDestination(types.TrustedDestination{Destination: "*.ngrok.io"}); err != nil {
+		t.Fatal(err)
+	}
+	if a := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "203.0.113.10", Hostname: "demo.ngrok.io"})); a != nil {
+		t.Error("trusted destination flagged")
+	}
+}
+
+func TestSuspiciousDisabledWithoutPatterns(t *testing.T) {
+	e := NewBaselineEngine(3)
+	if a := e.RecordSuspiciousTransfer(egressTo(types.Endpoint{IP: "203.0.113.10", Hostname: "c2.duckdns.org"})); a != nil {
+		t.Error("flagged with no patterns configured")
+	}
+}
+
+func TestParseSuspiciousPattern(t *testing.T) {
+	p, err := ParseSuspiciousPattern(" *.Example.TK ")
+	if err != nil || p.Pattern != "*.example.tk" || p.Severity != types.SeverityMedium {
+		t.Errorf("pattern = %+v, %v", p, err)
+	}
+	for _, s := range []string{"", "=info", "*example.tk", "*.example.tk=high", "ip=critical"} {
+		if _, err := ParseSuspiciousPattern(s); err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
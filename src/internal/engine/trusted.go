@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// trustedDestination is a validated trusted destination with its parsed
+// network, if it is an IP or CIDR.
+type trustedDestination struct {
+	types.TrustedDestination
+	network *net.IPNet
+}
+
+// matches reports whether dst, a hostname or IP, is covered.
+func (t trustedDestination) matches(dst string) bool {
+	if t.network != nil {
+		ip := net.ParseIP(dst)
+		return ip != nil && t.network.Contains(ip)
+	}
+	dst = strings.ToLower(dst)
+	if suffix, ok := strings.CutPrefix(t.Destination, "*"); ok {
+		return strings.HasSuffix(dst, suffix)
+	}
+	return dst == t.Destination
+}
+
+// AddTrustedDestination registers or replaces a trusted destination.
+func (e *BaselineEngine) AddTrustedDestination(t types.TrustedDestination) (types.TrustedDestination, error) {
+	t.Destination = strings.ToLower(strings.TrimSpace(t.Destination))
+	if t.Destination == "" {
+		return t, errors.New("destination is required")
+	}
+	t.CreatedAt = time.Now()
+
+	td := trustedDestination{TrustedDestination: t}
+	if _, network, err := net.ParseCIDR(t.Destination); err == nil {
+		td.network = network
+	} else if ip := net.ParseIP(t.Destination); ip != nil {
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		td.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	} else if strings.HasPrefix(t.Destination, "*") && !strings.HasPrefix(t.Destination, "*.") {
+		return t, errors.New("wildcard destinations must start with \"*.\"")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.trusted {
+		if e.trusted[i].Destination == t.Destination {
+			e.trusted[i] = td
+			return t, nil
+		}
+	}
+	e.trusted = append(e.trusted, td)
+
+	log.Info().Str("destination", t.Destination).Msg("Trusted destination added")
+
+	return t, nil
+}
+
+// GetTrustedDestinations returns all trusted destinations.
+func (e *BaselineEngine) GetTrustedDestinations() []types.TrustedDestination {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]types.TrustedDestination, len(e.trusted))
+	for i, t := range e.trusted {
+		out[i] = t.TrustedDestination
+	}
+	return out
+}
+
+// isTrusted reports whether a destination hostname or IP is trusted.
+// Caller must hold e.mu.
+func (e *BaselineEngine) isTrusted(dst string) bool {
+	if dst == "" {
+		return false
+	}
+	for _, t := range e.trusted {
+		if t.matches(dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// anomalyDestination returns the destination an anomaly is about.
+func anomalyDestination(a *types.Anomaly) string {
+	if a.DestinationEndpoint != "" {
+		return a.DestinationEndpoint
+	}
+	return flowDestination(a.SourceService)
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestTrustedNewDestinationRaisesNoAnomaly(t *testing.T) {
+	e := NewBaselineEngine(3)
+	for _, dst := range []string{"*.cdn.example.com", "198.51.100.0/24", "203.0.113.7"} {
+		if _, err := e.AddTrustedDestination(types.TrustedDestination{Destination: dst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	anomalies := e.DetectAnomalies(context.Background(), map[string]float64{
+		"shop/api|assets.cdn.example.com": 5000,
+		"shop/api|198.51.100.20":          5000,
+		"shop/api|203.0.113.7":            5000,
+		"shop/api|203.0.113.8":            5000,
+		"shop/api|cdn.example.com":        5000, // The wildcard covers subdomains only
+	})
+
+	flagged := make(map[string]bool)
+	for _, a := range anomalies {
+		if a.Type == types.AnomalyTypeNewEndpoint {
+			flagged[a.SourceService] = true
+		}
+	}
+	if len(flagged) != 2 || !flagged["shop/api|203.0.113.8"] || !flagged["shop/api|cdn.example.com"] {
+		t.Errorf("new endpoints flagged = %v, want only the untrusted destinations", flagged)
+	}
+}
+
+func TestTrustedDestinationDropsLeakAnomaly(t *testing.T) {
+	e := NewBaselineEngine(3)
+	if _, err := e.AddTrustedDestination(types.TrustedDestination{Destination: "Telemetry.Example.com "}); err != nil {
+		t.Fatal(err)
+	}
+
+	e.AddAnomaly(&types.Anomaly{ID: uuid.New(), Type: types.AnomalyTypeLeak, DestinationEndpoint: "telemetry.example.com"})
+	e.AddAnomaly(&types.Anomaly{ID: uuid.New(), Type: types.AnomalyTypeSpike, DestinationEndpoint: "telemetry.example.com"})
+	e.AddAnomaly(&types.Anomaly{ID: uuid.New(), Type: types.AnomalyTypeLeak, SourceService: "shop/api|paste.example.org"})
+
+	active := e.GetActiveAnomalies()
+	if len(active) != 2 {
+		t.Fatalf("active = %+v, want the spike and the untrusted leak", active)
+	}
+	for _, a := range active {
+		if a.Type == types.AnomalyTypeLeak && a.DestinationEndpoint == "telemetry.example.com" {
+			t.Error("leak to a trusted destination was kept")
+		}
+	}
+}
+
+func TestAddTrustedDestinationValidation(t *testing.T) {
+	e := NewBaselineEngine(3)
+	for _, dst := range []string{"", "  ", "*example.com"} {
+		if _, err := e.AddTrustedDestination(types.TrustedDestination{Destination: dst}); err == nil {
+			t.Errorf("%q accepted", dst)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := e.AddTrustedDestination(types.TrustedDestination{Destination: "cdn.example.com", Description: "own CDN"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := e.GetTrustedDestinations(); len(got) != 1 || got[0].Description != "own CDN" {
+		t.Errorf("trusted = %+v, want one entry after re-adding", got)
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// AddWatchlistEntry registers or replaces a watched destination.
+func (e *CostEngine) AddWatchlistEntry(w types.WatchlistEntry) (types.WatchlistEntry, error) {
+	w.Destination = strings.ToLower(strings.TrimSpace(w.Destination))
+	if w.Destination == "" {
+		return w, errors.New("destination is required")
+	}
+	w.CreatedAt = time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.watchlist[w.Destination] = w
+
+	log.Info().Str("destination", w.Destination).Msg("Destination added to watchlist")
+
+	return w, nil
+}
+
+// GetWatchlist returns all watched destinations.
+func (e *CostEngine) GetWatchlist() []types.WatchlistEntry {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	entries := make([]types.WatchlistEntry, 0, len(e.watchlist))
+	for _, w := range e.watchlist {
+		entries = append(entries, w)
+	}
+	return entries
+}
+
+// RecordWatchedTransfer checks a flow against the watchlist. It returns an
+// info anomaly the first time a source service sends to a watched
+// destination, matched by hostname or cloud service name, and nil otherwise.
+// A flow that ended before the destination was watched, such as one loaded
+// from storage, marks its source as a known consumer without alerting.
+func (e *CostEngine) RecordWatchedTransfer(flow types.TransferFlow) *types.Anomaly {
+	if flow.DestinationEndpoint == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.watchlist) == 0 {
+		return nil
+	}
+
+	var (
+		dest  string
+		entry types.WatchlistEntry
+	)
+	for _, candidate := range []string{
+		flow.DestinationEndpoint.Hostname,
+		flow.DestinationEndpoint.CloudServiceName,
+	} {
+		candidate = strings.ToLower(candidate)
+		if w, ok := e.watchlist[candidate]; ok && candidate != "" {
+			dest, entry = candidate, w
+			break
+		}
+	}
+	if dest == "" {
+		return nil
+	}
+
+	source := flow.SourceIdentity.FullName()
+	seen, ok := e.consumers[dest]
+	if !ok {
+		seen = make(map[string]bool)
+		e.consumers[dest] = seen
+	}
+	if seen[source] {
+		return nil
+	}
+	seen[source] = true
+	if !flow.WindowEnd.IsZero() && flow.WindowEnd.Before(entry.CreatedAt) {
+		return nil
+	}
+
+	now := time.Now()
+	causes, actions := inferCauses(types.AnomalyTypeNewEndpoint, dest, now)
+	actions = append(actions, "Confirm "+source+" is expected to use "+dest)
+
+	return &types.Anomaly{
+		ID:                  uuid.New(),
+		Type:                types.AnomalyTypeNewEndpoint,
+		Severity:            types.SeverityInfo,
+		SourceService:       source,
+		DestinationEndpoint: dest,
+		DetectedAt:          now,
+		CurrentValue:        float64(flow.TotalBytes),
+		AbsoluteDelta:       float64(flow.TotalBytes),
+		PotentialCauses:     causes,
+		SuggestedActions:    actions,
+		Labels:              map[string]string{"watchlist": dest},
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestWatchlistMatchesCloudService(t *testing.T) {
+	e := NewCostEngine()
+	if _, err := e.AddWatchlistEntry(types.WatchlistEntry{Destination: " DynamoDB "}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := e.GetWatchlist(); len(entries) != 1 || entries[0].Destination != "dynamodb" {
+		t.Errorf("watchlist = %+v, want dynamodb normalised", entries)
+	}
+
+	flow := func(source, service string) types.TransferFlow {
+		return types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: source},
+			DestinationEndpoint: &types.Endpoint{CloudServiceName: service},
+			TotalBytes:          100,
+		}
+	}
+	if a := e.RecordWatchedTransfer(flow("orders", "dynamodb")); a == nil || a.Labels["watchlist"] != "dynamodb" {
+		t.Errorf("first consumer: %+v, want a watchlist alert", a)
+	}
+	if a := e.RecordWatchedTransfer(flow("orders", "dynamodb")); a != nil {
+		t.Error("alerted twice for the same consumer")
+	}
+	if a := e.RecordWatchedTransfer(flow("orders", "s3")); a != nil {
+		t.Error("alerted for a destination not on the watchlist")
+	}
+	if a := e.RecordWatchedTransfer(types.TransferFlow{SourceIdentity: types.ServiceIdentity{Name: "orders"}}); a != nil {
+		t.Error("alerted for a flow without a destination")
+	}
+
+	if _, err := e.AddWatchlistEntry(types.WatchlistEntry{Destination: "  "}); err == nil {
+		t.Error("empty destination accepted")
+	}
+}
+
+func TestWatchlistLearnsConsumersFromEarlierFlows(t *testing.T) {
+	e := NewCostEngine()
+	if _, err := e.AddWatchlistEntry(types.WatchlistEntry{Destination: "api.openai.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	flow := func(source string, end time.Time) types.TransferFlow {
+		return types.TransferFlow{
+			SourceIdentity:      types.ServiceIdentity{Namespace: "shop", Name: source},
+			DestinationEndpoint: &types.Endpoint{Hostname: "api.openai.com"},
+			TotalBytes:          100,
+			WindowEnd:           end,
+		}
+	}
+	if a := e.RecordWatchedTransfer(flow("search", time.Now().Add(-time.Hour))); a != nil {
+		t.Errorf("alerted for a consumer from before the watch: %+v", a)
+	}
+	if a := e.RecordWatchedTransfer(flow("search", time.Now().Add(time.Minute))); a != nil {
+		t.Error("a known consumer was reported as new")
+	}
+	if a := e.RecordWatchedTransfer(flow("chat", time.Now().Add(time.Minute))); a == nil {
+		t.Error("no alert for a consumer new since the watch")
+	}
+}
@@ -0,0 +1,80 @@
+// Package queue provides bounded event channels with configurable
+// behaviour when they fill up.
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+// OverflowPolicy selects what happens when an event channel is full.
+type OverflowPolicy string
+
+const (
+	// DropNewest discards the event being offered.
+	DropNewest OverflowPolicy = "drop-newest"
+	// DropOldest discards the oldest buffered event to make room.
+	DropOldest OverflowPolicy = "drop-oldest"
+	// Block waits up to the configured timeout for room, then discards the
+	// event being offered.
+	Block OverflowPolicy = "block"
+)
+
+// DefaultBlockTimeout is used by the block policy when no timeout is set.
+const DefaultBlockTimeout = time.Second
+
+// ParseOverflowPolicy validates a policy name. An empty name selects
+// DropNewest.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case "":
+		return DropNewest, nil
+	case DropNewest, DropOldest, Block:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid overflow policy %q: must be %s, %s or %s", s, DropNewest, DropOldest, Block)
+}
+
+// Offer sends v on ch, applying policy if ch is full. It reports whether v
+// was queued and how many older events were evicted to make room.
+func Offer[T any](ch chan T, v T, policy OverflowPolicy, timeout time.Duration) (queued bool, evicted int) {
+	select {
+	case ch <- v:
+		return true, 0
+	default:
+	}
+
+	switch policy {
+	case DropOldest:
+		// Consumers and other producers may race us for the slot, so retry
+		// a few times before giving up on the new event.
+		for i := 0; i < 3; i++ {
+			select {
+			case <-ch:
+				evicted++
+			default:
+			}
+			select {
+			case ch <- v:
+				return true, evicted
+			default:
+			}
+		}
+		return false, evicted
+
+	case Block:
+		if timeout <= 0 {
+			timeout = DefaultBlockTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case ch <- v:
+			return true, 0
+		case <-timer.C:
+			return false, 0
+		}
+	}
+
+	return false, 0
+}
@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+// fullChan returns a channel of capacity n filled with 1..n.
+func fullChan(n int) chan int {
+	ch := make(chan int, n)
+	for i := 1; i <= n; i++ {
+		ch <- i
+	}
+	return ch
+}
+
+func drainAll(ch chan int) []int {
+	var out []int
+	for len(ch) > 0 {
+		out = append(out, <-ch)
+	}
+	return out
+}
+
+func TestOfferDropNewest(t *testing.T) {
+	ch := fullChan(3)
+	queued, evicted := Offer(ch, 4, DropNewest, 0)
+	if queued || evicted != 0 {
+		t.Errorf("queued %v evicted %d, want the new event dropped", queued, evicted)
+	}
+	if got := drainAll(ch); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("channel = %v, want 1..3 untouched", got)
+	}
+}
+
+func TestOfferDropOldest(t *testing.T) {
+	ch := fullChan(3)
+	queued, evicted := Offer(ch, 4, DropOldest, 0)
+	if !queued || evicted != 1 {
+		t.Errorf("queued %v evicted %d, want the new event queued over one eviction", queued, evicted)
+	}
+	if got := drainAll(ch); len(got) != 3 || got[0] != 2 || got[2] != 4 {
+		t.Errorf("channel = %v, want 2..4", got)
+	}
+}
+
+func TestOfferBlockTimesOut(t *testing.T) {
+	ch := fullChan(3)
+	start := time.Now()
+	queued, evicted := Offer(ch, 4, Block, 20*time.Millisecond)
+	if queued || evicted != 0 {
+		t.Errorf("queued %v evicted %d, want the new event dropped after the timeout", queued, evicted)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("returned after %v, want a wait of the timeout", waited)
+	}
+}
+
+func TestOfferBlockQueuesWhenRoomFrees(t *testing.T) {
+	ch := fullChan(3)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	queued, _ := Offer(ch, 4, Block, time.Second)
+	if !queued {
+		t.Fatal("event dropped although a consumer freed room before the timeout")
+	}
+	if got := drainAll(ch); len(got) != 3 || got[2] != 4 {
+		t.Errorf("channel = %v, want the new event last", got)
+	}
+}
+
+func TestOfferWithRoom(t *testing.T) {
+	for _, policy := range []OverflowPolicy{DropNewest, DropOldest, Block} {
+		ch := make(chan int, 1)
+		if queued, evicted := Offer(ch, 1, policy, time.Nanosecond); !queued || evicted != 0 {
+			t.Errorf("%s: queued %v evicted %d on an empty channel", policy, queued, evicted)
+		}
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for in, want := range map[string]OverflowPolicy{
+		"":            DropNewest,
+		"drop-newest": DropNewest,
+		"drop-oldest": DropOldest,
+		"block":       Block,
+	} {
+		got, err := ParseOverflowPolicy(in)
+		if err != nil || got != want {
+			t.Errorf("ParseOverflowPolicy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseOverflowPolicy("drop-all"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AggregationDimensions are the optional columns the hourly aggregates can
+// be grouped by on top of source, destination and transfer type, in the
+// order they appear in the hourly table. http_path and grpc_method can have
+// high cardinality; enable them only for services with bounded routes.
+var AggregationDimensions = []string{"dst_cloud_service", "http_path", "grpc_method"}
+
+// ParseAggregationDimensions validates dimension names and returns them
+// deduplicated in AggregationDimensions order.
+func ParseAggregationDimensions(names []string) ([]string, error) {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, d := range AggregationDimensions {
+			known = known || d == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown aggregation dimension %q (known: %s)",
+				name, strings.Join(AggregationDimensions, ", "))
+		}
+		selected[name] = true
+	}
+
+	var dims []string
+	for _, d := range AggregationDimensions {
+		if selected[d] {
+			dims = append(dims, d)
+		}
+	}
+	return dims, nil
+}
+
+// hourlyViewSQL builds a materialized view folding events from source into
+// transfer_flows_hourly, grouped by the given dimensions. Dimensions not
+// selected are written empty so their rows merge as before.
+func hourlyViewSQL(view, source string, dims []string) string {
+	selected := make(map[string]bool, len(dims))
+	for _, d := range dims {
+		selected[d] = true
+	}
+
+	var columns, groupBy strings.Builder
+	for _, d := range AggregationDimensions {
+		if selected[d] {
+			fmt.Fprintf(&columns, "\t\t\t\t%s,\n", d)
+		} else {
+			fmt.Fprintf(&columns, "\t\t\t\t'' AS %s,\n", d)
+		}
+		fmt.Fprintf(&groupBy, ", %s", d)
+	}
+
+	return fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+%s				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				max(src_cloud_provider) AS src_cloud_provider_hint,
+				max(dst_well_known_service) AS dst_well_known_service_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM %s
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type%s`,
+		view, columns.String(), source, groupBy.String())
+}
+
+// AggregationDDL returns the statements rebuilding both hourly views to
+// group by dims. Views cannot be altered in place, and creating the new
+// view under another name before dropping the old one would fold every
+// event inserted in between into the aggregates twice. Instead each view is
+// dropped right before it is recreated: events inserted in that gap miss
+// the hourly aggregates, so collectors should be stopped while regrouping.
+func AggregationDDL(dims []string) []string {
+	return []string{
+		`DROP VIEW IF EXISTS transfer_flows_hourly_mv`,
+		hourlyViewSQL("transfer_flows_hourly_mv", "transfer_events", dims),
+		`DROP VIEW IF EXISTS transfer_flows_hourly_unretained_mv`,
+		hourlyViewSQL("transfer_flows_hourly_unretained_mv", "transfer_events_unretained", dims),
+	}
+}
+
+// SetAggregationDimensions rebuilds the hourly views to group by dims.
+// Existing aggregates keep the grouping they were written with.
+func (s *ClickHouseStore) SetAggregationDimensions(ctx context.Context, dims []string) error {
+	for _, stmt := range AggregationDDL(dims) {
+		if err := s.conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("rebuilding hourly views: %w", err)
+		}
+	}
+	return nil
+}
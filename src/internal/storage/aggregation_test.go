@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHourlyViewSQLIncludesDimensions(t *testing.T) {
+	sql := hourlyViewSQL("transfer_flows_hourly_mv", "transfer_events", []string{"dst_cloud_service", "http_path"})
+
+	for _, want := range []string{
+		"\tdst_cloud_service,\n",
+		"\thttp_path,\n",
+		"'' AS grpc_method",
+		"max(dst_hostname) AS dst_hostname_hint",
+		"max(dst_cloud_service) AS dst_cloud_service_hint",
+		"max(src_cloud_provider) AS src_cloud_provider_hint",
+		"max(dst_well_known_service) AS dst_well_known_service_hint",
+		"FROM transfer_events\n",
+		"GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("view SQL missing %q:\n%s", want, sql)
+		}
+	}
+	for _, unwanted := range []string{"'' AS dst_cloud_service", "'' AS http_path"} {
+		if strings.Contains(sql, unwanted) {
+			t.Errorf("view SQL blanks a configured dimension: %q", unwanted)
+		}
+	}
+
+	// Without dimensions every optional column is written empty
+	sql = hourlyViewSQL("transfer_flows_hourly_mv", "transfer_events", nil)
+	for _, d := range AggregationDimensions {
+		if !strings.Contains(sql, "'' AS "+d) {
+			t.Errorf("default view SQL does not blank %s", d)
+		}
+	}
+}
+
+func TestParseAggregationDimensions(t *testing.T) {
+	dims, err := ParseAggregationDimensions([]string{" grpc_method", "dst_cloud_service", "", "grpc_method"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dst_cloud_service", "grpc_method"}; !reflect.DeepEqual(dims, want) {
+		t.Errorf("dims = %v, want %v", dims, want)
+	}
+	if _, err := ParseAggregationDimensions([]string{"dst_ip"}); err == nil {
+		t.Error("unknown dimension accepted")
+	}
+}
+
+func TestSetAggregationDimensionsRebuildsViews(t *testing.T) {
+	store, conn := newFakeStore()
+	if err := store.SetAggregationDimensions(context.Background(), []string{"http_path"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conn.execs) != 4 {
+		t.Fatalf("ran %d statements, want a drop and create for each view", len(conn.execs))
+	}
+	for i, view := range []string{"transfer_flows_hourly_mv", "transfer_flows_hourly_unretained_mv"} {
+		drop, create := conn.execs[2*i].sql, conn.execs[2*i+1].sql
+		if drop != "DROP VIEW IF EXISTS "+view {
+			t.Errorf("statement %d = %q, want the drop of %s", 2*i, drop, view)
+		}
+		if !strings.Contains(create, "VIEW IF NOT EXISTS "+view+"\n") || !strings.Contains(create, "\thttp_path,\n") {
+			t.Errorf("statement %d does not create %s grouped by http_path:\n%s", 2*i+1, view, create)
+		}
+	}
+}
+
+func TestMigrateRegroupsViews(t *testing.T) {
+	store, conn := newFakeStore([]any{LatestSchemaVersion()})
+	opts := MigrateOptions{RegroupViews: true, AggregationDimensions: []string{"http_path"}}
+	if _, err := store.Migrate(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conn.execs) < 4 {
+		t.Fatalf("ran %d statements, want the views rebuilt", len(conn.execs))
+	}
+	last := conn.execs[len(conn.execs)-1].sql
+	if !strings.Contains(last, "VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv\n") || !strings.Contains(last, "\thttp_path,\n") {
+		t.Errorf("migrate does not end by regrouping the views:\n%s", last)
+	}
+
+	store, conn = newFakeStore([]any{LatestSchemaVersion()})
+	if _, err := store.Migrate(context.Background(), MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, exec := range conn.execs {
+		if strings.HasPrefix(exec.sql, "DROP VIEW") {
+			t.Errorf("migrate without RegroupViews dropped a view: %s", exec.sql)
+		}
+	}
+}
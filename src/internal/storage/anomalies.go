@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// AnomalyFilter narrows an anomaly history query. Empty fields match all.
+type AnomalyFilter struct {
+	Severity      types.Severity
+	Type          types.AnomalyType
+	SourceService string
+	Limit         int
+}
+
+// InsertAnomaly stores a newly detected anomaly.
+func (s *ClickHouseStore) InsertAnomaly(ctx context.Context, a types.Anomaly) error {
+	if err := s.writeAnomaly(ctx, a); err != nil {
+		return fmt.Errorf("inserting anomaly: %w", err)
+	}
+	return nil
+}
+
+// UpdateAnomaly stores a new version of an anomaly, such as after it is
+// acknowledged, escalated or resolved. The anomalies table keeps the
+// version with the latest updated_at.
+func (s *ClickHouseStore) UpdateAnomaly(ctx context.Context, a types.Anomaly) error {
+	if err := s.writeAnomaly(ctx, a); err != nil {
+		return fmt.Errorf("updating anomaly: %w", err)
+	}
+	return nil
+}
+
+// writeAnomaly inserts a row holding every column of an anomaly, versioned
+// by its UpdatedAt.
+func (s *ClickHouseStore) writeAnomaly(ctx context.Context, a types.Anomaly) error {
+	now := time.Now()
+	createdAt, updatedAt := a.CreatedAt, a.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	if updatedAt.IsZero() {
+		updatedAt = now
+	}
+
+	return s.conn.Exec(ctx, `
+		INSERT INTO anomalies (
+			id, type, severity, src_service, dst_service, dst_endpoint, flow_key,
+			detected_at, started_at, ended_at,
+			current_value, baseline_value, deviation, absolute_delta,
+			estimated_cost_impact_usd, estimated_monthly_impact_usd,
+			acknowledged, resolved, ai_summary, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, string(a.Type), string(a.Severity), a.SourceService, a.DestinationService, a.DestinationEndpoint, a.FlowKey,
+		a.DetectedAt, a.StartedAt, a.EndedAt,
+		a.CurrentValue, a.BaselineValue, a.Deviation, a.AbsoluteDelta,
+		a.EstimatedCostImpactUSD, a.EstimatedMonthlyImpactUSD,
+		boolToUInt8(a.Acknowledged), boolToUInt8(a.Resolved), a.AISummary, createdAt, updatedAt,
+	)
+}
+
+// QueryAnomalies returns the latest version of stored anomalies detected
+// in [start, end), newest first.
+func (s *ClickHouseStore) QueryAnomalies(ctx context.Context, start, end time.Time, filter AnomalyFilter) ([]types.Anomaly, error) {
+	where := "detected_at >= ? AND detected_at < ?"
+	args := []interface{}{start, end}
+	if filter.Severity != "" {
+		where += " AND severity = ?"
+		args = append(args, string(filter.Severity))
+	}
+	if filter.Type != "" {
+		where += " AND type = ?"
+		args = append(args, string(filter.Type))
+	}
+	if filter.SourceService != "" {
+		where += " AND src_service = ?"
+		args = append(args, filter.SourceService)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT
+			id, type, severity, src_service, dst_service, dst_endpoint, flow_key,
+			detected_at, started_at, ended_at,
+			current_value, baseline_value, deviation, absolute_delta,
+			estimated_cost_impact_usd, estimated_monthly_impact_usd,
+			acknowledged, resolved, ai_summary, created_at, updated_at
+		FROM anomalies FINAL
+		WHERE %s
+		ORDER BY detected_at DESC
+		LIMIT %d
+	`, where, limit)
+
+	rows, err := s.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	var anomalies []types.Anomaly
+	for rows.Next() {
+		var (
+			a                      types.Anomaly
+			kind, severity         string
+			acknowledged, resolved uint8
+		)
+		if err := rows.Scan(
+			&a.ID, &kind, &severity, &a.SourceService, &a.DestinationService, &a.DestinationEndpoint, &a.FlowKey,
+			&a.DetectedAt, &a.StartedAt, &a.EndedAt,
+			&a.CurrentValue, &a.BaselineValue, &a.Deviation, &a.AbsoluteDelta,
+			&a.EstimatedCostImpactUSD, &a.EstimatedMonthlyImpactUSD,
+			&acknowledged, &resolved, &a.AISummary, &a.CreatedAt, &a.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		a.Type = types.AnomalyType(kind)
+		a.Severity = types.Severity(severity)
+		a.Acknowledged = acknowledged == 1
+		a.Resolved = resolved == 1
+		anomalies = append(anomalies, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return anomalies, nil
+}
+
+// boolToUInt8 encodes a bool for a UInt8 flag column.
+func boolToUInt8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
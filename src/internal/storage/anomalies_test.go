@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// testAnomaly returns an anomaly with every stored column set except the
+// nullable times.
+func testAnomaly(detectedAt time.Time) types.Anomaly {
+	return types.Anomaly{
+		ID:                        uuid.New(),
+		Type:                      types.AnomalyTypeSpike,
+		Severity:                  types.SeverityHigh,
+		SourceService:             "shop/api|203.0.113.10",
+		DestinationService:        "payments",
+		DestinationEndpoint:       "203.0.113.10",
+		DetectedAt:                detectedAt,
+		CurrentValue:              5000,
+		BaselineValue:             1000,
+		Deviation:                 4.5,
+		AbsoluteDelta:             4000,
+		EstimatedCostImpactUSD:    12.5,
+		EstimatedMonthlyImpactUSD: 375,
+		AISummary:                 "Backfill job",
+	}
+}
+
+func TestAnomalyRoundTrip(t *testing.T) {
+	detectedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	startedAt := detectedAt.Add(-10 * time.Minute)
+	withTimes := testAnomaly(detectedAt)
+	withTimes.StartedAt = &startedAt
+	withTimes.Acknowledged = true
+
+	for name, want := range map[string]types.Anomaly{"null times": testAnomaly(detectedAt), "set times": withTimes} {
+		want.CreatedAt = detectedAt.Add(time.Second)
+		want.UpdatedAt = detectedAt.Add(time.Minute)
+		store, conn := newFakeStore()
+		if err := store.InsertAnomaly(context.Background(), want); err != nil {
+			t.Fatal(err)
+		}
+		if len(conn.execs) != 1 || !strings.Contains(conn.execs[0].sql, "INSERT INTO anomalies") {
+			t.Fatalf("%s: statements = %v, want one insert", name, conn.execs)
+		}
+
+		// Read the inserted values back as a stored row
+		conn.rows = [][]any{conn.execs[0].args}
+		got, err := store.QueryAnomalies(context.Background(), detectedAt.Add(-time.Hour), detectedAt.Add(time.Hour), AnomalyFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("%s: read back %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestUpdateAnomalyWritesNewVersion(t *testing.T) {
+	store, conn := newFakeStore()
+	a := testAnomaly(time.Now())
+	endedAt := time.Now()
+	a.Resolved, a.EndedAt, a.UpdatedAt = true, &endedAt, endedAt
+
+	if err := store.UpdateAnomaly(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	exec := conn.execs[0]
+	if !strings.Contains(exec.sql, "INSERT INTO anomalies") {
+		t.Errorf("statement = %s, want a new row version rather than a mutation", exec.sql)
+	}
+	args := exec.args
+	if args[0] != a.ID || args[17] != uint8(1) || args[9] != &endedAt || args[len(args)-1] != endedAt {
+		t.Errorf("args = %v, want the resolved anomaly versioned at %v", args, endedAt)
+	}
+
+	if _, err := store.QueryAnomalies(context.Background(), endedAt.Add(-time.Hour), endedAt, AnomalyFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if q := conn.lastQuery(); !strings.Contains(q.sql, "FROM anomalies FINAL") {
+		t.Errorf("query reads every version:\n%s", q.sql)
+	}
+}
+
+func TestQueryAnomaliesFilters(t *testing.T) {
+	store, conn := newFakeStore()
+	end := time.Now()
+	if _, err := store.QueryAnomalies(context.Background(), end.Add(-time.Hour), end, AnomalyFilter{
+		Severity:      types.SeverityCritical,
+		Type:          types.AnomalyTypeLeak,
+		SourceService: "shop/api",
+		Limit:         5,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	q := conn.lastQuery()
+	for _, clause := range []string{"severity = ?", "type = ?", "src_service = ?", "LIMIT 5"} {
+		if !strings.Contains(q.sql, clause) {
+			t.Errorf("query is missing %q:\n%s", clause, q.sql)
+		}
+	}
+	if len(q.args) != 5 || q.args[2] != "critical" || q.args[3] != "leak" || q.args[4] != "shop/api" {
+		t.Errorf("args = %v", q.args)
+	}
+}
+
+func TestAnomalyRoundTripIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	detectedAt := time.Now().UTC().Truncate(time.Millisecond)
+	source := "roundtrip-" + uuid.NewString()[:8]
+
+	a := testAnomaly(detectedAt)
+	a.SourceService = source
+	if err := store.InsertAnomaly(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	query := func() types.Anomaly {
+		t.Helper()
+		got, err := store.QueryAnomalies(ctx, detectedAt.Add(-time.Minute), detectedAt.Add(time.Minute), AnomalyFilter{SourceService: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("got %d anomalies, want 1", len(got))
+		}
+		return got[0]
+	}
+
+	got := query()
+	if got.ID != a.ID || got.StartedAt != nil || got.EndedAt != nil || !got.DetectedAt.Equal(detectedAt) || got.AISummary != a.AISummary {
+		t.Errorf("stored %+v, want %+v with null times", got, a)
+	}
+
+	// The update is a new version, read back in place of the first
+	endedAt := detectedAt.Add(time.Minute)
+	a.Resolved, a.EndedAt, a.UpdatedAt = true, &endedAt, time.Now()
+	if err := store.UpdateAnomaly(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	got = query()
+	if !got.Resolved || got.EndedAt == nil || !got.EndedAt.Equal(endedAt) {
+		t.Errorf("after update resolved=%v ended=%v, want resolved at %v", got.Resolved, got.EndedAt, endedAt)
+	}
+}
@@ -3,11 +3,16 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
 	"github.com/egressor/egressor/src/pkg/types"
@@ -18,8 +23,29 @@ type ClickHouseStore struct {
 	conn driver.Conn
 }
 
-// NewClickHouseStore creates a new ClickHouse store.
+// NewClickHouseStore creates a new ClickHouse store and initializes its schema.
 func NewClickHouseStore(dsn string) (*ClickHouseStore, error) {
+	store, err := OpenClickHouseStore(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize schema
+	if err := store.initSchema(context.Background()); err != nil {
+		return nil, fmt.Errorf("initializing schema: %w", err)
+	}
+
+	log.Info().Msg("Connected to ClickHouse")
+	return store, nil
+}
+
+// OpenClickHouseStore connects to ClickHouse without touching the schema.
+// The DSN is normalized with NormalizeDSN first.
+func OpenClickHouseStore(dsn string) (*ClickHouseStore, error) {
+	dsn, err := NormalizeDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
 	opts, err := clickhouse.ParseDSN(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parsing DSN: %w", err)
@@ -34,21 +60,30 @@ func NewClickHouseStore(dsn string) (*ClickHouseStore, error) {
 		return nil, fmt.Errorf("pinging ClickHouse: %w", err)
 	}
 
-	store := &ClickHouseStore{conn: conn}
+	return &ClickHouseStore{conn: conn}, nil
+}
 
-	// Initialize schema
-	if err := store.initSchema(context.Background()); err != nil {
-		return nil, fmt.Errorf("initializing schema: %w", err)
-	}
+// Retention of raw events and hourly aggregates, matching the TTLs of
+// transfer_events and transfer_flows_hourly.
+const (
+	RawEventRetention        = 30 * 24 * time.Hour
+	HourlyAggregateRetention = 90 * 24 * time.Hour
+)
 
-	log.Info().Msg("Connected to ClickHouse")
-	return store, nil
+// schemaStatement is a base schema DDL statement.
+type schemaStatement struct {
+	Name string
+	DDL  string
+	// MayExist tolerates failure, for objects without IF NOT EXISTS semantics.
+	MayExist bool
 }
 
-// initSchema creates the required tables.
-func (s *ClickHouseStore) initSchema(ctx context.Context) error {
+// baseSchema lists the base tables created before migrations are applied.
+var baseSchema = []schemaStatement{
 	// Transfer events table - main fact table
-	eventsTable := `
+	{
+		Name: "events table",
+		DDL: `
 	CREATE TABLE IF NOT EXISTS transfer_events (
 		id UUID,
 		timestamp DateTime64(3),
@@ -108,14 +143,12 @@ func (s *ClickHouseStore) initSchema(ctx context.Context) error {
 	PARTITION BY toYYYYMM(timestamp)
 	ORDER BY (timestamp, src_namespace, src_service, dst_namespace, dst_service)
 	TTL timestamp + INTERVAL 30 DAY
-	`
-
-	if err := s.conn.Exec(ctx, eventsTable); err != nil {
-		return fmt.Errorf("creating events table: %w", err)
-	}
-
+	`,
+	},
 	// Aggregated flows table - hourly aggregates
-	flowsTable := `
+	{
+		Name: "flows table",
+		DDL: `
 	CREATE TABLE IF NOT EXISTS transfer_flows_hourly (
 		hour DateTime,
 		src_namespace LowCardinality(String),
@@ -134,14 +167,12 @@ func (s *ClickHouseStore) initSchema(ctx context.Context) error {
 	PARTITION BY toYYYYMM(hour)
 	ORDER BY (hour, src_namespace, src_service, dst_namespace, dst_service)
 	TTL hour + INTERVAL 90 DAY
-	`
-
-	if err := s.conn.Exec(ctx, flowsTable); err != nil {
-		return fmt.Errorf("creating flows table: %w", err)
-	}
-
+	`,
+	},
 	// Materialized view for automatic aggregation
-	flowsMV := `
+	{
+		Name: "flows MV",
+		DDL: `
 	CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_mv
 	TO transfer_flows_hourly AS
 	SELECT
@@ -159,14 +190,13 @@ func (s *ClickHouseStore) initSchema(ctx context.Context) error {
 		maxState(bytes_sent + bytes_received) AS bytes_max
 	FROM transfer_events
 	GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type
-	`
-
-	if err := s.conn.Exec(ctx, flowsMV); err != nil {
-		log.Warn().Err(err).Msg("Flows MV may already exist")
-	}
-
+	`,
+		MayExist: true,
+	},
 	// Cost tracking table
-	costTable := `
+	{
+		Name: "cost table",
+		DDL: `
 	CREATE TABLE IF NOT EXISTS cost_attributions (
 		id UUID,
 		period_start DateTime,
@@ -196,14 +226,12 @@ func (s *ClickHouseStore) initSchema(ctx context.Context) error {
 	PARTITION BY toYYYYMM(period_start)
 	ORDER BY (period_start, namespace, service_name)
 	TTL period_start + INTERVAL 365 DAY
-	`
-
-	if err := s.conn.Exec(ctx, costTable); err != nil {
-		return fmt.Errorf("creating cost table: %w", err)
-	}
-
+	`,
+	},
 	// Anomalies table
-	anomaliesTable := `
+	{
+		Name: "anomalies table",
+		DDL: `
 	CREATE TABLE IF NOT EXISTS anomalies (
 		id UUID,
 		type LowCardinality(String),
@@ -233,14 +261,12 @@ func (s *ClickHouseStore) initSchema(ctx context.Context) error {
 	PARTITION BY toYYYYMM(detected_at)
 	ORDER BY (detected_at, severity, type)
 	TTL detected_at + INTERVAL 180 DAY
-	`
-
-	if err := s.conn.Exec(ctx, anomaliesTable); err != nil {
-		return fmt.Errorf("creating anomalies table: %w", err)
-	}
-
+	`,
+	},
 	// Baselines table
-	baselinesTable := `
+	{
+		Name: "baselines table",
+		DDL: `
 	CREATE TABLE IF NOT EXISTS baselines (
 		id UUID,
 		src_service LowCardinality(String),
@@ -266,73 +292,311 @@ func (s *ClickHouseStore) initSchema(ctx context.Context) error {
 		updated_at DateTime DEFAULT now()
 	) ENGINE = ReplacingMergeTree(updated_at)
 	ORDER BY (src_service, dst_service, dst_endpoint, transfer_type)
-	`
+	`,
+	},
+}
 
-	if err := s.conn.Exec(ctx, baselinesTable); err != nil {
-		return fmt.Errorf("creating baselines table: %w", err)
+// initSchema creates the required tables.
+func (s *ClickHouseStore) initSchema(ctx context.Context) error {
+	for _, stmt := range baseSchema {
+		if err := s.conn.Exec(ctx, stmt.DDL); err != nil {
+			if stmt.MayExist {
+				log.Warn().Err(err).Str("object", stmt.Name).Msg("Schema object may already exist")
+				continue
+			}
+			return fmt.Errorf("creating %s: %w", stmt.Name, err)
+		}
+	}
+
+	if err := s.applyMigrations(ctx); err != nil {
+		return err
 	}
 
 	log.Info().Msg("ClickHouse schema initialized")
 	return nil
 }
 
-// InsertEvents inserts a batch of transfer events.
-func (s *ClickHouseStore) InsertEvents(ctx context.Context, events []types.TransferEvent) error {
-	batch, err := s.conn.PrepareBatch(ctx, `
-		INSERT INTO transfer_events (
+// MigrateOptions are optional steps of Migrate.
+type MigrateOptions struct {
+	// RegroupViews rebuilds the hourly views grouped by
+	// AggregationDimensions once migrations are applied. Migrations that
+	// rebuild the views reset them to the default grouping, so the chosen
+	// grouping should be given on every migrate.
+	RegroupViews          bool
+	AggregationDimensions []string
+}
+
+// Migrate creates the base schema, applies pending migrations, and returns
+// the resulting schema version.
+func (s *ClickHouseStore) Migrate(ctx context.Context, opts MigrateOptions) (uint32, error) {
+	if err := s.initSchema(ctx); err != nil {
+		return 0, err
+	}
+	if opts.RegroupViews {
+		if err := s.SetAggregationDimensions(ctx, opts.AggregationDimensions); err != nil {
+			return 0, err
+		}
+	}
+	return s.SchemaVersion(ctx)
+}
+
+// InsertResult reports the outcome of a batch insert.
+type InsertResult struct {
+	Inserted int // Rows sent to ClickHouse
+	Skipped  int // Rows rejected while building the batch
+
+	// Retained counts inserted rows kept as raw events; set by
+	// InsertEventsAtomic only.
+	Retained int
+
+	skipped map[int]bool // Indexes of the rejected rows
+}
+
+const (
+	// insertMaxAttempts bounds tries of a batch send that fails transiently.
+	insertMaxAttempts = 3
+	// insertRetryBackoff is the wait before the first retry; it doubles
+	// on each further attempt.
+	insertRetryBackoff = 200 * time.Millisecond
+)
+
+// InsertEvents inserts a batch of transfer events. Rows that cannot be
+// appended are skipped and counted rather than failing the whole batch.
+func (s *ClickHouseStore) InsertEvents(ctx context.Context, events []types.TransferEvent) (InsertResult, error) {
+	return s.insertEvents(ctx, "transfer_events", events)
+}
+
+// InsertAggregateOnly records events in the hourly aggregates without
+// retaining them as raw events.
+func (s *ClickHouseStore) InsertAggregateOnly(ctx context.Context, events []types.TransferEvent) (InsertResult, error) {
+	return s.insertEvents(ctx, "transfer_events_unretained", events)
+}
+
+// InsertEventsAtomic writes a flush in a single insert: retained events
+// become raw events and every event, retained or not, lands in the hourly
+// aggregates. Both are derived from the same block by materialized views,
+// so the collector never stops between writing one and the other.
+//
+// The insert is not atomic on the server: the views run one after another,
+// and a view that fails leaves the tables written by earlier views in
+// place. Retries carry the batch's deduplication token, so re-sending the
+// block completes the missing tables without doubling the written ones. A
+// flush that fails every attempt may remain partially written.
+func (s *ClickHouseStore) InsertEventsAtomic(ctx context.Context, retained, unretained []types.TransferEvent) (InsertResult, error) {
+	events := make([]types.TransferEvent, 0, len(retained)+len(unretained))
+	events = append(events, retained...)
+	events = append(events, unretained...)
+
+	rows := make([][]any, len(events))
+	for i, e := range events {
+		rows[i] = append(eventRow(e), boolToUInt8(i < len(retained)))
+	}
+	result, err := s.insertRows(ctx, "transfer_events_ingest", insertIngestSQL, events, rows)
+	if err == nil {
+		result.Retained = len(retained)
+		for i := range result.skipped {
+			if i < len(retained) {
+				result.Retained--
+			}
+		}
+	}
+	return result, err
+}
+
+// insertEvents inserts a batch of transfer events into the given table.
+func (s *ClickHouseStore) insertEvents(ctx context.Context, table string, events []types.TransferEvent) (InsertResult, error) {
+	rows := make([][]any, len(events))
+	for i, e := range events {
+		rows[i] = eventRow(e)
+	}
+	return s.insertRows(ctx, table, fmt.Sprintf(insertEventsSQL, table), events, rows)
+}
+
+// insertRows sends rows for events with the insert statement sql, retrying
+// sends that fail for transient reasons such as a dropped connection. A
+// rejected batch is not retried.
+//
+// A send that fails transiently may still have been written, so every
+// attempt carries the same deduplication token: the server drops a retried
+// block it has already stored, in the target table and in the tables fed
+// by its materialized views.
+func (s *ClickHouseStore) insertRows(ctx context.Context, table, sql string, events []types.TransferEvent, rows [][]any) (InsertResult, error) {
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(insertSettings(uuid.NewString())))
+
+	backoff := insertRetryBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := s.sendEvents(ctx, sql, events, rows)
+		if err == nil || attempt == insertMaxAttempts || !isTransientInsertError(err) {
+			return result, err
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Str("table", table).Msg("Retrying event insert")
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// insertSettings returns the settings of an insert deduplicated by token.
+// Deduplication needs non_replicated_deduplication_window on the target
+// tables, set by migration 16.
+func insertSettings(token string) clickhouse.Settings {
+	return clickhouse.Settings{
+		"insert_deduplication_token":                         token,
+		"deduplicate_blocks_in_dependent_materialized_views": 1,
+	}
+}
+
+// isTransientInsertError reports whether a failed send may succeed if
+// retried. Errors returned by the server mean the data was rejected.
+func isTransientInsertError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var exception *clickhouse.Exception
+	return !errors.As(err, &exception)
+}
+
+// sendEvents builds and sends one batch. A row the driver refuses to append
+// invalidates the batch, so the batch is rebuilt without that row.
+func (s *ClickHouseStore) sendEvents(ctx context.Context, sql string, events []types.TransferEvent, rows [][]any) (InsertResult, error) {
+	skipped := make(map[int]bool)
+
+	for {
+		batch, err := s.conn.PrepareBatch(ctx, sql)
+		if err != nil {
+			return InsertResult{Skipped: len(skipped)}, fmt.Errorf("preparing batch: %w", err)
+		}
+
+		failed := -1
+		for i, row := range rows {
+			if skipped[i] {
+				continue
+			}
+			if err := batch.Append(row...); err != nil {
+				log.Debug().Err(err).Str("id", events[i].ID.String()).Msg("Skipping event that cannot be appended")
+				failed = i
+				break
+			}
+		}
+		if failed >= 0 {
+			skipped[failed] = true
+			continue
+		}
+
+		result := InsertResult{Inserted: len(rows) - len(skipped), Skipped: len(skipped), skipped: skipped}
+		if result.Inserted == 0 {
+			batch.Abort()
+			return result, nil
+		}
+		if err := batch.Send(); err != nil {
+			return InsertResult{Skipped: result.Skipped}, fmt.Errorf("sending batch: %w", err)
+		}
+		return result, nil
+	}
+}
+
+// insertEventsSQL inserts transfer events; %s is the target table.
+const insertEventsSQL = `
+		INSERT INTO %s (
 			id, timestamp,
-			src_ip, src_port, src_type, src_namespace, src_service, src_pod, src_node, src_cluster, src_az, src_region,
-			dst_ip, dst_port, dst_type, dst_namespace, dst_service, dst_pod, dst_node, dst_cluster, dst_az, dst_region,
-			dst_hostname, dst_is_internet, dst_cloud_service,
+			src_ip, src_port, src_type, src_namespace, src_service, src_pod, src_node, src_cluster, src_az, src_region, src_cloud_provider, src_version, src_team, src_k8s_services, src_labels,
+			dst_ip, dst_port, dst_type, dst_namespace, dst_service, dst_pod, dst_node, dst_cluster, dst_az, dst_region, dst_k8s_services,
+			dst_hostname, dst_is_internet, dst_cloud_service, dst_well_known_service, dst_country, dst_asn,
 			protocol, direction, transfer_type,
 			bytes_sent, bytes_received, packets_sent, packets_received, duration_ns,
 			http_method, http_path, http_status_code, grpc_method,
-			trace_id, span_id, labels
+			trace_id, span_id, labels, sample_rate, raw_sample_rate
 		)
-	`)
-	if err != nil {
-		return fmt.Errorf("preparing batch: %w", err)
+	`
+
+// insertIngestSQL inserts into transfer_events_ingest: insertEventsSQL's
+// columns plus whether the raw event is retained.
+var insertIngestSQL = strings.Replace(
+	fmt.Sprintf(insertEventsSQL, "transfer_events_ingest"),
+	"sample_rate, raw_sample_rate", "sample_rate, raw_sample_rate, retained", 1)
+
+// eventRow flattens an event into insertEventsSQL column order.
+func eventRow(e types.TransferEvent) []any {
+	srcIdentity := e.Source.Identity
+	dstIdentity := e.Destination.Identity
+
+	isInternet := uint8(0)
+	if e.Destination.IsInternet {
+		isInternet = 1
 	}
 
-	for _, e := range events {
-		srcIdentity := e.Source.Identity
-		dstIdentity := e.Destination.Identity
+	return []any{
+		e.ID, e.Timestamp,
+		e.Source.IP, e.Source.Port, string(e.Source.Type),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Namespace }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Name }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.PodName }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.NodeName }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Cluster }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.AvailabilityZone }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Region }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.CloudProvider }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Version }),
+		getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Team }),
+		servicesOf(srcIdentity),
+		labelsOf(srcIdentity),
+		e.Destination.IP, e.Destination.Port, string(e.Destination.Type),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Namespace }),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Name }),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.PodName }),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.NodeName }),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Cluster }),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.AvailabilityZone }),
+		getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Region }),
+		servicesOf(dstIdentity),
+		e.Destination.Hostname, isInternet, e.Destination.CloudServiceName, e.Destination.WellKnownService,
+		e.Destination.Country, e.Destination.ASN,
+		e.Protocol, string(e.Direction), string(e.Type),
+		e.BytesSent, e.BytesReceived, e.PacketsSent, e.PacketsReceived, e.DurationNs,
+		e.HTTPMethod, e.HTTPPath, e.HTTPStatusCode, e.GRPCMethod,
+		e.TraceID, e.SpanID, labelsJSON(e.Labels), sampleRate(e.SampleRate), sampleRate(e.RawSampleRate),
+	}
+}
 
-		isInternet := uint8(0)
-		if e.Destination.IsInternet {
-			isInternet = 1
-		}
+// sampleRate returns the stored sample rate, treating unset or invalid
+// rates as unsampled.
+func sampleRate(rate float64) float64 {
+	if rate <= 0 || rate > 1 {
+		return 1
+	}
+	return rate
+}
 
-		err := batch.Append(
-			e.ID, e.Timestamp,
-			e.Source.IP, e.Source.Port, string(e.Source.Type),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Namespace }),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Name }),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.PodName }),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.NodeName }),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Cluster }),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.AvailabilityZone }),
-			getOrEmpty(srcIdentity, func(i *types.ServiceIdentity) string { return i.Region }),
-			e.Destination.IP, e.Destination.Port, string(e.Destination.Type),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Namespace }),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Name }),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.PodName }),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.NodeName }),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Cluster }),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.AvailabilityZone }),
-			getOrEmpty(dstIdentity, func(i *types.ServiceIdentity) string { return i.Region }),
-			e.Destination.Hostname, isInternet, e.Destination.CloudServiceName,
-			e.Protocol, string(e.Direction), string(e.Type),
-			e.BytesSent, e.BytesReceived, e.PacketsSent, e.PacketsReceived, e.DurationNs,
-			e.HTTPMethod, e.HTTPPath, e.HTTPStatusCode, e.GRPCMethod,
-			e.TraceID, e.SpanID, "{}",
-		)
-		if err != nil {
-			return fmt.Errorf("appending to batch: %w", err)
-		}
+// servicesOf returns the fronting Services of an identity, never nil.
+func servicesOf(identity *types.ServiceIdentity) []string {
+	if identity == nil || identity.Services == nil {
+		return []string{}
 	}
+	return identity.Services
+}
+
+// labelsOf returns the workload labels of an identity, never nil.
+func labelsOf(identity *types.ServiceIdentity) map[string]string {
+	if identity == nil || identity.Labels == nil {
+		return map[string]string{}
+	}
+	return identity.Labels
+}
 
-	return batch.Send()
+// labelsJSON encodes event labels for the labels column.
+func labelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
 }
 
 // getOrEmpty returns field value or empty string.
@@ -343,21 +607,49 @@ func getOrEmpty(identity *types.ServiceIdentity, getter func(*types.ServiceIdent
 	return getter(identity)
 }
 
-// QueryFlows queries aggregated flows.
+// QueryFlows queries aggregated flows. With a Granularity set, results are
+// bucketed in time and FlowResult.Bucket holds each bucket's start.
 func (s *ClickHouseStore) QueryFlows(ctx context.Context, query FlowQuery) ([]FlowResult, error) {
-	sql := `
-		SELECT
+	src := query.Granularity.source()
+	// Pods and versions are only kept on raw events
+	groupColumn := query.GroupBy.column()
+	if groupColumn != "" {
+		src = query.Granularity.rawSource()
+	}
+
+	columns := `
 			src_namespace,
 			src_service,
 			dst_namespace,
 			dst_service,
-			dst_external,
+			` + src.external + ` AS dst_external,
+			` + src.hostname + ` AS hostname,
+			` + src.service + ` AS cloud_service,
+			` + src.provider + ` AS cloud_provider,
+			` + src.wellKnown + ` AS well_known_service,
 			transfer_type,
-			sumMerge(total_bytes) AS total_bytes,
-			sumMerge(total_packets) AS total_packets,
-			countMerge(event_count) AS event_count
-		FROM transfer_flows_hourly
-		WHERE hour >= ? AND hour < ?
+			` + src.bytes + ` AS total_bytes,
+			` + src.packets + ` AS total_packets,
+			` + src.events + ` AS event_count,
+			` + src.coverage + ` AS raw_sample_rate`
+	groupBy := "src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type"
+	orderBy := "total_bytes DESC"
+	if groupColumn != "" {
+		columns = `
+			` + groupColumn + `,` + columns
+		groupBy = groupColumn + ", " + groupBy
+	}
+	if src.bucket != "" {
+		columns = `
+			` + src.bucket + ` AS bucket,` + columns
+		groupBy = "bucket, " + groupBy
+		orderBy = "bucket, " + orderBy
+	}
+
+	sql := `
+		SELECT` + columns + `
+		FROM ` + src.table + `
+		WHERE ` + src.timeColumn + ` >= ? AND ` + src.timeColumn + ` < ?
 	`
 
 	args := []interface{}{query.Start, query.End}
@@ -383,8 +675,8 @@ func (s *ClickHouseStore) QueryFlows(ctx context.Context, query FlowQuery) ([]Fl
 		args = append(args, query.TransferType)
 	}
 
-	sql += ` GROUP BY src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type
-	         ORDER BY total_bytes DESC
+	sql += ` GROUP BY ` + groupBy + `
+	         ORDER BY ` + orderBy + `
 	         LIMIT ?`
 	args = append(args, query.Limit)
 
@@ -397,20 +689,544 @@ func (s *ClickHouseStore) QueryFlows(ctx context.Context, query FlowQuery) ([]Fl
 	var results []FlowResult
 	for rows.Next() {
 		var r FlowResult
-		if err := rows.Scan(
+		dest := []interface{}{
 			&r.SrcNamespace, &r.SrcService,
-			&r.DstNamespace, &r.DstService, &r.DstExternal,
+			&r.DstNamespace, &r.DstService, &r.DstExternal, &r.DstHostname, &r.DstCloudService, &r.SrcCloudProvider, &r.DstWellKnownService,
+			&r.TransferType,
+			&r.TotalBytes, &r.TotalPackets, &r.EventCount, &r.RawSampleRate,
+		}
+		switch query.GroupBy {
+		case GroupByPod:
+			dest = append([]interface{}{&r.SrcPod}, dest...)
+		case GroupByVersion:
+			dest = append([]interface{}{&r.SrcVersion}, dest...)
+		}
+		if src.bucket != "" {
+			dest = append([]interface{}{&r.Bucket}, dest...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// TopEventIDs returns the IDs of the largest raw events for a flow key
+// ("ns/svc|ns/svc" or "ns/svc|ip") in [start, end), biggest first.
+func (s *ClickHouseStore) TopEventIDs(ctx context.Context, flowKey string, start, end time.Time, limit int) ([]string, error) {
+	where, args, err := flowKeyFilter(flowKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+		SELECT toString(id)
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ?
+		  AND ` + where + `
+		ORDER BY bytes_sent + bytes_received DESC
+		LIMIT ?`
+	args = append([]interface{}{start, end}, args...)
+	args = append(args, limit)
+
+	rows, err := s.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying event ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ErrInvalidFlowKey is returned for flow keys that cannot be matched
+// against raw events.
+var ErrInvalidFlowKey = errors.New("invalid flow key")
+
+// ValidateFlowKey returns an error wrapping ErrInvalidFlowKey unless
+// flowKey can be matched against raw events.
+func ValidateFlowKey(flowKey string) error {
+	_, _, err := flowKeyFilter(flowKey)
+	return err
+}
+
+// flowKeyFilter returns a WHERE condition on transfer_events matching a
+// flow key ("ns/svc|ns/svc" or "ns/svc|ip", optionally followed by
+// "|transfer_type"), and its arguments. Graph node IDs such as
+// "external:api.stripe.com" are not flow keys: an edge to an external node
+// aggregates the IP flow keys returned by the graph's FlowKeys.
+func flowKeyFilter(flowKey string) (string, []interface{}, error) {
+	src, dst, transferType, ok := types.ParseFlowKey(flowKey)
+	if !ok {
+		return "", nil, fmt.Errorf("%w %q: want source|destination", ErrInvalidFlowKey, flowKey)
+	}
+	srcNamespace, srcService, ok := strings.Cut(src, "/")
+	if !ok || srcService == "" {
+		return "", nil, fmt.Errorf("%w %q: source must be namespace/service", ErrInvalidFlowKey, flowKey)
+	}
+
+	where := "src_namespace = ? AND src_service = ?"
+	args := []interface{}{srcNamespace, srcService}
+	dstNamespace, dstService, isService := strings.Cut(dst, "/")
+	switch {
+	case strings.HasPrefix(dst, "external:"):
+		return "", nil, fmt.Errorf("%w %q: %s is a graph node, use the IP flow keys of its edges", ErrInvalidFlowKey, flowKey, dst)
+	case isService && dstService != "":
+		where += " AND dst_namespace = ? AND dst_service = ?"
+		args = append(args, dstNamespace, dstService)
+	case net.ParseIP(dst) != nil:
+		where += " AND dst_ip = ?"
+		args = append(args, dst)
+	default:
+		return "", nil, fmt.Errorf("%w %q: destination must be namespace/service or an IP", ErrInvalidFlowKey, flowKey)
+	}
+	if transferType != "" {
+		where += " AND transfer_type = ?"
+		args = append(args, string(transferType))
+	}
+	return where, args, nil
+}
+
+// QueryFlowsByVersion queries flows grouped by source deployment version and
+// team. Both are only recorded on raw events, so this reads transfer_events.
+func (s *ClickHouseStore) QueryFlowsByVersion(ctx context.Context, query FlowQuery) ([]FlowResult, error) {
+	var results []FlowResult
+	err := s.StreamFlowsByVersion(ctx, query, query.Limit, func(chunk []FlowResult) error {
+		results = append(results, chunk...)
+		return nil
+	})
+	return results, err
+}
+
+// StreamFlowsByVersion runs the QueryFlowsByVersion query and passes the
+// results to fn in chunks of up to chunkSize, so callers can process long
+// periods without holding every flow. A zero query.Limit returns all flows.
+// The chunk slice is reused; fn must not keep it.
+func (s *ClickHouseStore) StreamFlowsByVersion(ctx context.Context, query FlowQuery, chunkSize int, fn func([]FlowResult) error) error {
+	if chunkSize <= 0 {
+		chunkSize = defaultStreamChunkSize
+	}
+
+	sql := `
+		SELECT
+			src_namespace,
+			src_service,
+			src_version,
+			src_team,
+			arrayMap(k -> src_labels[k], ?) AS src_label_values,
+			dst_namespace,
+			dst_service,
+			if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+			` + rawHostname + ` AS hostname,
+			` + rawCloudService + ` AS cloud_service,
+			` + rawCloudProvider + ` AS cloud_provider,
+			` + rawWellKnownService + ` AS well_known_service,
+			transfer_type,
+			` + scaledBytesSum + ` AS total_bytes,
+			` + scaledPacketsSum + ` AS total_packets,
+			` + scaledEventCount + ` AS event_count,
+			` + rawCoverage + ` AS raw_sample_rate
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ?
+	`
+
+	labelKeys := query.SrcLabels
+	if labelKeys == nil {
+		labelKeys = []string{}
+	}
+	args := []interface{}{labelKeys, query.Start, query.End}
+
+	if query.SrcNamespace != "" {
+		sql += " AND src_namespace = ?"
+		args = append(args, query.SrcNamespace)
+	}
+	if query.SrcService != "" {
+		sql += " AND src_service = ?"
+		args = append(args, query.SrcService)
+	}
+
+	// Ties are broken on the grouping columns so the order is total: a
+	// limit, and free tiers consumed in row order, then select the same
+	// flows on every run
+	sql += ` GROUP BY src_namespace, src_service, src_version, src_team, src_label_values, dst_namespace, dst_service, dst_external, transfer_type
+	         ORDER BY total_bytes DESC, src_namespace, src_service, src_version, src_team, src_label_values, dst_namespace, dst_service, dst_external, transfer_type`
+	if query.Limit > 0 {
+		sql += ` LIMIT ?`
+		args = append(args, query.Limit)
+	}
+
+	rows, err := s.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("querying flows by version: %w", err)
+	}
+	defer rows.Close()
+
+	chunk := make([]FlowResult, 0, chunkSize)
+	for rows.Next() {
+		var (
+			r           FlowResult
+			labelValues []string
+		)
+		if err := rows.Scan(
+			&r.SrcNamespace, &r.SrcService, &r.SrcVersion, &r.SrcTeam, &labelValues,
+			&r.DstNamespace, &r.DstService, &r.DstExternal, &r.DstHostname, &r.DstCloudService, &r.SrcCloudProvider, &r.DstWellKnownService,
+			&r.TransferType,
+			&r.TotalBytes, &r.TotalPackets, &r.EventCount, &r.RawSampleRate,
+		); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		r.SrcLabels = zipLabels(labelKeys, labelValues)
+		chunk = append(chunk, r)
+		if len(chunk) == chunkSize {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+	if len(chunk) > 0 {
+		return fn(chunk)
+	}
+	return nil
+}
+
+// zipLabels pairs label keys with their values, dropping missing labels.
+func zipLabels(keys, values []string) map[string]string {
+	var labels map[string]string
+	for i, v := range values {
+		if v == "" || i >= len(keys) {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(keys))
+		}
+		labels[keys[i]] = v
+	}
+	return labels
+}
+
+// QueryFlowsByPath queries flows with HTTP request context grouped by path.
+// Each event carrying an HTTP path counts as one request.
+func (s *ClickHouseStore) QueryFlowsByPath(ctx context.Context, query FlowQuery) ([]FlowResult, error) {
+	sql := `
+		SELECT
+			src_namespace,
+			src_service,
+			http_path,
+			dst_namespace,
+			dst_service,
+			if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+			` + rawHostname + ` AS hostname,
+			` + rawCloudService + ` AS cloud_service,
+			` + rawCloudProvider + ` AS cloud_provider,
+			` + rawWellKnownService + ` AS well_known_service,
+			transfer_type,
+			` + scaledBytesSum + ` AS total_bytes,
+			` + scaledPacketsSum + ` AS total_packets,
+			` + scaledEventCount + ` AS event_count,
+			` + rawCoverage + ` AS raw_sample_rate
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ? AND http_path != ''
+	`
+
+	args := []interface{}{query.Start, query.End}
+
+	if query.SrcNamespace != "" {
+		sql += " AND src_namespace = ?"
+		args = append(args, query.SrcNamespace)
+	}
+	if query.SrcService != "" {
+		sql += " AND src_service = ?"
+		args = append(args, query.SrcService)
+	}
+
+	sql += ` GROUP BY src_namespace, src_service, http_path, dst_namespace, dst_service, dst_external, transfer_type
+	         ORDER BY total_bytes DESC
+	         LIMIT ?`
+	args = append(args, query.Limit)
+
+	rows, err := s.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying flows by path: %w", err)
+	}
+	defer rows.Close()
+
+	var results []FlowResult
+	for rows.Next() {
+		var r FlowResult
+		if err := rows.Scan(
+			&r.SrcNamespace, &r.SrcService, &r.HTTPPath,
+			&r.DstNamespace, &r.DstService, &r.DstExternal, &r.DstHostname, &r.DstCloudService, &r.SrcCloudProvider, &r.DstWellKnownService,
 			&r.TransferType,
-			&r.TotalBytes, &r.TotalPackets, &r.EventCount,
+			&r.TotalBytes, &r.TotalPackets, &r.EventCount, &r.RawSampleRate,
 		); err != nil {
 			return nil, fmt.Errorf("scanning row: %w", err)
 		}
 		results = append(results, r)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
 
 	return results, nil
 }
 
+// GeoEgressResult is internet egress aggregated by destination geography.
+type GeoEgressResult struct {
+	Country    string `json:"country,omitempty"`
+	ASN        uint32 `json:"asn,omitempty"`
+	TotalBytes uint64 `json:"total_bytes"`
+	EventCount uint64 `json:"event_count"`
+	// RawSampleRate is the lowest raw retention rate among the summed
+	// events; below 1, totals leave out flows not retained raw
+	RawSampleRate float64 `json:"raw_sample_rate"`
+}
+
+// Geo dimensions for QueryEgressByGeo.
+const (
+	GeoDimensionCountry = "country"
+	GeoDimensionASN     = "asn"
+)
+
+// QueryEgressByGeo aggregates internet egress bytes by destination country
+// or ASN. Unenriched events are grouped under an empty country or ASN 0.
+func (s *ClickHouseStore) QueryEgressByGeo(ctx context.Context, start, end time.Time, dimension string) ([]GeoEgressResult, error) {
+	var column string
+	switch dimension {
+	case GeoDimensionCountry:
+		column = "dst_country"
+	case GeoDimensionASN:
+		column = "dst_asn"
+	default:
+		return nil, fmt.Errorf("unknown geo dimension: %s", dimension)
+	}
+
+	sql := `
+		SELECT
+			` + column + ` AS geo,
+			` + scaledBytesSum + ` AS total_bytes,
+			` + scaledEventCount + ` AS event_count,
+			` + rawCoverage + ` AS raw_sample_rate
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ? AND dst_is_internet = 1
+		GROUP BY geo
+		ORDER BY total_bytes DESC
+	`
+
+	rows, err := s.conn.Query(ctx, sql, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("querying egress by %s: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	var results []GeoEgressResult
+	for rows.Next() {
+		var r GeoEgressResult
+		var dest any = &r.Country
+		if dimension == GeoDimensionASN {
+			dest = &r.ASN
+		}
+		if err := rows.Scan(dest, &r.TotalBytes, &r.EventCount, &r.RawSampleRate); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// CloudServiceResult is traffic to a cloud service (s3, dynamodb, ...) of one
+// transfer type.
+type CloudServiceResult struct {
+	CloudService  string
+	TransferType  string
+	TotalBytes    uint64
+	EventCount    uint64
+	RawSampleRate float64 // Lowest raw retention rate among the summed events
+}
+
+// QueryByCloudService aggregates traffic by destination cloud service and
+// transfer type. Events without a cloud service are skipped, as are
+// well-known services such as DNS that older agents recorded as cloud
+// services.
+func (s *ClickHouseStore) QueryByCloudService(ctx context.Context, start, end time.Time) ([]CloudServiceResult, error) {
+	sql := `
+		SELECT
+			dst_cloud_service,
+			transfer_type,
+			` + scaledBytesSum + ` AS total_bytes,
+			` + scaledEventCount + ` AS event_count,
+			` + rawCoverage + ` AS raw_sample_rate
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ? AND dst_cloud_service != ''
+		  AND dst_cloud_service NOT IN ` + legacyWellKnownServices + `
+		GROUP BY dst_cloud_service, transfer_type
+		ORDER BY total_bytes DESC
+	`
+
+	rows, err := s.conn.Query(ctx, sql, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("querying by cloud service: %w", err)
+	}
+	defer rows.Close()
+
+	var results []CloudServiceResult
+	for rows.Next() {
+		var r CloudServiceResult
+		if err := rows.Scan(&r.CloudService, &r.TransferType, &r.TotalBytes, &r.EventCount, &r.RawSampleRate); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// DestinationRegionResult is in-cloud traffic between two regions of one
+// transfer type.
+type DestinationRegionResult struct {
+	SrcRegion     string
+	DstRegion     string
+	TransferType  string
+	TotalBytes    uint64
+	EventCount    uint64
+	RawSampleRate float64 // Lowest raw retention rate among the summed events
+}
+
+// QueryCostByDestinationRegion aggregates traffic leaving its source region
+// for another cloud region by source region, destination region and
+// transfer type. Internet egress and events without a destination region
+// are skipped. The source region is kept because region pricing depends
+// on both ends.
+func (s *ClickHouseStore) QueryCostByDestinationRegion(ctx context.Context, start, end time.Time) ([]DestinationRegionResult, error) {
+	sql := `
+		SELECT
+			src_region,
+			dst_region,
+			transfer_type,
+			` + scaledBytesSum + ` AS total_bytes,
+			` + scaledEventCount + ` AS event_count,
+			` + rawCoverage + ` AS raw_sample_rate
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ?
+		  AND dst_is_internet = 0 AND dst_region != '' AND dst_region != src_region
+		GROUP BY src_region, dst_region, transfer_type
+		ORDER BY total_bytes DESC
+	`
+
+	rows, err := s.conn.Query(ctx, sql, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("querying by destination region: %w", err)
+	}
+	defer rows.Close()
+
+	var results []DestinationRegionResult
+	for rows.Next() {
+		var r DestinationRegionResult
+		if err := rows.Scan(&r.SrcRegion, &r.DstRegion, &r.TransferType, &r.TotalBytes, &r.EventCount, &r.RawSampleRate); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// DestinationSourceResult is traffic from one source service to a queried
+// destination, for one source region and transfer type.
+type DestinationSourceResult struct {
+	SrcNamespace  string
+	SrcService    string
+	SrcRegion     string
+	TransferType  string
+	TotalBytes    uint64
+	EventCount    uint64
+	RawSampleRate float64 // Lowest raw retention rate among the summed events
+}
+
+// QueryDestinationSources aggregates traffic to a destination by source
+// service. The destination matches on hostname, IP, or both if both are set.
+func (s *ClickHouseStore) QueryDestinationSources(ctx context.Context, start, end time.Time, host, ip string) ([]DestinationSourceResult, error) {
+	where := "timestamp >= ? AND timestamp < ?"
+	args := []interface{}{start, end}
+	if host != "" {
+		where += " AND dst_hostname = ?"
+		args = append(args, host)
+	}
+	if ip != "" {
+		where += " AND dst_ip = ?"
+		args = append(args, ip)
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT
+			src_namespace,
+			src_service,
+			src_region,
+			transfer_type,
+			%s AS total_bytes,
+			%s AS event_count,
+			%s AS raw_sample_rate
+		FROM transfer_events
+		WHERE %s
+		GROUP BY src_namespace, src_service, src_region, transfer_type
+		ORDER BY total_bytes DESC
+	`, scaledBytesSum, scaledEventCount, rawCoverage, where)
+
+	rows, err := s.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying destination sources: %w", err)
+	}
+	defer rows.Close()
+
+	var results []DestinationSourceResult
+	for rows.Next() {
+		var r DestinationSourceResult
+		if err := rows.Scan(&r.SrcNamespace, &r.SrcService, &r.SrcRegion, &r.TransferType, &r.TotalBytes, &r.EventCount, &r.RawSampleRate); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// Ping checks the ClickHouse connection.
+func (s *ClickHouseStore) Ping(ctx context.Context) error {
+	return s.conn.Ping(ctx)
+}
+
 // Close closes the connection.
 func (s *ClickHouseStore) Close() error {
 	return s.conn.Close()
@@ -425,18 +1241,106 @@ type FlowQuery struct {
 	DstNamespace string
 	DstService   string
 	TransferType string
-	Limit        int
+	Granularity  Granularity
+	GroupBy      FlowGrouping // Split source services by pod or version
+	// SrcLabels are source label keys to split flows by, for
+	// StreamFlowsByVersion only
+	SrcLabels []string
+	Limit     int
 }
 
+// defaultStreamChunkSize is the chunk size used when a streaming query is
+// given none.
+const defaultStreamChunkSize = 10000
+
 // FlowResult represents a flow query result.
 type FlowResult struct {
+	Bucket       time.Time // Bucket start; zero unless a granularity was set
 	SrcNamespace string
 	SrcService   string
+	SrcPod       string
+	SrcVersion   string
+	SrcTeam      string
+	SrcLabels    map[string]string // Only the keys asked for in FlowQuery.SrcLabels
+	HTTPPath     string
 	DstNamespace string
 	DstService   string
 	DstExternal  string
-	TransferType string
-	TotalBytes   uint64
-	TotalPackets uint64
-	EventCount   uint64
+	// DstHostname and DstCloudService name an external destination when
+	// any of its events were enriched with them
+	DstHostname     string
+	DstCloudService string
+	// SrcCloudProvider is the provider the source runs on, which bills
+	// its traffic; empty when the agent did not know it
+	SrcCloudProvider string
+	// DstWellKnownService is the service, such as DNS, recognized by the
+	// destination port
+	DstWellKnownService string
+	TransferType        string
+	TotalBytes          uint64
+	TotalPackets        uint64
+	EventCount          uint64
+	// RawSampleRate is the lowest raw retention rate among the summed
+	// events, 1 for hourly aggregates. Below 1, totals leave out the flows
+	// the collector did not retain raw; they are not scaled up.
+	RawSampleRate float64
+}
+
+// legacyWellKnownServices lists, as SQL, the well-known service names older
+// agents wrote to dst_cloud_service.
+const legacyWellKnownServices = "('" + types.WellKnownServiceDNS + "', '" + types.WellKnownServiceNTP + "', '" +
+	types.WellKnownServiceDHCP + "', '" + types.WellKnownServiceSNMP + "')"
+
+// ToFlow converts a query result into a transfer flow over the given window.
+func (r FlowResult) ToFlow(start, end time.Time) types.TransferFlow {
+	flow := types.TransferFlow{
+		ID: uuid.New(),
+		SourceIdentity: types.ServiceIdentity{
+			Namespace:     r.SrcNamespace,
+			Name:          r.SrcService,
+			PodName:       r.SrcPod,
+			Version:       r.SrcVersion,
+			CloudProvider: r.SrcCloudProvider,
+			Team:          r.SrcTeam,
+			Labels:        r.SrcLabels,
+		},
+		Type:             types.TransferType(r.TransferType),
+		TotalBytes:       r.TotalBytes,
+		TotalPackets:     r.TotalPackets,
+		EventCount:       r.EventCount,
+		RawSampleRate:    r.RawSampleRate,
+		WellKnownService: r.DstWellKnownService,
+		WindowStart:      start,
+		WindowEnd:        end,
+	}
+	// Older agents recorded well-known services as cloud services
+	cloudService := r.DstCloudService
+	if types.IsWellKnownService(cloudService) {
+		if flow.WellKnownService == "" {
+			flow.WellKnownService = cloudService
+		}
+		cloudService = ""
+	}
+
+	if r.DstService != "" {
+		flow.DestinationIdentity = &types.ServiceIdentity{
+			Namespace: r.DstNamespace,
+			Name:      r.DstService,
+		}
+	} else if r.DstExternal != "" {
+		flow.DestinationEndpoint = &types.Endpoint{
+			IP:               r.DstExternal,
+			Type:             types.EndpointTypeExternal,
+			IsInternet:       true,
+			Hostname:         r.DstHostname,
+			CloudServiceName: cloudService,
+		}
+	}
+
+	if r.HTTPPath != "" {
+		flow.ByHTTPPath = map[string]uint64{r.HTTPPath: r.TotalBytes}
+		flow.RequestsByHTTPPath = map[string]uint64{r.HTTPPath: r.EventCount}
+	}
+
+	return flow
 }
@@ -0,0 +1,503 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// column returns the value eventRow writes for a named column.
+func column(t *testing.T, row []any, name string) any {
+	t.Helper()
+	cols := strings.Split(strings.NewReplacer("\n", "", "\t", "", "(", "", ")", "").Replace(
+		strings.SplitN(insertEventsSQL, "(", 2)[1]), ",")
+	for i, c := range cols {
+		if strings.TrimSpace(c) == name {
+			return row[i]
+		}
+	}
+	t.Fatalf("no column %s", name)
+	return nil
+}
+
+func TestEventRowPersistsLabels(t *testing.T) {
+	e := types.TransferEvent{
+		Source: types.Endpoint{Identity: &types.ServiceIdentity{
+			Namespace: "shop", Name: "api", Labels: map[string]string{"cost-center": "cc-100"},
+		}},
+		Labels: map[string]string{"watchlist": "example.com"},
+	}
+	row := eventRow(e)
+
+	if got := column(t, row, "src_labels"); !reflect.DeepEqual(got, map[string]string{"cost-center": "cc-100"}) {
+		t.Errorf("src_labels = %v", got)
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(column(t, row, "labels").(string)), &labels); err != nil {
+		t.Fatal(err)
+	}
+	if labels["watchlist"] != "example.com" {
+		t.Errorf("labels = %v, want the event labels", labels)
+	}
+
+	empty := eventRow(types.TransferEvent{})
+	if got := column(t, empty, "src_labels"); got == nil || len(got.(map[string]string)) != 0 {
+		t.Errorf("src_labels of an event without identity = %v, want an empty map", got)
+	}
+	if got := column(t, empty, "labels"); got != "{}" {
+		t.Errorf("labels without labels = %v, want {}", got)
+	}
+}
+
+func TestEventRowPersistsFrontingServices(t *testing.T) {
+	row := eventRow(types.TransferEvent{
+		Source:      types.Endpoint{Identity: &types.ServiceIdentity{Namespace: "shop", Name: "web", Services: []string{"shop/web"}}},
+		Destination: types.Endpoint{Identity: &types.ServiceIdentity{Namespace: "shop", Name: "db", Services: []string{"shop/db", "shop/db-read"}}},
+	})
+	if got := column(t, row, "src_k8s_services"); !reflect.DeepEqual(got, []string{"shop/web"}) {
+		t.Errorf("src_k8s_services = %v", got)
+	}
+	if got := column(t, row, "dst_k8s_services"); !reflect.DeepEqual(got, []string{"shop/db", "shop/db-read"}) {
+		t.Errorf("dst_k8s_services = %v", got)
+	}
+
+	// Array columns reject nil, so missing identities store empty arrays
+	empty := eventRow(types.TransferEvent{Source: types.Endpoint{Identity: &types.ServiceIdentity{Name: "api"}}})
+	for _, name := range []string{"src_k8s_services", "dst_k8s_services"} {
+		if got, ok := column(t, empty, name).([]string); !ok || got == nil || len(got) != 0 {
+			t.Errorf("%s = %#v, want an empty array", name, column(t, empty, name))
+		}
+	}
+}
+
+func TestToFlowHydratesLabels(t *testing.T) {
+	r := FlowResult{
+		SrcNamespace: "shop",
+		SrcService:   "api",
+		SrcLabels:    zipLabels([]string{"cost-center", "squad"}, []string{"cc-100", ""}),
+	}
+	flow := r.ToFlow(r.Bucket, r.Bucket)
+
+	if want := map[string]string{"cost-center": "cc-100"}; !reflect.DeepEqual(flow.SourceIdentity.Labels, want) {
+		t.Errorf("labels = %v, want %v", flow.SourceIdentity.Labels, want)
+	}
+	if zipLabels(nil, nil) != nil {
+		t.Error("zipLabels without keys should be nil")
+	}
+}
+
+func TestToFlowCarriesPathRequests(t *testing.T) {
+	r := FlowResult{SrcService: "api", HTTPPath: "/items", TotalBytes: 4096, EventCount: 12}
+	flow := r.ToFlow(r.Bucket, r.Bucket)
+
+	if flow.ByHTTPPath["/items"] != 4096 || flow.RequestsByHTTPPath["/items"] != 12 {
+		t.Errorf("path bytes %v requests %v, want 4096 bytes over 12 requests", flow.ByHTTPPath, flow.RequestsByHTTPPath)
+	}
+	if flow := (FlowResult{SrcService: "api"}).ToFlow(r.Bucket, r.Bucket); flow.ByHTTPPath != nil {
+		t.Errorf("flow without a path has path bytes %v", flow.ByHTTPPath)
+	}
+}
+
+func TestToFlowNamesExternalDestination(t *testing.T) {
+	r := FlowResult{SrcService: "api", DstExternal: "52.216.0.1", DstHostname: "bucket.s3.amazonaws.com", DstCloudService: "s3"}
+	dst := r.ToFlow(r.Bucket, r.Bucket).DestinationEndpoint
+	if dst == nil || dst.IP != "52.216.0.1" || dst.Hostname != "bucket.s3.amazonaws.com" || dst.CloudServiceName != "s3" {
+		t.Errorf("destination = %+v, want the IP with its hostname and cloud service", dst)
+	}
+}
+
+func TestToFlowSeparatesWellKnownServices(t *testing.T) {
+	for _, r := range []FlowResult{
+		{SrcService: "api", DstExternal: "8.8.8.8", DstWellKnownService: "dns"},
+		// Older agents wrote the well-known service as the cloud service
+		{SrcService: "api", DstExternal: "8.8.8.8", DstCloudService: "dns"},
+	} {
+		flow := r.ToFlow(r.Bucket, r.Bucket)
+		if flow.WellKnownService != "dns" || flow.DestinationEndpoint.CloudServiceName != "" {
+			t.Errorf("flow from %+v: well-known %q, cloud service %q, want dns and none",
+				r, flow.WellKnownService, flow.DestinationEndpoint.CloudServiceName)
+		}
+	}
+
+	event := types.TransferEvent{Destination: types.Endpoint{WellKnownService: "ntp"}}
+	if got := column(t, eventRow(event), "dst_well_known_service"); got != "ntp" {
+		t.Errorf("dst_well_known_service = %v, want ntp", got)
+	}
+}
+
+func TestCloudServiceQuerySkipsWellKnownServices(t *testing.T) {
+	store, conn := newFakeStore()
+	if _, err := store.QueryByCloudService(context.Background(), time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if sql := conn.lastQuery().sql; !strings.Contains(sql, "dst_cloud_service NOT IN ('dns', 'ntp', 'dhcp', 'snmp')") {
+		t.Errorf("cloud service query keeps well-known services:\n%s", sql)
+	}
+}
+
+func TestSourceCloudProviderRoundTrips(t *testing.T) {
+	event := types.TransferEvent{Source: types.Endpoint{Identity: &types.ServiceIdentity{Name: "api", CloudProvider: "gcp"}}}
+	if got := column(t, eventRow(event), "src_cloud_provider"); got != "gcp" {
+		t.Errorf("src_cloud_provider = %v, want gcp", got)
+	}
+
+	r := FlowResult{SrcService: "api", DstExternal: "203.0.113.10", SrcCloudProvider: "gcp"}
+	if got := r.ToFlow(r.Bucket, r.Bucket).SourceIdentity.CloudProvider; got != "gcp" {
+		t.Errorf("flow source provider = %q, want gcp", got)
+	}
+}
+
+func TestEventRowRecordsRawSampleRate(t *testing.T) {
+	if got := column(t, eventRow(types.TransferEvent{}), "raw_sample_rate"); got != 1.0 {
+		t.Errorf("raw_sample_rate of a retained-by-default event = %v, want 1", got)
+	}
+	if got := column(t, eventRow(types.TransferEvent{RawSampleRate: 0.25}), "raw_sample_rate"); got != 0.25 {
+		t.Errorf("raw_sample_rate = %v, want 0.25", got)
+	}
+	if !strings.Contains(insertIngestSQL, "raw_sample_rate, retained") {
+		t.Errorf("ingest insert does not end with the retained flag:\n%s", insertIngestSQL)
+	}
+}
+
+func TestRawSourcesReportCoverage(t *testing.T) {
+	for _, g := range []Granularity{GranularityRaw, Granularity5Min} {
+		src := g.source()
+		// Whole flows are dropped, so scaling the kept ones up is wrong
+		for _, expr := range []string{src.bytes, src.packets, src.events} {
+			if strings.Contains(expr, "raw_sample_rate") {
+				t.Errorf("%s extrapolates %q by raw_sample_rate", g, expr)
+			}
+		}
+		if src.coverage != rawCoverage {
+			t.Errorf("%s coverage = %q, want %q", g, src.coverage, rawCoverage)
+		}
+	}
+	if strings.Contains(hourlyAggregates.bytes, "sample_rate") {
+		t.Error("hourly aggregates are already scaled")
+	}
+	if strings.Contains(hourlyAggregates.coverage, "raw_sample_rate") {
+		t.Error("hourly aggregates see every event but report partial coverage")
+	}
+}
+
+func TestToFlowCarriesRawSampleRate(t *testing.T) {
+	flow := FlowResult{SrcService: "api", TotalBytes: 1000, RawSampleRate: 0.25}.ToFlow(time.Time{}, time.Time{})
+	if flow.TotalBytes != 1000 || flow.RawSampleRate != 0.25 {
+		t.Errorf("flow = %d bytes at coverage %v, want 1000 unscaled bytes at 0.25", flow.TotalBytes, flow.RawSampleRate)
+	}
+}
+
+// integrationStore connects to the ClickHouse in
+// EGRESSOR_TEST_CLICKHOUSE_DSN, skipping the test when it is unset.
+func integrationStore(t *testing.T) *ClickHouseStore {
+	t.Helper()
+	dsn := os.Getenv("EGRESSOR_TEST_CLICKHOUSE_DSN")
+	if dsn == "" {
+		t.Skip("EGRESSOR_TEST_CLICKHOUSE_DSN not set")
+	}
+	store, err := NewClickHouseStore(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestQueryEgressByCountry(t *testing.T) {
+	store, conn := newFakeStore(
+		[]any{"DE", uint64(3000), uint64(3), float64(1)},
+		[]any{"US", uint64(1000), uint64(1), float64(0.5)},
+	)
+	end := time.Now()
+	start := end.Add(-time.Hour)
+
+	results, err := store.QueryEgressByGeo(context.Background(), start, end, GeoDimensionCountry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GeoEgressResult{
+		{Country: "DE", TotalBytes: 3000, EventCount: 3, RawSampleRate: 1},
+		{Country: "US", TotalBytes: 1000, EventCount: 1, RawSampleRate: 0.5},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+
+	q := conn.lastQuery()
+	for _, part := range []string{"dst_country AS geo", "dst_is_internet = 1", "GROUP BY geo"} {
+		if !strings.Contains(q.sql, part) {
+			t.Errorf("query is missing %q:\n%s", part, q.sql)
+		}
+	}
+	if !reflect.DeepEqual(q.args, []any{start, end}) {
+		t.Errorf("args = %v, want the range", q.args)
+	}
+}
+
+func TestQueryEgressByASN(t *testing.T) {
+	store, conn := newFakeStore([]any{uint32(16509), uint64(500), uint64(2), float64(1)})
+
+	results, err := store.QueryEgressByGeo(context.Background(), time.Now(), time.Now(), GeoDimensionASN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ASN != 16509 || results[0].Country != "" {
+		t.Errorf("results = %+v, want ASN 16509", results)
+	}
+	if !strings.Contains(conn.lastQuery().sql, "dst_asn AS geo") {
+		t.Errorf("query does not group by ASN:\n%s", conn.lastQuery().sql)
+	}
+
+	if _, err := store.QueryEgressByGeo(context.Background(), time.Now(), time.Now(), "city"); err == nil {
+		t.Error("want error for an unknown dimension")
+	}
+}
+
+// TestEgressByCountryIntegration writes egress to two countries and reads
+// it back grouped.
+func TestEgressByCountryIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	event := func(country string, bytes uint64) types.TransferEvent {
+		return types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   now,
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: "shop", Name: "api"}},
+			Destination: types.Endpoint{IP: "203.0.113.10", IsInternet: true, Country: country},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   bytes,
+		}
+	}
+	// Antarctica and Bouvet Island are unlikely to see other test traffic
+	if _, err := store.InsertEvents(ctx, []types.TransferEvent{event("AQ", 100), event("AQ", 200), event("BV", 50)}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := store.QueryEgressByGeo(ctx, now.Add(-time.Minute), now.Add(time.Minute), GeoDimensionCountry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byCountry := make(map[string]GeoEgressResult)
+	for _, r := range results {
+		byCountry[r.Country] = r
+	}
+	if byCountry["AQ"].TotalBytes < 300 || byCountry["AQ"].EventCount < 2 || byCountry["BV"].TotalBytes < 50 {
+		t.Errorf("AQ %+v BV %+v, want both countries grouped separately", byCountry["AQ"], byCountry["BV"])
+	}
+}
+
+func TestTopEventIDs(t *testing.T) {
+	store, conn := newFakeStore([]any{"event-1"}, []any{"event-2"})
+	end := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ids, err := store.TopEventIDs(context.Background(), "shop/api|203.0.113.10", end.Add(-time.Hour), end, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "event-1" || ids[1] != "event-2" {
+		t.Errorf("ids = %v, want event-1 and event-2", ids)
+	}
+	q := conn.lastQuery()
+	want := []any{end.Add(-time.Hour), end, "shop", "api", "203.0.113.10", 20}
+	if !reflect.DeepEqual(q.args, want) {
+		t.Errorf("args = %v, want %v", q.args, want)
+	}
+	if !strings.Contains(q.sql, "dst_ip = ?") {
+		t.Errorf("query does not filter on the destination IP:\n%s", q.sql)
+	}
+
+	if _, err := store.TopEventIDs(context.Background(), "not-a-key", end.Add(-time.Hour), end, 20); err == nil {
+		t.Error("want error for an invalid flow key")
+	}
+}
+
+func TestStreamFlowsByVersionOrdersTotally(t *testing.T) {
+	store, conn := newFakeStore()
+	end := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := store.QueryFlowsByVersion(context.Background(), FlowQuery{Start: end.Add(-time.Hour), End: end}); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := conn.lastQuery().sql
+	groupBy := regexp.MustCompile(`GROUP BY ([^\n]+)`).FindStringSubmatch(sql)
+	orderBy := regexp.MustCompile(`ORDER BY ([^\n]+)`).FindStringSubmatch(sql)
+	if groupBy == nil || orderBy == nil || orderBy[1] != "total_bytes DESC, "+groupBy[1] {
+		t.Errorf("query does not break byte ties on every grouping column:\n%s", sql)
+	}
+}
+
+func TestQueryByCloudService(t *testing.T) {
+	store, conn := newFakeStore(
+		[]any{"s3", "egress", uint64(3000), uint64(3), float64(1)},
+		[]any{"dynamodb", "egress", uint64(1000), uint64(2), float64(1)},
+	)
+	end := time.Now()
+	results, err := store.QueryByCloudService(context.Background(), end.Add(-time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CloudServiceResult{
+		{CloudService: "s3", TransferType: "egress", TotalBytes: 3000, EventCount: 3, RawSampleRate: 1},
+		{CloudService: "dynamodb", TransferType: "egress", TotalBytes: 1000, EventCount: 2, RawSampleRate: 1},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if sql := conn.lastQuery().sql; !strings.Contains(sql, "GROUP BY dst_cloud_service, transfer_type") {
+		t.Errorf("query does not group by cloud service and type:\n%s", sql)
+	}
+}
+
+func TestQueryByCloudServiceIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	// Service names unlikely to see other test traffic
+	s3, dynamo := "s3-"+uuid.NewString()[:8], "dynamodb-"+uuid.NewString()[:8]
+
+	event := func(svc string, bytes uint64) types.TransferEvent {
+		return types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   now,
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: "shop", Name: "api"}},
+			Destination: types.Endpoint{IP: "52.216.0.1", IsInternet: true, CloudServiceName: svc},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   bytes,
+		}
+	}
+	if _, err := store.InsertEvents(ctx, []types.TransferEvent{event(s3, 100), event(s3, 200), event(dynamo, 50)}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := store.QueryByCloudService(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes := make(map[string]uint64)
+	for _, r := range results {
+		bytes[r.CloudService] += r.TotalBytes
+	}
+	if bytes[s3] != 300 || bytes[dynamo] != 50 {
+		t.Errorf("s3 %d bytes, dynamodb %d bytes; want 300 and 50", bytes[s3], bytes[dynamo])
+	}
+}
+
+func TestQueryDestinationSources(t *testing.T) {
+	store, conn := newFakeStore(
+		[]any{"shop", "api", "us-east-1", "egress", uint64(3000), uint64(3), float64(1)},
+		[]any{"batch", "export", "us-east-1", "egress", uint64(1000), uint64(1), float64(1)},
+	)
+	end := time.Now()
+	results, err := store.QueryDestinationSources(context.Background(), end.Add(-time.Hour), end, "api.example.com", "203.0.113.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].SrcService != "api" || results[1].TotalBytes != 1000 {
+		t.Errorf("results = %+v", results)
+	}
+
+	q := conn.lastQuery()
+	if !strings.Contains(q.sql, "dst_hostname = ?") || !strings.Contains(q.sql, "dst_ip = ?") ||
+		!strings.Contains(q.sql, "GROUP BY src_namespace, src_service") {
+		t.Errorf("query does not filter by destination and group by source:\n%s", q.sql)
+	}
+	if len(q.args) != 4 || q.args[2] != "api.example.com" || q.args[3] != "203.0.113.10" {
+		t.Errorf("args = %v, want the range, host and ip", q.args)
+	}
+
+	if _, err := store.QueryDestinationSources(context.Background(), end.Add(-time.Hour), end, "", "203.0.113.10"); err != nil {
+		t.Fatal(err)
+	}
+	if q := conn.lastQuery(); strings.Contains(q.sql, "dst_hostname") || len(q.args) != 3 {
+		t.Errorf("ip-only query filters on hostname: %s %v", q.sql, q.args)
+	}
+}
+
+func TestQueryCancelledMidQuery(t *testing.T) {
+	store, conn := newFakeStore(flowRow())
+	conn.delay = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	results, err := store.QueryFlows(ctx, FlowQuery{Start: start.Add(-time.Hour), End: start, Limit: 10})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if results != nil {
+		t.Errorf("results = %+v, want none from a cancelled query", results)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want promptly on cancel", elapsed)
+	}
+}
+
+func TestQueryCostByDestinationRegion(t *testing.T) {
+	store, conn := newFakeStore(
+		[]any{"us-east-1", "us-west-2", "cross_region", uint64(3000), uint64(3), float64(1)},
+		[]any{"us-east-1", "eu-west-1", "cross_region", uint64(1000), uint64(1), float64(1)},
+	)
+	end := time.Now()
+	results, err := store.QueryCostByDestinationRegion(context.Background(), end.Add(-time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].DstRegion != "us-west-2" || results[1].TotalBytes != 1000 {
+		t.Errorf("results = %+v", results)
+	}
+
+	q := conn.lastQuery()
+	if !strings.Contains(q.sql, "dst_is_internet = 0") || !strings.Contains(q.sql, "dst_region != src_region") ||
+		!strings.Contains(q.sql, "GROUP BY src_region, dst_region, transfer_type") {
+		t.Errorf("query does not keep inter-region traffic grouped by region:\n%s", q.sql)
+	}
+}
+
+func TestQueryDestinationSourcesIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	host := uuid.NewString()[:8] + ".example.com"
+
+	event := func(service string, bytes uint64) types.TransferEvent {
+		return types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   now,
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: "shop", Name: service}},
+			Destination: types.Endpoint{IP: "203.0.113.10", Hostname: host, IsInternet: true},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   bytes,
+		}
+	}
+	if _, err := store.InsertEvents(ctx, []types.TransferEvent{event("api", 100), event("api", 200), event("worker", 50)}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := store.QueryDestinationSources(ctx, now.Add(-time.Minute), now.Add(time.Minute), host, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes := make(map[string]uint64)
+	for _, r := range results {
+		bytes[r.SrcService] += r.TotalBytes
+	}
+	if len(bytes) != 2 || bytes["api"] != 300 || bytes["worker"] != 50 {
+		t.Errorf("bytes by source = %v, want api 300 and worker 50", bytes)
+	}
+}
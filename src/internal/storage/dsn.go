@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// Settings NormalizeDSN fills in when a DSN leaves them out.
+const (
+	defaultDSNDatabase    = "egressor"
+	defaultDSNCompression = "lz4"
+	defaultDSNDialTimeout = "10s"
+)
+
+// dsnSchemes are the schemes the ClickHouse driver accepts.
+var dsnSchemes = []string{"clickhouse", "tcp", "http", "https"}
+
+// NormalizeDSN validates a ClickHouse DSN and fills in the database
+// (egressor), lz4 compression and a 10s dial timeout where it sets none,
+// and TLS for https. A DSN without a scheme, such as "localhost:9000", is
+// taken as clickhouse://. Errors name the mistake without echoing
+// credentials.
+func NormalizeDSN(dsn string) (string, error) {
+	dsn = strings.TrimSpace(dsn)
+	if dsn == "" {
+		return "", errors.New("ClickHouse DSN is empty (e.g. clickhouse://localhost:9000/egressor)")
+	}
+	if !strings.Contains(dsn, "://") {
+		dsn = "clickhouse://" + dsn
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("invalid ClickHouse DSN: %w", err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	known := false
+	for _, s := range dsnSchemes {
+		known = known || s == u.Scheme
+	}
+	if !known {
+		return "", fmt.Errorf("unsupported ClickHouse DSN scheme %q (known: %s)",
+			u.Scheme, strings.Join(dsnSchemes, ", "))
+	}
+	if u.Host == "" {
+		return "", errors.New("ClickHouse DSN has no host (e.g. clickhouse://localhost:9000/egressor)")
+	}
+
+	db := strings.Trim(u.Path, "/")
+	if strings.Contains(db, "/") {
+		return "", fmt.Errorf("ClickHouse DSN path %q must be a single database name", u.Path)
+	}
+	if db == "" {
+		db = defaultDSNDatabase
+	}
+	u.Path = "/" + db
+
+	params := u.Query()
+	if !params.Has("compress") {
+		params.Set("compress", defaultDSNCompression)
+	}
+	if v := params.Get("dial_timeout"); v == "" {
+		params.Set("dial_timeout", defaultDSNDialTimeout)
+	} else if _, err := time.ParseDuration(v); err != nil {
+		return "", fmt.Errorf("ClickHouse DSN dial_timeout %q is not a duration (e.g. 10s)", v)
+	}
+	if u.Scheme == "https" && !params.Has("secure") {
+		params.Set("secure", "true")
+	}
+	u.RawQuery = params.Encode()
+
+	normalized := u.String()
+	if _, err := clickhouse.ParseDSN(normalized); err != nil {
+		return "", fmt.Errorf("invalid ClickHouse DSN: %w", err)
+	}
+	return normalized, nil
+}
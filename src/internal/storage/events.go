@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// StreamFlowEvents reads the raw events of a flow key ("ns/svc|ns/svc" or
+// "ns/svc|ip") in [start, end), oldest first, calling fn for each. At most
+// limit events are read; a limit of 0 reads all. Only retained events are
+// returned. Reading stops at the first error from fn.
+func (s *ClickHouseStore) StreamFlowEvents(ctx context.Context, flowKey string, start, end time.Time, limit int, fn func(types.TransferEvent) error) error {
+	where, args, err := flowKeyFilter(flowKey)
+	if err != nil {
+		return err
+	}
+
+	sql := `
+		SELECT
+			id, timestamp,
+			src_ip, src_port, src_type, src_namespace, src_service, src_pod, src_node, src_cluster, src_az, src_region, src_cloud_provider, src_version, src_team, src_k8s_services, src_labels,
+			dst_ip, dst_port, dst_type, dst_namespace, dst_service, dst_pod, dst_node, dst_cluster, dst_az, dst_region, dst_k8s_services,
+			dst_hostname, dst_is_internet, dst_cloud_service, dst_well_known_service, dst_country, dst_asn,
+			protocol, direction, transfer_type,
+			bytes_sent, bytes_received, packets_sent, packets_received, duration_ns,
+			http_method, http_path, http_status_code, grpc_method,
+			trace_id, span_id, labels, sample_rate, raw_sample_rate
+		FROM transfer_events
+		WHERE timestamp >= ? AND timestamp < ?
+		  AND ` + where + `
+		ORDER BY timestamp`
+	args = append([]interface{}{start, end}, args...)
+	if limit > 0 {
+		sql += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("querying flow events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			e                types.TransferEvent
+			src, dst         types.ServiceIdentity
+			srcType, dstType string
+			direction, tType string
+			isInternet       uint8
+			statusCode       uint16
+			labels           string
+		)
+		if err := rows.Scan(
+			&e.ID, &e.Timestamp,
+			&e.Source.IP, &e.Source.Port, &srcType, &src.Namespace, &src.Name, &src.PodName, &src.NodeName, &src.Cluster, &src.AvailabilityZone, &src.Region, &src.CloudProvider, &src.Version, &src.Team, &src.Services, &src.Labels,
+			&e.Destination.IP, &e.Destination.Port, &dstType, &dst.Namespace, &dst.Name, &dst.PodName, &dst.NodeName, &dst.Cluster, &dst.AvailabilityZone, &dst.Region, &dst.Services,
+			&e.Destination.Hostname, &isInternet, &e.Destination.CloudServiceName, &e.Destination.WellKnownService, &e.Destination.Country, &e.Destination.ASN,
+			&e.Protocol, &direction, &tType,
+			&e.BytesSent, &e.BytesReceived, &e.PacketsSent, &e.PacketsReceived, &e.DurationNs,
+			&e.HTTPMethod, &e.HTTPPath, &statusCode, &e.GRPCMethod,
+			&e.TraceID, &e.SpanID, &labels, &e.SampleRate, &e.RawSampleRate,
+		); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+
+		e.Source.Type = types.EndpointType(srcType)
+		e.Destination.Type = types.EndpointType(dstType)
+		e.Destination.IsInternet = isInternet == 1
+		e.Direction = types.Direction(direction)
+		e.Type = types.TransferType(tType)
+		e.HTTPStatusCode = int(statusCode)
+		if src.Namespace != "" || src.Name != "" {
+			e.Source.Identity = &src
+		}
+		if dst.Namespace != "" || dst.Name != "" {
+			e.Destination.Identity = &dst
+		}
+		if labels != "" && labels != "{}" {
+			if err := json.Unmarshal([]byte(labels), &e.Labels); err != nil {
+				return fmt.Errorf("decoding labels of event %s: %w", e.ID, err)
+			}
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestStreamFlowEventsRoundTrip(t *testing.T) {
+	events := insertEvents(2)
+	events[0].Labels = map[string]string{"env": "prod"}
+	events[1].Destination.Hostname = "api.example.com"
+	events[1].HTTPStatusCode = 503
+	store, conn := newFakeStore(eventRow(events[0]), eventRow(events[1]))
+
+	var got []types.TransferEvent
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	err := store.StreamFlowEvents(context.Background(), "shop/api|203.0.113.0", start, start.Add(24*time.Hour), 50, func(e types.TransferEvent) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("streamed %d events, want 2", len(got))
+	}
+	for i, e := range got {
+		want := events[i]
+		if e.ID != want.ID || !e.Timestamp.Equal(want.Timestamp) || e.Destination.IP != want.Destination.IP ||
+			e.Type != want.Type || e.BytesSent != want.BytesSent || e.Source.Identity == nil || e.Source.Identity.FullName() != "shop/api" {
+			t.Errorf("event %d = %+v, want %+v", i, e, want)
+		}
+	}
+	if got[0].Labels["env"] != "prod" || got[1].Destination.Hostname != "api.example.com" || got[1].HTTPStatusCode != 503 {
+		t.Errorf("labels, hostname or status lost: %+v", got)
+	}
+
+	q := conn.lastQuery()
+	if !strings.Contains(q.sql, "dst_ip = ?") || !strings.Contains(q.sql, "ORDER BY timestamp") {
+		t.Errorf("query does not filter by the key oldest first:\n%s", q.sql)
+	}
+	if len(q.args) != 6 || q.args[2] != "shop" || q.args[3] != "api" || q.args[4] != "203.0.113.0" || q.args[5] != 50 {
+		t.Errorf("args = %v, want the range, key and limit", q.args)
+	}
+}
+
+func TestStreamFlowEventsStopsOnError(t *testing.T) {
+	store, _ := newFakeStore(eventRow(insertEvents(1)[0]), eventRow(insertEvents(1)[0]))
+	stop := errors.New("client gone")
+	calls := 0
+	err := store.StreamFlowEvents(context.Background(), "shop/api|shop/db", time.Now().Add(-time.Hour), time.Now(), 0, func(types.TransferEvent) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("err %v after %d calls, want the callback's error after 1", err, calls)
+	}
+
+	if err := store.StreamFlowEvents(context.Background(), "no-separator", time.Now(), time.Now(), 0, nil); err == nil {
+		t.Error("invalid flow key accepted")
+	}
+}
+
+func TestFlowKeyFilter(t *testing.T) {
+	tests := []struct {
+		flowKey string
+		where   string
+		args    []interface{}
+	}{
+		{"shop/api|shop/db", "src_namespace = ? AND src_service = ? AND dst_namespace = ? AND dst_service = ?",
+			[]interface{}{"shop", "api", "shop", "db"}},
+		{"shop/api|203.0.113.10", "src_namespace = ? AND src_service = ? AND dst_ip = ?",
+			[]interface{}{"shop", "api", "203.0.113.10"}},
+		{"shop/api|2001:db8::1|egress", "src_namespace = ? AND src_service = ? AND dst_ip = ? AND transfer_type = ?",
+			[]interface{}{"shop", "api", "2001:db8::1", "egress"}},
+	}
+	for _, tt := range tests {
+		where, args, err := flowKeyFilter(tt.flowKey)
+		if err != nil {
+			t.Errorf("%s: %v", tt.flowKey, err)
+			continue
+		}
+		if where != tt.where || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: got %q %v, want %q %v", tt.flowKey, where, args, tt.where, tt.args)
+		}
+	}
+
+	for _, key := range []string{
+		"shop/api",
+		"api|203.0.113.10",
+		"shop/api|external:api.stripe.com",
+		"shop/api|unknown",
+		"shop/api|shop/db|egress|extra",
+	} {
+		if err := ValidateFlowKey(key); !errors.Is(err, ErrInvalidFlowKey) {
+			t.Errorf("%s: err = %v, want ErrInvalidFlowKey", key, err)
+		}
+	}
+}
+
+func TestStreamFlowEventsIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	namespace := "stream-" + uuid.NewString()[:8]
+	now := time.Now().UTC()
+
+	events := insertEvents(4)
+	for i := range events {
+		events[i].Timestamp = now.Add(time.Duration(i) * time.Second)
+		events[i].Source.Identity = &types.ServiceIdentity{Namespace: namespace, Name: "api"}
+		events[i].Destination.IP = "203.0.113.10"
+	}
+	events[3].Destination.IP = "203.0.113.99" // Another flow
+	if _, err := store.InsertEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uuid.UUID
+	err := store.StreamFlowEvents(ctx, namespace+"/api|203.0.113.10", now.Add(-time.Minute), now.Add(time.Minute), 0, func(e types.TransferEvent) error {
+		ids = append(ids, e.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != events[0].ID || ids[1] != events[1].ID || ids[2] != events[2].ID {
+		t.Errorf("streamed %v, want the flow's three events oldest first", ids)
+	}
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeConn is a driver.Conn that records statements and answers every
+// query with canned rows. Methods the store does not use panic through the
+// nil embedded interface.
+type fakeConn struct {
+	driver.Conn
+
+	rows      [][]any                // Returned by every Query and QueryRow
+	delay     time.Duration          // Query blocks this long or until ctx is done
+	appendErr func(row []any) error  // Fails Append for matching rows
+	sendErr   func(sql string) error // Fails Send of a batch
+
+	mu       sync.Mutex
+	queries  []fakeQuery
+	execs    []fakeQuery
+	prepared []context.Context // Contexts of every PrepareBatch
+	sent     []*fakeBatch
+}
+
+// fakeQuery is a recorded query or statement and its arguments.
+type fakeQuery struct {
+	sql  string
+	args []any
+}
+
+// newFakeStore returns a store over a fakeConn answering with rows.
+func newFakeStore(rows ...[]any) (*ClickHouseStore, *fakeConn) {
+	conn := &fakeConn{rows: rows}
+	return &ClickHouseStore{conn: conn}, conn
+}
+
+func (c *fakeConn) Query(ctx context.Context, sql string, args ...any) (driver.Rows, error) {
+	c.mu.Lock()
+	c.queries = append(c.queries, fakeQuery{sql: sql, args: args})
+	c.mu.Unlock()
+
+	if c.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.delay):
+		}
+	}
+	return &fakeRows{rows: c.rows}, nil
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, sql string, args ...any) driver.Row {
+	rows, err := c.Query(ctx, sql, args...)
+	if err != nil {
+		return &fakeRow{err: err}
+	}
+	r := rows.(*fakeRows)
+	if !r.Next() {
+		return &fakeRow{err: fmt.Errorf("no rows")}
+	}
+	return &fakeRow{row: r.rows[0]}
+}
+
+func (c *fakeConn) Exec(ctx context.Context, sql string, args ...any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.execs = append(c.execs, fakeQuery{sql: sql, args: args})
+	return nil
+}
+
+func (c *fakeConn) PrepareBatch(ctx context.Context, sql string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	c.mu.Lock()
+	c.prepared = append(c.prepared, ctx)
+	c.mu.Unlock()
+	return &fakeBatch{conn: c, sql: sql}, nil
+}
+
+func (c *fakeConn) Ping(context.Context) error { return nil }
+func (c *fakeConn) Close() error               { return nil }
+
+// lastQuery returns the most recent query.
+func (c *fakeConn) lastQuery() fakeQuery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queries) == 0 {
+		return fakeQuery{}
+	}
+	return c.queries[len(c.queries)-1]
+}
+
+// querySetting returns the named setting attached to ctx by
+// clickhouse.Context, or "" if there is none. The driver keeps settings
+// unexported, so they are read by reflection.
+func querySetting(ctx context.Context, name string) string {
+	optionsType := reflect.TypeOf(clickhouse.QueryOptions{})
+	v := reflect.ValueOf(ctx)
+	for v.IsValid() {
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			break
+		}
+		if val := v.FieldByName("val"); val.IsValid() && val.Elem().Type() == optionsType {
+			setting := val.Elem().FieldByName("settings").MapIndex(reflect.ValueOf(name))
+			if setting.IsValid() {
+				return fmt.Sprint(setting)
+			}
+		}
+		v = v.FieldByName("Context")
+	}
+	return ""
+}
+
+// fakeRows iterates canned rows, assigning values to scan destinations.
+type fakeRows struct {
+	driver.Rows
+	rows [][]any
+	next int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return scanRow(r.rows[r.next-1], dest)
+}
+
+func (r *fakeRows) Err() error   { return nil }
+func (r *fakeRows) Close() error { return nil }
+
+// fakeRow is a single canned row.
+type fakeRow struct {
+	row []any
+	err error
+}
+
+func (r *fakeRow) Err() error { return r.err }
+
+func (r *fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanRow(r.row, dest)
+}
+
+func (r *fakeRow) ScanStruct(any) error { return fmt.Errorf("not supported") }
+
+// scanRow assigns row values to pointers, converting between compatible
+// types the way the driver does.
+func scanRow(row, dest []any) error {
+	if len(row) != len(dest) {
+		return fmt.Errorf("row has %d columns, scanning %d", len(row), len(dest))
+	}
+	for i, v := range row {
+		target := reflect.ValueOf(dest[i]).Elem()
+		value := reflect.ValueOf(v)
+		if !value.IsValid() {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		if !value.Type().ConvertibleTo(target.Type()) {
+			return fmt.Errorf("column %d: cannot scan %T into %s", i, v, target.Type())
+		}
+		target.Set(value.Convert(target.Type()))
+	}
+	return nil
+}
+
+// fakeBatch collects appended rows; sent batches are recorded on the conn.
+type fakeBatch struct {
+	driver.Batch
+	conn *fakeConn
+	sql  string
+	rows [][]any
+}
+
+func (b *fakeBatch) Append(v ...any) error {
+	if b.conn.appendErr != nil {
+		if err := b.conn.appendErr(v); err != nil {
+			return err
+		}
+	}
+	b.rows = append(b.rows, v)
+	return nil
+}
+
+func (b *fakeBatch) Abort() error { return nil }
+func (b *fakeBatch) Rows() int    { return len(b.rows) }
+
+func (b *fakeBatch) Send() error {
+	if b.conn.sendErr != nil {
+		if err := b.conn.sendErr(b.sql); err != nil {
+			return err
+		}
+	}
+	b.conn.mu.Lock()
+	defer b.conn.mu.Unlock()
+	b.conn.sent = append(b.conn.sent, b)
+	return nil
+}
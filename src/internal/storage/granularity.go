@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the time bucket size of a flow query.
+type Granularity string
+
+const (
+	// GranularityNone aggregates the whole query range into one row per flow.
+	GranularityNone Granularity = ""
+	// GranularityRaw buckets raw events by minute.
+	GranularityRaw Granularity = "raw"
+	// Granularity5Min buckets raw events into five-minute windows.
+	Granularity5Min Granularity = "5m"
+	// GranularityHourly buckets by hour from the hourly aggregates.
+	GranularityHourly Granularity = "hourly"
+	// GranularityDaily buckets by day from the hourly aggregates.
+	GranularityDaily Granularity = "daily"
+)
+
+// ParseGranularity validates a granularity name.
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case GranularityNone, GranularityRaw, Granularity5Min, GranularityHourly, GranularityDaily:
+		return g, nil
+	}
+	return GranularityNone, fmt.Errorf("unknown granularity %q (want raw, 5m, hourly, or daily)", s)
+}
+
+// Duration returns the bucket width, or zero for GranularityNone.
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case GranularityRaw:
+		return time.Minute
+	case Granularity5Min:
+		return 5 * time.Minute
+	case GranularityHourly:
+		return time.Hour
+	case GranularityDaily:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// flowSource describes where and how a granularity reads flows.
+type flowSource struct {
+	table      string
+	timeColumn string
+	bucket     string // Bucket expression; empty for no bucketing
+	external   string // Expression for dst_external
+	hostname   string // Expression for an external destination's hostname
+	service    string // Expression for an external destination's cloud service
+	provider   string // Expression for the source's cloud provider
+	wellKnown  string // Expression for the destination's well-known service
+	bytes      string
+	packets    string
+	events     string
+	coverage   string // Expression for raw_sample_rate
+}
+
+// Raw event sums scaled by 1/sample_rate so sampled events count for the
+// traffic they stand for, as in the hourly aggregates. They are not scaled
+// for the flows the collector did not retain raw: the sampler keeps or
+// drops whole flows, so scaling would inflate the kept flows and leave the
+// dropped ones at zero. rawCoverage reports the lowest retention rate
+// among the summed events instead, so callers can tell totals are partial.
+const (
+	scaledBytesSum   = "toUInt64(round(sum((bytes_sent + bytes_received) / sample_rate)))"
+	scaledPacketsSum = "toUInt64(round(sum((packets_sent + packets_received) / sample_rate)))"
+	scaledEventCount = "count()"
+	rawCoverage      = "min(raw_sample_rate)"
+)
+
+// An external destination's hostname and cloud service, taken as the
+// largest value so a known name wins over events that lack one. They are
+// not grouped by: an IP resolves to one name, and adding them to GROUP BY
+// would split its flows when only some events carry the name.
+const (
+	rawHostname     = "max(dst_hostname)"
+	rawCloudService = "max(dst_cloud_service)"
+)
+
+// rawCloudProvider is the source's cloud provider. A workload runs on one
+// provider, so like the destination names it is not grouped by.
+const rawCloudProvider = "max(src_cloud_provider)"
+
+// rawWellKnownService is the well-known service, such as DNS, recognized
+// by destination port. A destination serves one, so it is not grouped by.
+const rawWellKnownService = "max(dst_well_known_service)"
+
+var (
+	hourlyAggregates = flowSource{
+		table:      "transfer_flows_hourly",
+		timeColumn: "hour",
+		external:   "dst_external",
+		hostname:   "max(dst_hostname_hint)",
+		service:    "max(dst_cloud_service_hint)",
+		provider:   "max(src_cloud_provider_hint)",
+		wellKnown:  "max(dst_well_known_service_hint)",
+		bytes:      "sumMerge(total_bytes)",
+		packets:    "sumMerge(total_packets)",
+		events:     "countMerge(event_count)",
+		coverage:   "toFloat64(1)",
+	}
+	rawEvents = flowSource{
+		table:      "transfer_events",
+		timeColumn: "timestamp",
+		external:   "if(dst_is_internet = 1, dst_ip, '')",
+		hostname:   rawHostname,
+		service:    rawCloudService,
+		provider:   rawCloudProvider,
+		wellKnown:  rawWellKnownService,
+		bytes:      scaledBytesSum,
+		packets:    scaledPacketsSum,
+		events:     scaledEventCount,
+		coverage:   rawCoverage,
+	}
+)
+
+// source returns the table and bucketing for the granularity. Sub-hour
+// buckets need raw events, so they are limited by raw retention.
+func (g Granularity) source() flowSource {
+	switch g {
+	case GranularityRaw:
+		src := rawEvents
+		src.bucket = "toStartOfMinute(timestamp)"
+		return src
+	case Granularity5Min:
+		src := rawEvents
+		src.bucket = "toStartOfFiveMinutes(timestamp)"
+		return src
+	case GranularityHourly:
+		src := hourlyAggregates
+		src.bucket = "hour"
+		return src
+	case GranularityDaily:
+		src := hourlyAggregates
+		src.bucket = "toStartOfDay(hour)"
+		return src
+	}
+	return hourlyAggregates
+}
+
+// rawSource is like source but always reads raw events, for queries on
+// columns the hourly aggregates do not keep.
+func (g Granularity) rawSource() flowSource {
+	src := rawEvents
+	switch g {
+	case GranularityRaw:
+		src.bucket = "toStartOfMinute(timestamp)"
+	case Granularity5Min:
+		src.bucket = "toStartOfFiveMinutes(timestamp)"
+	case GranularityHourly:
+		src.bucket = "toStartOfHour(timestamp)"
+	case GranularityDaily:
+		src.bucket = "toStartOfDay(timestamp)"
+	}
+	return src
+}
+
+// FlowGrouping splits flow results below the service level.
+type FlowGrouping string
+
+const (
+	// GroupByService returns one row per source service (the default).
+	GroupByService FlowGrouping = ""
+	// GroupByPod splits each source service by pod.
+	GroupByPod FlowGrouping = "pod"
+	// GroupByVersion splits each source service by deployment version.
+	GroupByVersion FlowGrouping = "version"
+)
+
+// ParseFlowGrouping validates a grouping name.
+func ParseFlowGrouping(s string) (FlowGrouping, error) {
+	switch g := FlowGrouping(s); g {
+	case GroupByService, GroupByPod, GroupByVersion:
+		return g, nil
+	}
+	return GroupByService, fmt.Errorf("unknown group_by %q (want pod or version)", s)
+}
+
+// column returns the source column the grouping adds, or "" for none.
+func (g FlowGrouping) column() string {
+	switch g {
+	case GroupByPod:
+		return "src_pod"
+	case GroupByVersion:
+		return "src_version"
+	}
+	return ""
+}
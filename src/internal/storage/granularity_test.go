@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// flowRow is a QueryFlows result row without bucket or grouping columns.
+func flowRow() []any {
+	return []any{"shop", "api", "", "", "203.0.113.10", "", "", "", "", "egress", uint64(1000), uint64(10), uint64(2), float64(1)}
+}
+
+func TestQueryFlowsBucketing(t *testing.T) {
+	bucket := time.Date(2026, 3, 1, 12, 5, 0, 0, time.UTC)
+	tests := []struct {
+		granularity Granularity
+		table       string
+		bucket      string // Bucket expression; empty for none
+	}{
+		{GranularityNone, "transfer_flows_hourly", ""},
+		{GranularityRaw, "transfer_events", "toStartOfMinute(timestamp) AS bucket"},
+		{Granularity5Min, "transfer_events", "toStartOfFiveMinutes(timestamp) AS bucket"},
+		{GranularityHourly, "transfer_flows_hourly", "hour AS bucket"},
+		{GranularityDaily, "transfer_flows_hourly", "toStartOfDay(hour) AS bucket"},
+	}
+	for _, tt := range tests {
+		row := flowRow()
+		if tt.bucket != "" {
+			row = append([]any{bucket}, row...)
+		}
+		store, conn := newFakeStore(row)
+
+		results, err := store.QueryFlows(context.Background(), FlowQuery{
+			Start:       bucket.Add(-24 * time.Hour),
+			End:         bucket,
+			Granularity: tt.granularity,
+			Limit:       100,
+		})
+		if err != nil {
+			t.Errorf("%q: %v", tt.granularity, err)
+			continue
+		}
+		sql := conn.lastQuery().sql
+		if !strings.Contains(sql, "FROM "+tt.table) {
+			t.Errorf("%q: query does not read %s:\n%s", tt.granularity, tt.table, sql)
+		}
+		if tt.bucket == "" {
+			if strings.Contains(sql, "bucket") {
+				t.Errorf("%q: query is bucketed:\n%s", tt.granularity, sql)
+			}
+		} else if !strings.Contains(sql, tt.bucket) || !strings.Contains(sql, "GROUP BY bucket,") {
+			t.Errorf("%q: query does not group by %s:\n%s", tt.granularity, tt.bucket, sql)
+		}
+
+		wantBucket := time.Time{}
+		if tt.bucket != "" {
+			wantBucket = bucket
+		}
+		if len(results) != 1 || !results[0].Bucket.Equal(wantBucket) || results[0].TotalBytes != 1000 {
+			t.Errorf("%q: results = %+v, want one flow in bucket %v", tt.granularity, results, wantBucket)
+		}
+	}
+}
+
+func TestQueryFlowsByPodBucketsRawEvents(t *testing.T) {
+	store, conn := newFakeStore(append([]any{time.Now(), "api-0"}, flowRow()...))
+	if _, err := store.QueryFlows(context.Background(), FlowQuery{
+		Granularity: GranularityDaily,
+		GroupBy:     GroupByPod,
+		Limit:       100,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sql := conn.lastQuery().sql; !strings.Contains(sql, "FROM transfer_events") || !strings.Contains(sql, "toStartOfDay(timestamp) AS bucket") {
+		t.Errorf("pods are only on raw events, but the query is:\n%s", sql)
+	}
+}
+
+func TestQueryFlowsGroupByPod(t *testing.T) {
+	store, conn := newFakeStore(
+		append([]any{"api-0"}, flowRow()...),
+		append([]any{"api-1"}, flowRow()...),
+	)
+	results, err := store.QueryFlows(context.Background(), FlowQuery{GroupBy: GroupByPod, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql := conn.lastQuery().sql
+	if !strings.Contains(sql, "FROM transfer_events") || !strings.Contains(sql, "GROUP BY src_pod, src_namespace, src_service") {
+		t.Errorf("query does not split services by pod:\n%s", sql)
+	}
+	if len(results) != 2 || results[0].SrcPod != "api-0" || results[1].SrcPod != "api-1" || results[0].SrcService != "api" {
+		t.Fatalf("results = %+v, want api split into api-0 and api-1", results)
+	}
+	if flow := results[1].ToFlow(time.Time{}, time.Time{}); flow.SourceIdentity.PodName != "api-1" {
+		t.Errorf("flow source = %+v, want the pod name kept", flow.SourceIdentity)
+	}
+}
+
+func TestQueryFlowsGroupByVersion(t *testing.T) {
+	store, conn := newFakeStore(append([]any{"v2"}, flowRow()...))
+	results, err := store.QueryFlows(context.Background(), FlowQuery{GroupBy: GroupByVersion, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql := conn.lastQuery().sql; !strings.Contains(sql, "GROUP BY src_version, src_namespace") {
+		t.Errorf("query does not split services by version:\n%s", sql)
+	}
+	if len(results) != 1 || results[0].SrcVersion != "v2" || results[0].SrcPod != "" {
+		t.Errorf("results = %+v, want version v2", results)
+	}
+}
+
+func TestParseFlowGrouping(t *testing.T) {
+	for name, want := range map[string]FlowGrouping{"": GroupByService, "pod": GroupByPod, "version": GroupByVersion} {
+		if g, err := ParseFlowGrouping(name); err != nil || g != want {
+			t.Errorf("%q = %q, %v; want %q", name, g, err, want)
+		}
+	}
+	if _, err := ParseFlowGrouping("node"); err == nil {
+		t.Error("node accepted")
+	}
+}
+
+func TestPodGroupingIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	namespace := "pods-" + uuid.NewString()[:8]
+	now := time.Now().UTC()
+
+	var events []types.TransferEvent
+	for pod, count := range map[string]int{"api-0": 3, "api-1": 1} {
+		for i := 0; i < count; i++ {
+			events = append(events, types.TransferEvent{
+				ID:          uuid.New(),
+				Timestamp:   now,
+				Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: namespace, Name: "api", PodName: pod}},
+				Destination: types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+				Protocol:    "TCP",
+				Type:        types.TransferTypeEgress,
+				BytesSent:   100,
+			})
+		}
+	}
+	if _, err := store.InsertEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := store.QueryFlows(ctx, FlowQuery{
+		Start:        now.Add(-time.Minute),
+		End:          now.Add(time.Minute),
+		SrcNamespace: namespace,
+		GroupBy:      GroupByPod,
+		Limit:        100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes := make(map[string]uint64)
+	for _, r := range results {
+		bytes[r.SrcPod] += r.TotalBytes
+	}
+	if len(bytes) != 2 || bytes["api-0"] != 300 || bytes["api-1"] != 100 {
+		t.Errorf("bytes by pod = %v, want api-0 300 and api-1 100", bytes)
+	}
+}
+
+func TestParseGranularity(t *testing.T) {
+	for name, want := range map[string]time.Duration{"": 0, "raw": time.Minute, "5m": 5 * time.Minute, "hourly": time.Hour, "daily": 24 * time.Hour} {
+		g, err := ParseGranularity(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+		if g.Duration() != want {
+			t.Errorf("%q lasts %s, want %s", name, g.Duration(), want)
+		}
+	}
+	if _, err := ParseGranularity("weekly"); err == nil {
+		t.Error("weekly accepted")
+	}
+}
+
+func TestGranularityBucketsIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	namespace := "granularity-" + uuid.NewString()[:8]
+	// Yesterday noon, so every event falls on one day
+	base := time.Now().UTC().Truncate(24 * time.Hour).Add(-12 * time.Hour)
+
+	var events []types.TransferEvent
+	for _, offset := range []time.Duration{time.Minute, 3 * time.Minute, 7 * time.Minute, 65 * time.Minute} {
+		events = append(events, types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   base.Add(offset),
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: namespace, Name: "api"}},
+			Destination: types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   100,
+		})
+	}
+	if _, err := store.InsertEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	for granularity, want := range map[Granularity]int{GranularityRaw: 4, Granularity5Min: 3, GranularityHourly: 2, GranularityDaily: 1} {
+		results, err := store.QueryFlows(ctx, FlowQuery{
+			Start:        base,
+			End:          base.Add(2 * time.Hour),
+			SrcNamespace: namespace,
+			Granularity:  granularity,
+			Limit:        100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bytes uint64
+		for _, r := range results {
+			bytes += r.TotalBytes
+			if d := granularity.Duration(); !r.Bucket.Equal(r.Bucket.Truncate(d)) {
+				t.Errorf("%q: bucket %v not aligned to %s", granularity, r.Bucket, d)
+			}
+		}
+		if len(results) != want || bytes != 400 {
+			t.Errorf("%q: %d buckets with %d bytes, want %d buckets with 400 bytes", granularity, len(results), bytes, want)
+		}
+	}
+}
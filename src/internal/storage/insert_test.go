@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// insertEvents returns n egress events.
+func insertEvents(n int) []types.TransferEvent {
+	events := make([]types.TransferEvent, n)
+	for i := range events {
+		events[i] = types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   time.Date(2026, 3, 1, 12, 0, i, 0, time.UTC),
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: "shop", Name: "api"}},
+			Destination: types.Endpoint{IP: fmt.Sprintf("203.0.113.%d", i), IsInternet: true},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   100,
+		}
+	}
+	return events
+}
+
+// rejectID makes Append fail for the row of the event with id.
+func rejectID(id uuid.UUID) func(row []any) error {
+	return func(row []any) error {
+		if row[0] == id {
+			return errors.New("clickhouse [Append]: converting String to UInt8 is unsupported")
+		}
+		return nil
+	}
+}
+
+func TestInsertEventsSkipsInvalidRow(t *testing.T) {
+	store, conn := newFakeStore()
+	events := insertEvents(5)
+	conn.appendErr = rejectID(events[2].ID)
+
+	result, err := store.InsertEvents(context.Background(), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 4 || result.Skipped != 1 {
+		t.Errorf("inserted %d skipped %d, want 4 and 1", result.Inserted, result.Skipped)
+	}
+	if len(conn.sent) != 1 {
+		t.Fatalf("sent %d batches, want 1", len(conn.sent))
+	}
+	rows := conn.sent[0].rows
+	if len(rows) != 4 {
+		t.Fatalf("sent %d rows, want the 4 valid ones", len(rows))
+	}
+	for _, row := range rows {
+		if row[0] == events[2].ID {
+			t.Error("invalid row was sent")
+		}
+	}
+}
+
+func TestInsertEventsAllRowsInvalid(t *testing.T) {
+	store, conn := newFakeStore()
+	conn.appendErr = func([]any) error { return errors.New("bad row") }
+
+	result, err := store.InsertEvents(context.Background(), insertEvents(3))
+	if err != nil || result.Inserted != 0 || result.Skipped != 3 {
+		t.Errorf("got %+v, %v; want all 3 skipped without error", result, err)
+	}
+	if len(conn.sent) != 0 {
+		t.Errorf("sent %d empty batches", len(conn.sent))
+	}
+}
+
+func TestInsertEventsRetriesTransientFailure(t *testing.T) {
+	store, conn := newFakeStore()
+	var attempts atomic.Int32
+	conn.sendErr = func(string) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("write: broken pipe")
+		}
+		return nil
+	}
+
+	result, err := store.InsertEvents(context.Background(), insertEvents(3))
+	if err != nil || result.Inserted != 3 {
+		t.Errorf("got %+v, %v; want all 3 inserted on retry", result, err)
+	}
+	if attempts.Load() != 2 || len(conn.sent) != 1 {
+		t.Errorf("%d attempts, %d batches sent; want a retry and one batch", attempts.Load(), len(conn.sent))
+	}
+}
+
+func TestInsertRetriesReuseDeduplicationToken(t *testing.T) {
+	store, conn := newFakeStore()
+	var attempts atomic.Int32
+	conn.sendErr = func(string) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("read: connection reset by peer")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	if _, err := store.InsertEvents(ctx, insertEvents(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.InsertEvents(ctx, insertEvents(3)); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.prepared) != 3 {
+		t.Fatalf("prepared %d batches, want a retry and a second insert", len(conn.prepared))
+	}
+
+	first := querySetting(conn.prepared[0], "insert_deduplication_token")
+	if first == "" {
+		t.Fatal("insert carries no deduplication token")
+	}
+	if retry := querySetting(conn.prepared[1], "insert_deduplication_token"); retry != first {
+		t.Errorf("retry token = %q, want the first attempt's %q", retry, first)
+	}
+	if next := querySetting(conn.prepared[2], "insert_deduplication_token"); next == first {
+		t.Error("a new batch reused the previous batch's token")
+	}
+	if got := querySetting(conn.prepared[0], "deduplicate_blocks_in_dependent_materialized_views"); got != "1" {
+		t.Errorf("dependent view deduplication = %q, want 1", got)
+	}
+}
+
+func TestInsertEventsDoesNotRetryRejection(t *testing.T) {
+	store, conn := newFakeStore()
+	var attempts atomic.Int32
+	conn.sendErr = func(string) error {
+		attempts.Add(1)
+		return &clickhouse.Exception{Code: 27, Message: "Cannot parse input"}
+	}
+
+	if _, err := store.InsertEvents(context.Background(), insertEvents(3)); err == nil {
+		t.Error("want the server's rejection returned")
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("%d attempts, want a rejected batch sent once", attempts.Load())
+	}
+}
+
+func TestInsertEventsAtomicSendsOneBatch(t *testing.T) {
+	store, conn := newFakeStore()
+	events := insertEvents(5)
+	conn.appendErr = rejectID(events[1].ID)
+
+	result, err := store.InsertEventsAtomic(context.Background(), events[:3], events[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 4 || result.Retained != 2 || result.Skipped != 1 {
+		t.Errorf("got %+v, want 4 inserted, 2 retained, 1 skipped", result)
+	}
+	if len(conn.sent) != 1 {
+		t.Fatalf("sent %d batches, want raw and aggregate-only events in one", len(conn.sent))
+	}
+	if conn.sent[0].sql != insertIngestSQL {
+		t.Errorf("sent to %q, want the ingest table", conn.sent[0].sql)
+	}
+
+	retained := make(map[any]uint8)
+	for _, row := range conn.sent[0].rows {
+		retained[row[0]] = row[len(row)-1].(uint8)
+	}
+	for i, e := range events {
+		want := uint8(0)
+		if i < 3 {
+			want = 1
+		}
+		if got, ok := retained[e.ID]; i != 1 && (!ok || got != want) {
+			t.Errorf("event %d: retained = %d (sent %v), want %d", i, got, ok, want)
+		}
+	}
+}
+
+func TestInsertEventsAtomicCompletesPartialWrite(t *testing.T) {
+	store, conn := newFakeStore()
+
+	// Stand in for the server: the raw events view writes its block, then
+	// the aggregate view fails. Blocks already stored under a token are
+	// skipped, as with non_replicated_deduplication_window.
+	written := map[string]map[string]int{"raw": {}, "hourly": {}}
+	var attempts int
+	conn.sendErr = func(string) error {
+		attempts++
+		conn.mu.Lock()
+		token := querySetting(conn.prepared[len(conn.prepared)-1], "insert_deduplication_token")
+		conn.mu.Unlock()
+
+		for _, table := range []string{"raw", "hourly"} {
+			if written[table][token] > 0 {
+				continue
+			}
+			if table == "hourly" && attempts == 1 {
+				return errors.New("read: connection reset by peer")
+			}
+			written[table][token]++
+		}
+		return nil
+	}
+
+	if _, err := store.InsertEventsAtomic(context.Background(), insertEvents(2), insertEvents(1)); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("%d attempts, want the partial write retried once", attempts)
+	}
+	for table, blocks := range written {
+		if len(blocks) != 1 {
+			t.Errorf("%s: written under %d tokens, want one token across attempts", table, len(blocks))
+		}
+		for _, n := range blocks {
+			if n != 1 {
+				t.Errorf("%s: block written %d times, want once", table, n)
+			}
+		}
+	}
+}
+
+func TestInsertEventsAtomicIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	namespace := "atomic-" + uuid.NewString()[:8]
+	now := time.Now().UTC()
+
+	events := insertEvents(5)
+	for i := range events {
+		events[i].Timestamp = now
+		events[i].Source.Identity = &types.ServiceIdentity{Namespace: namespace, Name: "api"}
+	}
+	if _, err := store.InsertEventsAtomic(ctx, events[:3], events[3:]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Raw events hold the retained events; the aggregates hold all of them
+	for granularity, want := range map[Granularity]uint64{GranularityRaw: 3, GranularityHourly: 5} {
+		results, err := store.QueryFlows(ctx, FlowQuery{
+			Start:        now.Add(-time.Hour),
+			End:          now.Add(time.Hour),
+			SrcNamespace: namespace,
+			Granularity:  granularity,
+			Limit:        100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bytes, count uint64
+		for _, r := range results {
+			bytes += r.TotalBytes
+			count += r.EventCount
+		}
+		if count != want || bytes != want*100 {
+			t.Errorf("%q: %d bytes over %d events, want %d over %d", granularity, bytes, count, want*100, want)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migration is a versioned schema change applied on top of the base schema.
+type migration struct {
+	Version     uint32
+	Description string
+	Statements  []string
+}
+
+// migrations lists schema changes in order. Never edit or reorder an applied
+// migration; append a new one instead.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "add destination country and ASN to transfer events",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS dst_country LowCardinality(String) AFTER dst_cloud_service`,
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS dst_asn UInt32 AFTER dst_country`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "add source deployment version to transfer events",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS src_version LowCardinality(String) AFTER src_region`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "add aggregate-only ingest path for unretained raw events",
+		Statements: []string{
+			// Events dropped by raw retention sampling are written here. The Null
+			// engine discards rows, but the MV still folds them into the hourly
+			// aggregates. Later column changes to transfer_events must be
+			// mirrored on this table.
+			`CREATE TABLE IF NOT EXISTS transfer_events_unretained AS transfer_events ENGINE = Null`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				sumState(bytes_sent + bytes_received) AS total_bytes,
+				sumState(packets_sent + packets_received) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events_unretained
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "add source team to transfer events",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS src_team LowCardinality(String) AFTER src_version`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS src_team LowCardinality(String) AFTER src_version`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "add custom pricing rules table",
+		Statements: []string{
+			// Rules are stored as JSON. Deletes write a tombstone row; the
+			// newest row per id wins.
+			`CREATE TABLE IF NOT EXISTS pricing_rules (
+				id UUID,
+				rule String,
+				deleted UInt8 DEFAULT 0,
+				updated_at DateTime64(3)
+			) ENGINE = ReplacingMergeTree(updated_at)
+			ORDER BY id`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "add fronting Kubernetes Services to transfer events",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS src_k8s_services Array(String) AFTER src_team`,
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS dst_k8s_services Array(String) AFTER dst_region`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS src_k8s_services Array(String) AFTER src_team`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS dst_k8s_services Array(String) AFTER dst_region`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "scale hourly aggregates by event sample rate",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS sample_rate Float64 DEFAULT 1`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS sample_rate Float64 DEFAULT 1`,
+			// Views cannot be altered in place. Events inserted between the
+			// drop and the create miss the hourly aggregates.
+			`DROP VIEW IF EXISTS transfer_flows_hourly_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type`,
+			`DROP VIEW IF EXISTS transfer_flows_hourly_unretained_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events_unretained
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "add single-insert ingest table routing raw and unretained events",
+		Statements: []string{
+			// transfer_events_ingest stores nothing; its views route each row
+			// by the retained flag, so one insert feeds both raw events and
+			// the hourly aggregates. Column changes to transfer_events must
+			// be mirrored here.
+			`CREATE TABLE IF NOT EXISTS transfer_events_ingest AS transfer_events ENGINE = Null`,
+			`ALTER TABLE transfer_events_ingest ADD COLUMN IF NOT EXISTS retained UInt8 DEFAULT 1`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_events_ingest_retained_mv
+			TO transfer_events AS
+			SELECT * EXCEPT (retained)
+			FROM transfer_events_ingest
+			WHERE retained = 1`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_events_ingest_unretained_mv
+			TO transfer_events_unretained AS
+			SELECT * EXCEPT (retained)
+			FROM transfer_events_ingest
+			WHERE retained = 0`,
+		},
+	},
+	{
+		Version:     9,
+		Description: "add optional aggregation dimensions to hourly flows",
+		Statements: []string{
+			// New columns can only join the sorting key in the ALTER that adds
+			// them. They must be in the key, or merges would collapse rows
+			// that differ only by a dimension.
+			`ALTER TABLE transfer_flows_hourly
+				ADD COLUMN dst_cloud_service LowCardinality(String) DEFAULT '',
+				ADD COLUMN http_path String DEFAULT '',
+				ADD COLUMN grpc_method String DEFAULT '',
+				MODIFY ORDER BY (hour, src_namespace, src_service, dst_namespace, dst_service, dst_cloud_service, http_path, grpc_method)`,
+			// Rebuild both hourly views to write the new columns, with no
+			// dimension selected; SetAggregationDimensions regroups them
+			`DROP VIEW IF EXISTS transfer_flows_hourly_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+			`DROP VIEW IF EXISTS transfer_flows_hourly_unretained_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events_unretained
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+		},
+	},
+	{
+		Version:     10,
+		Description: "add source workload labels to transfer events",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS src_labels Map(String, String) AFTER src_k8s_services`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS src_labels Map(String, String) AFTER src_k8s_services`,
+			`ALTER TABLE transfer_events_ingest ADD COLUMN IF NOT EXISTS src_labels Map(String, String) AFTER src_k8s_services`,
+		},
+	},
+	{
+		Version:     11,
+		Description: "record the raw sample rate of retained events",
+		Statements: []string{
+			// Raw-event queries report raw_sample_rate as coverage; the
+			// hourly views see every event and scale by sample_rate alone.
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS raw_sample_rate Float64 DEFAULT 1 AFTER sample_rate`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS raw_sample_rate Float64 DEFAULT 1 AFTER sample_rate`,
+			`ALTER TABLE transfer_events_ingest ADD COLUMN IF NOT EXISTS raw_sample_rate Float64 DEFAULT 1 AFTER sample_rate`,
+		},
+	},
+	{
+		Version:     12,
+		Description: "keep external destination hostnames and cloud services in hourly flows",
+		Statements: []string{
+			// Not part of the sorting key: an IP has one name, and rows
+			// merge keeping the largest, so a known name wins over ''
+			`ALTER TABLE transfer_flows_hourly
+				ADD COLUMN IF NOT EXISTS dst_hostname_hint SimpleAggregateFunction(max, String) DEFAULT '',
+				ADD COLUMN IF NOT EXISTS dst_cloud_service_hint SimpleAggregateFunction(max, String) DEFAULT ''`,
+			// Rebuild both hourly views to write them, with no dimension
+			// selected; SetAggregationDimensions regroups them
+			`DROP VIEW IF EXISTS transfer_flows_hourly_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+			`DROP VIEW IF EXISTS transfer_flows_hourly_unretained_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events_unretained
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+		},
+	},
+	{
+		Version:     13,
+		Description: "record the baseline flow key of anomalies",
+		Statements: []string{
+			`ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS flow_key String DEFAULT '' AFTER dst_endpoint`,
+		},
+	},
+	{
+		Version:     14,
+		Description: "record the cloud provider of source workloads",
+		Statements: []string{
+			// Pricing rules are chosen by the source's provider
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS src_cloud_provider LowCardinality(String) DEFAULT '' AFTER src_region`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS src_cloud_provider LowCardinality(String) DEFAULT '' AFTER src_region`,
+			`ALTER TABLE transfer_events_ingest ADD COLUMN IF NOT EXISTS src_cloud_provider LowCardinality(String) DEFAULT '' AFTER src_region`,
+			// A source runs on one provider; like the destination hints it
+			// stays out of the sorting key
+			`ALTER TABLE transfer_flows_hourly
+				ADD COLUMN IF NOT EXISTS src_cloud_provider_hint SimpleAggregateFunction(max, String) DEFAULT ''`,
+			// Rebuild both hourly views to write it, with no dimension
+			// selected; SetAggregationDimensions regroups them
+			`DROP VIEW IF EXISTS transfer_flows_hourly_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				max(src_cloud_provider) AS src_cloud_provider_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+			`DROP VIEW IF EXISTS transfer_flows_hourly_unretained_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				max(src_cloud_provider) AS src_cloud_provider_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events_unretained
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+		},
+	},
+	{
+		Version:     15,
+		Description: "record well-known services such as DNS apart from cloud services",
+		Statements: []string{
+			`ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS dst_well_known_service LowCardinality(String) DEFAULT '' AFTER dst_cloud_service`,
+			`ALTER TABLE transfer_events_unretained ADD COLUMN IF NOT EXISTS dst_well_known_service LowCardinality(String) DEFAULT '' AFTER dst_cloud_service`,
+			`ALTER TABLE transfer_events_ingest ADD COLUMN IF NOT EXISTS dst_well_known_service LowCardinality(String) DEFAULT '' AFTER dst_cloud_service`,
+			`ALTER TABLE transfer_flows_hourly
+				ADD COLUMN IF NOT EXISTS dst_well_known_service_hint SimpleAggregateFunction(max, String) DEFAULT ''`,
+			// Rebuild both hourly views to write it, with no dimension
+			// selected; SetAggregationDimensions regroups them
+			`DROP VIEW IF EXISTS transfer_flows_hourly_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				max(src_cloud_provider) AS src_cloud_provider_hint,
+				max(dst_well_known_service) AS dst_well_known_service_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+			`DROP VIEW IF EXISTS transfer_flows_hourly_unretained_mv`,
+			`CREATE MATERIALIZED VIEW IF NOT EXISTS transfer_flows_hourly_unretained_mv
+			TO transfer_flows_hourly AS
+			SELECT
+				toStartOfHour(timestamp) AS hour,
+				src_namespace,
+				src_service,
+				dst_namespace,
+				dst_service,
+				if(dst_is_internet = 1, dst_ip, '') AS dst_external,
+				transfer_type,
+				'' AS dst_cloud_service,
+				'' AS http_path,
+				'' AS grpc_method,
+				max(dst_hostname) AS dst_hostname_hint,
+				max(dst_cloud_service) AS dst_cloud_service_hint,
+				max(src_cloud_provider) AS src_cloud_provider_hint,
+				max(dst_well_known_service) AS dst_well_known_service_hint,
+				sumState(toUInt64(round((bytes_sent + bytes_received) / sample_rate))) AS total_bytes,
+				sumState(toUInt64(round((packets_sent + packets_received) / sample_rate))) AS total_packets,
+				countState() AS event_count,
+				avgState(bytes_sent + bytes_received) AS bytes_avg,
+				maxState(bytes_sent + bytes_received) AS bytes_max
+			FROM transfer_events_unretained
+			GROUP BY hour, src_namespace, src_service, dst_namespace, dst_service, dst_external, transfer_type, dst_cloud_service, http_path, grpc_method`,
+		},
+	},
+	{
+		Version:     16,
+		Description: "deduplicate retried event inserts",
+		Statements: []string{
+			// Inserts carry insert_deduplication_token; tables that are not
+			// replicated only honour it within this window of recent blocks
+			`ALTER TABLE transfer_events MODIFY SETTING non_replicated_deduplication_window = 1000`,
+			`ALTER TABLE transfer_flows_hourly MODIFY SETTING non_replicated_deduplication_window = 1000`,
+		},
+	},
+	{
+		Version:     17,
+		Description: "version anomaly updates instead of mutating rows",
+		Statements: []string{
+			// Each update inserts a full row; the latest updated_at wins
+			`CREATE TABLE IF NOT EXISTS anomalies_versioned (
+				id UUID,
+				type LowCardinality(String),
+				severity LowCardinality(String),
+				src_service LowCardinality(String),
+				dst_service LowCardinality(String),
+				dst_endpoint String,
+				flow_key String DEFAULT '',
+
+				detected_at DateTime64(3),
+				started_at Nullable(DateTime64(3)),
+				ended_at Nullable(DateTime64(3)),
+
+				current_value Float64,
+				baseline_value Float64,
+				deviation Float64,
+				absolute_delta Float64,
+
+				estimated_cost_impact_usd Float64,
+				estimated_monthly_impact_usd Float64,
+
+				acknowledged UInt8 DEFAULT 0,
+				resolved UInt8 DEFAULT 0,
+				ai_summary String,
+
+				created_at DateTime DEFAULT now(),
+				updated_at DateTime64(3) DEFAULT now64(3)
+			) ENGINE = ReplacingMergeTree(updated_at)
+			PARTITION BY toYYYYMM(detected_at)
+			ORDER BY (detected_at, id)
+			TTL detected_at + INTERVAL 180 DAY`,
+			`INSERT INTO anomalies_versioned
+			SELECT
+				id, type, severity, src_service, dst_service, dst_endpoint, flow_key,
+				detected_at, started_at, ended_at,
+				current_value, baseline_value, deviation, absolute_delta,
+				estimated_cost_impact_usd, estimated_monthly_impact_usd,
+				acknowledged, resolved, ai_summary, created_at, created_at AS updated_at
+			FROM anomalies`,
+			`RENAME TABLE anomalies TO anomalies_mutated, anomalies_versioned TO anomalies`,
+			`DROP TABLE IF EXISTS anomalies_mutated`,
+		},
+	},
+}
+
+// migrationsTableDDL creates the table recording applied migrations.
+const migrationsTableDDL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version UInt32,
+		description String,
+		applied_at DateTime DEFAULT now()
+	) ENGINE = MergeTree()
+	ORDER BY version
+	`
+
+// LatestSchemaVersion returns the version of the newest known migration.
+func LatestSchemaVersion() uint32 {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaDDL returns every statement run against a fresh database, in order:
+// the base schema, the migrations table, then all migrations.
+func SchemaDDL() []string {
+	var ddl []string
+	for _, stmt := range baseSchema {
+		ddl = append(ddl, stmt.DDL)
+	}
+	ddl = append(ddl, migrationsTableDDL)
+	for _, m := range migrations {
+		ddl = append(ddl, m.Statements...)
+	}
+	return ddl
+}
+
+// applyMigrations applies all migrations newer than the recorded schema version.
+func (s *ClickHouseStore) applyMigrations(ctx context.Context) error {
+	if err := s.conn.Exec(ctx, migrationsTableDDL); err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		for _, stmt := range m.Statements {
+			if err := s.conn.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("applying migration %d: %w", m.Version, err)
+			}
+		}
+
+		if err := s.conn.Exec(ctx,
+			"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+			m.Version, m.Description,
+		); err != nil {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+
+		log.Info().
+			Uint32("version", m.Version).
+			Str("description", m.Description).
+			Msg("Applied schema migration")
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the latest applied migration version.
+func (s *ClickHouseStore) SchemaVersion(ctx context.Context) (uint32, error) {
+	var version uint32
+	if err := s.conn.QueryRow(ctx, "SELECT max(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrationVersionsAreSequential(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != uint32(i+1) {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Description == "" || len(m.Statements) == 0 {
+			t.Errorf("migration %d has no description or statements", m.Version)
+		}
+	}
+}
+
+func TestMigrationNineViewsHaveNoDimensions(t *testing.T) {
+	// Changing how the hourly views are built must not change what
+	// migration 9 ran on existing installs.
+	var m9 migration
+	for _, m := range migrations {
+		if m.Version == 9 {
+			m9 = m
+		}
+	}
+	for _, stmt := range m9.Statements {
+		if strings.Contains(stmt, "CREATE MATERIALIZED VIEW") && !strings.Contains(stmt, "'' AS dst_cloud_service") {
+			t.Errorf("migration 9 view groups by a dimension:\n%s", stmt)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+// SavePricingRule stores or replaces a custom pricing rule.
+func (s *ClickHouseStore) SavePricingRule(ctx context.Context, rule types.PricingRule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("encoding pricing rule: %w", err)
+	}
+	if err := s.conn.Exec(ctx,
+		`INSERT INTO pricing_rules (id, rule, deleted, updated_at) VALUES (?, ?, 0, ?)`,
+		rule.ID, string(data), time.Now(),
+	); err != nil {
+		return fmt.Errorf("saving pricing rule: %w", err)
+	}
+	return nil
+}
+
+// DeletePricingRule marks a stored pricing rule as deleted.
+func (s *ClickHouseStore) DeletePricingRule(ctx context.Context, id uuid.UUID) error {
+	if err := s.conn.Exec(ctx,
+		`INSERT INTO pricing_rules (id, rule, deleted, updated_at) VALUES (?, '', 1, ?)`,
+		id, time.Now(),
+	); err != nil {
+		return fmt.Errorf("deleting pricing rule: %w", err)
+	}
+	return nil
+}
+
+// LoadPricingRules returns all stored pricing rules that are not deleted,
+// oldest first.
+func (s *ClickHouseStore) LoadPricingRules(ctx context.Context) ([]types.PricingRule, error) {
+	rows, err := s.conn.Query(ctx, `
+		SELECT rule
+		FROM pricing_rules FINAL
+		WHERE deleted = 0
+		ORDER BY updated_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying pricing rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []types.PricingRule
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		var rule types.PricingRule
+		if err := json.Unmarshal([]byte(data), &rule); err != nil {
+			return nil, fmt.Errorf("decoding pricing rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return rules, nil
+}
+
+// LoadDeletedPricingRuleIDs returns the IDs of deleted pricing rules,
+// including deleted built-in defaults.
+func (s *ClickHouseStore) LoadDeletedPricingRuleIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := s.conn.Query(ctx, `
+		SELECT id
+		FROM pricing_rules FINAL
+		WHERE deleted = 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying deleted pricing rules: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+	return ids, nil
+}
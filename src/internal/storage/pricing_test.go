@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestPricingRulePersistence(t *testing.T) {
+	rule := types.PricingRule{
+		ID:            uuid.New(),
+		Name:          "Negotiated egress",
+		CloudProvider: types.CloudProviderAWS,
+		Category:      types.CostCategoryEgressInternet,
+		CostPerGB:     0.05,
+	}
+	data, err := json.Marshal(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, conn := newFakeStore([]any{string(data)})
+	ctx := context.Background()
+
+	if err := store.SavePricingRule(ctx, rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeletePricingRule(ctx, rule.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.execs) != 2 {
+		t.Errorf("ran %d statements, want a save and a delete marker", len(conn.execs))
+	}
+
+	rules, err := store.LoadPricingRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].ID != rule.ID || rules[0].CostPerGB != 0.05 {
+		t.Errorf("loaded %+v, want the stored rule", rules)
+	}
+
+	bad, _ := newFakeStore([]any{"{not json"})
+	if _, err := bad.LoadPricingRules(ctx); err == nil {
+		t.Error("want error for an undecodable rule")
+	}
+}
+
+func TestLoadDeletedPricingRuleIDs(t *testing.T) {
+	id := uuid.New()
+	store, conn := newFakeStore([]any{id})
+	ids, err := store.LoadDeletedPricingRuleIDs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Errorf("deleted IDs = %v, want [%s]", ids, id)
+	}
+	if sql := conn.lastQuery().sql; !strings.Contains(sql, "deleted = 1") {
+		t.Errorf("query does not select deletions:\n%s", sql)
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/egressor/egressor/src/pkg/types"
+)
+
+func TestEventRowStoresSampleRate(t *testing.T) {
+	for rate, want := range map[float64]float64{0: 1, 0.25: 0.25, 1: 1, 2: 1, -0.5: 1} {
+		row := eventRow(types.TransferEvent{SampleRate: rate})
+		if got := column(t, row, "sample_rate"); got != want {
+			t.Errorf("sample rate %v stored as %v, want %v", rate, got, want)
+		}
+	}
+}
+
+func TestRawFlowQueriesScaleBySampleRate(t *testing.T) {
+	store, conn := newFakeStore(append([]any{time.Now()}, flowRow()...))
+	if _, err := store.QueryFlows(context.Background(), FlowQuery{Granularity: GranularityRaw, Limit: 100}); err != nil {
+		t.Fatal(err)
+	}
+	sql := conn.lastQuery().sql
+	if !strings.Contains(sql, scaledBytesSum+" AS total_bytes") || !strings.Contains(sql, scaledPacketsSum+" AS total_packets") {
+		t.Errorf("raw query does not scale by sample rate:\n%s", sql)
+	}
+	if !strings.Contains(sql, rawCoverage+" AS raw_sample_rate") {
+		t.Errorf("raw query does not report raw coverage:\n%s", sql)
+	}
+}
+
+func TestMixedSampleRatesIntegration(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+	namespace := "sampled-" + uuid.NewString()[:8]
+	now := time.Now().UTC()
+
+	// 100 bytes each, standing for 100, 200 and 400 bytes of traffic
+	var events []types.TransferEvent
+	for _, rate := range []float64{0, 0.5, 0.25} {
+		events = append(events, types.TransferEvent{
+			ID:          uuid.New(),
+			Timestamp:   now,
+			Source:      types.Endpoint{IP: "10.0.0.5", Identity: &types.ServiceIdentity{Namespace: namespace, Name: "api"}},
+			Destination: types.Endpoint{IP: "203.0.113.10", IsInternet: true},
+			Protocol:    "TCP",
+			Type:        types.TransferTypeEgress,
+			BytesSent:   100,
+			SampleRate:  rate,
+		})
+	}
+	if _, err := store.InsertEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, granularity := range []Granularity{GranularityNone, GranularityRaw} {
+		results, err := store.QueryFlows(ctx, FlowQuery{
+			Start:        now.Add(-time.Hour),
+			End:          now.Add(time.Hour),
+			SrcNamespace: namespace,
+			Granularity:  granularity,
+			Limit:        100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bytes, count uint64
+		for _, r := range results {
+			bytes += r.TotalBytes
+			count += r.EventCount
+		}
+		if bytes != 700 || count != 3 {
+			t.Errorf("%q: %d bytes over %d events, want 700 over 3", granularity, bytes, count)
+		}
+	}
+}
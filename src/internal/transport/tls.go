@@ -0,0 +1,102 @@
+// Package transport provides shared transport configuration for Egressor services.
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSConfig holds TLS settings for the agent-collector gRPC channel.
+type TLSConfig struct {
+	Enabled    bool
+	CAFile     string // CA bundle used to verify the peer
+	CertFile   string // Certificate presented to the peer
+	KeyFile    string // Private key for CertFile
+	ServerName string // Expected server name (client side only)
+	ClientAuth bool   // Require and verify client certificates (server side only)
+}
+
+// ClientConfig builds a tls.Config for dialing a TLS server.
+// Returns nil if TLS is disabled.
+func (c TLSConfig) ClientConfig() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	// Client certificate for mTLS
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// ServerConfig builds a tls.Config for serving TLS.
+// Returns nil if TLS is disabled.
+func (c TLSConfig) ServerConfig() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("TLS enabled but certificate or key file not set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if c.ClientAuth {
+		if c.CAFile == "" {
+			return nil, errors.New("client authentication requires a CA file")
+		}
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// loadCertPool reads a PEM-encoded CA bundle.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
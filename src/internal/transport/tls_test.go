@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDisabledTLSHasNoConfig(t *testing.T) {
+	client, err := TLSConfig{CAFile: "ca.pem"}.ClientConfig()
+	if client != nil || err != nil {
+		t.Errorf("client config = %v (%v), want nil", client, err)
+	}
+	server, err := TLSConfig{CertFile: "cert.pem"}.ServerConfig()
+	if server != nil || err != nil {
+		t.Errorf("server config = %v (%v), want nil", server, err)
+	}
+}
+
+func TestServerConfigValidation(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	for name, cfg := range map[string]TLSConfig{
+		"no certificate":           {Enabled: true},
+		"unreadable certificate":   {Enabled: true, CertFile: missing, KeyFile: missing},
+		"client auth without a CA": {Enabled: true, CertFile: missing, KeyFile: missing, ClientAuth: true},
+	} {
+		if _, err := cfg.ServerConfig(); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestClientConfigDefaults(t *testing.T) {
+	cfg, err := TLSConfig{Enabled: true, ServerName: "collector"}.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.ServerName != "collector" || cfg.RootCAs != nil {
+		t.Errorf("config = %+v, want TLS 1.2+, the server name and system roots", cfg)
+	}
+	if _, err := (TLSConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}).ClientConfig(); err == nil {
+		t.Error("want error for a missing CA file")
+	}
+}
+
+// testCA issues certificates for handshake tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // PEM file with the CA certificate
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, file: filepath.Join(dir, name+"-ca.pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate and key for name, returning their paths.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake runs a TLS handshake between the configs over loopback and
+// returns the server's and the client's errors.
+func handshake(t *testing.T, server, client TLSConfig) (serverErr, clientErr error) {
+	t.Helper()
+	serverTLS, err := server.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTLS, err := client.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Present the certificate even when its issuer is not among the CAs the
+	// server asks for; crypto/tls would otherwise send none
+	if len(clientTLS.Certificates) > 0 {
+		cert := &clientTLS.Certificates[0]
+		clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+
+	// A real socket: net.Pipe is unbuffered, so an alert written while the
+	// peer is still writing would deadlock
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		done <- tls.Server(conn, serverTLS).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	clientErr = tls.Client(conn, clientTLS).Handshake()
+	return <-done, clientErr
+}
+
+func TestServerRejectsClientFromAnotherCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "egressor")
+	serverCert, serverKey := ca.issue(t, dir, "collector", x509.ExtKeyUsageServerAuth)
+	server := TLSConfig{Enabled: true, CAFile: ca.file, CertFile: serverCert, KeyFile: serverKey, ClientAuth: true}
+
+	trustedCert, trustedKey := ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+	serverErr, clientErr := handshake(t, server, TLSConfig{
+		Enabled: true, CAFile: ca.file, CertFile: trustedCert, KeyFile: trustedKey, ServerName: "collector",
+	})
+	if serverErr != nil || clientErr != nil {
+		t.Fatalf("trusted client: server %v, client %v", serverErr, clientErr)
+	}
+
+	// The rogue certificate is well formed and trusts the right server, so
+	// only the server's CA check can reject it
+	rogue := newTestCA(t, dir, "rogue")
+	rogueCert, rogueKey := rogue.issue(t, dir, "intruder", x509.ExtKeyUsageClientAuth)
+	serverErr, _ = handshake(t, server, TLSConfig{
+		Enabled: true, CAFile: ca.file, CertFile: rogueCert, KeyFile: rogueKey, ServerName: "collector",
+	})
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	if !errors.As(serverErr, &verifyErr) || !errors.As(serverErr, &authorityErr) {
+		t.Errorf("server error = %v, want the client certificate rejected as signed by an unknown authority", serverErr)
+	}
+}
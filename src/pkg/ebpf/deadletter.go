@@ -0,0 +1,137 @@
+package ebpf
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// deadLetterCapacity bounds the number of failed records kept for
+// diagnostics; older records are dropped first.
+const deadLetterCapacity = 256
+
+// deadLetterMaxData caps the raw bytes kept per failed record.
+const deadLetterMaxData = 128
+
+// Record kinds reported with dead letters.
+const (
+	RecordKindFlow   = "flow"
+	RecordKindEgress = "egress"
+)
+
+// errShortRecord is returned when a record is smaller than its struct.
+var errShortRecord = errors.New("record too short")
+
+// DeadLetter is a raw eBPF record that could not be parsed.
+type DeadLetter struct {
+	Kind       string    `json:"kind"`
+	Reason     string    `json:"reason"`
+	Error      string    `json:"error"`
+	Size       int       `json:"size"`
+	Data       []byte    `json:"data"` // Leading bytes of the record
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// deadLetters is a bounded ring of failed records with a failure counter.
+type deadLetters struct {
+	records  []DeadLetter
+	next     int
+	full     bool
+	failures *prometheus.CounterVec
+	mu       sync.Mutex
+}
+
+func newDeadLetters() *deadLetters {
+	return &deadLetters{
+		records: make([]DeadLetter, deadLetterCapacity),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "egressor_ebpf_parse_failures_total",
+			Help: "eBPF records that could not be parsed, by kind and reason",
+		}, []string{"kind", "reason"}),
+	}
+}
+
+// add records a failed record and counts it.
+func (d *deadLetters) add(kind string, data []byte, err error) {
+	reason := parseFailureReason(err)
+	d.failures.WithLabelValues(kind, reason).Inc()
+
+	kept := data
+	if len(kept) > deadLetterMaxData {
+		kept = kept[:deadLetterMaxData]
+	}
+	dl := DeadLetter{
+		Kind:       kind,
+		Reason:     reason,
+		Error:      err.Error(),
+		Size:       len(data),
+		Data:       append([]byte(nil), kept...),
+		ReceivedAt: time.Now(),
+	}
+
+	d.mu.Lock()
+	d.records[d.next] = dl
+	d.next = (d.next + 1) % len(d.records)
+	if d.next == 0 {
+		d.full = true
+	}
+	d.mu.Unlock()
+
+	log.Debug().Err(err).Str("kind", kind).Int("size", len(data)).Msg("Dropped unparseable eBPF record")
+}
+
+// list returns the buffered records, oldest first.
+func (d *deadLetters) list() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.full {
+		return append([]DeadLetter(nil), d.records[:d.next]...)
+	}
+	out := make([]DeadLetter, 0, len(d.records))
+	out = append(out, d.records[d.next:]...)
+	return append(out, d.records[:d.next]...)
+}
+
+// parseFailureReason maps a parse error to a low-cardinality metric label.
+func parseFailureReason(err error) string {
+	if errors.Is(err, errShortRecord) {
+		return "short_record"
+	}
+	return "malformed"
+}
+
+// HandleFlowRecord parses a raw flow record from the ring buffer and queues
+// it, or dead-letters it if it cannot be parsed.
+func (l *Loader) HandleFlowRecord(data []byte) {
+	event, err := parseFlowEvent(data)
+	if err != nil {
+		l.deadLetters.add(RecordKindFlow, data, err)
+		return
+	}
+	l.InjectFlowEvent(event)
+}
+
+// HandleEgressRecord parses a raw egress record and queues it, or
+// dead-letters it if it cannot be parsed.
+func (l *Loader) HandleEgressRecord(data []byte) {
+	event, err := parseEgressEvent(data)
+	if err != nil {
+		l.deadLetters.add(RecordKindEgress, data, err)
+		return
+	}
+	l.InjectEgressEvent(event)
+}
+
+// DeadLetters returns recently dropped records, oldest first.
+func (l *Loader) DeadLetters() []DeadLetter {
+	return l.deadLetters.list()
+}
+
+// Collectors returns the loader's Prometheus metrics for registration.
+func (l *Loader) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{l.deadLetters.failures}
+}
@@ -0,0 +1,77 @@
+package ebpf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTruncatedRecordsAreDeadLettered(t *testing.T) {
+	l := NewLoader()
+
+	l.HandleFlowRecord(make([]byte, 89))
+	l.HandleFlowRecord(nil)
+	l.HandleEgressRecord(make([]byte, 39))
+
+	failures := l.deadLetters.failures
+	if got := testutil.ToFloat64(failures.WithLabelValues(RecordKindFlow, "short_record")); got != 2 {
+		t.Errorf("flow short records = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(failures.WithLabelValues(RecordKindEgress, "short_record")); got != 1 {
+		t.Errorf("egress short records = %v, want 1", got)
+	}
+
+	letters := l.DeadLetters()
+	if len(letters) != 3 {
+		t.Fatalf("got %d dead letters, want 3", len(letters))
+	}
+	for i, want := range []struct {
+		kind string
+		size int
+	}{{RecordKindFlow, 89}, {RecordKindFlow, 0}, {RecordKindEgress, 39}} {
+		dl := letters[i]
+		if dl.Kind != want.kind || dl.Size != want.size || dl.Reason != "short_record" || dl.Error == "" {
+			t.Errorf("dead letter %d = %+v, want a %s short record of %d bytes", i, dl, want.kind, want.size)
+		}
+	}
+	if len(l.FlowEvents()) != 0 || len(l.EgressEvents()) != 0 {
+		t.Error("truncated records were queued as events")
+	}
+}
+
+func TestValidRecordsAreQueued(t *testing.T) {
+	l := NewLoader()
+
+	l.HandleFlowRecord(make([]byte, 96))
+	l.HandleEgressRecord(make([]byte, 40))
+
+	if len(l.DeadLetters()) != 0 {
+		t.Errorf("dead letters = %+v, want none", l.DeadLetters())
+	}
+	if len(l.FlowEvents()) != 1 || len(l.EgressEvents()) != 1 {
+		t.Error("valid records were not queued")
+	}
+}
+
+func TestDeadLettersBounded(t *testing.T) {
+	d := newDeadLetters()
+	total := deadLetterCapacity + 10
+	for i := 0; i < total; i++ {
+		d.add(RecordKindEgress, bytes.Repeat([]byte{byte(i)}, deadLetterMaxData+1), errShortRecord)
+	}
+
+	letters := d.list()
+	if len(letters) != deadLetterCapacity {
+		t.Fatalf("kept %d dead letters, want %d", len(letters), deadLetterCapacity)
+	}
+	if letters[0].Data[0] != byte(10) || letters[len(letters)-1].Data[0] != byte(total-1) {
+		t.Errorf("kept records %d..%d, want the newest oldest first", letters[0].Data[0], letters[len(letters)-1].Data[0])
+	}
+	if len(letters[0].Data) != deadLetterMaxData || letters[0].Size != deadLetterMaxData+1 {
+		t.Errorf("kept %d of %d bytes, want data capped at %d", len(letters[0].Data), letters[0].Size, deadLetterMaxData)
+	}
+	if got := testutil.ToFloat64(d.failures.WithLabelValues(RecordKindEgress, "short_record")); got != float64(total) {
+		t.Errorf("failure count = %v, want every record counted", got)
+	}
+}
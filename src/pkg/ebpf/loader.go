@@ -72,6 +72,7 @@ type Loader struct {
 	flowEventChan   chan FlowEvent
 	egressEventChan chan EgressEvent
 	stopChan        chan struct{}
+	deadLetters     *deadLetters
 	running         bool
 	stubMode        bool
 }
@@ -82,6 +83,7 @@ func NewLoader() *Loader {
 		flowEventChan:   make(chan FlowEvent, 10000),
 		egressEventChan: make(chan EgressEvent, 10000),
 		stopChan:        make(chan struct{}),
+		deadLetters:     newDeadLetters(),
 		clusterCIDRs:    make([]net.IPNet, 0),
 		stubMode:        true, // Default to stub mode for development
 	}
@@ -103,6 +105,28 @@ func (l *Loader) SetClusterCIDRs(cidrs []string) error {
 	return nil
 }
 
+// IsExternalIP reports whether ip lies outside every cluster CIDR. Without
+// configured CIDRs nothing is known to be external.
+func (l *Loader) IsExternalIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.clusterCIDRs) == 0 {
+		return false
+	}
+	for _, cidr := range l.clusterCIDRs {
+		if cidr.Contains(parsed) {
+			return false
+		}
+	}
+	return true
+}
+
 // LoadFlowTracker loads the flow tracking eBPF program.
 // In stub mode, this just logs and returns nil.
 func (l *Loader) LoadFlowTracker(cgroupPath string) error {
@@ -191,8 +215,8 @@ func (l *Loader) SetStubMode(stub bool) {
 
 // parseFlowEvent parses raw bytes into FlowEvent.
 func parseFlowEvent(data []byte) (FlowEvent, error) {
-	if len(data) < 88 {
-		return FlowEvent{}, errors.New("flow event data too short")
+	if len(data) < 96 {
+		return FlowEvent{}, fmt.Errorf("flow event: %w (%d of 96 bytes)", errShortRecord, len(data))
 	}
 
 	var event FlowEvent
@@ -222,7 +246,7 @@ func parseFlowEvent(data []byte) (FlowEvent, error) {
 // parseEgressEvent parses raw bytes into EgressEvent.
 func parseEgressEvent(data []byte) (EgressEvent, error) {
 	if len(data) < 40 {
-		return EgressEvent{}, errors.New("egress event data too short")
+		return EgressEvent{}, fmt.Errorf("egress event: %w (%d of 40 bytes)", errShortRecord, len(data))
 	}
 
 	var event EgressEvent
@@ -0,0 +1,100 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Info holds geographic and network ownership data for an IP.
+type Info struct {
+	Country        string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	ASN            uint32 `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+}
+
+// Resolver looks up country and ASN data from MaxMind databases.
+// Either database may be absent; lookups return whatever is available.
+type Resolver struct {
+	country *Reader
+	asn     *Reader
+}
+
+// NewResolver opens the country and ASN databases. Empty paths are skipped.
+// Each database loads independently: if one fails to open, the resolver
+// still uses the other and the error is returned alongside it. The
+// resolver is nil only if no database could be opened.
+func NewResolver(countryDBPath, asnDBPath string) (*Resolver, error) {
+	r := &Resolver{}
+	var errs []error
+
+	if countryDBPath != "" {
+		reader, err := Open(countryDBPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("opening country database: %w", err))
+		}
+		r.country = reader
+	}
+
+	if asnDBPath != "" {
+		reader, err := Open(asnDBPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("opening ASN database: %w", err))
+		}
+		r.asn = reader
+	}
+
+	if r.country == nil && r.asn == nil && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return r, errors.Join(errs...)
+}
+
+// Lookup returns geo/ASN info for an IP. The bool is false if nothing was found.
+func (r *Resolver) Lookup(ip net.IP) (Info, bool) {
+	var info Info
+	if r == nil || ip == nil {
+		return info, false
+	}
+
+	if r.country != nil {
+		if record, err := r.country.Lookup(ip); err == nil && record != nil {
+			info.Country = countryCode(record)
+		}
+	}
+
+	if r.asn != nil {
+		if record, err := r.asn.Lookup(ip); err == nil && record != nil {
+			info.ASN = uint32(toUint64(record["autonomous_system_number"]))
+			info.ASOrganization, _ = record["autonomous_system_organization"].(string)
+		}
+	}
+
+	return info, info.Country != "" || info.ASN != 0
+}
+
+// countryCode extracts the ISO country code, falling back to the registered country.
+func countryCode(record map[string]any) string {
+	for _, field := range []string{"country", "registered_country"} {
+		if c, ok := record[field].(map[string]any); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// cloudASNs maps well-known cloud provider ASNs to provider names.
+var cloudASNs = map[uint32]string{
+	16509:  "aws",
+	14618:  "aws",
+	15169:  "gcp",
+	396982: "gcp",
+	8075:   "azure",
+}
+
+// CloudProvider returns the cloud provider owning the ASN, if known.
+func (i Info) CloudProvider() string {
+	return cloudASNs[i.ASN]
+}
@@ -0,0 +1,356 @@
+// Package geoip provides GeoIP and ASN lookups backed by MaxMind DB files.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata section at the end of an MMDB file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the size of the zero block between tree and data.
+const dataSectionSeparator = 16
+
+// MMDB data types.
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// Reader reads a MaxMind DB (MMDB) file.
+type Reader struct {
+	buf          []byte
+	data         []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	DatabaseType string
+}
+
+// Open reads an MMDB file into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading MMDB file: %w", err)
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes parses an in-memory MMDB file.
+func FromBytes(buf []byte) (*Reader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("invalid MMDB file: metadata not found")
+	}
+
+	metaStart := idx + len(metadataMarker)
+	d := decoder{buf: buf[metaStart:]}
+	raw, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid MMDB metadata")
+	}
+
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  uint(toUint64(meta["node_count"])),
+		recordSize: uint(toUint64(meta["record_size"])),
+		ipVersion:  uint(toUint64(meta["ip_version"])),
+	}
+	r.DatabaseType, _ = meta["database_type"].(string)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size: %d", r.recordSize)
+	}
+
+	// Bound the node count before multiplying so the size check below
+	// cannot overflow
+	if r.nodeCount > uint(idx) {
+		return nil, errors.New("invalid MMDB file: search tree exceeds file size")
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(idx) {
+		return nil, errors.New("invalid MMDB file: search tree exceeds file size")
+	}
+	r.data = buf[treeSize+dataSectionSeparator : idx]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// Lookup returns the record for an IP, or nil if the IP is not in the database.
+func (r *Reader) Lookup(ip net.IP) (map[string]any, error) {
+	var addr []byte
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		addr = ip4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		addr = ip.To16()
+		if addr == nil {
+			return nil, fmt.Errorf("invalid IP: %v", ip)
+		}
+	}
+
+	bitCount := uint(len(addr) * 8)
+	for i := uint(0); i < bitCount && node < r.nodeCount; i++ {
+		bit := uint(addr[i>>3]>>(7-(i%8))) & 1
+		node = r.readRecord(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("invalid MMDB search tree")
+	}
+
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("invalid MMDB data pointer")
+	}
+
+	d := decoder{buf: r.data}
+	value, _, err := d.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+// readRecord reads the left (bit 0) or right (bit 1) record of a node.
+func (r *Reader) readRecord(node, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := r.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := r.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(r.buf[off : off+4]))
+	}
+}
+
+// maxDecodeDepth bounds how deeply maps, arrays and pointers may nest, so
+// a corrupt or self-referencing file fails instead of exhausting the stack.
+const maxDecodeDepth = 512
+
+// decoder decodes the MMDB data section format.
+type decoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset, returning it and the offset after it.
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	return d.decodeAt(offset, 0)
+}
+
+// decodeAt decodes the value at offset, nested depth levels deep.
+func (d *decoder) decodeAt(offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("invalid MMDB data: nested too deeply")
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errors.New("unexpected end of MMDB data")
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ptr, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// The format never points at a pointer; refusing to follow one
+		// rules out pointer cycles
+		if ptr < uint(len(d.buf)) && uint(d.buf[ptr]>>5) == typePointer {
+			return nil, 0, errors.New("invalid MMDB data: pointer to a pointer")
+		}
+		value, _, err := d.decodeAt(ptr, depth+1)
+		return value, next, err
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errors.New("unexpected end of MMDB data")
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errors.New("unexpected end of MMDB data")
+		}
+		v := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			v = v<<8 | uint(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + v
+		case 30:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+		offset += n
+	}
+
+	// Every element takes at least a byte, so a size beyond the remaining
+	// data is corrupt; capping the allocation keeps it from being a bomb
+	remaining := uint(len(d.buf)) - offset
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, remaining/2))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := d.decodeAt(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, _ := key.(string)
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		arr := make([]any, 0, min(size, remaining))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, value)
+			offset = next
+		}
+		return arr, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errors.New("unexpected end of MMDB data")
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid MMDB double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid MMDB float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	default:
+		// Containers and end markers carry no lookup data
+		return nil, next, nil
+	}
+}
+
+// decodePointer decodes a pointer and returns the target offset.
+func (d *decoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errors.New("unexpected end of MMDB data")
+	}
+	b := d.buf[offset : offset+n]
+
+	var ptr uint
+	switch n {
+	case 1:
+		ptr = uint(ctrl&0x7)<<8 | uint(b[0])
+	case 2:
+		ptr = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		ptr = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		ptr = uint(binary.BigEndian.Uint32(b))
+	}
+	return ptr, offset + n, nil
+}
+
+// toUint64 converts a decoded numeric value to uint64.
+func toUint64(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		return uint64(n)
+	case float64:
+		return uint64(n)
+	}
+	return 0
+}
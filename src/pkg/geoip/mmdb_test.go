@@ -0,0 +1,464 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// pointer encodes an MMDB pointer to a data section offset.
+type pointer uint
+
+// encode writes a value in the MMDB data section format.
+func encode(v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(header(typeString, len(v)), v...)
+	case []byte:
+		return append(header(typeBytes, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(header(typeDouble, 8), math.Float64bits(v))
+	case float32:
+		return binary.BigEndian.AppendUint32(header(typeFloat, 4), math.Float32bits(v))
+	case uint16:
+		return binary.BigEndian.AppendUint16(header(typeUint16, 2), v)
+	case uint32:
+		return binary.BigEndian.AppendUint32(header(typeUint32, 4), v)
+	case uint64:
+		return binary.BigEndian.AppendUint64(header(typeUint64, 8), v)
+	case int32:
+		return binary.BigEndian.AppendUint32(header(typeInt32, 4), uint32(v))
+	case bool:
+		if v {
+			return header(typeBool, 1)
+		}
+		return header(typeBool, 0)
+	case []any:
+		out := header(typeArray, len(v))
+		for _, item := range v {
+			out = append(out, encode(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := header(typeMap, len(v))
+		for _, k := range keys {
+			out = append(out, encode(k)...)
+			out = append(out, encode(v[k])...)
+		}
+		return out
+	case pointer:
+		switch {
+		case v < 2048:
+			return []byte{byte(typePointer<<5) | byte(v>>8), byte(v)}
+		case v < 526336:
+			v -= 2048
+			return []byte{byte(typePointer<<5) | 1<<3 | byte(v>>16), byte(v >> 8), byte(v)}
+		default:
+			return binary.BigEndian.AppendUint32([]byte{byte(typePointer<<5) | 3<<3}, uint32(v))
+		}
+	}
+	panic("cannot encode value")
+}
+
+// header encodes a control byte, extended type and size.
+func header(typ, size int) []byte {
+	var out []byte
+	if typ > 7 {
+		out = []byte{0, byte(typ - 7)}
+	} else {
+		out = []byte{byte(typ << 5)}
+	}
+	switch {
+	case size < 29:
+		out[0] |= byte(size)
+	case size < 285:
+		out[0] |= 29
+		out = append(out, byte(size-29))
+	case size < 65821:
+		out[0] |= 30
+		out = binary.BigEndian.AppendUint16(out, uint16(size-285))
+	default:
+		out[0] |= 31
+		n := size - 65821
+		out = append(out, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return out
+}
+
+// trieNode is a search tree node under construction. Each record holds a
+// child node or, when data >= 0, a data section offset.
+type trieNode struct {
+	id       int
+	children [2]*trieNode
+	data     [2]int
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{data: [2]int{-1, -1}}
+}
+
+// testNetwork maps a CIDR to the data section offset of its record.
+type testNetwork struct {
+	cidr   string
+	offset int
+}
+
+// buildMMDB writes a database with the given record size and IP version.
+// IPv4 networks in IPv6 databases are placed under ::/96.
+func buildMMDB(t testing.TB, recordSize, ipVersion int, data []byte, networks []testNetwork) []byte {
+	t.Helper()
+	root := newTrieNode()
+	for _, n := range networks {
+		_, network, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := []byte(network.IP)
+		ones, _ := network.Mask.Size()
+		if ipVersion == 6 && len(ip) == net.IPv4len {
+			ip, ones = append(make([]byte, 12), ip...), ones+96
+		}
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == ones-1 {
+				node.data[bit] = n.offset
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = newTrieNode()
+			}
+			node = node.children[bit]
+		}
+	}
+
+	// Number nodes breadth first from the root
+	nodes := []*trieNode{root}
+	for i := 0; i < len(nodes); i++ {
+		nodes[i].id = i
+		for _, c := range nodes[i].children {
+			if c != nil {
+				nodes = append(nodes, c)
+			}
+		}
+	}
+
+	var tree []byte
+	for _, n := range nodes {
+		var rec [2]uint
+		for bit := range rec {
+			switch {
+			case n.children[bit] != nil:
+				rec[bit] = uint(n.children[bit].id)
+			case n.data[bit] >= 0:
+				rec[bit] = uint(len(nodes) + dataSectionSeparator + n.data[bit])
+			default:
+				rec[bit] = uint(len(nodes))
+			}
+		}
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]),
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		case 28:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]),
+				byte(rec[0]>>24)<<4|byte(rec[1]>>24)&0x0F,
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, uint32(rec[0]))
+			tree = binary.BigEndian.AppendUint32(tree, uint32(rec[1]))
+		}
+	}
+
+	out := append(tree, make([]byte, dataSectionSeparator)...)
+	out = append(out, data...)
+	out = append(out, metadataMarker...)
+	return append(out, encode(map[string]any{
+		"node_count":    uint32(len(nodes)),
+		"record_size":   uint16(recordSize),
+		"ip_version":    uint16(ipVersion),
+		"database_type": "Test-DB",
+	})...)
+}
+
+// testData is a data section holding a country record, a US record that
+// points to it, and a DE record with ASN fields. It returns the section and
+// the offsets of the US and DE records.
+func testData() (data []byte, usOffset, deOffset int) {
+	country := encode(map[string]any{"iso_code": "US"})
+	data = append(data, country...)
+
+	usOffset = len(data)
+	data = append(data, encode(map[string]any{
+		"country":   pointer(0),
+		"continent": map[string]any{"code": "NA"},
+		"location":  map[string]any{"latitude": 37.751, "accuracy_radius": uint16(1000)},
+		"tags":      []any{"cloud", true, int32(-5)},
+	})...)
+
+	deOffset = len(data)
+	data = append(data, encode(map[string]any{
+		"registered_country":             map[string]any{"iso_code": "DE"},
+		"autonomous_system_number":       uint32(16509),
+		"autonomous_system_organization": "AMAZON-02",
+	})...)
+	return data, usOffset, deOffset
+}
+
+func TestReaderLookup(t *testing.T) {
+	data, us, de := testData()
+	networks := []testNetwork{{"1.2.3.0/24", us}, {"5.6.0.0/16", de}, {"2001:db8::/32", de}}
+
+	for _, tt := range []struct {
+		name       string
+		recordSize int
+		ipVersion  int
+	}{
+		{"ipv4 24-bit", 24, 4},
+		{"ipv6 24-bit", 24, 6},
+		{"ipv6 28-bit", 28, 6},
+		{"ipv6 32-bit", 32, 6},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			nets := networks
+			if tt.ipVersion == 4 {
+				nets = networks[:2]
+			}
+			r, err := FromBytes(buildMMDB(t, tt.recordSize, tt.ipVersion, data, nets))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.DatabaseType != "Test-DB" {
+				t.Errorf("DatabaseType = %q", r.DatabaseType)
+			}
+
+			record, err := r.Lookup(net.ParseIP("1.2.3.4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]any{
+				"country":   map[string]any{"iso_code": "US"},
+				"continent": map[string]any{"code": "NA"},
+				"location":  map[string]any{"latitude": 37.751, "accuracy_radius": uint64(1000)},
+				"tags":      []any{"cloud", true, int64(-5)},
+			}
+			if !reflect.DeepEqual(record, want) {
+				t.Errorf("1.2.3.4 = %#v, want %#v", record, want)
+			}
+
+			record, err = r.Lookup(net.ParseIP("5.6.7.8"))
+			if err != nil || toUint64(record["autonomous_system_number"]) != 16509 {
+				t.Errorf("5.6.7.8 = %v (%v), want AS16509", record, err)
+			}
+
+			if record, err := r.Lookup(net.ParseIP("9.9.9.9")); record != nil || err != nil {
+				t.Errorf("9.9.9.9 = %v (%v), want not found", record, err)
+			}
+
+			record, err = r.Lookup(net.ParseIP("2001:db8::1"))
+			if tt.ipVersion == 4 {
+				if record != nil || err != nil {
+					t.Errorf("IPv6 in an IPv4 database = %v (%v), want not found", record, err)
+				}
+			} else if err != nil || record["autonomous_system_organization"] != "AMAZON-02" {
+				t.Errorf("2001:db8::1 = %v (%v), want AMAZON-02", record, err)
+			}
+		})
+	}
+}
+
+func TestDecodeSizesAndPointers(t *testing.T) {
+	for _, n := range []int{0, 28, 29, 284, 285, 70000} {
+		s := strings.Repeat("x", n)
+		value, next, err := (&decoder{buf: encode(s)}).decode(0)
+		if err != nil || value != s || next != uint(len(encode(s))) {
+			t.Errorf("string of %d bytes: got %d bytes, next %d (%v)", n, len(value.(string)), next, err)
+		}
+	}
+
+	for _, target := range []uint{0, 2047, 2048, 526335, 526336} {
+		buf := encode(pointer(target))
+		ptr, next, err := (&decoder{buf: buf}).decodePointer(buf[0], 1)
+		if err != nil || ptr != target || next != uint(len(buf)) {
+			t.Errorf("pointer to %d decoded as %d, next %d (%v)", target, ptr, next, err)
+		}
+	}
+
+	for _, v := range []any{float32(1.5), uint64(1 << 40), []byte{1, 2}, false} {
+		got, _, err := (&decoder{buf: encode(v)}).decode(0)
+		if err != nil {
+			t.Fatalf("%T: %v", v, err)
+		}
+		want := v
+		switch v := v.(type) {
+		case float32:
+			want = float64(v)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("decoded %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestFromBytesRejectsInvalidFiles(t *testing.T) {
+	data, us, _ := testData()
+	valid := buildMMDB(t, 24, 4, data, []testNetwork{{"1.2.3.0/24", us}})
+
+	for name, buf := range map[string][]byte{
+		"no metadata":   []byte("not a database"),
+		"truncated":     valid[len(valid)-len(metadataMarker)-20:],
+		"bad record":    append(append([]byte{}, metadataMarker...), encode(map[string]any{"node_count": uint32(1), "record_size": uint16(20), "ip_version": uint16(4)})...),
+		"metadata type": append(append([]byte{}, metadataMarker...), encode("metadata")...),
+	} {
+		if _, err := FromBytes(buf); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+
+	truncated := decoder{buf: encode("hello")[:3]}
+	if _, _, err := truncated.decode(0); err == nil {
+		t.Error("want error decoding past the end of the data")
+	}
+}
+
+func TestDecodeRejectsCorruptNesting(t *testing.T) {
+	// An array holding itself through a pointer
+	selfArray := append(header(typeArray, 1), encode(pointer(0))...)
+	// Pointers to pointers, including one to itself
+	selfPointer := encode(pointer(0))
+	chain := append(encode(pointer(2)), encode(pointer(0))...)
+	// Arrays nested past the depth limit
+	var deep []byte
+	for i := 0; i <= maxDecodeDepth+1; i++ {
+		deep = append(deep, header(typeArray, 1)...)
+	}
+	deep = append(deep, encode("leaf")...)
+	// A map claiming millions of entries in a few bytes
+	huge := append(header(typeMap, 16_000_000), encode("k")...)
+
+	for name, buf := range map[string][]byte{
+		"self-referencing array": selfArray,
+		"self pointer":           selfPointer,
+		"pointer chain":          chain,
+		"deep nesting":           deep,
+		"oversized map":          huge,
+	} {
+		if _, _, err := (&decoder{buf: buf}).decode(0); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestFromBytesRejectsOversizedTree(t *testing.T) {
+	buf := append(append([]byte{}, metadataMarker...), encode(map[string]any{
+		"node_count":  uint64(1) << 62,
+		"record_size": uint16(32),
+		"ip_version":  uint16(4),
+	})...)
+	if _, err := FromBytes(buf); err == nil {
+		t.Error("want error for a node count beyond the file")
+	}
+}
+
+// FuzzDecode checks that no data section input panics or overflows the
+// stack.
+func FuzzDecode(f *testing.F) {
+	data, _, _ := testData()
+	f.Add(data)
+	f.Add(encode(pointer(0)))
+	f.Add(append(header(typeArray, 1), encode(pointer(0))...))
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		d := decoder{buf: buf}
+		for offset := uint(0); offset < uint(len(buf)) && offset < 64; offset++ {
+			d.decode(offset)
+		}
+	})
+}
+
+// FuzzLookup checks that no database file panics when opened and queried.
+func FuzzLookup(f *testing.F) {
+	data, us, de := testData()
+	networks := []testNetwork{{"1.2.3.0/24", us}, {"5.6.0.0/16", de}}
+	for _, size := range []int{24, 28, 32} {
+		f.Add(buildMMDB(f, size, 6, data, networks))
+	}
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		r, err := FromBytes(buf)
+		if err != nil {
+			return
+		}
+		for _, ip := range []string{"1.2.3.4", "5.6.7.8", "2001:db8::1"} {
+			r.Lookup(net.ParseIP(ip))
+		}
+	})
+}
+
+// writeDB writes a test database into dir.
+func writeDB(t *testing.T, dir, name string, networks []testNetwork) string {
+	t.Helper()
+	data, _, _ := testData()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buildMMDB(t, 24, 6, data, networks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolverLookup(t *testing.T) {
+	dir := t.TempDir()
+	_, us, de := testData()
+	country := writeDB(t, dir, "country.mmdb", []testNetwork{{"1.2.3.0/24", us}})
+	asn := writeDB(t, dir, "asn.mmdb", []testNetwork{{"1.2.3.0/24", de}})
+
+	r, err := NewResolver(country, asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := r.Lookup(net.ParseIP("1.2.3.4"))
+	if !ok || info.Country != "US" || info.ASN != 16509 || info.ASOrganization != "AMAZON-02" {
+		t.Errorf("info = %+v (%v), want US on AS16509", info, ok)
+	}
+	if info.CloudProvider() != "aws" {
+		t.Errorf("cloud provider = %q, want aws", info.CloudProvider())
+	}
+	if _, ok := r.Lookup(net.ParseIP("9.9.9.9")); ok {
+		t.Error("9.9.9.9 found, want nothing")
+	}
+}
+
+func TestResolverLoadsDatabasesIndependently(t *testing.T) {
+	dir := t.TempDir()
+	_, us, _ := testData()
+	country := writeDB(t, dir, "country.mmdb", []testNetwork{{"1.2.3.0/24", us}})
+
+	r, err := NewResolver(country, filepath.Join(dir, "missing.mmdb"))
+	if err == nil {
+		t.Error("want error for the missing ASN database")
+	}
+	if r == nil {
+		t.Fatal("resolver is nil, want the country database kept")
+	}
+	if info, ok := r.Lookup(net.ParseIP("1.2.3.4")); !ok || info.Country != "US" {
+		t.Errorf("info = %+v (%v), want US", info, ok)
+	}
+
+	r, err = NewResolver(filepath.Join(dir, "missing.mmdb"), "")
+	if err == nil || r != nil {
+		t.Errorf("resolver %v (%v), want nil and an error when nothing loads", r, err)
+	}
+	if _, ok := r.Lookup(net.ParseIP("1.2.3.4")); ok {
+		t.Error("nil resolver found a record")
+	}
+}
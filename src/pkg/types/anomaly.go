@@ -2,6 +2,8 @@
 package types
 
 import (
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -80,6 +82,7 @@ type Anomaly struct {
 	SourceService            string            `json:"source_service"`
 	DestinationService       string            `json:"destination_service,omitempty"`
 	DestinationEndpoint      string            `json:"destination_endpoint,omitempty"`
+	FlowKey                  string            `json:"flow_key,omitempty"` // Baseline flow, for feedback
 	DetectedAt               time.Time         `json:"detected_at"`
 	StartedAt                *time.Time        `json:"started_at,omitempty"`
 	EndedAt                  *time.Time        `json:"ended_at,omitempty"`
@@ -98,6 +101,9 @@ type Anomaly struct {
 	Resolved                 bool              `json:"resolved"`
 	ResolvedAt               *time.Time        `json:"resolved_at,omitempty"`
 	ResolutionNotes          string            `json:"resolution_notes,omitempty"`
+	FalsePositive            bool              `json:"false_positive,omitempty"`
+	Suppressed               bool              `json:"suppressed"`
+	SuppressionID            *uuid.UUID        `json:"suppression_id,omitempty"`
 	AISummary                string            `json:"ai_summary,omitempty"`
 	AIAnalysis               map[string]any    `json:"ai_analysis,omitempty"`
 	Labels                   map[string]string `json:"labels,omitempty"`
@@ -106,8 +112,37 @@ type Anomaly struct {
 }
 
 // IsActive checks if anomaly is still active.
+// Suppressed anomalies are retained for audit but never active.
 func (a Anomaly) IsActive() bool {
-	return !a.Resolved && a.EndedAt == nil
+	return !a.Resolved && !a.Suppressed && a.EndedAt == nil
+}
+
+// Clone returns a copy of the anomaly sharing no slices, maps or pointers
+// with the original, so it can be read while the original changes.
+// AIAnalysis is copied one level deep.
+func (a Anomaly) Clone() Anomaly {
+	a.StartedAt = cloneTime(a.StartedAt)
+	a.EndedAt = cloneTime(a.EndedAt)
+	a.AcknowledgedAt = cloneTime(a.AcknowledgedAt)
+	a.ResolvedAt = cloneTime(a.ResolvedAt)
+	if a.SuppressionID != nil {
+		id := *a.SuppressionID
+		a.SuppressionID = &id
+	}
+	a.RelatedEventIDs = slices.Clone(a.RelatedEventIDs)
+	a.PotentialCauses = slices.Clone(a.PotentialCauses)
+	a.SuggestedActions = slices.Clone(a.SuggestedActions)
+	a.AIAnalysis = maps.Clone(a.AIAnalysis)
+	a.Labels = maps.Clone(a.Labels)
+	return a
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
 }
 
 // DurationHours returns duration of anomaly in hours.
@@ -140,8 +175,58 @@ func (a Anomaly) PercentIncrease() float64 {
 type AnomalySummary struct {
 	TotalActive         int                     `json:"total_active"`
 	TotalResolved       int                     `json:"total_resolved"`
+	TotalSuppressed     int                     `json:"total_suppressed"`
 	BySeverity          map[Severity]int        `json:"by_severity"`
 	ByType              map[AnomalyType]int     `json:"by_type"`
 	TotalCostImpactUSD  float64                 `json:"total_cost_impact_usd"`
 	TopAnomalies        []Anomaly               `json:"top_anomalies"`
 }
+
+// FlowFeedback records operator resolution outcomes for a flow and the
+// detection adjustment learned from them.
+type FlowFeedback struct {
+	FlowKey             string    `json:"flow_key"`
+	Resolutions         int       `json:"resolutions"`
+	FalsePositives      int       `json:"false_positives"`
+	ThresholdMultiplier float64   `json:"threshold_multiplier"`
+	EffectiveThreshold  float64   `json:"effective_threshold"` // Stddevs
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Suppression silences anomalies during a planned window, such as a migration.
+type Suppression struct {
+	ID        uuid.UUID         `json:"id"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	FlowKey   string            `json:"flow_key,omitempty"` // Empty matches all flows
+	Labels    map[string]string `json:"labels,omitempty"`   // All must match the anomaly's labels
+	Reason    string            `json:"reason,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Matches checks if the suppression applies to an anomaly.
+func (s Suppression) Matches(a Anomaly) bool {
+	if a.DetectedAt.Before(s.Start) || !a.DetectedAt.Before(s.End) {
+		return false
+	}
+	if s.FlowKey != "" && s.FlowKey != a.SourceService {
+		return false
+	}
+	for k, v := range s.Labels {
+		if a.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// TrustedDestination is a known-good destination, such as an own CDN or an
+// observability vendor, that never raises new-endpoint or leak anomalies.
+// Its traffic is still costed. Destination is a hostname, a "*.example.com"
+// wildcard, an IP, or a CIDR.
+type TrustedDestination struct {
+	Destination string    `json:"destination"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAnomalyCloneSharesNothing(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	suppression := uuid.New()
+	a := Anomaly{
+		ID:              uuid.New(),
+		StartedAt:       &now,
+		AcknowledgedAt:  &now,
+		SuppressionID:   &suppression,
+		RelatedEventIDs: []string{"evt-1"},
+		PotentialCauses: []string{"deploy"},
+		Labels:          map[string]string{"team": "shop"},
+	}
+
+	c := a.Clone()
+	*c.StartedAt = now.Add(time.Hour)
+	*c.AcknowledgedAt = now.Add(time.Hour)
+	*c.SuppressionID = uuid.New()
+	c.RelatedEventIDs[0] = "changed"
+	c.PotentialCauses[0] = "changed"
+	c.Labels["team"] = "changed"
+
+	if !a.StartedAt.Equal(now) || !a.AcknowledgedAt.Equal(now) || *a.SuppressionID != suppression ||
+		a.RelatedEventIDs[0] != "evt-1" || a.PotentialCauses[0] != "deploy" || a.Labels["team"] != "shop" {
+		t.Errorf("original changed through its clone: %+v", a)
+	}
+	if c.EndedAt != nil || c.ResolvedAt != nil {
+		t.Error("nil times became non-nil")
+	}
+}
@@ -25,6 +25,7 @@ const (
 	CostCategoryEgressRegion   CostCategory = "egress_region"
 	CostCategoryCrossAZ        CostCategory = "cross_az"
 	CostCategoryCrossRegion    CostCategory = "cross_region"
+	CostCategoryCrossCluster   CostCategory = "cross_cluster"
 	CostCategoryVPCPeering     CostCategory = "vpc_peering"
 	CostCategoryNATGateway     CostCategory = "nat_gateway"
 	CostCategoryLoadBalancer   CostCategory = "load_balancer"
@@ -53,14 +54,57 @@ type PricingRule struct {
 	EffectiveUntil    *time.Time    `json:"effective_until,omitempty"`
 }
 
+// TierCharge is the part of a transfer billed at one rate.
+type TierCharge struct {
+	ThresholdGB float64 `json:"threshold_gb,omitempty"` // Upper bound of the tier; zero for the base rate
+	GB          float64 `json:"gb"`
+	CostPerGB   float64 `json:"cost_per_gb"`
+	CostUSD     float64 `json:"cost_usd"`
+}
+
+// PricedTransfer is a transfer priced by a rule: how much fell within the
+// free tier, how much was billed, and the charge at each rate. FreeTierGB
+// plus BilledGB is the transfer's size, and the charges sum to CostUSD.
+type PricedTransfer struct {
+	FreeTierGB float64      `json:"free_tier_gb"`
+	BilledGB   float64      `json:"billed_gb"`
+	Charges    []TierCharge `json:"charges,omitempty"`
+	CostUSD    float64      `json:"cost_usd"`
+}
+
 // CalculateCost computes cost for given bytes, accounting for tiers and free tier.
 func (p PricingRule) CalculateCost(bytesTransferred uint64, alreadyUsedGB float64) float64 {
+	return p.Price(bytesTransferred, alreadyUsedGB).CostUSD
+}
+
+// Price computes the cost of a transfer like CalculateCost, with the free
+// tier and per-tier amounts behind it.
+func (p PricingRule) Price(bytesTransferred uint64, alreadyUsedGB float64) PricedTransfer {
+	gb := float64(bytesTransferred) / (1024 * 1024 * 1024)
+	free := max(0, min(alreadyUsedGB+gb, p.FreeTierGB)-max(alreadyUsedGB, 0))
+	free = min(free, gb)
+
+	priced := PricedTransfer{
+		FreeTierGB: free,
+		BilledGB:   gb - free,
+		Charges:    p.Charges(bytesTransferred, alreadyUsedGB),
+	}
+	for _, c := range priced.Charges {
+		priced.CostUSD += c.CostUSD
+	}
+	return priced
+}
+
+// Charges splits the billable part of a transfer across the rule's tiers,
+// in tier order, with any remainder at the base rate. Usage within the free
+// tier is not charged and yields no entry.
+func (p PricingRule) Charges(bytesTransferred uint64, alreadyUsedGB float64) []TierCharge {
 	gb := float64(bytesTransferred) / (1024 * 1024 * 1024)
 	totalGB := alreadyUsedGB + gb
 
 	// Check free tier
 	if totalGB <= p.FreeTierGB {
-		return 0.0
+		return nil
 	}
 
 	// Calculate billable GB
@@ -68,11 +112,11 @@ func (p PricingRule) CalculateCost(bytesTransferred uint64, alreadyUsedGB float6
 	billableGB := totalGB - billableStart
 
 	if len(p.Tiers) == 0 {
-		return billableGB * p.CostPerGB
+		return []TierCharge{{GB: billableGB, CostPerGB: p.CostPerGB, CostUSD: billableGB * p.CostPerGB}}
 	}
 
 	// Apply tiered pricing
-	var cost float64
+	var charges []TierCharge
 	remainingGB := billableGB
 	currentPosition := billableStart
 
@@ -81,7 +125,12 @@ func (p PricingRule) CalculateCost(bytesTransferred uint64, alreadyUsedGB float6
 			continue
 		}
 		tierGB := min(remainingGB, tier.ThresholdGB-currentPosition)
-		cost += tierGB * tier.CostPerGB
+		charges = append(charges, TierCharge{
+			ThresholdGB: tier.ThresholdGB,
+			GB:          tierGB,
+			CostPerGB:   tier.CostPerGB,
+			CostUSD:     tierGB * tier.CostPerGB,
+		})
 		remainingGB -= tierGB
 		currentPosition += tierGB
 		if remainingGB <= 0 {
@@ -91,40 +140,96 @@ func (p PricingRule) CalculateCost(bytesTransferred uint64, alreadyUsedGB float6
 
 	// Any remaining at base rate
 	if remainingGB > 0 {
-		cost += remainingGB * p.CostPerGB
+		charges = append(charges, TierCharge{GB: remainingGB, CostPerGB: p.CostPerGB, CostUSD: remainingGB * p.CostPerGB})
 	}
 
-	return cost
+	return charges
+}
+
+// CostExemption marks traffic as free, e.g. cross-AZ traffic over private
+// links that the account is not billed for. An exemption matches a flow when
+// every non-empty criterion matches.
+type CostExemption struct {
+	Name              string `json:"name,omitempty"`
+	SourceRegion      string `json:"source_region,omitempty"`
+	DestinationRegion string `json:"destination_region,omitempty"`
+	DestinationCIDR   string `json:"destination_cidr,omitempty"`
 }
 
 // CostBreakdown provides detailed cost information for a transfer.
 type CostBreakdown struct {
 	Category           CostCategory `json:"category"`
 	BytesTransferred   uint64       `json:"bytes_transferred"`
+	OverheadBytes      uint64       `json:"overhead_bytes,omitempty"` // Estimated packet headers, billed on top of BytesTransferred
 	CostUSD            float64      `json:"cost_usd"`
+	FreeTierGB         float64      `json:"free_tier_gb,omitempty"` // Part of the transfer covered by the free tier
+	BilledGB           float64      `json:"billed_gb"`              // Part charged, including overhead bytes
+	Charges            []TierCharge `json:"charges,omitempty"`      // Amount billed at each rate; sums to CostUSD
 	PricingRuleID      *uuid.UUID   `json:"pricing_rule_id,omitempty"`
 	SourceService      string       `json:"source_service,omitempty"`
 	DestinationService string       `json:"destination_service,omitempty"`
 	SourceRegion       string       `json:"source_region,omitempty"`
 	DestinationRegion  string       `json:"destination_region,omitempty"`
+	Exempt             bool         `json:"exempt,omitempty"` // Matched a cost exemption
+}
+
+// EndpointCap is a monthly transfer limit for an external destination.
+type EndpointCap struct {
+	Hostname     string    `json:"hostname"`
+	MonthlyBytes uint64    `json:"monthly_bytes"`
+	Description  string    `json:"description,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// MonthToDateCost is the running cost total for a calendar month.
+type MonthToDateCost struct {
+	Month      string                   `json:"month"` // YYYY-MM, UTC
+	CostUSD    float64                  `json:"cost_usd"`
+	TotalBytes uint64                   `json:"total_bytes"`
+	ByCategory map[CostCategory]float64 `json:"by_category"`
+	UpdatedAt  time.Time                `json:"updated_at"`
+}
+
+// WatchlistEntry marks a costly destination, a hostname or cloud service
+// name, whose new consumers should be flagged.
+type WatchlistEntry struct {
+	Destination string    `json:"destination"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PathCost attributes transfer cost to an HTTP path.
+type PathCost struct {
+	Path                string  `json:"path"`
+	TotalBytes          uint64  `json:"total_bytes"`
+	Requests            uint64  `json:"requests"`
+	TotalCostUSD        float64 `json:"total_cost_usd"`
+	CostPer1000Requests float64 `json:"cost_per_1000_requests_usd"`
 }
 
 // CostAttribution attributes costs to specific workloads or dimensions.
 type CostAttribution struct {
-	ID                uuid.UUID       `json:"id"`
-	PeriodStart       time.Time       `json:"period_start"`
-	PeriodEnd         time.Time       `json:"period_end"`
-	Namespace         string          `json:"namespace,omitempty"`
-	ServiceName       string          `json:"service_name,omitempty"`
-	DeploymentVersion string          `json:"deployment_version,omitempty"`
-	Team              string          `json:"team,omitempty"`
-	Environment       string          `json:"environment,omitempty"`
-	TotalBytes        uint64          `json:"total_bytes"`
-	TotalCostUSD      float64         `json:"total_cost_usd"`
-	Breakdown         []CostBreakdown `json:"breakdown"`
-	BaselineCostUSD   *float64        `json:"baseline_cost_usd,omitempty"`
-	CostDeltaUSD      *float64        `json:"cost_delta_usd,omitempty"`
-	CostDeltaPercent  *float64        `json:"cost_delta_percent,omitempty"`
+	ID                uuid.UUID         `json:"id"`
+	PeriodStart       time.Time         `json:"period_start"`
+	PeriodEnd         time.Time         `json:"period_end"`
+	Namespace         string            `json:"namespace,omitempty"`
+	ServiceName       string            `json:"service_name,omitempty"`
+	DeploymentVersion string            `json:"deployment_version,omitempty"`
+	Team              string            `json:"team,omitempty"`
+	Environment       string            `json:"environment,omitempty"`
+	Dimensions        map[string]string `json:"dimensions,omitempty"` // Custom label-mapped dimensions
+	TotalBytes        uint64            `json:"total_bytes"`
+	TotalCostUSD      float64           `json:"total_cost_usd"`
+	SharedCostUSD     float64           `json:"shared_cost_usd,omitempty"` // Allocated share of untagged cost, included in TotalCostUSD
+	Breakdown         []CostBreakdown   `json:"breakdown"`
+	BaselineCostUSD   *float64          `json:"baseline_cost_usd,omitempty"`
+	CostDeltaUSD      *float64          `json:"cost_delta_usd,omitempty"`
+	CostDeltaPercent  *float64          `json:"cost_delta_percent,omitempty"`
+
+	// RawSampleRate is the lowest raw retention rate among the flows
+	// attributed. Below 1, bytes and cost leave out flows the collector did
+	// not retain raw; they are not extrapolated.
+	RawSampleRate float64 `json:"raw_sample_rate,omitempty"`
 }
 
 // CostPerGB returns average cost per GB for this attribution.
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPriceComponentsSumToTotal(t *testing.T) {
+	rule := PricingRule{
+		CostPerGB:  0.05,
+		FreeTierGB: 1,
+		Tiers:      []PricingTier{{ThresholdGB: 10, CostPerGB: 0.10}, {ThresholdGB: 50, CostPerGB: 0.08}},
+	}
+	tests := []struct {
+		name        string
+		gb, usedGB  float64
+		wantFree    float64
+		wantCharges int
+		wantCostUSD float64
+	}{
+		{name: "within free tier", gb: 0.5, wantFree: 0.5},
+		{name: "across free tier", gb: 3, wantFree: 1, wantCharges: 1, wantCostUSD: 0.2},
+		{name: "across tiers", gb: 20, usedGB: 5, wantCharges: 2, wantCostUSD: 5*0.10 + 15*0.08},
+		{name: "beyond last tier", gb: 10, usedGB: 45, wantCharges: 2, wantCostUSD: 5*0.08 + 5*0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := rule.Price(uint64(tt.gb*(1<<30)), tt.usedGB)
+
+			if math.Abs(p.FreeTierGB-tt.wantFree) > 1e-9 {
+				t.Errorf("FreeTierGB = %v, want %v", p.FreeTierGB, tt.wantFree)
+			}
+			if math.Abs(p.FreeTierGB+p.BilledGB-tt.gb) > 1e-9 {
+				t.Errorf("FreeTierGB + BilledGB = %v, want %v", p.FreeTierGB+p.BilledGB, tt.gb)
+			}
+			if len(p.Charges) != tt.wantCharges {
+				t.Fatalf("got %d charges, want %d: %+v", len(p.Charges), tt.wantCharges, p.Charges)
+			}
+			var gb, usd float64
+			for _, c := range p.Charges {
+				gb += c.GB
+				usd += c.CostUSD
+			}
+			if math.Abs(gb-p.BilledGB) > 1e-9 || math.Abs(usd-p.CostUSD) > 1e-9 {
+				t.Errorf("charges sum to %vGB/$%v, want %vGB/$%v", gb, usd, p.BilledGB, p.CostUSD)
+			}
+			if math.Abs(p.CostUSD-tt.wantCostUSD) > 1e-9 {
+				t.Errorf("CostUSD = %v, want %v", p.CostUSD, tt.wantCostUSD)
+			}
+			if got := rule.CalculateCost(uint64(tt.gb*(1<<30)), tt.usedGB); got != p.CostUSD {
+				t.Errorf("CalculateCost = %v, want %v", got, p.CostUSD)
+			}
+		})
+	}
+}
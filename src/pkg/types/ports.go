@@ -0,0 +1,56 @@
+package types
+
+// Well-known services recognized by destination port.
+const (
+	WellKnownServiceDNS  = "dns"
+	WellKnownServiceNTP  = "ntp"
+	WellKnownServiceDHCP = "dhcp"
+	WellKnownServiceSNMP = "snmp"
+)
+
+// wellKnownPorts maps protocol and port to a well-known service name.
+var wellKnownPorts = map[string]map[uint16]string{
+	"UDP": {
+		53:  WellKnownServiceDNS,
+		67:  WellKnownServiceDHCP,
+		68:  WellKnownServiceDHCP,
+		123: WellKnownServiceNTP,
+		161: WellKnownServiceSNMP,
+	},
+	"TCP": {
+		53: WellKnownServiceDNS,
+	},
+}
+
+// controlPlaneServices are infrastructure chatter rather than workload traffic.
+var controlPlaneServices = map[string]bool{
+	WellKnownServiceDNS:  true,
+	WellKnownServiceNTP:  true,
+	WellKnownServiceDHCP: true,
+	WellKnownServiceSNMP: true,
+}
+
+// WellKnownService returns the service name for a protocol and destination
+// port, or "" if the port is not recognized.
+func WellKnownService(protocol string, port uint16) string {
+	return wellKnownPorts[protocol][port]
+}
+
+// IsWellKnownService reports whether a service name is one recognized by
+// port rather than a cloud service.
+func IsWellKnownService(name string) bool {
+	for _, services := range wellKnownPorts {
+		for _, svc := range services {
+			if svc == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsControlPlaneService reports whether a service name is control-plane
+// chatter such as DNS or NTP.
+func IsControlPlaneService(name string) bool {
+	return controlPlaneServices[name]
+}
@@ -0,0 +1,31 @@
+package types
+
+import "testing"
+
+func TestWellKnownService(t *testing.T) {
+	tests := []struct {
+		protocol string
+		port     uint16
+		want     string
+	}{
+		{"UDP", 53, WellKnownServiceDNS},
+		{"TCP", 53, WellKnownServiceDNS},
+		{"UDP", 123, WellKnownServiceNTP},
+		{"TCP", 123, ""},
+		{"UDP", 67, WellKnownServiceDHCP},
+		{"TCP", 443, ""},
+		{"UDP", 5353, ""},
+	}
+	for _, tt := range tests {
+		if got := WellKnownService(tt.protocol, tt.port); got != tt.want {
+			t.Errorf("%s/%d = %q, want %q", tt.protocol, tt.port, got, tt.want)
+		}
+	}
+
+	if !IsControlPlaneService(WellKnownServiceDNS) || !IsControlPlaneService(WellKnownServiceNTP) {
+		t.Error("DNS and NTP are not control plane")
+	}
+	if IsControlPlaneService("s3") {
+		t.Error("s3 is control plane")
+	}
+}
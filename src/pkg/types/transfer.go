@@ -2,7 +2,10 @@
 package types
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -54,6 +57,8 @@ type ServiceIdentity struct {
 	Cluster          string            `json:"cluster,omitempty"`
 	AvailabilityZone string            `json:"availability_zone,omitempty"`
 	Region           string            `json:"region,omitempty"`
+	CloudProvider    string            `json:"cloud_provider,omitempty"` // aws, gcp, azure
+	Services         []string          `json:"services,omitempty"`       // Kubernetes Services selecting the pod, "namespace/name"
 	Labels           map[string]string `json:"labels,omitempty"`
 }
 
@@ -76,6 +81,10 @@ type Endpoint struct {
 	IsInternet       bool             `json:"is_internet"`
 	IsCloudService   bool             `json:"is_cloud_service"`
 	CloudServiceName string           `json:"cloud_service_name,omitempty"`
+	WellKnownService string           `json:"well_known_service,omitempty"` // Recognized by port, e.g. "dns"
+	Country          string           `json:"country,omitempty"`            // ISO 3166-1 alpha-2, external endpoints only
+	ASN              uint32           `json:"asn,omitempty"`
+	ASOrganization   string           `json:"as_organization,omitempty"`
 }
 
 // TransferEvent represents a single data transfer event between two endpoints.
@@ -93,6 +102,17 @@ type TransferEvent struct {
 	PacketsSent     uint64 `json:"packets_sent"`
 	PacketsReceived uint64 `json:"packets_received"`
 
+	// SampleRate is the fraction of traffic the event stands for when the
+	// producer samples; stored totals are scaled by 1/SampleRate. Zero
+	// means unsampled (1.0).
+	SampleRate float64 `json:"sample_rate,omitempty"`
+
+	// RawSampleRate is the fraction of flows whose raw events the collector
+	// retains. Raw-event totals are not scaled by it; queries report the
+	// lowest rate summed as coverage. Zero means every raw event is
+	// retained (1.0).
+	RawSampleRate float64 `json:"raw_sample_rate,omitempty"`
+
 	// Timing
 	Timestamp  time.Time `json:"timestamp"`
 	DurationNs uint64    `json:"duration_ns,omitempty"`
@@ -128,12 +148,19 @@ type TransferFlow struct {
 	DestinationIdentity *ServiceIdentity `json:"destination_identity,omitempty"`
 	DestinationEndpoint *Endpoint        `json:"destination_endpoint,omitempty"`
 	Type                TransferType     `json:"type"`
+	Protocol            string           `json:"protocol,omitempty"`           // Empty when the flow mixes or lacks protocols
+	WellKnownService    string           `json:"well_known_service,omitempty"` // Recognized by destination port, e.g. "dns"
 
 	// Aggregated metrics
 	TotalBytes   uint64 `json:"total_bytes"`
 	TotalPackets uint64 `json:"total_packets"`
 	EventCount   uint64 `json:"event_count"`
 
+	// RawSampleRate is the lowest raw retention rate among the events the
+	// flow was summed from. Below 1, the totals leave out flows the
+	// collector did not retain raw. Zero means complete (1.0).
+	RawSampleRate float64 `json:"raw_sample_rate,omitempty"`
+
 	// Time window
 	WindowStart time.Time `json:"window_start"`
 	WindowEnd   time.Time `json:"window_end"`
@@ -144,8 +171,49 @@ type TransferFlow struct {
 	BytesPerSecondP99 float64 `json:"bytes_per_second_p99"`
 
 	// Breakdown
-	ByHTTPPath   map[string]uint64 `json:"by_http_path,omitempty"`
-	ByGRPCMethod map[string]uint64 `json:"by_grpc_method,omitempty"`
+	ByHTTPPath         map[string]uint64 `json:"by_http_path,omitempty"` // Bytes per path
+	ByGRPCMethod       map[string]uint64 `json:"by_grpc_method,omitempty"`
+	RequestsByHTTPPath map[string]uint64 `json:"requests_by_http_path,omitempty"`
+}
+
+// LowerRawSampleRate returns the lower of two raw sample rates, for the
+// coverage of totals summed from both. Zero counts as 1.0.
+func LowerRawSampleRate(a, b float64) float64 {
+	if a <= 0 {
+		a = 1
+	}
+	if b <= 0 {
+		b = 1
+	}
+	return math.Min(a, b)
+}
+
+// FlowKeySeparator joins source and destination in flow keys and edge IDs.
+// It is ASCII so keys survive logs, URLs, and ClickHouse unchanged.
+const FlowKeySeparator = "|"
+
+// JoinFlowKey builds a flow key from source and destination names.
+func JoinFlowKey(src, dst string) string {
+	return src + FlowKeySeparator + dst
+}
+
+// SplitFlowKey splits a flow key into source and destination names.
+func SplitFlowKey(key string) (src, dst string, ok bool) {
+	return strings.Cut(key, FlowKeySeparator)
+}
+
+// ParseFlowKey splits a flow key into source, destination and, for keys of
+// the form "src|dst|type", transfer type. Keys built by JoinFlowKey have no
+// type.
+func ParseFlowKey(key string) (src, dst string, transferType TransferType, ok bool) {
+	parts := strings.Split(key, FlowKeySeparator)
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], "", true
+	case 3:
+		return parts[0], parts[1], TransferType(parts[2]), true
+	}
+	return "", "", "", false
 }
 
 // FlowKey returns a unique identifier for this flow pair.
@@ -159,10 +227,67 @@ func (f TransferFlow) FlowKey() string {
 	} else {
 		dst = "unknown"
 	}
-	return fmt.Sprintf("%s→%s", src, dst)
+	return JoinFlowKey(src, dst)
 }
 
 // DurationSeconds returns the window duration in seconds.
 func (f TransferFlow) DurationSeconds() float64 {
 	return f.WindowEnd.Sub(f.WindowStart).Seconds()
 }
+
+// ErrFlowMismatch is returned when merging flows of different keys or types.
+var ErrFlowMismatch = errors.New("flows do not match")
+
+// Merge adds other, a flow with the same key and type from another window,
+// into f. Totals and per-path breakdowns are summed and the window widened
+// to cover both. The average rate is recomputed over the merged window;
+// the max and p99 rates keep the larger of the two, since the exact p99
+// cannot be recovered from two summaries.
+func (f *TransferFlow) Merge(other TransferFlow) error {
+	if f.FlowKey() != other.FlowKey() || f.Type != other.Type {
+		return fmt.Errorf("%w: %s (%s) and %s (%s)", ErrFlowMismatch, f.FlowKey(), f.Type, other.FlowKey(), other.Type)
+	}
+
+	f.TotalBytes += other.TotalBytes
+	f.TotalPackets += other.TotalPackets
+	f.EventCount += other.EventCount
+
+	if f.WindowStart.IsZero() || (!other.WindowStart.IsZero() && other.WindowStart.Before(f.WindowStart)) {
+		f.WindowStart = other.WindowStart
+	}
+	if other.WindowEnd.After(f.WindowEnd) {
+		f.WindowEnd = other.WindowEnd
+	}
+
+	if secs := f.DurationSeconds(); secs > 0 {
+		f.BytesPerSecondAvg = float64(f.TotalBytes) / secs
+	}
+	if other.BytesPerSecondMax > f.BytesPerSecondMax {
+		f.BytesPerSecondMax = other.BytesPerSecondMax
+	}
+	if other.BytesPerSecondP99 > f.BytesPerSecondP99 {
+		f.BytesPerSecondP99 = other.BytesPerSecondP99
+	}
+
+	f.ByHTTPPath = mergeCounts(f.ByHTTPPath, other.ByHTTPPath)
+	f.ByGRPCMethod = mergeCounts(f.ByGRPCMethod, other.ByGRPCMethod)
+	f.RequestsByHTTPPath = mergeCounts(f.RequestsByHTTPPath, other.RequestsByHTTPPath)
+	if f.Protocol != other.Protocol {
+		f.Protocol = "" // Mixed protocols
+	}
+	return nil
+}
+
+// mergeCounts adds src into dst, allocating dst if needed.
+func mergeCounts(dst, src map[string]uint64) map[string]uint64 {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]uint64, len(src))
+	}
+	for k, v := range src {
+		dst[k] += v
+	}
+	return dst
+}
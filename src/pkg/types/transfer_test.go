@@ -0,0 +1,139 @@
+package types
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"unicode"
+)
+
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFlowKeyIsASCII(t *testing.T) {
+	tests := []struct {
+		flow TransferFlow
+		want string
+	}{
+		{
+			TransferFlow{SourceIdentity: ServiceIdentity{Namespace: "shop", Name: "api"}, DestinationIdentity: &ServiceIdentity{Namespace: "shop", Name: "db"}},
+			"shop/api|shop/db",
+		},
+		{
+			TransferFlow{SourceIdentity: ServiceIdentity{Namespace: "shop", Name: "api"}, DestinationEndpoint: &Endpoint{IP: "203.0.113.10"}},
+			"shop/api|203.0.113.10",
+		},
+		{
+			TransferFlow{SourceIdentity: ServiceIdentity{Namespace: "shop", Name: "api"}},
+			"shop/api|unknown",
+		},
+	}
+	for _, tt := range tests {
+		key := tt.flow.FlowKey()
+		if key != tt.want || !isASCII(key) {
+			t.Errorf("key = %q, want ASCII %q", key, tt.want)
+		}
+		src, dst, ok := SplitFlowKey(key)
+		if !ok || JoinFlowKey(src, dst) != key {
+			t.Errorf("split %q into %q and %q (%v), which do not join back", key, src, dst, ok)
+		}
+	}
+
+	if _, _, ok := SplitFlowKey("shop/api→shop/db"); ok {
+		t.Error("split an arrow-separated key")
+	}
+}
+
+func TestParseFlowKey(t *testing.T) {
+	tests := []struct {
+		key          string
+		src, dst     string
+		transferType TransferType
+		ok           bool
+	}{
+		{JoinFlowKey("shop/api", "shop/db"), "shop/api", "shop/db", "", true},
+		{"shop/api|203.0.113.10|egress", "shop/api", "203.0.113.10", TransferTypeEgress, true},
+		{"shop/api", "", "", "", false},
+		{"a|b|c|d", "", "", "", false},
+	}
+	for _, tt := range tests {
+		src, dst, transferType, ok := ParseFlowKey(tt.key)
+		if src != tt.src || dst != tt.dst || transferType != tt.transferType || ok != tt.ok {
+			t.Errorf("ParseFlowKey(%q) = %q, %q, %q, %v", tt.key, src, dst, transferType, ok)
+		}
+	}
+}
+
+func apiToDB(start time.Time, bytes uint64) TransferFlow {
+	return TransferFlow{
+		SourceIdentity:      ServiceIdentity{Namespace: "shop", Name: "api"},
+		DestinationIdentity: &ServiceIdentity{Namespace: "shop", Name: "db"},
+		Type:                TransferTypeServiceToService,
+		Protocol:            "TCP",
+		TotalBytes:          bytes,
+		TotalPackets:        bytes / 100,
+		EventCount:          10,
+		WindowStart:         start,
+		WindowEnd:           start.Add(time.Minute),
+	}
+}
+
+func TestMergeSumsFlows(t *testing.T) {
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	f := apiToDB(start.Add(time.Minute), 6000)
+	f.BytesPerSecondMax = 500
+	f.ByHTTPPath = map[string]uint64{"/orders": 6000}
+
+	other := apiToDB(start, 3000)
+	other.BytesPerSecondMax = 900
+	other.BytesPerSecondP99 = 800
+	other.ByHTTPPath = map[string]uint64{"/orders": 1000, "/users": 2000}
+
+	if err := f.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if f.TotalBytes != 9000 || f.TotalPackets != 90 || f.EventCount != 20 {
+		t.Errorf("totals = %d bytes, %d packets, %d events; want 9000, 90, 20", f.TotalBytes, f.TotalPackets, f.EventCount)
+	}
+	if !f.WindowStart.Equal(start) || !f.WindowEnd.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("window = %s to %s, want both minutes", f.WindowStart, f.WindowEnd)
+	}
+	if f.BytesPerSecondAvg != 75 || f.BytesPerSecondMax != 900 || f.BytesPerSecondP99 != 800 {
+		t.Errorf("rates = avg %v, max %v, p99 %v; want 75, 900, 800", f.BytesPerSecondAvg, f.BytesPerSecondMax, f.BytesPerSecondP99)
+	}
+	if f.ByHTTPPath["/orders"] != 7000 || f.ByHTTPPath["/users"] != 2000 {
+		t.Errorf("by path = %v", f.ByHTTPPath)
+	}
+	if f.Protocol != "TCP" {
+		t.Errorf("protocol = %q, want TCP", f.Protocol)
+	}
+
+	other.Protocol = "UDP"
+	if err := f.Merge(other); err != nil || f.Protocol != "" {
+		t.Errorf("merging another protocol: protocol %q, err %v; want mixed", f.Protocol, err)
+	}
+}
+
+func TestMergeRejectsMismatch(t *testing.T) {
+	start := time.Now()
+	otherDst := apiToDB(start, 100)
+	otherDst.DestinationIdentity = &ServiceIdentity{Namespace: "shop", Name: "cache"}
+	otherType := apiToDB(start, 100)
+	otherType.Type = TransferTypeEgress
+
+	for _, other := range []TransferFlow{otherDst, otherType} {
+		f := apiToDB(start, 100)
+		if err := f.Merge(other); !errors.Is(err, ErrFlowMismatch) {
+			t.Errorf("merging %s (%s): err = %v, want ErrFlowMismatch", other.FlowKey(), other.Type, err)
+		}
+		if f.TotalBytes != 100 {
+			t.Errorf("failed merge changed bytes to %d", f.TotalBytes)
+		}
+	}
+}